@@ -2,27 +2,43 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io/fs"
 	"os"
 	"os/exec"
+	"os/signal"
 	"path/filepath"
+	"runtime"
+	"slices"
+	"strconv"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/charmbracelet/huh"
 	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
 
 	"github.com/atomikpanda/dotular/internal/actions"
 	"github.com/atomikpanda/dotular/internal/ageutil"
 	"github.com/atomikpanda/dotular/internal/audit"
 	"github.com/atomikpanda/dotular/internal/color"
 	"github.com/atomikpanda/dotular/internal/config"
+	"github.com/atomikpanda/dotular/internal/diff"
+	"github.com/atomikpanda/dotular/internal/errs"
+	"github.com/atomikpanda/dotular/internal/export"
+	"github.com/atomikpanda/dotular/internal/httpclient"
+	"github.com/atomikpanda/dotular/internal/machines"
 	"github.com/atomikpanda/dotular/internal/platform"
 	"github.com/atomikpanda/dotular/internal/registry"
+	"github.com/atomikpanda/dotular/internal/runlock"
 	"github.com/atomikpanda/dotular/internal/runner"
 	"github.com/atomikpanda/dotular/internal/scanner"
+	"github.com/atomikpanda/dotular/internal/schedule"
+	"github.com/atomikpanda/dotular/internal/state"
+	"github.com/atomikpanda/dotular/internal/stats"
 	"github.com/atomikpanda/dotular/internal/tags"
 	"github.com/atomikpanda/dotular/internal/ui"
 )
@@ -36,19 +52,66 @@ var (
 var (
 	configFile string
 	dryRun     bool
-	verbose    bool
+	verbosity  int
+	quiet      bool
 	noAtomic   bool
 	noCache    bool
+	accept     bool
+	showDiff   bool
+	wait       bool
+	keepGoing  string
+	onlyTypes  []string
+	skipTypes  []string
+	colorMode  string
+	profile    string
 )
 
 func main() {
 	color.Init()
 	root := buildRoot()
-	if err := root.Execute(); err != nil {
+
+	// The first SIGINT or SIGTERM cancels ctx: the runner stops between
+	// items and rolls back the module in flight. A second one kills the
+	// process outright.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+	err := root.ExecuteContext(ctx)
+	stop()
+	if err != nil {
+		if hint := remedy(err); hint != "" {
+			fmt.Fprintln(os.Stderr, color.Dim("hint: "+hint))
+		}
 		os.Exit(1)
 	}
 }
 
+// remedy returns what the user can do about err, by its kind, or "".
+func remedy(err error) string {
+	switch {
+	case errors.Is(err, errs.ErrModuleNotFound):
+		return "run `dotular list` to see the module and group names"
+	case errors.Is(err, errs.ErrConflict):
+		return "run `dotular sync` in a terminal to choose, or `dotular push`/`dotular pull` to pick a side"
+	case errors.Is(err, errs.ErrChecksumMismatch):
+		return "the content changed since its checksum was pinned; review it, then update the sha256 or re-run with --no-cache to re-lock"
+	case errors.Is(err, errs.ErrAborted):
+		return "the interrupted module was rolled back (unless --no-atomic was set); re-run to finish"
+	case errors.Is(err, errs.ErrLocked):
+		return "wait for that run to finish, or re-run with --wait to queue behind it"
+	case errors.Is(err, errs.ErrNotAccepted):
+		return "review the summary of what the module runs, then re-run with --accept, or in a terminal to be asked"
+	case errors.Is(err, errs.ErrNeedsElevation):
+		if runtime.GOOS == "windows" {
+			return "re-run dotular from an elevated (Run as administrator) terminal"
+		}
+		return "re-run dotular with sudo"
+	}
+	return ""
+}
+
 func buildRoot() *cobra.Command {
 	root := &cobra.Command{
 		Use:   "dotular",
@@ -58,29 +121,76 @@ and Linux using a single YAML file.`,
 		SilenceUsage: true,
 	}
 
-	root.PersistentFlags().StringVarP(&configFile, "config", "c", "dotular.yaml", "path to config file")
+	root.PersistentFlags().StringVarP(&configFile, "config", "c", "", "path to config file (default: dotular.yaml in this or a parent directory, ~/dotfiles, or ~/.dotfiles; or $DOTULAR_CONFIG)")
 	root.PersistentFlags().BoolVar(&dryRun, "dry-run", false, "print actions without executing them")
-	root.PersistentFlags().BoolVarP(&verbose, "verbose", "v", false, "show skipped items and extra output")
+	root.PersistentFlags().CountVarP(&verbosity, "verbose", "v", "show skipped items and extra output (-vv for debug output)")
+	root.PersistentFlags().BoolVarP(&quiet, "quiet", "q", false, "only print errors and the final summary")
+	root.MarkFlagsMutuallyExclusive("quiet", "verbose")
+	root.PersistentFlags().BoolVar(&showDiff, "diff", false, "with --dry-run, show a diff under each file push that would modify its destination")
+	root.PersistentFlags().BoolVar(&wait, "wait", false, "if another dotular run is applying this config, wait for it to finish instead of failing")
 	root.PersistentFlags().BoolVar(&noAtomic, "no-atomic", false, "disable snapshot/rollback per module")
-	root.PersistentFlags().BoolVar(&noCache, "no-cache", false, "re-fetch registry modules from the network")
+	root.PersistentFlags().BoolVar(&noCache, "no-cache", false, "re-fetch registry modules, binaries, and remote scripts from the network")
+	root.PersistentFlags().BoolVar(&accept, "accept", false, "accept community registry modules that have not been reviewed yet, recording them in the lockfile")
+	root.PersistentFlags().StringVar(&keepGoing, "keep-going", "", "continue after failures: skip the rest of the failing module (module) or just the failing item (item)")
+	root.PersistentFlags().Lookup("keep-going").NoOptDefVal = runner.KeepGoingModule
+	root.PersistentFlags().StringSliceVar(&onlyTypes, "only", nil, "only run items of these types (e.g. files,packages)")
+	root.PersistentFlags().StringSliceVar(&skipTypes, "skip", nil, "skip items of these types (e.g. scripts,run)")
+	root.PersistentFlags().StringVar(&profile, "profile", "", "trim the run for an environment: devcontainer, a profile from the config, or none (default: devcontainer inside a container or Codespace)")
+	root.PersistentFlags().StringVar(&colorMode, "color", "", "color output: auto, always, or never (default: the config's color setting, else auto)")
+	root.RegisterFlagCompletionFunc("keep-going", cobra.FixedCompletions([]string{runner.KeepGoingModule, runner.KeepGoingItem}, cobra.ShellCompDirectiveNoFileComp))
+	root.RegisterFlagCompletionFunc("only", completeItemTypes)
+	root.RegisterFlagCompletionFunc("skip", completeItemTypes)
+	root.RegisterFlagCompletionFunc("profile", completeProfiles)
+	root.RegisterFlagCompletionFunc("color", cobra.FixedCompletions([]string{"auto", "always", "never"}, cobra.ShellCompDirectiveNoFileComp))
+	root.PersistentPreRunE = func(cmd *cobra.Command, args []string) error {
+		if colorMode != "" {
+			if err := color.Set(colorMode); err != nil {
+				return fmt.Errorf("--color: %w", err)
+			}
+		}
+		var err error
+		if onlyTypes, err = runner.ParseItemTypes(onlyTypes); err != nil {
+			return fmt.Errorf("--only: %w", err)
+		}
+		if skipTypes, err = runner.ParseItemTypes(skipTypes); err != nil {
+			return fmt.Errorf("--skip: %w", err)
+		}
+		configNotFound = nil
+		if configFile == "" {
+			discoverConfig()
+		}
+		return nil
+	}
 
 	root.AddCommand(
 		versionCmd(),
 		initCmd(),
 		addCmd(),
+		adoptCmd(),
+		editCmd(),
 		applyCmd(),
 		directionCmd("push", "Push repo files to the system (overrides direction on all file items)"),
 		directionCmd("pull", "Pull system files back into the repo (overrides direction on all file items)"),
 		directionCmd("sync", "Sync files bidirectionally, prompting on conflicts (overrides direction on all file items)"),
+		hookSaveCmd(),
 		listCmd(),
+		showCmd(),
 		statusCmd(),
+		planCmd(),
+		cleanCmd(),
+		unapplyCmd(),
 		platformCmd(),
 		verifyCmd(),
+		scheduleCmd(),
 		encryptCmd(),
 		decryptCmd(),
 		tagCmd(),
 		logCmd(),
+		statsCmd(),
+		machinesCmd(),
+		exportCmd(),
 		registryCmd(),
+		updateCmd(),
 	)
 
 	return root
@@ -98,15 +208,71 @@ func versionCmd() *cobra.Command {
 	}
 }
 
+// configNotFound holds the discovery error when no config file was found,
+// so commands that need one can explain where dotular looked.
+var configNotFound error
+
+// discoverConfig sets configFile from config.Discover. When nothing is
+// found it falls back to dotular.yaml in the working directory, which is
+// where init and add create a new config.
+func discoverConfig() {
+	path, err := config.Discover(".")
+	if err != nil {
+		configFile, configNotFound = config.FileName, err
+		return
+	}
+	configFile = path
+}
+
 // loadConfig parses the raw config file without registry resolution.
 func loadConfig() (config.Config, error) {
 	cfg, err := config.Load(configFile)
+	if errors.Is(err, fs.ErrNotExist) {
+		notFound := configNotFound
+		if notFound == nil {
+			notFound = fmt.Errorf("config %q not found", configFile)
+		}
+		return config.Config{}, fmt.Errorf("%w\nrun `dotular init` to create one, or point --config or $%s at an existing config", notFound, config.EnvVar)
+	}
 	if err != nil {
 		return config.Config{}, fmt.Errorf("load config %q: %w", configFile, err)
 	}
+	if err := httpclient.Configure(cfg.HTTP); err != nil {
+		return config.Config{}, err
+	}
+	if err := registry.ConfigureMirrors(cfg.Registry, cfg.HTTP); err != nil {
+		return config.Config{}, err
+	}
+	registry.ConfigureLock(cfg.Lock.Encrypt, ageutil.FromConfig(cfg.Age, cfg.Shell))
+	registry.ConfigureReview(reviewModule)
+	registry.ConfigurePrompt(promptParam)
+	if colorMode == "" && cfg.Color != "" {
+		if err := color.Set(cfg.Color); err != nil {
+			return config.Config{}, err
+		}
+	}
+	if name := profileName(); name != "" {
+		if _, err := runner.LookupProfile(cfg, name); err != nil {
+			return config.Config{}, fmt.Errorf("--profile: %w", err)
+		}
+	}
 	return cfg, nil
 }
 
+// profileName returns the profile to run with: --profile, else the
+// devcontainer profile inside a container. "none" and no profile are "".
+func profileName() string {
+	switch {
+	case profile == "none":
+		return ""
+	case profile != "":
+		return profile
+	case platform.InContainer():
+		return runner.ProfileDevcontainer
+	}
+	return ""
+}
+
 // loadAndResolveConfig parses the config and resolves any registry module
 // references, fetching remote modules and applying param/override logic.
 func loadAndResolveConfig(ctx context.Context) (config.Config, error) {
@@ -114,19 +280,256 @@ func loadAndResolveConfig(ctx context.Context) (config.Config, error) {
 	if err != nil {
 		return config.Config{}, err
 	}
-	u := ui.New(os.Stdout, os.Stderr)
+	u := newUI()
 	return registry.Resolve(ctx, cfg, configFile, noCache, u)
 }
 
+// reviewModule shows what a community registry module would run and asks
+// whether to use it, unless --accept already says so. Without a terminal to
+// ask in, the module is refused.
+func reviewModule(ref string, trust registry.TrustLevel, s registry.Summary) (bool, error) {
+	u := newUI()
+	u.Warn(fmt.Sprintf("%s is a %s registry module that has not been reviewed; it contains:", ref, trust))
+	u.Info(strings.TrimRight(s.String(), "\n"))
+	if accept {
+		return true, nil
+	}
+	if !isTerminal() {
+		return false, nil
+	}
+	var ok bool
+	if err := huh.NewConfirm().Title(fmt.Sprintf("Use %s?", ref)).Value(&ok).Run(); err != nil {
+		return false, err
+	}
+	return ok, nil
+}
+
+// promptParam asks in the terminal for a required registry module param
+// that the config's with: leaves out, and whether to save the answer there.
+// Without a terminal it gives no answer, so the param is reported missing.
+func promptParam(ref, name string, def registry.Param) (*registry.ParamAnswer, error) {
+	if !isTerminal() {
+		return nil, nil
+	}
+	title := fmt.Sprintf("%s: value for param %q", ref, name)
+	ans := &registry.ParamAnswer{Save: true}
+	var field huh.Field
+	if len(def.Enum) > 0 {
+		field = huh.NewSelect[string]().Title(title).Description(def.Description).
+			Options(huh.NewOptions(def.Enum...)...).Value(&ans.Value)
+	} else {
+		field = huh.NewInput().Title(title).Description(def.Description).Value(&ans.Value).
+			Validate(func(s string) error {
+				_, err := registry.ParseParam(def, s)
+				return err
+			})
+	}
+	form := huh.NewForm(huh.NewGroup(
+		field,
+		huh.NewConfirm().Title("Save it under with: in "+filepath.Base(configFile)+"?").Value(&ans.Save),
+	))
+	if err := form.Run(); err != nil {
+		return nil, err
+	}
+	return ans, nil
+}
+
 func newRunner(cfg config.Config) *runner.Runner {
-	return runner.New(cfg, dryRun, verbose, !noAtomic)
+	r := runner.New(cfg, dryRun, verbosity > 0, !noAtomic)
+	r.UI.Level = outputLevel()
+	r.KeepGoing = keepGoing
+	r.OnlyTypes, r.SkipTypes = onlyTypes, skipTypes
+	r.NoCache = noCache
+	r.ShowDiff = showDiff
+	r.Wait = wait
+	r.Root = repoRoot()
+	r.ConfigPath = configFile
+	r.Version = version
+	if name := profileName(); name != "" {
+		// loadConfig has already rejected unknown profiles.
+		if p, err := runner.LookupProfile(cfg, name); err == nil {
+			r.UseProfile(name, p)
+		}
+		if profile == "" && r.Verbose {
+			r.UI.Info(color.Dim("running in a container: using the " + name + " profile (--profile none to disable)"))
+		}
+	}
+	return r
+}
+
+// repoRoot returns the absolute directory of the config file, which module
+// stores are resolved against regardless of the working directory.
+func repoRoot() string {
+	root, err := filepath.Abs(filepath.Dir(configFile))
+	if err != nil {
+		return filepath.Dir(configFile)
+	}
+	return root
+}
+
+// outputLevel maps the --quiet and --verbose flags to a UI level.
+func outputLevel() ui.Level {
+	switch {
+	case quiet:
+		return ui.LevelQuiet
+	case verbosity >= 2:
+		return ui.LevelDebug
+	case verbosity == 1:
+		return ui.LevelVerbose
+	default:
+		return ui.LevelNormal
+	}
+}
+
+// newUI returns a terminal UI honouring the output level flags.
+func newUI() *ui.UI {
+	u := ui.New(os.Stdout, os.Stderr)
+	u.Level = outputLevel()
+	return u
+}
+
+// --- completion --------------------------------------------------------------
+
+// completionConfig loads the raw config for shell completion. Completion
+// runs without the root's PersistentPreRunE, so the config is discovered
+// here, and registry modules are not fetched.
+func completionConfig() (config.Config, bool) {
+	if configFile == "" {
+		discoverConfig()
+	}
+	cfg, err := config.Load(configFile)
+	return cfg, err == nil
+}
+
+// moduleCompletions lists the config's module and group names, each with
+// its registry ref as the description when it has one.
+func moduleCompletions(cfg config.Config) []string {
+	var names []string
+	seen := make(map[string]bool)
+	add := func(name, desc string) {
+		if name == "" || seen[name] {
+			return
+		}
+		seen[name] = true
+		if desc != "" {
+			name += "\t" + desc
+		}
+		names = append(names, name)
+	}
+	for _, mod := range cfg.Modules {
+		for _, group := range mod.Groups {
+			add(group, "group")
+		}
+		add(mod.Name, mod.From)
+	}
+	return names
+}
+
+// completeModules completes module and group names for up to max
+// arguments (no limit when max is 0), leaving out ones already given.
+func completeModules(max int) func(*cobra.Command, []string, string) ([]string, cobra.ShellCompDirective) {
+	return func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		if max > 0 && len(args) >= max {
+			return nil, cobra.ShellCompDirectiveNoFileComp
+		}
+		cfg, ok := completionConfig()
+		if !ok {
+			return nil, cobra.ShellCompDirectiveNoFileComp
+		}
+		var names []string
+		for _, name := range moduleCompletions(cfg) {
+			if !slices.Contains(args, strings.SplitN(name, "\t", 2)[0]) {
+				names = append(names, name)
+			}
+		}
+		return names, cobra.ShellCompDirectiveNoFileComp
+	}
+}
+
+// configTags lists the tags the config's modules and profiles mention and
+// the tags already set on this machine.
+func configTags(cfg config.Config) []string {
+	var all []string
+	for _, mod := range cfg.Modules {
+		all = append(all, mod.OnlyTags...)
+		all = append(all, mod.ExcludeTags...)
+		for _, groupTags := range mod.GroupOnlyTags {
+			all = append(all, groupTags...)
+		}
+	}
+	for _, p := range cfg.Profiles {
+		all = append(all, p.Tags...)
+	}
+	if mc, err := tags.Load(); err == nil {
+		all = append(all, mc.Tags...)
+	}
+	slices.Sort(all)
+	return slices.Compact(all)
+}
+
+// completeTags completes tag names for --tags.
+func completeTags(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	cfg, _ := completionConfig()
+	return listCompletions(configTags(cfg), toComplete), cobra.ShellCompDirectiveNoFileComp
+}
+
+// completeNewTag completes tag add with the config's tags this machine
+// does not have yet.
+func completeNewTag(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	if len(args) > 0 {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	cfg, _ := completionConfig()
+	var have []string
+	if mc, err := tags.Load(); err == nil {
+		have = mc.Tags
+	}
+	var out []string
+	for _, t := range configTags(cfg) {
+		if !slices.Contains(have, t) {
+			out = append(out, t)
+		}
+	}
+	return out, cobra.ShellCompDirectiveNoFileComp
+}
+
+// completeProfiles completes --profile with the built-in and configured
+// profiles and none.
+func completeProfiles(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	cfg, _ := completionConfig()
+	return append(runner.ProfileNames(cfg), "none"), cobra.ShellCompDirectiveNoFileComp
+}
+
+// completeItemTypes completes comma-separated item types for --only,
+// --skip, and list --type.
+func completeItemTypes(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	return listCompletions(runner.ItemTypes(), toComplete), cobra.ShellCompDirectiveNoFileComp
+}
+
+// listCompletions completes the last element of a comma-separated flag
+// value from values, keeping the elements before it as a prefix and
+// leaving out values already given.
+func listCompletions(values []string, toComplete string) []string {
+	prefix := ""
+	var given []string
+	if i := strings.LastIndex(toComplete, ","); i >= 0 {
+		prefix = toComplete[:i+1]
+		given = strings.Split(toComplete[:i], ",")
+	}
+	var out []string
+	for _, v := range values {
+		if !slices.Contains(given, v) {
+			out = append(out, prefix+v)
+		}
+	}
+	return out
 }
 
 // --- add ---------------------------------------------------------------------
 
 func addCmd() *cobra.Command {
-	var link bool
-	var direction string
+	var link, inPlace, encrypt bool
+	var direction, destination string
 
 	cmd := &cobra.Command{
 		Use:   "add <path> [module]",
@@ -135,12 +538,28 @@ func addCmd() *cobra.Command {
 the module name is optional — if omitted, dotular will try to infer it
 from the registry or prompt you interactively. If the module doesn't exist
 it is created. Copies (or symlinks with --link) the path into the module's
-managed store and records it in the config YAML.`,
+managed store and records it in the config YAML.
+
+With --in-place a path that is already inside the repo is recorded where it
+is, relative to the module's store, instead of being copied; --destination
+then says where it deploys to.
+
+With --encrypt a file is stored as <name>.age, encrypted with the key from the
+config's age section (or DOTULAR_AGE_IDENTITY / DOTULAR_AGE_PASSPHRASE), and
+the item is marked encrypted. Without a key nothing is added.`,
 		Example: `  dotular add ~/.config/nvim nvim
   dotular add ~/.config/nvim/init.lua nvim --link
   dotular add ~/.zshrc shell --direction sync
-  dotular add ~/.zshrc`,
+  dotular add ~/.zshrc
+  dotular add shell/zshrc.d shell --in-place --destination ~/.config/zsh
+  dotular add ~/.ssh/config ssh --encrypt`,
 		Args: cobra.RangeArgs(1, 2),
+		ValidArgsFunction: func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+			if len(args) == 0 {
+				return nil, cobra.ShellCompDirectiveDefault
+			}
+			return completeModules(2)(cmd, args, toComplete)
+		},
 		RunE: func(cmd *cobra.Command, args []string) error {
 			ctx := cmd.Context()
 			if ctx == nil {
@@ -176,77 +595,83 @@ managed store and records it in the config YAML.`,
 			isDir := info.IsDir()
 			baseName := filepath.Base(absSrc)
 
-			// Determine where the config file lives so we can compute
-			// the module store directory relative to it.
-			cfgDir := filepath.Dir(configFile)
-			if !filepath.IsAbs(cfgDir) {
-				cfgDir, _ = filepath.Abs(cfgDir)
-			}
-			moduleDir := filepath.Join(cfgDir, moduleName)
+			moduleDir := moduleStoreDir(moduleName)
+			dest := filepath.Join(moduleDir, baseName)
+			itemPath := baseName
 
-			// Create the module store directory.
-			if err := os.MkdirAll(moduleDir, 0o755); err != nil {
-				return fmt.Errorf("create module directory: %w", err)
+			// The source's parent directory becomes a portable per-OS
+			// destination unless --destination names one for this platform.
+			destMap := portableDestination(filepath.Dir(absSrc), platform.Current(), platform.Getenv)
+			if destination != "" {
+				destMap = currentPlatformMap(destination)
 			}
 
-			dest := filepath.Join(moduleDir, baseName)
-
-			// Copy the file or directory into the store.
-			if isDir {
-				if err := copyDirRecursive(absSrc, dest); err != nil {
-					return fmt.Errorf("copy directory: %w", err)
+			// --encrypt needs a key up front so that nothing is captured
+			// in plaintext when encryption is impossible.
+			var key *ageutil.Key
+			if encrypt {
+				switch {
+				case isDir:
+					return fmt.Errorf("--encrypt works on files, not directories")
+				case inPlace:
+					return fmt.Errorf("--encrypt cannot be combined with --in-place")
+				case link:
+					return fmt.Errorf("--encrypt cannot be combined with --link: a symlink would expose the ciphertext")
 				}
-			} else {
-				if err := copyFileSimple(absSrc, dest); err != nil {
-					return fmt.Errorf("copy file: %w", err)
+				if key, err = keyFromConfig(); err != nil {
+					return err
 				}
 			}
 
-			// Determine the destination platform map — use the parent
-			// directory of the source path as the destination for the
-			// current platform.
-			srcParent := filepath.Dir(absSrc)
-			pmap := config.PlatformMap{}
-			switch platform.Current() {
-			case "darwin":
-				pmap.MacOS = srcParent
-			case "windows":
-				pmap.Windows = srcParent
-			case "linux":
-				pmap.Linux = srcParent
-			}
+			if inPlace {
+				// The path already lives in the repo: record it relative
+				// to the module's store instead of copying it.
+				if destination == "" {
+					return fmt.Errorf("--in-place requires --destination: %s is already in the repo, so where it deploys to cannot be inferred", absSrc)
+				}
+				if !isWithin(absSrc, repoRoot()) {
+					return fmt.Errorf("%s is not inside the repo %s; add it without --in-place to copy it into the store", absSrc, repoRoot())
+				}
+				rel, err := filepath.Rel(moduleDir, absSrc)
+				if err != nil {
+					return fmt.Errorf("resolve path: %w", err)
+				}
+				itemPath, dest = filepath.ToSlash(rel), absSrc
+			} else {
+				// Create the module store directory.
+				if err := os.MkdirAll(moduleDir, 0o755); err != nil {
+					return fmt.Errorf("create module directory: %w", err)
+				}
 
-			// Load the existing config (or start fresh if it doesn't exist).
-			cfg, err := loadConfig()
-			if err != nil && !errors.Is(err, fs.ErrNotExist) {
-				return err
+				// Copy the file or directory into the store.
+				if isDir {
+					if err := copyDirRecursive(absSrc, dest); err != nil {
+						return fmt.Errorf("copy directory: %w", err)
+					}
+				} else if encrypt {
+					dest = ageutil.RepoPath(dest)
+					if err := key.EncryptFile(absSrc, dest); err != nil {
+						return fmt.Errorf("encrypt file: %w", err)
+					}
+				} else {
+					if err := copyFileSimple(absSrc, dest); err != nil {
+						return fmt.Errorf("copy file: %w", err)
+					}
+				}
 			}
 
-			// Build the new item.
 			item := config.Item{
-				Destination: pmap,
+				Destination: destMap,
 				Direction:   direction,
 				Link:        link,
+				Encrypted:   encrypt,
 			}
 			if isDir {
-				item.Directory = baseName
-			} else {
-				item.File = baseName
-			}
-
-			// Find or create the module.
-			mod := cfg.Module(moduleName)
-			if mod == nil {
-				cfg.Modules = append(cfg.Modules, config.Module{
-					Name:  moduleName,
-					Items: []config.Item{item},
-				})
+				item.Directory = itemPath
 			} else {
-				mod.Items = append(mod.Items, item)
+				item.File = itemPath
 			}
-
-			// Write the config back.
-			if err := config.Save(configFile, cfg); err != nil {
+			if err := saveItem(moduleName, item); err != nil {
 				return err
 			}
 
@@ -254,8 +679,8 @@ managed store and records it in the config YAML.`,
 			if isDir {
 				typeStr = "directory"
 			}
-			u := ui.New(os.Stdout, os.Stderr)
-			u.Success(fmt.Sprintf("added %s %q to module %q", typeStr, baseName, moduleName))
+			u := newUI()
+			u.Success(fmt.Sprintf("added %s %q to module %q", typeStr, itemPath, moduleName))
 			u.Info(fmt.Sprintf("  store: %s", dest))
 			u.Info(fmt.Sprintf("  config: %s", configFile))
 			return nil
@@ -264,11 +689,115 @@ managed store and records it in the config YAML.`,
 
 	cmd.Flags().BoolVar(&link, "link", false, "use symlink instead of copy at apply time")
 	cmd.Flags().StringVar(&direction, "direction", "push", "file direction: push, pull, or sync")
+	cmd.Flags().BoolVar(&encrypt, "encrypt", false, "store the file age-encrypted with the configured key")
+	cmd.Flags().BoolVar(&inPlace, "in-place", false, "record a path already inside the repo where it is instead of copying it")
+	cmd.Flags().StringVar(&destination, "destination", "", "directory to deploy to on this platform (default: the path's parent directory)")
 	return cmd
 }
 
+// currentPlatformMap returns a PlatformMap with value set for the current OS.
+func currentPlatformMap(value string) config.PlatformMap {
+	return platformMapFor(platform.Current(), value)
+}
+
+// platformMapFor returns a PlatformMap with value set for goos only.
+func platformMapFor(goos, value string) config.PlatformMap {
+	pmap := config.PlatformMap{}
+	switch goos {
+	case "darwin":
+		pmap.MacOS = value
+	case "windows":
+		pmap.Windows = value
+	case "linux":
+		pmap.Linux = value
+	}
+	return pmap
+}
+
+// portableDestination maps dir, a directory on this machine, to equivalent
+// destinations on every platform. Paths under the platform's config home —
+// ~/Library/Application Support, $XDG_CONFIG_HOME (~/.config), or %APPDATA% —
+// are rewritten relative to each platform's counterpart, and other paths
+// under the home directory become ~/ paths. Anything else is recorded for
+// the current platform only.
+func portableDestination(dir, goos string, getenv func(string) string) config.PlatformMap {
+	home := getenv("HOME")
+	if goos == "windows" {
+		home = getenv("USERPROFILE")
+	}
+	within := func(base string) (string, bool) {
+		if base == "" || !isWithin(dir, base) {
+			return "", false
+		}
+		rel, err := filepath.Rel(base, dir)
+		if err != nil {
+			return "", false
+		}
+		if rel == "." {
+			return "", true
+		}
+		return "/" + filepath.ToSlash(rel), true
+	}
+	configHome := func(rel string) config.PlatformMap {
+		return config.PlatformMap{
+			MacOS:   "~/Library/Application Support" + rel,
+			Linux:   "$XDG_CONFIG_HOME" + rel,
+			Windows: "%APPDATA%" + rel,
+		}
+	}
+
+	switch goos {
+	case "darwin":
+		if rel, ok := within(filepath.Join(home, "Library", "Application Support")); ok {
+			return configHome(rel)
+		}
+	case "windows":
+		if rel, ok := within(getenv("APPDATA")); ok {
+			return configHome(rel)
+		}
+	}
+	if goos != "windows" {
+		// CLI tools read ~/.config on macOS too, so keep it there.
+		if rel, ok := within(getenv("XDG_CONFIG_HOME")); ok {
+			pm := configHome(rel)
+			pm.MacOS = "$XDG_CONFIG_HOME" + rel
+			return pm
+		}
+	}
+	if rel, ok := within(home); ok {
+		return config.PlatformMap{MacOS: "~" + rel, Linux: "~" + rel, Windows: "~" + rel}
+	}
+	return platformMapFor(goos, dir)
+}
+
+// saveItem appends item to the named module in the config file, creating the
+// config and the module as needed.
+func saveItem(moduleName string, item config.Item) error {
+	cfg, err := loadConfig()
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	if mod := cfg.Module(moduleName); mod != nil {
+		mod.Items = append(mod.Items, item)
+	} else {
+		cfg.Modules = append(cfg.Modules, config.Module{
+			Name:  moduleName,
+			Items: []config.Item{item},
+		})
+	}
+	return config.Save(configFile, cfg)
+}
+
+// moduleStoreDir returns the absolute path of a module's managed store,
+// following the config's store settings: by default the directory next to
+// the config file named after the module.
+func moduleStoreDir(moduleName string) string {
+	cfg, _ := loadConfig() // a missing config uses the default layout
+	return cfg.StoreDir(repoRoot(), moduleName)
+}
+
 func inferModuleName(ctx context.Context, absPath string) (string, error) {
-	u := ui.New(os.Stdout, os.Stderr)
+	u := newUI()
 
 	// Try registry-based inference.
 	entries, err := registry.FetchIndex(ctx, u)
@@ -335,7 +864,8 @@ func copyFileSimple(src, dst string) error {
 	return os.WriteFile(dst, data, info.Mode().Perm())
 }
 
-// copyDirRecursive copies a directory tree from src to dst.
+// copyDirRecursive copies a directory tree from src to dst. Symlinks are
+// copied as symlinks with the same target.
 func copyDirRecursive(src, dst string) error {
 	return filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
 		if err != nil {
@@ -346,147 +876,1376 @@ func copyDirRecursive(src, dst string) error {
 			return err
 		}
 		target := filepath.Join(dst, rel)
-		if d.IsDir() {
+		switch {
+		case d.Type()&fs.ModeSymlink != 0:
+			link, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(link, target)
+		case d.IsDir():
 			return os.MkdirAll(target, 0o755)
 		}
 		return copyFileSimple(path, target)
 	})
 }
 
-// --- apply -------------------------------------------------------------------
+// --- adopt -------------------------------------------------------------------
 
-func applyCmd() *cobra.Command {
-	return &cobra.Command{
-		Use:   "apply [module...]",
-		Short: "Apply modules (all if none specified)",
-		Example: `  dotular apply
-  dotular apply homebrew "Visual Studio Code"
-  dotular apply --dry-run
-  dotular apply --no-atomic`,
+func adoptCmd() *cobra.Command {
+	var copyMode bool
+
+	cmd := &cobra.Command{
+		Use:   "adopt <module> <path>",
+		Short: "Take over an existing file, directory, or symlink",
+		Long: `Adopts a path that is already in place — a plain file or directory, or a
+symlink created by another tool such as stow. The real content is moved into
+the module's store and the original path is replaced with a symlink to it,
+then a link item is recorded in the config. With --copy the content is
+copied instead and a copy item is recorded, leaving the original untouched.
+
+If the path is already a symlink into the module's store, only the config
+item is recorded.`,
+		Example: `  dotular adopt shell ~/.zshrc
+  dotular adopt nvim ~/.config/nvim
+  dotular adopt git ~/.gitconfig --copy`,
+		Args: cobra.ExactArgs(2),
+		ValidArgsFunction: func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+			if len(args) == 1 {
+				return nil, cobra.ShellCompDirectiveDefault
+			}
+			return completeModules(1)(cmd, args, toComplete)
+		},
 		RunE: func(cmd *cobra.Command, args []string) error {
-			ctx := context.Background()
-			cfg, err := loadAndResolveConfig(ctx)
+			moduleName := args[0]
+			absPath, err := filepath.Abs(platform.ExpandPath(args[1]))
 			if err != nil {
-				return err
+				return fmt.Errorf("resolve path: %w", err)
 			}
-			r := newRunner(cfg)
-
-			if len(args) == 0 {
-				return r.ApplyAll(ctx)
+			linfo, err := os.Lstat(absPath)
+			if err != nil {
+				return fmt.Errorf("stat %q: %w", absPath, err)
 			}
-			for _, name := range args {
-				mod := cfg.Module(name)
-				if mod == nil {
-					return fmt.Errorf("module %q not found in config", name)
+
+			baseName := filepath.Base(absPath)
+			moduleDir := moduleStoreDir(moduleName)
+			storePath := filepath.Join(moduleDir, baseName)
+			u := newUI()
+
+			// realPath holds the content to adopt: the path itself, or the
+			// target of a symlink.
+			realPath := absPath
+			alreadyLinked := false
+			if linfo.Mode()&os.ModeSymlink != 0 {
+				realPath, err = filepath.EvalSymlinks(absPath)
+				if err != nil {
+					return fmt.Errorf("resolve symlink %q: %w", absPath, err)
 				}
-				result := r.ApplyModule(ctx, *mod)
-				if result.Err != nil {
-					return result.Err
+				storeReal, _ := filepath.EvalSymlinks(storePath)
+				alreadyLinked = storeReal != "" && storeReal == realPath
+				if !alreadyLinked && isWithin(realPath, moduleDir) {
+					return fmt.Errorf("%s links to %s inside module %q's store, but not to %s; rename it or use dotular add",
+						absPath, realPath, moduleName, storePath)
 				}
 			}
-			return nil
-		},
-	}
-}
-
-// --- push / pull / sync ------------------------------------------------------
-
-func directionCmd(direction, short string) *cobra.Command {
-	return &cobra.Command{
-		Use:   fmt.Sprintf("%s [module...]", direction),
-		Short: short,
-		Example: fmt.Sprintf(`  dotular %[1]s
-  dotular %[1]s "Visual Studio Code"
-  dotular %[1]s --dry-run`, direction),
-		RunE: func(cmd *cobra.Command, args []string) error {
-			ctx := context.Background()
-			cfg, err := loadAndResolveConfig(ctx)
+			info, err := os.Stat(realPath)
 			if err != nil {
-				return err
+				return fmt.Errorf("stat %q: %w", realPath, err)
 			}
-			r := newRunner(cfg)
-			r.Command = direction
-			r.DirectionOverride = direction
+			isDir := info.IsDir()
 
-			if len(args) == 0 {
-				return r.ApplyAll(ctx)
+			if !dryRun {
+				lock, err := lockConfig(cmd.Context(), "adopt")
+				if err != nil {
+					return err
+				}
+				defer lock.Release()
 			}
-			for _, name := range args {
-				mod := cfg.Module(name)
-				if mod == nil {
-					return fmt.Errorf("module %q not found in config", name)
+			if !alreadyLinked {
+				if _, err := os.Lstat(storePath); err == nil {
+					return fmt.Errorf("%s already exists in module %q's store", baseName, moduleName)
+				}
+				if dryRun {
+					verb := "move"
+					if copyMode {
+						verb = "copy"
+					}
+					u.DryRun(fmt.Sprintf("%s %s -> %s", verb, realPath, storePath))
+					if !copyMode {
+						u.DryRun(fmt.Sprintf("link %s -> %s", absPath, storePath))
+					}
+					return nil
 				}
-				result := r.ApplyModule(ctx, *mod)
-				if result.Err != nil {
-					return result.Err
+				if err := os.MkdirAll(moduleDir, 0o755); err != nil {
+					return fmt.Errorf("create module directory: %w", err)
 				}
+				if copyMode {
+					err = copyPath(realPath, storePath, isDir)
+				} else {
+					err = adoptIntoStore(absPath, realPath, storePath, isDir)
+				}
+				if err != nil {
+					return err
+				}
+			} else if dryRun {
+				u.DryRun(fmt.Sprintf("record %s (already linked to %s)", absPath, storePath))
+				return nil
+			}
+
+			item := config.Item{
+				Destination: currentPlatformMap(filepath.Dir(absPath)),
+				Link:        !copyMode,
+			}
+			if isDir {
+				item.Directory = baseName
+			} else {
+				item.File = baseName
+			}
+			if err := saveItem(moduleName, item); err != nil {
+				return err
+			}
+			if !copyMode {
+				recordAdopted(configFile, moduleName, absPath, storePath)
 			}
+
+			typeStr := "file"
+			if isDir {
+				typeStr = "directory"
+			}
+			u.Success(fmt.Sprintf("adopted %s %q into module %q", typeStr, baseName, moduleName))
+			u.Info(fmt.Sprintf("  store: %s", storePath))
+			u.Info(fmt.Sprintf("  config: %s", configFile))
 			return nil
 		},
 	}
+
+	cmd.Flags().BoolVar(&copyMode, "copy", false, "copy into the store and record a copy item instead of linking")
+	return cmd
 }
 
-// --- list --------------------------------------------------------------------
+// adoptIntoStore moves realPath into storePath and points linkPath (which is
+// realPath itself, or a symlink to it) at the store.
+func adoptIntoStore(linkPath, realPath, storePath string, isDir bool) error {
+	if err := movePath(realPath, storePath, isDir); err != nil {
+		return fmt.Errorf("move into store: %w", err)
+	}
+	if _, err := os.Lstat(linkPath); err == nil {
+		if err := os.Remove(linkPath); err != nil {
+			return fmt.Errorf("remove %s: %w", linkPath, err)
+		}
+	}
+	if err := os.Symlink(storePath, linkPath); err != nil {
+		return fmt.Errorf("link %s: %w", linkPath, err)
+	}
+	return nil
+}
 
-func listCmd() *cobra.Command {
-	return &cobra.Command{
+// movePath renames src to dst, falling back to copy-and-delete across
+// filesystems.
+func movePath(src, dst string, isDir bool) error {
+	if err := os.Rename(src, dst); err == nil {
+		return nil
+	}
+	if err := copyPath(src, dst, isDir); err != nil {
+		return err
+	}
+	return os.RemoveAll(src)
+}
+
+func copyPath(src, dst string, isDir bool) error {
+	if isDir {
+		return copyDirRecursive(src, dst)
+	}
+	return copyFileSimple(src, dst)
+}
+
+// isWithin reports whether path is dir or lies beneath it.
+func isWithin(path, dir string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// lockConfig takes the run lock of the config for a command that changes
+// what is deployed without going through the runner.
+func lockConfig(ctx context.Context, command string) (*runlock.Lock, error) {
+	path, err := runlock.Path(configFile)
+	if err != nil {
+		return nil, fmt.Errorf("lock: %w", err)
+	}
+	return runlock.Acquire(ctx, path, command, nil)
+}
+
+// recordAdopted notes an adopted symlink in the state file so that clean can
+// track it like one dotular deployed itself from the config at cfgPath.
+func recordAdopted(cfgPath, moduleName, linkPath, storePath string) {
+	path, err := state.DefaultPath()
+	if err != nil {
+		return
+	}
+	st, err := state.Load(path)
+	if err != nil {
+		return
+	}
+	if abs, err := filepath.Abs(cfgPath); err == nil {
+		cfgPath = abs
+	}
+	st.Record(state.Resource{Kind: state.KindSymlink, Path: linkPath, Source: storePath, Module: moduleName, Config: cfgPath})
+	st.Save(path)
+}
+
+// --- edit --------------------------------------------------------------------
+
+func editCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "edit [module] [item]",
+		Short: "Open the config or a module's stored files in $EDITOR",
+		Long: `With no arguments, opens the config file in $VISUAL or $EDITOR, then
+validates it and shows a diff of what changed. If the edited config is invalid
+you are offered the chance to re-open it.
+
+With a module name, opens that module's stored files and directories; an item
+name (a file or directory name) narrows it to one. Encrypted files are
+decrypted to a temporary file for editing and re-encrypted on save.`,
+		Example: `  dotular edit
+  dotular edit shell
+  dotular edit shell .zshrc`,
+		Args:              cobra.MaximumNArgs(2),
+		ValidArgsFunction: completeEditArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) == 0 {
+				return editConfig()
+			}
+			cfg, err := loadConfig()
+			if err != nil {
+				return err
+			}
+			itemName := ""
+			if len(args) == 2 {
+				itemName = args[1]
+			}
+			items, err := editableItems(cfg, args[0], itemName)
+			if err != nil {
+				return err
+			}
+			return editItems(args[0], items)
+		},
+	}
+}
+
+// completeItems completes --item with the primary values of the one
+// module named on the command line.
+func completeItems(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	cfg, ok := completionConfig()
+	if !ok || len(args) != 1 {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	mod := cfg.Module(args[0])
+	if mod == nil {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	var values []string
+	for i, item := range mod.Items {
+		value := item.PrimaryValue()
+		if item.Name != "" {
+			value = item.Name
+		}
+		values = append(values, fmt.Sprintf("%s\titem %d, %s", value, i+1, item.Type()))
+	}
+	return values, cobra.ShellCompDirectiveNoFileComp
+}
+
+// completeRegistryRefs completes the registry refs the config uses.
+func completeRegistryRefs(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	cfg, ok := completionConfig()
+	if !ok {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	var refs []string
+	for ref := range registry.CollectActiveRefs(cfg) {
+		if !slices.Contains(args, ref) {
+			refs = append(refs, ref)
+		}
+	}
+	slices.Sort(refs)
+	return refs, cobra.ShellCompDirectiveNoFileComp
+}
+
+// completeEditArgs completes edit's module, then the module's file and
+// directory item names.
+func completeEditArgs(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	switch len(args) {
+	case 0:
+		return completeModules(1)(cmd, args, toComplete)
+	case 1:
+		cfg, ok := completionConfig()
+		if !ok {
+			break
+		}
+		items, err := editableItems(cfg, args[0], "")
+		if err != nil {
+			break
+		}
+		var names []string
+		for _, item := range items {
+			name := item.File
+			if name == "" {
+				name = item.Directory
+			}
+			names = append(names, name)
+		}
+		return names, cobra.ShellCompDirectiveNoFileComp
+	}
+	return nil, cobra.ShellCompDirectiveNoFileComp
+}
+
+// editorCommand returns the user's preferred editor command.
+func editorCommand() string {
+	for _, env := range []string{"VISUAL", "EDITOR"} {
+		if e := strings.TrimSpace(os.Getenv(env)); e != "" {
+			return e
+		}
+	}
+	if runtime.GOOS == "windows" {
+		return "notepad"
+	}
+	return "vi"
+}
+
+// runEditor opens paths in the editor, attached to the terminal. The editor
+// command may include arguments (e.g. "code --wait").
+func runEditor(paths ...string) error {
+	editor := editorCommand()
+	var c *exec.Cmd
+	if runtime.GOOS == "windows" {
+		fields := strings.Fields(editor)
+		c = exec.Command(fields[0], append(fields[1:], paths...)...)
+	} else {
+		c = exec.Command("sh", append([]string{"-c", editor + ` "$@"`, editor}, paths...)...)
+	}
+	c.Stdin, c.Stdout, c.Stderr = os.Stdin, os.Stdout, os.Stderr
+	if err := c.Run(); err != nil {
+		return fmt.Errorf("editor %q: %w", editor, err)
+	}
+	return nil
+}
+
+// editConfig opens the config file, then validates it and shows the diff.
+func editConfig() error {
+	u := newUI()
+	before, err := os.ReadFile(configFile)
+	if err != nil {
+		return fmt.Errorf("read config: %w", err)
+	}
+	for {
+		if err := runEditor(configFile); err != nil {
+			return err
+		}
+		after, err := os.ReadFile(configFile)
+		if err != nil {
+			return fmt.Errorf("read config: %w", err)
+		}
+		d := diff.Unified(configFile+" (before)", configFile, string(before), string(after), 3)
+		if d == "" {
+			u.Info("no changes")
+			return nil
+		}
+		fmt.Fprint(u.Out, diff.Colorize(d))
+
+		verr := validateConfigFile(configFile)
+		if verr == nil {
+			u.Success("config is valid")
+			return nil
+		}
+		u.Warn("config is invalid:\n" + verr.Error())
+		if !isTerminal() {
+			return fmt.Errorf("%s is invalid", configFile)
+		}
+		reopen := true
+		if err := huh.NewConfirm().Title("Re-open the editor?").Value(&reopen).Run(); err != nil || !reopen {
+			return fmt.Errorf("%s is invalid", configFile)
+		}
+	}
+}
+
+func validateConfigFile(path string) error {
+	cfg, err := config.Load(path)
+	if err != nil {
+		return err
+	}
+	return cfg.Validate()
+}
+
+// editableItems returns the module's file and directory items, narrowed to
+// the one named itemName when it is non-empty.
+func editableItems(cfg config.Config, moduleName, itemName string) ([]config.Item, error) {
+	mod := cfg.Module(moduleName)
+	if mod == nil {
+		return nil, fmt.Errorf("%w: %q", errs.ErrModuleNotFound, moduleName)
+	}
+	if mod.IsRegistry() {
+		return nil, fmt.Errorf("module %q comes from the registry and has no stored files; use override to replace its items", moduleName)
+	}
+	var items []config.Item
+	for _, item := range mod.Items {
+		name := item.File
+		if name == "" {
+			name = item.Directory
+		}
+		if name == "" {
+			continue
+		}
+		if itemName != "" && name != itemName && filepath.Base(name) != itemName {
+			continue
+		}
+		items = append(items, item)
+	}
+	if len(items) == 0 {
+		if itemName != "" {
+			return nil, fmt.Errorf("module %q has no file or directory item %q", moduleName, itemName)
+		}
+		return nil, fmt.Errorf("module %q has no file or directory items", moduleName)
+	}
+	return items, nil
+}
+
+// editItems opens the stored copies of items in the editor and shows a diff
+// for each file that changed. Encrypted files are edited through a decrypted
+// temporary copy.
+func editItems(moduleName string, items []config.Item) error {
+	u := newUI()
+	storeDir := moduleStoreDir(moduleName)
+
+	type edited struct {
+		stored, path string // stored path in the repo; path opened in the editor
+		before       []byte
+		encrypted    bool
+		isDir        bool
+	}
+	var files []edited
+	var key *ageutil.Key
+	for _, item := range items {
+		if item.Directory != "" {
+			files = append(files, edited{stored: filepath.Join(storeDir, item.Directory), isDir: true})
+			continue
+		}
+		e := edited{stored: filepath.Join(storeDir, item.File), encrypted: item.Encrypted}
+		if item.Encrypted {
+			e.stored = ageutil.RepoPath(e.stored)
+			if key == nil {
+				var err error
+				if key, err = keyFromConfig(); err != nil {
+					return err
+				}
+			}
+			tmpDir, err := os.MkdirTemp("", "dotular-edit-*")
+			if err != nil {
+				return err
+			}
+			defer os.RemoveAll(tmpDir)
+			e.path = filepath.Join(tmpDir, strings.TrimSuffix(filepath.Base(e.stored), ".age"))
+			if err := key.DecryptFile(e.stored, e.path); err != nil {
+				return fmt.Errorf("decrypt %s: %w", e.stored, err)
+			}
+		}
+		files = append(files, e)
+	}
+
+	paths := make([]string, len(files))
+	for i := range files {
+		if files[i].path == "" {
+			files[i].path = files[i].stored
+		}
+		paths[i] = files[i].path
+		if !files[i].isDir {
+			files[i].before, _ = os.ReadFile(files[i].path)
+		}
+	}
+	if err := runEditor(paths...); err != nil {
+		return err
+	}
+
+	for _, f := range files {
+		if f.isDir {
+			continue
+		}
+		after, err := os.ReadFile(f.path)
+		if err != nil {
+			return fmt.Errorf("read %s: %w", f.path, err)
+		}
+		d := diff.Unified(f.stored+" (before)", f.stored, string(f.before), string(after), 3)
+		if d == "" {
+			continue
+		}
+		fmt.Fprint(u.Out, diff.Colorize(d))
+		if f.encrypted {
+			if err := key.EncryptFile(f.path, f.stored); err != nil {
+				return fmt.Errorf("re-encrypt %s: %w", f.stored, err)
+			}
+			u.Success("re-encrypted " + f.stored)
+		}
+	}
+	return nil
+}
+
+// --- apply -------------------------------------------------------------------
+
+func applyCmd() *cobra.Command {
+	var changedOnly bool
+	var item string
+	cmd := &cobra.Command{
+		Use:   "apply [module...]",
+		Short: "Apply modules (all if none specified)",
+		Example: `  dotular apply
+  dotular apply homebrew "Visual Studio Code"
+  dotular apply 'shell*' '!shell-legacy'
+  dotular apply --dry-run
+  dotular apply --changed-only
+  dotular apply shell --item .zshrc
+  dotular apply homebrew --item 3
+  dotular apply --no-atomic`,
+		ValidArgsFunction: completeModules(0),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+			cfg, err := loadAndResolveConfig(ctx)
+			if err != nil {
+				return err
+			}
+			r := newRunner(cfg)
+			r.ChangedOnly = changedOnly
+
+			if len(args) == 0 {
+				if item != "" {
+					return errors.New("--item needs the module to apply, e.g. dotular apply shell --item .zshrc")
+				}
+				return r.ApplyAll(ctx)
+			}
+			mods, err := cfg.Select(args)
+			if err != nil {
+				return err
+			}
+			if item != "" {
+				if len(mods) != 1 {
+					return fmt.Errorf("--item needs exactly one module, got %d", len(mods))
+				}
+				if _, err := mods[0].FindItem(item); err != nil {
+					return err
+				}
+				r.Item = item
+			}
+			return r.ApplyModules(ctx, mods)
+		},
+	}
+	cmd.Flags().BoolVar(&changedOnly, "changed-only", false, "skip modules whose config and store files are unchanged since their last successful apply")
+	cmd.Flags().StringVar(&item, "item", "", "apply only this item of the module: its position (1 is the first) or its package, file, or other primary value")
+	cmd.RegisterFlagCompletionFunc("item", completeItems)
+	return cmd
+}
+
+// --- push / pull / sync ------------------------------------------------------
+
+func directionCmd(direction, short string) *cobra.Command {
+	return &cobra.Command{
+		Use:   fmt.Sprintf("%s [module...]", direction),
+		Short: short,
+		Example: fmt.Sprintf(`  dotular %[1]s
+  dotular %[1]s "Visual Studio Code"
+  dotular %[1]s --dry-run`, direction),
+		ValidArgsFunction: completeModules(0),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+			cfg, err := loadAndResolveConfig(ctx)
+			if err != nil {
+				return err
+			}
+			r := newRunner(cfg)
+			r.Command = direction
+			r.DirectionOverride = direction
+
+			if len(args) == 0 {
+				return r.ApplyAll(ctx)
+			}
+			mods, err := cfg.Select(args)
+			if err != nil {
+				return err
+			}
+			return r.ApplyModules(ctx, mods)
+		},
+	}
+}
+
+// --- hook-save ---------------------------------------------------------------
+
+func hookSaveCmd() *cobra.Command {
+	var commit bool
+	cmd := &cobra.Command{
+		Use:   "hook-save <path>",
+		Short: "Pull a just-saved managed file into the repo (for editor save hooks)",
+		Long: `Pulls the file at path into the repo when a file item, or a directory item
+containing it, manages it on this machine. It is meant to be called from an
+editor's save hook so that tweaks are captured as they are made. Files that no
+module manages are ignored, so the hook can run on every save.
+
+With --commit, the repo copy is committed to git on its own.`,
+		Example: `  dotular hook-save ~/.zshrc
+  dotular hook-save --commit ~/.config/nvim/lua/opts.lua`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+			cfg, err := loadAndResolveConfig(ctx)
+			if err != nil {
+				return err
+			}
+			r := newRunner(cfg)
+			r.Command = "pull"
+			res, err := r.Capture(ctx, args[0])
+			if err != nil {
+				return err
+			}
+			if res == nil {
+				r.UI.Debug(args[0] + " is not managed by any module")
+				return nil
+			}
+			if res.Linked {
+				r.UI.Debug(args[0] + " is linked into the repo; nothing to pull")
+			}
+			if !commit || dryRun {
+				return nil
+			}
+			return commitCaptured(r.Root, res)
+		},
+	}
+	cmd.Flags().BoolVar(&commit, "commit", false, "commit the captured file to the repo's git history")
+	return cmd
+}
+
+// commitCaptured commits just the captured file in the repo at root. A file
+// that is unchanged since the last commit is left alone.
+func commitCaptured(root string, res *runner.CaptureResult) error {
+	git := func(args ...string) ([]byte, error) {
+		return exec.Command("git", append([]string{"-C", root}, args...)...).CombinedOutput()
+	}
+	if out, err := git("add", "--", res.Source); err != nil {
+		return fmt.Errorf("git add: %w: %s", err, strings.TrimSpace(string(out)))
+	}
+	if _, err := git("diff", "--cached", "--quiet", "--", res.Source); err == nil {
+		return nil
+	}
+	rel, err := filepath.Rel(root, res.Source)
+	if err != nil {
+		rel = res.Source
+	}
+	msg := fmt.Sprintf("%s: update %s", res.Module, filepath.ToSlash(rel))
+	if out, err := git("commit", "--quiet", "-m", msg, "--", res.Source); err != nil {
+		return fmt.Errorf("git commit: %w: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// --- list --------------------------------------------------------------------
+
+// listedModule is a module as reported by `dotular list --json`.
+type listedModule struct {
+	Name        string       `json:"name"`
+	Groups      []string     `json:"groups,omitempty"`
+	OnlyTags    []string     `json:"only_tags,omitempty"`
+	ExcludeTags []string     `json:"exclude_tags,omitempty"`
+	Skipped     bool         `json:"skipped"` // tags do not match this machine
+	LastApplied *time.Time   `json:"last_applied,omitempty"`
+	Items       []listedItem `json:"items"`
+}
+
+// listedItem is an item as reported by `dotular list --json`.
+type listedItem struct {
+	Type        string `json:"type"`
+	Name        string `json:"name,omitempty"`
+	Value       string `json:"value"`
+	Via         string `json:"via,omitempty"`
+	Direction   string `json:"direction,omitempty"`
+	Link        bool   `json:"link,omitempty"`
+	Encrypted   bool   `json:"encrypted,omitempty"`
+	Destination string `json:"destination,omitempty"` // for this OS, unexpanded
+}
+
+func listCmd() *cobra.Command {
+	var showItems, asJSON bool
+	var tagFilter, typeFilter []string
+	cmd := &cobra.Command{
 		Use:   "list",
 		Short: "List all modules defined in the config",
+		Example: `  dotular list
+  dotular list --items --type file
+  dotular list --tags work
+  dotular list --json`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+			cfg, err := loadAndResolveConfig(ctx)
+			if err != nil {
+				return err
+			}
+			types, err := runner.ParseItemTypes(typeFilter)
+			if err != nil {
+				return fmt.Errorf("--type: %w", err)
+			}
+			r := newRunner(cfg)
+
+			var listed []listedModule
+			for _, mod := range cfg.Modules {
+				if len(tagFilter) > 0 && !mod.MatchesTags(tagFilter) {
+					continue
+				}
+				lm := listedModule{
+					Name:        mod.Name,
+					Groups:      mod.Groups,
+					OnlyTags:    mod.OnlyTags,
+					ExcludeTags: mod.ExcludeTags,
+					Skipped:     !mod.MatchesTags(r.MachineTags),
+					Items:       []listedItem{},
+				}
+				if t := r.LastApplied(mod.Name); !t.IsZero() {
+					lm.LastApplied = &t
+				}
+				for _, item := range mod.Items {
+					if len(types) > 0 && !slices.Contains(types, item.Type()) {
+						continue
+					}
+					lm.Items = append(lm.Items, listItem(item, r.OS))
+				}
+				if len(types) > 0 && len(lm.Items) == 0 {
+					continue
+				}
+				listed = append(listed, lm)
+			}
+
+			if asJSON {
+				data, err := json.MarshalIndent(listed, "", "  ")
+				if err != nil {
+					return err
+				}
+				fmt.Fprintln(cmd.OutOrStdout(), string(data))
+				return nil
+			}
+			u := ui.New(cmd.OutOrStdout(), cmd.ErrOrStderr())
+			u.Level = outputLevel()
+			printList(u, listed, showItems)
+			return nil
+		},
+	}
+	cmd.Flags().BoolVar(&showItems, "items", false, "show each item with its type, direction, and destination")
+	cmd.Flags().StringSliceVar(&tagFilter, "tags", nil, "only list modules that would run on a machine with these tags")
+	cmd.Flags().StringSliceVar(&typeFilter, "type", nil, "only list items of these types (e.g. file,package)")
+	cmd.RegisterFlagCompletionFunc("tags", completeTags)
+	cmd.RegisterFlagCompletionFunc("type", completeItemTypes)
+	cmd.Flags().BoolVar(&asJSON, "json", false, "print the modules as JSON")
+	return cmd
+}
+
+func listItem(item config.Item, goos string) listedItem {
+	li := listedItem{
+		Type:        item.Type(),
+		Name:        item.Name,
+		Value:       item.PrimaryValue(),
+		Via:         item.Via,
+		Link:        item.Link,
+		Encrypted:   item.Encrypted,
+		Destination: item.Destination.ForOS(goos),
+	}
+	if (li.Type == "file" || li.Type == "directory") && !item.Link {
+		li.Direction = item.EffectiveDirection()
+	}
+	return li
+}
+
+// printList renders modules with group members indented under their group
+// and, with showItems, each item under its module. Modules whose tags do not
+// match this machine are marked.
+func printList(u *ui.UI, listed []listedModule, showItems bool) {
+	var groups []string // groups of the previous module
+	for _, lm := range listed {
+		// Print a header for each group this module enters.
+		shared := 0
+		for shared < len(groups) && shared < len(lm.Groups) && groups[shared] == lm.Groups[shared] {
+			shared++
+		}
+		for depth := shared; depth < len(lm.Groups); depth++ {
+			u.Info(strings.Repeat("  ", depth) + color.Bold(lm.Groups[depth]+"/"))
+		}
+		groups = lm.Groups
+
+		counts := make(map[string]int)
+		for _, item := range lm.Items {
+			counts[item.Type]++
+		}
+		indent := strings.Repeat("  ", len(lm.Groups))
+		line := fmt.Sprintf("%s%s  %s", indent,
+			color.Bold(fmt.Sprintf("%-*s", 30-len(indent), lm.Name)),
+			color.Dim(fmt.Sprintf("%d items (%s)", len(lm.Items), formatTypeCounts(counts))))
+		if lm.LastApplied != nil {
+			line += "  " + color.Dim("applied "+lm.LastApplied.Local().Format(time.DateTime))
+		}
+		if lm.Skipped {
+			line += "  " + color.Yellow("skipped on this machine (tags)")
+		}
+		u.Info(line)
+
+		if !showItems {
+			continue
+		}
+		for _, item := range lm.Items {
+			detail := item.Value
+			switch {
+			case item.Link:
+				detail += " link -> " + item.Destination
+			case item.Direction != "":
+				detail += " " + item.Direction + " -> " + item.Destination
+			case item.Via != "":
+				detail += " via " + item.Via
+			}
+			if item.Encrypted {
+				detail += " [encrypted]"
+			}
+			if item.Name != "" {
+				detail = item.Name + " " + color.Dim("("+detail+")")
+			}
+			u.Info(fmt.Sprintf("%s    %s %s", indent, color.Dim(fmt.Sprintf("%-9s", item.Type)), detail))
+		}
+	}
+}
+
+// formatTypeCounts formats a map of item type counts into a human-readable string.
+func formatTypeCounts(counts map[string]int) string {
+	types := []string{"package", "file", "directory", "script", "binary", "run", "setting", "dock", "login_item", "repo", "container", "extension", "default_app", "shell_plugin", "gpg_key", "ssh_host"}
+	var parts []string
+	for _, t := range types {
+		if n, ok := counts[t]; ok && n > 0 {
+			label := t
+			if n != 1 {
+				label += "s"
+			}
+			parts = append(parts, fmt.Sprintf("%d %s", n, label))
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// --- show --------------------------------------------------------------------
+
+// shownModule is a module as reported by `dotular show --json`.
+type shownModule struct {
+	Name       string                 `json:"name"`
+	From       string                 `json:"from,omitempty"`
+	With       map[string]any         `json:"with,omitempty"`
+	Groups     []string               `json:"groups,omitempty"`
+	Skipped    bool                   `json:"skipped"` // tags do not match this machine
+	OS         string                 `json:"os"`
+	Definition moduleDefinition       `json:"definition"`
+	Effective  []runner.EffectiveItem `json:"effective"`
+}
+
+// moduleDefinition is a module encoded in JSON with the same keys and shape
+// as in dotular.yaml.
+type moduleDefinition config.Module
+
+func (d moduleDefinition) MarshalJSON() ([]byte, error) {
+	data, err := yaml.Marshal(config.Module(d))
+	if err != nil {
+		return nil, err
+	}
+	var v any
+	if err := yaml.Unmarshal(data, &v); err != nil {
+		return nil, err
+	}
+	return json.Marshal(v)
+}
+
+func (d *moduleDefinition) UnmarshalJSON(data []byte) error {
+	var v any
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	doc, err := yaml.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return yaml.Unmarshal(doc, (*config.Module)(d))
+}
+
+func showCmd() *cobra.Command {
+	var asJSON bool
+	cmd := &cobra.Command{
+		Use:   "show <module>",
+		Short: "Print a module's fully resolved definition and effective destinations",
+		Long: `Print a module as dotular sees it after registry resolution, parameter
+templating, and override merging, followed by each item's effective source
+and destination on this OS. A group name shows every member. Nothing is
+run: skip_if commands and idempotency checks are left to "dotular plan".`,
+		Example: `  dotular show nvim
+  dotular show nvim --json`,
+		Args:              cobra.ExactArgs(1),
+		ValidArgsFunction: completeModules(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+			raw, err := loadConfig()
+			if err != nil {
+				return err
+			}
+			cfg, err := registry.Resolve(ctx, raw, configFile, noCache, newUI())
+			if err != nil {
+				return err
+			}
+			mods, err := cfg.Select(args)
+			if err != nil {
+				return err
+			}
+			r := newRunner(cfg)
+
+			var shown []shownModule
+			for _, mod := range mods {
+				sm := shownModule{
+					Name:       mod.Name,
+					Groups:     mod.Groups,
+					Skipped:    !mod.MatchesTags(r.MachineTags),
+					OS:         r.OS,
+					Definition: moduleDefinition(mod),
+				}
+				// Resolve keeps modules in config order, so the same index
+				// finds the registry reference the module came from.
+				if i := slices.IndexFunc(cfg.Modules, func(m config.Module) bool { return m.Name == mod.Name }); i >= 0 && i < len(raw.Modules) {
+					sm.From, sm.With = raw.Modules[i].From, raw.Modules[i].With
+				}
+				if sm.Effective, err = r.Effective(mod); err != nil {
+					return err
+				}
+				shown = append(shown, sm)
+			}
+
+			if asJSON {
+				data, err := json.MarshalIndent(shown, "", "  ")
+				if err != nil {
+					return err
+				}
+				fmt.Fprintln(cmd.OutOrStdout(), string(data))
+				return nil
+			}
+			u := ui.New(cmd.OutOrStdout(), cmd.ErrOrStderr())
+			u.Level = outputLevel()
+			for _, sm := range shown {
+				if err := printShown(u, sm); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	}
+	cmd.Flags().BoolVar(&asJSON, "json", false, "print the resolved module as JSON")
+	return cmd
+}
+
+// printShown renders a resolved module: where it came from, its definition
+// as YAML, and each item's effective paths on this OS.
+func printShown(u *ui.UI, sm shownModule) error {
+	if sm.Skipped {
+		u.SkipHeader(sm.Name, "tag mismatch")
+	} else {
+		u.Header(sm.Name)
+	}
+	if sm.From != "" {
+		u.Info(color.Dim("from: ") + sm.From)
+		if len(sm.With) > 0 {
+			with, err := yaml.Marshal(sm.With)
+			if err != nil {
+				return err
+			}
+			u.Info(color.Dim("with:"))
+			u.Info(indentLines(string(with), "  "))
+		}
+	}
+	if len(sm.Groups) > 0 {
+		u.Info(color.Dim("groups: ") + strings.Join(sm.Groups, " / "))
+	}
+
+	def, err := yaml.Marshal(config.Module(sm.Definition))
+	if err != nil {
+		return err
+	}
+	u.Info(color.Bold("definition:"))
+	u.Info(indentLines(string(def), "  "))
+
+	u.Info(color.Bold("effective on " + sm.OS + ":"))
+	for _, ei := range sm.Effective {
+		if ei.Skipped {
+			u.Skip(ei.Reason, ei.Description)
+			continue
+		}
+		if ei.Name != "" {
+			u.Item(ei.Name + " " + color.Dim("("+ei.Description+")"))
+		} else {
+			u.Item(ei.Description)
+		}
+		if ei.Source != "" {
+			u.Info(color.Dim("      source:      ") + ei.Source)
+		}
+		if ei.Destination != "" {
+			u.Info(color.Dim("      destination: ") + ei.Destination)
+		}
+	}
+	return nil
+}
+
+// indentLines prefixes every line of s with indent, dropping a trailing
+// newline.
+func indentLines(s, indent string) string {
+	lines := strings.Split(strings.TrimRight(s, "\n"), "\n")
+	for i, line := range lines {
+		lines[i] = indent + line
+	}
+	return strings.Join(lines, "\n")
+}
+
+// --- status ------------------------------------------------------------------
+
+func statusCmd() *cobra.Command {
+	var exitCode, summary bool
+	cmd := &cobra.Command{
+		Use:   "status",
+		Short: "Show what would be applied and which copied files have drifted",
+		Example: `  dotular status
+  dotular status --summary
+  dotular status --exit-code --quiet || echo "out of sync"`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+			cfg, err := loadAndResolveConfig(ctx)
+			if err != nil {
+				return err
+			}
+			r := runner.New(cfg, true, true, false)
+			r.OnlyTypes, r.SkipTypes = onlyTypes, skipTypes
+			r.RunGuards = true
+			r.Root = repoRoot()
+			if quiet {
+				r.UI.Level = ui.LevelQuiet
+			}
+			if summary {
+				sums, err := r.Summarize(ctx)
+				if err != nil {
+					return err
+				}
+				printSummary(r.UI, sums)
+				if exitCode && slices.ContainsFunc(sums, runner.ModuleSummary.NeedsAttention) {
+					os.Exit(1)
+				}
+				return nil
+			}
+			if err := r.ApplyAll(ctx); err != nil {
+				return err
+			}
+			drift := r.Drift()
+			printDrift(r.UI, drift)
+			if exitCode && !inSync(r.Totals(), drift) {
+				os.Exit(1)
+			}
+			return nil
+		},
+	}
+	cmd.Flags().BoolVar(&exitCode, "exit-code", false, "exit 1 when anything would be applied or a copied file has drifted")
+	cmd.Flags().BoolVar(&summary, "summary", false, "print one row per module with item counts and when it was last applied")
+	return cmd
+}
+
+// printSummary prints a row per module: how many of its items are in sync,
+// modified, missing, or could not be checked, and when it was last applied.
+func printSummary(u *ui.UI, sums []runner.ModuleSummary) {
+	if len(sums) == 0 {
+		u.Info("(no modules)")
+		return
+	}
+	// count colors a non-zero count and dims the rest.
+	count := func(paint func(string) string) func(string) string {
+		return func(cell string) string {
+			if cell == "0" || cell == "-" {
+				return color.Dim(cell)
+			}
+			return paint(cell)
+		}
+	}
+	var rows [][]string
+	for _, s := range sums {
+		last := "never"
+		if !s.LastApplied.IsZero() {
+			last = s.LastApplied.Local().Format(time.DateTime)
+		}
+		if s.Skipped {
+			rows = append(rows, []string{s.Module, "-", "-", "-", "-", "skipped (tags)"})
+			continue
+		}
+		rows = append(rows, []string{s.Module, strconv.Itoa(s.InSync), strconv.Itoa(s.Modified),
+			strconv.Itoa(s.Missing), strconv.Itoa(s.Errors), last})
+	}
+	u.Table([]string{"MODULE", "IN SYNC", "MODIFIED", "MISSING", "ERRORS", "LAST APPLIED"}, rows,
+		[]func(string) string{nil, count(color.Green), count(color.Yellow), count(color.Cyan), count(color.Red), nil})
+}
+
+// inSync reports whether a dry run found nothing to apply and no copied file
+// differs from the state it was applied in.
+func inSync(totals runner.ModuleResult, drift []runner.DriftResult) bool {
+	if totals.Applied > 0 || totals.Failed > 0 {
+		return false
+	}
+	for _, d := range drift {
+		if d.Status != runner.DriftInSync {
+			return false
+		}
+	}
+	return true
+}
+
+// printDrift lists copied file items whose system or repo copy changed since
+// they were applied.
+func printDrift(u *ui.UI, results []runner.DriftResult) {
+	var rows [][]string
+	drifted := false
+	for _, d := range results {
+		if d.Status == runner.DriftInSync {
+			continue
+		}
+		if d.Status == runner.DriftSystem || d.Status == runner.DriftBoth {
+			drifted = true
+		}
+		rows = append(rows, []string{d.Module, d.Target, d.Status})
+	}
+	if len(rows) == 0 {
+		return
+	}
+	u.Info("")
+	u.Table([]string{"MODULE", "PATH", "STATUS"}, rows, []func(string) string{nil, nil, driftColor})
+	if drifted {
+		u.Info(color.Dim("\ndrifted files were edited on this machine: `dotular pull` keeps the edits, `dotular push` overwrites them"))
+	}
+}
+
+func driftColor(status string) string {
+	switch status {
+	case runner.DriftSystem, runner.DriftBoth:
+		return color.Yellow(status)
+	case runner.DriftRepo:
+		return color.Cyan(status)
+	default:
+		return color.Dim(status)
+	}
+}
+
+// --- plan --------------------------------------------------------------------
+
+func planCmd() *cobra.Command {
+	var asJSON bool
+	cmd := &cobra.Command{
+		Use:   "plan [module...]",
+		Short: "Show the concrete actions apply would take, without running them",
+		Example: `  dotular plan
+  dotular plan homebrew
+  dotular plan --json`,
+		ValidArgsFunction: completeModules(0),
 		RunE: func(cmd *cobra.Command, args []string) error {
-			ctx := context.Background()
+			ctx := cmd.Context()
 			cfg, err := loadAndResolveConfig(ctx)
 			if err != nil {
 				return err
 			}
-			u := ui.New(os.Stdout, os.Stderr)
-			for _, mod := range cfg.Modules {
-				counts := make(map[string]int)
-				for _, item := range mod.Items {
-					counts[item.Type()]++
+			r := newRunner(cfg)
+
+			var plan *runner.Plan
+			if len(args) == 0 {
+				plan, err = r.Plan(ctx)
+				if err != nil {
+					return err
+				}
+			} else {
+				mods, err := cfg.Select(args)
+				if err != nil {
+					return err
 				}
-				total := len(mod.Items)
-				breakdown := formatTypeCounts(counts)
-				u.Info(fmt.Sprintf("%s  %s",
-					color.Bold(fmt.Sprintf("%-30s", mod.Name)),
-					color.Dim(fmt.Sprintf("%d items (%s)", total, breakdown))))
+				plan = &runner.Plan{}
+				for _, mod := range mods {
+					mp, err := r.PlanModule(ctx, mod)
+					if err != nil {
+						return err
+					}
+					plan.Modules = append(plan.Modules, mp)
+				}
+			}
+
+			if asJSON {
+				data, err := json.MarshalIndent(plan, "", "  ")
+				if err != nil {
+					return err
+				}
+				fmt.Fprintln(cmd.OutOrStdout(), string(data))
+				return nil
 			}
+			u := ui.New(cmd.OutOrStdout(), cmd.ErrOrStderr())
+			u.Level = outputLevel()
+			printPlan(u, plan)
 			return nil
 		},
 	}
+	cmd.Flags().BoolVar(&asJSON, "json", false, "print the plan as JSON")
+	return cmd
 }
 
-// formatTypeCounts formats a map of item type counts into a human-readable string.
-func formatTypeCounts(counts map[string]int) string {
-	types := []string{"package", "file", "directory", "script", "binary", "run", "setting"}
-	var parts []string
-	for _, t := range types {
-		if n, ok := counts[t]; ok && n > 0 {
-			label := t
-			if n != 1 {
-				label += "s"
+// printPlan renders a plan in the same layout apply uses.
+func printPlan(u *ui.UI, plan *runner.Plan) {
+	for _, mp := range plan.Modules {
+		if mp.Skipped {
+			u.SkipHeader(mp.Module, mp.Reason)
+			continue
+		}
+		u.Header(mp.Module)
+		for _, pa := range mp.Actions {
+			if pa.Status == runner.StatusSkip {
+				u.Skip(pa.Reason, pa.Description)
+				continue
 			}
-			parts = append(parts, fmt.Sprintf("%d %s", n, label))
+			desc := pa.Description
+			if pa.Current != "" || pa.Desired != "" {
+				desc += "  " + color.Dim(pa.Current+" => "+pa.Desired)
+			}
+			u.Item(desc)
 		}
 	}
-	return strings.Join(parts, ", ")
 }
 
-// --- status ------------------------------------------------------------------
+// --- clean -------------------------------------------------------------------
 
-func statusCmd() *cobra.Command {
-	return &cobra.Command{
-		Use:   "status",
-		Short: "Show what would be applied for the current platform",
+func cleanCmd() *cobra.Command {
+	var force bool
+	cmd := &cobra.Command{
+		Use:   "clean",
+		Short: "List (and with --force remove) deployed files no longer in the config",
+		Long: `Compares the state file of resources dotular has deployed on this machine
+with the current config and lists the orphans: files, symlinks, and binaries
+whose items were renamed or removed. With --force they are deleted, except
+files modified since they were deployed. Packages and directories are only
+listed.`,
+		Example: `  dotular clean
+  dotular clean --force`,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			ctx := context.Background()
+			ctx := cmd.Context()
 			cfg, err := loadAndResolveConfig(ctx)
 			if err != nil {
 				return err
 			}
-			r := runner.New(cfg, true, true, false)
-			return r.ApplyAll(ctx)
+			r := newRunner(cfg)
+			u := r.UI
+			if r.State == nil {
+				return fmt.Errorf("state file unavailable")
+			}
+
+			orphans := r.Orphans()
+			if len(orphans) == 0 {
+				u.Success("nothing to clean")
+				return nil
+			}
+
+			if !force || dryRun {
+				headers := []string{"KIND", "RESOURCE", "MODULE"}
+				var rows [][]string
+				for _, res := range orphans {
+					rows = append(rows, []string{res.Kind, resourceLabel(res), res.Module})
+				}
+				u.Table(headers, rows, nil)
+				u.Info(color.Dim(fmt.Sprintf("\n%d orphaned resource(s); run with --force to remove them", len(orphans))))
+				return nil
+			}
+
+			r.Command = "clean"
+			results, err := r.Clean(ctx, orphans)
+			if err != nil {
+				return err
+			}
+			for _, res := range results {
+				label := resourceLabel(res.Resource)
+				switch {
+				case res.Removed:
+					u.Success("removed " + label)
+				case res.Reason == "":
+					u.Info(color.Dim("forgot " + label + " (already gone)"))
+				default:
+					u.Warn(fmt.Sprintf("kept %s: %s", label, res.Reason))
+				}
+			}
+			return nil
+		},
+	}
+	cmd.Flags().BoolVar(&force, "force", false, "remove orphaned resources instead of listing them")
+	return cmd
+}
+
+func unapplyCmd() *cobra.Command {
+	var packages bool
+	cmd := &cobra.Command{
+		Use:   "unapply <module>",
+		Short: "Remove what a module deployed on this machine",
+		Long: `Reverses a module's effects using the state file: files, symlinks, and
+binaries it deployed are removed, except files modified since they were
+deployed. Packages are uninstalled only with --packages, and directories are
+always kept. The module's before_unapply and after_unapply hooks run around
+the removal. A module that is no longer in the config can still be unapplied
+while the state file remembers it.`,
+		Example: `  dotular unapply neovim
+  dotular unapply neovim --packages
+  dotular unapply neovim --dry-run`,
+		Args:              cobra.ExactArgs(1),
+		ValidArgsFunction: completeModules(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+			cfg, err := loadAndResolveConfig(ctx)
+			if err != nil {
+				return err
+			}
+			r := newRunner(cfg)
+			r.Command = "unapply"
+			u := r.UI
+			if r.State == nil {
+				return fmt.Errorf("state file unavailable")
+			}
+
+			mod := config.Module{Name: args[0]}
+			if m := cfg.Module(args[0]); m != nil {
+				mod = *m
+			} else if len(r.ModuleResources(args[0])) == 0 {
+				return fmt.Errorf("%w in config or state: %q", errs.ErrModuleNotFound, args[0])
+			}
+
+			results, err := r.Unapply(ctx, mod, packages)
+			if len(results) == 0 && err == nil {
+				u.Success("nothing to unapply")
+				return nil
+			}
+			for _, res := range results {
+				label := resourceLabel(res.Resource)
+				switch {
+				case dryRun && res.Reason == "":
+					u.DryRun("would remove " + label)
+				case res.Removed:
+					u.Success("removed " + label)
+				case res.Reason == "":
+					u.Info(color.Dim("forgot " + label + " (already gone)"))
+				default:
+					u.Warn(fmt.Sprintf("kept %s: %s", label, res.Reason))
+				}
+			}
+			return err
 		},
 	}
+	cmd.Flags().BoolVar(&packages, "packages", false, "also uninstall packages the module installed")
+	return cmd
+}
+
+// resourceLabel names a state resource for display.
+func resourceLabel(res state.Resource) string {
+	if res.Kind == state.KindPackage {
+		return res.Manager + ":" + res.Package
+	}
+	return res.Path
 }
 
 // --- platform ----------------------------------------------------------------
@@ -496,7 +2255,7 @@ func platformCmd() *cobra.Command {
 		Use:   "platform",
 		Short: "Print the detected platform (OS)",
 		Run: func(cmd *cobra.Command, args []string) {
-			u := ui.New(os.Stdout, os.Stderr)
+			u := newUI()
 			u.Info(fmt.Sprintf("os: %s", platform.Current()))
 		},
 	}
@@ -510,40 +2269,34 @@ func verifyCmd() *cobra.Command {
 		Short: "Run verify checks without modifying anything",
 		Example: `  dotular verify
   dotular verify "Visual Studio Code"`,
+		ValidArgsFunction: completeModules(0),
 		RunE: func(cmd *cobra.Command, args []string) error {
-			ctx := context.Background()
+			ctx := cmd.Context()
 			cfg, err := loadAndResolveConfig(ctx)
 			if err != nil {
 				return err
 			}
-			r := runner.New(cfg, false, verbose, false)
+			r := runner.New(cfg, false, verbosity > 0, false)
+			r.UI.Level = outputLevel()
 			r.Command = "verify"
+			r.Root = repoRoot()
 
 			var allPassed bool
 			if len(args) == 0 {
 				allPassed, err = r.VerifyAll(ctx)
 			} else {
-				allPassed = true
-				for _, name := range args {
-					mod := cfg.Module(name)
-					if mod == nil {
-						return fmt.Errorf("module %q not found in config", name)
-					}
-					passed, verErr := r.VerifyModule(ctx, *mod)
-					if verErr != nil {
-						return verErr
-					}
-					if !passed {
-						allPassed = false
-					}
+				mods, selErr := cfg.Select(args)
+				if selErr != nil {
+					return selErr
 				}
+				allPassed, err = r.VerifyModules(ctx, mods)
 			}
 
 			if err != nil {
 				return err
 			}
 			if !allPassed {
-				u := ui.New(os.Stdout, os.Stderr)
+				u := newUI()
 				u.Warn("some verify checks failed")
 				os.Exit(1)
 			}
@@ -552,6 +2305,104 @@ func verifyCmd() *cobra.Command {
 	}
 }
 
+// --- schedule ----------------------------------------------------------------
+
+func scheduleCmd() *cobra.Command {
+	var command string
+	var every time.Duration
+
+	cmd := &cobra.Command{
+		Use:   "schedule",
+		Short: "Run verify or apply on an interval with a system timer",
+	}
+
+	install := &cobra.Command{
+		Use:   "install",
+		Short: "Install a launchd agent, systemd user timer, or scheduled task",
+		Example: `  dotular schedule install
+  dotular schedule install --every 1h
+  dotular schedule install --command apply --every 24h`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if _, err := loadConfig(); err != nil {
+				return err
+			}
+			exe, err := os.Executable()
+			if err != nil {
+				return err
+			}
+			if resolved, err := filepath.EvalSymlinks(exe); err == nil {
+				exe = resolved
+			}
+			cfgPath, err := filepath.Abs(configFile)
+			if err != nil {
+				return err
+			}
+			job := schedule.Job{Command: command, Every: every, Executable: exe, Config: cfgPath, Path: os.Getenv("PATH")}
+			plan, err := schedule.InstallPlan(runtime.GOOS, job)
+			if err != nil {
+				return err
+			}
+			u := newUI()
+			if dryRun {
+				printSchedulePlan(u, plan, true)
+				return nil
+			}
+			if err := schedule.Install(cmd.Context(), plan); err != nil {
+				return err
+			}
+			u.Success(fmt.Sprintf("scheduled dotular %s every %s", command, every))
+			return nil
+		},
+	}
+	install.Flags().StringVar(&command, "command", "verify", "command to run: verify or apply")
+	install.RegisterFlagCompletionFunc("command", cobra.FixedCompletions([]string{"verify", "apply"}, cobra.ShellCompDirectiveNoFileComp))
+	install.Flags().DurationVar(&every, "every", 6*time.Hour, "interval between runs")
+
+	uninstall := &cobra.Command{
+		Use:   "uninstall",
+		Short: "Remove the timer installed by schedule install",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			plan, err := schedule.UninstallPlan(runtime.GOOS, command)
+			if err != nil {
+				return err
+			}
+			u := newUI()
+			if dryRun {
+				printSchedulePlan(u, plan, false)
+				return nil
+			}
+			if err := schedule.Uninstall(cmd.Context(), plan); err != nil {
+				return err
+			}
+			u.Success(fmt.Sprintf("removed the dotular %s schedule", command))
+			return nil
+		},
+	}
+	uninstall.Flags().StringVar(&command, "command", "verify", "command whose schedule to remove: verify or apply")
+	uninstall.RegisterFlagCompletionFunc("command", cobra.FixedCompletions([]string{"verify", "apply"}, cobra.ShellCompDirectiveNoFileComp))
+
+	cmd.AddCommand(install, uninstall)
+	return cmd
+}
+
+// printSchedulePlan shows what schedule install or uninstall would do.
+func printSchedulePlan(u *ui.UI, plan schedule.Plan, install bool) {
+	for _, s := range plan.Before {
+		u.Info(color.Dim("[dry-run] " + strings.Join(s.Args, " ")))
+	}
+	for _, f := range plan.Files {
+		if !install {
+			u.Info(color.Dim("[dry-run] remove " + f.Path))
+			continue
+		}
+		u.Info(color.Dim("[dry-run] write " + f.Path))
+		u.Info(f.Content)
+	}
+	for _, s := range plan.After {
+		u.Info(color.Dim("[dry-run] " + strings.Join(s.Args, " ")))
+	}
+}
+
 // --- encrypt / decrypt -------------------------------------------------------
 
 func encryptCmd() *cobra.Command {
@@ -566,7 +2417,7 @@ func encryptCmd() *cobra.Command {
 			}
 			src := args[0]
 			dst := ageutil.RepoPath(src)
-			u := ui.New(os.Stdout, os.Stderr)
+			u := newUI()
 			u.Info(fmt.Sprintf("encrypting %s → %s", src, dst))
 			return key.EncryptFile(src, dst)
 		},
@@ -588,7 +2439,7 @@ func decryptCmd() *cobra.Command {
 			if len(dst) > 4 && dst[len(dst)-4:] == ".age" {
 				dst = dst[:len(dst)-4]
 			}
-			u := ui.New(os.Stdout, os.Stderr)
+			u := newUI()
 			u.Info(fmt.Sprintf("decrypting %s → %s", src, dst))
 			return key.DecryptFile(src, dst)
 		},
@@ -603,7 +2454,7 @@ func keyFromConfig() (*ageutil.Key, error) {
 	// Reuse runner's resolver so env vars are respected.
 	r := runner.New(cfg, false, false, false)
 	if r.AgeKey == nil {
-		return nil, fmt.Errorf("no age key configured; set age.identity or age.passphrase in %s, or set DOTULAR_AGE_IDENTITY / DOTULAR_AGE_PASSPHRASE", configFile)
+		return nil, fmt.Errorf("no age key configured; set age.identity, age.passphrase, or age.passphrase_command in %s, or set DOTULAR_AGE_IDENTITY / DOTULAR_AGE_PASSPHRASE / DOTULAR_AGE_PASSPHRASE_CMD", configFile)
 	}
 	return r.AgeKey, nil
 }
@@ -628,7 +2479,7 @@ func tagCmd() *cobra.Command {
 				if err != nil {
 					return err
 				}
-				u := ui.New(os.Stdout, os.Stderr)
+				u := newUI()
 				u.Info(color.Bold(fmt.Sprintf("machine config: %s", tags.ConfigPath())))
 				if len(cfg.Tags) == 0 {
 					u.Info(color.Dim("(no tags)"))
@@ -641,9 +2492,10 @@ func tagCmd() *cobra.Command {
 			},
 		},
 		&cobra.Command{
-			Use:   "add <tag>",
-			Short: "Add a tag to this machine",
-			Args:  cobra.ExactArgs(1),
+			Use:               "add <tag>",
+			Short:             "Add a tag to this machine",
+			Args:              cobra.ExactArgs(1),
+			ValidArgsFunction: completeNewTag,
 			RunE: func(cmd *cobra.Command, args []string) error {
 				if err := tags.EnsureInitialised(); err != nil {
 					return err
@@ -651,7 +2503,7 @@ func tagCmd() *cobra.Command {
 				if err := tags.Add(args[0]); err != nil {
 					return err
 				}
-				u := ui.New(os.Stdout, os.Stderr)
+				u := newUI()
 				u.Success(fmt.Sprintf("added tag %q", args[0]))
 				return nil
 			},
@@ -677,7 +2529,7 @@ func logCmd() *cobra.Command {
 			if err != nil {
 				return fmt.Errorf("read audit log: %w", err)
 			}
-			u := ui.New(os.Stdout, os.Stderr)
+			u := newUI()
 			if len(entries) == 0 {
 				u.Info("(no log entries)")
 				return nil
@@ -690,6 +2542,8 @@ func logCmd() *cobra.Command {
 				outcome := e.Outcome
 				if e.Error != "" {
 					outcome += " (" + e.Error + ")"
+				} else if e.Detail != "" {
+					outcome += " (" + e.Detail + ")"
 				}
 				// Pre-color outcome
 				switch e.Outcome {
@@ -702,15 +2556,298 @@ func logCmd() *cobra.Command {
 				}
 				rows = append(rows, []string{ts, e.Command, e.Module, outcome, e.Item})
 			}
-			u.Table(headers, rows, nil)
-			u.Info(fmt.Sprintf("\nlog: %s", audit.LogPath()))
-			return nil
-		},
+			u.Table(headers, rows, nil)
+			u.Info(fmt.Sprintf("\nlog: %s", audit.LogPath()))
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&moduleFilter, "module", "", "filter log by module name")
+	cmd.RegisterFlagCompletionFunc("module", completeModules(0))
+	cmd.Flags().IntVar(&limit, "limit", 50, "maximum number of entries to show")
+	return cmd
+}
+
+// --- stats -------------------------------------------------------------------
+
+func statsCmd() *cobra.Command {
+	var top int
+	var asJSON bool
+
+	cmd := &cobra.Command{
+		Use:   "stats",
+		Short: "Summarize the audit log and state: resources per module, last applies, failing and slow items",
+		Long: `Summarize this machine's audit log and state file: the resources each
+module manages, the last apply on each machine that wrote the log, the items
+that fail most often, and the slowest items. Everything is read locally.`,
+		Example: `  dotular stats
+  dotular stats --top 5
+  dotular stats --json`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			entries, err := audit.Read("", 0)
+			if err != nil {
+				return fmt.Errorf("read audit log: %w", err)
+			}
+			var st *state.State
+			if path, err := state.DefaultPath(); err == nil {
+				if st, err = state.Load(path); err != nil {
+					return fmt.Errorf("read state: %w", err)
+				}
+			}
+			rep := stats.Build(entries, st, top)
+
+			if asJSON {
+				data, err := json.MarshalIndent(rep, "", "  ")
+				if err != nil {
+					return err
+				}
+				fmt.Fprintln(cmd.OutOrStdout(), string(data))
+				return nil
+			}
+			u := ui.New(cmd.OutOrStdout(), cmd.ErrOrStderr())
+			u.Level = outputLevel()
+			printStats(u, rep)
+			return nil
+		},
+	}
+
+	cmd.Flags().IntVar(&top, "top", 10, "number of failing and slowest items to show (0 for all)")
+	cmd.Flags().BoolVar(&asJSON, "json", false, "print the report as JSON")
+	return cmd
+}
+
+// --- export ------------------------------------------------------------------
+
+func exportCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "export",
+		Short: "Export the config in another form",
+	}
+	cmd.AddCommand(exportScriptCmd(), exportNixCmd())
+	return cmd
+}
+
+// exportSteps returns the export steps of all or the named modules. Named
+// modules are exported regardless of tags, as apply does.
+func exportSteps(cmd *cobra.Command, args []string) ([]export.Step, error) {
+	cfg, err := loadAndResolveConfig(cmd.Context())
+	if err != nil {
+		return nil, err
+	}
+	mods := cfg.Modules
+	if len(args) > 0 {
+		if mods, err = cfg.Select(args); err != nil {
+			return nil, err
+		}
+	}
+	return newRunner(cfg).ExportSteps(mods, len(args) == 0)
+}
+
+func exportScriptCmd() *cobra.Command {
+	shell := export.ShellPOSIX
+	if runtime.GOOS == "windows" {
+		shell = export.ShellPowerShell
+	}
+	cmd := &cobra.Command{
+		Use:   "script [module...]",
+		Short: "Print a standalone shell script that copies files and installs packages for this platform",
+		Long: `Print a POSIX sh or PowerShell script that performs the file and directory
+copies, links, and package installs of all or the named modules for this
+platform and machine tags, for bootstrapping a machine where dotular cannot be
+installed first. Run the script from a checkout of the repo, or point
+DOTULAR_REPO at one.
+
+Destinations under your home directory are written relative to the home
+directory of whoever runs the script. Items a script cannot reproduce, such as
+encrypted files, settings, and run items, are listed as comments.`,
+		Example: `  dotular export script > bootstrap.sh
+  dotular export script shell git > bootstrap.sh
+  dotular export script --shell powershell > bootstrap.ps1`,
+		ValidArgsFunction: completeModules(0),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			steps, err := exportSteps(cmd, args)
+			if err != nil {
+				return err
+			}
+			return export.Write(cmd.OutOrStdout(), shell, steps)
+		},
+	}
+	cmd.Flags().StringVar(&shell, "shell", shell, "script dialect: sh or powershell")
+	cmd.RegisterFlagCompletionFunc("shell", cobra.FixedCompletions([]string{"sh", "powershell"}, cobra.ShellCompDirectiveNoFileComp))
+	return cmd
+}
+
+func exportNixCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "nix [module...]",
+		Short: "Print a home-manager module with the config's files and nix packages",
+		Long: `Print a home-manager module for all or the named modules on this platform
+and machine tags. Copied files and directories under your home directory
+become home.file entries with paths relative to the repo root, so keep the
+module in the repo root. Link items become out-of-store symlinks into this
+checkout, so edits stay live. Packages installed via nix or nix-profile from
+nixpkgs become home.packages.
+
+Everything else, such as packages from other managers, encrypted files, and
+destinations outside the home directory, is listed as comments.`,
+		Example: `  dotular export nix > home.nix
+  dotular export nix shell git > home.nix`,
+		ValidArgsFunction: completeModules(0),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			steps, err := exportSteps(cmd, args)
+			if err != nil {
+				return err
+			}
+			return export.WriteNix(cmd.OutOrStdout(), repoRoot(), steps)
+		},
+	}
+}
+
+// --- machines ----------------------------------------------------------------
+
+// machineStatus is a machine as reported by `dotular machines --json`.
+type machineStatus struct {
+	machines.Machine
+	Current bool     `json:"current"`          // the machine running the command
+	Behind  []string `json:"behind,omitempty"` // applied modules changed since
+}
+
+func machinesCmd() *cobra.Command {
+	var asJSON bool
+	cmd := &cobra.Command{
+		Use:   "machines",
+		Short: "List the machines applied from this repo and whether they are up to date",
+		Long: `List the machines recorded in dotular.machines.yaml, next to the config file,
+with their tags, dotular version, and last apply. A machine is behind when a
+module it applied has since changed in the config or its store.
+
+Machines register themselves on apply when the config sets:
+
+  machines:
+    register: true
+
+Commit dotular.machines.yaml so every machine sees the others.`,
+		Example: `  dotular machines
+  dotular machines --json`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+			cfg, err := loadAndResolveConfig(ctx)
+			if err != nil {
+				return err
+			}
+			inv, err := machines.Load(machines.Path(configFile))
+			if err != nil {
+				return err
+			}
+			r := newRunner(cfg)
+			host, _ := os.Hostname()
+			statuses := make([]machineStatus, 0, len(inv.Machines))
+			for _, m := range inv.Machines {
+				statuses = append(statuses, machineStatus{Machine: m, Current: m.Hostname == host, Behind: r.Behind(m)})
+			}
+
+			if asJSON {
+				data, err := json.MarshalIndent(statuses, "", "  ")
+				if err != nil {
+					return err
+				}
+				fmt.Fprintln(cmd.OutOrStdout(), string(data))
+				return nil
+			}
+			u := ui.New(cmd.OutOrStdout(), cmd.ErrOrStderr())
+			u.Level = outputLevel()
+			printMachines(u, statuses)
+			return nil
+		},
+	}
+	cmd.Flags().BoolVar(&asJSON, "json", false, "print the machines as JSON")
+	return cmd
+}
+
+// printMachines renders the machine inventory as a table, marking the
+// current machine with "*".
+func printMachines(u *ui.UI, statuses []machineStatus) {
+	if len(statuses) == 0 {
+		u.Info("No machines registered. Set machines.register: true in the config and run dotular apply.")
+		return
+	}
+	var rows [][]string
+	for _, s := range statuses {
+		name := s.Hostname
+		if s.Current {
+			name += " *"
+		}
+		status := "up to date"
+		if len(s.Behind) > 0 {
+			status = "behind: " + strings.Join(s.Behind, ", ")
+		}
+		version := s.Version
+		if version == "" {
+			version = "-"
+		}
+		rows = append(rows, []string{name, s.OS + "/" + s.Arch, strings.Join(s.Tags, ","), version,
+			s.LastApply.Local().Format(time.DateTime), status})
+	}
+	statusColor := func(s string) string {
+		if strings.HasPrefix(s, "behind") {
+			return color.Yellow(s)
+		}
+		return color.Green(s)
+	}
+	u.Table([]string{"MACHINE", "PLATFORM", "TAGS", "VERSION", "LAST APPLY", "STATUS"}, rows,
+		[]func(string) string{nil, nil, color.Dim, nil, nil, statusColor})
+}
+
+// printStats renders a stats report as one table per section.
+func printStats(u *ui.UI, rep stats.Report) {
+	section := func(title string, empty bool) bool {
+		u.Info(color.Bold(title))
+		if empty {
+			u.Info(color.Dim("  (none)"))
+		}
+		return !empty
+	}
+
+	if section("Managed resources", len(rep.Modules) == 0) {
+		var rows [][]string
+		for _, m := range rep.Modules {
+			rows = append(rows, []string{m.Module, strconv.Itoa(m.Files), strconv.Itoa(m.Directories),
+				strconv.Itoa(m.Symlinks), strconv.Itoa(m.Packages), strconv.Itoa(m.Binaries)})
+		}
+		u.Table([]string{"MODULE", "FILES", "DIRS", "SYMLINKS", "PACKAGES", "BINARIES"}, rows, nil)
+	}
+
+	u.Info("")
+	if section("Last apply", len(rep.Machines) == 0) {
+		var rows [][]string
+		for _, m := range rep.Machines {
+			host := m.Host
+			if host == "" {
+				host = "(unknown)"
+			}
+			rows = append(rows, []string{host, m.Command, m.Time.Local().Format(time.DateTime)})
+		}
+		u.Table([]string{"HOST", "COMMAND", "TIME"}, rows, nil)
 	}
 
-	cmd.Flags().StringVar(&moduleFilter, "module", "", "filter log by module name")
-	cmd.Flags().IntVar(&limit, "limit", 50, "maximum number of entries to show")
-	return cmd
+	u.Info("")
+	if section("Failing items", len(rep.Failing) == 0) {
+		var rows [][]string
+		for _, f := range rep.Failing {
+			rows = append(rows, []string{f.Module, f.Item, fmt.Sprintf("%d/%d", f.Failures, f.Runs), fmt.Sprintf("%.0f%%", 100*f.Rate())})
+		}
+		u.Table([]string{"MODULE", "ITEM", "FAILED", "RATE"}, rows, []func(string) string{nil, nil, nil, color.Red})
+	}
+
+	u.Info("")
+	if section("Slowest items", len(rep.Slowest) == 0) {
+		var rows [][]string
+		for _, t := range rep.Slowest {
+			rows = append(rows, []string{t.Module, t.Item, strconv.Itoa(t.Runs), t.Mean.Round(time.Millisecond).String(), t.Max.Round(time.Millisecond).String()})
+		}
+		u.Table([]string{"MODULE", "ITEM", "RUNS", "MEAN", "MAX"}, rows, nil)
+	}
 }
 
 // --- registry ----------------------------------------------------------------
@@ -726,7 +2863,7 @@ func registryCmd() *cobra.Command {
 		Short: "List available registry modules",
 		RunE: func(cmd *cobra.Command, args []string) error {
 			cached, _ := cmd.Flags().GetBool("cached")
-			u := ui.New(os.Stdout, os.Stderr)
+			u := newUI()
 
 			if cached {
 				_, err := loadConfig()
@@ -766,7 +2903,7 @@ func registryCmd() *cobra.Command {
 			}
 
 			// Default: fetch and display remote index.
-			ctx := context.Background()
+			ctx := cmd.Context()
 			entries, err := registry.FetchIndex(ctx, u)
 			if err != nil {
 				return err
@@ -786,8 +2923,53 @@ func registryCmd() *cobra.Command {
 	}
 	listCmd.Flags().Bool("cached", false, "Show locally cached modules instead of the remote index")
 
+	verifyCmd := &cobra.Command{
+		Use:   "verify",
+		Short: "Check that every locked registry module still matches its lockfile checksum",
+		Example: `  dotular registry verify
+  dotular registry verify --remote`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			remote, _ := cmd.Flags().GetBool("remote")
+			lock, err := registry.LoadLock(registry.LockPath(configFile))
+			if err != nil {
+				return err
+			}
+			u := newUI()
+			if len(lock.Registry) == 0 {
+				u.Info("(no locked registry modules)")
+				return nil
+			}
+
+			results := registry.VerifyLock(cmd.Context(), lock, remote)
+			headers := []string{"REF", "SOURCE", "STATUS"}
+			var rows [][]string
+			failed := 0
+			for _, res := range results {
+				status := color.Green("ok")
+				switch {
+				case res.Err != nil:
+					status = color.BoldRed("error: " + res.Err.Error())
+					failed++
+				case !res.OK():
+					status = color.BoldRed(fmt.Sprintf("drift (lockfile %.12s, got %.12s)", res.Expected, res.Actual))
+					failed++
+				}
+				rows = append(rows, []string{res.Ref, res.Source, status})
+			}
+			u.Table(headers, rows, nil)
+
+			if failed > 0 {
+				return fmt.Errorf("%d of %d locked registry module(s) failed verification", failed, len(results))
+			}
+			u.Success(fmt.Sprintf("all %d locked registry module(s) match the lockfile", len(results)))
+			return nil
+		},
+	}
+	verifyCmd.Flags().Bool("remote", false, "re-download every module instead of reading the cache")
+
 	cmd.AddCommand(
 		listCmd,
+		verifyCmd,
 		&cobra.Command{
 			Use:   "clear",
 			Short: "Remove all cached registry modules",
@@ -795,27 +2977,91 @@ func registryCmd() *cobra.Command {
 				if err := registry.ClearCache(); err != nil {
 					return err
 				}
-				u := ui.New(os.Stdout, os.Stderr)
+				u := newUI()
 				u.Success("registry cache cleared")
 				return nil
 			},
 		},
+		registryOutdatedCmd(),
+		registryUpdateCmd(),
+		registryLintCmd(),
+		registryTestCmd(),
 		&cobra.Command{
-			Use:   "update",
-			Short: "Re-fetch all registry modules referenced in the config",
+			Use:   "prune",
+			Short: "Remove cached modules and lockfile entries no longer referenced by the config",
+			Example: `  dotular registry prune
+  dotular registry prune --dry-run`,
 			RunE: func(cmd *cobra.Command, args []string) error {
-				ctx := context.Background()
-				// Force re-fetch by passing noCache=true.
 				cfg, err := loadConfig()
 				if err != nil {
 					return err
 				}
-				u := ui.New(os.Stdout, os.Stderr)
-				_, err = registry.Resolve(ctx, cfg, configFile, true, u)
+				lockPath := registry.LockPath(configFile)
+				lock, err := registry.LoadLock(lockPath)
 				if err != nil {
 					return err
 				}
-				u.Success("registry modules updated")
+				u := newUI()
+				pruned, err := registry.Prune(lock, registry.CollectActiveRefs(cfg), dryRun)
+				if err != nil {
+					// Save the entries already pruned, so the lockfile
+					// does not list modules whose cache is gone.
+					if len(pruned) > 0 {
+						if saveErr := registry.SaveLock(lockPath, lock); saveErr != nil {
+							return errors.Join(err, saveErr)
+						}
+					}
+					return err
+				}
+				if len(pruned) == 0 {
+					u.Info("(no unused registry modules)")
+					return nil
+				}
+				for _, ref := range pruned {
+					if dryRun {
+						u.DryRun("prune " + ref)
+					} else {
+						u.Info(fmt.Sprintf("  pruned %s", ref))
+					}
+				}
+				if dryRun {
+					return nil
+				}
+				if err := registry.SaveLock(lockPath, lock); err != nil {
+					return err
+				}
+				u.Success(fmt.Sprintf("pruned %d unused registry module(s)", len(pruned)))
+				return nil
+			},
+		},
+		&cobra.Command{
+			Use:   "vendor",
+			Short: "Copy registry modules into vendor/ and point the config at them",
+			Long: `Writes every registry module referenced in the config into a vendor/
+directory next to dotular.yaml and rewrites each "from:" to the local copy,
+so the repo can be applied without reaching the registry.`,
+			RunE: func(cmd *cobra.Command, args []string) error {
+				ctx := cmd.Context()
+				cfg, err := loadConfig()
+				if err != nil {
+					return err
+				}
+				u := newUI()
+				out, vendored, err := registry.Vendor(ctx, cfg, configFile, noCache, u)
+				if err != nil {
+					return err
+				}
+				if len(vendored) == 0 {
+					u.Info("(no registry modules to vendor)")
+					return nil
+				}
+				if err := config.Save(configFile, out); err != nil {
+					return err
+				}
+				for _, v := range vendored {
+					u.Info(fmt.Sprintf("  %s %s", v.Ref, color.Dim("-> "+v.Local)))
+				}
+				u.Success(fmt.Sprintf("vendored %d registry module(s) into %s", len(vendored), registry.VendorDir(configFile)))
 				return nil
 			},
 		},
@@ -823,6 +3069,438 @@ func registryCmd() *cobra.Command {
 	return cmd
 }
 
+func registryOutdatedCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "outdated",
+		Short: "List official registry modules whose index version is newer than the cached copy",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := loadConfig()
+			if err != nil {
+				return err
+			}
+			u := newUI()
+			entries, err := registry.FetchIndex(cmd.Context(), u)
+			if err != nil {
+				return err
+			}
+			var refs []string
+			for ref := range registry.CollectActiveRefs(cfg) {
+				refs = append(refs, ref)
+			}
+			var rows [][]string
+			for _, res := range registry.Outdated(refs, entries) {
+				if !res.Outdated() {
+					continue
+				}
+				current := res.Current
+				if current == "" {
+					current = color.Dim("(not cached)")
+				}
+				rows = append(rows, []string{res.Ref, current, color.Green(res.Latest)})
+			}
+			if len(rows) == 0 {
+				u.Info("(all registry modules are up to date)")
+				return nil
+			}
+			u.Table([]string{"REF", "CACHED", "LATEST"}, rows, nil)
+			return nil
+		},
+	}
+}
+
+func registryUpdateCmd() *cobra.Command {
+	var preview bool
+	cmd := &cobra.Command{
+		Use:   "update [ref...]",
+		Short: "Re-fetch registry modules referenced in the config (all if none specified)",
+		Long: `Re-fetches registry modules from the network and records their new
+checksums in the lockfile. With --preview, shows a diff of each cached module
+against the published one and changes nothing.`,
+		Example: `  dotular registry update
+  dotular registry update --preview neovim
+  dotular registry update neovim`,
+		ValidArgsFunction: completeRegistryRefs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+			cfg, err := loadConfig()
+			if err != nil {
+				return err
+			}
+			u := newUI()
+			active := registry.CollectActiveRefs(cfg)
+			for _, ref := range args {
+				if !active[ref] {
+					return fmt.Errorf("no module in the config uses registry ref %q", ref)
+				}
+			}
+			refs := args
+			if len(refs) == 0 && preview {
+				for ref := range active {
+					if !registry.IsLocalRef(ref) {
+						refs = append(refs, ref)
+					}
+				}
+				slices.Sort(refs)
+			}
+
+			if preview {
+				for _, ref := range refs {
+					cached, latest, err := registry.FetchLatest(ctx, ref)
+					if err != nil {
+						return err
+					}
+					d := diff.Unified(ref+" (cached)", ref+" (latest)", string(cached), string(latest), 3)
+					if d == "" {
+						u.Info(fmt.Sprintf("%s %s", ref, color.Dim("(unchanged)")))
+						continue
+					}
+					u.Info(diff.Colorize(d))
+				}
+				return nil
+			}
+
+			if len(refs) == 0 {
+				// Force re-fetch by passing noCache=true.
+				if _, err := registry.Resolve(ctx, cfg, configFile, true, u); err != nil {
+					return err
+				}
+				u.Success("registry modules updated")
+				return nil
+			}
+			lockPath := registry.LockPath(configFile)
+			lock, err := registry.LoadLock(lockPath)
+			if err != nil {
+				return err
+			}
+			for _, ref := range refs {
+				if _, _, err := registry.FetchRaw(ctx, ref, lock, true, u); err != nil {
+					return err
+				}
+			}
+			if err := registry.SaveLock(lockPath, lock); err != nil {
+				return err
+			}
+			u.Success(fmt.Sprintf("updated %d registry module(s)", len(refs)))
+			return nil
+		},
+	}
+	cmd.Flags().BoolVar(&preview, "preview", false, "show what would change in each module without updating the cache or lockfile")
+	return cmd
+}
+
+// --- update ------------------------------------------------------------------
+
+func updateCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "update [module...]",
+		Short: "Refresh registry modules, latest binaries, and remote scripts (all modules if none specified)",
+		Long: `Refreshes everything the config pins from outside the repo and reports
+what changed:
+
+  - registry modules are re-fetched and their lockfile checksums updated
+  - binaries with version: latest are downloaded again
+  - remote scripts are downloaded again; a sha256 pin in the config is
+    rewritten to the new checksum
+
+Checksums of latest binaries and unpinned remote scripts are recorded under
+downloads in the lockfile, so the next update can tell whether they changed.`,
+		Example: `  dotular update
+  dotular update neovim tools`,
+		ValidArgsFunction: completeModules(0),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+			cfg, err := loadConfig()
+			if err != nil {
+				return err
+			}
+			selected := make(map[string]bool)
+			for _, mod := range cfg.Modules {
+				selected[mod.Name] = len(args) == 0
+			}
+			if len(args) > 0 {
+				mods, err := cfg.Select(args)
+				if err != nil {
+					return err
+				}
+				for _, mod := range mods {
+					selected[mod.Name] = true
+				}
+			}
+
+			u := newUI()
+			lockPath := registry.LockPath(configFile)
+			lock, err := registry.LoadLock(lockPath)
+			if err != nil {
+				return err
+			}
+			var rows [][]string
+			seen := make(map[string]bool)
+			for _, mod := range cfg.Modules {
+				if !selected[mod.Name] || mod.From == "" || registry.IsLocalRef(mod.From) || seen[mod.From] {
+					continue
+				}
+				seen[mod.From] = true
+				before, oldVersion := lock.Registry[mod.From].SHA256, registry.CachedVersion(mod.From)
+				if _, _, err := registry.FetchRaw(ctx, mod.From, lock, true, u); err != nil {
+					return err
+				}
+				if after := lock.Registry[mod.From].SHA256; after != before {
+					rows = append(rows, []string{mod.Name, mod.From, versionChange(oldVersion, registry.CachedVersion(mod.From), before, after)})
+				}
+			}
+			if err := registry.SaveLock(lockPath, lock); err != nil {
+				return err
+			}
+
+			// Resolve from the refreshed cache so registry modules' own
+			// binaries and scripts are checked too.
+			resolved, err := registry.Resolve(ctx, cfg, configFile, false, u)
+			if err != nil {
+				return err
+			}
+			if lock, err = registry.LoadLock(lockPath); err != nil {
+				return err
+			}
+			cfgDirty := false
+			// Resolve keeps the config's module order, so resolved.Modules[i]
+			// comes from cfg.Modules[i].
+			for i, mod := range resolved.Modules {
+				raw := cfg.Modules[i]
+				if !selected[raw.Name] {
+					continue
+				}
+				for j, item := range mod.Items {
+					var url, pin string
+					switch {
+					case item.Type() == "script" && item.Via == "remote":
+						url, pin = item.Script, item.SHA256
+					case item.Type() == "binary" && item.Version == "latest":
+						url = item.Source.ForOS(platform.Current())
+					default:
+						continue
+					}
+					if url == "" {
+						continue
+					}
+					sum, err := actions.Refresh(ctx, url)
+					if err != nil {
+						return fmt.Errorf("module %q: %w", mod.Name, err)
+					}
+					name := item.Name
+					if name == "" {
+						name = item.PrimaryValue()
+					}
+
+					if pin == "" {
+						before := lock.Downloads[url].SHA256
+						lock.Downloads[url] = registry.LockEntry{SHA256: sum, FetchedAt: time.Now().UTC(), URL: url}
+						if before != "" && before != sum {
+							rows = append(rows, []string{mod.Name, name, fmt.Sprintf("content changed (%s -> %s)", shortSum(before), shortSum(sum))})
+						}
+						continue
+					}
+					if strings.EqualFold(pin, sum) {
+						continue
+					}
+					if raw.IsRegistry() || j >= len(raw.Items) || raw.Items[j].SHA256 != pin {
+						// The pin lives in a registry module or a template,
+						// not somewhere update can rewrite it.
+						u.Warn(fmt.Sprintf("%s: %s no longer matches its sha256 pin %s (now %s)", mod.Name, name, shortSum(pin), shortSum(sum)))
+						continue
+					}
+					raw.Items[j].SHA256 = sum
+					cfgDirty = true
+					rows = append(rows, []string{mod.Name, name, fmt.Sprintf("sha256 pin %s -> %s", shortSum(pin), shortSum(sum))})
+				}
+			}
+			if err := registry.SaveLock(lockPath, lock); err != nil {
+				return err
+			}
+			if cfgDirty {
+				if err := config.Save(configFile, cfg); err != nil {
+					return err
+				}
+			}
+
+			if len(rows) == 0 {
+				u.Info("(everything is up to date)")
+				return nil
+			}
+			u.Table([]string{"MODULE", "ITEM", "CHANGE"}, rows, nil)
+			return nil
+		},
+	}
+}
+
+// versionChange describes a re-fetched registry module by its versions, or
+// by its checksums when the version did not change.
+func versionChange(oldVersion, newVersion, oldSum, newSum string) string {
+	switch {
+	case oldSum == "" && newVersion != "":
+		return "fetched " + newVersion
+	case oldSum == "":
+		return "fetched"
+	case oldVersion != newVersion && oldVersion != "":
+		return fmt.Sprintf("%s -> %s", oldVersion, color.Green(newVersion))
+	default:
+		return fmt.Sprintf("content changed (%s -> %s)", shortSum(oldSum), shortSum(newSum))
+	}
+}
+
+// shortSum abbreviates a hex checksum for display.
+func shortSum(sum string) string {
+	if len(sum) > 12 {
+		return sum[:12]
+	}
+	return sum
+}
+
+// moduleFile is the file a module author keeps a registry module in.
+const moduleFile = "dotular-module.yaml"
+
+// lintModuleFile reads and lints the module at path, printing its problems.
+func lintModuleFile(u *ui.UI, path string) (*registry.RemoteModule, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	mod, problems := registry.Lint(data)
+	if len(problems) == 0 {
+		return mod, nil
+	}
+	for _, p := range problems {
+		u.Warn(p.Error())
+	}
+	return nil, fmt.Errorf("%s: %d problem(s)", path, len(problems))
+}
+
+func registryLintCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "lint [file]",
+		Short: "Check a registry module definition before publishing it",
+		Long: `Checks a module definition (default: ` + moduleFile + `): unknown fields,
+param definitions and defaults, params declared but unused or used but not
+declared, and that the items rendered with the param defaults are valid.
+Exits 1 when anything is wrong.`,
+		Example: `  dotular registry lint
+  dotular registry lint modules/neovim.yaml`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			path := moduleFile
+			if len(args) == 1 {
+				path = args[0]
+			}
+			u := newUI()
+			if _, err := lintModuleFile(u, path); err != nil {
+				return err
+			}
+			u.Success(path + " is valid")
+			return nil
+		},
+	}
+}
+
+// testOSes are the operating systems registry test plans a module for.
+var testOSes = []string{"darwin", "linux", "windows"}
+
+func registryTestCmd() *cobra.Command {
+	var oses []string
+	var with []string
+	cmd := &cobra.Command{
+		Use:   "test [file]",
+		Short: "Lint a registry module and show what it would do on each OS",
+		Long: `Lints a module definition (default: ` + moduleFile + `), then renders it with
+its param defaults and any --with values and plans it for each OS in turn,
+as a dry run that reads nothing from the system and runs no commands. Files
+and directories are taken from the store next to the module file. Exits 1
+when the module has lint problems or fails to plan on any OS.`,
+		Example: `  dotular registry test
+  dotular registry test --os darwin,linux --with version=0.10.2`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			path := moduleFile
+			if len(args) == 1 {
+				path = args[0]
+			}
+			params := make(map[string]any, len(with))
+			for _, kv := range with {
+				name, value, ok := strings.Cut(kv, "=")
+				if !ok || name == "" {
+					return fmt.Errorf("--with: want name=value, got %q", kv)
+				}
+				var v any
+				if err := yaml.Unmarshal([]byte(value), &v); err != nil || v == nil {
+					v = value
+				}
+				params[name] = v
+			}
+			var targets []string
+			for _, goos := range oses {
+				if goos == "macos" {
+					goos = "darwin"
+				}
+				if !slices.Contains(testOSes, goos) {
+					return fmt.Errorf("--os: unknown OS %q (want darwin, linux, or windows)", goos)
+				}
+				targets = append(targets, goos)
+			}
+
+			u := newUI()
+			u.Level = outputLevel()
+			mod, err := lintModuleFile(u, path)
+			if err != nil {
+				return err
+			}
+			items, err := mod.Render(params)
+			if err != nil {
+				return fmt.Errorf("%s: %w", path, err)
+			}
+			module := config.Module{Name: mod.Name, Items: items}
+			cfg := config.Config{Modules: []config.Module{module}}
+			root, err := filepath.Abs(filepath.Dir(path))
+			if err != nil {
+				return err
+			}
+
+			failed := 0
+			for _, goos := range targets {
+				r := runner.New(cfg, true, false, false)
+				r.OS, r.Root = goos, root
+				u.Header(goos)
+				effective, err := r.Effective(module)
+				if err != nil {
+					u.ItemResult("plan", 0, err)
+					failed++
+					continue
+				}
+				applies := 0
+				for _, ei := range effective {
+					if ei.Skipped {
+						u.Skip(ei.Reason, ei.Description)
+						continue
+					}
+					applies++
+					u.Item(ei.Description)
+				}
+				if applies == 0 {
+					u.Warn(fmt.Sprintf("no item applies on %s", goos))
+				}
+			}
+			if failed > 0 {
+				return fmt.Errorf("%s failed to plan on %d of %d OS(es)", path, failed, len(targets))
+			}
+			u.Success(fmt.Sprintf("%s planned on %s", path, strings.Join(targets, ", ")))
+			return nil
+		},
+	}
+	cmd.Flags().StringSliceVar(&oses, "os", testOSes, "operating systems to plan for")
+	cmd.Flags().StringArrayVar(&with, "with", nil, "set a param, as name=value (repeatable)")
+	cmd.RegisterFlagCompletionFunc("os", func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		return listCompletions(testOSes, toComplete), cobra.ShellCompDirectiveNoFileComp
+	})
+	return cmd
+}
+
 // --- init --------------------------------------------------------------------
 
 func isTerminal() bool {
@@ -878,8 +3556,8 @@ func initCmd() *cobra.Command {
 them against the official module registry, and lets you pick which
 modules to add to your dotular.yaml.`,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			ctx := context.Background()
-			u := ui.New(os.Stdout, os.Stderr)
+			ctx := cmd.Context()
+			u := newUI()
 
 			// 1. Fetch the registry index.
 			u.Info("Fetching module registry...")
@@ -926,12 +3604,8 @@ modules to add to your dotular.yaml.`,
 				return err == nil
 			}
 			pkgInstalled := func(manager, pkg string) bool {
-				checkArgs := actions.CheckArgs(manager, pkg)
-				if checkArgs == nil {
-					return false
-				}
-				c := exec.CommandContext(ctx, checkArgs[0], checkArgs[1:]...)
-				return c.Run() == nil
+				installed, _ := (&actions.PackageAction{Package: pkg, Manager: manager}).IsApplied(ctx)
+				return installed
 			}
 
 			results := scanner.ScanInstalled(modules, platform.Current(), expand, fileExists, pkgInstalled)
@@ -1,12 +1,34 @@
 package main
 
 import (
+	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/atomikpanda/dotular/internal/audit"
+	"github.com/atomikpanda/dotular/internal/color"
 	"github.com/atomikpanda/dotular/internal/config"
+	"github.com/atomikpanda/dotular/internal/errs"
+	"github.com/atomikpanda/dotular/internal/machines"
+	"github.com/atomikpanda/dotular/internal/registry"
+	"github.com/atomikpanda/dotular/internal/runlock"
+	"github.com/atomikpanda/dotular/internal/runner"
+	"github.com/atomikpanda/dotular/internal/state"
+	"github.com/atomikpanda/dotular/internal/stats"
+	"github.com/atomikpanda/dotular/internal/ui"
 )
 
 func writeTestConfig(t *testing.T, content string) string {
@@ -34,7 +56,7 @@ func TestBuildRoot(t *testing.T) {
 		names[cmd.Name()] = true
 	}
 
-	expected := []string{"init", "add", "apply", "push", "pull", "sync", "list", "status", "platform", "verify", "encrypt", "decrypt", "tag", "log", "registry"}
+	expected := []string{"init", "add", "adopt", "edit", "apply", "push", "pull", "sync", "list", "show", "status", "plan", "clean", "unapply", "platform", "verify", "encrypt", "decrypt", "tag", "log", "stats", "registry"}
 	for _, name := range expected {
 		if !names[name] {
 			t.Errorf("missing subcommand %q", name)
@@ -107,6 +129,16 @@ func TestVerifyCmdDef(t *testing.T) {
 	}
 }
 
+func TestScheduleCmdDef(t *testing.T) {
+	cmd := scheduleCmd()
+	if cmd.Use != "schedule" {
+		t.Errorf("Use = %q", cmd.Use)
+	}
+	if len(cmd.Commands()) != 2 {
+		t.Errorf("expected install and uninstall subcommands, got %d", len(cmd.Commands()))
+	}
+}
+
 func TestEncryptCmdDef(t *testing.T) {
 	cmd := encryptCmd()
 	if cmd.Use != "encrypt <file>" {
@@ -158,6 +190,43 @@ func TestLoadConfigMissing(t *testing.T) {
 	}
 }
 
+func TestMissingConfigSuggestsInit(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("HOME", dir)
+	t.Setenv(config.EnvVar, "")
+	wd, _ := os.Getwd()
+	os.Chdir(dir)
+	t.Cleanup(func() { os.Chdir(wd) })
+
+	root := buildRoot()
+	root.SetOut(&bytes.Buffer{})
+	root.SetErr(&bytes.Buffer{})
+	root.SetArgs([]string{"list"})
+	err := root.Execute()
+	if err == nil || !strings.Contains(err.Error(), "dotular init") || !strings.Contains(err.Error(), "no dotular.yaml found") {
+		t.Errorf("err = %v, want a hint to run dotular init", err)
+	}
+}
+
+func TestConfigDiscoveredFromEnv(t *testing.T) {
+	path := writeTestConfig(t, listTestConfig)
+	t.Setenv(config.EnvVar, filepath.Dir(path))
+	wd, _ := os.Getwd()
+	os.Chdir(t.TempDir())
+	t.Cleanup(func() { os.Chdir(wd) })
+
+	var out bytes.Buffer
+	root := buildRoot()
+	root.SetOut(&out)
+	root.SetArgs([]string{"list", "--json"})
+	if err := root.Execute(); err != nil {
+		t.Fatal(err)
+	}
+	if configFile != path {
+		t.Errorf("configFile = %q, want %q", configFile, path)
+	}
+}
+
 func TestLoadConfigValid(t *testing.T) {
 	configFile = writeTestConfig(t, `
 modules:
@@ -201,7 +270,8 @@ modules:
       - run: echo hello
 `)
 	dryRun = true
-	verbose = false
+	verbosity = 0
+	quiet = false
 	noAtomic = false
 
 	cfg, _ := loadConfig()
@@ -236,75 +306,77 @@ modules:
 	}
 }
 
-func TestApplyCmdModuleNotFound(t *testing.T) {
+func TestApplyCmdFromOtherDirectory(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
 	path := writeTestConfig(t, `
 modules:
-  - name: test
+  - name: shell
     items:
-      - run: "true"
+      - file: .zshrc
+        destination: ~/
 `)
-	root := buildRoot()
-	root.SetArgs([]string{"apply", "--config", path, "nonexistent"})
-	if err := root.Execute(); err == nil {
-		t.Error("expected error for nonexistent module")
-	}
-}
+	repo := filepath.Dir(path)
+	os.MkdirAll(filepath.Join(repo, "shell"), 0o755)
+	os.WriteFile(filepath.Join(repo, "shell", ".zshrc"), []byte("export A=1\n"), 0o644)
+
+	wd, _ := os.Getwd()
+	os.Chdir(t.TempDir())
+	t.Cleanup(func() { os.Chdir(wd) })
 
-func TestListCmdExecute(t *testing.T) {
-	path := writeTestConfig(t, `
-modules:
-  - name: mod1
-    items:
-      - package: git
-        via: brew
-  - name: mod2
-    items:
-      - run: echo
-`)
 	root := buildRoot()
-	root.SetArgs([]string{"list", "--config", path})
+	root.SetArgs([]string{"apply", "--no-atomic", "--config", path})
 	if err := root.Execute(); err != nil {
 		t.Fatal(err)
 	}
+	data, err := os.ReadFile(filepath.Join(home, ".zshrc"))
+	if err != nil || string(data) != "export A=1\n" {
+		t.Errorf("deployed .zshrc = %q, %v", data, err)
+	}
 }
 
-func TestStatusCmdExecute(t *testing.T) {
+func TestApplyCmdItem(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
 	path := writeTestConfig(t, `
 modules:
-  - name: test
+  - name: shell
     items:
-      - run: echo hello
+      - file: .zshrc
+        destination: ~/
+      - file: .bashrc
+        destination: ~/
 `)
+	repo := filepath.Dir(path)
+	os.MkdirAll(filepath.Join(repo, "shell"), 0o755)
+	os.WriteFile(filepath.Join(repo, "shell", ".zshrc"), []byte("zsh\n"), 0o644)
+	os.WriteFile(filepath.Join(repo, "shell", ".bashrc"), []byte("bash\n"), 0o644)
+
 	root := buildRoot()
-	root.SetArgs([]string{"status", "--config", path})
+	root.SetArgs([]string{"apply", "--no-atomic", "--config", path, "shell", "--item", "2"})
 	if err := root.Execute(); err != nil {
 		t.Fatal(err)
 	}
-}
-
-func TestLogCmdExecute(t *testing.T) {
-	root := buildRoot()
-	root.SetArgs([]string{"log"})
-	root.Execute()
-}
+	if _, err := os.Stat(filepath.Join(home, ".bashrc")); err != nil {
+		t.Errorf(".bashrc not deployed: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(home, ".zshrc")); err == nil {
+		t.Error(".zshrc deployed, want only the selected item applied")
+	}
 
-func TestDirectionCmdExecute(t *testing.T) {
-	path := writeTestConfig(t, `
-modules:
-  - name: test
-    items:
-      - run: echo hello
-`)
-	for _, direction := range []string{"push", "pull", "sync"} {
+	for _, args := range [][]string{
+		{"--item", ".zshrc"},
+		{"shell", "--item", ".fishrc"},
+	} {
 		root := buildRoot()
-		root.SetArgs([]string{direction, "--dry-run", "--config", path})
-		if err := root.Execute(); err != nil {
-			t.Errorf("%s: %v", direction, err)
+		root.SetArgs(append([]string{"apply", "--dry-run", "--config", path}, args...))
+		if err := root.Execute(); err == nil {
+			t.Errorf("apply %v: expected error", args)
 		}
 	}
 }
 
-func TestDirectionCmdModuleNotFound(t *testing.T) {
+func TestApplyCmdModuleNotFound(t *testing.T) {
 	path := writeTestConfig(t, `
 modules:
   - name: test
@@ -312,198 +384,917 @@ modules:
       - run: "true"
 `)
 	root := buildRoot()
-	root.SetArgs([]string{"push", "--config", path, "nonexistent"})
+	root.SetArgs([]string{"apply", "--config", path, "nonexistent"})
 	if err := root.Execute(); err == nil {
 		t.Error("expected error for nonexistent module")
 	}
 }
 
-func TestKeyFromConfigNoKey(t *testing.T) {
+func TestSelectModulesGroup(t *testing.T) {
 	configFile = writeTestConfig(t, `
 modules:
-  - name: test
-    items: []
+  - name: git
+    items: [{run: "true"}]
+  - name: editors
+    modules:
+      - name: nvim
+        items: [{run: "true"}]
+      - name: helix
+        items: [{run: "true"}]
 `)
-	t.Setenv("DOTULAR_AGE_IDENTITY", "")
-	t.Setenv("DOTULAR_AGE_PASSPHRASE", "")
-
-	_, err := keyFromConfig()
-	if err == nil {
-		t.Error("expected error when no age key configured")
+	cfg, err := loadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	mods, err := cfg.Select([]string{"nvim", "editors", "git"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, mod := range mods {
+		names = append(names, mod.Name)
+	}
+	if strings.Join(names, ",") != "nvim,helix,git" {
+		t.Errorf("selected %v, want the group expanded without duplicates", names)
+	}
+	if _, err := cfg.Select([]string{"missing"}); err == nil {
+		t.Error("expected an error for an unknown name")
 	}
 }
 
-func TestKeyFromConfigWithPassphrase(t *testing.T) {
+func TestSelectModulesPatterns(t *testing.T) {
 	configFile = writeTestConfig(t, `
-age:
-  passphrase: "test-pass"
-modules: []
+modules:
+  - name: shell
+    items: [{run: "true"}]
+  - name: shell-legacy
+    items: [{run: "true"}]
+  - name: git
+    items: [{run: "true"}]
+  - name: editors
+    modules:
+      - name: nvim
+        items: [{run: "true"}]
+      - name: helix
+        items: [{run: "true"}]
 `)
-	key, err := keyFromConfig()
+	cfg, err := loadConfig()
 	if err != nil {
 		t.Fatal(err)
 	}
-	if key.Passphrase != "test-pass" {
-		t.Errorf("Passphrase = %q", key.Passphrase)
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"shell*"}, "shell,shell-legacy"},
+		{[]string{"shell*", "!shell-legacy"}, "shell"},
+		{[]string{"!shell*"}, "git,nvim,helix"},
+		{[]string{"edit*", "!helix"}, "nvim"},
+		{[]string{"!editors", "!git"}, "shell,shell-legacy"},
+		{[]string{"git", "?hell"}, "git,shell"},
+	}
+	for _, tt := range tests {
+		mods, err := cfg.Select(tt.args)
+		if err != nil {
+			t.Errorf("%v: %v", tt.args, err)
+			continue
+		}
+		var names []string
+		for _, mod := range mods {
+			names = append(names, mod.Name)
+		}
+		if got := strings.Join(names, ","); got != tt.want {
+			t.Errorf("%v selected %s, want %s", tt.args, got, tt.want)
+		}
+	}
+	for _, args := range [][]string{{"zsh*"}, {"!missing"}, {"[shell"}, {"shell", "!shell"}} {
+		if _, err := cfg.Select(args); !errors.Is(err, errs.ErrModuleNotFound) && !strings.Contains(fmt.Sprint(err), "invalid module pattern") {
+			t.Errorf("%v: err = %v", args, err)
+		}
 	}
 }
 
-func TestVerifyCmdExecute(t *testing.T) {
+func TestListCmdExecute(t *testing.T) {
 	path := writeTestConfig(t, `
 modules:
-  - name: test
+  - name: mod1
     items:
-      - run: echo hello
-        verify: "true"
+      - package: git
+        via: brew
+  - name: mod2
+    items:
+      - run: echo
 `)
 	root := buildRoot()
-	root.SetArgs([]string{"verify", "--config", path})
+	root.SetArgs([]string{"list", "--config", path})
 	if err := root.Execute(); err != nil {
 		t.Fatal(err)
 	}
 }
 
-func TestVerifyCmdModuleNotFound(t *testing.T) {
-	path := writeTestConfig(t, `
+const listTestConfig = `
 modules:
-  - name: test
-    items: []
-`)
-	root := buildRoot()
-	root.SetArgs([]string{"verify", "--config", path, "nonexistent"})
-	if err := root.Execute(); err == nil {
-		t.Error("expected error for nonexistent module")
-	}
-}
+  - name: git
+    items:
+      - package: git
+        via: brew
+      - file: .gitconfig
+        destination: ~/
+  - name: work
+    only_tags: [work-laptop-only]
+    items:
+      - run: echo hi
+`
 
-func TestRegistryClearCmdExecute(t *testing.T) {
+func TestListCmdJSON(t *testing.T) {
+	path := writeTestConfig(t, listTestConfig)
+	var out bytes.Buffer
 	root := buildRoot()
-	root.SetArgs([]string{"registry", "clear"})
+	root.SetOut(&out)
+	root.SetArgs([]string{"list", "--json", "--config", path})
 	if err := root.Execute(); err != nil {
 		t.Fatal(err)
 	}
+	var listed []listedModule
+	if err := json.Unmarshal(out.Bytes(), &listed); err != nil {
+		t.Fatalf("invalid JSON: %v\n%s", err, out.String())
+	}
+	if len(listed) != 2 || len(listed[0].Items) != 2 {
+		t.Fatalf("listed = %+v", listed)
+	}
+	if file := listed[0].Items[1]; file.Type != "file" || file.Direction != "push" || file.Destination != "~/" {
+		t.Errorf("file item = %+v", file)
+	}
+	if listed[0].Skipped || !listed[1].Skipped {
+		t.Errorf("skipped = %v, %v; want only the tagged module skipped", listed[0].Skipped, listed[1].Skipped)
+	}
 }
 
-func TestRegistryListCmdExecute(t *testing.T) {
-	path := writeTestConfig(t, `modules: []`)
-	root := buildRoot()
-	root.SetArgs([]string{"registry", "list", "--config", path})
-	if err := root.Execute(); err != nil {
-		t.Fatal(err)
+func TestListCmdFilters(t *testing.T) {
+	path := writeTestConfig(t, listTestConfig)
+	for _, tt := range []struct {
+		args []string
+		want []string
+	}{
+		{[]string{"--type", "run"}, []string{"work"}},
+		{[]string{"--type", "files"}, []string{"git"}},
+		{[]string{"--tags", "other"}, []string{"git"}},
+		{[]string{"--tags", "work-laptop-only"}, []string{"git", "work"}},
+	} {
+		var out bytes.Buffer
+		root := buildRoot()
+		root.SetOut(&out)
+		root.SetArgs(append([]string{"list", "--json", "--config", path}, tt.args...))
+		if err := root.Execute(); err != nil {
+			t.Fatal(err)
+		}
+		var listed []listedModule
+		json.Unmarshal(out.Bytes(), &listed)
+		var names []string
+		for _, lm := range listed {
+			names = append(names, lm.Name)
+		}
+		if strings.Join(names, ",") != strings.Join(tt.want, ",") {
+			t.Errorf("list %v = %v, want %v", tt.args, names, tt.want)
+		}
 	}
 }
 
-func TestEncryptDecryptCmdExecute(t *testing.T) {
-	dir := t.TempDir()
-	configPath := filepath.Join(dir, "dotular.yaml")
-	os.WriteFile(configPath, []byte(`
-age:
-  passphrase: "test-password"
-modules: []
-`), 0o644)
-
-	// Create a file to encrypt.
-	plainFile := filepath.Join(dir, "secret.txt")
-	os.WriteFile(plainFile, []byte("secret data"), 0o644)
-
-	// Encrypt.
+func TestListCmdItems(t *testing.T) {
+	path := writeTestConfig(t, listTestConfig)
+	var out bytes.Buffer
 	root := buildRoot()
-	root.SetArgs([]string{"encrypt", "--config", configPath, plainFile})
+	root.SetOut(&out)
+	root.SetArgs([]string{"list", "--items", "--config", path})
 	if err := root.Execute(); err != nil {
 		t.Fatal(err)
 	}
-
-	// Verify .age file was created.
-	ageFile := plainFile + ".age"
-	if _, err := os.Stat(ageFile); err != nil {
-		t.Fatalf("expected %s to exist: %v", ageFile, err)
-	}
-
-	// Decrypt.
-	decryptedFile := filepath.Join(dir, "secret.txt.decrypted")
-	// The decrypt command removes the .age suffix.
-	root2 := buildRoot()
-	root2.SetArgs([]string{"decrypt", "--config", configPath, ageFile})
-	if err := root2.Execute(); err != nil {
-		t.Fatal(err)
+	for _, want := range []string{"git via brew", ".gitconfig push -> ~/", "skipped on this machine"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("output missing %q:\n%s", want, out.String())
+		}
 	}
+}
 
-	// Verify decrypted file content.
-	data, _ := os.ReadFile(plainFile) // decrypt writes back to plainFile (without .age)
-	if string(data) == "" {
-		_ = decryptedFile // unused but that's fine
+func TestCompletions(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	path := writeTestConfig(t, `
+profiles:
+  work:
+    tags: [office]
+modules:
+  - name: shell
+    only_tags: [laptop]
+    modules:
+      - name: zsh
+        items:
+          - file: .zshrc
+            destination: ~/
+  - name: nvim
+    from: github.com/atomikpanda/dotular/modules/neovim@main
+`)
+	for _, tt := range []struct {
+		args []string
+		want []string
+	}{
+		{[]string{"apply", "zsh", ""}, []string{"shell\tgroup", "nvim\tgithub.com/atomikpanda/dotular/modules/neovim@main"}},
+		{[]string{"show", "zsh", ""}, nil},
+		{[]string{"edit", "zsh", ""}, []string{".zshrc"}},
+		{[]string{"list", "--tags", "laptop,"}, []string{"laptop,office"}},
+		{[]string{"apply", "--profile", ""}, []string{"devcontainer", "work", "none"}},
+		{[]string{"tag", "add", ""}, []string{"laptop", "office"}},
+	} {
+		var out bytes.Buffer
+		root := buildRoot()
+		root.SetOut(&out)
+		root.SetArgs(append([]string{"__complete", "--config", path}, tt.args...))
+		if err := root.Execute(); err != nil {
+			t.Fatal(err)
+		}
+		lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+		got := lines[:len(lines)-1] // the last line is the directive
+		if strings.Join(got, "|") != strings.Join(tt.want, "|") {
+			t.Errorf("complete %v = %q, want %q", tt.args, got, tt.want)
+		}
 	}
 }
 
-func TestTagListCmdExecute(t *testing.T) {
+func TestShowCmdJSON(t *testing.T) {
 	dir := t.TempDir()
 	t.Setenv("HOME", dir)
+	module := `name: nvim
+params:
+  config_dir:
+    default: ~/.config/nvim
+items:
+  - package: neovim
+  - file: init.lua
+    destination:
+      linux: "{{ .config_dir }}/"
+      macos: "{{ .config_dir }}/"
+      windows: "{{ .config_dir }}/"
+`
+	if err := os.WriteFile(filepath.Join(dir, "nvim.yaml"), []byte(module), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "dotular.yaml")
+	cfg := `modules:
+  - name: editor
+    from: ./nvim.yaml
+    with:
+      config_dir: ~/nvim
+    override:
+      - package: neovim
+        via: apt
+`
+	if err := os.WriteFile(path, []byte(cfg), 0o644); err != nil {
+		t.Fatal(err)
+	}
 
+	var out bytes.Buffer
 	root := buildRoot()
-	root.SetArgs([]string{"tag", "list"})
+	root.SetOut(&out)
+	root.SetArgs([]string{"show", "editor", "--json", "--config", path})
 	if err := root.Execute(); err != nil {
 		t.Fatal(err)
 	}
+	var shown []shownModule
+	if err := json.Unmarshal(out.Bytes(), &shown); err != nil {
+		t.Fatalf("invalid JSON: %v\n%s", err, out.String())
+	}
+	if len(shown) != 1 || shown[0].From != "./nvim.yaml" || shown[0].With["config_dir"] != "~/nvim" {
+		t.Fatalf("shown = %+v", shown)
+	}
+	def := shown[0].Definition
+	if len(def.Items) != 2 || def.Items[0].Via != "apt" {
+		t.Errorf("definition items = %+v, want the override merged", def.Items)
+	}
+	eff := shown[0].Effective
+	if len(eff) != 2 {
+		t.Fatalf("effective = %+v", eff)
+	}
+	if want := filepath.Join(dir, "nvim", "init.lua"); eff[1].Destination != want {
+		t.Errorf("destination = %q, want %q", eff[1].Destination, want)
+	}
+	if want := filepath.Join(dir, "editor", "init.lua"); eff[1].Source != want {
+		t.Errorf("source = %q, want %q", eff[1].Source, want)
+	}
 }
 
-func TestTagAddCmdExecute(t *testing.T) {
-	dir := t.TempDir()
-	t.Setenv("HOME", dir)
-
+func TestShowCmdModuleNotFound(t *testing.T) {
+	path := writeTestConfig(t, listTestConfig)
 	root := buildRoot()
-	root.SetArgs([]string{"tag", "add", "work"})
-	if err := root.Execute(); err != nil {
-		t.Fatal(err)
+	root.SetArgs([]string{"show", "nope", "--config", path})
+	if err := root.Execute(); err == nil {
+		t.Error("expected an error for an unknown module")
 	}
 }
 
-func TestApplyWithSpecificModule(t *testing.T) {
-	path := writeTestConfig(t, `
-modules:
-  - name: alpha
-    items:
-      - run: "true"
-  - name: beta
-    items:
-      - run: "true"
-`)
+func TestShowCmdText(t *testing.T) {
+	path := writeTestConfig(t, listTestConfig)
+	var out bytes.Buffer
 	root := buildRoot()
-	root.SetArgs([]string{"apply", "--dry-run", "--config", path, "alpha"})
+	root.SetOut(&out)
+	root.SetArgs([]string{"show", "git", "--config", path})
 	if err := root.Execute(); err != nil {
 		t.Fatal(err)
 	}
+	for _, want := range []string{"definition:", "effective on " + runtime.GOOS + ":", "destination:"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("output missing %q:\n%s", want, out.String())
+		}
+	}
 }
 
-func TestDirectionCmdWithModule(t *testing.T) {
+func TestStatusCmdExecute(t *testing.T) {
 	path := writeTestConfig(t, `
 modules:
-  - name: mymod
+  - name: test
     items:
-      - run: "true"
+      - run: echo hello
 `)
 	root := buildRoot()
-	root.SetArgs([]string{"push", "--dry-run", "--config", path, "mymod"})
+	root.SetArgs([]string{"status", "--config", path})
 	if err := root.Execute(); err != nil {
 		t.Fatal(err)
 	}
 }
 
-func TestVerifyCmdWithModule(t *testing.T) {
+func TestApplyCmdKeepGoing(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Unix-only test")
+	}
+	home := t.TempDir()
+	t.Setenv("HOME", home)
 	path := writeTestConfig(t, `
 modules:
-  - name: mymod
+  - name: broken
     items:
-      - run: "true"
-        verify: "true"
+      - run: "false"
+      - run: touch "$HOME/broken-rest"
+  - name: fine
+    items:
+      - run: touch "$HOME/fine"
+  - name: app
+    items:
+      - file: good.conf
+        destination: ~/
+      - file: bad.conf
+        destination: ~/
+        hooks:
+          after_apply: "false"
 `)
+	repo := filepath.Dir(path)
+	os.MkdirAll(filepath.Join(repo, "app"), 0o755)
+	os.WriteFile(filepath.Join(repo, "app", "good.conf"), []byte("good"), 0o644)
+	os.WriteFile(filepath.Join(repo, "app", "bad.conf"), []byte("bad"), 0o644)
+	os.WriteFile(filepath.Join(home, "bad.conf"), []byte("before"), 0o644)
+
+	// --keep-going reports the failing module, skips the rest of it, and
+	// still applies the next module.
 	root := buildRoot()
-	root.SetArgs([]string{"verify", "--config", path, "mymod"})
-	if err := root.Execute(); err != nil {
-		t.Fatal(err)
+	root.SetArgs([]string{"apply", "--no-atomic", "--keep-going", "--config", path, "broken", "fine"})
+	err := root.Execute()
+	if err == nil || !strings.Contains(err.Error(), `module "broken"`) {
+		t.Errorf("err = %v, want the broken module reported", err)
+	}
+	if _, err := os.Stat(filepath.Join(home, "fine")); err != nil {
+		t.Error("the module after the failing one was not applied")
+	}
+	if _, err := os.Stat(filepath.Join(home, "broken-rest")); err == nil {
+		t.Error("the rest of the failing module ran")
+	}
+
+	// --keep-going=item rolls back only the item that failed.
+	root = buildRoot()
+	root.SetArgs([]string{"apply", "--keep-going=item", "--config", path, "app"})
+	if err := root.Execute(); err == nil || !strings.Contains(err.Error(), `module "app"`) {
+		t.Errorf("err = %v, want the app module reported", err)
+	}
+	if got, _ := os.ReadFile(filepath.Join(home, "good.conf")); string(got) != "good" {
+		t.Errorf("good.conf = %q; the item that succeeded was rolled back", got)
+	}
+	if got, _ := os.ReadFile(filepath.Join(home, "bad.conf")); string(got) != "before" {
+		t.Errorf("bad.conf = %q; the failed item was not rolled back", got)
 	}
 }
 
-func TestRegistryUpdateCmdExecute(t *testing.T) {
+func TestOutputLevel(t *testing.T) {
+	defer func() { quiet, verbosity = false, 0 }()
+	tests := []struct {
+		quiet     bool
+		verbosity int
+		want      ui.Level
+	}{
+		{false, 0, ui.LevelNormal},
+		{false, 1, ui.LevelVerbose},
+		{false, 2, ui.LevelDebug},
+		{true, 0, ui.LevelQuiet},
+	}
+	for _, tt := range tests {
+		quiet, verbosity = tt.quiet, tt.verbosity
+		if got := outputLevel(); got != tt.want {
+			t.Errorf("quiet=%v verbosity=%d: got %d, want %d", tt.quiet, tt.verbosity, got, tt.want)
+		}
+	}
+}
+
+func TestVerbosityFlags(t *testing.T) {
+	path := writeTestConfig(t, `
+modules:
+  - name: test
+    items:
+      - run: "true"
+`)
+	root := buildRoot()
+	root.SetArgs([]string{"apply", "--dry-run", "-vv", "--config", path})
+	if err := root.Execute(); err != nil {
+		t.Fatal(err)
+	}
+	if verbosity != 2 {
+		t.Errorf("verbosity = %d, want 2", verbosity)
+	}
+
+	root = buildRoot()
+	root.SetArgs([]string{"apply", "--dry-run", "-q", "-v", "--config", path})
+	if err := root.Execute(); err == nil {
+		t.Error("expected error combining --quiet and --verbose")
+	}
+}
+
+func TestCleanCmd(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	orphan := filepath.Join(home, ".oldrc")
+	os.WriteFile(orphan, []byte("old"), 0o644)
+	hash, _ := state.HashFile(orphan)
+
+	other := filepath.Join(home, ".otherrc")
+	os.WriteFile(other, []byte("other"), 0o644)
+	otherHash, _ := state.HashFile(other)
+	path := writeTestConfig(t, `
+modules:
+  - name: test
+    items:
+      - run: "true"
+`)
+	abs, _ := filepath.Abs(path)
+
+	statePath, _ := state.DefaultPath()
+	st := state.New()
+	st.Record(state.Resource{Kind: state.KindFile, Path: orphan, Module: "old", Config: abs, Hash: hash})
+	st.Record(state.Resource{Kind: state.KindFile, Path: other, Module: "old", Config: filepath.Join(home, "other.yaml"), Hash: otherHash})
+	if err := st.Save(statePath); err != nil {
+		t.Fatal(err)
+	}
+
+	root := buildRoot()
+	root.SetArgs([]string{"clean", "--config", path})
+	if err := root.Execute(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(orphan); err != nil {
+		t.Fatal("clean without --force must not remove files")
+	}
+
+	root = buildRoot()
+	root.SetArgs([]string{"clean", "--force", "--config", path})
+	if err := root.Execute(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(orphan); !os.IsNotExist(err) {
+		t.Error("clean --force should remove the orphan")
+	}
+	if _, err := os.Stat(other); err != nil {
+		t.Error("clean --force must not remove resources deployed from another config")
+	}
+}
+
+func TestUnapplyCmd(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	deployed := filepath.Join(home, ".vimrc")
+	os.WriteFile(deployed, []byte("set nu"), 0o644)
+	hash, _ := state.HashFile(deployed)
+
+	path := writeTestConfig(t, `
+modules:
+  - name: test
+    items:
+      - run: "true"
+`)
+	abs, _ := filepath.Abs(path)
+	statePath, _ := state.DefaultPath()
+	st := state.New()
+	st.Record(state.Resource{Kind: state.KindFile, Path: deployed, Module: "vim", Config: abs, Hash: hash})
+	if err := st.Save(statePath); err != nil {
+		t.Fatal(err)
+	}
+
+	root := buildRoot()
+	root.SetArgs([]string{"unapply", "vim", "--dry-run", "--config", path})
+	if err := root.Execute(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(deployed); err != nil {
+		t.Fatal("unapply --dry-run must not remove files")
+	}
+
+	root = buildRoot()
+	root.SetArgs([]string{"unapply", "vim", "--config", path})
+	if err := root.Execute(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(deployed); !os.IsNotExist(err) {
+		t.Error("unapply should remove the module's deployed file")
+	}
+
+	root = buildRoot()
+	root.SetArgs([]string{"unapply", "missing", "--config", path})
+	if err := root.Execute(); err == nil {
+		t.Error("expected error for unknown module")
+	}
+}
+
+func TestPlanCmdJSON(t *testing.T) {
+	path := writeTestConfig(t, `
+modules:
+  - name: test
+    items:
+      - run: echo hello
+      - run: echo never
+        when: "false"
+`)
+	var out bytes.Buffer
+	root := buildRoot()
+	root.SetOut(&out)
+	root.SetArgs([]string{"plan", "--json", "--config", path})
+	if err := root.Execute(); err != nil {
+		t.Fatal(err)
+	}
+	var plan runner.Plan
+	if err := json.Unmarshal(out.Bytes(), &plan); err != nil {
+		t.Fatalf("invalid JSON: %v\n%s", err, out.String())
+	}
+	acts := plan.Modules[0].Actions
+	if len(acts) != 2 || acts[0].Status != runner.StatusApply || acts[1].Reason != "when" {
+		t.Errorf("plan = %+v", plan)
+	}
+}
+
+func TestPlanCmdModuleNotFound(t *testing.T) {
+	path := writeTestConfig(t, `
+modules:
+  - name: test
+    items:
+      - run: "true"
+`)
+	root := buildRoot()
+	root.SetArgs([]string{"plan", "--config", path, "nonexistent"})
+	if err := root.Execute(); err == nil {
+		t.Error("expected error for nonexistent module")
+	}
+}
+
+func TestLogCmdExecute(t *testing.T) {
+	root := buildRoot()
+	root.SetArgs([]string{"log"})
+	root.Execute()
+}
+
+func TestStatsCmdJSON(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	audit.Log(audit.Entry{Command: "apply", Module: "git", Item: "run make", Outcome: "failure", DurationMS: 1200})
+
+	root := buildRoot()
+	var out bytes.Buffer
+	root.SetOut(&out)
+	root.SetArgs([]string{"stats", "--json"})
+	if err := root.Execute(); err != nil {
+		t.Fatal(err)
+	}
+	var rep stats.Report
+	if err := json.Unmarshal(out.Bytes(), &rep); err != nil {
+		t.Fatalf("parse %q: %v", out.String(), err)
+	}
+	if len(rep.Failing) != 1 || rep.Failing[0].Item != "run make" || len(rep.Machines) != 1 {
+		t.Errorf("report = %+v", rep)
+	}
+}
+
+func TestDirectionCmdExecute(t *testing.T) {
+	path := writeTestConfig(t, `
+modules:
+  - name: test
+    items:
+      - run: echo hello
+`)
+	for _, direction := range []string{"push", "pull", "sync"} {
+		root := buildRoot()
+		root.SetArgs([]string{direction, "--dry-run", "--config", path})
+		if err := root.Execute(); err != nil {
+			t.Errorf("%s: %v", direction, err)
+		}
+	}
+}
+
+func TestDirectionCmdModuleNotFound(t *testing.T) {
+	path := writeTestConfig(t, `
+modules:
+  - name: test
+    items:
+      - run: "true"
+`)
+	root := buildRoot()
+	root.SetArgs([]string{"push", "--config", path, "nonexistent"})
+	if err := root.Execute(); err == nil {
+		t.Error("expected error for nonexistent module")
+	}
+}
+
+func TestKeyFromConfigNoKey(t *testing.T) {
+	configFile = writeTestConfig(t, `
+modules:
+  - name: test
+    items: []
+`)
+	t.Setenv("DOTULAR_AGE_IDENTITY", "")
+	t.Setenv("DOTULAR_AGE_PASSPHRASE", "")
+
+	_, err := keyFromConfig()
+	if err == nil {
+		t.Error("expected error when no age key configured")
+	}
+}
+
+func TestKeyFromConfigWithPassphrase(t *testing.T) {
+	configFile = writeTestConfig(t, `
+age:
+  passphrase: "test-pass"
+modules: []
+`)
+	key, err := keyFromConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key.Passphrase != "test-pass" {
+		t.Errorf("Passphrase = %q", key.Passphrase)
+	}
+}
+
+func TestVerifyCmdExecute(t *testing.T) {
+	path := writeTestConfig(t, `
+modules:
+  - name: test
+    items:
+      - run: echo hello
+        verify: "true"
+`)
+	root := buildRoot()
+	root.SetArgs([]string{"verify", "--config", path})
+	if err := root.Execute(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestVerifyCmdModuleNotFound(t *testing.T) {
+	path := writeTestConfig(t, `
+modules:
+  - name: test
+    items: []
+`)
+	root := buildRoot()
+	root.SetArgs([]string{"verify", "--config", path, "nonexistent"})
+	if err := root.Execute(); err == nil {
+		t.Error("expected error for nonexistent module")
+	}
+}
+
+func TestScheduleInstallDryRun(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	path := writeTestConfig(t, `modules: []`)
+	root := buildRoot()
+	root.SetArgs([]string{"schedule", "install", "--dry-run", "--every", "2h", "--config", path})
+	if err := root.Execute(); err != nil {
+		t.Fatal(err)
+	}
+
+	root = buildRoot()
+	root.SetArgs([]string{"schedule", "install", "--dry-run", "--command", "clean", "--config", path})
+	if err := root.Execute(); err == nil {
+		t.Error("expected error for unschedulable command")
+	}
+}
+
+func TestRegistryClearCmdExecute(t *testing.T) {
+	root := buildRoot()
+	root.SetArgs([]string{"registry", "clear"})
+	if err := root.Execute(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRegistryListCmdExecute(t *testing.T) {
+	path := writeTestConfig(t, `modules: []`)
+	root := buildRoot()
+	root.SetArgs([]string{"registry", "list", "--config", path})
+	if err := root.Execute(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRegistryVendorCmdNoRegistryModules(t *testing.T) {
+	path := writeTestConfig(t, `
+modules:
+  - name: local
+    items:
+      - run: "true"
+`)
+	root := buildRoot()
+	root.SetArgs([]string{"registry", "vendor", "--config", path})
+	if err := root.Execute(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(filepath.Dir(path), "vendor")); !os.IsNotExist(err) {
+		t.Error("vendor directory should not be created when nothing is vendored")
+	}
+}
+
+func TestRegistryPruneCmdExecute(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	path := writeTestConfig(t, `
+modules:
+  - from: neovim
+`)
+	lockPath := filepath.Join(filepath.Dir(path), "dotular.lock.yaml")
+	os.WriteFile(lockPath, []byte(`registry:
+  neovim:
+    sha256: abc
+  old-module:
+    sha256: def
+`), 0o644)
+
+	root := buildRoot()
+	root.SetArgs([]string{"registry", "prune", "--dry-run", "--config", path})
+	if err := root.Execute(); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(lockPath); !strings.Contains(string(data), "old-module") {
+		t.Error("dry run should not modify the lockfile")
+	}
+
+	root = buildRoot()
+	root.SetArgs([]string{"registry", "prune", "--config", path})
+	if err := root.Execute(); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := os.ReadFile(lockPath)
+	if strings.Contains(string(data), "old-module") || !strings.Contains(string(data), "neovim") {
+		t.Errorf("lockfile after prune = %s", data)
+	}
+}
+
+func TestRegistryVerifyCmdExecute(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	path := writeTestConfig(t, `modules: []`)
+	lockPath := filepath.Join(filepath.Dir(path), "dotular.lock.yaml")
+
+	// No lockfile: nothing to verify.
+	root := buildRoot()
+	root.SetArgs([]string{"registry", "verify", "--config", path})
+	if err := root.Execute(); err != nil {
+		t.Fatal(err)
+	}
+
+	// A locked ref whose cache no longer matches is reported as drift.
+	cacheDir := filepath.Join(home, ".cache", "dotular", "registry")
+	os.MkdirAll(cacheDir, 0o755)
+	os.WriteFile(filepath.Join(cacheDir, "mod.yaml"), []byte("name: changed\n"), 0o644)
+	os.WriteFile(lockPath, []byte(`registry:
+  mod:
+    sha256: abc
+`), 0o644)
+
+	root = buildRoot()
+	root.SetArgs([]string{"registry", "verify", "--config", path})
+	if err := root.Execute(); err == nil {
+		t.Error("expected error for checksum drift")
+	}
+}
+
+func TestEncryptDecryptCmdExecute(t *testing.T) {
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "dotular.yaml")
+	os.WriteFile(configPath, []byte(`
+age:
+  passphrase: "test-password"
+modules: []
+`), 0o644)
+
+	// Create a file to encrypt.
+	plainFile := filepath.Join(dir, "secret.txt")
+	os.WriteFile(plainFile, []byte("secret data"), 0o644)
+
+	// Encrypt.
+	root := buildRoot()
+	root.SetArgs([]string{"encrypt", "--config", configPath, plainFile})
+	if err := root.Execute(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Verify .age file was created.
+	ageFile := plainFile + ".age"
+	if _, err := os.Stat(ageFile); err != nil {
+		t.Fatalf("expected %s to exist: %v", ageFile, err)
+	}
+
+	// Decrypt.
+	decryptedFile := filepath.Join(dir, "secret.txt.decrypted")
+	// The decrypt command removes the .age suffix.
+	root2 := buildRoot()
+	root2.SetArgs([]string{"decrypt", "--config", configPath, ageFile})
+	if err := root2.Execute(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Verify decrypted file content.
+	data, _ := os.ReadFile(plainFile) // decrypt writes back to plainFile (without .age)
+	if string(data) == "" {
+		_ = decryptedFile // unused but that's fine
+	}
+}
+
+func TestTagListCmdExecute(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("HOME", dir)
+
+	root := buildRoot()
+	root.SetArgs([]string{"tag", "list"})
+	if err := root.Execute(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTagAddCmdExecute(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("HOME", dir)
+
+	root := buildRoot()
+	root.SetArgs([]string{"tag", "add", "work"})
+	if err := root.Execute(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestApplyWithSpecificModule(t *testing.T) {
+	path := writeTestConfig(t, `
+modules:
+  - name: alpha
+    items:
+      - run: "true"
+  - name: beta
+    items:
+      - run: "true"
+`)
+	root := buildRoot()
+	root.SetArgs([]string{"apply", "--dry-run", "--config", path, "alpha"})
+	if err := root.Execute(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDirectionCmdWithModule(t *testing.T) {
+	path := writeTestConfig(t, `
+modules:
+  - name: mymod
+    items:
+      - run: "true"
+`)
+	root := buildRoot()
+	root.SetArgs([]string{"push", "--dry-run", "--config", path, "mymod"})
+	if err := root.Execute(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestVerifyCmdWithModule(t *testing.T) {
+	path := writeTestConfig(t, `
+modules:
+  - name: mymod
+    items:
+      - run: "true"
+        verify: "true"
+`)
+	root := buildRoot()
+	root.SetArgs([]string{"verify", "--config", path, "mymod"})
+	if err := root.Execute(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRegistryUpdateCmdExecute(t *testing.T) {
 	path := writeTestConfig(t, `modules: []`)
 	root := buildRoot()
 	root.SetArgs([]string{"registry", "update", "--config", path})
@@ -512,6 +1303,112 @@ func TestRegistryUpdateCmdExecute(t *testing.T) {
 	}
 }
 
+func TestRegistryUpdateCmdUnknownRef(t *testing.T) {
+	path := writeTestConfig(t, `
+modules:
+  - name: nvim
+    from: ./vendor/neovim.yaml
+`)
+	root := buildRoot()
+	root.SetArgs([]string{"registry", "update", "--preview", "neovim", "--config", path})
+	err := root.Execute()
+	if err == nil || !strings.Contains(err.Error(), `no module in the config uses registry ref "neovim"`) {
+		t.Errorf("err = %v", err)
+	}
+}
+
+func TestRegistryTestCmd(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	dir := t.TempDir()
+	path := filepath.Join(dir, "dotular-module.yaml")
+	module := `
+name: tool
+params:
+  channel: {required: true, enum: [stable, nightly]}
+items:
+  - binary: tool
+    source:
+      linux: https://example.com/{{ .channel }}/tool.tgz
+`
+	if err := os.WriteFile(path, []byte(module), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	root := buildRoot()
+	root.SetArgs([]string{"registry", "test", path, "--os", "macos,linux", "--with", "channel=nightly"})
+	if err := root.Execute(); err != nil {
+		t.Fatal(err)
+	}
+
+	root = buildRoot()
+	root.SetArgs([]string{"registry", "test", path, "--with", "channel=beta"})
+	if err := root.Execute(); err == nil || !strings.Contains(err.Error(), "must be one of") {
+		t.Errorf("err = %v, want the param rejected", err)
+	}
+
+	root = buildRoot()
+	root.SetArgs([]string{"registry", "test", path, "--os", "plan9"})
+	if err := root.Execute(); err == nil || !strings.Contains(err.Error(), `unknown OS "plan9"`) {
+		t.Errorf("err = %v", err)
+	}
+
+	if err := os.WriteFile(path, []byte(module+"    colour: red\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	root = buildRoot()
+	root.SetArgs([]string{"registry", "lint", path})
+	if err := root.Execute(); err == nil || !strings.Contains(err.Error(), "1 problem(s)") {
+		t.Errorf("lint err = %v", err)
+	}
+}
+
+func TestUpdateCmd(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "echo %s\n", r.URL.Path)
+	}))
+	defer srv.Close()
+	sum := func(s string) string { return fmt.Sprintf("%x", sha256.Sum256([]byte(s))) }
+
+	path := writeTestConfig(t, fmt.Sprintf(`
+modules:
+  - name: tools
+    items:
+      # keep this comment
+      - script: %[1]s/pinned.sh
+        via: remote
+        sha256: %[2]s
+      - script: %[1]s/unpinned.sh
+        via: remote
+`, srv.URL, sum("old")))
+	root := buildRoot()
+	root.SetArgs([]string{"update", "tools", "--config", path})
+	if err := root.Execute(); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), "sha256: "+sum("echo /pinned.sh\n")) {
+		t.Errorf("pin not updated:\n%s", data)
+	}
+	if !strings.Contains(string(data), "# keep this comment") {
+		t.Errorf("comment lost:\n%s", data)
+	}
+	lock, err := registry.LoadLock(registry.LockPath(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := lock.Downloads[srv.URL+"/unpinned.sh"].SHA256; got != sum("echo /unpinned.sh\n") {
+		t.Errorf("lock download sum = %q", got)
+	}
+	if _, ok := lock.Downloads[srv.URL+"/pinned.sh"]; ok {
+		t.Error("pinned script should not be recorded in the lockfile")
+	}
+}
+
 func TestInitCmdExists(t *testing.T) {
 	root := buildRoot()
 	cmd, _, err := root.Find([]string{"init"})
@@ -547,41 +1444,192 @@ func TestAddCmdFile(t *testing.T) {
 	dir := t.TempDir()
 	cfgPath := filepath.Join(dir, "dotular.yaml")
 	os.WriteFile(cfgPath, []byte("modules: []\n"), 0o644)
-
-	// Create a source file.
-	srcFile := filepath.Join(dir, "myfile.txt")
-	os.WriteFile(srcFile, []byte("hello"), 0o644)
+
+	// Create a source file.
+	srcFile := filepath.Join(dir, "myfile.txt")
+	os.WriteFile(srcFile, []byte("hello"), 0o644)
+
+	root := buildRoot()
+	root.SetArgs([]string{"add", "--config", cfgPath, srcFile, "mymod"})
+	if err := root.Execute(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Verify the file was copied into the module store.
+	stored := filepath.Join(dir, "mymod", "myfile.txt")
+	data, err := os.ReadFile(stored)
+	if err != nil {
+		t.Fatalf("stored file not found: %v", err)
+	}
+	if string(data) != "hello" {
+		t.Errorf("stored content = %q", string(data))
+	}
+
+	// Verify the config was updated.
+	cfg, err := loadConfigFrom(cfgPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mod := cfg.Module("mymod")
+	if mod == nil {
+		t.Fatal("module 'mymod' not found in config")
+	}
+	if len(mod.Items) != 1 {
+		t.Fatalf("expected 1 item, got %d", len(mod.Items))
+	}
+	if mod.Items[0].File != "myfile.txt" {
+		t.Errorf("item file = %q", mod.Items[0].File)
+	}
+}
+
+func TestAddCmdStoreLayout(t *testing.T) {
+	for _, tt := range []struct {
+		store, want string
+	}{
+		{"store:\n  dir: files\n", filepath.Join("files", "mymod", "myfile.txt")},
+		{"store:\n  dir: files\n  layout: flat\n", filepath.Join("files", "myfile.txt")},
+	} {
+		dir := t.TempDir()
+		cfgPath := filepath.Join(dir, "dotular.yaml")
+		os.WriteFile(cfgPath, []byte(tt.store+"modules: []\n"), 0o644)
+		srcFile := filepath.Join(t.TempDir(), "myfile.txt")
+		os.WriteFile(srcFile, []byte("hello"), 0o644)
+
+		root := buildRoot()
+		root.SetArgs([]string{"add", "--config", cfgPath, srcFile, "mymod"})
+		if err := root.Execute(); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := os.Stat(filepath.Join(dir, tt.want)); err != nil {
+			t.Errorf("store %q: file not at %s: %v", tt.store, tt.want, err)
+		}
+		cfg, err := loadConfigFrom(cfgPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cfg.Store.Dir != "files" {
+			t.Errorf("store settings lost on save: %+v", cfg.Store)
+		}
+	}
+}
+
+func TestAddCmdInPlace(t *testing.T) {
+	dir := t.TempDir()
+	cfgPath := filepath.Join(dir, "dotular.yaml")
+	os.WriteFile(cfgPath, []byte("modules: []\n"), 0o644)
+	inRepo := filepath.Join(dir, "common", "aliases")
+	os.MkdirAll(filepath.Dir(inRepo), 0o755)
+	os.WriteFile(inRepo, []byte("alias ll=ls"), 0o644)
+
+	root := buildRoot()
+	root.SetArgs([]string{"add", "--config", cfgPath, inRepo, "shell", "--in-place"})
+	if err := root.Execute(); err == nil {
+		t.Error("expected error without --destination")
+	}
+
+	root = buildRoot()
+	root.SetArgs([]string{"add", "--config", cfgPath, inRepo, "shell", "--in-place", "--destination", "~/.config/shell"})
+	if err := root.Execute(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "shell")); !os.IsNotExist(err) {
+		t.Error("--in-place must not copy into the module store")
+	}
+	cfg, err := loadConfigFrom(cfgPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	item := cfg.Module("shell").Items[0]
+	if item.File != "../common/aliases" {
+		t.Errorf("item file = %q, want ../common/aliases", item.File)
+	}
+	if got := item.Destination.ForOS(runtime.GOOS); got != "~/.config/shell" {
+		t.Errorf("destination = %q", got)
+	}
+
+	outside := filepath.Join(t.TempDir(), "x")
+	os.WriteFile(outside, []byte("x"), 0o644)
+	root = buildRoot()
+	root.SetArgs([]string{"add", "--config", cfgPath, outside, "shell", "--in-place", "--destination", "~"})
+	if err := root.Execute(); err == nil {
+		t.Error("expected error for a path outside the repo")
+	}
+}
+
+func TestAddCmdEncrypt(t *testing.T) {
+	t.Setenv("DOTULAR_AGE_IDENTITY", "")
+	t.Setenv("DOTULAR_AGE_PASSPHRASE", "")
+	dir := t.TempDir()
+	cfgPath := filepath.Join(dir, "dotular.yaml")
+	os.WriteFile(cfgPath, []byte("modules: []\n"), 0o644)
+	secret := filepath.Join(t.TempDir(), "token")
+	os.WriteFile(secret, []byte("s3cret"), 0o600)
 
 	root := buildRoot()
-	root.SetArgs([]string{"add", "--config", cfgPath, srcFile, "mymod"})
+	root.SetArgs([]string{"add", "--config", cfgPath, secret, "secrets", "--encrypt"})
+	if err := root.Execute(); err == nil {
+		t.Fatal("expected error without an age key")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "secrets")); !os.IsNotExist(err) {
+		t.Error("nothing should be stored without a key")
+	}
+
+	os.WriteFile(cfgPath, []byte("age:\n  passphrase: test-pass\nmodules: []\n"), 0o644)
+	root = buildRoot()
+	root.SetArgs([]string{"add", "--config", cfgPath, secret, "secrets", "--encrypt"})
 	if err := root.Execute(); err != nil {
 		t.Fatal(err)
 	}
-
-	// Verify the file was copied into the module store.
-	stored := filepath.Join(dir, "mymod", "myfile.txt")
-	data, err := os.ReadFile(stored)
+	if _, err := os.Stat(filepath.Join(dir, "secrets", "token")); !os.IsNotExist(err) {
+		t.Error("plaintext copy must not be stored")
+	}
+	stored, err := os.ReadFile(filepath.Join(dir, "secrets", "token.age"))
 	if err != nil {
-		t.Fatalf("stored file not found: %v", err)
+		t.Fatal(err)
 	}
-	if string(data) != "hello" {
-		t.Errorf("stored content = %q", string(data))
+	if bytes.Contains(stored, []byte("s3cret")) {
+		t.Error("stored file is not encrypted")
 	}
-
-	// Verify the config was updated.
 	cfg, err := loadConfigFrom(cfgPath)
 	if err != nil {
 		t.Fatal(err)
 	}
-	mod := cfg.Module("mymod")
-	if mod == nil {
-		t.Fatal("module 'mymod' not found in config")
+	if item := cfg.Module("secrets").Items[0]; item.File != "token" || !item.Encrypted {
+		t.Errorf("item = %+v", item)
 	}
-	if len(mod.Items) != 1 {
-		t.Fatalf("expected 1 item, got %d", len(mod.Items))
+}
+
+func TestPortableDestination(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses Unix paths")
 	}
-	if mod.Items[0].File != "myfile.txt" {
-		t.Errorf("item file = %q", mod.Items[0].File)
+	env := map[string]string{
+		"HOME":            "/home/me",
+		"USERPROFILE":     "/users/me",
+		"XDG_CONFIG_HOME": "/home/me/.config",
+		"APPDATA":         "/users/me/AppData/Roaming",
+	}
+	getenv := func(k string) string { return env[k] }
+	tests := []struct {
+		dir, goos string
+		want      config.PlatformMap
+	}{
+		{"/home/me/Library/Application Support/Code/User", "darwin", config.PlatformMap{
+			MacOS: "~/Library/Application Support/Code/User", Linux: "$XDG_CONFIG_HOME/Code/User", Windows: "%APPDATA%/Code/User"}},
+		{"/home/me/.config/nvim", "linux", config.PlatformMap{
+			MacOS: "$XDG_CONFIG_HOME/nvim", Linux: "$XDG_CONFIG_HOME/nvim", Windows: "%APPDATA%/nvim"}},
+		{"/home/me/.config", "darwin", config.PlatformMap{
+			MacOS: "$XDG_CONFIG_HOME", Linux: "$XDG_CONFIG_HOME", Windows: "%APPDATA%"}},
+		{"/users/me/AppData/Roaming/Code/User", "windows", config.PlatformMap{
+			MacOS: "~/Library/Application Support/Code/User", Linux: "$XDG_CONFIG_HOME/Code/User", Windows: "%APPDATA%/Code/User"}},
+		{"/home/me", "linux", config.PlatformMap{MacOS: "~", Linux: "~", Windows: "~"}},
+		{"/home/me/.ssh", "darwin", config.PlatformMap{MacOS: "~/.ssh", Linux: "~/.ssh", Windows: "~/.ssh"}},
+		{"/etc/nginx", "linux", config.PlatformMap{Linux: "/etc/nginx"}},
+	}
+	for _, tt := range tests {
+		if got := portableDestination(tt.dir, tt.goos, getenv); got != tt.want {
+			t.Errorf("portableDestination(%q, %s) = %+v, want %+v", tt.dir, tt.goos, got, tt.want)
+		}
 	}
 }
 
@@ -762,10 +1810,14 @@ func TestCopyDirRecursive(t *testing.T) {
 	os.MkdirAll(filepath.Join(src, "sub"), 0o755)
 	os.WriteFile(filepath.Join(src, "a.txt"), []byte("aaa"), 0o644)
 	os.WriteFile(filepath.Join(src, "sub", "b.txt"), []byte("bbb"), 0o644)
+	hasLink := os.Symlink("../a.txt", filepath.Join(src, "sub", "link")) == nil
 
 	if err := copyDirRecursive(src, dst); err != nil {
 		t.Fatal(err)
 	}
+	if link, err := os.Readlink(filepath.Join(dst, "sub", "link")); hasLink && link != "../a.txt" {
+		t.Errorf("sub/link -> %q, %v; want the symlink copied", link, err)
+	}
 
 	data, err := os.ReadFile(filepath.Join(dst, "a.txt"))
 	if err != nil {
@@ -788,3 +1840,485 @@ func TestCopyDirRecursive(t *testing.T) {
 func loadConfigFrom(path string) (config.Config, error) {
 	return config.Load(path)
 }
+
+func TestAdoptCmdFile(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	dir := t.TempDir()
+	cfgPath := filepath.Join(dir, "dotular.yaml")
+	os.WriteFile(cfgPath, []byte("modules: []\n"), 0o644)
+
+	target := filepath.Join(t.TempDir(), ".zshrc")
+	os.WriteFile(target, []byte("export A=1"), 0o644)
+
+	root := buildRoot()
+	root.SetArgs([]string{"adopt", "--config", cfgPath, "shell", target})
+	if err := root.Execute(); err != nil {
+		t.Fatal(err)
+	}
+
+	stored := filepath.Join(dir, "shell", ".zshrc")
+	if data, err := os.ReadFile(stored); err != nil || string(data) != "export A=1" {
+		t.Fatalf("stored file = %q, %v", data, err)
+	}
+	if link, err := os.Readlink(target); err != nil || link != stored {
+		t.Errorf("original should link to store, got %q, %v", link, err)
+	}
+
+	cfg, err := loadConfigFrom(cfgPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mod := cfg.Module("shell")
+	if mod == nil || len(mod.Items) != 1 {
+		t.Fatalf("expected module with 1 item, got %+v", mod)
+	}
+	if mod.Items[0].File != ".zshrc" || !mod.Items[0].Link {
+		t.Errorf("item = %+v", mod.Items[0])
+	}
+
+	statePath, _ := state.DefaultPath()
+	st, err := state.Load(statePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, ok := st.Resources["symlink:"+target]
+	if !ok || res.Source != stored || res.Module != "shell" || res.Config != cfgPath {
+		t.Errorf("state resources = %+v", st.Resources)
+	}
+}
+
+func TestAdoptCmdExternalSymlink(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	dir := t.TempDir()
+	cfgPath := filepath.Join(dir, "dotular.yaml")
+	os.WriteFile(cfgPath, []byte("modules: []\n"), 0o644)
+
+	// Simulate a stow-managed directory.
+	stow := filepath.Join(t.TempDir(), "stow", "nvim")
+	os.MkdirAll(stow, 0o755)
+	os.WriteFile(filepath.Join(stow, "init.lua"), []byte("-- nvim"), 0o644)
+	target := filepath.Join(t.TempDir(), "nvim")
+	os.Symlink(stow, target)
+
+	root := buildRoot()
+	root.SetArgs([]string{"adopt", "--config", cfgPath, "nvim", target})
+	if err := root.Execute(); err != nil {
+		t.Fatal(err)
+	}
+
+	stored := filepath.Join(dir, "nvim", "nvim")
+	if _, err := os.Stat(filepath.Join(stored, "init.lua")); err != nil {
+		t.Fatalf("directory not moved into store: %v", err)
+	}
+	if _, err := os.Stat(stow); !os.IsNotExist(err) {
+		t.Error("original stow directory should have been moved")
+	}
+	if link, _ := os.Readlink(target); link != stored {
+		t.Errorf("symlink should now point to store, got %q", link)
+	}
+
+	cfg, _ := loadConfigFrom(cfgPath)
+	if item := cfg.Module("nvim").Items[0]; item.Directory != "nvim" || !item.Link {
+		t.Errorf("item = %+v", item)
+	}
+}
+
+func TestAdoptCmdAlreadyLinked(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	dir := t.TempDir()
+	cfgPath := filepath.Join(dir, "dotular.yaml")
+	os.WriteFile(cfgPath, []byte("modules: []\n"), 0o644)
+
+	stored := filepath.Join(dir, "git", ".gitconfig")
+	os.MkdirAll(filepath.Dir(stored), 0o755)
+	os.WriteFile(stored, []byte("[user]"), 0o644)
+	target := filepath.Join(t.TempDir(), ".gitconfig")
+	os.Symlink(stored, target)
+
+	root := buildRoot()
+	root.SetArgs([]string{"adopt", "--config", cfgPath, "git", target})
+	if err := root.Execute(); err != nil {
+		t.Fatal(err)
+	}
+
+	if data, _ := os.ReadFile(stored); string(data) != "[user]" {
+		t.Errorf("store content changed: %q", data)
+	}
+	if link, _ := os.Readlink(target); link != stored {
+		t.Errorf("symlink changed: %q", link)
+	}
+	cfg, _ := loadConfigFrom(cfgPath)
+	if mod := cfg.Module("git"); mod == nil || len(mod.Items) != 1 || mod.Items[0].File != ".gitconfig" {
+		t.Errorf("module = %+v", mod)
+	}
+}
+
+func TestAdoptCmdCopy(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	dir := t.TempDir()
+	cfgPath := filepath.Join(dir, "dotular.yaml")
+	os.WriteFile(cfgPath, []byte("modules: []\n"), 0o644)
+
+	target := filepath.Join(t.TempDir(), ".vimrc")
+	os.WriteFile(target, []byte("set nu"), 0o644)
+
+	root := buildRoot()
+	root.SetArgs([]string{"adopt", "--config", cfgPath, "--copy", "vim", target})
+	if err := root.Execute(); err != nil {
+		t.Fatal(err)
+	}
+
+	if info, err := os.Lstat(target); err != nil || info.Mode()&os.ModeSymlink != 0 {
+		t.Error("--copy should leave the original file in place")
+	}
+	if data, _ := os.ReadFile(filepath.Join(dir, "vim", ".vimrc")); string(data) != "set nu" {
+		t.Errorf("stored content = %q", data)
+	}
+	cfg, _ := loadConfigFrom(cfgPath)
+	if item := cfg.Module("vim").Items[0]; item.Link {
+		t.Errorf("--copy should record a copy item, got %+v", item)
+	}
+}
+
+func TestAdoptCmdStoreConflict(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	dir := t.TempDir()
+	cfgPath := filepath.Join(dir, "dotular.yaml")
+	os.WriteFile(cfgPath, []byte("modules: []\n"), 0o644)
+	os.MkdirAll(filepath.Join(dir, "vim"), 0o755)
+	os.WriteFile(filepath.Join(dir, "vim", ".vimrc"), []byte("old"), 0o644)
+
+	target := filepath.Join(t.TempDir(), ".vimrc")
+	os.WriteFile(target, []byte("new"), 0o644)
+
+	root := buildRoot()
+	root.SetArgs([]string{"adopt", "--config", cfgPath, "vim", target})
+	if err := root.Execute(); err == nil {
+		t.Fatal("expected error when the store already has the file")
+	}
+	if data, _ := os.ReadFile(target); string(data) != "new" {
+		t.Error("original should be untouched on conflict")
+	}
+}
+
+// fakeEditor installs an $EDITOR script that appends line to every file it
+// is given.
+func fakeEditor(t *testing.T, line string) {
+	t.Helper()
+	script := filepath.Join(t.TempDir(), "editor.sh")
+	body := "#!/bin/sh\nfor f in \"$@\"; do printf '%s\\n' '" + line + "' >> \"$f\"; done\n"
+	if err := os.WriteFile(script, []byte(body), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("VISUAL", "")
+	t.Setenv("EDITOR", script)
+}
+
+func TestEditCmdConfig(t *testing.T) {
+	fakeEditor(t, "# edited")
+	path := writeTestConfig(t, "modules:\n  - name: test\n    items:\n      - run: \"true\"\n")
+
+	var out bytes.Buffer
+	root := buildRoot()
+	root.SetOut(&out)
+	root.SetArgs([]string{"edit", "--config", path})
+	if err := root.Execute(); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := os.ReadFile(path)
+	if !strings.HasSuffix(string(data), "# edited\n") {
+		t.Errorf("config not edited: %q", data)
+	}
+}
+
+func TestEditCmdInvalidConfig(t *testing.T) {
+	fakeEditor(t, "  - items: [{via: brew}]")
+	path := writeTestConfig(t, "modules:\n  - name: test\n    items:\n      - run: \"true\"\n")
+
+	root := buildRoot()
+	root.SetArgs([]string{"edit", "--config", path})
+	if err := root.Execute(); err == nil {
+		t.Fatal("expected validation error")
+	}
+}
+
+func TestEditCmdModuleFile(t *testing.T) {
+	fakeEditor(t, "alias ll=ls")
+	path := writeTestConfig(t, `
+modules:
+  - name: shell
+    items:
+      - file: .zshrc
+        destination: ~/
+      - file: .bashrc
+        destination: ~/
+      - package: zsh
+`)
+	storeDir := filepath.Join(filepath.Dir(path), "shell")
+	os.MkdirAll(storeDir, 0o755)
+	os.WriteFile(filepath.Join(storeDir, ".zshrc"), []byte("export A=1\n"), 0o644)
+	os.WriteFile(filepath.Join(storeDir, ".bashrc"), []byte("export B=1\n"), 0o644)
+
+	root := buildRoot()
+	root.SetArgs([]string{"edit", "--config", path, "shell", ".zshrc"})
+	if err := root.Execute(); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(filepath.Join(storeDir, ".zshrc")); !strings.Contains(string(data), "alias ll") {
+		t.Errorf(".zshrc not edited: %q", data)
+	}
+	if data, _ := os.ReadFile(filepath.Join(storeDir, ".bashrc")); strings.Contains(string(data), "alias ll") {
+		t.Error(".bashrc should not be opened when an item is named")
+	}
+}
+
+func TestEditableItems(t *testing.T) {
+	cfg := config.Config{Modules: []config.Module{
+		{Name: "shell", Items: []config.Item{{File: ".zshrc"}, {Directory: "zsh.d"}, {Package: "zsh"}}},
+		{Name: "tools", Items: []config.Item{{Package: "jq"}}},
+		{Name: "nvim", From: "github.com/atomikpanda/dotular/modules/neovim"},
+	}}
+
+	items, err := editableItems(cfg, "shell", "")
+	if err != nil || len(items) != 2 {
+		t.Errorf("shell items = %v, %v", items, err)
+	}
+	items, err = editableItems(cfg, "shell", "zsh.d")
+	if err != nil || len(items) != 1 || items[0].Directory != "zsh.d" {
+		t.Errorf("zsh.d items = %v, %v", items, err)
+	}
+	for _, tc := range [][2]string{{"missing", ""}, {"tools", ""}, {"nvim", ""}, {"shell", ".bashrc"}} {
+		if _, err := editableItems(cfg, tc[0], tc[1]); err == nil {
+			t.Errorf("editableItems(%q, %q) should fail", tc[0], tc[1])
+		}
+	}
+}
+
+func TestEditorCommand(t *testing.T) {
+	t.Setenv("VISUAL", "")
+	t.Setenv("EDITOR", "nano")
+	if got := editorCommand(); got != "nano" {
+		t.Errorf("editorCommand() = %q", got)
+	}
+	t.Setenv("VISUAL", "code --wait")
+	if got := editorCommand(); got != "code --wait" {
+		t.Errorf("VISUAL should win, got %q", got)
+	}
+}
+
+func TestPrintDrift(t *testing.T) {
+	var out bytes.Buffer
+	u := ui.New(&out, &bytes.Buffer{})
+	printDrift(u, []runner.DriftResult{
+		{Module: "shell", Target: "/home/u/.zshrc", Status: runner.DriftSystem},
+		{Module: "shell", Target: "/home/u/.bashrc", Status: runner.DriftInSync},
+		{Module: "git", Target: "/home/u/.gitconfig", Status: runner.DriftRepo},
+	})
+	got := out.String()
+	if !strings.Contains(got, ".zshrc") || !strings.Contains(got, "drifted") || !strings.Contains(got, "repo changed") {
+		t.Errorf("missing drift rows:\n%s", got)
+	}
+	if strings.Contains(got, ".bashrc") {
+		t.Errorf("in-sync files should not be listed:\n%s", got)
+	}
+	if !strings.Contains(got, "dotular pull") {
+		t.Errorf("expected a push/pull hint:\n%s", got)
+	}
+
+	out.Reset()
+	printDrift(u, []runner.DriftResult{{Module: "shell", Target: "/x", Status: runner.DriftInSync}})
+	if out.Len() != 0 {
+		t.Errorf("nothing should print when all files are in sync, got %q", out.String())
+	}
+}
+
+func TestTypeFilterFlags(t *testing.T) {
+	defer func() { onlyTypes, skipTypes = nil, nil }()
+	path := writeTestConfig(t, `
+modules:
+  - name: test
+    items:
+      - run: "true"
+`)
+	root := buildRoot()
+	root.SetArgs([]string{"apply", "--dry-run", "--config", path, "--only", "files,packages", "--skip", "run"})
+	if err := root.Execute(); err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(onlyTypes, []string{"file", "package"}) || !slices.Equal(skipTypes, []string{"run"}) {
+		t.Errorf("only = %v, skip = %v", onlyTypes, skipTypes)
+	}
+	if r := newRunner(config.Config{}); !slices.Equal(r.OnlyTypes, onlyTypes) {
+		t.Errorf("runner OnlyTypes = %v", r.OnlyTypes)
+	}
+
+	root = buildRoot()
+	root.SetArgs([]string{"apply", "--config", path, "--only", "services"})
+	if err := root.Execute(); err == nil {
+		t.Error("expected error for unknown item type")
+	}
+}
+
+func TestInSync(t *testing.T) {
+	clean := []runner.DriftResult{{Module: "git", Target: "~/.gitconfig", Status: runner.DriftInSync}}
+	if !inSync(runner.ModuleResult{Skipped: 3}, clean) {
+		t.Error("expected in sync")
+	}
+	if inSync(runner.ModuleResult{Applied: 1}, clean) {
+		t.Error("pending items should be out of sync")
+	}
+	if inSync(runner.ModuleResult{}, []runner.DriftResult{{Status: runner.DriftSystem}}) {
+		t.Error("drifted files should be out of sync")
+	}
+}
+
+func TestStatusCmdExitCodeFlag(t *testing.T) {
+	if statusCmd().Flags().Lookup("exit-code") == nil {
+		t.Error("status has no --exit-code flag")
+	}
+}
+
+func TestRemedy(t *testing.T) {
+	tests := []struct {
+		err  error
+		want string
+	}{
+		{fmt.Errorf("%w: %q", errs.ErrModuleNotFound, "nvim"), "dotular list"},
+		{fmt.Errorf("module %q: %w", "x", errs.ErrConflict), "dotular sync"},
+		{fmt.Errorf("script: %w", &errs.ChecksumError{Subject: "s", Want: "a", Got: "b"}), "--no-cache"},
+		{fmt.Errorf("module %q: %w", "x", errs.ErrNeedsElevation), "re-run dotular"},
+		{fmt.Errorf("module %q: %w (%w)", "x", errs.ErrAborted, context.Canceled), "rolled back"},
+		{&runlock.HeldError{Path: "x.lock", Holder: runlock.Info{PID: 1}}, "--wait"},
+		{fmt.Errorf("%s: %w", "github.com/a/b", errs.ErrNotAccepted), "--accept"},
+		{errors.New("boom"), ""},
+	}
+	for _, tt := range tests {
+		if got := remedy(tt.err); !strings.Contains(got, tt.want) || (tt.want == "" && got != "") {
+			t.Errorf("remedy(%v) = %q, want it to mention %q", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestColorFlagAndConfig(t *testing.T) {
+	defer func() { colorMode, color.Enabled = "", false }()
+	path := writeTestConfig(t, `
+color: always
+modules:
+  - name: test
+    items:
+      - run: "true"
+`)
+	root := buildRoot()
+	root.SetArgs([]string{"apply", "--dry-run", "--config", path})
+	if err := root.Execute(); err != nil {
+		t.Fatal(err)
+	}
+	if !color.Enabled {
+		t.Error("color: always in the config should enable color")
+	}
+
+	root = buildRoot()
+	root.SetArgs([]string{"apply", "--dry-run", "--config", path, "--color", "never"})
+	if err := root.Execute(); err != nil {
+		t.Fatal(err)
+	}
+	if color.Enabled {
+		t.Error("--color never should override the config")
+	}
+
+	colorMode = ""
+	root = buildRoot()
+	root.SetArgs([]string{"apply", "--config", path, "--color", "sometimes"})
+	if err := root.Execute(); err == nil {
+		t.Error("expected error for unknown color mode")
+	}
+}
+
+func TestPrintSummary(t *testing.T) {
+	var out bytes.Buffer
+	u := ui.New(&out, &bytes.Buffer{})
+	applied := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	printSummary(u, []runner.ModuleSummary{
+		{Module: "shell", InSync: 3, Modified: 1, Missing: 2, LastApplied: applied},
+		{Module: "work", Skipped: true},
+	})
+	got := out.String()
+	for _, want := range []string{"MODULE", "LAST APPLIED", "shell", applied.Local().Format(time.DateTime), "skipped (tags)"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("summary missing %q:\n%s", want, got)
+		}
+	}
+}
+
+func TestPrintMachines(t *testing.T) {
+	var out bytes.Buffer
+	u := ui.New(&out, &bytes.Buffer{})
+	at := time.Date(2026, 5, 1, 9, 0, 0, 0, time.UTC)
+	printMachines(u, []machineStatus{
+		{Machine: machines.Machine{Hostname: "laptop", OS: "darwin", Arch: "arm64", Tags: []string{"work"}, LastApply: at}, Current: true},
+		{Machine: machines.Machine{Hostname: "desktop", OS: "linux", Arch: "amd64", Version: "1.2.0", LastApply: at}, Behind: []string{"shell", "git"}},
+	})
+	got := out.String()
+	for _, want := range []string{"MACHINE", "laptop *", "darwin/arm64", "up to date", "1.2.0", "behind: shell, git", at.Local().Format(time.DateTime)} {
+		if !strings.Contains(got, want) {
+			t.Errorf("machines output missing %q:\n%s", want, got)
+		}
+	}
+
+	out.Reset()
+	printMachines(u, nil)
+	if !strings.Contains(out.String(), "machines.register") {
+		t.Errorf("empty inventory should explain how to register:\n%s", out.String())
+	}
+}
+
+func TestStatusSummaryExecute(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	path := writeTestConfig(t, `
+modules:
+  - name: test
+    items:
+      - run: echo hello
+`)
+	root := buildRoot()
+	root.SetArgs([]string{"status", "--summary", "--config", path})
+	if err := root.Execute(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCommitCaptured(t *testing.T) {
+	root := t.TempDir()
+	git := func(args ...string) string {
+		out, err := exec.Command("git", append([]string{"-C", root}, args...)...).CombinedOutput()
+		if err != nil {
+			t.Fatalf("git %v: %v: %s", args, err, out)
+		}
+		return strings.TrimSpace(string(out))
+	}
+	git("init", "--quiet")
+	git("config", "user.email", "test@example.com")
+	git("config", "user.name", "test")
+	os.MkdirAll(filepath.Join(root, "shell"), 0o755)
+	src := filepath.Join(root, "shell", ".zshrc")
+	os.WriteFile(src, []byte("saved"), 0o644)
+	os.WriteFile(filepath.Join(root, "unrelated"), []byte("x"), 0o644)
+	git("add", "unrelated")
+
+	res := &runner.CaptureResult{Module: "shell", Source: src}
+	if err := commitCaptured(root, res); err != nil {
+		t.Fatal(err)
+	}
+	if got := git("log", "-1", "--format=%s"); got != "shell: update shell/.zshrc" {
+		t.Errorf("commit subject = %q", got)
+	}
+	if got := git("show", "--name-only", "--format=", "HEAD"); got != "shell/.zshrc" {
+		t.Errorf("committed files = %q, want only the captured file", got)
+	}
+	if err := commitCaptured(root, res); err != nil {
+		t.Errorf("unchanged file: %v", err)
+	}
+	if got := git("rev-list", "--count", "HEAD"); got != "1" {
+		t.Errorf("commits = %s, want no empty commit for an unchanged file", got)
+	}
+}
@@ -1,3 +1,19 @@
+// Package actions implements the item types. Each builds an Action that
+// describes and runs one step; optional interfaces add idempotency checks
+// (Idempotent), current/desired state for plan (Stater), dry-run previews
+// (Previewer), and process restarts (Restarter).
+//
+// Actions never print. They report leveled Events with report and
+// reportDryRun to the Reporter on the context, which the runner points at
+// the terminal or the spinner.
+//
+// Writes to destinations go through replaceFile, which writes a temporary
+// file beside the destination, syncs it, and renames it over the target
+// (the link's target, for a symlinked destination). Modes go through
+// setMode and modeState, which chmod on Unix and map to the read-only
+// attribute and an owner-only ACL on Windows. copyDir recreates symlinks
+// unless dereference is set, and skips files larger than the item's
+// max_file_size, as snapshots and drift hashes do.
 package actions
 
 import (
@@ -26,6 +42,19 @@ type Action interface {
 //     package is already installed. Guaranteed to be side-effect free.
 //   - FileAction (link): checks that the symlink at the destination already
 //     exists and resolves to the correct absolute source path.
+//   - DockAction, LoginItemAction: read the Dock's persistent apps or the
+//     user's login items.
+//   - RepoAction: lists the package manager's configured sources.
+//   - ContainerAction: inspects the image or container, or lists the
+//     running compose services.
+//   - ExtensionAction, DefaultAppAction: query the editor's installed
+//     extensions or the current default handlers.
+//   - ShellPluginAction: checks the plugin clone's commit, the antidote
+//     plugins file, or `fisher list`.
+//   - GpgKeyAction: looks the fingerprint up in the keyring and compares
+//     the owner trust.
+//   - SSHHostAction: compares its Host block and pinned keys with
+//     ~/.ssh/config and known_hosts.
 //   - FileAction (push/pull/sync), ScriptAction, SettingAction: do not
 //     implement Idempotent; use skip_if for custom idempotency guards.
 type Idempotent interface {
@@ -33,3 +62,36 @@ type Idempotent interface {
 	// place and the action can safely be skipped.
 	IsApplied(ctx context.Context) (bool, error)
 }
+
+// Stater is optionally implemented by actions that can describe the state
+// they would change, for plan output and debug logs. Current is what is on
+// the system now and desired is what Run would leave behind, both short
+// phrases such as "missing" and "symlink -> /repo/nvim". State must not
+// change anything and is only asked of actions that are about to run.
+//
+// State per action type:
+//   - FileAction, DirectoryAction: the destination's kind against a copy or
+//     symlink of the repo path.
+//   - BinaryAction: the installed path against the version and URL.
+//   - SettingAction: the value read with `defaults read` on macOS against
+//     the configured value.
+type Stater interface {
+	State(ctx context.Context) (current, desired string)
+}
+
+// Previewer is optionally implemented by actions that can tell, in a dry
+// run, whether Run would change their destination. The runner prints the
+// change kind next to the dry-run line, and the diff when asked to.
+// FileAction implements it for pushes.
+type Previewer interface {
+	Preview(ctx context.Context) (Change, error)
+}
+
+// Restarter is optionally implemented by actions whose changes only take
+// effect once a running process reloads its preferences, such as the macOS
+// Dock or Finder. After a module's items have run, the runner restarts each
+// process named by its applied actions once.
+type Restarter interface {
+	// Restarts returns the names of the processes to restart.
+	Restarts() []string
+}
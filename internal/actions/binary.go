@@ -7,12 +7,10 @@ import (
 	"context"
 	"fmt"
 	"io"
-	"net/http"
 	"os"
 	"path/filepath"
 	"strings"
 
-	"github.com/atomikpanda/dotular/internal/color"
 	"github.com/atomikpanda/dotular/internal/platform"
 )
 
@@ -38,9 +36,14 @@ func (a *BinaryAction) Describe() string {
 	return fmt.Sprintf("install binary %s%s -> %s", a.Name, v, dest)
 }
 
+// InstalledPath returns the fully expanded path the binary is installed to.
+func (a *BinaryAction) InstalledPath() string {
+	return filepath.Join(platform.ExpandPath(a.InstallTo), a.Name)
+}
+
 func (a *BinaryAction) Run(ctx context.Context, dryRun bool) error {
 	if dryRun {
-		fmt.Printf("    %s\n", color.Dim("[dry-run] "+a.Describe()))
+		reportDryRun(ctx, "%s", a.Describe())
 		return nil
 	}
 
@@ -49,19 +52,10 @@ func (a *BinaryAction) Run(ctx context.Context, dryRun bool) error {
 		return fmt.Errorf("create install dir: %w", err)
 	}
 
-	// Download to a temp file.
-	tmpFile, err := os.CreateTemp("", "dotular-bin-*")
+	archive, err := fetch(ctx, a.SourceURL)
 	if err != nil {
-		return fmt.Errorf("create temp file: %w", err)
-	}
-	tmpPath := tmpFile.Name()
-	defer os.Remove(tmpPath)
-
-	if err := downloadTo(ctx, a.SourceURL, tmpFile); err != nil {
-		tmpFile.Close()
 		return fmt.Errorf("download %s: %w", a.SourceURL, err)
 	}
-	tmpFile.Close()
 
 	destPath := filepath.Join(destDir, a.Name)
 
@@ -69,47 +63,26 @@ func (a *BinaryAction) Run(ctx context.Context, dryRun bool) error {
 	lower := strings.ToLower(a.SourceURL)
 	switch {
 	case strings.HasSuffix(lower, ".tar.gz") || strings.HasSuffix(lower, ".tgz"):
-		if err := extractFromTarGz(tmpPath, a.Name, destPath); err != nil {
+		if err := extractFromTarGz(archive, a.Name, destPath); err != nil {
 			return fmt.Errorf("extract %s from archive: %w", a.Name, err)
 		}
 	case strings.HasSuffix(lower, ".zip"):
-		if err := extractFromZip(tmpPath, a.Name, destPath); err != nil {
+		if err := extractFromZip(archive, a.Name, destPath); err != nil {
 			return fmt.Errorf("extract %s from zip: %w", a.Name, err)
 		}
 	default:
-		// Treat as a plain binary.
-		if err := os.Rename(tmpPath, destPath); err != nil {
-			if err := copyFilePath(tmpPath, destPath); err != nil {
-				return fmt.Errorf("install binary: %w", err)
-			}
+		// Treat as a plain binary. The cached download stays in place, so
+		// copy it beside the destination and rename it over a running one.
+		if err := replaceFile(destPath, 0o755, func(tmp string) error {
+			return copyFilePath(archive, tmp)
+		}); err != nil {
+			return fmt.Errorf("install binary: %w", err)
 		}
 	}
 
 	return os.Chmod(destPath, 0o755)
 }
 
-// --- download ----------------------------------------------------------------
-
-func downloadTo(ctx context.Context, url string, dst *os.File) error {
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
-	if err != nil {
-		return err
-	}
-	req.Header.Set("User-Agent", "dotular/1")
-
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
-		return err
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("HTTP %d", resp.StatusCode)
-	}
-	_, err = io.Copy(dst, resp.Body)
-	return err
-}
-
 // --- extraction --------------------------------------------------------------
 
 func extractFromTarGz(archivePath, binaryName, destPath string) error {
@@ -165,14 +138,20 @@ func extractFromZip(archivePath, binaryName, destPath string) error {
 	return fmt.Errorf("binary %q not found in zip", binaryName)
 }
 
+// writeBinary writes r to destPath with replaceFile, so a failed extraction
+// never leaves a half-written binary in place.
 func writeBinary(r io.Reader, destPath string) error {
-	out, err := os.Create(destPath)
-	if err != nil {
-		return err
-	}
-	defer out.Close()
-	_, err = io.Copy(out, r)
-	return err
+	return replaceFile(destPath, 0o755, func(tmp string) error {
+		out, err := os.Create(tmp)
+		if err != nil {
+			return err
+		}
+		defer out.Close()
+		if _, err := io.Copy(out, r); err != nil {
+			return err
+		}
+		return out.Close()
+	})
 }
 
 func copyFilePath(src, dst string) error {
@@ -186,6 +165,8 @@ func copyFilePath(src, dst string) error {
 		return err
 	}
 	defer out.Close()
-	_, err = io.Copy(out, in)
-	return err
+	if _, err := io.Copy(out, in); err != nil {
+		return err
+	}
+	return out.Close()
 }
@@ -0,0 +1,161 @@
+package actions
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// ContainerAction keeps a container workload up with docker or podman. It
+// has three forms:
+//
+//   - Image set: the container Name runs from Image with the given ports,
+//     volumes, and environment, and is restarted unless stopped by hand.
+//   - Compose set: the compose file is brought up as project Name.
+//   - Neither: Name is an image that is pulled.
+//
+// Idempotency: ContainerAction implements Idempotent by inspecting the image
+// or container, or by comparing the compose file's services with the
+// running ones.
+type ContainerAction struct {
+	Name    string
+	Image   string
+	Compose string // absolute path of the compose file
+	Ports   []string
+	Volumes []string
+	Env     map[string]string
+	Engine  string // docker | podman; empty picks whichever is installed
+}
+
+func (a *ContainerAction) Describe() string {
+	switch {
+	case a.Compose != "":
+		return fmt.Sprintf("compose up %s (%s)", a.Name, a.Compose)
+	case a.Image != "":
+		return fmt.Sprintf("run container %s from %s", a.Name, a.Image)
+	default:
+		return "pull image " + a.Name
+	}
+}
+
+// engine returns the container CLI to use.
+func (a *ContainerAction) engine() string {
+	if a.Engine != "" {
+		return a.Engine
+	}
+	if _, err := exec.LookPath("docker"); err != nil {
+		if _, err := exec.LookPath("podman"); err == nil {
+			return "podman"
+		}
+	}
+	return "docker"
+}
+
+func (a *ContainerAction) Run(ctx context.Context, dryRun bool) error {
+	var args []string
+	switch {
+	case a.Compose != "":
+		args = []string{"compose", "-f", a.Compose, "-p", a.Name, "up", "-d"}
+	case a.Image != "":
+		running, image, exists := a.inspect(ctx)
+		switch {
+		case exists && image == a.Image && running:
+			return nil
+		case exists && image == a.Image:
+			args = []string{"start", a.Name}
+		default:
+			if exists {
+				// The container runs another image: replace it.
+				if err := a.run(ctx, dryRun, "rm", "-f", a.Name); err != nil {
+					return err
+				}
+			}
+			args = a.runArgs()
+		}
+	default:
+		args = []string{"pull", a.Name}
+	}
+	return a.run(ctx, dryRun, args...)
+}
+
+func (a *ContainerAction) run(ctx context.Context, dryRun bool, args ...string) error {
+	engine := a.engine()
+	if dryRun {
+		reportDryRun(ctx, "%s %s", engine, strings.Join(args, " "))
+		return nil
+	}
+	if err := command(ctx, engine, args...).Run(); err != nil {
+		return fmt.Errorf("%s %s: %w", engine, args[0], err)
+	}
+	return nil
+}
+
+// runArgs returns the arguments creating and starting the container.
+func (a *ContainerAction) runArgs() []string {
+	args := []string{"run", "-d", "--name", a.Name, "--restart", "unless-stopped"}
+	for _, p := range a.Ports {
+		args = append(args, "-p", p)
+	}
+	for _, v := range a.Volumes {
+		args = append(args, "-v", v)
+	}
+	keys := make([]string, 0, len(a.Env))
+	for k := range a.Env {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		args = append(args, "-e", k+"="+a.Env[k])
+	}
+	return append(args, a.Image)
+}
+
+// inspect reports whether the container exists, whether it is running, and
+// the image it was created from.
+func (a *ContainerAction) inspect(ctx context.Context) (running bool, image string, exists bool) {
+	out, err := quietOutput(ctx, a.engine(), "container", "inspect", "-f", "{{.State.Running}} {{.Config.Image}}", a.Name)
+	if err != nil {
+		return false, "", false
+	}
+	state, image, _ := strings.Cut(strings.TrimSpace(out), " ")
+	return state == "true", image, true
+}
+
+// IsApplied reports whether the image is present, the container runs the
+// configured image, or every compose service is running.
+func (a *ContainerAction) IsApplied(ctx context.Context) (bool, error) {
+	engine := a.engine()
+	switch {
+	case a.Compose != "":
+		want, err := quietOutput(ctx, engine, "compose", "-f", a.Compose, "-p", a.Name, "config", "--services")
+		if err != nil {
+			return false, nil
+		}
+		got, err := quietOutput(ctx, engine, "compose", "-f", a.Compose, "-p", a.Name, "ps", "--services", "--status", "running")
+		if err != nil {
+			return false, nil
+		}
+		return sameLines(want, got), nil
+	case a.Image != "":
+		running, image, exists := a.inspect(ctx)
+		return exists && running && image == a.Image, nil
+	default:
+		_, err := quietOutput(ctx, engine, "image", "inspect", a.Name)
+		return err == nil, nil
+	}
+}
+
+// sameLines reports whether a and b hold the same non-empty lines, in any
+// order.
+func sameLines(a, b string) bool {
+	split := func(s string) []string {
+		lines := strings.Fields(s)
+		sort.Strings(lines)
+		return lines
+	}
+	x, y := split(a), split(b)
+	return len(x) > 0 && slices.Equal(x, y)
+}
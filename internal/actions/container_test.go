@@ -0,0 +1,123 @@
+package actions
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestContainerActionRunArgs(t *testing.T) {
+	a := &ContainerAction{
+		Name:    "postgres",
+		Image:   "postgres:16",
+		Ports:   []string{"5432:5432"},
+		Volumes: []string{"pgdata:/var/lib/postgresql/data"},
+		Env:     map[string]string{"POSTGRES_USER": "dev", "POSTGRES_PASSWORD": "dev"},
+	}
+	want := []string{"run", "-d", "--name", "postgres", "--restart", "unless-stopped",
+		"-p", "5432:5432", "-v", "pgdata:/var/lib/postgresql/data",
+		"-e", "POSTGRES_PASSWORD=dev", "-e", "POSTGRES_USER=dev", "postgres:16"}
+	if got := a.runArgs(); !slices.Equal(got, want) {
+		t.Errorf("runArgs = %v\nwant %v", got, want)
+	}
+}
+
+func TestContainerActionDescribe(t *testing.T) {
+	tests := []struct {
+		a    ContainerAction
+		want string
+	}{
+		{ContainerAction{Name: "redis:7"}, "pull image redis:7"},
+		{ContainerAction{Name: "db", Image: "postgres:16"}, "run container db from postgres:16"},
+		{ContainerAction{Name: "svc", Compose: "/s/compose.yaml"}, "compose up svc (/s/compose.yaml)"},
+	}
+	for _, tt := range tests {
+		if got := tt.a.Describe(); got != tt.want {
+			t.Errorf("Describe() = %q, want %q", got, tt.want)
+		}
+	}
+}
+
+func TestSameLines(t *testing.T) {
+	if !sameLines("db\nweb\n", "web\ndb") {
+		t.Error("same services in another order should match")
+	}
+	if sameLines("db\nweb\n", "db\n") || sameLines("", "") {
+		t.Error("missing or no services should not match")
+	}
+}
+
+// fakeDocker puts a docker stand-in on PATH that reports a container "db"
+// created from image and running when running is set. The returned function
+// lists the other docker commands run since.
+func fakeDocker(t *testing.T, image string, running bool) (calls func() string) {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("uses a shell script")
+	}
+	dir := t.TempDir()
+	state := "false"
+	if running {
+		state = "true"
+	}
+	script := `#!/bin/sh
+case "$1 $2" in
+"container inspect") [ "$5" = db ] && echo "` + state + ` ` + image + `" && exit 0; exit 1 ;;
+"image inspect") [ "$3" = redis:7 ] && exit 0; exit 1 ;;
+esac
+echo "$@" >> "` + filepath.Join(dir, "calls") + `"
+`
+	if err := os.WriteFile(filepath.Join(dir, "docker"), []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	return func() string {
+		data, _ := os.ReadFile(filepath.Join(dir, "calls"))
+		return strings.TrimSpace(string(data))
+	}
+}
+
+func TestContainerActionIsApplied(t *testing.T) {
+	fakeDocker(t, "postgres:16", true)
+	ctx := context.Background()
+	tests := []struct {
+		a    ContainerAction
+		want bool
+	}{
+		{ContainerAction{Name: "db", Image: "postgres:16", Engine: "docker"}, true},
+		{ContainerAction{Name: "db", Image: "postgres:17", Engine: "docker"}, false},
+		{ContainerAction{Name: "cache", Image: "redis:7", Engine: "docker"}, false},
+		{ContainerAction{Name: "redis:7", Engine: "docker"}, true},
+		{ContainerAction{Name: "nginx", Engine: "docker"}, false},
+	}
+	for _, tt := range tests {
+		if got, _ := tt.a.IsApplied(ctx); got != tt.want {
+			t.Errorf("%s: IsApplied = %v, want %v", tt.a.Describe(), got, tt.want)
+		}
+	}
+}
+
+func TestContainerActionRun(t *testing.T) {
+	ctx := context.Background()
+
+	calls := fakeDocker(t, "postgres:16", false)
+	a := &ContainerAction{Name: "db", Image: "postgres:16", Engine: "docker"}
+	if err := a.Run(ctx, false); err != nil {
+		t.Fatal(err)
+	}
+	if got := calls(); got != "start db" {
+		t.Errorf("stopped container: calls = %q, want start", got)
+	}
+
+	calls = fakeDocker(t, "postgres:15", true)
+	if err := a.Run(ctx, false); err != nil {
+		t.Fatal(err)
+	}
+	if got := calls(); !strings.HasPrefix(got, "rm -f db\nrun -d --name db") {
+		t.Errorf("other image: calls = %q, want rm then run", got)
+	}
+}
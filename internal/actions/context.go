@@ -0,0 +1,154 @@
+package actions
+
+import (
+	"context"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+type ctxKey int
+
+const (
+	progressKey ctxKey = iota
+	outputKey
+	debugKey
+	conflictBatchKey
+	conflictLogKey
+	refetchKey
+	reporterKey
+)
+
+// ProgressFunc receives byte progress for a download. total is -1 when the
+// server did not send a Content-Length.
+type ProgressFunc func(done, total int64)
+
+// WithProgress returns a context whose downloads report byte progress to fn.
+func WithProgress(ctx context.Context, fn ProgressFunc) context.Context {
+	return context.WithValue(ctx, progressKey, fn)
+}
+
+// WithRefetch returns a context whose downloads bypass the download cache
+// and are fetched again in full.
+func WithRefetch(ctx context.Context) context.Context {
+	return context.WithValue(ctx, refetchKey, true)
+}
+
+func refetchFrom(ctx context.Context) bool {
+	v, _ := ctx.Value(refetchKey).(bool)
+	return v
+}
+
+type outputs struct {
+	stdout, stderr io.Writer
+}
+
+// WithOutput returns a context whose subprocesses write to stdout and stderr
+// instead of the process's own streams. Nil writers keep the defaults.
+func WithOutput(ctx context.Context, stdout, stderr io.Writer) context.Context {
+	return context.WithValue(ctx, outputKey, outputs{stdout, stderr})
+}
+
+// outputFrom returns the subprocess output streams configured on ctx.
+func outputFrom(ctx context.Context) (stdout, stderr io.Writer) {
+	stdout, stderr = os.Stdout, os.Stderr
+	if o, ok := ctx.Value(outputKey).(outputs); ok {
+		if o.stdout != nil {
+			stdout = o.stdout
+		}
+		if o.stderr != nil {
+			stderr = o.stderr
+		}
+	}
+	return stdout, stderr
+}
+
+// WithDebug returns a context whose subprocesses log their argv to fn before
+// running.
+func WithDebug(ctx context.Context, fn func(string)) context.Context {
+	return context.WithValue(ctx, debugKey, fn)
+}
+
+// Sync conflict resolutions.
+const (
+	ResolveRepo   = "keep repo"
+	ResolveSystem = "keep system"
+	ResolveNewer  = "keep newer"
+	ResolveSkip   = "skip"
+)
+
+// ConflictBatch carries a "for all" answer from one sync conflict prompt to
+// the conflicts that follow it in the same run.
+type ConflictBatch struct {
+	choice string // "" until the user picks a for-all resolution
+}
+
+// WithConflictBatch returns a context whose sync conflicts share b, so that a
+// for-all answer is applied to every later conflict without prompting.
+func WithConflictBatch(ctx context.Context, b *ConflictBatch) context.Context {
+	return context.WithValue(ctx, conflictBatchKey, b)
+}
+
+// conflictBatchFrom returns the batch on ctx, or a fresh one scoped to a
+// single conflict.
+func conflictBatchFrom(ctx context.Context) *ConflictBatch {
+	if b, ok := ctx.Value(conflictBatchKey).(*ConflictBatch); ok && b != nil {
+		return b
+	}
+	return &ConflictBatch{}
+}
+
+// WithConflictLog returns a context that reports each resolved sync conflict
+// to fn with the destination path and the resolution taken.
+func WithConflictLog(ctx context.Context, fn func(path, resolution string)) context.Context {
+	return context.WithValue(ctx, conflictLogKey, fn)
+}
+
+func conflictLogFrom(ctx context.Context) func(path, resolution string) {
+	fn, _ := ctx.Value(conflictLogKey).(func(path, resolution string))
+	return fn
+}
+
+// command builds a subprocess wired to the output streams on ctx, logging its
+// argv when a debug logger is configured.
+func command(ctx context.Context, name string, args ...string) *exec.Cmd {
+	if fn, ok := ctx.Value(debugKey).(func(string)); ok && fn != nil {
+		fn("exec: " + strings.Join(append([]string{name}, args...), " "))
+	}
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Stdout, cmd.Stderr = outputFrom(ctx)
+	return cmd
+}
+
+// progressReader wraps r, reporting bytes read to the ProgressFunc on ctx.
+// It returns r unchanged when no ProgressFunc is configured.
+func progressReader(ctx context.Context, r io.Reader, total int64) io.Reader {
+	return progressReaderFrom(ctx, r, 0, total)
+}
+
+// progressReaderFrom is progressReader for a download resumed after done
+// bytes.
+func progressReaderFrom(ctx context.Context, r io.Reader, done, total int64) io.Reader {
+	fn, ok := ctx.Value(progressKey).(ProgressFunc)
+	if !ok || fn == nil {
+		return r
+	}
+	return &countingReader{r: r, done: done, total: total, fn: fn}
+}
+
+type countingReader struct {
+	r     io.Reader
+	done  int64
+	total int64
+	fn    ProgressFunc
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	if n > 0 {
+		c.done += int64(n)
+		c.fn(c.done, c.total)
+	}
+	return n, err
+}
@@ -0,0 +1,85 @@
+package actions
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"runtime"
+	"strconv"
+	"testing"
+)
+
+func TestOutputFromDefaults(t *testing.T) {
+	stdout, stderr := outputFrom(context.Background())
+	if stdout != os.Stdout || stderr != os.Stderr {
+		t.Error("expected process streams by default")
+	}
+	var buf bytes.Buffer
+	stdout, stderr = outputFrom(WithOutput(context.Background(), &buf, nil))
+	if stdout != &buf || stderr != os.Stderr {
+		t.Error("expected stdout override with default stderr")
+	}
+}
+
+func TestRunActionWithOutput(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Unix-only test")
+	}
+	var buf bytes.Buffer
+	ctx := WithOutput(context.Background(), &buf, &buf)
+	a := &RunAction{Command: "echo captured"}
+	if err := a.Run(ctx, false); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != "captured\n" {
+		t.Errorf("output = %q", buf.String())
+	}
+}
+
+func TestBinaryActionReportsProgress(t *testing.T) {
+	content := bytes.Repeat([]byte("x"), 4096)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+		w.Write(content)
+	}))
+	defer srv.Close()
+
+	var lastDone, lastTotal int64
+	ctx := WithProgress(context.Background(), func(done, total int64) {
+		lastDone, lastTotal = done, total
+	})
+	a := &BinaryAction{Name: "bin", SourceURL: srv.URL + "/bin", InstallTo: t.TempDir()}
+	if err := a.Run(ctx, false); err != nil {
+		t.Fatal(err)
+	}
+	if lastDone != int64(len(content)) || lastTotal != int64(len(content)) {
+		t.Errorf("progress = %d/%d, want %d/%d", lastDone, lastTotal, len(content), len(content))
+	}
+}
+
+func TestCommandLogsArgv(t *testing.T) {
+	var logged []string
+	ctx := WithDebug(context.Background(), func(s string) { logged = append(logged, s) })
+	cmd := command(ctx, "echo", "a", "b")
+	if cmd.Stdout != os.Stdout {
+		t.Error("expected default stdout")
+	}
+	if len(logged) != 1 || logged[0] != "exec: echo a b" {
+		t.Errorf("logged = %q", logged)
+	}
+}
+
+func TestConflictBatchFrom(t *testing.T) {
+	b := &ConflictBatch{}
+	if got := conflictBatchFrom(WithConflictBatch(context.Background(), b)); got != b {
+		t.Error("expected the batch stored on the context")
+	}
+	if got := conflictBatchFrom(context.Background()); got == nil || got.choice != "" {
+		t.Errorf("expected a fresh batch, got %+v", got)
+	}
+	if conflictLogFrom(context.Background()) != nil {
+		t.Error("expected no conflict log by default")
+	}
+}
@@ -0,0 +1,167 @@
+package actions
+
+import (
+	"context"
+	"fmt"
+	"mime"
+	"os/exec"
+	"strings"
+)
+
+// DefaultAppAction makes App the default handler for file types and URL
+// schemes. Each entry of Handles is a file extension (".md"), a URL scheme
+// ("https:" or "mailto://"), or a platform type name: a UTI such as
+// "public.plain-text" on macOS, a MIME type such as "text/markdown" on
+// Linux, or a ProgID-style name on Windows.
+//
+// App is a bundle ID on macOS (set with duti), a .desktop file on Linux
+// (set with xdg-mime), and a ProgID on Windows, where Windows only accepts
+// changes through the SetUserFTA tool; without it the item is skipped with
+// instructions.
+//
+// Idempotency: DefaultAppAction implements Idempotent by querying the
+// current handler of every entry.
+type DefaultAppAction struct {
+	App     string
+	Handles []string
+	OS      string
+}
+
+func (a *DefaultAppAction) Describe() string {
+	return fmt.Sprintf("set %s as default for %s", a.App, strings.Join(a.Handles, ", "))
+}
+
+// handlerScheme returns the scheme of a URL scheme entry such as "https:"
+// or "mailto://", and whether the entry is one.
+func handlerScheme(entry string) (string, bool) {
+	scheme, ok := strings.CutSuffix(entry, "://")
+	if !ok {
+		scheme, ok = strings.CutSuffix(entry, ":")
+	}
+	if !ok || scheme == "" {
+		return "", false
+	}
+	return scheme, true
+}
+
+// linuxMIME returns the MIME type xdg-mime takes for an entry.
+func linuxMIME(entry string) (string, error) {
+	if scheme, ok := handlerScheme(entry); ok {
+		return "x-scheme-handler/" + scheme, nil
+	}
+	if strings.HasPrefix(entry, ".") {
+		t := mime.TypeByExtension(entry)
+		if t == "" {
+			return "", fmt.Errorf("no MIME type known for %s; give the MIME type instead", entry)
+		}
+		t, _, _ = strings.Cut(t, ";")
+		return t, nil
+	}
+	return entry, nil
+}
+
+// setCommand returns the command making App the handler for entry.
+func (a *DefaultAppAction) setCommand(entry string) ([]string, error) {
+	switch a.OS {
+	case "darwin":
+		if scheme, ok := handlerScheme(entry); ok {
+			return []string{"duti", "-s", a.App, scheme}, nil
+		}
+		return []string{"duti", "-s", a.App, entry, "all"}, nil
+	case "linux":
+		t, err := linuxMIME(entry)
+		if err != nil {
+			return nil, err
+		}
+		return []string{"xdg-mime", "default", a.App, t}, nil
+	case "windows":
+		if scheme, ok := handlerScheme(entry); ok {
+			entry = scheme
+		}
+		return []string{"SetUserFTA", entry, a.App}, nil
+	default:
+		return nil, fmt.Errorf("default apps are not supported on %s", a.OS)
+	}
+}
+
+// current returns the handler currently set for entry.
+func (a *DefaultAppAction) current(ctx context.Context, entry string) (string, error) {
+	switch a.OS {
+	case "darwin":
+		if strings.HasPrefix(entry, ".") {
+			// duti -x prints the app name, its path, and its bundle ID.
+			out, err := quietOutput(ctx, "duti", "-x", strings.TrimPrefix(entry, "."))
+			lines := strings.Split(strings.TrimSpace(out), "\n")
+			if err != nil || len(lines) < 3 {
+				return "", err
+			}
+			return strings.TrimSpace(lines[2]), nil
+		}
+		if scheme, ok := handlerScheme(entry); ok {
+			entry = scheme
+		}
+		out, err := quietOutput(ctx, "duti", "-d", entry)
+		return strings.TrimSpace(out), err
+	case "linux":
+		t, err := linuxMIME(entry)
+		if err != nil {
+			return "", err
+		}
+		out, err := quietOutput(ctx, "xdg-mime", "query", "default", t)
+		return strings.TrimSpace(out), err
+	case "windows":
+		if scheme, ok := handlerScheme(entry); ok {
+			entry = scheme
+		}
+		// SetUserFTA get lists "entry, ProgID" lines.
+		out, err := quietOutput(ctx, "SetUserFTA", "get")
+		for _, line := range strings.Split(out, "\n") {
+			k, v, _ := strings.Cut(line, ",")
+			if strings.EqualFold(strings.TrimSpace(k), entry) {
+				return strings.TrimSpace(v), err
+			}
+		}
+		return "", err
+	}
+	return "", nil
+}
+
+func (a *DefaultAppAction) Run(ctx context.Context, dryRun bool) error {
+	tool := map[string]string{"darwin": "duti", "linux": "xdg-mime", "windows": "SetUserFTA"}[a.OS]
+	if _, err := exec.LookPath(tool); err != nil && !dryRun {
+		switch a.OS {
+		case "darwin":
+			return fmt.Errorf("duti not found; install it with `brew install duti`")
+		case "windows":
+			return fmt.Errorf("Windows only changes default apps through Settings > Apps > Default apps, or SetUserFTA when it is on PATH: %w", ErrSkipped)
+		}
+	}
+	for _, entry := range a.Handles {
+		args, err := a.setCommand(entry)
+		if err != nil {
+			return err
+		}
+		if dryRun {
+			reportDryRun(ctx, "%s", strings.Join(args, " "))
+			continue
+		}
+		if cur, err := a.current(ctx, entry); err == nil && strings.EqualFold(cur, a.App) {
+			continue
+		}
+		if err := command(ctx, args[0], args[1:]...).Run(); err != nil {
+			return fmt.Errorf("set default for %s: %w", entry, err)
+		}
+	}
+	return nil
+}
+
+// IsApplied reports whether App already handles every entry.
+func (a *DefaultAppAction) IsApplied(ctx context.Context) (bool, error) {
+	for _, entry := range a.Handles {
+		cur, err := a.current(ctx, entry)
+		if err != nil || !strings.EqualFold(cur, a.App) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
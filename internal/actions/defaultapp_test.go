@@ -0,0 +1,78 @@
+package actions
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestHandlerScheme(t *testing.T) {
+	tests := []struct {
+		entry, scheme string
+		ok            bool
+	}{
+		{"https:", "https", true},
+		{"mailto://", "mailto", true},
+		{".md", "", false},
+		{"public.plain-text", "", false},
+	}
+	for _, tt := range tests {
+		if scheme, ok := handlerScheme(tt.entry); scheme != tt.scheme || ok != tt.ok {
+			t.Errorf("handlerScheme(%q) = %q, %v", tt.entry, scheme, ok)
+		}
+	}
+}
+
+func TestDefaultAppSetCommand(t *testing.T) {
+	tests := []struct {
+		os, app, entry string
+		want           []string
+	}{
+		{"darwin", "com.microsoft.VSCode", ".md", []string{"duti", "-s", "com.microsoft.VSCode", ".md", "all"}},
+		{"darwin", "org.mozilla.firefox", "https:", []string{"duti", "-s", "org.mozilla.firefox", "https"}},
+		{"linux", "firefox.desktop", "https://", []string{"xdg-mime", "default", "firefox.desktop", "x-scheme-handler/https"}},
+		{"linux", "code.desktop", "text/markdown", []string{"xdg-mime", "default", "code.desktop", "text/markdown"}},
+		{"linux", "firefox.desktop", ".html", []string{"xdg-mime", "default", "firefox.desktop", "text/html"}},
+		{"windows", "FirefoxURL", "https:", []string{"SetUserFTA", "https", "FirefoxURL"}},
+	}
+	for _, tt := range tests {
+		a := &DefaultAppAction{App: tt.app, OS: tt.os}
+		got, err := a.setCommand(tt.entry)
+		if err != nil || !slices.Equal(got, tt.want) {
+			t.Errorf("%s %s: setCommand = %v, %v; want %v", tt.os, tt.entry, got, err, tt.want)
+		}
+	}
+}
+
+func TestDefaultAppIsAppliedLinux(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses a shell script")
+	}
+	dir := t.TempDir()
+	script := `#!/bin/sh
+[ "$3" = x-scheme-handler/https ] && echo firefox.desktop
+[ "$3" = text/markdown ] && echo org.gnome.TextEditor.desktop
+exit 0
+`
+	if err := os.WriteFile(filepath.Join(dir, "xdg-mime"), []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	ctx := context.Background()
+	a := &DefaultAppAction{App: "firefox.desktop", Handles: []string{"https:"}, OS: "linux"}
+	if ok, _ := a.IsApplied(ctx); !ok {
+		t.Error("firefox should already handle https")
+	}
+	a.Handles = append(a.Handles, "text/markdown")
+	if ok, _ := a.IsApplied(ctx); ok {
+		t.Error("reported applied while another app handles text/markdown")
+	}
+	if !strings.Contains(a.Describe(), "https:, text/markdown") {
+		t.Errorf("Describe() = %q", a.Describe())
+	}
+}
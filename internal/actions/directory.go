@@ -6,9 +6,9 @@ import (
 	"io/fs"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
 
-	"github.com/atomikpanda/dotular/internal/color"
 	"github.com/atomikpanda/dotular/internal/platform"
 )
 
@@ -24,16 +24,40 @@ import (
 // Link=true creates a symlink at the system destination pointing to the repo
 // directory (equivalent to permanent push, always in sync).
 //
+// Permissions and DirPermissions are enforced on every file and directory of
+// the system-side tree after a push or sync, as FileAction does for a single
+// file.
+//
+// Symlinks inside the tree are recreated as symlinks: one pointing into the
+// tree points at the same entry of the copy, relative to the link, and one
+// pointing outside it keeps its absolute target. With Dereference the files
+// and directories they point to are copied instead.
+//
+// Files larger than MaxFileSize are left out of copies in either direction,
+// with a warning, so multi-gigabyte caches in a managed directory are
+// neither copied nor read.
+//
+// Owner and Group (Unix only) are applied to the whole system-side tree after
+// a push or sync, as with FileAction.
+//
 // Idempotency: DirectoryAction implements Idempotent for link items. It
 // verifies that the symlink exists and resolves to the correct source path.
 type DirectoryAction struct {
-	Source      string // repo-side directory path
-	Destination string // system-side parent directory (may contain ~ / $VARS)
-	Direction   string // "push" | "pull" | "sync"
-	Link        bool
-	Permissions string // applied to every file written (optional)
+	Source         string // repo-side directory path
+	Destination    string // system-side parent directory (may contain ~ / $VARS)
+	Direction      string // "push" | "pull" | "sync"
+	Link           bool
+	Permissions    string // Unix octal applied to every file in the tree (optional)
+	DirPermissions string // Unix octal applied to every directory in the tree (optional)
+	Dereference    bool   // copy what symlinks point to rather than the links
+	MaxFileSize    int64  // files larger than this are skipped; 0 means no limit
+	Owner          string // user name or uid (Unix only)
+	Group          string // group name or gid (Unix only)
 }
 
+// RepoPath returns the directory's path in the repo.
+func (a *DirectoryAction) RepoPath() string { return a.Source }
+
 // ResolvedTarget returns the fully expanded destination directory path.
 // If the destination's basename matches the source basename or has a file
 // extension, it is treated as the complete path. Otherwise the source basename
@@ -95,7 +119,12 @@ func (a *DirectoryAction) Run(ctx context.Context, dryRun bool) error {
 	dest := a.ResolvedDir()
 
 	if dryRun {
-		fmt.Printf("    %s\n", color.Dim("[dry-run] "+a.Describe()))
+		reportDryRun(ctx, "%s", a.Describe())
+		for _, status := range []string{a.PermissionsStatus(), a.OwnershipStatus()} {
+			if status != "" {
+				report(ctx, LevelDetail, KindDryRun, status)
+			}
+		}
 		return nil
 	}
 
@@ -106,32 +135,155 @@ func (a *DirectoryAction) Run(ctx context.Context, dryRun bool) error {
 		return createDirSymlink(a.Source, target)
 	}
 
-	switch a.Direction {
-	case "pull":
+	if a.Direction == "pull" {
 		if !dirExists(target) {
 			return fmt.Errorf("pull: system directory does not exist: %s: %w", target, ErrSkipped)
 		}
-		return copyDir(target, a.Source)
-	case "sync":
-		repoExists := dirExists(a.Source)
-		sysExists := dirExists(target)
-		switch {
-		case !repoExists && !sysExists:
-			return fmt.Errorf("sync-dir: neither repo nor system directory exists (%s)", filepath.Base(a.Source))
-		case repoExists && !sysExists:
-			fmt.Printf("    %s\n", color.Cyan("sync-dir: system copy missing, pushing"))
-			return copyDir(a.Source, target)
-		case !repoExists && sysExists:
-			fmt.Printf("    %s\n", color.Cyan("sync-dir: repo copy missing, pulling"))
-			return copyDir(target, a.Source)
-		default:
-			// Both exist: push repo over system (per-file sync requires file items).
-			fmt.Printf("    %s\n", color.Cyan("sync-dir: both exist, pushing repo -> system"))
-			return copyDir(a.Source, target)
+		return copyDir(target, a.Source, a.copyOptions(ctx))
+	}
+
+	fileMode, dirMode, err := a.modes()
+	if err != nil {
+		return err
+	}
+	own, err := resolveOwnership(a.Owner, a.Group)
+	if err != nil {
+		return err
+	}
+	if err := own.checkElevation(); err != nil {
+		return err
+	}
+	if err := a.runPushOrSync(ctx, target); err != nil {
+		return err
+	}
+	if err := enforceTreePermissions(target, fileMode, dirMode); err != nil {
+		return err
+	}
+	return own.applyTree(target)
+}
+
+// modes parses Permissions and DirPermissions; a zero mode means unset.
+func (a *DirectoryAction) modes() (fileMode, dirMode os.FileMode, err error) {
+	if a.Permissions != "" {
+		if fileMode, err = parseMode(a.Permissions); err != nil {
+			return 0, 0, fmt.Errorf("invalid permissions %q: %w", a.Permissions, err)
+		}
+	}
+	if a.DirPermissions != "" {
+		if dirMode, err = parseMode(a.DirPermissions); err != nil {
+			return 0, 0, fmt.Errorf("invalid dir_permissions %q: %w", a.DirPermissions, err)
+		}
+	}
+	return fileMode, dirMode, nil
+}
+
+// PermissionsStatus returns a human-readable permissions annotation for the
+// destination tree, or "" when not applicable.
+func (a *DirectoryAction) PermissionsStatus() string {
+	if a.Link || (a.Permissions == "" && a.DirPermissions == "") {
+		return ""
+	}
+	fileMode, dirMode, err := a.modes()
+	if err != nil {
+		return fmt.Sprintf("[permissions: %v]", err)
+	}
+	target := a.ResolvedTarget()
+	if !dirExists(target) {
+		return ""
+	}
+	var total, wrong int
+	filepath.WalkDir(target, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.Type()&fs.ModeSymlink != 0 {
+			return nil
+		}
+		want := fileMode
+		if d.IsDir() {
+			want = dirMode
+		}
+		if want == 0 {
+			return nil
+		}
+		total++
+		if info, err := d.Info(); err == nil {
+			if ok, _ := modeState(path, info, want); !ok {
+				wrong++
+			}
+		}
+		return nil
+	})
+
+	want := a.Permissions
+	if a.DirPermissions != "" {
+		want = strings.TrimPrefix(want+", dirs "+a.DirPermissions, ", ")
+	}
+	if wrong == 0 {
+		return fmt.Sprintf("[permissions: %s ✓]", want)
+	}
+	return fmt.Sprintf("[permissions: want %s, %d of %d entries differ ⚠]", want, wrong, total)
+}
+
+// enforceTreePermissions sets every file under root to fileMode and every
+// directory (including root) to dirMode. Zero modes are skipped, and
+// symlinks are never followed.
+func enforceTreePermissions(root string, fileMode, dirMode os.FileMode) error {
+	if fileMode == 0 && dirMode == 0 {
+		return nil
+	}
+	return filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.Type()&fs.ModeSymlink != 0 {
+			return nil
+		}
+		want := fileMode
+		if d.IsDir() {
+			want = dirMode
+		}
+		if want == 0 {
+			return nil
 		}
-	default: // push
-		return copyDir(a.Source, target)
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		return setMode(path, info, want)
+	})
+}
+
+func (a *DirectoryAction) runPushOrSync(ctx context.Context, target string) error {
+	if a.Direction != "sync" {
+		return copyDir(a.Source, target, a.copyOptions(ctx))
+	}
+	repoExists := dirExists(a.Source)
+	sysExists := dirExists(target)
+	switch {
+	case !repoExists && !sysExists:
+		return fmt.Errorf("sync-dir: neither repo nor system directory exists (%s)", filepath.Base(a.Source))
+	case repoExists && !sysExists:
+		report(ctx, LevelInfo, KindSync, "sync-dir: system copy missing, pushing")
+		return copyDir(a.Source, target, a.copyOptions(ctx))
+	case !repoExists && sysExists:
+		report(ctx, LevelInfo, KindSync, "sync-dir: repo copy missing, pulling")
+		return copyDir(target, a.Source, a.copyOptions(ctx))
+	default:
+		// Both exist: push repo over system (per-file sync requires file items).
+		report(ctx, LevelInfo, KindSync, "sync-dir: both exist, pushing repo -> system")
+		return copyDir(a.Source, target, a.copyOptions(ctx))
+	}
+}
+
+// OwnershipStatus returns a human-readable owner/group annotation for the
+// destination directory, or "" when not applicable.
+func (a *DirectoryAction) OwnershipStatus() string {
+	if a.Link || (a.Owner == "" && a.Group == "") {
+		return ""
 	}
+	own, err := resolveOwnership(a.Owner, a.Group)
+	if err != nil {
+		return fmt.Sprintf("[owner: %v]", err)
+	}
+	return own.status(a.ResolvedTarget())
 }
 
 // --- helpers -----------------------------------------------------------------
@@ -153,9 +305,45 @@ func createDirSymlink(src, dst string) error {
 	return os.Symlink(abs, dst)
 }
 
-// copyDir recursively copies the src directory tree into dst (created if needed).
-func copyDir(src, dst string) error {
-	src = filepath.Clean(src)
+// copyOptions control copyDir.
+type copyOptions struct {
+	Dereference bool                          // copy what symlinks point to instead of the links
+	MaxFileSize int64                         // skip larger files; 0 means no limit
+	Skipped     func(path string, size int64) // called for each file skipped for its size
+}
+
+// copyOptions returns the options for copying the action's tree, reporting
+// skipped files on ctx.
+func (a *DirectoryAction) copyOptions(ctx context.Context) copyOptions {
+	return copyOptions{
+		Dereference: a.Dereference,
+		MaxFileSize: a.MaxFileSize,
+		Skipped: func(path string, size int64) {
+			report(ctx, LevelWarn, KindSkipped, fmt.Sprintf("skipped %s: %.1f MiB is over max_file_size", path, float64(size)/(1<<20)))
+		},
+	}
+}
+
+// copyDir recursively copies the src directory tree into dst (created if
+// needed). Symlinks are recreated with linkTarget, or with Dereference
+// replaced by copies of what they point to. Files over MaxFileSize are left
+// alone on both sides.
+func copyDir(src, dst string, opts copyOptions) error {
+	return copyTree(filepath.Clean(src), dst, opts, nil)
+}
+
+// copyTree is copyDir, with the resolved paths of the directories being
+// copied through dereferenced symlinks in seen, so a link to an ancestor is
+// an error rather than an endless copy.
+func copyTree(src, dst string, opts copyOptions, seen []string) error {
+	// WalkDir does not descend into a root that is a symlink.
+	if resolved, err := filepath.EvalSymlinks(src); err == nil {
+		if slices.Contains(seen, resolved) {
+			return fmt.Errorf("symlink loop at %s", src)
+		}
+		seen = append(seen, resolved)
+		src = resolved
+	}
 	return filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
 		if err != nil {
 			return err
@@ -165,13 +353,88 @@ func copyDir(src, dst string) error {
 			return err
 		}
 		target := filepath.Join(dst, rel)
-		if d.IsDir() {
+		if d.Type()&fs.ModeSymlink != 0 && !opts.Dereference {
+			link, err := linkTarget(path, src, dst)
+			if err != nil {
+				return err
+			}
+			return replaceSymlink(link, target)
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			return fmt.Errorf("dereference %s: %w", path, err)
+		}
+		switch {
+		case info.IsDir() && d.Type()&fs.ModeSymlink != 0:
+			return copyTree(path, target, opts, seen)
+		case info.IsDir():
 			return os.MkdirAll(target, 0o755)
+		case opts.MaxFileSize > 0 && info.Size() > opts.MaxFileSize:
+			if opts.Skipped != nil {
+				opts.Skipped(path, info.Size())
+			}
+			return nil
+		}
+		// Write a file over an old symlink, not through it.
+		if err := removeSymlink(target); err != nil {
+			return err
 		}
-		return copyFilePath(path, target)
+		return copyFile(path, target)
 	})
 }
 
+// linkTarget returns the target for the copy in dstRoot of the symlink path
+// in srcRoot: a link into srcRoot points at the same entry under dstRoot,
+// relative to the copy, and a link out of it gets the absolute path of what
+// it points to.
+func linkTarget(path, srcRoot, dstRoot string) (string, error) {
+	link, err := os.Readlink(path)
+	if err != nil {
+		return "", err
+	}
+	dest := link
+	if !filepath.IsAbs(dest) {
+		dest = filepath.Join(filepath.Dir(path), dest)
+	}
+	if dir, err := filepath.EvalSymlinks(filepath.Dir(dest)); err == nil {
+		dest = filepath.Join(dir, filepath.Base(dest))
+	}
+	rel, err := filepath.Rel(srcRoot, dest)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return filepath.Abs(dest)
+	}
+	from, err := filepath.Rel(srcRoot, filepath.Dir(path))
+	if err != nil {
+		return "", err
+	}
+	return filepath.Rel(filepath.Join(dstRoot, from), filepath.Join(dstRoot, rel))
+}
+
+// replaceSymlink makes path a symlink to link, replacing a file or symlink
+// already there.
+func replaceSymlink(link, path string) error {
+	if info, err := os.Lstat(path); err == nil {
+		if info.IsDir() {
+			return fmt.Errorf("cannot replace directory %s with a symlink", path)
+		}
+		if cur, err := os.Readlink(path); err == nil && cur == link {
+			return nil
+		}
+		if err := os.Remove(path); err != nil {
+			return err
+		}
+	}
+	return os.Symlink(link, path)
+}
+
+// removeSymlink removes path if it is a symlink.
+func removeSymlink(path string) error {
+	if info, err := os.Lstat(path); err == nil && info.Mode()&os.ModeSymlink != 0 {
+		return os.Remove(path)
+	}
+	return nil
+}
+
 func dirExists(path string) bool {
 	fi, err := os.Stat(path)
 	return err == nil && fi.IsDir()
@@ -4,6 +4,8 @@ import (
 	"context"
 	"os"
 	"path/filepath"
+	"runtime"
+	"strings"
 	"testing"
 )
 
@@ -81,7 +83,7 @@ func TestCopyDir(t *testing.T) {
 	os.WriteFile(filepath.Join(src, "a.txt"), []byte("aaa"), 0o644)
 	os.WriteFile(filepath.Join(src, "sub", "b.txt"), []byte("bbb"), 0o644)
 
-	if err := copyDir(src, dst); err != nil {
+	if err := copyDir(src, dst, copyOptions{}); err != nil {
 		t.Fatal(err)
 	}
 
@@ -102,6 +104,85 @@ func TestCopyDir(t *testing.T) {
 	}
 }
 
+func TestCopyDirSymlinks(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src")
+	outside := filepath.Join(dir, "outside.txt")
+	os.MkdirAll(filepath.Join(src, "sub"), 0o755)
+	os.WriteFile(filepath.Join(src, "a.txt"), []byte("aaa"), 0o644)
+	os.WriteFile(outside, []byte("out"), 0o644)
+	if err := os.Symlink(filepath.Join(src, "a.txt"), filepath.Join(src, "sub", "abs")); err != nil {
+		t.Skip("symlinks not supported:", err)
+	}
+	os.Symlink("../a.txt", filepath.Join(src, "sub", "rel"))
+	os.Symlink(outside, filepath.Join(src, "out"))
+	os.Symlink("sub", filepath.Join(src, "subdir"))
+
+	dst := filepath.Join(dir, "dst")
+	if err := copyDir(src, dst, copyOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[string]string{
+		"sub/abs": filepath.Join("..", "a.txt"),
+		"sub/rel": filepath.Join("..", "a.txt"),
+		"subdir":  "sub",
+	} {
+		if got, err := os.Readlink(filepath.Join(dst, name)); err != nil || got != want {
+			t.Errorf("%s -> %q, %v; want %q", name, got, err, want)
+		}
+	}
+	if got, _ := os.Readlink(filepath.Join(dst, "out")); filepath.Base(got) != "outside.txt" || !filepath.IsAbs(got) {
+		t.Errorf("out -> %q, want the absolute path of outside.txt", got)
+	}
+	if data, _ := os.ReadFile(filepath.Join(dst, "out")); string(data) != "out" {
+		t.Errorf("out reads %q", data)
+	}
+
+	deref := filepath.Join(dir, "deref")
+	if err := copyDir(src, deref, copyOptions{Dereference: true}); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"sub/abs", "out", "subdir/rel"} {
+		info, err := os.Lstat(filepath.Join(deref, name))
+		if err != nil || !info.Mode().IsRegular() {
+			t.Errorf("%s is not a regular file: %v", name, err)
+		}
+	}
+
+	os.Symlink("..", filepath.Join(src, "sub", "loop"))
+	if err := copyDir(src, filepath.Join(dir, "loop"), copyOptions{Dereference: true}); err == nil {
+		t.Error("expected an error for a symlink loop")
+	}
+}
+
+func TestCopyDirMaxFileSize(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src")
+	dst := filepath.Join(dir, "dst")
+	os.MkdirAll(src, 0o755)
+	os.MkdirAll(dst, 0o755)
+	os.WriteFile(filepath.Join(src, "small.txt"), []byte("ok"), 0o644)
+	os.WriteFile(filepath.Join(src, "big.db"), make([]byte, 2048), 0o644)
+	os.WriteFile(filepath.Join(dst, "big.db"), []byte("system copy"), 0o644)
+
+	var skipped []string
+	opts := copyOptions{MaxFileSize: 1024, Skipped: func(path string, size int64) {
+		skipped = append(skipped, filepath.Base(path))
+	}}
+	if err := copyDir(src, dst, opts); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(filepath.Join(dst, "small.txt")); string(data) != "ok" {
+		t.Errorf("small.txt = %q", data)
+	}
+	if data, _ := os.ReadFile(filepath.Join(dst, "big.db")); string(data) != "system copy" {
+		t.Error("file over the limit was copied")
+	}
+	if len(skipped) != 1 || skipped[0] != "big.db" {
+		t.Errorf("skipped = %q, want [big.db]", skipped)
+	}
+}
+
 func TestDirExists(t *testing.T) {
 	dir := t.TempDir()
 	if !dirExists(dir) {
@@ -344,3 +425,66 @@ func TestDirectoryActionResolvedDir(t *testing.T) {
 		t.Errorf("ResolvedDir() = %q", got)
 	}
 }
+
+func TestDirectoryActionRecursivePermissions(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Unix permissions")
+	}
+	dir := t.TempDir()
+	src := filepath.Join(dir, "repo", "ssh")
+	os.MkdirAll(filepath.Join(src, "keys"), 0o755)
+	os.WriteFile(filepath.Join(src, "config"), []byte("Host *"), 0o644)
+	os.WriteFile(filepath.Join(src, "keys", "id"), []byte("key"), 0o644)
+
+	a := &DirectoryAction{
+		Source:         src,
+		Destination:    filepath.Join(dir, "home") + "/",
+		Direction:      "push",
+		Permissions:    "0600",
+		DirPermissions: "0700",
+	}
+	if err := a.Run(context.Background(), false); err != nil {
+		t.Fatal(err)
+	}
+
+	target := a.ResolvedTarget()
+	for path, want := range map[string]os.FileMode{
+		target:                              0o700,
+		filepath.Join(target, "keys"):       0o700,
+		filepath.Join(target, "config"):     0o600,
+		filepath.Join(target, "keys", "id"): 0o600,
+	} {
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := info.Mode().Perm(); got != want {
+			t.Errorf("%s: mode %04o, want %04o", path, got, want)
+		}
+	}
+	if status := a.PermissionsStatus(); !strings.Contains(status, "✓") {
+		t.Errorf("PermissionsStatus() = %q", status)
+	}
+
+	os.Chmod(filepath.Join(target, "config"), 0o644)
+	if status := a.PermissionsStatus(); !strings.Contains(status, "1 of 4 entries differ") {
+		t.Errorf("PermissionsStatus() = %q", status)
+	}
+}
+
+func TestDirectoryActionInvalidPermissions(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "repo", "conf")
+	os.MkdirAll(src, 0o755)
+	a := &DirectoryAction{
+		Source:         src,
+		Destination:    filepath.Join(dir, "sys") + "/",
+		DirPermissions: "rwx",
+	}
+	if err := a.Run(context.Background(), false); err == nil {
+		t.Fatal("expected error for invalid dir_permissions")
+	}
+	if _, err := os.Stat(a.ResolvedTarget()); !os.IsNotExist(err) {
+		t.Error("nothing should be copied when the mode is invalid")
+	}
+}
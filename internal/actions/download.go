@@ -0,0 +1,174 @@
+package actions
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/atomikpanda/dotular/internal/httpclient"
+)
+
+// downloadCacheDir returns the directory binary and remote-script downloads
+// are cached in. It is a variable so tests can redirect it.
+var downloadCacheDir = func() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("resolve home dir: %w", err)
+	}
+	return filepath.Join(home, ".cache", "dotular", "downloads"), nil
+}
+
+// downloadMeta is stored next to each cached download. Its validators make
+// revalidation and resuming possible.
+type downloadMeta struct {
+	URL          string `json:"url"`
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"last_modified,omitempty"`
+}
+
+// validator returns the value for an If-Range header, preferring the ETag.
+func (m downloadMeta) validator() string {
+	if m.ETag != "" {
+		return m.ETag
+	}
+	return m.LastModified
+}
+
+// fetch downloads url into the download cache and returns the path of the
+// cached copy, which callers must not modify.
+//
+// A complete cached copy is revalidated with If-None-Match and
+// If-Modified-Since and reused when the server answers 304 Not Modified. An
+// interrupted download is kept as a .part file and resumed with a Range
+// request on the next attempt, provided the server sent a validator that
+// can be checked with If-Range.
+func fetch(ctx context.Context, url string) (string, error) {
+	dir, err := downloadCacheDir()
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", fmt.Errorf("create download cache: %w", err)
+	}
+	sum := sha256.Sum256([]byte(url))
+	base := filepath.Join(dir, hex.EncodeToString(sum[:16]))
+	dataPath, partPath, metaPath := base, base+".part", base+".json"
+	meta := readDownloadMeta(metaPath, url)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return "", err
+	}
+	var offset int64
+	cached := fileExists(dataPath)
+	switch {
+	case refetchFrom(ctx):
+		// Download from scratch.
+	case cached:
+		if meta.ETag != "" {
+			req.Header.Set("If-None-Match", meta.ETag)
+		}
+		if meta.LastModified != "" {
+			req.Header.Set("If-Modified-Since", meta.LastModified)
+		}
+	case meta.validator() != "":
+		if info, err := os.Stat(partPath); err == nil && info.Size() > 0 {
+			offset = info.Size()
+			req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+			req.Header.Set("If-Range", meta.validator())
+		}
+	}
+
+	resp, err := httpclient.Client().Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var out *os.File
+	switch {
+	case resp.StatusCode == http.StatusNotModified && cached:
+		return dataPath, nil
+	case resp.StatusCode == http.StatusPartialContent && offset > 0:
+		out, err = os.OpenFile(partPath, os.O_WRONLY|os.O_APPEND, 0o644)
+	case resp.StatusCode == http.StatusRequestedRangeNotSatisfiable && offset > 0:
+		// The partial file no longer lines up with the resource; start over.
+		resp.Body.Close()
+		os.Remove(partPath)
+		return fetch(ctx, url)
+	case resp.StatusCode == http.StatusOK:
+		// A new version replaces the cached copy, and the metadata now
+		// describes the partial download until it completes.
+		offset = 0
+		os.Remove(dataPath)
+		meta = downloadMeta{URL: url, ETag: resp.Header.Get("ETag"), LastModified: resp.Header.Get("Last-Modified")}
+		if err := writeDownloadMeta(metaPath, meta); err != nil {
+			return "", err
+		}
+		out, err = os.Create(partPath)
+	default:
+		return "", fmt.Errorf("HTTP %d", resp.StatusCode)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	total := resp.ContentLength
+	if total >= 0 {
+		total += offset
+	}
+	_, err = io.Copy(out, progressReaderFrom(ctx, resp.Body, offset, total))
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		// Keep the partial file so the next attempt can resume it.
+		return "", err
+	}
+	if err := os.Rename(partPath, dataPath); err != nil {
+		return "", err
+	}
+	return dataPath, nil
+}
+
+// Refresh downloads url again without revalidating the cached copy, replaces
+// the cached copy with it, and returns the hex SHA-256 of the content.
+func Refresh(ctx context.Context, url string) (string, error) {
+	path, err := fetch(WithRefetch(ctx), url)
+	if err != nil {
+		return "", fmt.Errorf("download %s: %w", url, err)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func readDownloadMeta(path, url string) downloadMeta {
+	var meta downloadMeta
+	data, err := os.ReadFile(path)
+	if err != nil || json.Unmarshal(data, &meta) != nil || meta.URL != url {
+		return downloadMeta{URL: url}
+	}
+	return meta
+}
+
+func writeDownloadMeta(path string, meta downloadMeta) error {
+	data, err := json.Marshal(meta)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0o644)
+}
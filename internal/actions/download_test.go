@@ -0,0 +1,229 @@
+package actions
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMain(m *testing.M) {
+	// Keep downloads made by tests out of the real cache.
+	dir, err := os.MkdirTemp("", "dotular-downloads-*")
+	if err != nil {
+		panic(err)
+	}
+	downloadCacheDir = func() (string, error) { return dir, nil }
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// useDownloadCache points the download cache at a fresh directory for one test.
+func useDownloadCache(t *testing.T) {
+	t.Helper()
+	dir := t.TempDir()
+	orig := downloadCacheDir
+	downloadCacheDir = func() (string, error) { return dir, nil }
+	t.Cleanup(func() { downloadCacheDir = orig })
+}
+
+// contentServer serves body with an ETag, recording the status of each
+// response and the Range header of each request.
+type contentServer struct {
+	mu       sync.Mutex
+	body     []byte
+	etag     string
+	statuses []int
+	ranges   []string
+}
+
+func (s *contentServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	body, etag := s.body, s.etag
+	s.ranges = append(s.ranges, r.Header.Get("Range"))
+	s.mu.Unlock()
+
+	rec := &statusRecorder{ResponseWriter: w}
+	w.Header().Set("ETag", etag)
+	http.ServeContent(rec, r, "", time.Time{}, bytes.NewReader(body))
+
+	s.mu.Lock()
+	s.statuses = append(s.statuses, rec.status)
+	s.mu.Unlock()
+}
+
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(code int) {
+	r.status = code
+	r.ResponseWriter.WriteHeader(code)
+}
+
+func (r *statusRecorder) Write(p []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	return r.ResponseWriter.Write(p)
+}
+
+func TestFetchRevalidatesWithETag(t *testing.T) {
+	useDownloadCache(t)
+	cs := &contentServer{body: []byte("binary v1"), etag: `"v1"`}
+	srv := httptest.NewServer(cs)
+	defer srv.Close()
+
+	for i := 0; i < 2; i++ {
+		path, err := fetch(context.Background(), srv.URL+"/tool")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if data, _ := os.ReadFile(path); string(data) != "binary v1" {
+			t.Fatalf("cached content = %q", data)
+		}
+	}
+	if len(cs.statuses) != 2 || cs.statuses[1] != http.StatusNotModified {
+		t.Errorf("statuses = %v, want the second request answered 304", cs.statuses)
+	}
+
+	// A new version on the server replaces the cached copy.
+	cs.mu.Lock()
+	cs.body, cs.etag = []byte("binary v2"), `"v2"`
+	cs.mu.Unlock()
+	path, err := fetch(context.Background(), srv.URL+"/tool")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(path); string(data) != "binary v2" {
+		t.Errorf("content after update = %q", data)
+	}
+}
+
+func TestFetchRefetch(t *testing.T) {
+	useDownloadCache(t)
+	cs := &contentServer{body: []byte("data"), etag: `"x"`}
+	srv := httptest.NewServer(cs)
+	defer srv.Close()
+
+	if _, err := fetch(context.Background(), srv.URL); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fetch(WithRefetch(context.Background()), srv.URL); err != nil {
+		t.Fatal(err)
+	}
+	if cs.statuses[1] != http.StatusOK {
+		t.Errorf("statuses = %v, want a full download with WithRefetch", cs.statuses)
+	}
+}
+
+func TestRefresh(t *testing.T) {
+	useDownloadCache(t)
+	cs := &contentServer{body: []byte("v1"), etag: `"v1"`}
+	srv := httptest.NewServer(cs)
+	defer srv.Close()
+
+	sum, err := Refresh(context.Background(), srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := fmt.Sprintf("%x", sha256.Sum256([]byte("v1"))); sum != want {
+		t.Errorf("sum = %s, want %s", sum, want)
+	}
+
+	// The server still sends the old ETag, so only a refetch sees v2.
+	cs.mu.Lock()
+	cs.body = []byte("v2")
+	cs.mu.Unlock()
+	sum, err = Refresh(context.Background(), srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := fmt.Sprintf("%x", sha256.Sum256([]byte("v2"))); sum != want {
+		t.Errorf("sum after update = %s, want %s", sum, want)
+	}
+}
+
+func TestFetchResumesPartialDownload(t *testing.T) {
+	useDownloadCache(t)
+	body := []byte(strings.Repeat("0123456789", 100))
+	cs := &contentServer{body: body, etag: `"big"`}
+	srv := httptest.NewServer(cs)
+	defer srv.Close()
+	url := srv.URL + "/big.tar.gz"
+
+	// Simulate an interrupted first attempt: a partial file and its metadata.
+	path, err := fetch(context.Background(), url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.Remove(path)
+	if err := os.WriteFile(path+".part", body[:400], 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	var progress []int64
+	ctx := WithProgress(context.Background(), func(done, total int64) {
+		progress = append(progress, done)
+	})
+	path, err = fetch(ctx, url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(path); !bytes.Equal(data, body) {
+		t.Fatalf("resumed content has %d bytes, want %d", len(data), len(body))
+	}
+	if got := cs.ranges[len(cs.ranges)-1]; got != "bytes=400-" {
+		t.Errorf("Range = %q, want bytes=400-", got)
+	}
+	if got := cs.statuses[len(cs.statuses)-1]; got != http.StatusPartialContent {
+		t.Errorf("status = %d, want 206", got)
+	}
+	if len(progress) == 0 || progress[len(progress)-1] != int64(len(body)) {
+		t.Errorf("progress = %v, want it to end at %d", progress, len(body))
+	}
+}
+
+func TestFetchRestartsWhenResourceChanged(t *testing.T) {
+	useDownloadCache(t)
+	cs := &contentServer{body: []byte("old content"), etag: `"old"`}
+	srv := httptest.NewServer(cs)
+	defer srv.Close()
+
+	path, err := fetch(context.Background(), srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.Remove(path)
+	os.WriteFile(path+".part", []byte("old"), 0o644)
+
+	// If-Range no longer matches, so the server sends the whole new file.
+	cs.mu.Lock()
+	cs.body, cs.etag = []byte("new content"), `"new"`
+	cs.mu.Unlock()
+	path, err = fetch(context.Background(), srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(path); string(data) != "new content" {
+		t.Errorf("content = %q", data)
+	}
+}
+
+func TestFetchHTTPError(t *testing.T) {
+	useDownloadCache(t)
+	srv := httptest.NewServer(http.NotFoundHandler())
+	defer srv.Close()
+	if _, err := fetch(context.Background(), srv.URL); err == nil || !strings.Contains(err.Error(), "404") {
+		t.Errorf("err = %v, want HTTP 404", err)
+	}
+}
@@ -0,0 +1,120 @@
+package actions
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// editorCLIs maps the supported editors to their command-line tools.
+var editorCLIs = map[string]string{
+	"vscode":   "code",
+	"vscodium": "codium",
+	"cursor":   "cursor",
+}
+
+// ExtensionAction installs editor extensions with the editor's CLI, e.g.
+// `code --install-extension`. With Pull it instead reads the installed
+// extensions and hands them to Capture, which records them in the config.
+//
+// Idempotency: ExtensionAction implements Idempotent by comparing the
+// extensions against `--list-extensions`: all of them installed when
+// pushing, exactly the installed set when pulling.
+type ExtensionAction struct {
+	Extensions []string
+	Editor     string // vscode | vscodium | cursor
+	Pull       bool
+	Capture    func(ctx context.Context, extensions []string, dryRun bool) error
+}
+
+func (a *ExtensionAction) Describe() string {
+	if a.Pull {
+		return fmt.Sprintf("capture %s extensions", a.Editor)
+	}
+	return fmt.Sprintf("install %s extensions %s", a.Editor, strings.Join(a.Extensions, ", "))
+}
+
+// cli returns the editor's command-line tool.
+func (a *ExtensionAction) cli() (string, error) {
+	cli, ok := editorCLIs[a.Editor]
+	if !ok {
+		return "", fmt.Errorf("unknown editor %q (want vscode, vscodium, or cursor)", a.Editor)
+	}
+	return cli, nil
+}
+
+// installed returns the lower-cased IDs of the installed extensions, sorted.
+func (a *ExtensionAction) installed(ctx context.Context) ([]string, error) {
+	cli, err := a.cli()
+	if err != nil {
+		return nil, err
+	}
+	out, err := quietOutput(ctx, cli, "--list-extensions")
+	if err != nil {
+		return nil, fmt.Errorf("%s --list-extensions: %w", cli, err)
+	}
+	return normalizeExtensions(strings.Fields(out)), nil
+}
+
+func (a *ExtensionAction) Run(ctx context.Context, dryRun bool) error {
+	cli, err := a.cli()
+	if err != nil {
+		return err
+	}
+	if a.Pull {
+		current, err := a.installed(ctx)
+		if err != nil {
+			return err
+		}
+		return a.Capture(ctx, current, dryRun)
+	}
+
+	current, _ := a.installed(ctx) // the editor may not have run yet
+	for _, ext := range a.Extensions {
+		if slices.Contains(current, strings.ToLower(ext)) {
+			continue
+		}
+		if dryRun {
+			reportDryRun(ctx, "%s --install-extension %s", cli, ext)
+			continue
+		}
+		if err := command(ctx, cli, "--install-extension", ext).Run(); err != nil {
+			return fmt.Errorf("install extension %s: %w", ext, err)
+		}
+	}
+	return nil
+}
+
+// IsApplied reports whether every extension is installed or, when pulling,
+// whether the configured list already matches the installed one.
+func (a *ExtensionAction) IsApplied(ctx context.Context) (bool, error) {
+	current, err := a.installed(ctx)
+	if err != nil {
+		return false, nil
+	}
+	want := normalizeExtensions(a.Extensions)
+	if a.Pull {
+		return slices.Equal(current, want), nil
+	}
+	for _, ext := range want {
+		if !slices.Contains(current, ext) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// normalizeExtensions lower-cases extension IDs, which editors treat
+// case-insensitively, and sorts them.
+func normalizeExtensions(exts []string) []string {
+	out := make([]string, 0, len(exts))
+	for _, ext := range exts {
+		if ext = strings.ToLower(strings.TrimSpace(ext)); ext != "" && !slices.Contains(out, ext) {
+			out = append(out, ext)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
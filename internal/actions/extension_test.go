@@ -0,0 +1,82 @@
+package actions
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// fakeCode puts a code stand-in on PATH that lists installed and records
+// the extensions it is asked to install.
+func fakeCode(t *testing.T, installed ...string) (calls func() string) {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("uses a shell script")
+	}
+	dir := t.TempDir()
+	log := filepath.Join(dir, "calls")
+	script := `#!/bin/sh
+case "$1" in
+--list-extensions) printf '` + strings.Join(installed, `\n`) + `\n' ;;
+*) echo "$@" >> "` + log + `" ;;
+esac
+`
+	if err := os.WriteFile(filepath.Join(dir, "code"), []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	return func() string {
+		data, _ := os.ReadFile(log)
+		return strings.TrimSpace(string(data))
+	}
+}
+
+func TestExtensionActionPush(t *testing.T) {
+	calls := fakeCode(t, "golang.Go", "esbenp.prettier-vscode")
+	ctx := context.Background()
+
+	a := &ExtensionAction{Extensions: []string{"golang.go", "rust-lang.rust-analyzer"}, Editor: "vscode"}
+	if ok, _ := a.IsApplied(ctx); ok {
+		t.Error("reported applied with an extension missing")
+	}
+	if err := a.Run(ctx, false); err != nil {
+		t.Fatal(err)
+	}
+	if got := calls(); got != "--install-extension rust-lang.rust-analyzer" {
+		t.Errorf("calls = %q, want only the missing extension installed", got)
+	}
+
+	a.Extensions = []string{"GoLang.go"}
+	if ok, _ := a.IsApplied(ctx); !ok {
+		t.Error("extension IDs should match case-insensitively")
+	}
+}
+
+func TestExtensionActionPull(t *testing.T) {
+	fakeCode(t, "golang.Go", "esbenp.prettier-vscode")
+	ctx := context.Background()
+
+	var captured []string
+	a := &ExtensionAction{Extensions: []string{"golang.go"}, Editor: "vscode", Pull: true,
+		Capture: func(_ context.Context, exts []string, _ bool) error { captured = exts; return nil }}
+	if ok, _ := a.IsApplied(ctx); ok {
+		t.Error("pull reported applied while the lists differ")
+	}
+	if err := a.Run(ctx, false); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"esbenp.prettier-vscode", "golang.go"}; !slices.Equal(captured, want) {
+		t.Errorf("captured %v, want %v", captured, want)
+	}
+}
+
+func TestExtensionActionUnknownEditor(t *testing.T) {
+	a := &ExtensionAction{Extensions: []string{"golang.go"}, Editor: "emacs"}
+	if err := a.Run(context.Background(), true); err == nil {
+		t.Error("expected an error for an unknown editor")
+	}
+}
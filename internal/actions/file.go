@@ -1,9 +1,9 @@
 package actions
 
 import (
-	"bufio"
 	"bytes"
 	"context"
+	"crypto/sha256"
 	"fmt"
 	"io"
 	"os"
@@ -12,7 +12,8 @@ import (
 	"strings"
 
 	"github.com/atomikpanda/dotular/internal/ageutil"
-	"github.com/atomikpanda/dotular/internal/color"
+	"github.com/atomikpanda/dotular/internal/diff"
+	"github.com/atomikpanda/dotular/internal/errs"
 	"github.com/atomikpanda/dotular/internal/platform"
 )
 
@@ -27,7 +28,12 @@ import (
 //
 // Permissions: when Permissions is non-empty (Unix octal, e.g. "0600"), the
 // mode is enforced on the destination file after every write. On apply, if
-// the existing file's mode does not match, it is corrected.
+// the existing file's mode does not match, it is corrected. On Windows the
+// mode maps to the read-only attribute and an owner-only ACL (see setMode).
+//
+// Ownership: when Owner or Group is set (Unix only), the destination file is
+// chowned after every write to the system. Changing the owner requires root;
+// this is checked before anything is written.
 //
 // Encryption: when Encrypted is true and AgeKey is set, files are stored in
 // the repo with an ".age" extension. On push the repo file is decrypted to the
@@ -38,8 +44,20 @@ type FileAction struct {
 	Direction   string // "push" | "pull" | "sync"
 	Link        bool
 	Permissions string       // Unix octal string, e.g. "0600"
+	Owner       string       // user name or uid (Unix only)
+	Group       string       // group name or gid (Unix only)
 	Encrypted   bool
 	AgeKey      *ageutil.Key // required when Encrypted is true
+
+	contentHash string // sha256 of the destination, when the last Run read it whole
+}
+
+// ContentHash returns the hex sha256 of the destination's content as the
+// last Run found it in sync, in the format of state.HashFile, so the state
+// file can record it without reading the file again. It is "" when Run did
+// not compare the whole file, such as after a copy.
+func (a *FileAction) ContentHash() string {
+	return a.contentHash
 }
 
 // resolvedTarget returns the fully expanded destination file path.
@@ -59,6 +77,15 @@ func (a *FileAction) ResolvedTarget() string {
 	return filepath.Join(expanded, filepath.Base(a.Source))
 }
 
+// RepoPath returns the repo-side path of the file as stored, including the
+// ".age" extension for encrypted items.
+func (a *FileAction) RepoPath() string {
+	if a.Encrypted {
+		return ageutil.RepoPath(a.Source)
+	}
+	return a.Source
+}
+
 // resolvedDir returns the parent directory of the resolved target.
 func (a *FileAction) ResolvedDir() string {
 	return filepath.Dir(a.ResolvedTarget())
@@ -98,11 +125,24 @@ func (a *FileAction) PermissionsStatus() string {
 	if err != nil {
 		return fmt.Sprintf("[permissions: invalid %q]", a.Permissions)
 	}
-	actual := info.Mode().Perm()
-	if actual == mode {
+	ok, actual := modeState(dest, info, mode)
+	if ok {
 		return fmt.Sprintf("[permissions: %s ✓]", a.Permissions)
 	}
-	return fmt.Sprintf("[permissions: want %s, got %04o ⚠]", a.Permissions, actual)
+	return fmt.Sprintf("[permissions: want %s, got %s ⚠]", a.Permissions, actual)
+}
+
+// OwnershipStatus returns a human-readable owner/group annotation for use in
+// status output, or "" when not applicable.
+func (a *FileAction) OwnershipStatus() string {
+	if a.Link || (a.Owner == "" && a.Group == "") {
+		return ""
+	}
+	own, err := resolveOwnership(a.Owner, a.Group)
+	if err != nil {
+		return fmt.Sprintf("[owner: %v]", err)
+	}
+	return own.status(a.ResolvedTarget())
 }
 
 // IsApplied implements Idempotent for link items.
@@ -129,9 +169,12 @@ func (a *FileAction) Run(ctx context.Context, dryRun bool) error {
 	dest := a.ResolvedDir()
 
 	if dryRun {
-		fmt.Printf("    %s\n", color.Dim("[dry-run] "+a.Describe()))
+		reportDryRun(ctx, "%s", a.Describe())
 		if ps := a.PermissionsStatus(); ps != "" {
-			fmt.Printf("    %s\n", color.Dim("          "+ps))
+			report(ctx, LevelDetail, KindDryRun, ps)
+		}
+		if ow := a.OwnershipStatus(); ow != "" {
+			report(ctx, LevelDetail, KindDryRun, ow)
 		}
 		return nil
 	}
@@ -143,12 +186,25 @@ func (a *FileAction) Run(ctx context.Context, dryRun bool) error {
 		return createSymlink(a.Source, target)
 	}
 
+	// Pull only writes into the repo, so ownership never applies to it.
+	own := ownership{uid: -1, gid: -1}
+	if a.Direction != "pull" {
+		var err error
+		if own, err = resolveOwnership(a.Owner, a.Group); err != nil {
+			return err
+		}
+		if err := own.checkElevation(); err != nil {
+			return err
+		}
+	}
+
+	a.contentHash = ""
 	var err error
 	switch a.Direction {
 	case "pull":
 		err = a.runPull(target)
 	case "sync":
-		err = a.runSync(target)
+		err = a.runSync(ctx, target)
 	default:
 		err = a.runPush(dest, target)
 	}
@@ -156,7 +212,13 @@ func (a *FileAction) Run(ctx context.Context, dryRun bool) error {
 		return err
 	}
 
-	return a.enforcePermissions(target)
+	if err := a.enforcePermissions(target); err != nil {
+		return err
+	}
+	if !fileExists(target) {
+		return nil
+	}
+	return own.apply(target)
 }
 
 // --- direction implementations -----------------------------------------------
@@ -184,11 +246,8 @@ func (a *FileAction) runPull(target string) error {
 	return copyFile(target, a.Source)
 }
 
-func (a *FileAction) runSync(target string) error {
-	repoPath := a.Source
-	if a.Encrypted {
-		repoPath = ageutil.RepoPath(a.Source)
-	}
+func (a *FileAction) runSync(ctx context.Context, target string) error {
+	repoPath := a.RepoPath()
 
 	repoExists := fileExists(repoPath)
 	sysExists := fileExists(target)
@@ -201,7 +260,7 @@ func (a *FileAction) runSync(target string) error {
 		if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
 			return fmt.Errorf("create destination directory: %w", err)
 		}
-		fmt.Printf("    %s\n", color.Cyan("sync: system copy missing, pushing repo -> system"))
+		report(ctx, LevelInfo, KindSync, "sync: system copy missing, pushing repo -> system")
 		if a.Encrypted {
 			return a.decryptTo(repoPath, target)
 		}
@@ -211,7 +270,7 @@ func (a *FileAction) runSync(target string) error {
 		if err := os.MkdirAll(filepath.Dir(a.Source), 0o755); err != nil {
 			return fmt.Errorf("create repo directory: %w", err)
 		}
-		fmt.Printf("    %s\n", color.Cyan("sync: repo copy missing, pulling system -> repo"))
+		report(ctx, LevelInfo, KindSync, "sync: repo copy missing, pulling system -> repo")
 		if a.Encrypted {
 			return a.encryptFrom(target, repoPath)
 		}
@@ -219,70 +278,184 @@ func (a *FileAction) runSync(target string) error {
 
 	default:
 		// Both exist — compare (decrypt repo copy for comparison if encrypted).
-		equal, err := a.syncEqual(repoPath, target)
+		equal, sum, err := a.syncEqual(repoPath, target)
 		if err != nil {
 			return fmt.Errorf("sync: compare: %w", err)
 		}
 		if equal {
-			fmt.Printf("    %s\n", color.Dim("sync: already in sync"))
+			report(ctx, LevelDetail, KindSync, "sync: already in sync")
+			a.contentHash = sum
 			return nil
 		}
-		return a.resolveConflict(repoPath, target)
+		return a.resolveConflict(ctx, repoPath, target)
 	}
 }
 
-// syncEqual compares the effective plaintext of both sides.
-func (a *FileAction) syncEqual(repoPath, sysPath string) (bool, error) {
+// syncEqual compares the effective plaintext of both sides with
+// compareFiles.
+func (a *FileAction) syncEqual(repoPath, sysPath string) (bool, string, error) {
 	if !a.Encrypted {
-		return filesEqual(repoPath, sysPath)
+		return compareFiles(repoPath, sysPath)
 	}
 	// Decrypt repo side to a temp file for comparison.
 	tmp, err := os.CreateTemp("", "dotular-cmp-*")
 	if err != nil {
-		return false, err
+		return false, "", err
 	}
 	tmpPath := tmp.Name()
 	tmp.Close()
 	defer os.Remove(tmpPath)
 
 	if err := a.decryptTo(repoPath, tmpPath); err != nil {
-		return false, err
+		return false, "", err
 	}
-	return filesEqual(tmpPath, sysPath)
+	return compareFiles(tmpPath, sysPath)
 }
 
-func (a *FileAction) resolveConflict(repoPath, sysPath string) error {
+// conflictChoices are the answers offered at a sync conflict prompt.
+const conflictChoices = `[1] keep repo   (push repo -> system)
+[2] keep system (pull system -> repo)
+[A] repo for all    [S] system for all    [N] newer for all
+[d] diff
+[s] skip`
+
+func (a *FileAction) resolveConflict(ctx context.Context, repoPath, sysPath string) error {
 	name := filepath.Base(a.Source)
-	fmt.Printf("\n    %s\n", color.BoldYellow("CONFLICT: "+name+" differs between repo and system"))
-	fmt.Printf("      [1] keep repo   (push repo -> system)\n")
-	fmt.Printf("      [2] keep system (pull system -> repo)\n")
-	fmt.Printf("      [s] skip\n")
-	fmt.Printf("    %s ", color.Bold(">"))
+	batch := conflictBatchFrom(ctx)
+	report(ctx, LevelWarn, KindConflict, "CONFLICT: "+name+" differs between repo and system")
 
-	choice, err := readLine(os.Stdin)
-	if err != nil {
-		return fmt.Errorf("read conflict choice: %w", err)
+	if choice := batch.choice; choice != "" {
+		report(ctx, LevelInfo, KindResolution, choice+" (chosen for all conflicts)")
+		return a.applyResolution(ctx, choice, repoPath, sysPath, true)
+	}
+
+	for {
+		report(ctx, LevelWarn, KindPrompt, conflictChoices)
+
+		input, err := readLine(os.Stdin)
+		if err != nil {
+			return fmt.Errorf("%w for %s: read choice: %w", errs.ErrConflict, name, err)
+		}
+
+		// Answers are case-sensitive only where it matters: "s" skips one
+		// file, "S" keeps the system copy of every file.
+		switch input = strings.TrimSpace(input); input {
+		case "1":
+			return a.applyResolution(ctx, ResolveRepo, repoPath, sysPath, false)
+		case "2":
+			return a.applyResolution(ctx, ResolveSystem, repoPath, sysPath, false)
+		case "A", "a":
+			batch.choice = ResolveRepo
+			return a.applyResolution(ctx, ResolveRepo, repoPath, sysPath, true)
+		case "S":
+			batch.choice = ResolveSystem
+			return a.applyResolution(ctx, ResolveSystem, repoPath, sysPath, true)
+		case "N", "n":
+			batch.choice = ResolveNewer
+			return a.applyResolution(ctx, ResolveNewer, repoPath, sysPath, true)
+		case "d", "D":
+			if err := a.reportConflictDiff(ctx, repoPath, sysPath); err != nil {
+				report(ctx, LevelWarn, KindDiff, err.Error())
+			}
+		default:
+			return a.applyResolution(ctx, ResolveSkip, repoPath, sysPath, false)
+		}
 	}
+}
 
-	switch strings.ToLower(strings.TrimSpace(choice)) {
-	case "1":
-		fmt.Printf("    %s pushing repo copy to system\n", color.Dim("->"))
+// applyResolution carries out a conflict choice and reports it to the
+// conflict log on ctx. ResolveNewer keeps whichever copy was modified last.
+func (a *FileAction) applyResolution(ctx context.Context, choice, repoPath, sysPath string, forAll bool) error {
+	kept := choice
+	if choice == ResolveNewer {
+		kept = ResolveRepo
+		repoInfo, rerr := os.Stat(repoPath)
+		sysInfo, serr := os.Stat(sysPath)
+		if rerr == nil && serr == nil && sysInfo.ModTime().After(repoInfo.ModTime()) {
+			kept = ResolveSystem
+		}
+	}
+
+	if fn := conflictLogFrom(ctx); fn != nil {
+		detail := kept
+		if choice == ResolveNewer {
+			detail += ", newer"
+		}
+		if forAll {
+			detail += ", for all"
+		}
+		fn(a.ResolvedTarget(), detail)
+	}
+
+	switch kept {
+	case ResolveRepo:
+		report(ctx, LevelInfo, KindResolution, "pushing repo copy to system")
 		if a.Encrypted {
 			return a.decryptTo(repoPath, sysPath)
 		}
 		return copyFile(repoPath, sysPath)
-	case "2":
-		fmt.Printf("    %s pulling system copy to repo\n", color.Dim("->"))
+	case ResolveSystem:
+		report(ctx, LevelInfo, KindResolution, "pulling system copy to repo")
 		if a.Encrypted {
 			return a.encryptFrom(sysPath, repoPath)
 		}
 		return copyFile(sysPath, a.Source)
 	default:
-		fmt.Printf("    %s\n", color.Dim("-> skipped"))
+		report(ctx, LevelInfo, KindResolution, "skipped")
 		return nil
 	}
 }
 
+// reportConflictDiff reports a unified diff from the repo copy to the system
+// copy, decrypting the repo side first when the item is encrypted.
+func (a *FileAction) reportConflictDiff(ctx context.Context, repoPath, sysPath string) error {
+	repoData, err := a.plaintext(repoPath)
+	if err != nil {
+		return err
+	}
+	sysData, err := os.ReadFile(sysPath)
+	if err != nil {
+		return err
+	}
+	if bytes.IndexByte(repoData, 0) >= 0 || bytes.IndexByte(sysData, 0) >= 0 {
+		report(ctx, LevelDetail, KindDiff, "binary files differ")
+		return nil
+	}
+	report(ctx, LevelInfo, KindDiff, diff.Unified("repo: "+a.Source, "system: "+sysPath, string(repoData), string(sysData), 3))
+	return nil
+}
+
+// PlaintextHash returns the hex sha256 of the repo file's plaintext,
+// decrypting it first when the item is encrypted. The format matches
+// state.HashFile.
+func (a *FileAction) PlaintextHash() (string, error) {
+	data, err := a.plaintext(a.RepoPath())
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%x", sha256.Sum256(data)), nil
+}
+
+// plaintext returns the content of the repo file at repoPath, decrypted when
+// the item is encrypted.
+func (a *FileAction) plaintext(repoPath string) ([]byte, error) {
+	if !a.Encrypted {
+		return os.ReadFile(repoPath)
+	}
+	tmp, err := os.CreateTemp("", "dotular-diff-*")
+	if err != nil {
+		return nil, err
+	}
+	tmpPath := tmp.Name()
+	tmp.Close()
+	defer os.Remove(tmpPath)
+
+	if err := a.decryptTo(repoPath, tmpPath); err != nil {
+		return nil, err
+	}
+	return os.ReadFile(tmpPath)
+}
+
 // --- permissions -------------------------------------------------------------
 
 func (a *FileAction) enforcePermissions(target string) error {
@@ -297,12 +470,7 @@ func (a *FileAction) enforcePermissions(target string) error {
 	if err != nil {
 		return nil // file may not exist yet (e.g. pull with no system file)
 	}
-	if info.Mode().Perm() != mode {
-		if err := os.Chmod(target, mode); err != nil {
-			return fmt.Errorf("chmod %s to %s: %w", target, a.Permissions, err)
-		}
-	}
-	return nil
+	return setMode(target, info, mode)
 }
 
 func parseMode(s string) (os.FileMode, error) {
@@ -319,14 +487,18 @@ func (a *FileAction) decryptTo(src, dst string) error {
 	if a.AgeKey == nil {
 		return fmt.Errorf("encrypted file %s requires an age key (set age.identity or age.passphrase in dotular.yaml)", src)
 	}
-	return a.AgeKey.DecryptFile(src, dst)
+	return replaceFile(dst, 0o600, func(tmp string) error {
+		return a.AgeKey.DecryptFile(src, tmp)
+	})
 }
 
 func (a *FileAction) encryptFrom(src, dst string) error {
 	if a.AgeKey == nil {
 		return fmt.Errorf("encrypted file %s requires an age key (set age.identity or age.passphrase in dotular.yaml)", src)
 	}
-	return a.AgeKey.EncryptFile(src, dst)
+	return replaceFile(dst, 0o600, func(tmp string) error {
+		return a.AgeKey.EncryptFile(src, tmp)
+	})
 }
 
 // --- helpers -----------------------------------------------------------------
@@ -344,6 +516,7 @@ func createSymlink(src, dst string) error {
 	return os.Symlink(abs, dst)
 }
 
+// copyFile copies src over dst with replaceFile. A new dst gets mode 0644.
 func copyFile(src, dst string) error {
 	in, err := os.Open(src)
 	if err != nil {
@@ -351,28 +524,130 @@ func copyFile(src, dst string) error {
 	}
 	defer in.Close()
 
-	out, err := os.Create(dst)
+	return replaceFile(dst, 0o644, func(tmp string) error {
+		out, err := os.Create(tmp)
+		if err != nil {
+			return fmt.Errorf("create destination: %w", err)
+		}
+		defer out.Close()
+
+		if _, err := io.Copy(out, in); err != nil {
+			return fmt.Errorf("copy contents: %w", err)
+		}
+		return out.Close()
+	})
+}
+
+// replaceFile has write fill a temporary file beside dst, flushes it to
+// disk, and renames it over dst, so that a crash or a full disk leaves
+// either the old dst or the new one, never a truncated file. When dst is a
+// symlink the file it points to is replaced instead. The new file keeps the
+// mode of the file it replaces, or gets perm.
+func replaceFile(dst string, perm os.FileMode, write func(tmp string) error) error {
+	if info, err := os.Lstat(dst); err == nil && info.Mode()&os.ModeSymlink != 0 {
+		if resolved, err := filepath.EvalSymlinks(dst); err == nil {
+			dst = resolved
+		}
+	}
+	if info, err := os.Stat(dst); err == nil {
+		perm = info.Mode().Perm()
+	}
+
+	f, err := os.CreateTemp(filepath.Dir(dst), "."+filepath.Base(dst)+".dotular-*")
 	if err != nil {
 		return fmt.Errorf("create destination: %w", err)
 	}
-	defer out.Close()
+	tmp := f.Name()
+	f.Close()
+	defer os.Remove(tmp) // no-op once renamed
 
-	if _, err := io.Copy(out, in); err != nil {
-		return fmt.Errorf("copy contents: %w", err)
+	if err := write(tmp); err != nil {
+		return err
+	}
+	if err := syncFile(tmp); err != nil {
+		return fmt.Errorf("flush %s: %w", dst, err)
+	}
+	if err := os.Chmod(tmp, perm); err != nil {
+		return err
 	}
-	return out.Close()
+	if err := os.Rename(tmp, dst); err != nil {
+		return fmt.Errorf("replace %s: %w", dst, err)
+	}
+	return nil
+}
+
+// syncFile flushes the contents of path to disk.
+func syncFile(path string) error {
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
 }
 
+// filesEqual reports whether the files at a and b have the same content.
 func filesEqual(a, b string) (bool, error) {
-	aData, err := os.ReadFile(a)
+	equal, _, err := compareFiles(a, b)
+	return equal, err
+}
+
+// compareChunk is how much of each file compareFiles holds in memory.
+const compareChunk = 64 << 10
+
+// compareFiles reports whether the files at a and b have the same content,
+// reading both a chunk at a time and stopping at the first difference.
+// Files of different sizes are not read at all. When they are equal it also
+// returns the hex sha256 of the content, in the format of state.HashFile.
+func compareFiles(a, b string) (bool, string, error) {
+	ia, err := os.Stat(a)
+	if err != nil {
+		return false, "", err
+	}
+	ib, err := os.Stat(b)
 	if err != nil {
-		return false, err
+		return false, "", err
 	}
-	bData, err := os.ReadFile(b)
+	if ia.Size() != ib.Size() {
+		return false, "", nil
+	}
+
+	fa, err := os.Open(a)
+	if err != nil {
+		return false, "", err
+	}
+	defer fa.Close()
+	fb, err := os.Open(b)
 	if err != nil {
-		return false, err
+		return false, "", err
+	}
+	defer fb.Close()
+
+	h := sha256.New()
+	bufA, bufB := make([]byte, compareChunk), make([]byte, compareChunk)
+	for {
+		na, errA := io.ReadFull(fa, bufA)
+		nb, errB := io.ReadFull(fb, bufB)
+		if !bytes.Equal(bufA[:na], bufB[:nb]) {
+			return false, "", nil
+		}
+		h.Write(bufA[:na])
+		endA := errA == io.EOF || errA == io.ErrUnexpectedEOF
+		endB := errB == io.EOF || errB == io.ErrUnexpectedEOF
+		switch {
+		case endA && endB:
+			return true, fmt.Sprintf("%x", h.Sum(nil)), nil
+		case endA || endB:
+			return false, "", nil // one grew or shrank while being read
+		case errA != nil:
+			return false, "", errA
+		case errB != nil:
+			return false, "", errB
+		}
 	}
-	return bytes.Equal(aData, bData), nil
 }
 
 func fileExists(path string) bool {
@@ -380,13 +655,27 @@ func fileExists(path string) bool {
 	return err == nil
 }
 
+// readLine reads one line from r a byte at a time, so that repeated prompts
+// on the same reader never consume input meant for the next one.
 func readLine(r io.Reader) (string, error) {
-	scanner := bufio.NewScanner(r)
-	if scanner.Scan() {
-		return scanner.Text(), nil
-	}
-	if err := scanner.Err(); err != nil {
-		return "", err
+	var line []byte
+	buf := make([]byte, 1)
+	for empty := 0; empty < 100; {
+		n, err := r.Read(buf)
+		if n > 0 {
+			if buf[0] == '\n' {
+				return strings.TrimSuffix(string(line), "\r"), nil
+			}
+			line = append(line, buf[0])
+		} else {
+			empty++
+		}
+		if err == io.EOF {
+			return string(line), nil
+		}
+		if err != nil {
+			return "", err
+		}
 	}
-	return "", nil
+	return string(line), nil
 }
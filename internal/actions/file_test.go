@@ -2,9 +2,15 @@ package actions
 
 import (
 	"context"
+	"crypto/sha256"
+	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"runtime"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestFileActionResolvedTarget(t *testing.T) {
@@ -116,6 +122,48 @@ func TestCopyFile(t *testing.T) {
 	}
 }
 
+func TestReplaceFile(t *testing.T) {
+	dir := t.TempDir()
+	target := filepath.Join(dir, "zshrc")
+	link := filepath.Join(dir, ".zshrc")
+	os.WriteFile(target, []byte("old"), 0o600)
+	if err := os.Symlink(target, link); err != nil {
+		t.Skip("symlinks not supported:", err)
+	}
+
+	// A failed write leaves the original untouched and no temp file behind.
+	err := replaceFile(link, 0o644, func(tmp string) error {
+		os.WriteFile(tmp, []byte("partial"), 0o644)
+		return io.ErrUnexpectedEOF
+	})
+	if err == nil {
+		t.Fatal("expected the write error")
+	}
+	if data, _ := os.ReadFile(target); string(data) != "old" {
+		t.Errorf("after failed write = %q, want old", data)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 2 {
+		t.Errorf("dir has %d entries, want the temp file removed", len(entries))
+	}
+
+	// A write through the symlink replaces its target and keeps its mode.
+	if err := replaceFile(link, 0o644, func(tmp string) error {
+		return os.WriteFile(tmp, []byte("new"), 0o644)
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if info, err := os.Lstat(link); err != nil || info.Mode()&os.ModeSymlink == 0 {
+		t.Error("symlink was replaced")
+	}
+	info, _ := os.Stat(target)
+	if data, _ := os.ReadFile(target); string(data) != "new" {
+		t.Errorf("target = %q, want new", data)
+	}
+	if runtime.GOOS != "windows" && info.Mode().Perm() != 0o600 {
+		t.Errorf("mode = %04o, want the original 0600", info.Mode().Perm())
+	}
+}
+
 func TestFilesEqual(t *testing.T) {
 	dir := t.TempDir()
 	a := filepath.Join(dir, "a.txt")
@@ -143,6 +191,36 @@ func TestFilesEqual(t *testing.T) {
 	}
 }
 
+func TestCompareFilesChunks(t *testing.T) {
+	dir := t.TempDir()
+	a := filepath.Join(dir, "a")
+	b := filepath.Join(dir, "b")
+	data := make([]byte, 3*compareChunk+17)
+	for i := range data {
+		data[i] = byte(i)
+	}
+	os.WriteFile(a, data, 0o644)
+	os.WriteFile(b, data, 0o644)
+
+	equal, sum, err := compareFiles(a, b)
+	if err != nil || !equal {
+		t.Fatalf("compareFiles = %v, %v; want equal", equal, err)
+	}
+	if want := fmt.Sprintf("%x", sha256.Sum256(data)); sum != want {
+		t.Errorf("sum = %q, want %q", sum, want)
+	}
+
+	data[2*compareChunk+5]++
+	os.WriteFile(b, data, 0o644)
+	if equal, sum, _ := compareFiles(a, b); equal || sum != "" {
+		t.Errorf("compareFiles = %v, %q; want a difference in the third chunk found", equal, sum)
+	}
+	os.WriteFile(b, data[:len(data)-1], 0o644)
+	if equal, _, _ := compareFiles(a, b); equal {
+		t.Error("files of different sizes compared equal")
+	}
+}
+
 func TestFileExists(t *testing.T) {
 	dir := t.TempDir()
 	f := filepath.Join(dir, "exists.txt")
@@ -340,6 +418,9 @@ func TestFileActionRunSyncBothExistEqual(t *testing.T) {
 	if err := a.Run(context.Background(), false); err != nil {
 		t.Fatal(err)
 	}
+	if want := fmt.Sprintf("%x", sha256.Sum256([]byte("same content"))); a.ContentHash() != want {
+		t.Errorf("ContentHash() = %q, want %q", a.ContentHash(), want)
+	}
 }
 
 func TestFileActionRunSyncRepoOnlyPushes(t *testing.T) {
@@ -540,13 +621,16 @@ func TestSyncEqualNonEncrypted(t *testing.T) {
 	os.WriteFile(sysFile, []byte("same"), 0o644)
 
 	a := &FileAction{Source: repoFile, Destination: dir + "/", Direction: "sync"}
-	equal, err := a.syncEqual(repoFile, sysFile)
+	equal, sum, err := a.syncEqual(repoFile, sysFile)
 	if err != nil {
 		t.Fatal(err)
 	}
 	if !equal {
 		t.Error("expected equal")
 	}
+	if want := fmt.Sprintf("%x", sha256.Sum256([]byte("same"))); sum != want {
+		t.Errorf("sum = %q, want %q", sum, want)
+	}
 }
 
 func TestSyncEqualNonEncryptedDifferent(t *testing.T) {
@@ -557,7 +641,7 @@ func TestSyncEqualNonEncryptedDifferent(t *testing.T) {
 	os.WriteFile(sysFile, []byte("system"), 0o644)
 
 	a := &FileAction{Source: repoFile, Destination: dir + "/", Direction: "sync"}
-	equal, err := a.syncEqual(repoFile, sysFile)
+	equal, _, err := a.syncEqual(repoFile, sysFile)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -622,7 +706,7 @@ func TestFileActionEncryptedSyncNoKey(t *testing.T) {
 		AgeKey:      nil,
 	}
 	// syncEqual for encrypted files will try to decrypt — should fail with no key.
-	_, err := a.syncEqual(repoFile, sysFile)
+	_, _, err := a.syncEqual(repoFile, sysFile)
 	if err == nil {
 		t.Error("expected error for encrypted sync with no key")
 	}
@@ -696,6 +780,137 @@ func TestFileActionRunSyncConflictChoice2(t *testing.T) {
 	}
 }
 
+func TestFileActionRunSyncConflictDiffThenChoose(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "repo", "test.txt")
+	destDir := filepath.Join(dir, "system")
+	os.MkdirAll(filepath.Join(dir, "repo"), 0o755)
+	os.MkdirAll(destDir, 0o755)
+	os.WriteFile(src, []byte("shared\nrepo version\n"), 0o644)
+	destFile := filepath.Join(destDir, "test.txt")
+	os.WriteFile(destFile, []byte("shared\nsystem version\n"), 0o644)
+
+	a := &FileAction{
+		Source:      src,
+		Destination: destDir + "/",
+		Direction:   "sync",
+	}
+
+	// Ask for the diff first, then keep the repo copy.
+	oldStdin, oldStdout := os.Stdin, os.Stdout
+	r, w, _ := os.Pipe()
+	w.Write([]byte("d\n1\n"))
+	w.Close()
+	outR, outW, _ := os.Pipe()
+	os.Stdin, os.Stdout = r, outW
+	defer func() { os.Stdin, os.Stdout = oldStdin, oldStdout }()
+
+	err := a.Run(context.Background(), false)
+	outW.Close()
+	os.Stdout = oldStdout
+	out, _ := io.ReadAll(outR)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !strings.Contains(string(out), "-repo version") || !strings.Contains(string(out), "+system version") {
+		t.Errorf("expected a diff in the prompt output, got:\n%s", out)
+	}
+	data, _ := os.ReadFile(destFile)
+	if string(data) != "shared\nrepo version\n" {
+		t.Errorf("expected repo version pushed after the diff, got %q", string(data))
+	}
+}
+
+// conflictFixture returns a sync FileAction whose repo and system copies
+// differ.
+func conflictFixture(t *testing.T, name string) (a *FileAction, repoFile, sysFile string) {
+	t.Helper()
+	dir := t.TempDir()
+	repoFile = filepath.Join(dir, "repo", name)
+	destDir := filepath.Join(dir, "system")
+	os.MkdirAll(filepath.Join(dir, "repo"), 0o755)
+	os.MkdirAll(destDir, 0o755)
+	os.WriteFile(repoFile, []byte("repo version"), 0o644)
+	sysFile = filepath.Join(destDir, name)
+	os.WriteFile(sysFile, []byte("system version"), 0o644)
+	return &FileAction{Source: repoFile, Destination: destDir + "/", Direction: "sync"}, repoFile, sysFile
+}
+
+func TestFileActionRunSyncConflictForAll(t *testing.T) {
+	first, firstRepo, _ := conflictFixture(t, "a.txt")
+	second, secondRepo, _ := conflictFixture(t, "b.txt")
+
+	var logged []string
+	ctx := WithConflictBatch(context.Background(), &ConflictBatch{})
+	ctx = WithConflictLog(ctx, func(path, resolution string) {
+		logged = append(logged, filepath.Base(path)+": "+resolution)
+	})
+
+	// Only one answer is available: the second conflict must not prompt.
+	oldStdin := os.Stdin
+	r, w, _ := os.Pipe()
+	w.Write([]byte("S\n"))
+	w.Close()
+	os.Stdin = r
+	defer func() { os.Stdin = oldStdin }()
+
+	for _, a := range []*FileAction{first, second} {
+		if err := a.Run(ctx, false); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	for _, repo := range []string{firstRepo, secondRepo} {
+		if data, _ := os.ReadFile(repo); string(data) != "system version" {
+			t.Errorf("%s: expected system version pulled, got %q", filepath.Base(repo), data)
+		}
+	}
+	want := []string{"a.txt: keep system, for all", "b.txt: keep system, for all"}
+	if strings.Join(logged, "|") != strings.Join(want, "|") {
+		t.Errorf("logged = %q, want %q", logged, want)
+	}
+}
+
+func TestFileActionRunSyncConflictNewer(t *testing.T) {
+	a, repoFile, _ := conflictFixture(t, "a.txt")
+	old := time.Now().Add(-time.Hour)
+	os.Chtimes(repoFile, old, old)
+
+	ctx := WithConflictBatch(context.Background(), &ConflictBatch{})
+	oldStdin := os.Stdin
+	r, w, _ := os.Pipe()
+	w.Write([]byte("N\n"))
+	w.Close()
+	os.Stdin = r
+	defer func() { os.Stdin = oldStdin }()
+
+	if err := a.Run(ctx, false); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if data, _ := os.ReadFile(repoFile); string(data) != "system version" {
+		t.Errorf("newer system copy should win, repo has %q", data)
+	}
+
+	// The batch now resolves by age without prompting: make the repo newer.
+	b, _, sysFile2 := conflictFixture(t, "b.txt")
+	os.Chtimes(sysFile2, old, old)
+	if err := b.Run(ctx, false); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if data, _ := os.ReadFile(sysFile2); string(data) != "repo version" {
+		t.Errorf("newer repo copy should win, system has %q", data)
+	}
+}
+
+func TestReadLineUnbuffered(t *testing.T) {
+	r := strings.NewReader("d\r\n1\n")
+	first, _ := readLine(r)
+	second, _ := readLine(r)
+	if first != "d" || second != "1" {
+		t.Errorf("readLine() = %q, %q; want \"d\", \"1\"", first, second)
+	}
+}
+
 func TestFileActionPermissionsStatusNonexistent(t *testing.T) {
 	a := &FileAction{
 		Source:      "nonexistent.txt",
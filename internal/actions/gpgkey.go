@@ -0,0 +1,168 @@
+package actions
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/atomikpanda/dotular/internal/ageutil"
+)
+
+// GpgKeyAction imports a GPG key, identified by its fingerprint, from a key
+// file in the repo (optionally age-encrypted, as secret keys should be) or
+// from a keyserver, and sets its owner trust.
+//
+// Idempotency: GpgKeyAction implements Idempotent by looking the fingerprint
+// up in the keyring (the secret keyring for Secret keys) and comparing the
+// exported owner trust.
+type GpgKeyAction struct {
+	Fingerprint string
+	KeyFile     string // plaintext path; the repo holds KeyFile.age when Encrypted
+	Encrypted   bool
+	AgeKey      *ageutil.Key
+	Keyserver   string
+	Trust       string // unknown | never | marginal | full | ultimate
+	Secret      bool
+}
+
+// ownerTrust maps trust names to the levels of gpg --import-ownertrust.
+var ownerTrust = map[string]string{
+	"unknown":  "2",
+	"never":    "3",
+	"marginal": "4",
+	"full":     "5",
+	"ultimate": "6",
+}
+
+// NormalizeFingerprint strips spaces and a 0x prefix from a fingerprint and
+// upper-cases it, the form gpg prints.
+func NormalizeFingerprint(fpr string) string {
+	fpr = strings.ToUpper(strings.ReplaceAll(fpr, " ", ""))
+	return strings.TrimPrefix(fpr, "0X")
+}
+
+func (a *GpgKeyAction) fpr() string { return NormalizeFingerprint(a.Fingerprint) }
+
+func (a *GpgKeyAction) Describe() string {
+	kind := "key"
+	if a.Secret {
+		kind = "secret key"
+	}
+	desc := fmt.Sprintf("import GPG %s %s", kind, a.fpr())
+	if a.Trust != "" {
+		desc += " (trust " + a.Trust + ")"
+	}
+	return desc
+}
+
+func (a *GpgKeyAction) Run(ctx context.Context, dryRun bool) error {
+	present := a.hasKey(ctx)
+	if !present {
+		if err := a.importKey(ctx, dryRun); err != nil {
+			return err
+		}
+	}
+	if a.Trust == "" || (present && a.trustSet(ctx)) {
+		return nil
+	}
+	line := a.fpr() + ":" + ownerTrust[a.Trust] + ":\n"
+	if dryRun {
+		reportDryRun(ctx, "gpg --import-ownertrust %s", strings.TrimSpace(line))
+		return nil
+	}
+	cmd := command(ctx, "gpg", "--batch", "--import-ownertrust")
+	cmd.Stdin = strings.NewReader(line)
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("set owner trust of %s: %w", a.fpr(), err)
+	}
+	return nil
+}
+
+// importKey imports the key from KeyFile, decrypting it to a private
+// temporary directory first, or receives it from the keyserver.
+func (a *GpgKeyAction) importKey(ctx context.Context, dryRun bool) error {
+	if a.KeyFile == "" {
+		args := []string{"--batch"}
+		if a.Keyserver != "" {
+			args = append(args, "--keyserver", a.Keyserver)
+		}
+		args = append(args, "--recv-keys", a.fpr())
+		if dryRun {
+			reportDryRun(ctx, "gpg %s", strings.Join(args, " "))
+			return nil
+		}
+		if err := command(ctx, "gpg", args...).Run(); err != nil {
+			return fmt.Errorf("receive key %s: %w", a.fpr(), err)
+		}
+		return nil
+	}
+
+	path := a.KeyFile
+	if a.Encrypted {
+		path = ageutil.RepoPath(a.KeyFile)
+	}
+	if dryRun {
+		reportDryRun(ctx, "gpg --import %s", path)
+		return nil
+	}
+	if a.Encrypted {
+		if a.AgeKey == nil {
+			return fmt.Errorf("encrypted key %s requires an age key (set age.identity or age.passphrase in dotular.yaml)", path)
+		}
+		tmp, err := os.MkdirTemp("", "dotular-gpg-*")
+		if err != nil {
+			return err
+		}
+		defer os.RemoveAll(tmp)
+		plain := filepath.Join(tmp, filepath.Base(a.KeyFile))
+		if err := a.AgeKey.DecryptFile(path, plain); err != nil {
+			return fmt.Errorf("decrypt %s: %w", path, err)
+		}
+		path = plain
+	}
+	if err := command(ctx, "gpg", "--batch", "--import", path).Run(); err != nil {
+		return fmt.Errorf("import key %s: %w", a.fpr(), err)
+	}
+	if !a.hasKey(ctx) {
+		return fmt.Errorf("%s does not contain key %s", a.KeyFile, a.fpr())
+	}
+	return nil
+}
+
+// hasKey reports whether the keyring holds the key.
+func (a *GpgKeyAction) hasKey(ctx context.Context) bool {
+	list := "--list-keys"
+	if a.Secret {
+		list = "--list-secret-keys"
+	}
+	out, err := quietOutput(ctx, "gpg", "--batch", "--with-colons", list, a.fpr())
+	return err == nil && hasFingerprint(out, a.fpr())
+}
+
+// hasFingerprint reports whether --with-colons output lists fpr.
+func hasFingerprint(out, fpr string) bool {
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Split(line, ":")
+		if len(fields) > 9 && fields[0] == "fpr" && fields[9] == fpr {
+			return true
+		}
+	}
+	return false
+}
+
+// trustSet reports whether the key's owner trust is already Trust.
+func (a *GpgKeyAction) trustSet(ctx context.Context) bool {
+	out, err := quietOutput(ctx, "gpg", "--batch", "--export-ownertrust")
+	return err == nil && containsLine(out, a.fpr()+":"+ownerTrust[a.Trust]+":")
+}
+
+// IsApplied reports whether the key is in the keyring with the configured
+// owner trust.
+func (a *GpgKeyAction) IsApplied(ctx context.Context) (bool, error) {
+	if !a.hasKey(ctx) {
+		return false, nil
+	}
+	return a.Trust == "" || a.trustSet(ctx), nil
+}
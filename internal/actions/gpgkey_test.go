@@ -0,0 +1,99 @@
+package actions
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+const testFpr = "0123456789ABCDEF0123456789ABCDEF01234567"
+
+func TestNormalizeFingerprint(t *testing.T) {
+	if got := NormalizeFingerprint("0x0123 4567 89ab cdef 0123  4567 89AB CDEF 0123 4567"); got != testFpr {
+		t.Errorf("NormalizeFingerprint = %q", got)
+	}
+}
+
+func TestHasFingerprint(t *testing.T) {
+	out := "pub:u:255:22:89ABCDEF01234567:1700000000:::u:::scESC:::::ed25519:::0:\n" +
+		"fpr:::::::::" + testFpr + ":\n"
+	if !hasFingerprint(out, testFpr) {
+		t.Error("fingerprint not found")
+	}
+	if hasFingerprint(out, strings.Repeat("F", 40)) {
+		t.Error("another fingerprint was found")
+	}
+}
+
+// fakeGpg puts a gpg stand-in on PATH whose keyring holds testFpr once
+// imported and whose owner trust for it is trust. It records the trust
+// lines it is given in a file next to it.
+func fakeGpg(t *testing.T, imported bool, trust string) (dir string) {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("uses a shell script")
+	}
+	dir = t.TempDir()
+	if imported {
+		os.WriteFile(filepath.Join(dir, "keyring"), nil, 0o644)
+	}
+	script := `#!/bin/sh
+dir=$(dirname "$0")
+for arg in "$@"; do
+  case "$arg" in
+  --list-keys|--list-secret-keys) [ -f "$dir/keyring" ] || exit 2; echo "fpr:::::::::` + testFpr + `:"; exit 0 ;;
+  --import) touch "$dir/keyring"; exit 0 ;;
+  --export-ownertrust) echo "` + testFpr + `:` + trust + `:"; exit 0 ;;
+  --import-ownertrust) cat >> "$dir/trust"; exit 0 ;;
+  esac
+done
+`
+	if err := os.WriteFile(filepath.Join(dir, "gpg"), []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	return dir
+}
+
+func TestGpgKeyActionImportAndTrust(t *testing.T) {
+	dir := fakeGpg(t, false, "2")
+	ctx := context.Background()
+	keyFile := filepath.Join(t.TempDir(), "me.asc")
+	os.WriteFile(keyFile, []byte("-----BEGIN PGP PUBLIC KEY BLOCK-----"), 0o644)
+
+	a := &GpgKeyAction{Fingerprint: testFpr, KeyFile: keyFile, Trust: "ultimate"}
+	if ok, _ := a.IsApplied(ctx); ok {
+		t.Error("reported applied before import")
+	}
+	if err := a.Run(ctx, false); err != nil {
+		t.Fatal(err)
+	}
+	trust, _ := os.ReadFile(filepath.Join(dir, "trust"))
+	if got := strings.TrimSpace(string(trust)); got != testFpr+":6:" {
+		t.Errorf("owner trust line = %q", got)
+	}
+}
+
+func TestGpgKeyActionIsApplied(t *testing.T) {
+	fakeGpg(t, true, "6")
+	ctx := context.Background()
+	a := &GpgKeyAction{Fingerprint: strings.ToLower(testFpr), Trust: "ultimate"}
+	if ok, _ := a.IsApplied(ctx); !ok {
+		t.Error("key with ultimate trust should be applied")
+	}
+	a.Trust = "full"
+	if ok, _ := a.IsApplied(ctx); ok {
+		t.Error("reported applied with a different owner trust")
+	}
+}
+
+func TestGpgKeyActionEncryptedNeedsAgeKey(t *testing.T) {
+	fakeGpg(t, false, "")
+	a := &GpgKeyAction{Fingerprint: testFpr, KeyFile: "/repo/gpg/secret.asc", Encrypted: true, Secret: true}
+	if err := a.Run(context.Background(), false); err == nil || !strings.Contains(err.Error(), "age key") {
+		t.Errorf("Run() = %v, want an age key error", err)
+	}
+}
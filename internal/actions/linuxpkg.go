@@ -0,0 +1,148 @@
+package actions
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+)
+
+// --- flatpak -----------------------------------------------------------------
+
+// flatpakRemoteURLs are the .flatpakrepo files of remotes that can be added
+// by name alone.
+var flatpakRemoteURLs = map[string]string{
+	"flathub":      "https://dl.flathub.org/repo/flathub.flatpakrepo",
+	"flathub-beta": "https://flathub.org/beta-repo/flathub-beta.flatpakrepo",
+}
+
+// flatpakRef splits a flatpak app ID or ref into the application ID and the
+// branch, if the ref names one. It accepts "org.gimp.GIMP",
+// "org.gimp.GIMP//beta", and "app/org.gimp.GIMP/x86_64/stable".
+func flatpakRef(pkg string) (id, branch string) {
+	parts := strings.Split(pkg, "/")
+	if parts[0] == "app" || parts[0] == "runtime" {
+		parts = parts[1:]
+	}
+	id = parts[0]
+	if len(parts) >= 3 {
+		branch = parts[2]
+	}
+	return id, branch
+}
+
+// flatpakInstalled reports whether the app (and branch, for refs naming
+// one) is installed, parsing `flatpak list --app`.
+func flatpakInstalled(ctx context.Context, pkg string) (bool, error) {
+	out, err := quietOutput(ctx, "flatpak", "list", "--app", "--columns=application,branch")
+	if err != nil {
+		return false, err
+	}
+	return parseFlatpakList(out, pkg), nil
+}
+
+// parseFlatpakList reports whether pkg appears in `flatpak list --app
+// --columns=application,branch` output.
+func parseFlatpakList(out, pkg string) bool {
+	id, branch := flatpakRef(pkg)
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 || fields[0] != id {
+			continue
+		}
+		if branch == "" || (len(fields) > 1 && fields[1] == branch) {
+			return true
+		}
+	}
+	return false
+}
+
+// flatpakAddRemote adds the named remote when its URL is known (given or
+// built in) and it is not configured yet.
+func flatpakAddRemote(ctx context.Context, remote, url string, dryRun bool) error {
+	if url == "" {
+		url = flatpakRemoteURLs[remote]
+	}
+	if url == "" {
+		return nil // assume the remote is configured already
+	}
+	args := []string{"remote-add", "--if-not-exists", remote, url}
+	if dryRun {
+		reportDryRun(ctx, "flatpak %s", strings.Join(args, " "))
+		return nil
+	}
+	if err := command(ctx, "flatpak", args...).Run(); err != nil {
+		return fmt.Errorf("add flatpak remote %s: %w", remote, err)
+	}
+	return nil
+}
+
+// --- snap --------------------------------------------------------------------
+
+// snapTracking returns the channel an installed snap tracks, and whether it
+// is installed at all, parsing `snap list <name>`.
+func snapTracking(ctx context.Context, name string) (tracking string, installed bool) {
+	out, err := quietOutput(ctx, "snap", "list", name)
+	if err != nil {
+		// snap list exits non-zero when the snap is not installed.
+		return "", false
+	}
+	return parseSnapList(out, name)
+}
+
+func parseSnapList(out, name string) (tracking string, installed bool) {
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	if len(lines) < 2 {
+		return "", false
+	}
+	header := strings.Fields(lines[0])
+	col := -1
+	for i, h := range header {
+		if h == "Tracking" {
+			col = i
+		}
+	}
+	for _, line := range lines[1:] {
+		fields := strings.Fields(line)
+		if len(fields) == 0 || fields[0] != name {
+			continue
+		}
+		if col >= 0 && col < len(fields) {
+			tracking = fields[col]
+		}
+		return tracking, true
+	}
+	return "", false
+}
+
+// snapChannelMatches reports whether an installed snap tracking tracking
+// follows channel. A bare risk such as "edge" means "latest/edge" and a
+// bare track such as "1.x" means its stable risk.
+func snapChannelMatches(tracking, channel string) bool {
+	return normalizeSnapChannel(tracking) == normalizeSnapChannel(channel)
+}
+
+func normalizeSnapChannel(channel string) string {
+	switch channel {
+	case "":
+		return "latest/stable"
+	case "stable", "candidate", "beta", "edge":
+		return "latest/" + channel
+	}
+	if !strings.Contains(channel, "/") {
+		return channel + "/stable"
+	}
+	return channel
+}
+
+// --- helpers -----------------------------------------------------------------
+
+// quietOutput runs a query command and returns its stdout without echoing
+// it to the run's output.
+func quietOutput(ctx context.Context, name string, args ...string) (string, error) {
+	var buf bytes.Buffer
+	cmd := command(ctx, name, args...)
+	cmd.Stdout, cmd.Stderr = &buf, nil
+	err := cmd.Run()
+	return buf.String(), err
+}
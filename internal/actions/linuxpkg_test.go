@@ -0,0 +1,95 @@
+package actions
+
+import (
+	"context"
+	"slices"
+	"testing"
+)
+
+func TestFlatpakRef(t *testing.T) {
+	tests := []struct{ pkg, id, branch string }{
+		{"org.gimp.GIMP", "org.gimp.GIMP", ""},
+		{"org.gimp.GIMP//beta", "org.gimp.GIMP", "beta"},
+		{"app/org.gimp.GIMP/x86_64/stable", "org.gimp.GIMP", "stable"},
+	}
+	for _, tt := range tests {
+		if id, branch := flatpakRef(tt.pkg); id != tt.id || branch != tt.branch {
+			t.Errorf("flatpakRef(%q) = %q, %q", tt.pkg, id, branch)
+		}
+	}
+}
+
+func TestParseFlatpakList(t *testing.T) {
+	out := "org.gimp.GIMP\tstable\norg.mozilla.firefox\tstable\n"
+	for pkg, want := range map[string]bool{
+		"org.gimp.GIMP":                   true,
+		"app/org.gimp.GIMP/x86_64/stable": true,
+		"org.gimp.GIMP//beta":             false,
+		"org.inkscape.Inkscape":           false,
+	} {
+		if got := parseFlatpakList(out, pkg); got != want {
+			t.Errorf("parseFlatpakList(%q) = %v, want %v", pkg, got, want)
+		}
+	}
+}
+
+func TestParseSnapList(t *testing.T) {
+	out := `Name  Version  Rev  Tracking     Publisher   Notes
+code  1.85.1   151  latest/edge  vscode✓     classic
+`
+	if tracking, ok := parseSnapList(out, "code"); !ok || tracking != "latest/edge" {
+		t.Errorf("parseSnapList = %q, %v", tracking, ok)
+	}
+	if _, ok := parseSnapList(out, "other"); ok {
+		t.Error("a snap missing from the list was reported installed")
+	}
+}
+
+func TestSnapChannelMatches(t *testing.T) {
+	tests := []struct {
+		tracking, channel string
+		want              bool
+	}{
+		{"latest/edge", "edge", true},
+		{"latest/stable", "stable", true},
+		{"1.x/stable", "1.x", true},
+		{"latest/stable", "edge", false},
+		{"latest/stable", "", true},
+	}
+	for _, tt := range tests {
+		if got := snapChannelMatches(tt.tracking, tt.channel); got != tt.want {
+			t.Errorf("snapChannelMatches(%q, %q) = %v, want %v", tt.tracking, tt.channel, got, tt.want)
+		}
+	}
+}
+
+func TestPackageInstallCommandOptions(t *testing.T) {
+	ctx := context.Background()
+	tests := []struct {
+		action *PackageAction
+		want   []string
+	}{
+		{&PackageAction{Package: "org.gimp.GIMP", Manager: "flatpak", Remote: "flathub"},
+			[]string{"flatpak", "install", "-y", "--noninteractive", "flathub", "org.gimp.GIMP"}},
+		{&PackageAction{Package: "dotular-test-missing-snap", Manager: "snap", Classic: true, Channel: "edge"},
+			[]string{"sudo", "snap", "install", "dotular-test-missing-snap", "--channel=edge", "--classic"}},
+		{&PackageAction{Package: "git", Manager: "apt"},
+			[]string{"sudo", "apt-get", "install", "-y", "git"}},
+	}
+	for _, tt := range tests {
+		got, err := tt.action.installCommand(ctx, tt.action.Package)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("installCommand = %q, want %q", got, tt.want)
+		}
+	}
+}
+
+func TestPackageDescribeOptions(t *testing.T) {
+	a := &PackageAction{Package: "code", Manager: "snap", Classic: true, Channel: "edge"}
+	if got, want := a.Describe(), `install package "code" via snap (classic, channel edge)`; got != want {
+		t.Errorf("Describe() = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,248 @@
+package actions
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/atomikpanda/dotular/internal/platform"
+)
+
+// appDirs are searched, in order, for an app given by name.
+var appDirs = []string{"/Applications", "/System/Applications", "~/Applications"}
+
+// resolveApp returns the path of the app bundle named app. Paths (anything
+// containing a "/") are expanded and returned as they are; names are looked
+// up in appDirs, defaulting to /Applications when not found.
+func resolveApp(app string) string {
+	if strings.Contains(app, "/") {
+		return strings.TrimSuffix(platform.ExpandPath(app), "/")
+	}
+	if !strings.HasSuffix(app, ".app") {
+		app += ".app"
+	}
+	for _, dir := range appDirs {
+		path := filepath.Join(platform.ExpandPath(dir), app)
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+	}
+	return filepath.Join(appDirs[0], app)
+}
+
+// appName returns the display name of an app path, e.g. "Safari".
+func appName(path string) string {
+	return strings.TrimSuffix(filepath.Base(path), ".app")
+}
+
+// --- dock --------------------------------------------------------------------
+
+// DockAction sets the persistent apps in the macOS Dock. By default the Dock
+// is made to hold exactly Apps, in order; with Add, missing apps are
+// appended and the rest are left alone.
+//
+// Idempotency: DockAction implements Idempotent by reading the current
+// persistent-apps list with `defaults read`.
+type DockAction struct {
+	Apps []string // names or paths
+	Add  bool
+}
+
+func (a *DockAction) Describe() string {
+	names := make([]string, len(a.Apps))
+	for i, app := range a.Apps {
+		names[i] = appName(app)
+	}
+	verb := "set dock to"
+	if a.Add {
+		verb = "add to dock"
+	}
+	return fmt.Sprintf("%s %s", verb, strings.Join(names, ", "))
+}
+
+func (a *DockAction) paths() []string {
+	paths := make([]string, len(a.Apps))
+	for i, app := range a.Apps {
+		paths[i] = resolveApp(app)
+	}
+	return paths
+}
+
+func (a *DockAction) Run(ctx context.Context, dryRun bool) error {
+	want := a.paths()
+	var args []string
+	if a.Add {
+		current, err := dockApps(ctx)
+		if err != nil {
+			return err
+		}
+		for _, path := range want {
+			if !slices.Contains(current, path) {
+				args = append(args, dockTile(path))
+			}
+		}
+		if len(args) == 0 {
+			return nil
+		}
+		args = append([]string{"write", "com.apple.dock", "persistent-apps", "-array-add"}, args...)
+	} else {
+		args = []string{"write", "com.apple.dock", "persistent-apps", "-array"}
+		for _, path := range want {
+			args = append(args, dockTile(path))
+		}
+	}
+	if dryRun {
+		reportDryRun(ctx, "defaults write com.apple.dock persistent-apps: %s", strings.Join(want, ", "))
+		return nil
+	}
+	if err := command(ctx, "defaults", args...).Run(); err != nil {
+		return fmt.Errorf("write dock: %w", err)
+	}
+	return nil
+}
+
+// IsApplied reports whether the Dock already holds the apps: exactly and in
+// order, or with Add, among its other apps.
+func (a *DockAction) IsApplied(ctx context.Context) (bool, error) {
+	current, err := dockApps(ctx)
+	if err != nil {
+		return false, nil // unreadable: apply and let defaults report errors
+	}
+	want := a.paths()
+	if a.Add {
+		for _, path := range want {
+			if !slices.Contains(current, path) {
+				return false, nil
+			}
+		}
+		return true, nil
+	}
+	return slices.Equal(current, want), nil
+}
+
+// Restarts implements Restarter: the Dock reads its preferences at launch.
+func (a *DockAction) Restarts() []string { return []string{"Dock"} }
+
+// dockApps returns the paths of the Dock's persistent apps, in order.
+func dockApps(ctx context.Context) ([]string, error) {
+	cmd := command(ctx, "defaults", "read", "com.apple.dock", "persistent-apps")
+	cmd.Stdout = nil
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("read dock: %w", err)
+	}
+	return parseDockApps(string(out)), nil
+}
+
+var dockURLPattern = regexp.MustCompile(`"_CFURLString"\s*=\s*"([^"]*)"`)
+
+// parseDockApps extracts the app paths from `defaults read` output of the
+// persistent-apps array.
+func parseDockApps(out string) []string {
+	var paths []string
+	for _, m := range dockURLPattern.FindAllStringSubmatch(out, -1) {
+		u, err := url.Parse(m[1])
+		if err != nil || u.Path == "" {
+			continue
+		}
+		paths = append(paths, strings.TrimSuffix(u.Path, "/"))
+	}
+	return paths
+}
+
+// dockTile returns the plist fragment `defaults write -array` takes for one
+// persistent app.
+func dockTile(path string) string {
+	u := url.URL{Scheme: "file", Path: path + "/"}
+	return "<dict><key>tile-data</key><dict><key>file-data</key><dict>" +
+		"<key>_CFURLString</key><string>" + html.EscapeString(u.String()) + "</string>" +
+		"<key>_CFURLStringType</key><integer>15</integer>" +
+		"</dict></dict></dict>"
+}
+
+// --- login items -------------------------------------------------------------
+
+// LoginItemAction adds an app to the current user's login items through
+// System Events.
+//
+// Idempotency: LoginItemAction implements Idempotent by listing the existing
+// login items.
+type LoginItemAction struct {
+	App    string // name or path
+	Hidden bool
+}
+
+func (a *LoginItemAction) Describe() string {
+	desc := "add login item " + appName(a.App)
+	if a.Hidden {
+		desc += " (hidden)"
+	}
+	return desc
+}
+
+func (a *LoginItemAction) Run(ctx context.Context, dryRun bool) error {
+	path := resolveApp(a.App)
+	if dryRun {
+		reportDryRun(ctx, "add login item: %s", path)
+		return nil
+	}
+	script := fmt.Sprintf(`tell application "System Events" to make login item at end with properties {path:%q, hidden:%t}`, path, a.Hidden)
+	if err := command(ctx, "osascript", "-e", script).Run(); err != nil {
+		return fmt.Errorf("add login item %s: %w", path, err)
+	}
+	return nil
+}
+
+// IsApplied reports whether a login item for the app already exists.
+func (a *LoginItemAction) IsApplied(ctx context.Context) (bool, error) {
+	cmd := command(ctx, "osascript", "-e", `tell application "System Events" to get the path of every login item`)
+	cmd.Stdout = nil
+	out, err := cmd.Output()
+	if err != nil {
+		return false, nil
+	}
+	path := resolveApp(a.App)
+	for _, item := range strings.Split(strings.TrimSpace(string(out)), ", ") {
+		if strings.TrimSuffix(item, "/") == path {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// --- restarts ----------------------------------------------------------------
+
+// restartedBy maps preference domains to the process that must be restarted
+// for changes to them to take effect.
+var restartedBy = map[string]string{
+	"com.apple.dock":              "Dock",
+	"com.apple.finder":            "Finder",
+	"com.apple.systemuiserver":    "SystemUIServer",
+	"com.apple.menuextra.clock":   "SystemUIServer",
+	"com.apple.menuextra.battery": "SystemUIServer",
+	"com.apple.screencapture":     "SystemUIServer",
+}
+
+// RestartApp restarts a macOS process such as the Dock or Finder with
+// killall; launchd starts it again with the new preferences. A process that
+// is not running is not an error.
+func RestartApp(ctx context.Context, name string) error {
+	cmd := command(ctx, "killall", name)
+	cmd.Stdout, cmd.Stderr = nil, nil
+	if err := cmd.Run(); err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return nil // no such process
+		}
+		return fmt.Errorf("restart %s: %w", name, err)
+	}
+	return nil
+}
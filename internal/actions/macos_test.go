@@ -0,0 +1,110 @@
+package actions
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestResolveApp(t *testing.T) {
+	dir := t.TempDir()
+	orig := appDirs
+	appDirs = []string{filepath.Join(dir, "Applications"), filepath.Join(dir, "System")}
+	t.Cleanup(func() { appDirs = orig })
+	os.MkdirAll(filepath.Join(dir, "System", "Safari.app"), 0o755)
+
+	tests := []struct{ app, want string }{
+		{"Safari", filepath.Join(dir, "System", "Safari.app")},
+		{"Ghostty.app", filepath.Join(dir, "Applications", "Ghostty.app")},
+		{"/opt/Tools/Thing.app/", "/opt/Tools/Thing.app"},
+	}
+	for _, tt := range tests {
+		if got := resolveApp(tt.app); got != tt.want {
+			t.Errorf("resolveApp(%q) = %q, want %q", tt.app, got, tt.want)
+		}
+	}
+}
+
+func TestParseDockApps(t *testing.T) {
+	out := `(
+        {
+        "tile-data" =         {
+            "file-data" =             {
+                "_CFURLString" = "file:///Applications/Safari.app/";
+                "_CFURLStringType" = 15;
+            };
+        };
+    },
+        {
+        "tile-data" =         {
+            "file-data" =             {
+                "_CFURLString" = "file:///Applications/Visual%20Studio%20Code.app/";
+                "_CFURLStringType" = 15;
+            };
+        };
+    }
+)`
+	want := []string{"/Applications/Safari.app", "/Applications/Visual Studio Code.app"}
+	if got := parseDockApps(out); !slices.Equal(got, want) {
+		t.Errorf("parseDockApps = %q, want %q", got, want)
+	}
+}
+
+func TestDockTile(t *testing.T) {
+	tile := dockTile("/Applications/Visual Studio Code.app")
+	if !strings.Contains(tile, "<string>file:///Applications/Visual%20Studio%20Code.app/</string>") {
+		t.Errorf("dockTile = %s", tile)
+	}
+	// The tile written must read back as the same path.
+	if got := parseDockApps(`"_CFURLString" = "file:///Applications/Visual%20Studio%20Code.app/";`); got[0] != "/Applications/Visual Studio Code.app" {
+		t.Errorf("round trip = %q", got)
+	}
+}
+
+func TestDockAndLoginItemDescribe(t *testing.T) {
+	tests := []struct {
+		action Action
+		want   string
+	}{
+		{&DockAction{Apps: []string{"Safari", "/Applications/Ghostty.app"}}, "set dock to Safari, Ghostty"},
+		{&DockAction{Apps: []string{"Safari"}, Add: true}, "add to dock Safari"},
+		{&LoginItemAction{App: "Rectangle"}, "add login item Rectangle"},
+		{&LoginItemAction{App: "Rectangle", Hidden: true}, "add login item Rectangle (hidden)"},
+	}
+	for _, tt := range tests {
+		if got := tt.action.Describe(); got != tt.want {
+			t.Errorf("Describe() = %q, want %q", got, tt.want)
+		}
+	}
+}
+
+func TestDockRunDryRun(t *testing.T) {
+	a := &DockAction{Apps: []string{"Safari"}}
+	if err := a.Run(context.Background(), true); err != nil {
+		t.Errorf("dry run error: %v", err)
+	}
+	l := &LoginItemAction{App: "Rectangle"}
+	if err := l.Run(context.Background(), true); err != nil {
+		t.Errorf("dry run error: %v", err)
+	}
+}
+
+func TestRestarts(t *testing.T) {
+	tests := []struct {
+		action Restarter
+		want   []string
+	}{
+		{&SettingAction{Domain: "com.apple.dock", Key: "autohide", Value: true}, []string{"Dock"}},
+		{&SettingAction{Domain: "com.apple.finder", Key: "ShowPathbar", Value: true}, []string{"Finder"}},
+		{&SettingAction{Domain: "NSGlobalDomain", Key: "KeyRepeat", Value: 2}, nil},
+		{&DockAction{Apps: []string{"Safari"}}, []string{"Dock"}},
+	}
+	for _, tt := range tests {
+		if got := tt.action.Restarts(); !slices.Equal(got, tt.want) {
+			t.Errorf("%T.Restarts() = %v, want %v", tt.action, got, tt.want)
+		}
+	}
+}
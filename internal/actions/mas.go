@@ -0,0 +1,135 @@
+package actions
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// Mac App Store apps are installed with mas, which only takes numeric app
+// IDs. Packages may instead name the app; the name is resolved to an ID
+// with `mas search` and remembered for the rest of the run.
+
+// masApp is one line of `mas list` or `mas search` output.
+type masApp struct {
+	ID   string
+	Name string
+}
+
+// masLine matches "  497799835  Xcode  (15.0)" as printed by mas list and
+// mas search (which may append a price column after the version).
+var masLine = regexp.MustCompile(`^\s*(\d+)\s+(.+?)\s+\(([^)]*)\)`)
+
+func parseMasApps(out string) []masApp {
+	var apps []masApp
+	for _, line := range strings.Split(out, "\n") {
+		if m := masLine.FindStringSubmatch(line); m != nil {
+			apps = append(apps, masApp{ID: m[1], Name: m[2]})
+		}
+	}
+	return apps
+}
+
+// isMasID reports whether pkg is already a numeric App Store ID.
+func isMasID(pkg string) bool {
+	if pkg == "" {
+		return false
+	}
+	for _, r := range pkg {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// pickMasApp returns the ID of the search result whose name matches name
+// exactly, ignoring case. Without an exact match the error lists the
+// closest results so the user can pin the ID.
+func pickMasApp(name string, results []masApp) (string, error) {
+	for _, app := range results {
+		if strings.EqualFold(app.Name, name) {
+			return app.ID, nil
+		}
+	}
+	if len(results) == 0 {
+		return "", fmt.Errorf("no App Store app named %q", name)
+	}
+	var candidates []string
+	for i, app := range results {
+		if i == 5 {
+			break
+		}
+		candidates = append(candidates, fmt.Sprintf("%s (%s)", app.Name, app.ID))
+	}
+	return "", fmt.Errorf("no App Store app named exactly %q; use one of these IDs instead: %s", name, strings.Join(candidates, ", "))
+}
+
+var masIDs sync.Map // app name -> ID
+
+// masResolve returns the App Store ID for pkg, searching by name when pkg
+// is not numeric.
+func masResolve(ctx context.Context, pkg string) (string, error) {
+	if isMasID(pkg) {
+		return pkg, nil
+	}
+	if id, ok := masIDs.Load(pkg); ok {
+		return id.(string), nil
+	}
+	out, err := masOutput(ctx, "search", pkg)
+	if err != nil {
+		return "", fmt.Errorf("mas search %q: %w", pkg, err)
+	}
+	id, err := pickMasApp(pkg, parseMasApps(out))
+	if err != nil {
+		return "", err
+	}
+	masIDs.Store(pkg, id)
+	return id, nil
+}
+
+// masInstalled reports whether the app with the given ID is in `mas list`.
+func masInstalled(ctx context.Context, id string) (bool, error) {
+	out, err := masOutput(ctx, "list")
+	if err != nil {
+		return false, fmt.Errorf("mas list: %w", err)
+	}
+	for _, app := range parseMasApps(out) {
+		if app.ID == id {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// ErrMasSignedOut is returned when installing from the App Store while no
+// Apple ID is signed in.
+var ErrMasSignedOut = errors.New("not signed in to the App Store; open the App Store app and sign in, then run dotular again")
+
+// masCheckSignedIn returns ErrMasSignedOut when mas reports that no Apple ID
+// is signed in. Recent macOS versions do not let mas query the account; the
+// check passes then and the install reports any problem itself.
+func masCheckSignedIn(ctx context.Context) error {
+	out, err := masOutput(ctx, "account")
+	if err != nil && masSignedOut(out) {
+		return ErrMasSignedOut
+	}
+	return nil
+}
+
+func masSignedOut(out string) bool {
+	return strings.Contains(strings.ToLower(out), "not signed in")
+}
+
+// masOutput runs mas with args and returns its combined output.
+func masOutput(ctx context.Context, args ...string) (string, error) {
+	var buf bytes.Buffer
+	cmd := command(ctx, "mas", args...)
+	cmd.Stdout, cmd.Stderr = &buf, &buf
+	err := cmd.Run()
+	return buf.String(), err
+}
@@ -0,0 +1,97 @@
+package actions
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestParseMasApps(t *testing.T) {
+	out := `  497799835  Xcode                 (15.0)
+ 1451685025  WireGuard             (1.0.16)
+  441258766  Magnet                (2.14.0)  $4.99
+Warning: something unrelated
+`
+	want := []masApp{{"497799835", "Xcode"}, {"1451685025", "WireGuard"}, {"441258766", "Magnet"}}
+	if got := parseMasApps(out); !slices.Equal(got, want) {
+		t.Errorf("parseMasApps = %+v, want %+v", got, want)
+	}
+}
+
+func TestPickMasApp(t *testing.T) {
+	results := []masApp{{"1", "Magnet Pro"}, {"441258766", "Magnet"}}
+	if id, err := pickMasApp("magnet", results); err != nil || id != "441258766" {
+		t.Errorf("pickMasApp = %q, %v", id, err)
+	}
+	_, err := pickMasApp("Magne", results)
+	if err == nil || !strings.Contains(err.Error(), "Magnet (441258766)") {
+		t.Errorf("inexact match error = %v, want candidates listed", err)
+	}
+	if _, err := pickMasApp("Nothing", nil); err == nil {
+		t.Error("expected an error without results")
+	}
+}
+
+func TestIsMasID(t *testing.T) {
+	for pkg, want := range map[string]bool{"497799835": true, "Xcode": false, "": false, "12a": false} {
+		if got := isMasID(pkg); got != want {
+			t.Errorf("isMasID(%q) = %v, want %v", pkg, got, want)
+		}
+	}
+}
+
+// fakeMas puts a mas stand-in on PATH that prints canned output per
+// subcommand and fails "account" when signedOut is set.
+func fakeMas(t *testing.T, signedOut bool) {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("uses a shell script")
+	}
+	dir := t.TempDir()
+	account := `echo "me@example.com"`
+	if signedOut {
+		account = `echo "Error: Not signed in"; exit 1`
+	}
+	script := `#!/bin/sh
+case "$1" in
+search) printf '  441258766  Magnet  (2.14.0)\n 1000000000  Magnet Pro  (1.0)\n' ;;
+list)   printf '  441258766  Magnet  (2.14.0)\n' ;;
+account) ` + account + ` ;;
+install) exit 0 ;;
+esac
+`
+	if err := os.WriteFile(filepath.Join(dir, "mas"), []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+}
+
+func TestPackageActionMas(t *testing.T) {
+	fakeMas(t, false)
+	ctx := context.Background()
+
+	byName := &PackageAction{Package: "Magnet", Manager: "mas"}
+	if applied, _ := byName.IsApplied(ctx); !applied {
+		t.Error("Magnet should be found installed by name")
+	}
+	other := &PackageAction{Package: "1000000000", Manager: "mas"}
+	if applied, _ := other.IsApplied(ctx); applied {
+		t.Error("an app missing from mas list was reported installed")
+	}
+	if err := other.Run(ctx, false); err != nil {
+		t.Errorf("install: %v", err)
+	}
+}
+
+func TestPackageActionMasSignedOut(t *testing.T) {
+	fakeMas(t, true)
+	a := &PackageAction{Package: "441258766", Manager: "mas"}
+	if err := a.Run(context.Background(), false); !errors.Is(err, ErrMasSignedOut) {
+		t.Errorf("Run() = %v, want ErrMasSignedOut", err)
+	}
+}
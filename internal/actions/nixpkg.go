@@ -0,0 +1,81 @@
+package actions
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+)
+
+// --- nix profile -------------------------------------------------------------
+
+// nixProfileRef returns the flake reference to install for a nix-profile
+// package: pkg itself when it names a flake ("github:owner/repo#tool"),
+// otherwise the package from the nixpkgs flake ("nixpkgs#ripgrep").
+func nixProfileRef(pkg string) string {
+	if strings.Contains(pkg, "#") {
+		return pkg
+	}
+	return "nixpkgs#" + pkg
+}
+
+// nixProfileAttr returns the attribute a nix-profile package installs:
+// "ripgrep" for "ripgrep" and "nixpkgs#ripgrep", "tool" for
+// "github:owner/repo#packages.x86_64-linux.tool".
+func nixProfileAttr(pkg string) string {
+	if _, attr, ok := strings.Cut(pkg, "#"); ok {
+		pkg = attr
+	}
+	if i := strings.LastIndex(pkg, "."); i >= 0 {
+		return pkg[i+1:]
+	}
+	return pkg
+}
+
+// nixProfileInstalled reports whether pkg is in the user's nix profile,
+// parsing `nix profile list --json`.
+func nixProfileInstalled(ctx context.Context, pkg string) (bool, error) {
+	out, err := quietOutput(ctx, "nix", "profile", "list", "--json")
+	if err != nil {
+		return false, err
+	}
+	return parseNixProfileList(out, pkg), nil
+}
+
+// nixProfileElement is an installed element in `nix profile list --json`.
+type nixProfileElement struct {
+	AttrPath string `json:"attrPath"`
+}
+
+// parseNixProfileList reports whether pkg appears in `nix profile list
+// --json` output. Nix 2.20 and later key elements by name; earlier
+// versions list them.
+func parseNixProfileList(out, pkg string) bool {
+	var list struct {
+		Elements json.RawMessage `json:"elements"`
+	}
+	if err := json.Unmarshal([]byte(out), &list); err != nil {
+		return false
+	}
+	attr := nixProfileAttr(pkg)
+	matches := func(el nixProfileElement) bool {
+		return el.AttrPath == attr || strings.HasSuffix(el.AttrPath, "."+attr)
+	}
+	var named map[string]nixProfileElement
+	if err := json.Unmarshal(list.Elements, &named); err == nil {
+		for name, el := range named {
+			if name == attr || matches(el) {
+				return true
+			}
+		}
+		return false
+	}
+	var listed []nixProfileElement
+	if err := json.Unmarshal(list.Elements, &listed); err == nil {
+		for _, el := range listed {
+			if matches(el) {
+				return true
+			}
+		}
+	}
+	return false
+}
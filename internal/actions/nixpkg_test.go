@@ -0,0 +1,42 @@
+package actions
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestNixProfileRef(t *testing.T) {
+	tests := []struct{ pkg, ref, attr string }{
+		{"ripgrep", "nixpkgs#ripgrep", "ripgrep"},
+		{"nixpkgs#ripgrep", "nixpkgs#ripgrep", "ripgrep"},
+		{"github:owner/repo#packages.x86_64-linux.tool", "github:owner/repo#packages.x86_64-linux.tool", "tool"},
+	}
+	for _, tt := range tests {
+		if got := nixProfileRef(tt.pkg); got != tt.ref {
+			t.Errorf("nixProfileRef(%q) = %q, want %q", tt.pkg, got, tt.ref)
+		}
+		if got := nixProfileAttr(tt.pkg); got != tt.attr {
+			t.Errorf("nixProfileAttr(%q) = %q, want %q", tt.pkg, got, tt.attr)
+		}
+	}
+	args, _ := installArgs("nix-profile", "ripgrep")
+	if !slices.Equal(args, []string{"nix", "profile", "install", "nixpkgs#ripgrep"}) {
+		t.Errorf("installArgs = %v", args)
+	}
+}
+
+func TestParseNixProfileList(t *testing.T) {
+	named := `{"version":3,"elements":{"ripgrep":{"attrPath":"legacyPackages.x86_64-linux.ripgrep","originalUrl":"flake:nixpkgs"}}}`
+	listed := `{"version":2,"elements":[{"attrPath":"legacyPackages.aarch64-darwin.ripgrep","originalUrl":"flake:nixpkgs"}]}`
+	for _, out := range []string{named, listed} {
+		if !parseNixProfileList(out, "ripgrep") || !parseNixProfileList(out, "nixpkgs#ripgrep") {
+			t.Errorf("ripgrep not found in %s", out)
+		}
+		if parseNixProfileList(out, "fd") {
+			t.Errorf("fd reported installed in %s", out)
+		}
+	}
+	if parseNixProfileList("not json", "ripgrep") {
+		t.Error("unparsable output reported installed")
+	}
+}
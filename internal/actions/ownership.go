@@ -0,0 +1,160 @@
+package actions
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/user"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strconv"
+
+	"github.com/atomikpanda/dotular/internal/errs"
+)
+
+// ownership is a resolved owner/group pair for chown. A uid or gid of -1
+// leaves that side unchanged, as with os.Chown.
+type ownership struct {
+	owner, group string
+	uid, gid     int
+}
+
+// resolveOwnership looks up owner and group, each of which may be a name or a
+// numeric ID. Both empty yields an ownership that changes nothing.
+func resolveOwnership(owner, group string) (ownership, error) {
+	o := ownership{owner: owner, group: group, uid: -1, gid: -1}
+	if owner == "" && group == "" {
+		return o, nil
+	}
+	if runtime.GOOS == "windows" {
+		return o, fmt.Errorf("owner and group are not supported on windows")
+	}
+	if owner != "" {
+		id, err := lookupID(owner, func(name string) (string, error) {
+			u, err := user.Lookup(name)
+			if err != nil {
+				return "", err
+			}
+			return u.Uid, nil
+		})
+		if err != nil {
+			return o, fmt.Errorf("owner %q: %w", owner, err)
+		}
+		o.uid = id
+	}
+	if group != "" {
+		id, err := lookupID(group, func(name string) (string, error) {
+			g, err := user.LookupGroup(name)
+			if err != nil {
+				return "", err
+			}
+			return g.Gid, nil
+		})
+		if err != nil {
+			return o, fmt.Errorf("group %q: %w", group, err)
+		}
+		o.gid = id
+	}
+	return o, nil
+}
+
+func lookupID(nameOrID string, lookup func(string) (string, error)) (int, error) {
+	if id, err := strconv.Atoi(nameOrID); err == nil {
+		return id, nil
+	}
+	s, err := lookup(nameOrID)
+	if err != nil {
+		return -1, err
+	}
+	return strconv.Atoi(s)
+}
+
+func (o ownership) isZero() bool { return o.uid == -1 && o.gid == -1 }
+
+// checkElevation reports an error before anything is written when the
+// ownership cannot be applied without root: only root may give a file to
+// another user, and other users may only use groups they belong to.
+func (o ownership) checkElevation() error {
+	euid := os.Geteuid()
+	if o.isZero() || euid == 0 {
+		return nil
+	}
+	if o.uid != -1 && o.uid != euid {
+		return fmt.Errorf("setting owner %q: %w", o.owner, errs.ErrNeedsElevation)
+	}
+	if o.gid != -1 && o.gid != os.Getegid() {
+		u, err := user.Current()
+		if err != nil {
+			return nil // let chown itself decide
+		}
+		groups, err := u.GroupIds()
+		if err != nil || !slices.Contains(groups, strconv.Itoa(o.gid)) {
+			return fmt.Errorf("setting group %q: %w (or membership in the group)", o.group, errs.ErrNeedsElevation)
+		}
+	}
+	return nil
+}
+
+// apply sets the ownership of path without following a final symlink.
+func (o ownership) apply(path string) error {
+	if o.isZero() {
+		return nil
+	}
+	if err := os.Lchown(path, o.uid, o.gid); err != nil {
+		if errors.Is(err, fs.ErrPermission) {
+			return fmt.Errorf("chown %s: %w: %w", path, errs.ErrNeedsElevation, err)
+		}
+		return fmt.Errorf("chown %s: %w", path, err)
+	}
+	return nil
+}
+
+// applyTree sets the ownership of root and everything beneath it.
+func (o ownership) applyTree(root string) error {
+	if o.isZero() {
+		return nil
+	}
+	return filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		return o.apply(path)
+	})
+}
+
+// status returns a status annotation comparing path's ownership with the
+// wanted one, or "" when no ownership is configured or path does not exist.
+func (o ownership) status(path string) string {
+	if o.isZero() {
+		return ""
+	}
+	info, err := os.Lstat(path)
+	if err != nil {
+		return ""
+	}
+	uid, gid, known := fileOwner(info)
+	if !known {
+		return ""
+	}
+	want := o.owner + ":" + o.group
+	if (o.uid == -1 || o.uid == uid) && (o.gid == -1 || o.gid == gid) {
+		return fmt.Sprintf("[owner: %s ✓]", want)
+	}
+	return fmt.Sprintf("[owner: want %s, got %s:%s ⚠]", want, userName(uid), groupName(gid))
+}
+
+func userName(uid int) string {
+	if u, err := user.LookupId(strconv.Itoa(uid)); err == nil {
+		return u.Username
+	}
+	return strconv.Itoa(uid)
+}
+
+func groupName(gid int) string {
+	if g, err := user.LookupGroupId(strconv.Itoa(gid)); err == nil {
+		return g.Name
+	}
+	return strconv.Itoa(gid)
+}
@@ -0,0 +1,120 @@
+package actions
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/atomikpanda/dotular/internal/errs"
+)
+
+func skipOnWindows(t *testing.T) {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("ownership is Unix only")
+	}
+}
+
+func TestResolveOwnershipEmpty(t *testing.T) {
+	o, err := resolveOwnership("", "")
+	if err != nil || !o.isZero() {
+		t.Errorf("resolveOwnership(\"\", \"\") = %+v, %v", o, err)
+	}
+}
+
+func TestResolveOwnershipNumeric(t *testing.T) {
+	skipOnWindows(t)
+	o, err := resolveOwnership("0", "0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if o.uid != 0 || o.gid != 0 {
+		t.Errorf("got uid %d gid %d", o.uid, o.gid)
+	}
+}
+
+func TestResolveOwnershipUnknown(t *testing.T) {
+	skipOnWindows(t)
+	if _, err := resolveOwnership("no-such-user-dotular", ""); err == nil {
+		t.Error("expected error for unknown user")
+	}
+	if _, err := resolveOwnership("", "no-such-group-dotular"); err == nil {
+		t.Error("expected error for unknown group")
+	}
+}
+
+func TestCheckElevation(t *testing.T) {
+	skipOnWindows(t)
+	self := ownership{owner: "me", uid: os.Geteuid(), gid: os.Getegid()}
+	if err := self.checkElevation(); err != nil {
+		t.Errorf("own user and group should not need root: %v", err)
+	}
+	if os.Geteuid() == 0 {
+		t.Skip("running as root")
+	}
+	other := ownership{owner: "root", uid: 0, gid: -1}
+	if err := other.checkElevation(); !errors.Is(err, errs.ErrNeedsElevation) {
+		t.Errorf("expected an elevation error, got %v", err)
+	}
+}
+
+func TestFileActionOwnership(t *testing.T) {
+	skipOnWindows(t)
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src.txt")
+	destDir := filepath.Join(dir, "dest")
+	os.WriteFile(src, []byte("data"), 0o644)
+
+	a := &FileAction{
+		Source:      src,
+		Destination: destDir + "/",
+		Direction:   "push",
+		Owner:       strconv.Itoa(os.Geteuid()),
+		Group:       strconv.Itoa(os.Getegid()),
+	}
+	if err := a.Run(context.Background(), false); err != nil {
+		t.Fatal(err)
+	}
+	if status := a.OwnershipStatus(); !strings.Contains(status, "✓") {
+		t.Errorf("OwnershipStatus() = %q", status)
+	}
+}
+
+func TestOwnershipStatusMismatch(t *testing.T) {
+	skipOnWindows(t)
+	path := filepath.Join(t.TempDir(), "f")
+	os.WriteFile(path, []byte("x"), 0o644)
+	o := ownership{owner: "nobody", uid: os.Geteuid() + 1, gid: -1}
+	if status := o.status(path); !strings.Contains(status, "want nobody:") {
+		t.Errorf("status = %q", status)
+	}
+	if status := o.status(filepath.Join(t.TempDir(), "missing")); status != "" {
+		t.Errorf("missing file should have no status, got %q", status)
+	}
+}
+
+func TestDirectoryActionOwnership(t *testing.T) {
+	skipOnWindows(t)
+	dir := t.TempDir()
+	src := filepath.Join(dir, "repo", "conf")
+	os.MkdirAll(src, 0o755)
+	os.WriteFile(filepath.Join(src, "a"), []byte("a"), 0o644)
+
+	a := &DirectoryAction{
+		Source:      src,
+		Destination: filepath.Join(dir, "sys") + "/",
+		Direction:   "push",
+		Group:       strconv.Itoa(os.Getegid()),
+	}
+	if err := a.Run(context.Background(), false); err != nil {
+		t.Fatal(err)
+	}
+	if status := a.OwnershipStatus(); !strings.Contains(status, "✓") {
+		t.Errorf("OwnershipStatus() = %q", status)
+	}
+}
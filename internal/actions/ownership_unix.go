@@ -0,0 +1,17 @@
+//go:build !windows
+
+package actions
+
+import (
+	"io/fs"
+	"syscall"
+)
+
+// fileOwner returns the uid and gid recorded in info.
+func fileOwner(info fs.FileInfo) (uid, gid int, ok bool) {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return -1, -1, false
+	}
+	return int(st.Uid), int(st.Gid), true
+}
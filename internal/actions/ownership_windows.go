@@ -0,0 +1,10 @@
+//go:build windows
+
+package actions
+
+import "io/fs"
+
+// fileOwner is unsupported on Windows, where files have no uid/gid.
+func fileOwner(info fs.FileInfo) (uid, gid int, ok bool) {
+	return -1, -1, false
+}
@@ -6,8 +6,6 @@ import (
 	"os"
 	"os/exec"
 	"strings"
-
-	"github.com/atomikpanda/dotular/internal/color"
 )
 
 // PackageAction installs a package via the specified package manager.
@@ -16,27 +14,170 @@ import (
 // package manager (e.g. `brew list`, `winget list`) to check whether the
 // package is already installed. If the check command is unavailable the
 // query is skipped and the install proceeds normally.
+//
+// Mac App Store packages (via: mas) may be given by app name instead of
+// numeric ID; the name is resolved with `mas search`. Flatpak packages may
+// be app IDs or refs and are installed from Remote, which is added first
+// when its URL is known. Snaps can be classic and follow a Channel; an
+// installed snap on another channel is refreshed onto it. Winget packages
+// install from Remote as their source. A scoop package given as
+// "bucket/app" has its bucket added first when it is missing.
+//
+// Options are passed through to the install command after the defaults,
+// which make Windows installs silent and non-interactive.
 type PackageAction struct {
 	Package string
 	Manager string // e.g. "brew", "winget", "apt"
+
+	Remote    string // flatpak remote, e.g. "flathub", or winget source, e.g. "msstore"
+	RemoteURL string // .flatpakrepo URL for adding Remote
+	Channel   string // snap channel, e.g. "edge" or "1.x/stable"
+	Classic   bool   // snap classic confinement
+	Options   []string
 }
 
 func (a *PackageAction) Describe() string {
-	return fmt.Sprintf("install package %q via %s", a.Package, a.Manager)
+	desc := fmt.Sprintf("install package %q via %s", a.Package, a.Manager)
+	var opts []string
+	if a.Remote != "" {
+		opts = append(opts, "from "+a.Remote)
+	}
+	if a.Classic {
+		opts = append(opts, "classic")
+	}
+	if a.Channel != "" {
+		opts = append(opts, "channel "+a.Channel)
+	}
+	if len(opts) > 0 {
+		desc += " (" + strings.Join(opts, ", ") + ")"
+	}
+	return desc
 }
 
 func (a *PackageAction) Run(ctx context.Context, dryRun bool) error {
-	args, err := installArgs(a.Manager, a.Package)
+	pkg, err := a.resolve(ctx)
 	if err != nil {
 		return err
 	}
+	args, err := a.installCommand(ctx, pkg)
+	if err != nil {
+		return err
+	}
+	if a.Manager == "flatpak" && a.Remote != "" {
+		if err := flatpakAddRemote(ctx, a.Remote, a.RemoteURL, dryRun); err != nil {
+			return err
+		}
+	}
+	if bucket, _, ok := strings.Cut(pkg, "/"); ok && a.Manager == "scoop" {
+		if err := scoopAddBucket(ctx, bucket, "", dryRun); err != nil {
+			return err
+		}
+	}
 	if dryRun {
-		fmt.Printf("    %s\n", color.Dim(fmt.Sprintf("[dry-run] %s %s", args[0], strings.Join(args[1:], " "))))
+		reportDryRun(ctx, "%s %s", args[0], strings.Join(args[1:], " "))
 		return nil
 	}
-	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
+	if a.Manager == "mas" {
+		if err := masCheckSignedIn(ctx); err != nil {
+			return err
+		}
+	}
+	cmd := command(ctx, args[0], args[1:]...)
+	cmd.Stdin = os.Stdin
+	return cmd.Run()
+}
+
+// installCommand returns the command installing pkg with the action's
+// remote, channel, and confinement options, followed by Options.
+func (a *PackageAction) installCommand(ctx context.Context, pkg string) ([]string, error) {
+	refresh := false
+	if a.Manager == "snap" && a.Channel != "" {
+		_, refresh = snapTracking(ctx, pkg)
+	}
+	return a.installCommandFor(pkg, refresh)
+}
+
+// ScriptCommands returns the commands that install the package, for an
+// exported script: adding a flatpak remote or scoop bucket when needed, then
+// the install itself. Unlike Run it does not query the machine, so mas
+// packages must be given by App Store ID and snaps are always installed
+// rather than refreshed onto their channel.
+func (a *PackageAction) ScriptCommands() ([][]string, error) {
+	install, err := a.installCommandFor(a.Package, false)
+	if err != nil {
+		return nil, err
+	}
+	var cmds [][]string
+	if a.Manager == "flatpak" && a.Remote != "" {
+		url := a.RemoteURL
+		if url == "" {
+			url = flatpakRemoteURLs[a.Remote]
+		}
+		if url != "" {
+			cmds = append(cmds, []string{"flatpak", "remote-add", "--if-not-exists", a.Remote, url})
+		}
+	}
+	if bucket, _, ok := strings.Cut(a.Package, "/"); ok && a.Manager == "scoop" {
+		cmds = append(cmds, []string{"scoop", "bucket", "add", bucket})
+	}
+	return append(cmds, install), nil
+}
+
+// installCommandFor is installCommand with refresh telling whether a snap
+// on a channel is already installed and should be refreshed instead.
+func (a *PackageAction) installCommandFor(pkg string, refresh bool) ([]string, error) {
+	args, err := installArgs(a.Manager, pkg)
+	if err != nil {
+		return nil, err
+	}
+	switch a.Manager {
+	case "flatpak":
+		if a.Remote != "" {
+			// flatpak install -y --noninteractive <remote> <ref>
+			args = append(args[:len(args)-1], "--noninteractive", a.Remote, pkg)
+		}
+	case "snap":
+		if a.Channel != "" {
+			if refresh {
+				args = []string{"sudo", "snap", "refresh", pkg}
+			}
+			args = append(args, "--channel="+a.Channel)
+		}
+		if a.Classic && args[2] == "install" {
+			args = append(args, "--classic")
+		}
+	case "winget":
+		if a.Remote != "" {
+			args = append(args, "--source", a.Remote)
+		}
+	}
+	return append(args, a.Options...), nil
+}
+
+// resolve returns the name to pass to the package manager: the App Store ID
+// for mas packages given by name, otherwise Package itself.
+func (a *PackageAction) resolve(ctx context.Context) (string, error) {
+	if a.Manager != "mas" {
+		return a.Package, nil
+	}
+	return masResolve(ctx, a.Package)
+}
+
+// Uninstall removes the package via its package manager.
+func (a *PackageAction) Uninstall(ctx context.Context, dryRun bool) error {
+	pkg, err := a.resolve(ctx)
+	if err != nil {
+		return err
+	}
+	args, err := uninstallArgs(a.Manager, pkg)
+	if err != nil {
+		return err
+	}
+	if dryRun {
+		reportDryRun(ctx, "%s %s", args[0], strings.Join(args[1:], " "))
+		return nil
+	}
+	cmd := command(ctx, args[0], args[1:]...)
 	cmd.Stdin = os.Stdin
 	return cmd.Run()
 }
@@ -44,6 +185,29 @@ func (a *PackageAction) Run(ctx context.Context, dryRun bool) error {
 // IsApplied returns true when the package is already installed according to
 // the package manager. Returns (false, nil) when the check is unsupported.
 func (a *PackageAction) IsApplied(ctx context.Context) (bool, error) {
+	if a.Manager == "mas" {
+		// An unresolvable name or missing mas is reported by Run.
+		id, err := masResolve(ctx, a.Package)
+		if err != nil {
+			return false, nil
+		}
+		installed, err := masInstalled(ctx, id)
+		return installed && err == nil, nil
+	}
+	switch a.Manager {
+	case "flatpak":
+		installed, err := flatpakInstalled(ctx, a.Package)
+		return installed && err == nil, nil
+	case "nix-profile":
+		installed, err := nixProfileInstalled(ctx, a.Package)
+		return installed && err == nil, nil
+	case "snap":
+		tracking, installed := snapTracking(ctx, a.Package)
+		if !installed {
+			return false, nil
+		}
+		return a.Channel == "" || snapChannelMatches(tracking, a.Channel), nil
+	}
 	args := CheckArgs(a.Manager, a.Package)
 	if args == nil {
 		return false, nil // no check available for this manager
@@ -61,15 +225,14 @@ func (a *PackageAction) IsApplied(ctx context.Context) (bool, error) {
 }
 
 // CheckArgs returns the command to test whether a package is installed.
-// Returns nil when no check is defined for the manager.
+// Returns nil when no check is defined for the manager. The mas, flatpak,
+// snap, and nix-profile checks in PackageAction.IsApplied are more precise.
 func CheckArgs(manager, pkg string) []string {
 	switch manager {
 	case "brew":
 		return []string{"brew", "list", "--formula", pkg}
 	case "brew-cask":
 		return []string{"brew", "list", "--cask", pkg}
-	case "mas":
-		return []string{"mas", "list"} // imprecise but side-effect free
 	case "winget":
 		return []string{"winget", "list", "--id", pkg, "-e"}
 	case "choco":
@@ -95,6 +258,12 @@ func CheckArgs(manager, pkg string) []string {
 	}
 }
 
+// InstallCommand returns the command line that installs pkg with manager,
+// so it can be shown without running it.
+func InstallCommand(manager, pkg string) ([]string, error) {
+	return installArgs(manager, pkg)
+}
+
 // installArgs returns the command + arguments needed to install pkg.
 func installArgs(manager, pkg string) ([]string, error) {
 	switch manager {
@@ -105,9 +274,9 @@ func installArgs(manager, pkg string) ([]string, error) {
 	case "mas":
 		return []string{"mas", "install", pkg}, nil
 	case "winget":
-		return []string{"winget", "install", "--id", pkg, "-e", "--accept-source-agreements"}, nil
+		return []string{"winget", "install", "--id", pkg, "-e", "--silent", "--accept-source-agreements", "--accept-package-agreements", "--disable-interactivity"}, nil
 	case "choco":
-		return []string{"choco", "install", pkg, "-y"}, nil
+		return []string{"choco", "install", pkg, "-y", "--no-progress"}, nil
 	case "scoop":
 		return []string{"scoop", "install", pkg}, nil
 	case "apt", "apt-get":
@@ -124,6 +293,44 @@ func installArgs(manager, pkg string) ([]string, error) {
 		return []string{"flatpak", "install", "-y", pkg}, nil
 	case "nix":
 		return []string{"nix-env", "-iA", pkg}, nil
+	case "nix-profile":
+		return []string{"nix", "profile", "install", nixProfileRef(pkg)}, nil
+	default:
+		return nil, fmt.Errorf("unknown package manager: %q", manager)
+	}
+}
+
+// uninstallArgs returns the command + arguments needed to remove pkg.
+func uninstallArgs(manager, pkg string) ([]string, error) {
+	switch manager {
+	case "brew":
+		return []string{"brew", "uninstall", pkg}, nil
+	case "brew-cask":
+		return []string{"brew", "uninstall", "--cask", pkg}, nil
+	case "mas":
+		return []string{"mas", "uninstall", pkg}, nil
+	case "winget":
+		return []string{"winget", "uninstall", "--id", pkg, "-e", "--silent", "--disable-interactivity"}, nil
+	case "choco":
+		return []string{"choco", "uninstall", pkg, "-y"}, nil
+	case "scoop":
+		return []string{"scoop", "uninstall", pkg}, nil
+	case "apt", "apt-get":
+		return []string{"sudo", "apt-get", "remove", "-y", pkg}, nil
+	case "dnf":
+		return []string{"sudo", "dnf", "remove", "-y", pkg}, nil
+	case "yum":
+		return []string{"sudo", "yum", "remove", "-y", pkg}, nil
+	case "pacman":
+		return []string{"sudo", "pacman", "-R", "--noconfirm", pkg}, nil
+	case "snap":
+		return []string{"sudo", "snap", "remove", pkg}, nil
+	case "flatpak":
+		return []string{"flatpak", "uninstall", "-y", pkg}, nil
+	case "nix":
+		return []string{"nix-env", "-e", pkg}, nil
+	case "nix-profile":
+		return []string{"nix", "profile", "remove", nixProfileAttr(pkg)}, nil
 	default:
 		return nil, fmt.Errorf("unknown package manager: %q", manager)
 	}
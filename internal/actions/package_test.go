@@ -2,6 +2,7 @@ package actions
 
 import (
 	"context"
+	"slices"
 	"testing"
 )
 
@@ -35,6 +36,7 @@ func TestInstallArgs(t *testing.T) {
 		{"snap", "code", "sudo", ""},
 		{"flatpak", "org.app", "flatpak", ""},
 		{"nix", "git", "nix-env", ""},
+		{"nix-profile", "git", "nix", ""},
 		{"unknown-mgr", "pkg", "", "unknown package manager"},
 	}
 	for _, tt := range tests {
@@ -145,3 +147,29 @@ func TestPackageActionIsAppliedMissingBinary(t *testing.T) {
 		t.Error("expected false when check binary is missing")
 	}
 }
+
+func TestUninstallArgsCoverInstallManagers(t *testing.T) {
+	for _, m := range []string{"brew", "brew-cask", "mas", "winget", "choco", "scoop", "apt", "apt-get", "dnf", "yum", "pacman", "snap", "flatpak", "nix", "nix-profile"} {
+		if _, err := installArgs(m, "pkg"); err != nil {
+			t.Fatalf("installArgs(%q): %v", m, err)
+		}
+		args, err := uninstallArgs(m, "pkg")
+		if err != nil {
+			t.Errorf("uninstallArgs(%q): %v", m, err)
+			continue
+		}
+		if !slices.Contains(args, "pkg") {
+			t.Errorf("uninstallArgs(%q) = %v, missing package", m, args)
+		}
+	}
+	if _, err := uninstallArgs("unknown-mgr", "pkg"); err == nil {
+		t.Error("expected error for unknown manager")
+	}
+}
+
+func TestPackageActionUninstallUnknownManager(t *testing.T) {
+	a := &PackageAction{Package: "git", Manager: "nonexistent"}
+	if err := a.Uninstall(context.Background(), true); err == nil {
+		t.Error("expected error for unknown manager")
+	}
+}
@@ -0,0 +1,72 @@
+package actions
+
+import (
+	"os"
+	"strings"
+)
+
+// Permissions are Unix octal modes. On Unix they are applied with chmod. On
+// Windows, which has no mode bits, a mode without the owner write bit sets the
+// read-only attribute, and a mode that grants nothing to group or others
+// restricts the ACL to the current user, SYSTEM, and Administrators, the
+// access OpenSSH requires of private keys. Other bits have no Windows
+// equivalent and are ignored there.
+
+// ownerOnly reports whether mode grants nothing to group or others.
+func ownerOnly(mode os.FileMode) bool {
+	return mode&0o077 == 0
+}
+
+// aclEntry is one access control entry as listed by icacls, e.g. principal
+// `BUILTIN\Users` with rights "(I)(RX)".
+type aclEntry struct {
+	Principal string
+	Rights    string
+}
+
+// parseICACLS parses the output of `icacls path`: the path followed by the
+// first entry, further entries indented on their own lines, and a summary.
+func parseICACLS(path, out string) []aclEntry {
+	var acl []aclEntry
+	for i, line := range strings.Split(strings.ReplaceAll(out, "\r\n", "\n"), "\n") {
+		if i == 0 {
+			line = strings.TrimPrefix(line, path)
+		}
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "Successfully processed") {
+			continue
+		}
+		sep := strings.Index(line, ":(")
+		if sep < 0 {
+			continue
+		}
+		acl = append(acl, aclEntry{Principal: line[:sep], Rights: line[sep+1:]})
+	}
+	return acl
+}
+
+// foreignEntries returns the entries of acl that grant access to anyone
+// other than user, SYSTEM, or the Administrators group.
+func foreignEntries(acl []aclEntry, user string) []aclEntry {
+	var out []aclEntry
+	for _, e := range acl {
+		p := strings.ToLower(e.Principal)
+		if p == strings.ToLower(user) || strings.HasSuffix(p, `\system`) || strings.HasSuffix(p, `\administrators`) {
+			continue
+		}
+		out = append(out, e)
+	}
+	return out
+}
+
+// windowsModeLabel describes the Windows state that stands in for a mode.
+func windowsModeLabel(readOnly, restricted bool) string {
+	label := "writable"
+	if readOnly {
+		label = "read-only"
+	}
+	if restricted {
+		return label + ", owner only"
+	}
+	return label + ", shared"
+}
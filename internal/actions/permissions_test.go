@@ -0,0 +1,50 @@
+package actions
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestParseICACLS(t *testing.T) {
+	path := `C:\Users\me\.ssh\id ed25519`
+	out := path + " NT AUTHORITY\\SYSTEM:(F)\r\n" +
+		"                             BUILTIN\\Administrators:(I)(F)\r\n" +
+		"                             DESKTOP\\me:(F)\r\n" +
+		"                             BUILTIN\\Users:(I)(RX)\r\n" +
+		"\r\n" +
+		"Successfully processed 1 files; Failed processing 0 files\r\n"
+	acl := parseICACLS(path, out)
+	if len(acl) != 4 {
+		t.Fatalf("acl = %+v, want 4 entries", acl)
+	}
+	if acl[0].Principal != `NT AUTHORITY\SYSTEM` || acl[0].Rights != "(F)" {
+		t.Errorf("first entry = %+v", acl[0])
+	}
+	foreign := foreignEntries(acl, `desktop\ME`)
+	if len(foreign) != 1 || foreign[0].Principal != `BUILTIN\Users` {
+		t.Errorf("foreign = %+v, want only BUILTIN\\Users", foreign)
+	}
+}
+
+func TestSetMode(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("mode bits are not kept on windows")
+	}
+	path := filepath.Join(t.TempDir(), "key")
+	if err := os.WriteFile(path, []byte("secret"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	info, _ := os.Stat(path)
+	if ok, got := modeState(path, info, 0o600); ok || got != "0644" {
+		t.Errorf("modeState = %v, %q; want a mismatch showing 0644", ok, got)
+	}
+	if err := setMode(path, info, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	info, _ = os.Stat(path)
+	if ok, _ := modeState(path, info, 0o600); !ok {
+		t.Errorf("mode = %04o, want 0600", info.Mode().Perm())
+	}
+}
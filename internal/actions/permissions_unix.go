@@ -0,0 +1,27 @@
+//go:build !windows
+
+package actions
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+)
+
+// setMode chmods path to mode unless info shows it already has it.
+func setMode(path string, info fs.FileInfo, mode os.FileMode) error {
+	if info.Mode().Perm() == mode {
+		return nil
+	}
+	if err := os.Chmod(path, mode); err != nil {
+		return fmt.Errorf("chmod %s to %04o: %w", path, mode, err)
+	}
+	return nil
+}
+
+// modeState reports whether path, described by info, has mode, and its
+// actual mode for display.
+func modeState(path string, info fs.FileInfo, mode os.FileMode) (bool, string) {
+	actual := info.Mode().Perm()
+	return actual == mode, fmt.Sprintf("%04o", actual)
+}
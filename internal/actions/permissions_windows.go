@@ -0,0 +1,86 @@
+//go:build windows
+
+package actions
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"os/user"
+	"strings"
+)
+
+// setMode applies the Windows equivalent of mode to path: the read-only
+// attribute, and for owner-only modes an ACL without inherited or foreign
+// entries.
+func setMode(path string, info fs.FileInfo, mode os.FileMode) error {
+	readOnly := mode&0o200 == 0
+	if (info.Mode().Perm()&0o200 == 0) != readOnly {
+		if err := os.Chmod(path, mode); err != nil {
+			return fmt.Errorf("set read-only attribute of %s: %w", path, err)
+		}
+	}
+	if !ownerOnly(mode) {
+		return nil
+	}
+	if restricted, err := aclRestricted(path); err != nil || restricted {
+		return err
+	}
+	u, err := user.Current()
+	if err != nil {
+		return fmt.Errorf("restrict %s: %w", path, err)
+	}
+	grant := u.Username + ":(F)"
+	if info.IsDir() {
+		grant = u.Username + ":(OI)(CI)(F)"
+	}
+	if _, err := icacls(path, "/inheritance:r", "/grant:r", grant); err != nil {
+		return err
+	}
+	acl, err := icacls(path)
+	if err != nil {
+		return err
+	}
+	for _, e := range foreignEntries(acl, u.Username) {
+		if _, err := icacls(path, "/remove:g", e.Principal); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// modeState reports whether path has the Windows equivalent of mode, and
+// its actual state for display.
+func modeState(path string, info fs.FileInfo, mode os.FileMode) (bool, string) {
+	readOnly := info.Mode().Perm()&0o200 == 0
+	restricted, err := aclRestricted(path)
+	if err != nil {
+		return false, "unknown ACL"
+	}
+	ok := readOnly == (mode&0o200 == 0) && (!ownerOnly(mode) || restricted)
+	return ok, windowsModeLabel(readOnly, restricted)
+}
+
+// aclRestricted reports whether only the current user, SYSTEM, and
+// Administrators have access to path.
+func aclRestricted(path string) (bool, error) {
+	u, err := user.Current()
+	if err != nil {
+		return false, err
+	}
+	acl, err := icacls(path)
+	if err != nil {
+		return false, err
+	}
+	return len(foreignEntries(acl, u.Username)) == 0, nil
+}
+
+// icacls runs icacls on path with args and parses the ACL it lists.
+func icacls(path string, args ...string) ([]aclEntry, error) {
+	out, err := exec.Command("icacls", append([]string{path}, args...)...).CombinedOutput()
+	if err != nil {
+		return nil, fmt.Errorf("icacls %s %s: %w: %s", path, strings.Join(args, " "), err, strings.TrimSpace(string(out)))
+	}
+	return parseICACLS(path, string(out)), nil
+}
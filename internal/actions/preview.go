@@ -0,0 +1,66 @@
+package actions
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+
+	"github.com/atomikpanda/dotular/internal/diff"
+)
+
+// Change kinds reported by Preview.
+const (
+	ChangeCreated   = "created"
+	ChangeModified  = "modified"
+	ChangeUnchanged = "unchanged"
+)
+
+// Change is the effect Run would have on an action's destination. Diff is a
+// unified diff from the current to the new content when a text file would be
+// modified, and empty otherwise.
+type Change struct {
+	Kind string
+	Diff string
+}
+
+// Preview implements Previewer for push items by comparing the repo file's
+// plaintext and permissions with the destination's. Links, pulls, and syncs
+// return the zero Change.
+func (a *FileAction) Preview(ctx context.Context) (Change, error) {
+	if a.Link || a.Direction == "pull" || a.Direction == "sync" {
+		return Change{}, nil
+	}
+	target := a.ResolvedTarget()
+	sysData, err := os.ReadFile(target)
+	if errors.Is(err, fs.ErrNotExist) {
+		return Change{Kind: ChangeCreated}, nil
+	}
+	if err != nil {
+		return Change{}, err
+	}
+	repoData, err := a.plaintext(a.RepoPath())
+	if err != nil {
+		return Change{}, err
+	}
+	if !bytes.Equal(repoData, sysData) {
+		ch := Change{Kind: ChangeModified}
+		if bytes.IndexByte(repoData, 0) < 0 && bytes.IndexByte(sysData, 0) < 0 {
+			ch.Diff = diff.Unified("system: "+target, "repo: "+a.Source, string(sysData), string(repoData), 3)
+		}
+		return ch, nil
+	}
+	if a.Permissions != "" {
+		mode, err := parseMode(a.Permissions)
+		if err != nil {
+			return Change{}, err
+		}
+		if info, err := os.Stat(target); err == nil {
+			if ok, _ := modeState(target, info, mode); !ok {
+				return Change{Kind: ChangeModified}, nil
+			}
+		}
+	}
+	return Change{Kind: ChangeUnchanged}, nil
+}
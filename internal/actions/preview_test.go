@@ -0,0 +1,75 @@
+package actions
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFilePreview(t *testing.T) {
+	ctx := context.Background()
+	repo, sys := t.TempDir(), t.TempDir()
+	src := filepath.Join(repo, "init.lua")
+	if err := os.WriteFile(src, []byte("a\nb\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	var _ Previewer = (*FileAction)(nil)
+	fa := &FileAction{Source: src, Destination: sys, Direction: "push"}
+	target := filepath.Join(sys, "init.lua")
+
+	if ch, err := fa.Preview(ctx); err != nil || ch.Kind != ChangeCreated {
+		t.Errorf("missing destination: Preview() = %+v, %v; want created", ch, err)
+	}
+
+	if err := os.WriteFile(target, []byte("a\nc\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	ch, err := fa.Preview(ctx)
+	if err != nil || ch.Kind != ChangeModified {
+		t.Fatalf("differing destination: Preview() = %+v, %v; want modified", ch, err)
+	}
+	if !strings.Contains(ch.Diff, "-c\n") || !strings.Contains(ch.Diff, "+b\n") {
+		t.Errorf("diff should go from system to repo:\n%s", ch.Diff)
+	}
+
+	if err := os.WriteFile(target, []byte("a\nb\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if ch, err := fa.Preview(ctx); err != nil || ch.Kind != ChangeUnchanged {
+		t.Errorf("equal destination: Preview() = %+v, %v; want unchanged", ch, err)
+	}
+
+	fa.Permissions = "0600"
+	if ch, err := fa.Preview(ctx); err != nil || ch.Kind != ChangeModified || ch.Diff != "" {
+		t.Errorf("wrong permissions: Preview() = %+v, %v; want modified without diff", ch, err)
+	}
+}
+
+func TestFilePreviewBinary(t *testing.T) {
+	repo, sys := t.TempDir(), t.TempDir()
+	src := filepath.Join(repo, "icon.png")
+	if err := os.WriteFile(src, []byte{0, 1}, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(sys, "icon.png"), []byte{0, 2}, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	fa := &FileAction{Source: src, Destination: sys, Direction: "push"}
+	if ch, err := fa.Preview(context.Background()); err != nil || ch.Kind != ChangeModified || ch.Diff != "" {
+		t.Errorf("Preview() = %+v, %v; want modified without diff", ch, err)
+	}
+}
+
+func TestFilePreviewNotPush(t *testing.T) {
+	for _, fa := range []*FileAction{
+		{Source: "x", Destination: t.TempDir(), Link: true},
+		{Source: "x", Destination: t.TempDir(), Direction: "pull"},
+		{Source: "x", Destination: t.TempDir(), Direction: "sync"},
+	} {
+		if ch, err := fa.Preview(context.Background()); err != nil || ch.Kind != "" {
+			t.Errorf("%s: Preview() = %+v, %v; want zero Change", fa.Describe(), ch, err)
+		}
+	}
+}
@@ -0,0 +1,262 @@
+package actions
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// RepoAction adds a package source: a brew tap, an apt PPA or sources.list
+// entry (with its signing key), a dnf copr or .repo URL, a choco source, or
+// a scoop bucket ("extras", or "name url" for other buckets).
+//
+// Idempotency: RepoAction implements Idempotent by listing the manager's
+// configured sources (brew tap, the apt sources directory, dnf copr list
+// and the yum repos directory, choco source list, scoop bucket list).
+type RepoAction struct {
+	Repo    string
+	Manager string // brew | apt | dnf | choco | scoop
+	KeyURL  string // apt: signing key, referenced with signed-by
+}
+
+// apt and dnf source locations, variables for tests.
+var (
+	aptSourcesDir = "/etc/apt/sources.list.d"
+	aptKeyringDir = "/etc/apt/keyrings"
+	yumReposDir   = "/etc/yum.repos.d"
+)
+
+func (a *RepoAction) Describe() string {
+	kind := map[string]string{"brew": "tap", "dnf": "repo", "choco": "source", "scoop": "bucket"}[a.Manager]
+	if a.Manager == "apt" {
+		kind = "source"
+		if strings.HasPrefix(a.Repo, "ppa:") {
+			kind = "PPA"
+		}
+	}
+	if a.Manager == "dnf" && !isURL(a.Repo) {
+		kind = "copr"
+	}
+	return fmt.Sprintf("add %s %s via %s", kind, a.Repo, a.Manager)
+}
+
+func (a *RepoAction) Run(ctx context.Context, dryRun bool) error {
+	steps, err := a.Commands()
+	if err != nil {
+		return err
+	}
+	if dryRun {
+		for _, args := range steps {
+			reportDryRun(ctx, "%s", strings.Join(args, " "))
+		}
+		if a.Manager == "apt" && !strings.HasPrefix(a.Repo, "ppa:") {
+			reportDryRun(ctx, "write %s", a.aptListPath())
+		}
+		return nil
+	}
+	if a.Manager == "apt" && !strings.HasPrefix(a.Repo, "ppa:") {
+		if err := a.writeAptSource(ctx); err != nil {
+			return err
+		}
+	}
+	for _, args := range steps {
+		cmd := command(ctx, args[0], args[1:]...)
+		cmd.Stdin = os.Stdin
+		if err := cmd.Run(); err != nil {
+			return fmt.Errorf("%s: %w", strings.Join(args, " "), err)
+		}
+	}
+	return nil
+}
+
+// Commands returns the commands that add the source. An apt sources.list
+// entry is written by Run itself; its command only refreshes the index.
+func (a *RepoAction) Commands() ([][]string, error) {
+	switch a.Manager {
+	case "brew":
+		return [][]string{{"brew", "tap", a.Repo}}, nil
+	case "apt":
+		if strings.HasPrefix(a.Repo, "ppa:") {
+			// add-apt-repository refreshes the package index itself.
+			return [][]string{{"sudo", "add-apt-repository", "-y", a.Repo}}, nil
+		}
+		return [][]string{{"sudo", "apt-get", "update"}}, nil
+	case "dnf":
+		if isURL(a.Repo) {
+			return [][]string{{"sudo", "dnf", "config-manager", "--add-repo", a.Repo}}, nil
+		}
+		return [][]string{{"sudo", "dnf", "copr", "enable", "-y", a.Repo}}, nil
+	case "choco":
+		return [][]string{{"choco", "source", "add", "--name=" + repoName(a.Repo), "--source=" + a.Repo}}, nil
+	case "scoop":
+		return [][]string{append([]string{"scoop", "bucket", "add"}, strings.Fields(a.Repo)...)}, nil
+	default:
+		return nil, fmt.Errorf("repositories are not supported for %q (want brew, apt, dnf, choco, or scoop)", a.Manager)
+	}
+}
+
+// IsApplied reports whether the source is already configured.
+func (a *RepoAction) IsApplied(ctx context.Context) (bool, error) {
+	switch a.Manager {
+	case "brew":
+		out, err := quietOutput(ctx, "brew", "tap")
+		return err == nil && containsLine(out, strings.ToLower(a.Repo)), nil
+	case "apt":
+		if strings.HasPrefix(a.Repo, "ppa:") {
+			return aptHasPPA(a.Repo), nil
+		}
+		data, err := os.ReadFile(a.aptListPath())
+		return err == nil && strings.TrimSpace(string(data)) == a.aptLine(), nil
+	case "dnf":
+		if isURL(a.Repo) {
+			_, err := os.Stat(filepath.Join(yumReposDir, pathBase(a.Repo)))
+			return err == nil, nil
+		}
+		out, err := quietOutput(ctx, "dnf", "copr", "list")
+		return err == nil && strings.Contains(out, "/"+a.Repo), nil
+	case "choco":
+		out, err := quietOutput(ctx, "choco", "source", "list", "--limit-output")
+		return err == nil && strings.Contains(out, repoName(a.Repo)+"|"), nil
+	case "scoop":
+		bucket, _, _ := strings.Cut(a.Repo, " ")
+		return scoopHasBucket(ctx, bucket), nil
+	default:
+		return false, nil
+	}
+}
+
+// aptListPath is the sources.list.d file dotular writes the entry to.
+func (a *RepoAction) aptListPath() string {
+	return filepath.Join(aptSourcesDir, "dotular-"+repoName(aptURL(a.Repo))+".list")
+}
+
+// aptKeyPath is the keyring the entry's signed-by option points at.
+func (a *RepoAction) aptKeyPath() string {
+	return filepath.Join(aptKeyringDir, "dotular-"+repoName(aptURL(a.Repo))+".gpg")
+}
+
+// aptLine returns the sources.list entry, adding signed-by for KeyURL when
+// the entry does not set its own options.
+func (a *RepoAction) aptLine() string {
+	line := strings.TrimSpace(a.Repo)
+	if a.KeyURL == "" || strings.Contains(line, "[") {
+		return line
+	}
+	kind, rest, _ := strings.Cut(line, " ")
+	return fmt.Sprintf("%s [signed-by=%s] %s", kind, a.aptKeyPath(), rest)
+}
+
+// writeAptSource installs the signing key, dearmoring it when needed, and
+// the sources.list.d entry.
+func (a *RepoAction) writeAptSource(ctx context.Context) error {
+	if a.KeyURL != "" {
+		path, err := fetch(ctx, a.KeyURL)
+		if err != nil {
+			return fmt.Errorf("download key %s: %w", a.KeyURL, err)
+		}
+		key, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if bytes.Contains(key, []byte("-----BEGIN PGP")) {
+			var out bytes.Buffer
+			cmd := command(ctx, "gpg", "--dearmor")
+			cmd.Stdin, cmd.Stdout = bytes.NewReader(key), &out
+			if err := cmd.Run(); err != nil {
+				return fmt.Errorf("dearmor key %s: %w", a.KeyURL, err)
+			}
+			key = out.Bytes()
+		}
+		if err := writeSystemFile(ctx, a.aptKeyPath(), key); err != nil {
+			return err
+		}
+	}
+	return writeSystemFile(ctx, a.aptListPath(), []byte(a.aptLine()+"\n"))
+}
+
+// writeSystemFile writes a root-owned configuration file, through sudo
+// when the directory is not writable by the current user.
+func writeSystemFile(ctx context.Context, path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err == nil {
+		if err := os.WriteFile(path, data, 0o644); err == nil {
+			return nil
+		}
+	}
+	tmp, err := os.CreateTemp("", "dotular-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	tmp.Close()
+	if err := command(ctx, "sudo", "install", "-D", "-m", "0644", tmp.Name(), path).Run(); err != nil {
+		return fmt.Errorf("write %s: %w", path, err)
+	}
+	return nil
+}
+
+// aptHasPPA reports whether a sources file references the PPA.
+func aptHasPPA(ppa string) bool {
+	owner, name, _ := strings.Cut(strings.TrimPrefix(ppa, "ppa:"), "/")
+	if name == "" {
+		name = "ppa"
+	}
+	needle := "/" + owner + "/" + name + "/"
+	files, _ := filepath.Glob(filepath.Join(aptSourcesDir, "*"))
+	for _, f := range files {
+		data, err := os.ReadFile(f)
+		if err == nil && strings.Contains(string(data), needle) && strings.Contains(string(data), "launchpad") {
+			return true
+		}
+	}
+	return false
+}
+
+var debURL = regexp.MustCompile(`\w+://\S+`)
+
+// aptURL returns the archive URL of a sources.list entry.
+func aptURL(line string) string {
+	if u := debURL.FindString(line); u != "" {
+		return u
+	}
+	return line
+}
+
+var nonName = regexp.MustCompile(`[^a-z0-9]+`)
+
+// repoName derives a file or source name from a repository URL, e.g.
+// "repo-charm-sh-apt" for https://repo.charm.sh/apt/.
+func repoName(repo string) string {
+	if u, err := url.Parse(repo); err == nil && u.Host != "" {
+		repo = u.Host + u.Path
+	}
+	return strings.Trim(nonName.ReplaceAllString(strings.ToLower(repo), "-"), "-")
+}
+
+func isURL(s string) bool {
+	return strings.HasPrefix(s, "http://") || strings.HasPrefix(s, "https://")
+}
+
+func pathBase(rawURL string) string {
+	if u, err := url.Parse(rawURL); err == nil {
+		return filepath.Base(u.Path)
+	}
+	return filepath.Base(rawURL)
+}
+
+func containsLine(out, want string) bool {
+	for _, line := range strings.Split(out, "\n") {
+		if strings.TrimSpace(line) == want {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,79 @@
+package actions
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRepoName(t *testing.T) {
+	tests := map[string]string{
+		"https://repo.charm.sh/apt/":               "repo-charm-sh-apt",
+		"https://download.docker.com/linux/ubuntu": "download-docker-com-linux-ubuntu",
+		"https://community.chocolatey.org/api/v2/": "community-chocolatey-org-api-v2",
+		"deb https://repo.charm.sh/apt/ * *":       "deb-https-repo-charm-sh-apt",
+	}
+	for repo, want := range tests {
+		if got := repoName(repo); got != want {
+			t.Errorf("repoName(%q) = %q, want %q", repo, got, want)
+		}
+	}
+	if got := repoName(aptURL("deb https://repo.charm.sh/apt/ * *")); got != "repo-charm-sh-apt" {
+		t.Errorf("repoName(aptURL(...)) = %q", got)
+	}
+}
+
+func TestRepoActionAptLine(t *testing.T) {
+	aptKeyringDir = "/keys"
+	t.Cleanup(func() { aptKeyringDir = "/etc/apt/keyrings" })
+
+	a := &RepoAction{Repo: "deb https://repo.charm.sh/apt/ * *", Manager: "apt", KeyURL: "https://repo.charm.sh/apt/gpg.key"}
+	if got, want := a.aptLine(), "deb [signed-by=/keys/dotular-repo-charm-sh-apt.gpg] https://repo.charm.sh/apt/ * *"; got != want {
+		t.Errorf("aptLine = %q, want %q", got, want)
+	}
+	a.Repo = "deb [arch=amd64] https://repo.charm.sh/apt/ * *"
+	if got := a.aptLine(); got != a.Repo {
+		t.Errorf("aptLine with options = %q, want it unchanged", got)
+	}
+}
+
+func TestRepoActionAptIsApplied(t *testing.T) {
+	dir := t.TempDir()
+	aptSourcesDir = dir
+	t.Cleanup(func() { aptSourcesDir = "/etc/apt/sources.list.d" })
+	ctx := context.Background()
+
+	ppa := &RepoAction{Repo: "ppa:neovim-ppa/unstable", Manager: "apt"}
+	if ok, _ := ppa.IsApplied(ctx); ok {
+		t.Error("PPA reported applied before its sources file exists")
+	}
+	line := "deb https://ppa.launchpadcontent.net/neovim-ppa/unstable/ubuntu jammy main\n"
+	if err := os.WriteFile(filepath.Join(dir, "neovim-ppa-ubuntu-unstable-jammy.list"), []byte(line), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if ok, _ := ppa.IsApplied(ctx); !ok {
+		t.Error("PPA not reported applied")
+	}
+
+	src := &RepoAction{Repo: "deb https://repo.charm.sh/apt/ * *", Manager: "apt"}
+	if ok, _ := src.IsApplied(ctx); ok {
+		t.Error("source reported applied before it is written")
+	}
+	if err := src.writeAptSource(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "dotular-repo-charm-sh-apt.list")); err != nil {
+		t.Fatal(err)
+	}
+	if ok, _ := src.IsApplied(ctx); !ok {
+		t.Error("source not reported applied after it was written")
+	}
+}
+
+func TestRepoActionUnsupportedManager(t *testing.T) {
+	a := &RepoAction{Repo: "x", Manager: "pacman"}
+	if err := a.Run(context.Background(), true); err == nil {
+		t.Error("expected an error for an unsupported manager")
+	}
+}
@@ -0,0 +1,132 @@
+package actions
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/atomikpanda/dotular/internal/color"
+	"github.com/atomikpanda/dotular/internal/diff"
+)
+
+// Level is the importance of a reported event.
+type Level int
+
+const (
+	LevelDetail Level = iota // secondary lines, such as a dry-run attribute or "already in sync"
+	LevelInfo                // a step the action takes
+	LevelWarn                // something that needs the user's attention, such as a sync conflict
+)
+
+func (l Level) String() string {
+	switch l {
+	case LevelDetail:
+		return "detail"
+	case LevelWarn:
+		return "warn"
+	}
+	return "info"
+}
+
+// MarshalText encodes the level by name in machine-readable events.
+func (l Level) MarshalText() ([]byte, error) { return []byte(l.String()), nil }
+
+// Event kinds.
+const (
+	KindDryRun     = "dry-run"    // what the action would do
+	KindSync       = "sync"       // the direction a sync takes
+	KindConflict   = "conflict"   // a sync conflict was found
+	KindPrompt     = "prompt"     // the choices offered for a conflict; a reply is read from stdin next
+	KindResolution = "resolution" // how a conflict was resolved
+	KindDiff       = "diff"       // a unified diff, uncolored
+	KindSkipped    = "skipped"    // a file left out of a copy, such as one over max_file_size
+)
+
+// Event is a message an action reports while it runs. Message is plain text
+// without color or indentation; reporters format it by Kind and Level.
+type Event struct {
+	Level   Level  `json:"level"`
+	Kind    string `json:"kind"`
+	Message string `json:"message"`
+}
+
+// Reporter receives the events actions report.
+type Reporter interface {
+	Report(Event)
+}
+
+// ReporterFunc adapts a function to a Reporter.
+type ReporterFunc func(Event)
+
+// Report calls f(e).
+func (f ReporterFunc) Report(e Event) { f(e) }
+
+// WithReporter returns a context whose actions report their events to rep
+// instead of printing them to stdout.
+func WithReporter(ctx context.Context, rep Reporter) context.Context {
+	return context.WithValue(ctx, reporterKey, rep)
+}
+
+// report sends an event to the Reporter on ctx, or prints it to stdout when
+// there is none.
+func report(ctx context.Context, level Level, kind, msg string) {
+	rep, ok := ctx.Value(reporterKey).(Reporter)
+	if !ok || rep == nil {
+		rep = NewTextReporter(os.Stdout)
+	}
+	rep.Report(Event{Level: level, Kind: kind, Message: msg})
+}
+
+// reportDryRun reports what an action would do in place of doing it.
+func reportDryRun(ctx context.Context, format string, args ...any) {
+	report(ctx, LevelInfo, KindDryRun, fmt.Sprintf(format, args...))
+}
+
+// NewTextReporter returns a Reporter that writes events to w in dotular's
+// terminal format, indented under the item line.
+func NewTextReporter(w io.Writer) Reporter {
+	return ReporterFunc(func(e Event) {
+		switch e.Kind {
+		case KindDryRun:
+			if e.Level == LevelDetail {
+				fmt.Fprintf(w, "    %s\n", color.Dim("          "+e.Message))
+			} else {
+				fmt.Fprintf(w, "    %s\n", color.Dim("[dry-run] "+e.Message))
+			}
+		case KindConflict:
+			fmt.Fprintf(w, "\n    %s\n", color.BoldYellow(e.Message))
+		case KindPrompt:
+			for _, line := range strings.Split(e.Message, "\n") {
+				fmt.Fprintf(w, "      %s\n", line)
+			}
+			fmt.Fprintf(w, "    %s ", color.Bold(">"))
+		case KindResolution:
+			fmt.Fprintf(w, "    %s %s\n", color.Dim("->"), e.Message)
+		case KindDiff:
+			if e.Level == LevelWarn {
+				fmt.Fprintf(w, "    %s\n", color.Red("diff: "+e.Message))
+				return
+			}
+			if e.Level == LevelDetail {
+				fmt.Fprintf(w, "\n      %s\n\n", color.Dim(e.Message))
+				return
+			}
+			fmt.Fprintln(w)
+			for _, line := range strings.Split(strings.TrimSuffix(diff.Colorize(e.Message), "\n"), "\n") {
+				fmt.Fprintf(w, "      %s\n", line)
+			}
+			fmt.Fprintln(w)
+		default:
+			switch e.Level {
+			case LevelDetail:
+				fmt.Fprintf(w, "    %s\n", color.Dim(e.Message))
+			case LevelWarn:
+				fmt.Fprintf(w, "    %s\n", color.Yellow(e.Message))
+			default:
+				fmt.Fprintf(w, "    %s\n", color.Cyan(e.Message))
+			}
+		}
+	})
+}
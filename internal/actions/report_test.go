@@ -0,0 +1,49 @@
+package actions
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+)
+
+func TestReporterReceivesDryRun(t *testing.T) {
+	var events []Event
+	ctx := WithReporter(context.Background(), ReporterFunc(func(e Event) {
+		events = append(events, e)
+	}))
+	a := &RunAction{Command: "echo hi"}
+	if err := a.Run(ctx, true); err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 1 {
+		t.Fatalf("events = %+v, want 1", events)
+	}
+	if e := events[0]; e.Kind != KindDryRun || e.Level != LevelInfo || e.Message != a.Describe() {
+		t.Errorf("event = %+v", e)
+	}
+}
+
+func TestTextReporterFormat(t *testing.T) {
+	var buf bytes.Buffer
+	rep := NewTextReporter(&buf)
+	rep.Report(Event{Level: LevelInfo, Kind: KindDryRun, Message: "run: echo hi"})
+	rep.Report(Event{Level: LevelDetail, Kind: KindDryRun, Message: "shell: bash"})
+	rep.Report(Event{Level: LevelInfo, Kind: KindResolution, Message: "skipped"})
+	want := "    [dry-run] run: echo hi\n" +
+		"              shell: bash\n" +
+		"    -> skipped\n"
+	if buf.String() != want {
+		t.Errorf("output = %q, want %q", buf.String(), want)
+	}
+}
+
+func TestEventJSON(t *testing.T) {
+	data, err := json.Marshal(Event{Level: LevelWarn, Kind: KindConflict, Message: "CONFLICT"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(data); got != `{"level":"warn","kind":"conflict","message":"CONFLICT"}` {
+		t.Errorf("json = %s", got)
+	}
+}
@@ -1,13 +1,14 @@
 package actions
 
 import (
+	"bytes"
 	"context"
 	"fmt"
+	"io"
 	"os"
-	"os/exec"
-	"runtime"
+	"sort"
 
-	"github.com/atomikpanda/dotular/internal/color"
+	"github.com/atomikpanda/dotular/internal/shell"
 )
 
 // RunAction executes an inline shell command declared directly in the module.
@@ -15,15 +16,21 @@ import (
 // command is written inline rather than as a script file path.
 //
 // The After field records which item type this step logically follows. It is
-// informational only in v1 — ordering is determined by the item's position in
-// the items list. Module authors should place run items after their
-// dependencies in the declaration order.
+// informational only — ordering is determined by the item's phase and its
+// position in the items list. Module authors should place run items after
+// their dependencies, or in a later phase.
 //
 // Idempotency: RunAction does not implement Idempotent. Use skip_if for
 // custom guards.
 type RunAction struct {
 	Command string
-	After   string // informational dependency annotation
+	After   string            // informational dependency annotation
+	Dir     string            // working directory; "" inherits dotular's
+	Env     map[string]string // extra environment variables
+	Shell   string            // see shell.Shell; "" is the platform default
+	Capture bool              // keep stdout for Output
+
+	output bytes.Buffer
 }
 
 func (a *RunAction) Describe() string {
@@ -36,18 +43,38 @@ func (a *RunAction) Describe() string {
 
 func (a *RunAction) Run(ctx context.Context, dryRun bool) error {
 	if dryRun {
-		fmt.Printf("    %s\n", color.Dim("[dry-run] "+a.Describe()))
+		reportDryRun(ctx, "%s", a.Describe())
 		return nil
 	}
 
-	var cmd *exec.Cmd
-	if runtime.GOOS == "windows" {
-		cmd = exec.CommandContext(ctx, "powershell", "-Command", a.Command)
-	} else {
-		cmd = exec.CommandContext(ctx, "sh", "-c", a.Command)
+	args, err := shell.Shell(a.Shell).Args(a.Command)
+	if err != nil {
+		return err
 	}
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
+	cmd := command(ctx, args[0], args[1:]...)
 	cmd.Stdin = os.Stdin
+	cmd.Dir = a.Dir
+	if len(a.Env) > 0 {
+		cmd.Env = append(os.Environ(), envList(a.Env)...)
+	}
+	a.output.Reset()
+	if a.Capture {
+		cmd.Stdout = io.MultiWriter(cmd.Stdout, &a.output)
+	}
 	return cmd.Run()
 }
+
+// Output returns the stdout of the last run when Capture is set.
+func (a *RunAction) Output() string {
+	return a.output.String()
+}
+
+// envList formats env as KEY=value pairs in a stable order.
+func envList(env map[string]string) []string {
+	out := make([]string, 0, len(env))
+	for k, v := range env {
+		out = append(out, k+"="+v)
+	}
+	sort.Strings(out)
+	return out
+}
@@ -1,7 +1,9 @@
 package actions
 
 import (
+	"bytes"
 	"context"
+	"path/filepath"
 	"runtime"
 	"testing"
 )
@@ -48,3 +50,41 @@ func TestRunActionRunFailure(t *testing.T) {
 		t.Error("expected error from Run(false)")
 	}
 }
+
+func TestRunActionCwdEnvCapture(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Unix-only test")
+	}
+	dir := t.TempDir()
+	a := &RunAction{
+		Command: `printf '%s %s' "$(basename "$PWD")" "$GREETING"`,
+		Dir:     dir,
+		Env:     map[string]string{"GREETING": "hi"},
+		Capture: true,
+	}
+	if err := a.Run(context.Background(), false); err != nil {
+		t.Fatal(err)
+	}
+	want := filepath.Base(dir) + " hi"
+	if got := a.Output(); got != want {
+		t.Errorf("Output() = %q, want %q", got, want)
+	}
+}
+
+func TestRunActionNoCapture(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Unix-only test")
+	}
+	var out bytes.Buffer
+	ctx := WithOutput(context.Background(), &out, &out)
+	a := &RunAction{Command: "echo hi"}
+	if err := a.Run(ctx, false); err != nil {
+		t.Fatal(err)
+	}
+	if a.Output() != "" {
+		t.Errorf("Output() = %q without Capture", a.Output())
+	}
+	if out.String() != "hi\n" {
+		t.Errorf("stdout = %q", out.String())
+	}
+}
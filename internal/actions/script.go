@@ -2,20 +2,30 @@ package actions
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
-	"io"
-	"net/http"
+	"net/url"
 	"os"
-	"os/exec"
+	"path"
+	"path/filepath"
 	"runtime"
+	"strings"
 
-	"github.com/atomikpanda/dotular/internal/color"
+	"github.com/atomikpanda/dotular/internal/errs"
 )
 
 // ScriptAction runs a shell script, either from a local path or a remote URL.
+//
+// When SHA256 is set the script's content is checked against it before
+// anything is executed, so a tampered or truncated download never runs.
 type ScriptAction struct {
-	Script string
-	Via    string // "remote" or "local"
+	Script      string
+	Via         string   // "remote" or "local"
+	Args        []string // passed to the script
+	Interpreter string   // e.g. "python3", "zsh", "pwsh"; "" is bash (powershell on Windows)
+	SHA256      string   // expected hex digest of the script content
+	Dir         string   // working directory; "" inherits dotular's
 }
 
 func (a *ScriptAction) Describe() string {
@@ -24,36 +34,37 @@ func (a *ScriptAction) Describe() string {
 
 func (a *ScriptAction) Run(ctx context.Context, dryRun bool) error {
 	if dryRun {
-		fmt.Printf("    %s\n", color.Dim(fmt.Sprintf("[dry-run] run script: %s (via %s)", a.Script, a.Via)))
+		args := ""
+		if len(a.Args) > 0 {
+			args = " " + strings.Join(a.Args, " ")
+		}
+		reportDryRun(ctx, "run script: %s%s (via %s)", a.Script, args, a.Via)
 		return nil
 	}
 	switch a.Via {
 	case "remote":
-		return runRemoteScript(ctx, a.Script)
+		return a.runRemote(ctx)
 	case "local", "":
-		return runLocalScript(ctx, a.Script)
+		return a.runLocal(ctx)
 	default:
 		return fmt.Errorf("unknown script source %q; expected \"remote\" or \"local\"", a.Via)
 	}
 }
 
-func runRemoteScript(ctx context.Context, url string) error {
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+func (a *ScriptAction) runRemote(ctx context.Context) error {
+	cached, err := fetch(ctx, a.Script)
 	if err != nil {
-		return err
+		return fmt.Errorf("download %s: %w", a.Script, err)
 	}
-	resp, err := http.DefaultClient.Do(req)
+	script, err := os.ReadFile(cached)
 	if err != nil {
 		return err
 	}
-	defer resp.Body.Close()
-
-	script, err := io.ReadAll(resp.Body)
-	if err != nil {
+	if err := a.checkSum(script); err != nil {
 		return err
 	}
 
-	tmp, err := os.CreateTemp("", "dotular-*.sh")
+	tmp, err := os.CreateTemp("", "dotular-*"+scriptExt(a.Script))
 	if err != nil {
 		return err
 	}
@@ -69,21 +80,78 @@ func runRemoteScript(ctx context.Context, url string) error {
 		return err
 	}
 
-	return execScript(ctx, tmp.Name())
+	return a.exec(ctx, tmp.Name())
 }
 
-func runLocalScript(ctx context.Context, path string) error {
-	return execScript(ctx, path)
+func (a *ScriptAction) runLocal(ctx context.Context) error {
+	// Resolve the path before changing directory so that paths relative to
+	// the repo keep working when Dir is set.
+	script, err := filepath.Abs(a.Script)
+	if err != nil {
+		return err
+	}
+	if a.SHA256 != "" {
+		data, err := os.ReadFile(script)
+		if err != nil {
+			return err
+		}
+		if err := a.checkSum(data); err != nil {
+			return err
+		}
+	}
+	return a.exec(ctx, script)
 }
 
-func execScript(ctx context.Context, path string) error {
-	shell := "bash"
-	if runtime.GOOS == "windows" {
-		shell = "powershell"
-	}
-	cmd := exec.CommandContext(ctx, shell, path)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
+// checkSum verifies data against SHA256 when one is configured.
+func (a *ScriptAction) checkSum(data []byte) error {
+	if a.SHA256 == "" {
+		return nil
+	}
+	sum := sha256.Sum256(data)
+	if got := hex.EncodeToString(sum[:]); !strings.EqualFold(got, a.SHA256) {
+		return fmt.Errorf("script: %w", &errs.ChecksumError{Subject: a.Script, Want: a.SHA256, Got: got})
+	}
+	return nil
+}
+
+func (a *ScriptAction) exec(ctx context.Context, script string) error {
+	args := append(interpreterArgs(a.Interpreter, script), a.Args...)
+	cmd := command(ctx, args[0], args[1:]...)
 	cmd.Stdin = os.Stdin
+	cmd.Dir = a.Dir
 	return cmd.Run()
 }
+
+// interpreterArgs returns the command that runs script. The interpreter may
+// carry its own arguments, e.g. "/usr/bin/env node".
+func interpreterArgs(interpreter, script string) []string {
+	fields := strings.Fields(interpreter)
+	if len(fields) == 0 {
+		if runtime.GOOS == "windows" {
+			fields = []string{"powershell"}
+		} else {
+			fields = []string{"bash"}
+		}
+	}
+	switch filepath.Base(fields[0]) {
+	case "pwsh", "powershell", "pwsh.exe", "powershell.exe":
+		if len(fields) == 1 {
+			fields = append(fields, "-NoProfile", "-File")
+		}
+	case "cmd", "cmd.exe":
+		if len(fields) == 1 {
+			fields = append(fields, "/C")
+		}
+	}
+	return append(fields, script)
+}
+
+// scriptExt keeps a downloaded script's extension, which PowerShell and cmd
+// require to run it.
+func scriptExt(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || path.Ext(u.Path) == "" {
+		return ".sh"
+	}
+	return path.Ext(u.Path)
+}
@@ -2,12 +2,18 @@ package actions
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"path/filepath"
 	"runtime"
+	"strings"
 	"testing"
+
+	"github.com/atomikpanda/dotular/internal/errs"
 )
 
 func TestScriptActionDescribe(t *testing.T) {
@@ -75,3 +81,118 @@ func TestScriptActionUnknownVia(t *testing.T) {
 		t.Error("expected error for unknown via")
 	}
 }
+
+func TestScriptActionArgsAndDir(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Unix-only test")
+	}
+	dir := t.TempDir()
+	work := t.TempDir()
+	script := filepath.Join(dir, "test.sh")
+	os.WriteFile(script, []byte("#!/bin/bash\necho \"$1 $2\" > out\n"), 0o755)
+
+	a := &ScriptAction{Script: script, Via: "local", Args: []string{"a", "b"}, Dir: work}
+	if err := a.Run(context.Background(), false); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(filepath.Join(work, "out"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "a b\n" {
+		t.Errorf("out = %q", data)
+	}
+}
+
+func TestScriptActionInterpreter(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Unix-only test")
+	}
+	dir := t.TempDir()
+	script := filepath.Join(dir, "test")
+	os.WriteFile(script, []byte("exit 3\n"), 0o644)
+
+	a := &ScriptAction{Script: script, Via: "local", Interpreter: "sh"}
+	err := a.Run(context.Background(), false)
+	if err == nil || !strings.Contains(err.Error(), "exit status 3") {
+		t.Errorf("err = %v, want exit status 3", err)
+	}
+}
+
+func TestInterpreterArgs(t *testing.T) {
+	tests := []struct {
+		interpreter string
+		want        string
+	}{
+		{"python3", "python3 s"},
+		{"/usr/bin/env node", "/usr/bin/env node s"},
+		{"pwsh", "pwsh -NoProfile -File s"},
+		{"cmd", "cmd /C s"},
+	}
+	for _, tt := range tests {
+		if got := strings.Join(interpreterArgs(tt.interpreter, "s"), " "); got != tt.want {
+			t.Errorf("interpreterArgs(%q) = %q, want %q", tt.interpreter, got, tt.want)
+		}
+	}
+}
+
+func TestScriptActionRemoteChecksum(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Unix-only test")
+	}
+	body := []byte("#!/bin/bash\ntrue\n")
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(body)
+	}))
+	defer srv.Close()
+	sum := sha256.Sum256(body)
+
+	good := &ScriptAction{Script: srv.URL + "/install.sh", Via: "remote", SHA256: hex.EncodeToString(sum[:])}
+	if err := good.Run(context.Background(), false); err != nil {
+		t.Errorf("matching checksum: %v", err)
+	}
+
+	bad := &ScriptAction{Script: srv.URL + "/install.sh", Via: "remote", SHA256: strings.Repeat("0", 64)}
+	err := bad.Run(context.Background(), false)
+	if !errors.Is(err, errs.ErrChecksumMismatch) {
+		t.Errorf("err = %v, want a checksum mismatch", err)
+	}
+}
+
+func TestScriptActionLocalChecksum(t *testing.T) {
+	dir := t.TempDir()
+	script := filepath.Join(dir, "test.sh")
+	os.WriteFile(script, []byte("touch ran\n"), 0o755)
+
+	a := &ScriptAction{Script: script, Via: "local", SHA256: strings.Repeat("0", 64), Dir: dir}
+	if err := a.Run(context.Background(), false); err == nil {
+		t.Fatal("expected checksum error")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "ran")); err == nil {
+		t.Error("script must not run when its checksum does not match")
+	}
+}
+
+func TestScriptActionRemoteHTTPError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.NotFound(w, r)
+	}))
+	defer srv.Close()
+
+	a := &ScriptAction{Script: srv.URL + "/missing.sh", Via: "remote"}
+	if err := a.Run(context.Background(), false); err == nil || !strings.Contains(err.Error(), "HTTP 404") {
+		t.Errorf("err = %v, want HTTP 404", err)
+	}
+}
+
+func TestScriptExt(t *testing.T) {
+	for url, want := range map[string]string{
+		"https://x/install.ps1":    ".ps1",
+		"https://x/install.sh?v=1": ".sh",
+		"https://x/install":        ".sh",
+	} {
+		if got := scriptExt(url); got != want {
+			t.Errorf("scriptExt(%q) = %q, want %q", url, got, want)
+		}
+	}
+}
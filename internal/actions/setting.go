@@ -3,12 +3,8 @@ package actions
 import (
 	"context"
 	"fmt"
-	"os"
-	"os/exec"
 	"runtime"
 	"strconv"
-
-	"github.com/atomikpanda/dotular/internal/color"
 )
 
 // SettingAction writes a system preference.
@@ -25,7 +21,7 @@ func (a *SettingAction) Describe() string {
 
 func (a *SettingAction) Run(ctx context.Context, dryRun bool) error {
 	if dryRun {
-		fmt.Printf("    %s\n", color.Dim(fmt.Sprintf("[dry-run] set: %s %s = %v", a.Domain, a.Key, a.Value)))
+		reportDryRun(ctx, "set: %s %s = %v", a.Domain, a.Key, a.Value)
 		return nil
 	}
 	switch runtime.GOOS {
@@ -38,19 +34,24 @@ func (a *SettingAction) Run(ctx context.Context, dryRun bool) error {
 	}
 }
 
+// Restarts implements Restarter for preference domains read by a running
+// process, such as com.apple.dock and com.apple.finder.
+func (a *SettingAction) Restarts() []string {
+	if name, ok := restartedBy[a.Domain]; ok {
+		return []string{name}
+	}
+	return nil
+}
+
 func applyMacOSSetting(ctx context.Context, domain, key string, value any) error {
 	typeFlag, val := macOSValueArgs(value)
-	cmd := exec.CommandContext(ctx, "defaults", "write", domain, key, typeFlag, val)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
+	cmd := command(ctx, "defaults", "write", domain, key, typeFlag, val)
 	return cmd.Run()
 }
 
 func applyWindowsSetting(ctx context.Context, regPath, key string, value any) error {
 	regType, regVal := windowsValueArgs(value)
-	cmd := exec.CommandContext(ctx, "reg", "add", regPath, "/v", key, "/t", regType, "/d", regVal, "/f")
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
+	cmd := command(ctx, "reg", "add", regPath, "/v", key, "/t", regType, "/d", regVal, "/f")
 	return cmd.Run()
 }
 
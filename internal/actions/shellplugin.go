@@ -0,0 +1,268 @@
+package actions
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/atomikpanda/dotular/internal/platform"
+)
+
+// ShellPluginAction installs a shell or tmux plugin with a plugin manager,
+// bootstrapping the manager itself when it is missing. Plugins are GitHub
+// "owner/repo" names or git URLs, pinned to Version (a tag, branch, or
+// commit) when it is set; changing the version updates the plugin.
+//
+// oh-my-zsh, zinit, and tpm plugins are git clones in the manager's plugin
+// directory. antidote plugins are lines in ~/.zsh_plugins.txt, which
+// antidote clones on the next shell start. fisher plugins are installed
+// with `fisher install`.
+//
+// Idempotency: ShellPluginAction implements Idempotent by checking the
+// clone's checked-out commit, the plugins file, or `fisher list`.
+type ShellPluginAction struct {
+	Plugin  string
+	Manager string // oh-my-zsh | zinit | antidote | fisher | tpm
+	Version string
+}
+
+// pluginManagers are the git repos of the managers and where they are
+// cloned when bootstrapping. fisher is installed through fish instead.
+var pluginManagers = map[string]struct{ repo, dir string }{
+	"oh-my-zsh": {"ohmyzsh/ohmyzsh", "~/.oh-my-zsh"},
+	"zinit":     {"zdharma-continuum/zinit", "~/.local/share/zinit/zinit.git"},
+	"antidote":  {"mattmc3/antidote", "${ZDOTDIR:-~}/.antidote"},
+	"tpm":       {"tmux-plugins/tpm", "~/.tmux/plugins/tpm"},
+}
+
+// fisherVersion is the fisher release bootstrapped when fish has none, so
+// the script piped into fish is a fixed one rather than whatever the
+// default branch holds.
+const fisherVersion = "4.4.4"
+
+// FisherURL is the fisher script that bootstrapping pipes into fish.
+const FisherURL = "https://raw.githubusercontent.com/jorgebucaran/fisher/" + fisherVersion + "/functions/fisher.fish"
+
+func (a *ShellPluginAction) Describe() string {
+	desc := fmt.Sprintf("install %s plugin %s", a.Manager, a.Plugin)
+	if a.Version != "" {
+		desc += "@" + a.Version
+	}
+	return desc
+}
+
+// Downloads returns where the plugin, and the manager if it has to be
+// bootstrapped, are fetched from.
+func (a *ShellPluginAction) Downloads() []string {
+	urls := []string{gitURL(a.Plugin)}
+	if a.Manager == "fisher" {
+		return append(urls, FisherURL)
+	}
+	if m, ok := pluginManagers[a.Manager]; ok {
+		urls = append(urls, gitURL(m.repo))
+	}
+	return urls
+}
+
+// gitURL returns the clone URL of an "owner/repo" name or URL.
+func gitURL(plugin string) string {
+	if strings.Contains(plugin, "://") || strings.HasPrefix(plugin, "git@") {
+		return plugin
+	}
+	return "https://github.com/" + plugin + ".git"
+}
+
+// pluginName returns the repository name of a plugin, e.g.
+// "zsh-autosuggestions" for zsh-users/zsh-autosuggestions.
+func pluginName(plugin string) string {
+	return strings.TrimSuffix(filepath.Base(strings.TrimSuffix(plugin, "/")), ".git")
+}
+
+// expandHome expands ~ and environment variables, including ${VAR:-default}.
+func expandHome(path string) string {
+	path = os.Expand(path, func(v string) string {
+		name, def, _ := strings.Cut(v, ":-")
+		if val := os.Getenv(name); val != "" {
+			return val
+		}
+		return def
+	})
+	return platform.ExpandPath(path)
+}
+
+// cloneDir returns where a git-based manager keeps the plugin.
+func (a *ShellPluginAction) cloneDir() string {
+	name := pluginName(a.Plugin)
+	switch a.Manager {
+	case "oh-my-zsh":
+		custom := os.Getenv("ZSH_CUSTOM")
+		if custom == "" {
+			custom = filepath.Join(expandHome("${ZSH:-~/.oh-my-zsh}"), "custom")
+		}
+		return filepath.Join(custom, "plugins", name)
+	case "zinit":
+		// zinit names plugin directories "owner---repo".
+		owner := pluginName(filepath.Dir(strings.TrimSuffix(a.Plugin, "/")))
+		return filepath.Join(expandHome("~/.local/share/zinit/plugins"), owner+"---"+name)
+	case "tpm":
+		return filepath.Join(expandHome("~/.tmux/plugins"), name)
+	}
+	return ""
+}
+
+// antidoteLine returns the plugin's line in the antidote plugins file.
+func (a *ShellPluginAction) antidoteLine() string {
+	if a.Version != "" {
+		return a.Plugin + " branch:" + a.Version
+	}
+	return a.Plugin
+}
+
+func antidotePluginsFile() string {
+	return expandHome("${ZDOTDIR:-~}/.zsh_plugins.txt")
+}
+
+func (a *ShellPluginAction) fisherSpec() string {
+	if a.Version != "" {
+		return a.Plugin + "@" + a.Version
+	}
+	return a.Plugin
+}
+
+func (a *ShellPluginAction) Run(ctx context.Context, dryRun bool) error {
+	if err := a.bootstrap(ctx, dryRun); err != nil {
+		return err
+	}
+	switch a.Manager {
+	case "oh-my-zsh", "zinit", "tpm":
+		return gitCheckout(ctx, gitURL(a.Plugin), a.cloneDir(), a.Version, dryRun)
+	case "antidote":
+		path := antidotePluginsFile()
+		if dryRun {
+			reportDryRun(ctx, "add %q to %s", a.antidoteLine(), path)
+			return nil
+		}
+		return setPluginLine(path, a.Plugin, a.antidoteLine())
+	case "fisher":
+		return a.fish(ctx, dryRun, "fisher install $argv", a.fisherSpec())
+	default:
+		return fmt.Errorf("unknown plugin manager %q (want oh-my-zsh, zinit, antidote, fisher, or tpm)", a.Manager)
+	}
+}
+
+// bootstrap installs the plugin manager when it is missing.
+func (a *ShellPluginAction) bootstrap(ctx context.Context, dryRun bool) error {
+	if a.Manager == "fisher" {
+		if err := command(ctx, "fish", "-c", "functions -q fisher").Run(); err == nil {
+			return nil
+		}
+		return a.fish(ctx, dryRun, "curl -fsSL $argv[1] | source && fisher install $argv[2]", FisherURL, "jorgebucaran/fisher@"+fisherVersion)
+	}
+	m, ok := pluginManagers[a.Manager]
+	if !ok {
+		return nil
+	}
+	dir := expandHome(m.dir)
+	if _, err := os.Stat(dir); err == nil {
+		return nil
+	}
+	return gitCheckout(ctx, gitURL(m.repo), dir, "", dryRun)
+}
+
+// fish runs script with fish, passing args as $argv rather than splicing
+// them into the script, so a plugin name cannot run fish code.
+func (a *ShellPluginAction) fish(ctx context.Context, dryRun bool, script string, args ...string) error {
+	if dryRun {
+		reportDryRun(ctx, "fish -c %q -- %s", script, strings.Join(args, " "))
+		return nil
+	}
+	if err := command(ctx, "fish", append([]string{"-c", script, "--"}, args...)...).Run(); err != nil {
+		return fmt.Errorf("fish -c %q -- %s: %w", script, strings.Join(args, " "), err)
+	}
+	return nil
+}
+
+// IsApplied reports whether the plugin is installed at the pinned version.
+func (a *ShellPluginAction) IsApplied(ctx context.Context) (bool, error) {
+	switch a.Manager {
+	case "oh-my-zsh", "zinit", "tpm":
+		return gitAt(ctx, a.cloneDir(), a.Version), nil
+	case "antidote":
+		data, err := os.ReadFile(antidotePluginsFile())
+		return err == nil && containsLine(string(data), a.antidoteLine()), nil
+	case "fisher":
+		out, err := quietOutput(ctx, "fish", "-c", "fisher list")
+		return err == nil && containsLine(out, a.fisherSpec()), nil
+	}
+	return false, nil
+}
+
+// gitCheckout clones url into dir, or fetches when the clone exists, and
+// checks out ref when it is set.
+func gitCheckout(ctx context.Context, url, dir, ref string, dryRun bool) error {
+	_, err := os.Stat(filepath.Join(dir, ".git"))
+	cloned := err == nil
+	var steps [][]string
+	if cloned {
+		if ref != "" {
+			steps = append(steps, []string{"git", "-C", dir, "fetch", "--tags", "origin"})
+		}
+	} else {
+		steps = append(steps, []string{"git", "clone", "--quiet", url, dir})
+	}
+	if ref != "" {
+		steps = append(steps, []string{"git", "-C", dir, "-c", "advice.detachedHead=false", "checkout", "--quiet", ref})
+	}
+	for _, args := range steps {
+		if dryRun {
+			reportDryRun(ctx, "%s", strings.Join(args, " "))
+			continue
+		}
+		if err := command(ctx, args[0], args[1:]...).Run(); err != nil {
+			return fmt.Errorf("%s: %w", strings.Join(args[:4], " "), err)
+		}
+	}
+	return nil
+}
+
+// gitAt reports whether dir is a clone whose HEAD is ref (any commit when
+// ref is empty).
+func gitAt(ctx context.Context, dir, ref string) bool {
+	head, err := quietOutput(ctx, "git", "-C", dir, "rev-parse", "HEAD")
+	if err != nil {
+		return false
+	}
+	if ref == "" {
+		return true
+	}
+	want, err := quietOutput(ctx, "git", "-C", dir, "rev-parse", "--verify", "--quiet", ref+"^{commit}")
+	return err == nil && strings.TrimSpace(head) == strings.TrimSpace(want)
+}
+
+// setPluginLine writes line to the plugins file at path, replacing the
+// plugin's existing line (with any annotations) or appending it.
+func setPluginLine(path, plugin, line string) error {
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	lines := strings.Split(strings.TrimRight(string(data), "\n"), "\n")
+	if len(data) == 0 {
+		lines = nil
+	}
+	found := false
+	for i, l := range lines {
+		if f := strings.Fields(l); len(f) > 0 && f[0] == plugin {
+			lines[i], found = line, true
+		}
+	}
+	if !found {
+		lines = append(lines, line)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0o644)
+}
@@ -0,0 +1,110 @@
+package actions
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+func TestPluginNames(t *testing.T) {
+	if got := gitURL("zsh-users/zsh-autosuggestions"); got != "https://github.com/zsh-users/zsh-autosuggestions.git" {
+		t.Errorf("gitURL = %q", got)
+	}
+	if got := gitURL("git@example.com:me/plugin.git"); got != "git@example.com:me/plugin.git" {
+		t.Errorf("gitURL kept URL = %q", got)
+	}
+	if got := pluginName("https://example.com/me/plugin.git"); got != "plugin" {
+		t.Errorf("pluginName = %q", got)
+	}
+}
+
+func TestFisherPassesSpecAsArgument(t *testing.T) {
+	var msgs []string
+	ctx := WithReporter(context.Background(), ReporterFunc(func(e Event) { msgs = append(msgs, e.Message) }))
+	a := &ShellPluginAction{Plugin: "me/plugin; rm -rf ~", Manager: "fisher", Version: "v1"}
+	if err := a.Run(ctx, true); err != nil {
+		t.Fatal(err)
+	}
+	if last := msgs[len(msgs)-1]; last != `fish -c "fisher install $argv" -- me/plugin; rm -rf ~@v1` {
+		t.Errorf("dry run = %q, want the spec passed after --", last)
+	}
+}
+
+func TestShellPluginCloneDir(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("ZSH", "")
+	t.Setenv("ZSH_CUSTOM", "")
+	tests := map[string]string{
+		"oh-my-zsh": filepath.Join(home, ".oh-my-zsh", "custom", "plugins", "zsh-autosuggestions"),
+		"zinit":     filepath.Join(home, ".local", "share", "zinit", "plugins", "zsh-users---zsh-autosuggestions"),
+		"tpm":       filepath.Join(home, ".tmux", "plugins", "zsh-autosuggestions"),
+	}
+	for manager, want := range tests {
+		a := &ShellPluginAction{Plugin: "zsh-users/zsh-autosuggestions", Manager: manager}
+		if got := a.cloneDir(); got != want {
+			t.Errorf("%s: cloneDir = %q, want %q", manager, got, want)
+		}
+	}
+}
+
+func TestSetPluginLine(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ".zsh_plugins.txt")
+	os.WriteFile(path, []byte("romkatv/zsh-defer\nzsh-users/zsh-autosuggestions branch:v0.6.0\n"), 0o644)
+	if err := setPluginLine(path, "zsh-users/zsh-autosuggestions", "zsh-users/zsh-autosuggestions branch:v0.7.0"); err != nil {
+		t.Fatal(err)
+	}
+	if err := setPluginLine(path, "zdharma-continuum/fast-syntax-highlighting", "zdharma-continuum/fast-syntax-highlighting"); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := os.ReadFile(path)
+	want := "romkatv/zsh-defer\nzsh-users/zsh-autosuggestions branch:v0.7.0\nzdharma-continuum/fast-syntax-highlighting\n"
+	if string(data) != want {
+		t.Errorf("plugins file =\n%s\nwant\n%s", data, want)
+	}
+}
+
+// gitRepo creates a repository with two tagged commits, v1 and v2.
+func gitRepo(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	for _, args := range [][]string{
+		{"init", "--quiet"},
+		{"-c", "user.name=t", "-c", "user.email=t@example.com", "commit", "--quiet", "--allow-empty", "-m", "one"},
+		{"tag", "v1"},
+		{"-c", "user.name=t", "-c", "user.email=t@example.com", "commit", "--quiet", "--allow-empty", "-m", "two"},
+		{"tag", "v2"},
+	} {
+		if out, err := exec.Command("git", append([]string{"-C", dir}, args...)...).CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v\n%s", args, err, out)
+		}
+	}
+	return dir
+}
+
+func TestGitCheckoutPinned(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	repo := gitRepo(t)
+	dir := filepath.Join(t.TempDir(), "plugin")
+	ctx := context.Background()
+
+	if gitAt(ctx, dir, "v1") {
+		t.Error("missing clone reported at v1")
+	}
+	if err := gitCheckout(ctx, repo, dir, "v1", false); err != nil {
+		t.Fatal(err)
+	}
+	if !gitAt(ctx, dir, "v1") || gitAt(ctx, dir, "v2") {
+		t.Error("clone should be at v1 only")
+	}
+	if err := gitCheckout(ctx, repo, dir, "v2", false); err != nil {
+		t.Fatal(err)
+	}
+	if !gitAt(ctx, dir, "v2") {
+		t.Error("bumping the version should move the clone to v2")
+	}
+}
@@ -0,0 +1,242 @@
+package actions
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/atomikpanda/dotular/internal/platform"
+)
+
+// SSHHostAction manages one Host block in the SSH client config and pins
+// the host's keys in known_hosts, leaving the rest of both files alone.
+// The block is delimited by "# BEGIN dotular <host>" and "# END dotular
+// <host>" comments, replaced in place on change, and otherwise inserted
+// before the first "Host *" block so that its options take precedence.
+//
+// Idempotency: SSHHostAction implements Idempotent by comparing the block
+// with the one in the config and looking each key up in known_hosts,
+// including hashed entries.
+type SSHHostAction struct {
+	Host       string
+	Options    map[string]string
+	KnownHosts []string // "<type> <base64 key>"
+
+	ConfigPath     string // default ~/.ssh/config
+	KnownHostsPath string // default ~/.ssh/known_hosts
+}
+
+func (a *SSHHostAction) Describe() string {
+	desc := "configure ssh host " + a.Host
+	if n := len(a.KnownHosts); n > 0 {
+		desc += fmt.Sprintf(" (%d pinned keys)", n)
+	}
+	return desc
+}
+
+func (a *SSHHostAction) configPath() string {
+	if a.ConfigPath != "" {
+		return a.ConfigPath
+	}
+	return platform.ExpandPath("~/.ssh/config")
+}
+
+func (a *SSHHostAction) knownHostsPath() string {
+	if a.KnownHostsPath != "" {
+		return a.KnownHostsPath
+	}
+	return platform.ExpandPath("~/.ssh/known_hosts")
+}
+
+// keyHost returns the name known_hosts entries are recorded under: the
+// HostName option when set, since ssh checks keys against the real host.
+func (a *SSHHostAction) keyHost() string {
+	for k, v := range a.Options {
+		if strings.EqualFold(k, "HostName") {
+			return v
+		}
+	}
+	return a.Host
+}
+
+func (a *SSHHostAction) beginMarker() string { return "# BEGIN dotular " + a.Host }
+func (a *SSHHostAction) endMarker() string   { return "# END dotular " + a.Host }
+
+// block renders the managed Host block, options sorted by name.
+func (a *SSHHostAction) block() []string {
+	keys := make([]string, 0, len(a.Options))
+	for k := range a.Options {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	lines := []string{a.beginMarker(), "Host " + a.Host}
+	for _, k := range keys {
+		lines = append(lines, "    "+k+" "+a.Options[k])
+	}
+	return append(lines, a.endMarker())
+}
+
+// withBlock returns the config lines with the managed block set.
+func (a *SSHHostAction) withBlock(lines []string) []string {
+	block := a.block()
+	begin, end := -1, -1
+	for i, l := range lines {
+		switch strings.TrimSpace(l) {
+		case a.beginMarker():
+			begin = i
+		case a.endMarker():
+			if begin >= 0 && end < 0 {
+				end = i
+			}
+		}
+	}
+	if begin >= 0 && end >= begin {
+		return append(append(append([]string{}, lines[:begin]...), block...), lines[end+1:]...)
+	}
+	at := len(lines)
+	for i, l := range lines {
+		if f := strings.Fields(l); len(f) == 2 && strings.EqualFold(f[0], "Host") && f[1] == "*" {
+			at = i
+			break
+		}
+	}
+	out := append([]string{}, lines[:at]...)
+	if at > 0 && strings.TrimSpace(out[at-1]) != "" {
+		out = append(out, "")
+	}
+	out = append(out, block...)
+	if at < len(lines) {
+		out = append(out, "")
+	}
+	return append(out, lines[at:]...)
+}
+
+func (a *SSHHostAction) Run(ctx context.Context, dryRun bool) error {
+	path := a.configPath()
+	lines, err := readLines(path)
+	if err != nil {
+		return err
+	}
+	updated := a.withBlock(lines)
+	if strings.Join(updated, "\n") != strings.Join(lines, "\n") {
+		if dryRun {
+			reportDryRun(ctx, "write Host %s block to %s", a.Host, path)
+		} else if err := writeSSHFile(path, updated); err != nil {
+			return err
+		}
+	}
+
+	khPath := a.knownHostsPath()
+	known, err := readLines(khPath)
+	if err != nil {
+		return err
+	}
+	var missing []string
+	for _, key := range a.KnownHosts {
+		if !knownHostsHas(known, a.keyHost(), key) {
+			missing = append(missing, a.keyHost()+" "+strings.TrimSpace(key))
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+	if dryRun {
+		reportDryRun(ctx, "pin %d keys for %s in %s", len(missing), a.keyHost(), khPath)
+		return nil
+	}
+	return writeSSHFile(khPath, append(known, missing...))
+}
+
+// IsApplied reports whether the block is in place and every key is pinned.
+func (a *SSHHostAction) IsApplied(ctx context.Context) (bool, error) {
+	lines, err := readLines(a.configPath())
+	if err != nil {
+		return false, nil
+	}
+	if strings.Join(a.withBlock(lines), "\n") != strings.Join(lines, "\n") {
+		return false, nil
+	}
+	known, err := readLines(a.knownHostsPath())
+	if err != nil {
+		return false, nil
+	}
+	for _, key := range a.KnownHosts {
+		if !knownHostsHas(known, a.keyHost(), key) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// knownHostsHas reports whether a known_hosts line pins key ("<type>
+// <base64>") for host, matching plain host lists and hashed "|1|" entries.
+func knownHostsHas(lines []string, host, key string) bool {
+	want := strings.Fields(key)
+	if len(want) < 2 {
+		return false
+	}
+	for _, line := range lines {
+		f := strings.Fields(line)
+		if len(f) < 3 || strings.HasPrefix(f[0], "#") || strings.HasPrefix(f[0], "@") {
+			continue
+		}
+		if f[1] != want[0] || f[2] != want[1] {
+			continue
+		}
+		for _, h := range strings.Split(f[0], ",") {
+			if h == host || hashedHostMatches(h, host) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// hashedHostMatches reports whether a HashKnownHosts entry
+// "|1|<salt>|<hmac>" is for host.
+func hashedHostMatches(entry, host string) bool {
+	parts := strings.Split(entry, "|")
+	if len(parts) != 4 || parts[1] != "1" {
+		return false
+	}
+	salt, err := base64.StdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(sha1.New, salt)
+	mac.Write([]byte(host))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil)) == parts[3]
+}
+
+// readLines returns the lines of path, or none when it does not exist.
+func readLines(path string) ([]string, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	text := strings.TrimRight(string(data), "\n")
+	if text == "" {
+		return nil, nil
+	}
+	return strings.Split(text, "\n"), nil
+}
+
+// writeSSHFile writes lines to path with the permissions ssh insists on.
+func writeSSHFile(path string, lines []string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0o600); err != nil {
+		return fmt.Errorf("write %s: %w", path, err)
+	}
+	return nil
+}
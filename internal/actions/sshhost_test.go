@@ -0,0 +1,87 @@
+package actions
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testHostKey = "ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIOMqqnkVzrm0SdG6UOoqKLsabgH5C9okWi0dh2l9GKJl"
+
+func newSSHHostAction(t *testing.T) *SSHHostAction {
+	dir := t.TempDir()
+	return &SSHHostAction{
+		Host:           "gh",
+		Options:        map[string]string{"HostName": "github.com", "User": "git"},
+		KnownHosts:     []string{testHostKey},
+		ConfigPath:     filepath.Join(dir, "config"),
+		KnownHostsPath: filepath.Join(dir, "known_hosts"),
+	}
+}
+
+func TestSSHHostActionRun(t *testing.T) {
+	a := newSSHHostAction(t)
+	ctx := context.Background()
+	existing := "Include ~/.orbstack/ssh/config\n\nHost *\n    AddKeysToAgent yes\n"
+	os.WriteFile(a.ConfigPath, []byte(existing), 0o600)
+
+	if ok, _ := a.IsApplied(ctx); ok {
+		t.Error("reported applied before the block was written")
+	}
+	if err := a.Run(ctx, false); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := os.ReadFile(a.ConfigPath)
+	want := "Include ~/.orbstack/ssh/config\n\n# BEGIN dotular gh\nHost gh\n    HostName github.com\n    User git\n# END dotular gh\n\nHost *\n    AddKeysToAgent yes\n"
+	if string(data) != want {
+		t.Errorf("config =\n%s\nwant\n%s", data, want)
+	}
+	known, _ := os.ReadFile(a.KnownHostsPath)
+	if string(known) != "github.com "+testHostKey+"\n" {
+		t.Errorf("known_hosts = %q", known)
+	}
+	if ok, _ := a.IsApplied(ctx); !ok {
+		t.Error("not reported applied after running")
+	}
+
+	// Changing an option replaces the block in place.
+	a.Options["User"] = "me"
+	if err := a.Run(ctx, false); err != nil {
+		t.Fatal(err)
+	}
+	data, _ = os.ReadFile(a.ConfigPath)
+	if strings.Count(string(data), "Host gh") != 1 || !strings.Contains(string(data), "User me") {
+		t.Errorf("config after change =\n%s", data)
+	}
+	if info, _ := os.Stat(a.ConfigPath); info.Mode().Perm() != 0o600 {
+		t.Errorf("config mode = %v", info.Mode().Perm())
+	}
+}
+
+func TestKnownHostsHas(t *testing.T) {
+	salt := []byte("0123456789abcdef0123")
+	mac := hmac.New(sha1.New, salt)
+	mac.Write([]byte("github.com"))
+	hashed := "|1|" + base64.StdEncoding.EncodeToString(salt) + "|" + base64.StdEncoding.EncodeToString(mac.Sum(nil))
+
+	tests := []struct {
+		line string
+		want bool
+	}{
+		{"github.com,140.82.121.4 " + testHostKey, true},
+		{hashed + " " + testHostKey, true},
+		{"gitlab.com " + testHostKey, false},
+		{"github.com ssh-rsa AAAAB3NzaC1yc2E", false},
+		{"@revoked github.com " + testHostKey, false},
+	}
+	for _, tt := range tests {
+		if got := knownHostsHas([]string{tt.line}, "github.com", testHostKey); got != tt.want {
+			t.Errorf("knownHostsHas(%q) = %v, want %v", tt.line, got, tt.want)
+		}
+	}
+}
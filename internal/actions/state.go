@@ -0,0 +1,71 @@
+package actions
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+func (a *FileAction) State(ctx context.Context) (current, desired string) {
+	return pathState(a.ResolvedTarget()), directionState(a.Link, a.Direction, a.Source)
+}
+
+func (a *DirectoryAction) State(ctx context.Context) (current, desired string) {
+	return pathState(a.ResolvedTarget()), directionState(a.Link, a.Direction, a.Source)
+}
+
+func (a *BinaryAction) State(ctx context.Context) (current, desired string) {
+	desired = a.Name
+	if a.Version != "" {
+		desired += "@" + a.Version
+	}
+	return pathState(a.InstalledPath()), desired + " from " + a.SourceURL
+}
+
+func (a *SettingAction) State(ctx context.Context) (current, desired string) {
+	desired = fmt.Sprint(a.Value)
+	if runtime.GOOS != "darwin" {
+		return "", desired
+	}
+	out, err := quietOutput(ctx, "defaults", "read", a.Domain, a.Key)
+	if err != nil {
+		return "unset", desired
+	}
+	return strings.TrimSpace(out), desired
+}
+
+// pathState describes what is at path: "missing", "file", "directory", or
+// "symlink -> <target>".
+func pathState(path string) string {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return "missing"
+	}
+	if info.Mode()&os.ModeSymlink != 0 {
+		dest, _ := os.Readlink(path)
+		return "symlink -> " + dest
+	}
+	if info.IsDir() {
+		return "directory"
+	}
+	return "file"
+}
+
+// directionState describes what a file or directory item leaves behind.
+func directionState(link bool, direction, source string) string {
+	if link {
+		abs, _ := filepath.Abs(source)
+		return "symlink -> " + abs
+	}
+	switch direction {
+	case "pull":
+		return "copied into " + source
+	case "sync":
+		return "in sync with " + source
+	default:
+		return "copy of " + source
+	}
+}
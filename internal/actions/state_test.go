@@ -0,0 +1,57 @@
+package actions
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPathState(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "file")
+	if err := os.WriteFile(file, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	link := filepath.Join(dir, "link")
+	if err := os.Symlink(file, link); err != nil {
+		t.Skip("symlinks unavailable:", err)
+	}
+	tests := map[string]string{
+		filepath.Join(dir, "missing"): "missing",
+		file:                          "file",
+		dir:                           "directory",
+		link:                          "symlink -> " + file,
+	}
+	for path, want := range tests {
+		if got := pathState(path); got != want {
+			t.Errorf("pathState(%s) = %q, want %q", path, got, want)
+		}
+	}
+}
+
+func TestActionStates(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+
+	var _ Stater = (*FileAction)(nil)
+	fa := &FileAction{Source: "nvim/init.lua", Destination: dir, Direction: "push"}
+	if cur, want := fa.State(ctx); cur != "missing" || want != "copy of nvim/init.lua" {
+		t.Errorf("FileAction.State() = %q, %q", cur, want)
+	}
+	fa.Link = true
+	if _, want := fa.State(ctx); !strings.HasPrefix(want, "symlink -> ") || !filepath.IsAbs(strings.TrimPrefix(want, "symlink -> ")) {
+		t.Errorf("link desired state = %q, want an absolute symlink", want)
+	}
+
+	da := &DirectoryAction{Source: "nvim", Destination: dir, Direction: "sync"}
+	if cur, want := da.State(ctx); cur != "missing" || want != "in sync with nvim" {
+		t.Errorf("DirectoryAction.State() = %q, %q", cur, want)
+	}
+
+	ba := &BinaryAction{Name: "rg", Version: "14.1.0", SourceURL: "https://example.com/rg.tgz", InstallTo: dir}
+	if cur, want := ba.State(ctx); cur != "missing" || want != "rg@14.1.0 from https://example.com/rg.tgz" {
+		t.Errorf("BinaryAction.State() = %q, %q", cur, want)
+	}
+}
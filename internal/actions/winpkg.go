@@ -0,0 +1,67 @@
+package actions
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// --- scoop -------------------------------------------------------------------
+
+// scoopBuckets returns the names of the added buckets, parsing `scoop
+// bucket list`.
+func scoopBuckets(ctx context.Context) ([]string, error) {
+	out, err := quietOutput(ctx, "scoop", "bucket", "list")
+	if err != nil {
+		return nil, err
+	}
+	return parseScoopBuckets(out), nil
+}
+
+// parseScoopBuckets extracts the bucket names from `scoop bucket list`
+// output, which is a table headed by "Name  Source  Updated  Manifests".
+func parseScoopBuckets(out string) []string {
+	var names []string
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 || fields[0] == "Name" || strings.HasPrefix(fields[0], "-") {
+			continue
+		}
+		names = append(names, fields[0])
+	}
+	return names
+}
+
+// scoopHasBucket reports whether the bucket has been added.
+func scoopHasBucket(ctx context.Context, bucket string) bool {
+	buckets, err := scoopBuckets(ctx)
+	if err != nil {
+		return false
+	}
+	for _, b := range buckets {
+		if strings.EqualFold(b, bucket) {
+			return true
+		}
+	}
+	return false
+}
+
+// scoopAddBucket adds bucket, from url when given (scoop knows the URLs of
+// its official buckets such as "extras"), unless it is already added.
+func scoopAddBucket(ctx context.Context, bucket, url string, dryRun bool) error {
+	args := []string{"bucket", "add", bucket}
+	if url != "" {
+		args = append(args, url)
+	}
+	if dryRun {
+		reportDryRun(ctx, "scoop %s", strings.Join(args, " "))
+		return nil
+	}
+	if scoopHasBucket(ctx, bucket) {
+		return nil
+	}
+	if err := command(ctx, "scoop", args...).Run(); err != nil {
+		return fmt.Errorf("add scoop bucket %s: %w", bucket, err)
+	}
+	return nil
+}
@@ -0,0 +1,42 @@
+package actions
+
+import (
+	"context"
+	"slices"
+	"testing"
+)
+
+func TestParseScoopBuckets(t *testing.T) {
+	out := `
+Name   Source                                   Updated            Manifests
+----   ------                                   -------            ---------
+main   https://github.com/ScoopInstaller/Main   2024-01-10 09:12:31      1321
+extras https://github.com/ScoopInstaller/Extras 2024-01-10 09:12:40      2043
+`
+	if got, want := parseScoopBuckets(out), []string{"main", "extras"}; !slices.Equal(got, want) {
+		t.Errorf("parseScoopBuckets = %v, want %v", got, want)
+	}
+}
+
+func TestPackageActionWindowsInstallCommand(t *testing.T) {
+	ctx := context.Background()
+	a := &PackageAction{Package: "Git.Git", Manager: "winget", Remote: "winget", Options: []string{"--scope", "machine"}}
+	args, err := a.installCommand(ctx, a.Package)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"--silent", "--accept-package-agreements"} {
+		if !slices.Contains(args, want) {
+			t.Errorf("winget args %v should include %s", args, want)
+		}
+	}
+	if got := args[len(args)-4:]; !slices.Equal(got, []string{"--source", "winget", "--scope", "machine"}) {
+		t.Errorf("winget args end with %v", got)
+	}
+
+	a = &PackageAction{Package: "git", Manager: "choco", Options: []string{"--params", "/NoShellIntegration"}}
+	args, _ = a.installCommand(ctx, a.Package)
+	if want := []string{"choco", "install", "git", "-y", "--no-progress", "--params", "/NoShellIntegration"}; !slices.Equal(args, want) {
+		t.Errorf("choco args = %v, want %v", args, want)
+	}
+}
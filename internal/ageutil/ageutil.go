@@ -3,19 +3,93 @@ package ageutil
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"io"
 	"os"
 	"strings"
+	"sync"
 
 	"filippo.io/age"
+	"filippo.io/age/armor"
+
+	"github.com/atomikpanda/dotular/internal/config"
+	"github.com/atomikpanda/dotular/internal/platform"
+	"github.com/atomikpanda/dotular/internal/shell"
 )
 
 // Key holds the credential needed to encrypt and decrypt age files.
-// Exactly one of IdentityFile or Passphrase should be non-empty.
+// Exactly one of IdentityFile, Passphrase, or PassphraseCommand should be
+// non-empty.
 type Key struct {
 	IdentityFile string // path to an age identity file (secret key)
 	Passphrase   string // scrypt passphrase (used when IdentityFile is empty)
+
+	// PassphraseCommand is run in Shell the first time the passphrase is
+	// needed; its stdout, without the trailing newline, is the passphrase.
+	PassphraseCommand string
+	Shell             string
+
+	once    sync.Once
+	passErr error
+}
+
+// passphrase returns the scrypt passphrase, running PassphraseCommand on
+// first use. It returns "" when the key uses an identity file.
+func (k *Key) passphrase() (string, error) {
+	if k.Passphrase != "" || k.PassphraseCommand == "" {
+		return k.Passphrase, nil
+	}
+	k.once.Do(func() {
+		cmd, err := shell.Shell(k.Shell).Command(context.Background(), k.PassphraseCommand)
+		if err != nil {
+			k.passErr = err
+			return
+		}
+		// The command may prompt, e.g. for a GPG or keychain unlock.
+		cmd.Stdin, cmd.Stderr = os.Stdin, os.Stderr
+		out, err := cmd.Output()
+		if err != nil {
+			k.passErr = fmt.Errorf("age passphrase command: %w", err)
+			return
+		}
+		k.Passphrase = strings.TrimRight(string(out), "\r\n")
+		if k.Passphrase == "" {
+			k.passErr = fmt.Errorf("age passphrase command printed nothing")
+		}
+	})
+	return k.Passphrase, k.passErr
+}
+
+// FromConfig returns the age key from cfg, else from the environment. A
+// passphrase command runs in sh, and only once a file needs the key.
+func FromConfig(cfg *config.AgeConfig, sh string) *Key {
+	// Config file takes precedence over env vars.
+	if cfg != nil {
+		passphrase := cfg.Passphrase
+		if strings.HasPrefix(passphrase, "env:") {
+			passphrase = os.Getenv(strings.TrimPrefix(passphrase, "env:"))
+		}
+		if cfg.Identity != "" || passphrase != "" || cfg.PassphraseCommand != "" {
+			return &Key{
+				IdentityFile:      platform.ExpandPath(cfg.Identity),
+				Passphrase:        passphrase,
+				PassphraseCommand: cfg.PassphraseCommand,
+				Shell:             sh,
+			}
+		}
+	}
+	// Fallback: environment variables.
+	if v := os.Getenv("DOTULAR_AGE_IDENTITY"); v != "" {
+		return &Key{IdentityFile: platform.ExpandPath(v)}
+	}
+	if v := os.Getenv("DOTULAR_AGE_PASSPHRASE"); v != "" {
+		return &Key{Passphrase: v}
+	}
+	if v := os.Getenv("DOTULAR_AGE_PASSPHRASE_CMD"); v != "" {
+		return &Key{PassphraseCommand: v, Shell: sh}
+	}
+	return nil
 }
 
 // EncryptFile reads src (plaintext), encrypts it with k, and writes the result to dst.
@@ -71,10 +145,56 @@ func (k *Key) DecryptFile(src, dst string) error {
 	return os.WriteFile(dst, plaintext, 0o600)
 }
 
+// Seal encrypts plaintext with k and returns it ASCII-armored, for storing
+// in a text file such as the lockfile.
+func (k *Key) Seal(plaintext []byte) (string, error) {
+	recipients, err := k.recipients()
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	aw := armor.NewWriter(&buf)
+	w, err := age.Encrypt(aw, recipients...)
+	if err != nil {
+		return "", fmt.Errorf("age encrypt: %w", err)
+	}
+	if _, err := w.Write(plaintext); err != nil {
+		return "", fmt.Errorf("write ciphertext: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return "", fmt.Errorf("finalise ciphertext: %w", err)
+	}
+	if err := aw.Close(); err != nil {
+		return "", fmt.Errorf("finalise armor: %w", err)
+	}
+	return buf.String(), nil
+}
+
+// Open decrypts an ASCII-armored ciphertext from Seal.
+func (k *Key) Open(sealed string) ([]byte, error) {
+	identities, err := k.identities()
+	if err != nil {
+		return nil, err
+	}
+	r, err := age.Decrypt(armor.NewReader(strings.NewReader(sealed)), identities...)
+	if err != nil {
+		return nil, fmt.Errorf("age decrypt: %w", err)
+	}
+	plaintext, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("read plaintext: %w", err)
+	}
+	return plaintext, nil
+}
+
 // recipients returns the age recipients for encryption.
 func (k *Key) recipients() ([]age.Recipient, error) {
-	if k.Passphrase != "" {
-		r, err := age.NewScryptRecipient(k.Passphrase)
+	passphrase, err := k.passphrase()
+	if err != nil {
+		return nil, err
+	}
+	if passphrase != "" {
+		r, err := age.NewScryptRecipient(passphrase)
 		if err != nil {
 			return nil, fmt.Errorf("create scrypt recipient: %w", err)
 		}
@@ -99,8 +219,12 @@ func (k *Key) recipients() ([]age.Recipient, error) {
 
 // identities returns the age identities for decryption.
 func (k *Key) identities() ([]age.Identity, error) {
-	if k.Passphrase != "" {
-		id, err := age.NewScryptIdentity(k.Passphrase)
+	passphrase, err := k.passphrase()
+	if err != nil {
+		return nil, err
+	}
+	if passphrase != "" {
+		id, err := age.NewScryptIdentity(passphrase)
 		if err != nil {
 			return nil, fmt.Errorf("create scrypt identity: %w", err)
 		}
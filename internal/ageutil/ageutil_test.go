@@ -3,9 +3,13 @@ package ageutil
 import (
 	"os"
 	"path/filepath"
+	"runtime"
+	"strings"
 	"testing"
 
 	"filippo.io/age"
+
+	"github.com/atomikpanda/dotular/internal/config"
 )
 
 func TestRepoPath(t *testing.T) {
@@ -179,3 +183,165 @@ func TestEncryptedFilePermissions(t *testing.T) {
 		t.Errorf("encrypted file permissions = %o, want 0600", perm)
 	}
 }
+
+func TestEncryptDecryptPassphraseCommand(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Unix-only test")
+	}
+	dir := t.TempDir()
+	plain := filepath.Join(dir, "secret.txt")
+	if err := os.WriteFile(plain, []byte("from command"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	count := filepath.Join(dir, "runs")
+	key := &Key{PassphraseCommand: "echo run >> " + count + "; echo test-password-123"}
+
+	encrypted := filepath.Join(dir, "secret.txt.age")
+	if err := key.EncryptFile(plain, encrypted); err != nil {
+		t.Fatal(err)
+	}
+	decrypted := filepath.Join(dir, "decrypted.txt")
+	if err := key.DecryptFile(encrypted, decrypted); err != nil {
+		t.Fatal(err)
+	}
+	if runs, _ := os.ReadFile(count); string(runs) != "run\n" {
+		t.Errorf("command runs = %q, want one", runs)
+	}
+
+	// The passphrase is the command's output without its trailing newline.
+	other := &Key{Passphrase: "test-password-123"}
+	if err := other.DecryptFile(encrypted, decrypted); err != nil {
+		t.Errorf("decrypt with the literal passphrase: %v", err)
+	}
+}
+
+func TestPassphraseCommandFails(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Unix-only test")
+	}
+	dir := t.TempDir()
+	plain := filepath.Join(dir, "secret.txt")
+	if err := os.WriteFile(plain, []byte("x"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	for _, command := range []string{"exit 1", "true"} {
+		key := &Key{PassphraseCommand: command}
+		if err := key.EncryptFile(plain, plain+".age"); err == nil {
+			t.Errorf("%q: expected error", command)
+		}
+	}
+}
+
+func TestFromConfigPassphrase(t *testing.T) {
+	cfg := &config.AgeConfig{Passphrase: "secret"}
+	key := FromConfig(cfg, "")
+	if key == nil {
+		t.Fatal("expected key")
+	}
+	if key.Passphrase != "secret" {
+		t.Errorf("Passphrase = %q", key.Passphrase)
+	}
+}
+
+func TestFromConfigEnvPassphrase(t *testing.T) {
+	cfg := &config.AgeConfig{Passphrase: "env:MY_AGE_PASS"}
+	t.Setenv("MY_AGE_PASS", "from-env")
+	key := FromConfig(cfg, "")
+	if key == nil {
+		t.Fatal("expected key")
+	}
+	if key.Passphrase != "from-env" {
+		t.Errorf("Passphrase = %q", key.Passphrase)
+	}
+}
+
+func TestFromConfigIdentity(t *testing.T) {
+	cfg := &config.AgeConfig{Identity: "~/.age/key.txt"}
+	key := FromConfig(cfg, "")
+	if key == nil {
+		t.Fatal("expected key")
+	}
+	if key.IdentityFile == "" {
+		t.Error("expected non-empty IdentityFile")
+	}
+}
+
+func TestFromConfigNil(t *testing.T) {
+	t.Setenv("DOTULAR_AGE_IDENTITY", "")
+	t.Setenv("DOTULAR_AGE_PASSPHRASE", "")
+	t.Setenv("DOTULAR_AGE_PASSPHRASE_CMD", "")
+	key := FromConfig(nil, "")
+	if key != nil {
+		t.Error("expected nil key when no config")
+	}
+}
+
+func TestFromConfigEnvIdentityFallback(t *testing.T) {
+	t.Setenv("DOTULAR_AGE_IDENTITY", "/path/to/key")
+	t.Setenv("DOTULAR_AGE_PASSPHRASE", "")
+	key := FromConfig(nil, "")
+	if key == nil {
+		t.Fatal("expected key from env")
+	}
+	if key.IdentityFile == "" {
+		t.Error("expected non-empty IdentityFile")
+	}
+}
+
+func TestFromConfigEnvPassphraseFallback(t *testing.T) {
+	t.Setenv("DOTULAR_AGE_IDENTITY", "")
+	t.Setenv("DOTULAR_AGE_PASSPHRASE", "env-pass")
+	key := FromConfig(nil, "")
+	if key == nil {
+		t.Fatal("expected key from env")
+	}
+	if key.Passphrase != "env-pass" {
+		t.Errorf("Passphrase = %q", key.Passphrase)
+	}
+}
+
+func TestFromConfigEmptyConfig(t *testing.T) {
+	t.Setenv("DOTULAR_AGE_IDENTITY", "")
+	t.Setenv("DOTULAR_AGE_PASSPHRASE", "")
+	cfg := &config.AgeConfig{}
+	key := FromConfig(cfg, "")
+	if key != nil {
+		t.Error("expected nil key for empty age config")
+	}
+}
+
+func TestFromConfigPassphraseCommand(t *testing.T) {
+	key := FromConfig(&config.AgeConfig{PassphraseCommand: "pass show dotular"}, "bash")
+	if key == nil || key.PassphraseCommand != "pass show dotular" || key.Shell != "bash" || key.Passphrase != "" {
+		t.Fatalf("key = %+v", key)
+	}
+
+	t.Setenv("DOTULAR_AGE_IDENTITY", "")
+	t.Setenv("DOTULAR_AGE_PASSPHRASE", "")
+	t.Setenv("DOTULAR_AGE_PASSPHRASE_CMD", "security find-generic-password -w -s dotular")
+	key = FromConfig(nil, "")
+	if key == nil || key.PassphraseCommand != "security find-generic-password -w -s dotular" {
+		t.Errorf("key from env = %+v", key)
+	}
+}
+
+func TestSealOpen(t *testing.T) {
+	key := &Key{Passphrase: "test-password-123"}
+	sealed, err := key.Seal([]byte("registry: {}"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(sealed, "-----BEGIN AGE ENCRYPTED FILE-----") {
+		t.Errorf("sealed = %q, want armored", sealed)
+	}
+	plain, err := key.Open(sealed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(plain) != "registry: {}" {
+		t.Errorf("opened = %q", plain)
+	}
+	if _, err := (&Key{Passphrase: "wrong"}).Open(sealed); err == nil {
+		t.Error("expected error opening with the wrong passphrase")
+	}
+}
@@ -16,8 +16,12 @@ type Entry struct {
 	Command string    `json:"command"` // "apply" | "pull" | "sync" | "verify"
 	Module  string    `json:"module"`
 	Item    string    `json:"item"`
-	Outcome string    `json:"outcome"` // "success" | "skipped" | "failure"
+	Outcome string    `json:"outcome"` // "success" | "unchanged" | "skipped" | "failure" | "resolved" | "aborted"
 	Error   string    `json:"error,omitempty"`
+	Detail  string    `json:"detail,omitempty"` // e.g. the choice made for a sync conflict
+	Host    string    `json:"host,omitempty"`   // machine that ran the command; set by Log
+	// DurationMS is how long the item took to run, for items that ran.
+	DurationMS int64 `json:"duration_ms,omitempty"`
 }
 
 // Log appends e to the audit log. Errors are silently ignored so that logging
@@ -26,6 +30,9 @@ func Log(e Entry) {
 	if e.Time.IsZero() {
 		e.Time = time.Now().UTC()
 	}
+	if e.Host == "" {
+		e.Host, _ = os.Hostname()
+	}
 	path, err := logPath()
 	if err != nil {
 		return
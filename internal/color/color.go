@@ -1,23 +1,60 @@
 // Package color provides ANSI colour helpers for terminal output.
 // All functions are no-ops when Enabled is false, so callers need not
 // guard their output — just call Init once at program start.
+//
+// The CLI calls Set with --color, else with the config's color: once the
+// config is loaded; without either, Init's detection stands.
 package color
 
-import "os"
+import (
+	"fmt"
+	"os"
+)
 
 // Enabled is true when ANSI colour output is supported.
 // Call Init once at program start to auto-detect the capability.
 var Enabled bool
 
+// Colour modes, as accepted by --color and the color config option.
+const (
+	ModeAuto   = "auto"   // detect with Init
+	ModeAlways = "always" // colour even when piped or NO_COLOR is set
+	ModeNever  = "never"
+)
+
+// Set applies a colour mode. Always and never override detection; auto, or
+// "", runs Init.
+func Set(mode string) error {
+	switch mode {
+	case "", ModeAuto:
+		Enabled = false
+		Init()
+	case ModeAlways:
+		Enabled = true
+	case ModeNever:
+		Enabled = false
+	default:
+		return fmt.Errorf("unknown color mode %q (want auto, always, or never)", mode)
+	}
+	return nil
+}
+
 // Init detects whether os.Stdout is a colour-capable terminal and sets Enabled.
 // Colour is suppressed when:
 //   - NO_COLOR env var is set (https://no-color.org)
 //   - TERM=dumb
 //   - stdout is not a character device (piped, redirected, etc.)
+//
+// FORCE_COLOR or CLICOLOR_FORCE set to anything but "0" enables colour on a
+// piped stdout, for CI logs that render ANSI codes; NO_COLOR still wins.
 func Init() {
 	if os.Getenv("NO_COLOR") != "" {
 		return
 	}
+	if forced("FORCE_COLOR") || forced("CLICOLOR_FORCE") {
+		Enabled = true
+		return
+	}
 	if os.Getenv("TERM") == "dumb" {
 		return
 	}
@@ -28,6 +65,12 @@ func Init() {
 	Enabled = stat.Mode()&os.ModeCharDevice != 0
 }
 
+// forced reports whether the environment variable name asks for colour.
+func forced(name string) bool {
+	v := os.Getenv(name)
+	return v != "" && v != "0"
+}
+
 func seq(code, s string) string {
 	if !Enabled || s == "" {
 		return s
@@ -92,3 +92,40 @@ func TestInitNormal(t *testing.T) {
 	// In test environments stdout is usually piped, so Enabled should be false.
 	// We just verify Init() doesn't panic.
 }
+
+func TestSet(t *testing.T) {
+	defer func() { Enabled = false }()
+	t.Setenv("NO_COLOR", "1")
+	if err := Set(ModeAlways); err != nil || !Enabled {
+		t.Errorf("always: Enabled = %v, err = %v", Enabled, err)
+	}
+	if err := Set(ModeNever); err != nil || Enabled {
+		t.Errorf("never: Enabled = %v, err = %v", Enabled, err)
+	}
+	Enabled = true
+	if err := Set(ModeAuto); err != nil || Enabled {
+		t.Errorf("auto with NO_COLOR: Enabled = %v, err = %v", Enabled, err)
+	}
+	if err := Set("sometimes"); err == nil {
+		t.Error("expected error for unknown mode")
+	}
+}
+
+func TestInitForceColor(t *testing.T) {
+	defer func() { Enabled = false }()
+	os.Unsetenv("NO_COLOR")
+	t.Setenv("TERM", "dumb")
+	t.Setenv("FORCE_COLOR", "1")
+	Enabled = false
+	Init()
+	if !Enabled {
+		t.Error("FORCE_COLOR should enable color on a piped stdout")
+	}
+
+	t.Setenv("FORCE_COLOR", "0")
+	Enabled = false
+	Init()
+	if Enabled {
+		t.Error("FORCE_COLOR=0 should not force color")
+	}
+}
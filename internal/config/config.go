@@ -1,10 +1,21 @@
 package config
 
 import (
+	"errors"
 	"fmt"
+	"math"
 	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
 
 	"gopkg.in/yaml.v3"
+
+	"github.com/atomikpanda/dotular/internal/color"
+	"github.com/atomikpanda/dotular/internal/shell"
+	"github.com/atomikpanda/dotular/internal/version"
 )
 
 // Config is the top-level document. It supports two on-disk formats:
@@ -12,14 +23,202 @@ import (
 //   - New (mapping): has a "modules" key and optional "age" key.
 //   - Legacy (sequence): a bare list of modules (no global settings).
 type Config struct {
-	Age     *AgeConfig `yaml:"age,omitempty"`
-	Modules []Module   `yaml:"modules"`
+	Age    *AgeConfig    `yaml:"age,omitempty"`
+	Hooks  GlobalHooks   `yaml:"hooks,omitempty"`
+	Notify *NotifyConfig `yaml:"notify,omitempty"`
+	// Shell runs hooks, skip_if, verify, and run items unless an item sets
+	// its own; see shell.Shell for the accepted values.
+	Shell string      `yaml:"shell,omitempty"`
+	Store StoreConfig `yaml:"store,omitempty"`
+	HTTP  HTTPConfig  `yaml:"http,omitempty"`
+	Lock  LockConfig  `yaml:"lock,omitempty"`
+	// Registry configures mirrors for registry fetches.
+	Registry RegistryConfig `yaml:"registry,omitempty"`
+	// Trust decides which registry modules Resolve accepts.
+	Trust TrustConfig `yaml:"trust,omitempty"`
+	// Machines controls the machine inventory, dotular.machines.yaml.
+	Machines MachinesConfig `yaml:"machines,omitempty"`
+	// Profiles are named sets of item types and package managers to skip,
+	// chosen with --profile; a profile named like a built-in one replaces it.
+	Profiles map[string]Profile `yaml:"profiles,omitempty"`
+	// Color is the colour mode (auto, always, or never) when --color is
+	// not given; see color.Set.
+	Color string `yaml:"color,omitempty"`
+	// MaxFileSize is the size, such as "100MB", above which files inside
+	// directory items are left out of copies, snapshots, and drift hashes;
+	// "0" disables the limit. See MaxFileSizeFor.
+	MaxFileSize string `yaml:"max_file_size,omitempty"`
+	// Vars are template values for every module's items; a module's own
+	// Vars take precedence.
+	Vars    map[string]any `yaml:"vars,omitempty"`
+	Modules []Module       `yaml:"modules"`
+
+	groups map[string]Module // group definitions, for re-nesting on Save
+}
+
+// HTTPConfig configures the client used for registry fetches, binary and
+// remote-script downloads, and webhooks. Proxies always come from the
+// HTTP_PROXY, HTTPS_PROXY, and NO_PROXY environment variables.
+type HTTPConfig struct {
+	CABundle string            `yaml:"ca_bundle,omitempty"` // PEM file of extra trusted CA certificates
+	Headers  map[string]string `yaml:"headers,omitempty"`   // sent to Hosts; values may be "env:VARNAME"
+	Timeout  string            `yaml:"timeout,omitempty"`   // connect and response-header timeout, e.g. "30s"
+	// ClientCert and ClientKey are PEM files of a certificate and its key
+	// presented to Hosts when they require TLS client authentication.
+	ClientCert string `yaml:"client_cert,omitempty"`
+	ClientKey  string `yaml:"client_key,omitempty"`
+	// Hosts are the host names and URL prefixes that Headers and the client
+	// certificate are sent to; other requests, including redirects away from
+	// them, get neither.
+	Hosts []string `yaml:"hosts,omitempty"`
+}
+
+// RegistryConfig points registry fetches at internal mirrors, for networks
+// that cannot reach GitHub.
+type RegistryConfig struct {
+	// Mirrors are tried in order for each URL under their prefix, before
+	// the original host.
+	Mirrors []Mirror `yaml:"mirrors,omitempty"`
+	// MirrorsOnly never falls back to the original host once a mirror
+	// covers the URL.
+	MirrorsOnly bool `yaml:"mirrors_only,omitempty"`
+}
+
+// Mirror serves a copy of the registry URLs under Prefix from URL: a fetch
+// of Prefix + "/x" is tried as URL + "/x". Its TLS settings replace the
+// http section's ones for requests to the mirror.
+type Mirror struct {
+	// Prefix is the URL prefix the mirror replaces. The default is the
+	// official registry; "https://raw.githubusercontent.com" mirrors every
+	// GitHub ref.
+	Prefix     string `yaml:"prefix,omitempty"`
+	URL        string `yaml:"url"`
+	CABundle   string `yaml:"ca_bundle,omitempty"`
+	ClientCert string `yaml:"client_cert,omitempty"`
+	ClientKey  string `yaml:"client_key,omitempty"`
+}
+
+// LockConfig controls how dotular.lock.yaml is written.
+type LockConfig struct {
+	// Encrypt seals the lockfile's registry entries (refs, URLs, and
+	// checksums) with the age key, so private hostnames and tokens in refs
+	// can be committed to a public repo.
+	Encrypt bool `yaml:"encrypt,omitempty"`
+}
+
+// TrustConfig is the policy for community registry modules: those from
+// GitHub repositories other than the official registry and from other
+// hosts. Official and local modules are always allowed.
+type TrustConfig struct {
+	// Community is TrustPrompt (default) to review each module before its
+	// first use, TrustAllow to use them without review, or TrustDeny to
+	// refuse them.
+	Community string `yaml:"community,omitempty"`
+	// PrivateHosts are ref prefixes, such as "github.com/myorg", whose
+	// modules are trusted like official ones.
+	PrivateHosts []string `yaml:"private_hosts,omitempty"`
+	// RequirePin refuses community refs whose version is not a semver tag
+	// or a full commit SHA: branches, whatever their name, can change
+	// under the lockfile.
+	RequirePin bool `yaml:"require_pin,omitempty"`
+}
+
+// Community module policies.
+const (
+	TrustPrompt = "prompt"
+	TrustAllow  = "allow"
+	TrustDeny   = "deny"
+)
+
+// MachinesConfig controls the machine inventory listed by `dotular machines`.
+type MachinesConfig struct {
+	// Register records this machine, its tags, and the modules it applied
+	// in dotular.machines.yaml after each apply, for committing to the repo.
+	Register bool `yaml:"register,omitempty"`
+}
+
+// Profile trims a run for a kind of environment, such as a dev container
+// that has no GUI.
+type Profile struct {
+	Skip         []string `yaml:"skip,omitempty"`          // item types, as for --skip
+	SkipManagers []string `yaml:"skip_managers,omitempty"` // package managers, e.g. brew-cask
+	Tags         []string `yaml:"tags,omitempty"`          // added to the machine tags
+}
+
+// StoreConfig controls where module files live in the repo. By default each
+// module has a directory named after it next to the config file.
+type StoreConfig struct {
+	Dir    string `yaml:"dir,omitempty"`    // relative to the config file's directory, e.g. "files"
+	Layout string `yaml:"layout,omitempty"` // "module" (default): <dir>/<module>/<file>; "flat": <dir>/<file>
+}
+
+// Store layouts.
+const (
+	LayoutModule = "module"
+	LayoutFlat   = "flat"
+)
+
+// Item phases, in the order they run within a module.
+const (
+	PhasePre  = "pre"
+	PhaseMain = "main"
+	PhasePost = "post"
+)
+
+// PhaseRank returns the position of phase in the run order; the empty
+// phase is PhaseMain.
+func PhaseRank(phase string) int {
+	switch phase {
+	case PhasePre:
+		return 0
+	case PhasePost:
+		return 2
+	}
+	return 1
+}
+
+// StoreDir returns the directory holding module's files for a repo rooted at
+// root.
+func (c Config) StoreDir(root, module string) string {
+	dir := filepath.Join(root, c.Store.Dir)
+	if c.Store.Layout == LayoutFlat {
+		return dir
+	}
+	return filepath.Join(dir, module)
 }
 
 // AgeConfig holds age encryption credentials for encrypted file items.
 type AgeConfig struct {
 	Identity   string `yaml:"identity,omitempty"`
 	Passphrase string `yaml:"passphrase,omitempty"` // literal or "env:VARNAME"
+	// PassphraseCommand is a shell command whose stdout is the passphrase,
+	// e.g. "pass show dotular"; it runs once, when a file is first
+	// encrypted or decrypted.
+	PassphraseCommand string `yaml:"passphrase_command,omitempty"`
+}
+
+// GlobalHooks are shell commands that run around a whole apply, push, pull,
+// or sync run. AfterAll runs only when every module succeeded; OnFailure runs
+// instead when any module (or BeforeAll) failed.
+type GlobalHooks struct {
+	BeforeAll string `yaml:"before_all,omitempty"`
+	AfterAll  string `yaml:"after_all,omitempty"`
+	OnFailure string `yaml:"on_failure,omitempty"`
+}
+
+// NotifyConfig sends a notification when a run completes. On lists the
+// outcomes that trigger it ("success", "failure"); empty means both.
+type NotifyConfig struct {
+	On       []string  `yaml:"on,omitempty"`
+	Desktop  bool      `yaml:"desktop,omitempty"`
+	Webhooks []Webhook `yaml:"webhooks,omitempty"`
+}
+
+// Webhook is an HTTP endpoint that receives a POST per notification. Format
+// selects the payload shape: "slack", "discord", or "json" (default).
+type Webhook struct {
+	URL    string `yaml:"url"`
+	Format string `yaml:"format,omitempty"`
 }
 
 // Module groups related items under a named application or topic.
@@ -32,12 +231,25 @@ type Module struct {
 	OnlyTags    []string    `yaml:"only_tags,omitempty"`
 	ExcludeTags []string    `yaml:"exclude_tags,omitempty"`
 	Hooks       ModuleHooks `yaml:"hooks,omitempty"`
+	// Vars are rendered into the module's item fields as {{ .name }} when
+	// the config is resolved, over the config's top-level Vars.
+	Vars map[string]any `yaml:"vars,omitempty"`
+
+	// Modules makes this module a group whose members can be applied and
+	// listed together and share its tags and hooks. Groups are flattened
+	// into Config.Modules when the config is loaded.
+	Modules []Module `yaml:"modules,omitempty"`
+	// Groups names the enclosing groups, outermost first, and GroupOnlyTags
+	// holds the only_tags of each of them that sets any; the module must
+	// match every one. Both are filled in when groups are flattened.
+	Groups        []string   `yaml:"-"`
+	GroupOnlyTags [][]string `yaml:"-"`
 
 	// Registry module reference (mutually exclusive with Items in source YAML;
 	// after resolution Items is populated from the registry module).
 	From     string         `yaml:"from,omitempty"`     // e.g. "github.com/atomikpanda/dotular/modules/neovim@main"
 	With     map[string]any `yaml:"with,omitempty"`     // parameter overrides
-	Override []Item         `yaml:"override,omitempty"` // items that replace matching registry items
+	Override []Item         `yaml:"override,omitempty"` // fields merged into matching registry items
 }
 
 // IsRegistry returns true when this module is backed by a registry reference.
@@ -49,16 +261,34 @@ type ModuleHooks struct {
 	AfterApply  string `yaml:"after_apply,omitempty"`
 	BeforeSync  string `yaml:"before_sync,omitempty"`
 	AfterSync   string `yaml:"after_sync,omitempty"`
+
+	BeforeUnapply string `yaml:"before_unapply,omitempty"`
+	AfterUnapply  string `yaml:"after_unapply,omitempty"`
 }
 
 // Item represents a single configuration action within a module.
 // The item type is determined by which primary field is populated.
 type Item struct {
 	// --- package ---
-	Package string `yaml:"package,omitempty"`
+	// Remote (with RemoteURL to add it when it is not flathub) selects the
+	// flatpak remote or the winget source to install from; Channel and
+	// Classic are snap options. Options are extra arguments appended to the
+	// install command, e.g. ["--scope", "machine"] for winget.
+	Package   string   `yaml:"package,omitempty"`
+	Remote    string   `yaml:"remote,omitempty"`
+	RemoteURL string   `yaml:"remote_url,omitempty"`
+	Channel   string   `yaml:"channel,omitempty"`
+	Classic   bool     `yaml:"classic,omitempty"`
+	Options   []string `yaml:"options,omitempty"`
 
 	// --- script ---
-	Script string `yaml:"script,omitempty"`
+	// Script runs a local path or, with via: remote, a downloaded URL. SHA256
+	// pins the script content; Interpreter overrides bash (e.g. "python3",
+	// "pwsh"). Scripts run from the module's store directory.
+	Script      string   `yaml:"script,omitempty"`
+	Args        []string `yaml:"args,omitempty"`
+	Interpreter string   `yaml:"interpreter,omitempty"`
+	SHA256      string   `yaml:"sha256,omitempty"`
 
 	// --- setting ---
 	Setting string `yaml:"setting,omitempty"`
@@ -66,17 +296,29 @@ type Item struct {
 	Value   any    `yaml:"value,omitempty"`
 
 	// --- file ---
+	// File may be a glob such as "*.conf", and Files a list of names or
+	// globs; both are expanded against the module store at plan time into
+	// one file item per match.
 	File        string      `yaml:"file,omitempty"`
+	Files       []string    `yaml:"files,omitempty"`
 	Destination PlatformMap `yaml:"destination,omitempty"`
 	Direction   string      `yaml:"direction,omitempty"` // push | pull | sync (default: push)
 	Link        bool        `yaml:"link,omitempty"`
 	Permissions string      `yaml:"permissions,omitempty"` // Unix octal, e.g. "0600"
+	Owner       string      `yaml:"owner,omitempty"`       // user name or uid (Unix only)
+	Group       string      `yaml:"group,omitempty"`       // group name or gid (Unix only)
 	Encrypted   bool        `yaml:"encrypted,omitempty"`
 
 	// --- directory ---
 	// Directory manages a whole directory tree. Supports the same direction,
-	// link, and permissions semantics as file items.
-	Directory string `yaml:"directory,omitempty"`
+	// link, permissions, and ownership semantics as file items; Permissions
+	// applies to every file in the tree and DirPermissions to every directory.
+	// Symlinks inside the tree are copied as symlinks unless Dereference is
+	// set, which copies what they point to instead.
+	Directory      string `yaml:"directory,omitempty"`
+	DirPermissions string `yaml:"dir_permissions,omitempty"` // Unix octal, e.g. "0700"
+	Dereference    bool   `yaml:"dereference,omitempty"`
+	MaxFileSize    string `yaml:"max_file_size,omitempty"` // overrides the config's max_file_size
 
 	// --- binary ---
 	// Binary downloads a pre-built binary from Source URLs, extracts it, and
@@ -84,21 +326,174 @@ type Item struct {
 	// can be referenced in Source URLs via {{ .version }}.
 	Binary    string      `yaml:"binary,omitempty"`
 	Version   string      `yaml:"version,omitempty"`
-	Source    PlatformMap `yaml:"source,omitempty"`  // download URL per OS
+	Source    PlatformMap `yaml:"source,omitempty"`     // download URL per OS
 	InstallTo string      `yaml:"install_to,omitempty"` // destination directory
 
 	// --- run ---
-	// Run executes an inline shell command. After is informational: it names
-	// the item type this run step logically depends on (ordering is determined
-	// by declaration order in the items list).
-	Run   string `yaml:"run,omitempty"`
-	After string `yaml:"after,omitempty"`
+	// Run executes an inline shell command. Register stores the command's
+	// trimmed stdout under that name for {{ .name }} templates in later items
+	// of the same module. ChangedWhen is a regular expression matched against
+	// the command's stdout: the run counts as a change only when it matches.
+	// Without it, a run with Creates counts as a change only if it created
+	// the path, and any other run always does.
+	Run         string            `yaml:"run,omitempty"`
+	Cwd         string            `yaml:"cwd,omitempty"`
+	Env         map[string]string `yaml:"env,omitempty"`
+	Shell       string            `yaml:"shell,omitempty"` // overrides Config.Shell for this item's run, skip_if, and verify
+	Register    string            `yaml:"register,omitempty"`
+	ChangedWhen string            `yaml:"changed_when,omitempty"`
+
+	// --- dock (macOS) ---
+	// Dock lists the apps pinned to the Dock, by name (looked up in the
+	// Applications folders) or path. With DockMode "replace" (the default)
+	// the Dock holds exactly these apps in this order; "add" only appends
+	// the ones that are missing.
+	Dock     []string `yaml:"dock,omitempty"`
+	DockMode string   `yaml:"dock_mode,omitempty"` // replace | add
+
+	// --- login_item (macOS) ---
+	// LoginItem opens an app, by name or path, at login; Hidden starts it
+	// hidden.
+	LoginItem string `yaml:"login_item,omitempty"`
+	Hidden    bool   `yaml:"hidden,omitempty"`
+
+	// --- repo ---
+	// Repo adds a package source for Via: a brew tap ("user/repo"), an apt
+	// PPA ("ppa:user/name") or sources.list line, a dnf copr ("user/project")
+	// or .repo URL, a choco source URL, or a scoop bucket ("extras", or
+	// "name url"). KeyURL is the apt signing key.
+	// Repo items run before the module's package items.
+	Repo   string `yaml:"repo,omitempty"`
+	KeyURL string `yaml:"key_url,omitempty"`
+
+	// --- container ---
+	// Container names a container that runs Image (with Ports, Volumes, and
+	// the item's Env), or the project of a Compose file in the module store.
+	// With neither, Container is an image to pull. Via picks docker or
+	// podman; by default whichever is installed.
+	Container string   `yaml:"container,omitempty"`
+	Image     string   `yaml:"image,omitempty"`
+	Compose   string   `yaml:"compose,omitempty"`
+	Ports     []string `yaml:"ports,omitempty"`
+	Volumes   []string `yaml:"volumes,omitempty"`
+
+	// --- extension ---
+	// Extension or Extensions name editor extensions to install, by ID
+	// ("golang.go"). Via picks the editor: vscode (the default), vscodium,
+	// or cursor. Pulling records the installed extensions in Extensions.
+	Extension  string   `yaml:"extension,omitempty"`
+	Extensions []string `yaml:"extensions,omitempty"`
+
+	// --- default_app ---
+	// DefaultApp is the app made the default for Handles (file extensions
+	// such as ".md", URL schemes such as "https:", or UTIs and MIME types):
+	// a bundle ID on macOS, a .desktop file on Linux, a ProgID on Windows.
+	DefaultApp PlatformMap `yaml:"default_app,omitempty"`
+	Handles    []string    `yaml:"handles,omitempty"`
+
+	// --- shell_plugin ---
+	// ShellPlugin is a plugin ("owner/repo" on GitHub, or a git URL) for the
+	// plugin manager named by Via: oh-my-zsh, zinit, antidote, fisher, or
+	// tpm. Version pins a tag, branch, or commit.
+	ShellPlugin string `yaml:"shell_plugin,omitempty"`
+
+	// --- gpg_key ---
+	// GpgKey is the fingerprint of a key imported from KeyFile, a path in the
+	// module store (age-encrypted with Encrypted, as secret keys should be),
+	// or else received from Keyserver. Trust sets the owner trust; Secret
+	// marks secret keys, which are looked up in the secret keyring.
+	GpgKey    string `yaml:"gpg_key,omitempty"`
+	KeyFile   string `yaml:"key_file,omitempty"`
+	Keyserver string `yaml:"keyserver,omitempty"`
+	Trust     string `yaml:"trust,omitempty"` // unknown | never | marginal | full | ultimate
+	Secret    bool   `yaml:"secret,omitempty"`
+
+	// --- ssh_host ---
+	// SSHHost is a Host pattern whose block in ~/.ssh/config holds
+	// SSHOptions (e.g. User, IdentityFile). KnownHosts pins the host's keys,
+	// "<type> <base64 key>", in ~/.ssh/known_hosts under the HostName
+	// option or, without one, the host itself.
+	SSHHost    string            `yaml:"ssh_host,omitempty"`
+	SSHOptions map[string]string `yaml:"ssh_options,omitempty"`
+	KnownHosts []string          `yaml:"known_hosts,omitempty"`
 
 	// --- shared ---
-	Via    string `yaml:"via,omitempty"`
+	// Name identifies the item in output, the audit log, verify reports,
+	// apply --item, and registry override matching, in place of its primary
+	// value. Names are unique within a module.
+	Name string `yaml:"name,omitempty"`
+	Via  string `yaml:"via,omitempty"`
+	// Phase is PhasePre, PhaseMain (the default), or PhasePost. A module
+	// runs its pre items first and its post items last, each in declaration
+	// order.
+	Phase string `yaml:"phase,omitempty"`
+	// After names an item type, such as "package": within its phase, the
+	// item runs after every item of that type in the module that does not
+	// itself set After.
+	After string `yaml:"after,omitempty"`
+	// When is a condition evaluated at plan time without a shell (see
+	// internal/expr); the item is skipped when it evaluates to false.
+	When string `yaml:"when,omitempty"`
+	// SkipIf and its synonym Unless skip the item when the shell command
+	// exits zero; OnlyIf skips it unless the command exits zero.
 	SkipIf string `yaml:"skip_if,omitempty"`
-	Verify string `yaml:"verify,omitempty"`
-	Hooks  ItemHooks `yaml:"hooks,omitempty"`
+	Unless string `yaml:"unless,omitempty"`
+	OnlyIf string `yaml:"only_if,omitempty"`
+	// Creates skips the item when the path, or any path matching the glob
+	// pattern, exists. ~ and environment variables are expanded; a relative
+	// path is taken from the config file's directory.
+	Creates string    `yaml:"creates,omitempty"`
+	Verify  Verify    `yaml:"verify,omitempty"`
+	Hooks   ItemHooks `yaml:"hooks,omitempty"`
+	// VerifyFileExists, VerifySymlink, and VerifyVersion are built-in checks
+	// run after the item without a shell: a path that must exist, a path
+	// that must be a symlink to an existing target, and a constraint such
+	// as ">=0.10" on the version printed by the verify command or, without
+	// one, by the item's program run with --version.
+	VerifyFileExists string `yaml:"verify_file_exists,omitempty"`
+	VerifySymlink    string `yaml:"verify_symlink,omitempty"`
+	VerifyVersion    string `yaml:"verify_version,omitempty"`
+	// Retries re-runs a failed item up to this many extra times, waiting
+	// RetryDelay (a Go duration such as "5s") between attempts. Nil means the
+	// per-type default: network-backed items retry, everything else does not.
+	Retries    *int   `yaml:"retries,omitempty"`
+	RetryDelay string `yaml:"retry_delay,omitempty"`
+}
+
+// Verify is an item's verify command, which must exit zero and, when
+// Expect is set, print output matching that regular expression. It is
+// written as a command string or as a {command, expect} mapping.
+type Verify struct {
+	Command string `yaml:"command,omitempty"`
+	Expect  string `yaml:"expect,omitempty"`
+}
+
+// IsZero reports whether no verify command is set.
+func (v Verify) IsZero() bool { return v.Command == "" && v.Expect == "" }
+
+// UnmarshalYAML accepts a plain command string or a mapping.
+func (v *Verify) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		v.Command = value.Value
+		return nil
+	}
+	type plain Verify
+	return value.Decode((*plain)(v))
+}
+
+// MarshalYAML writes a verify without Expect as a plain command string.
+func (v Verify) MarshalYAML() (any, error) {
+	if v.Expect == "" {
+		return v.Command, nil
+	}
+	type plain Verify
+	return plain(v), nil
+}
+
+// HasVerify reports whether the item has a verify command or a built-in
+// check.
+func (i Item) HasVerify() bool {
+	return i.Verify.Command != "" || i.VerifyFileExists != "" || i.VerifySymlink != "" || i.VerifyVersion != ""
 }
 
 // ItemHooks are shell commands that run around individual item application.
@@ -118,7 +513,7 @@ func (i Item) Type() string {
 		return "script"
 	case i.Setting != "":
 		return "setting"
-	case i.File != "":
+	case i.File != "" || len(i.Files) > 0:
 		return "file"
 	case i.Directory != "":
 		return "directory"
@@ -126,11 +521,49 @@ func (i Item) Type() string {
 		return "binary"
 	case i.Run != "":
 		return "run"
+	case len(i.Dock) > 0:
+		return "dock"
+	case i.LoginItem != "":
+		return "login_item"
+	case i.Repo != "":
+		return "repo"
+	case i.Container != "":
+		return "container"
+	case i.Extension != "" || len(i.Extensions) > 0:
+		return "extension"
+	case !i.DefaultApp.IsZero():
+		return "default_app"
+	case i.ShellPlugin != "":
+		return "shell_plugin"
+	case i.GpgKey != "":
+		return "gpg_key"
+	case i.SSHHost != "":
+		return "ssh_host"
 	default:
 		return "unknown"
 	}
 }
 
+// checkAfter reports whether the After of items[j] names a type that some
+// other item in items has in the same or an earlier phase.
+func checkAfter(items []Item, j int) error {
+	after, rank := items[j].After, PhaseRank(items[j].Phase)
+	later := false
+	for k, other := range items {
+		if k == j || other.Type() != after {
+			continue
+		}
+		if PhaseRank(other.Phase) <= rank {
+			return nil
+		}
+		later = true
+	}
+	if later {
+		return fmt.Errorf("after %q: every %s item runs in a later phase", after, after)
+	}
+	return fmt.Errorf("after %q: no %s item in the module", after, after)
+}
+
 // PrimaryValue returns the primary field value used for item matching (e.g.
 // when merging registry overrides).
 func (i Item) PrimaryValue() string {
@@ -142,6 +575,9 @@ func (i Item) PrimaryValue() string {
 	case "setting":
 		return i.Setting
 	case "file":
+		if i.File == "" {
+			return strings.Join(i.Files, ",")
+		}
 		return i.File
 	case "directory":
 		return i.Directory
@@ -149,6 +585,27 @@ func (i Item) PrimaryValue() string {
 		return i.Binary
 	case "run":
 		return i.Run
+	case "dock":
+		return strings.Join(i.Dock, ",")
+	case "login_item":
+		return i.LoginItem
+	case "repo":
+		return i.Repo
+	case "container":
+		return i.Container
+	case "extension":
+		if i.Extension == "" {
+			return strings.Join(i.Extensions, ",")
+		}
+		return i.Extension
+	case "default_app":
+		return strings.Join(i.Handles, ",")
+	case "shell_plugin":
+		return i.ShellPlugin
+	case "gpg_key":
+		return i.GpgKey
+	case "ssh_host":
+		return i.SSHHost
 	default:
 		return ""
 	}
@@ -168,11 +625,18 @@ func (i Item) EffectiveDirection() string {
 // PlatformMap holds a per-OS value. It accepts two YAML forms:
 //
 //   - Scalar: a single string applied to all platforms.
-//   - Mapping: per-OS keys (macos, windows, linux).
+//   - Mapping: per-OS keys (macos, windows, linux), plus windows_host and
+//     wsl for destinations across the WSL boundary.
 type PlatformMap struct {
 	MacOS   string
 	Windows string
 	Linux   string
+	// WindowsHost is a Windows-side path (e.g. ~/AppData/Local/...) used
+	// under WSL when Linux is unset.
+	WindowsHost string
+	// WSL is a path inside the default WSL distribution (e.g. ~/.bashrc)
+	// used on Windows when Windows is unset.
+	WSL string
 }
 
 // ForOS returns the value for the given runtime.GOOS string.
@@ -191,7 +655,7 @@ func (p PlatformMap) ForOS(goos string) string {
 
 // IsZero reports whether all platform values are empty.
 func (p PlatformMap) IsZero() bool {
-	return p.MacOS == "" && p.Windows == "" && p.Linux == ""
+	return p.MacOS == "" && p.Windows == "" && p.Linux == "" && p.WindowsHost == "" && p.WSL == ""
 }
 
 // UnmarshalYAML implements yaml.Unmarshaler. It accepts both a scalar string
@@ -221,6 +685,10 @@ func (p *PlatformMap) UnmarshalYAML(value *yaml.Node) error {
 				p.Windows = v
 			case "linux":
 				p.Linux = v
+			case "windows_host":
+				p.WindowsHost = v
+			case "wsl":
+				p.WSL = v
 			}
 		}
 		return nil
@@ -232,14 +700,21 @@ func (p *PlatformMap) UnmarshalYAML(value *yaml.Node) error {
 // MarshalYAML implements yaml.Marshaler so round-trips work correctly.
 func (p PlatformMap) MarshalYAML() (any, error) {
 	// If all values are identical (set from a scalar), marshal back as scalar.
-	if p.MacOS != "" && p.MacOS == p.Windows && p.MacOS == p.Linux {
+	if p.MacOS != "" && p.MacOS == p.Windows && p.MacOS == p.Linux && p.WindowsHost == "" && p.WSL == "" {
 		return p.MacOS, nil
 	}
-	return map[string]string{
+	m := map[string]string{
 		"macos":   p.MacOS,
 		"windows": p.Windows,
 		"linux":   p.Linux,
-	}, nil
+	}
+	if p.WindowsHost != "" {
+		m["windows_host"] = p.WindowsHost
+	}
+	if p.WSL != "" {
+		m["wsl"] = p.WSL
+	}
+	return m, nil
 }
 
 // Load reads and parses a config file. It accepts both the new mapping format
@@ -249,7 +724,11 @@ func Load(path string) (Config, error) {
 	if err != nil {
 		return Config{}, err
 	}
+	return parse(data)
+}
 
+// parse decodes a config file's content.
+func parse(data []byte) (Config, error) {
 	var root yaml.Node
 	if err := yaml.Unmarshal(data, &root); err != nil {
 		return Config{}, fmt.Errorf("parse config: %w", err)
@@ -274,6 +753,11 @@ func Load(path string) (Config, error) {
 		return Config{}, fmt.Errorf("config root must be a mapping or sequence, got kind %d", doc.Kind)
 	}
 
+	var err error
+	cfg.Modules, cfg.groups, err = flattenGroups(cfg.Modules)
+	if err != nil {
+		return Config{}, err
+	}
 	return cfg, nil
 }
 
@@ -287,11 +771,332 @@ func (c Config) Module(name string) *Module {
 	return nil
 }
 
-// Save marshals the config and writes it to path using the mapping format.
-func Save(path string, cfg Config) error {
-	data, err := yaml.Marshal(&cfg)
-	if err != nil {
-		return fmt.Errorf("marshal config: %w", err)
+// FindItem returns the index in m.Items of the item sel selects: a 1-based
+// position such as "3", an item's name, or a primary value such as "git" or
+// ".zshrc" (a file or directory also matches by its base name). A primary
+// value matching more than one item is an error.
+func (m Module) FindItem(sel string) (int, error) {
+	if n, err := strconv.Atoi(sel); err == nil {
+		if n < 1 || n > len(m.Items) {
+			return -1, fmt.Errorf("module %q has %d item(s), no item %d", m.Name, len(m.Items), n)
+		}
+		return n - 1, nil
+	}
+	for i, item := range m.Items {
+		if item.Name == sel {
+			return i, nil
+		}
+	}
+	var found []int
+	for i, item := range m.Items {
+		primary := item.PrimaryValue()
+		if primary == sel || ((item.File != "" || item.Directory != "") && filepath.Base(primary) == sel) {
+			found = append(found, i)
+		}
+	}
+	switch len(found) {
+	case 0:
+		return -1, fmt.Errorf("module %q has no item %q", m.Name, sel)
+	case 1:
+		return found[0], nil
+	}
+	positions := make([]string, len(found))
+	for i, idx := range found {
+		positions[i] = strconv.Itoa(idx + 1)
+	}
+	return -1, fmt.Errorf("module %q has several items matching %q (items %s); select one by position or give them names", m.Name, sel, strings.Join(positions, ", "))
+}
+
+// DefaultMaxFileSize is the limit on files inside directory items when
+// neither the item nor the config sets max_file_size.
+const DefaultMaxFileSize = 100 << 20
+
+var sizeUnits = []struct {
+	suffix string
+	scale  int64
+}{
+	{"KIB", 1 << 10}, {"MIB", 1 << 20}, {"GIB", 1 << 30}, {"TIB", 1 << 40},
+	{"KB", 1 << 10}, {"MB", 1 << 20}, {"GB", 1 << 30}, {"TB", 1 << 40},
+	{"K", 1 << 10}, {"M", 1 << 20}, {"G", 1 << 30}, {"T", 1 << 40},
+	{"B", 1},
+}
+
+// ParseSize parses a byte count with an optional binary unit, such as
+// "4096", "512KB", "100MB", or "2GiB". KB, MB, GB, and TB are powers of
+// 1024, as are K, M, G, and T.
+func ParseSize(s string) (int64, error) {
+	num, scale := strings.ToUpper(strings.TrimSpace(s)), int64(1)
+	for _, u := range sizeUnits {
+		if strings.HasSuffix(num, u.suffix) {
+			num, scale = strings.TrimSpace(strings.TrimSuffix(num, u.suffix)), u.scale
+			break
+		}
+	}
+	n, err := strconv.ParseInt(num, 10, 64)
+	if err != nil || n < 0 || n > math.MaxInt64/scale {
+		return 0, fmt.Errorf("invalid size %q (want a byte count such as 100MB)", s)
+	}
+	return n * scale, nil
+}
+
+// MaxFileSizeFor returns the limit in bytes on files inside the directory
+// item: its max_file_size, else the config's, else DefaultMaxFileSize. Zero
+// means no limit. Invalid sizes, which Validate reports, give the default.
+func (c Config) MaxFileSizeFor(item Item) int64 {
+	for _, s := range []string{item.MaxFileSize, c.MaxFileSize} {
+		if s == "" {
+			continue
+		}
+		if n, err := ParseSize(s); err == nil {
+			return n
+		}
+		break
+	}
+	return DefaultMaxFileSize
+}
+
+// pluginPattern matches a shell_plugin: a GitHub "owner/repo" or an https or
+// ssh git URL, with nothing a shell or fish would interpret.
+var pluginPattern = regexp.MustCompile(`^([A-Za-z0-9_.-]+/[A-Za-z0-9_.-]+|(https://|ssh://|git@)[A-Za-z0-9_.~:/@%+-]+)$`)
+
+// pluginRefPattern matches a shell_plugin version: a tag, branch, or commit.
+var pluginRefPattern = regexp.MustCompile(`^[A-Za-z0-9_.][A-Za-z0-9_./+-]*$`)
+
+// Validate checks the structure of a parsed config: every module has a
+// unique name and every local item has a recognised type and direction. All
+// problems are reported together.
+func (c Config) Validate() error {
+	var errs []error
+	if !shell.Shell(c.Shell).Valid() {
+		errs = append(errs, fmt.Errorf("unknown shell %q (want %s)", c.Shell, strings.Join(shell.Names, ", ")))
+	}
+	switch c.Store.Layout {
+	case "", LayoutModule, LayoutFlat:
+	default:
+		errs = append(errs, fmt.Errorf("store: unknown layout %q (want module or flat)", c.Store.Layout))
+	}
+	if filepath.IsAbs(c.Store.Dir) {
+		errs = append(errs, fmt.Errorf("store: dir %q must be relative to the config file", c.Store.Dir))
+	}
+	if c.Age != nil && c.Age.Passphrase != "" && c.Age.PassphraseCommand != "" {
+		errs = append(errs, fmt.Errorf("age: set passphrase or passphrase_command, not both"))
+	}
+	switch c.Color {
+	case "", color.ModeAuto, color.ModeAlways, color.ModeNever:
+	default:
+		errs = append(errs, fmt.Errorf("unknown color mode %q (want auto, always, or never)", c.Color))
+	}
+	if c.HTTP.Timeout != "" {
+		if _, err := time.ParseDuration(c.HTTP.Timeout); err != nil {
+			errs = append(errs, fmt.Errorf("http: invalid timeout %q", c.HTTP.Timeout))
+		}
+	}
+	if (c.HTTP.ClientCert == "") != (c.HTTP.ClientKey == "") {
+		errs = append(errs, fmt.Errorf("http: set client_cert and client_key together"))
+	}
+	if (len(c.HTTP.Headers) > 0 || c.HTTP.ClientCert != "") && len(c.HTTP.Hosts) == 0 {
+		errs = append(errs, fmt.Errorf("http: headers and client_cert need hosts, the hosts or URL prefixes to send them to"))
+	}
+	for i, m := range c.Registry.Mirrors {
+		urls := []string{m.URL}
+		if m.Prefix != "" {
+			urls = append(urls, m.Prefix)
+		}
+		for _, u := range urls {
+			if !strings.HasPrefix(u, "https://") && !strings.HasPrefix(u, "http://") {
+				errs = append(errs, fmt.Errorf("registry: mirror %d: invalid URL %q (want http:// or https://)", i+1, u))
+			}
+		}
+		if (m.ClientCert == "") != (m.ClientKey == "") {
+			errs = append(errs, fmt.Errorf("registry: mirror %d: set client_cert and client_key together", i+1))
+		}
+	}
+	if c.MaxFileSize != "" {
+		if _, err := ParseSize(c.MaxFileSize); err != nil {
+			errs = append(errs, fmt.Errorf("max_file_size: %w", err))
+		}
+	}
+	switch c.Trust.Community {
+	case "", TrustPrompt, TrustAllow, TrustDeny:
+	default:
+		errs = append(errs, fmt.Errorf("trust: unknown community policy %q (want prompt, allow, or deny)", c.Trust.Community))
+	}
+	for _, host := range c.Trust.PrivateHosts {
+		if strings.TrimSuffix(host, "/") == "" || strings.Contains(host, "@") {
+			errs = append(errs, fmt.Errorf("trust: invalid private host %q (want a ref prefix such as github.com/myorg)", host))
+		}
+	}
+	seen := make(map[string]bool)
+	for name := range c.groups {
+		seen[name] = true
+	}
+	for i, mod := range c.Modules {
+		if mod.Name == "" {
+			errs = append(errs, fmt.Errorf("module %d: missing name", i+1))
+			continue
+		}
+		if seen[mod.Name] {
+			errs = append(errs, fmt.Errorf("module %q: duplicate name", mod.Name))
+		}
+		seen[mod.Name] = true
+		itemNames := make(map[string]bool)
+		for j, item := range mod.Items {
+			if item.Name != "" {
+				if itemNames[item.Name] {
+					errs = append(errs, fmt.Errorf("module %q item %d: duplicate item name %q", mod.Name, j+1, item.Name))
+				}
+				itemNames[item.Name] = true
+			}
+			if item.Type() == "unknown" {
+				errs = append(errs, fmt.Errorf("module %q item %d: no item type (package, script, setting, file, directory, binary, run, dock, login_item, repo, container, extension, default_app, shell_plugin, gpg_key, or ssh_host)", mod.Name, j+1))
+			}
+			switch item.Direction {
+			case "", "push", "pull", "sync":
+			default:
+				errs = append(errs, fmt.Errorf("module %q item %d: invalid direction %q", mod.Name, j+1, item.Direction))
+			}
+			if item.Remote != "" && item.Via != "flatpak" && item.Via != "winget" {
+				errs = append(errs, fmt.Errorf("module %q item %d: remote applies to flatpak and winget packages only", mod.Name, j+1))
+			}
+			if item.RemoteURL != "" && item.Via != "flatpak" {
+				errs = append(errs, fmt.Errorf("module %q item %d: remote_url applies to flatpak packages only", mod.Name, j+1))
+			}
+			if len(item.Options) > 0 && item.Package == "" {
+				errs = append(errs, fmt.Errorf("module %q item %d: options apply to packages only", mod.Name, j+1))
+			}
+			if (item.Channel != "" || item.Classic) && item.Via != "snap" {
+				errs = append(errs, fmt.Errorf("module %q item %d: channel and classic apply to snap packages only", mod.Name, j+1))
+			}
+			if item.Repo != "" {
+				switch item.Via {
+				case "brew", "apt", "dnf", "choco", "scoop":
+				default:
+					errs = append(errs, fmt.Errorf("module %q item %d: repo needs via: brew, apt, dnf, choco, or scoop", mod.Name, j+1))
+				}
+			}
+			if item.KeyURL != "" && (item.Repo == "" || item.Via != "apt") {
+				errs = append(errs, fmt.Errorf("module %q item %d: key_url applies to apt repos only", mod.Name, j+1))
+			}
+			if item.Container != "" {
+				if item.Image != "" && item.Compose != "" {
+					errs = append(errs, fmt.Errorf("module %q item %d: set image or compose, not both", mod.Name, j+1))
+				}
+				if item.Image == "" && (len(item.Ports) > 0 || len(item.Volumes) > 0) {
+					errs = append(errs, fmt.Errorf("module %q item %d: ports and volumes need an image", mod.Name, j+1))
+				}
+				switch item.Via {
+				case "", "docker", "podman":
+				default:
+					errs = append(errs, fmt.Errorf("module %q item %d: invalid container via %q (want docker or podman)", mod.Name, j+1, item.Via))
+				}
+			}
+			if item.Type() == "extension" {
+				switch item.Via {
+				case "", "vscode", "vscodium", "cursor":
+				default:
+					errs = append(errs, fmt.Errorf("module %q item %d: invalid extension via %q (want vscode, vscodium, or cursor)", mod.Name, j+1, item.Via))
+				}
+				if item.Extension != "" && len(item.Extensions) > 0 {
+					errs = append(errs, fmt.Errorf("module %q item %d: set extension or extensions, not both", mod.Name, j+1))
+				}
+			}
+			if !item.DefaultApp.IsZero() && len(item.Handles) == 0 {
+				errs = append(errs, fmt.Errorf("module %q item %d: default_app needs handles", mod.Name, j+1))
+			}
+			if item.ShellPlugin != "" {
+				switch item.Via {
+				case "oh-my-zsh", "zinit", "antidote", "fisher", "tpm":
+				default:
+					errs = append(errs, fmt.Errorf("module %q item %d: shell_plugin needs via: oh-my-zsh, zinit, antidote, fisher, or tpm", mod.Name, j+1))
+				}
+				if !pluginPattern.MatchString(item.ShellPlugin) {
+					errs = append(errs, fmt.Errorf("module %q item %d: invalid shell_plugin %q (want owner/repo or a git URL)", mod.Name, j+1, item.ShellPlugin))
+				}
+				if item.Version != "" && !pluginRefPattern.MatchString(item.Version) {
+					errs = append(errs, fmt.Errorf("module %q item %d: invalid shell_plugin version %q (want a tag, branch, or commit)", mod.Name, j+1, item.Version))
+				}
+			}
+			if item.GpgKey != "" {
+				switch item.Trust {
+				case "", "unknown", "never", "marginal", "full", "ultimate":
+				default:
+					errs = append(errs, fmt.Errorf("module %q item %d: invalid trust %q (want unknown, never, marginal, full, or ultimate)", mod.Name, j+1, item.Trust))
+				}
+				if item.KeyFile != "" && item.Keyserver != "" {
+					errs = append(errs, fmt.Errorf("module %q item %d: set key_file or keyserver, not both", mod.Name, j+1))
+				}
+			}
+			hasHostName := false
+			for k := range item.SSHOptions {
+				hasHostName = hasHostName || strings.EqualFold(k, "HostName")
+			}
+			if len(item.KnownHosts) > 0 && !hasHostName && strings.ContainsAny(item.SSHHost, "*? ") {
+				errs = append(errs, fmt.Errorf("module %q item %d: known_hosts needs a single host; set ssh_options.HostName for pattern %q", mod.Name, j+1, item.SSHHost))
+			}
+			if item.Verify.Expect != "" {
+				if item.Verify.Command == "" {
+					errs = append(errs, fmt.Errorf("module %q item %d: verify expect needs a command", mod.Name, j+1))
+				} else if _, err := regexp.Compile(item.Verify.Expect); err != nil {
+					errs = append(errs, fmt.Errorf("module %q item %d: invalid verify expect: %w", mod.Name, j+1, err))
+				}
+			}
+			if item.ChangedWhen != "" {
+				if item.Run == "" {
+					errs = append(errs, fmt.Errorf("module %q item %d: changed_when applies to run items only", mod.Name, j+1))
+				} else if _, err := regexp.Compile(item.ChangedWhen); err != nil {
+					errs = append(errs, fmt.Errorf("module %q item %d: invalid changed_when: %w", mod.Name, j+1, err))
+				}
+			}
+			if item.VerifyVersion != "" {
+				if _, err := version.ParseConstraint(item.VerifyVersion); err != nil {
+					errs = append(errs, fmt.Errorf("module %q item %d: %w", mod.Name, j+1, err))
+				}
+			}
+			if item.After != "" && !mod.IsRegistry() {
+				if err := checkAfter(mod.Items, j); err != nil {
+					errs = append(errs, fmt.Errorf("module %q item %d: %w", mod.Name, j+1, err))
+				}
+			}
+			switch item.Phase {
+			case "", PhasePre, PhaseMain, PhasePost:
+			default:
+				errs = append(errs, fmt.Errorf("module %q item %d: invalid phase %q (want pre, main, or post)", mod.Name, j+1, item.Phase))
+			}
+			switch item.DockMode {
+			case "", "replace", "add":
+			default:
+				errs = append(errs, fmt.Errorf("module %q item %d: invalid dock_mode %q (want replace or add)", mod.Name, j+1, item.DockMode))
+			}
+			if item.SkipIf != "" && item.Unless != "" {
+				errs = append(errs, fmt.Errorf("module %q item %d: set skip_if or unless, not both", mod.Name, j+1))
+			}
+			if item.Creates != "" {
+				if _, err := filepath.Match(item.Creates, ""); err != nil {
+					errs = append(errs, fmt.Errorf("module %q item %d: invalid creates pattern %q: %w", mod.Name, j+1, item.Creates, err))
+				}
+			}
+			for _, perm := range []struct{ field, value string }{{"permissions", item.Permissions}, {"dir_permissions", item.DirPermissions}} {
+				if perm.value == "" {
+					continue
+				}
+				if v, err := strconv.ParseUint(perm.value, 8, 32); err != nil || v > 0o7777 {
+					errs = append(errs, fmt.Errorf("module %q item %d: invalid %s %q (want octal, e.g. \"0600\")", mod.Name, j+1, perm.field, perm.value))
+				}
+			}
+			if item.MaxFileSize != "" {
+				if item.Directory == "" {
+					errs = append(errs, fmt.Errorf("module %q item %d: max_file_size applies to directory items only", mod.Name, j+1))
+				} else if _, err := ParseSize(item.MaxFileSize); err != nil {
+					errs = append(errs, fmt.Errorf("module %q item %d: max_file_size: %w", mod.Name, j+1, err))
+				}
+			}
+			if item.File != "" && len(item.Files) > 0 {
+				errs = append(errs, fmt.Errorf("module %q item %d: set file or files, not both", mod.Name, j+1))
+			}
+			if !shell.Shell(item.Shell).Valid() {
+				errs = append(errs, fmt.Errorf("module %q item %d: unknown shell %q (want %s)", mod.Name, j+1, item.Shell, strings.Join(shell.Names, ", ")))
+			}
+		}
 	}
-	return os.WriteFile(path, data, 0o644)
+	return errors.Join(errs...)
 }
@@ -3,6 +3,7 @@ package config
 import (
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	"gopkg.in/yaml.v3"
@@ -18,9 +19,20 @@ func TestItemType(t *testing.T) {
 		{"script", Item{Script: "setup.sh"}, "script"},
 		{"setting", Item{Setting: "com.apple.dock"}, "setting"},
 		{"file", Item{File: ".vimrc"}, "file"},
+		{"files", Item{Files: []string{"*.conf"}}, "file"},
 		{"directory", Item{Directory: "nvim"}, "directory"},
 		{"binary", Item{Binary: "nvim"}, "binary"},
 		{"run", Item{Run: "echo hello"}, "run"},
+		{"dock", Item{Dock: []string{"Safari"}}, "dock"},
+		{"login_item", Item{LoginItem: "Rectangle"}, "login_item"},
+		{"repo", Item{Repo: "homebrew/cask-fonts"}, "repo"},
+		{"container", Item{Container: "postgres", Image: "postgres:16"}, "container"},
+		{"extension", Item{Extension: "golang.go"}, "extension"},
+		{"extensions", Item{Extensions: []string{"golang.go"}}, "extension"},
+		{"default_app", Item{DefaultApp: PlatformMap{MacOS: "org.mozilla.firefox"}, Handles: []string{"https:"}}, "default_app"},
+		{"shell_plugin", Item{ShellPlugin: "zsh-users/zsh-autosuggestions", Via: "oh-my-zsh"}, "shell_plugin"},
+		{"gpg_key", Item{GpgKey: "0123456789ABCDEF", KeyFile: "me.asc"}, "gpg_key"},
+		{"ssh_host", Item{SSHHost: "github.com", SSHOptions: map[string]string{"User": "git"}}, "ssh_host"},
 		{"unknown", Item{}, "unknown"},
 	}
 	for _, tt := range tests {
@@ -45,6 +57,16 @@ func TestItemPrimaryValue(t *testing.T) {
 		{"directory", Item{Directory: "nvim"}, "nvim"},
 		{"binary", Item{Binary: "nvim"}, "nvim"},
 		{"run", Item{Run: "echo hello"}, "echo hello"},
+		{"dock", Item{Dock: []string{"Safari", "Ghostty"}}, "Safari,Ghostty"},
+		{"login_item", Item{LoginItem: "Rectangle"}, "Rectangle"},
+		{"repo", Item{Repo: "ppa:neovim-ppa/unstable"}, "ppa:neovim-ppa/unstable"},
+		{"container", Item{Container: "postgres"}, "postgres"},
+		{"extension", Item{Extension: "golang.go"}, "golang.go"},
+		{"extensions", Item{Extensions: []string{"golang.go", "vscodevim.vim"}}, "golang.go,vscodevim.vim"},
+		{"default_app", Item{DefaultApp: PlatformMap{Linux: "firefox.desktop"}, Handles: []string{"http:", "https:"}}, "http:,https:"},
+		{"shell_plugin", Item{ShellPlugin: "tmux-plugins/tmux-resurrect"}, "tmux-plugins/tmux-resurrect"},
+		{"gpg_key", Item{GpgKey: "0123456789ABCDEF"}, "0123456789ABCDEF"},
+		{"ssh_host", Item{SSHHost: "*.internal"}, "*.internal"},
 		{"unknown", Item{}, ""},
 	}
 	for _, tt := range tests {
@@ -164,6 +186,60 @@ func TestPlatformMapMarshalMapping(t *testing.T) {
 	}
 }
 
+func TestPlatformMapWSLKeys(t *testing.T) {
+	var pm PlatformMap
+	if err := yaml.Unmarshal([]byte("windows_host: ~/AppData/Local/x\nwsl: ~/.bashrc\n"), &pm); err != nil {
+		t.Fatal(err)
+	}
+	if pm.WindowsHost != "~/AppData/Local/x" || pm.WSL != "~/.bashrc" || pm.IsZero() {
+		t.Errorf("parsed = %+v", pm)
+	}
+	data, err := yaml.Marshal(pm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var back PlatformMap
+	if err := yaml.Unmarshal(data, &back); err != nil || back != pm {
+		t.Errorf("round trip = %+v, %v; want %+v", back, err, pm)
+	}
+}
+
+func TestVerifyYAML(t *testing.T) {
+	var items []Item
+	data := `
+- run: make
+  verify: test -x bin/app
+- package: neovim
+  verify:
+    command: nvim --version
+    expect: ^NVIM v0\.1\d
+`
+	if err := yaml.Unmarshal([]byte(data), &items); err != nil {
+		t.Fatal(err)
+	}
+	if items[0].Verify != (Verify{Command: "test -x bin/app"}) {
+		t.Errorf("scalar verify = %+v", items[0].Verify)
+	}
+	if items[1].Verify != (Verify{Command: "nvim --version", Expect: `^NVIM v0\.1\d`}) {
+		t.Errorf("mapping verify = %+v", items[1].Verify)
+	}
+
+	out, err := yaml.Marshal(items)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(out), "verify: test -x bin/app\n") {
+		t.Errorf("verify without expect should marshal as a string:\n%s", out)
+	}
+	var decoded []Item
+	if err := yaml.Unmarshal(out, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded[1].Verify != items[1].Verify {
+		t.Errorf("round-trip verify = %+v, want %+v", decoded[1].Verify, items[1].Verify)
+	}
+}
+
 func TestLoadNewFormat(t *testing.T) {
 	dir := t.TempDir()
 	path := filepath.Join(dir, "dotular.yaml")
@@ -194,6 +270,28 @@ modules:
 	}
 }
 
+func TestLoadGlobalHooks(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dotular.yaml")
+	data := `
+hooks:
+  before_all: git pull
+  after_all: echo done
+  on_failure: echo failed
+modules: []
+`
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := GlobalHooks{BeforeAll: "git pull", AfterAll: "echo done", OnFailure: "echo failed"}
+	if cfg.Hooks != want {
+		t.Errorf("hooks = %+v, want %+v", cfg.Hooks, want)
+	}
+}
+
 func TestLoadLegacyFormat(t *testing.T) {
 	dir := t.TempDir()
 	path := filepath.Join(dir, "dotular.yaml")
@@ -267,6 +365,45 @@ func TestConfigModule(t *testing.T) {
 	}
 }
 
+func TestModuleFindItem(t *testing.T) {
+	mod := Module{Name: "shell", Items: []Item{
+		{Package: "zsh"},
+		{File: ".zshrc"},
+		{File: "zsh/.zprofile"},
+		{File: "bash/.profile"},
+		{File: "sh/.profile"},
+		{Name: "work profile", File: "work/.profile"},
+	}}
+	for _, tt := range []struct {
+		sel  string
+		want int
+		err  string
+	}{
+		{"1", 0, ""},
+		{"5", 4, ""},
+		{"zsh", 0, ""},
+		{".zshrc", 1, ""},
+		{".zprofile", 2, ""},
+		{"sh/.profile", 4, ""},
+		{"work profile", 5, ""},
+		{"7", -1, "no item 7"},
+		{"0", -1, "no item 0"},
+		{"fish", -1, `no item "fish"`},
+		{".profile", -1, "items 4, 5, 6"},
+	} {
+		got, err := mod.FindItem(tt.sel)
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("FindItem(%q) error = %v, want %q", tt.sel, err, tt.err)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("FindItem(%q) = %d, %v; want %d", tt.sel, got, err, tt.want)
+		}
+	}
+}
+
 func TestModuleIsRegistry(t *testing.T) {
 	m := Module{From: "github.com/user/repo"}
 	if !m.IsRegistry() {
@@ -421,3 +558,133 @@ destination:
 		t.Error("expected error for sequence node")
 	}
 }
+
+func TestStoreDir(t *testing.T) {
+	tests := []struct {
+		store StoreConfig
+		want  string
+	}{
+		{StoreConfig{}, filepath.Join("/repo", "nvim")},
+		{StoreConfig{Dir: "files"}, filepath.Join("/repo", "files", "nvim")},
+		{StoreConfig{Dir: "files", Layout: LayoutFlat}, filepath.Join("/repo", "files")},
+		{StoreConfig{Layout: LayoutFlat}, "/repo"},
+	}
+	for _, tt := range tests {
+		cfg := Config{Store: tt.store}
+		if got := cfg.StoreDir("/repo", "nvim"); got != tt.want {
+			t.Errorf("StoreDir with %+v = %q, want %q", tt.store, got, tt.want)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	valid := Config{Modules: []Module{
+		{Name: "git", Items: []Item{{Package: "git"}, {File: ".gitconfig", Direction: "sync"}}},
+		{Name: "nvim", From: "github.com/atomikpanda/dotular/modules/neovim"},
+	}}
+	if err := valid.Validate(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	invalid := Config{Shell: "tcsh", Color: "sometimes", Age: &AgeConfig{Passphrase: "x", PassphraseCommand: "pass show x"}, Store: StoreConfig{Dir: "/abs", Layout: "nested"}, HTTP: HTTPConfig{Timeout: "soon", ClientCert: "me.pem"}, Registry: RegistryConfig{Mirrors: []Mirror{{URL: "mirror.internal", ClientKey: "k.pem"}}}, Trust: TrustConfig{Community: "ask", PrivateHosts: []string{"github.com/org@main"}}, Modules: []Module{
+		{Name: "git", Items: []Item{{Via: "brew"}}},
+		{Name: "git"},
+		{Items: []Item{{Run: "true"}}},
+		{Name: "shell", Items: []Item{{File: ".zshrc", Direction: "both"}}},
+		{Name: "fish", Items: []Item{{Run: "true", Shell: "fish"}}},
+		{Name: "conf", Items: []Item{{File: "a.conf", Files: []string{"*.conf"}}}},
+		{Name: "dock", Items: []Item{{Dock: []string{"Safari"}, DockMode: "merge"}}},
+		{Name: "flatpak", Items: []Item{{Package: "org.gimp.GIMP", Via: "apt", Remote: "flathub"}}},
+		{Name: "snap", Items: []Item{{Package: "code", Via: "brew", Classic: true}}},
+		{Name: "winget", Items: []Item{{Package: "Git.Git", Via: "winget", Remote: "msstore", RemoteURL: "https://example.com"}, {Run: "true", Options: []string{"-x"}}}},
+		{Name: "containers", Items: []Item{{Container: "db", Image: "postgres", Compose: "compose.yaml", Via: "nerdctl"}, {Container: "redis:7", Ports: []string{"6379:6379"}}}},
+		{Name: "editor", Items: []Item{{Extension: "golang.go", Extensions: []string{"vscodevim.vim"}, Via: "emacs"}}},
+		{Name: "browser", Items: []Item{{DefaultApp: PlatformMap{MacOS: "org.mozilla.firefox"}}}},
+		{Name: "zsh", Items: []Item{{ShellPlugin: "zsh-users/zsh-autosuggestions", Via: "prezto"}, {ShellPlugin: "a/b; rm -rf ~", Via: "fisher", Version: "v1$(id)"}}},
+		{Name: "gpg", Items: []Item{{GpgKey: "0123456789ABCDEF", Trust: "total", KeyFile: "me.asc", Keyserver: "keys.openpgp.org"}}},
+		{Name: "ssh", Items: []Item{{SSHHost: "*.internal", KnownHosts: []string{"ssh-ed25519 AAAA"}}}},
+		{Name: "repo", Items: []Item{{Repo: "extra", Via: "pacman"}, {Repo: "homebrew/cask-fonts", Via: "brew", KeyURL: "https://example.com/key"}}},
+		{Name: "verify", Items: []Item{{Run: "true", Verify: Verify{Expect: "ok"}}, {Run: "true", Verify: Verify{Command: "true", Expect: "("}}, {Run: "true", VerifyVersion: "~>1"}}},
+		{Name: "creates", Items: []Item{{Run: "true", Creates: "["}, {Run: "true", SkipIf: "true", Unless: "true"}}},
+		{Name: "changed", Items: []Item{{Package: "git", ChangedWhen: "x"}, {Run: "true", ChangedWhen: "("}}},
+		{Name: "phase", Items: []Item{{Run: "true", Phase: "late"}}},
+		{Name: "after", Items: []Item{{Run: "true", After: "binary"}, {Run: "true", After: "package"}, {Package: "git", Phase: PhasePost}}},
+		{Name: "named", Items: []Item{{Name: "rc", File: "a/.rc"}, {Name: "rc", File: "b/.rc"}}},
+	}}
+	err := invalid.Validate()
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	for _, want := range []string{"no item type", "duplicate name", "missing name", `invalid direction "both"`, `unknown shell "fish"`, `unknown shell "tcsh"`, `unknown color mode "sometimes"`, "set passphrase or passphrase_command, not both", `unknown layout "nested"`, "must be relative", "set file or files, not both", `invalid timeout "soon"`, "http: set client_cert and client_key together", `mirror 1: invalid URL "mirror.internal"`, "mirror 1: set client_cert and client_key together", `unknown community policy "ask"`, `invalid private host "github.com/org@main"`, `invalid dock_mode "merge"`, "remote applies to flatpak", "channel and classic apply to snap", "repo needs via", "key_url applies to apt", "remote_url applies to flatpak", "options apply to packages only", "set image or compose, not both", "ports and volumes need an image", `invalid container via "nerdctl"`, `invalid extension via "emacs"`, "set extension or extensions, not both", "default_app needs handles", "shell_plugin needs via", `invalid shell_plugin "a/b; rm -rf ~"`, `invalid shell_plugin version "v1$(id)"`, `invalid trust "total"`, "set key_file or keyserver, not both", "known_hosts needs a single host", "verify expect needs a command", "invalid verify expect", "invalid version constraint", "invalid creates", "set skip_if or unless, not both", "changed_when applies to run items only", "invalid changed_when", `invalid phase "late"`, `after "binary": no binary item`, `after "package": every package item runs in a later phase`, `duplicate item name "rc"`} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q should mention %q", err, want)
+		}
+	}
+}
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		in   string
+		want int64
+	}{
+		{"4096", 4096},
+		{"512KB", 512 << 10},
+		{"100MB", 100 << 20},
+		{"2GiB", 2 << 30},
+		{"1 g", 1 << 30},
+		{"0", 0},
+	}
+	for _, tt := range tests {
+		got, err := ParseSize(tt.in)
+		if err != nil || got != tt.want {
+			t.Errorf("ParseSize(%q) = %d, %v; want %d", tt.in, got, err, tt.want)
+		}
+	}
+	for _, in := range []string{"", "MB", "-1MB", "1.5GB", "99999999999TB"} {
+		if _, err := ParseSize(in); err == nil {
+			t.Errorf("ParseSize(%q): expected an error", in)
+		}
+	}
+}
+
+func TestMaxFileSizeFor(t *testing.T) {
+	item := Item{Directory: "profile"}
+	if got := (Config{}).MaxFileSizeFor(item); got != DefaultMaxFileSize {
+		t.Errorf("default = %d, want %d", got, DefaultMaxFileSize)
+	}
+	cfg := Config{MaxFileSize: "1GB"}
+	if got := cfg.MaxFileSizeFor(item); got != 1<<30 {
+		t.Errorf("config limit = %d, want 1GiB", got)
+	}
+	item.MaxFileSize = "0"
+	if got := cfg.MaxFileSizeFor(item); got != 0 {
+		t.Errorf("item limit = %d, want 0 (no limit)", got)
+	}
+
+	cfg = Config{MaxFileSize: "lots", Modules: []Module{{Name: "m", Items: []Item{{Package: "git", MaxFileSize: "1MB"}}}}}
+	err := cfg.Validate()
+	if err == nil || !strings.Contains(err.Error(), "max_file_size: invalid size") || !strings.Contains(err.Error(), "directory items only") {
+		t.Errorf("Validate() = %v, want both max_file_size problems", err)
+	}
+}
+
+func TestValidatePermissions(t *testing.T) {
+	cfg := Config{Modules: []Module{{Name: "m", Items: []Item{
+		{File: "a", Permissions: "0600"},
+		{File: "b", Permissions: "0600; rm -rf ~"},
+		{Directory: "c", DirPermissions: "0800"},
+		{Directory: "d", Permissions: "17777"},
+	}}}}
+	err := cfg.Validate()
+	if err == nil {
+		t.Fatal("expected errors")
+	}
+	for _, want := range []string{`item 2: invalid permissions "0600; rm -rf ~"`, `item 3: invalid dir_permissions "0800"`, `item 4: invalid permissions "17777"`} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Validate() = %v, want %q", err, want)
+		}
+	}
+	if strings.Contains(err.Error(), "item 1") {
+		t.Errorf("Validate() = %v, want item 1 accepted", err)
+	}
+}
@@ -0,0 +1,70 @@
+package config
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// FileName is the name dotular looks for when discovering a config file.
+const FileName = "dotular.yaml"
+
+// EnvVar names the environment variable pointing at the config file, or at
+// a directory holding one.
+const EnvVar = "DOTULAR_CONFIG"
+
+// NotFoundError is returned by Discover when no config file exists in any
+// of the searched locations. It matches fs.ErrNotExist.
+type NotFoundError struct {
+	Searched []string
+}
+
+func (e *NotFoundError) Error() string {
+	return fmt.Sprintf("no %s found (searched %s)", FileName, strings.Join(e.Searched, ", "))
+}
+
+func (e *NotFoundError) Unwrap() error { return fs.ErrNotExist }
+
+// Discover returns the config file for a command run in dir. When
+// $DOTULAR_CONFIG is set it is used as is, so it may name a file that does
+// not exist yet; a directory is taken to hold FileName. Otherwise dir and
+// each of its parents are searched for FileName, then ~/dotfiles and
+// ~/.dotfiles. A *NotFoundError lists the locations searched.
+func Discover(dir string) (string, error) {
+	if env := os.Getenv(EnvVar); env != "" {
+		if info, err := os.Stat(env); err == nil && info.IsDir() {
+			return filepath.Join(env, FileName), nil
+		}
+		return env, nil
+	}
+
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", fmt.Errorf("resolve %s: %w", dir, err)
+	}
+	var candidates []string
+	for d := dir; ; d = filepath.Dir(d) {
+		candidates = append(candidates, d)
+		if filepath.Dir(d) == d {
+			break
+		}
+	}
+	if home, err := os.UserHomeDir(); err == nil {
+		candidates = append(candidates, filepath.Join(home, "dotfiles"), filepath.Join(home, ".dotfiles"))
+	}
+
+	for _, d := range candidates {
+		path := filepath.Join(d, FileName)
+		if info, err := os.Stat(path); err == nil && !info.IsDir() {
+			return path, nil
+		}
+	}
+	return "", &NotFoundError{Searched: []string{
+		dir + " and its parents",
+		filepath.Join("~", "dotfiles"),
+		filepath.Join("~", ".dotfiles"),
+		"$" + EnvVar,
+	}}
+}
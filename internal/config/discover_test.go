@@ -0,0 +1,48 @@
+package config
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDiscover(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv(EnvVar, "")
+
+	repo := filepath.Join(home, "src", "dots")
+	nested := filepath.Join(repo, "nvim", "lua")
+	os.MkdirAll(nested, 0o755)
+	os.WriteFile(filepath.Join(repo, FileName), nil, 0o644)
+
+	if got, err := Discover(nested); err != nil || got != filepath.Join(repo, FileName) {
+		t.Errorf("from a subdirectory: Discover = %q, %v", got, err)
+	}
+
+	// Outside the repo, fall back to ~/.dotfiles.
+	elsewhere := t.TempDir()
+	var nf *NotFoundError
+	if _, err := Discover(elsewhere); !errors.As(err, &nf) || !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("without a config: err = %v, want a NotFoundError", err)
+	}
+	dotfiles := filepath.Join(home, ".dotfiles")
+	os.MkdirAll(dotfiles, 0o755)
+	os.WriteFile(filepath.Join(dotfiles, FileName), nil, 0o644)
+	if got, err := Discover(elsewhere); err != nil || got != filepath.Join(dotfiles, FileName) {
+		t.Errorf("from elsewhere: Discover = %q, %v", got, err)
+	}
+
+	// $DOTULAR_CONFIG wins, naming either a file or its directory.
+	t.Setenv(EnvVar, repo)
+	if got, _ := Discover(elsewhere); got != filepath.Join(repo, FileName) {
+		t.Errorf("with %s set to a directory: Discover = %q", EnvVar, got)
+	}
+	custom := filepath.Join(home, "custom.yaml")
+	t.Setenv(EnvVar, custom)
+	if got, _ := Discover(nested); got != custom {
+		t.Errorf("with %s set to a file: Discover = %q", EnvVar, got)
+	}
+}
@@ -0,0 +1,277 @@
+package config
+
+import (
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/atomikpanda/dotular/internal/errs"
+	"github.com/atomikpanda/dotular/internal/tags"
+)
+
+// IsGroup reports whether the module only groups child modules.
+func (m Module) IsGroup() bool { return len(m.Modules) > 0 }
+
+// InGroup reports whether the module is a member, directly or through a
+// nested group, of the named group.
+func (m Module) InGroup(name string) bool { return slices.Contains(m.Groups, name) }
+
+// MatchesTags reports whether a machine with machineTags runs the module:
+// its own only_tags and exclude_tags and the only_tags of every enclosing
+// group must all be satisfied.
+func (m Module) MatchesTags(machineTags []string) bool {
+	for _, only := range m.GroupOnlyTags {
+		if !tags.Matches(machineTags, only, nil) {
+			return false
+		}
+	}
+	return tags.Matches(machineTags, m.OnlyTags, m.ExcludeTags)
+}
+
+// Select looks up each named module or group, in the order given. A group
+// selects all of its members; a module named twice is selected once. A name
+// containing *, ?, or [ is a glob pattern over module and group names. A
+// name starting with ! drops the modules it matches from the selection, or
+// from all modules when every name does.
+func (c Config) Select(names []string) ([]Module, error) {
+	var include []string
+	excluded := make(map[string]bool)
+	for _, name := range names {
+		pattern, ok := strings.CutPrefix(name, "!")
+		if !ok {
+			include = append(include, name)
+			continue
+		}
+		matched, err := c.match(pattern)
+		if err != nil {
+			return nil, err
+		}
+		for _, mod := range matched {
+			excluded[mod.Name] = true
+		}
+	}
+
+	mods := make([]Module, 0, len(names))
+	seen := make(map[string]bool)
+	add := func(mod Module) {
+		if !seen[mod.Name] && !excluded[mod.Name] {
+			seen[mod.Name] = true
+			mods = append(mods, mod)
+		}
+	}
+	if len(include) == 0 {
+		for _, mod := range c.Modules {
+			add(mod)
+		}
+	}
+	for _, name := range include {
+		matched, err := c.match(name)
+		if err != nil {
+			return nil, err
+		}
+		for _, mod := range matched {
+			add(mod)
+		}
+	}
+	if len(mods) == 0 {
+		return nil, fmt.Errorf("%w: every selected module is excluded", errs.ErrModuleNotFound)
+	}
+	return mods, nil
+}
+
+// match returns the modules name selects: the module itself, a group's
+// members, or, for a glob pattern, every module whose name or enclosing
+// group matches it, in config order.
+func (c Config) match(name string) ([]Module, error) {
+	if !strings.ContainsAny(name, "*?[") {
+		if mod := c.Module(name); mod != nil {
+			return []Module{*mod}, nil
+		}
+		if !c.IsGroupName(name) {
+			return nil, fmt.Errorf("%w in config: %q", errs.ErrModuleNotFound, name)
+		}
+		return c.Members(name), nil
+	}
+	if _, err := path.Match(name, ""); err != nil {
+		return nil, fmt.Errorf("invalid module pattern %q: %w", name, err)
+	}
+	var out []Module
+	for _, mod := range c.Modules {
+		if ok, _ := path.Match(name, mod.Name); ok || slices.ContainsFunc(mod.Groups, func(group string) bool {
+			ok, _ := path.Match(name, group)
+			return ok
+		}) {
+			out = append(out, mod)
+		}
+	}
+	if len(out) == 0 {
+		return nil, fmt.Errorf("%w in config: nothing matches %q", errs.ErrModuleNotFound, name)
+	}
+	return out, nil
+}
+
+// Members returns the modules in the named group, in config order.
+func (c Config) Members(group string) []Module {
+	var out []Module
+	for _, mod := range c.Modules {
+		if mod.InGroup(group) {
+			out = append(out, mod)
+		}
+	}
+	return out
+}
+
+// IsGroupName reports whether name is a group rather than a module.
+func (c Config) IsGroupName(name string) bool {
+	_, ok := c.groups[name]
+	return ok
+}
+
+// flattenGroups replaces each group in mods with its members, recursively.
+// Members must match the group's tags as well as their own (see
+// GroupOnlyTags), inherit any hooks they do not set, and record the
+// enclosing group names in Groups. The
+// group definitions are returned so that Save can nest the members again.
+func flattenGroups(mods []Module) ([]Module, map[string]Module, error) {
+	groups := make(map[string]Module)
+	out, err := flattenInto(nil, mods, Module{}, nil, groups)
+	if len(groups) == 0 {
+		groups = nil
+	}
+	return out, groups, err
+}
+
+func flattenInto(out, mods []Module, parent Module, path []string, groups map[string]Module) ([]Module, error) {
+	for _, mod := range mods {
+		mod.ExcludeTags = mergeTags(parent.ExcludeTags, mod.ExcludeTags)
+		mod.Hooks = mod.Hooks.inherit(parent.Hooks)
+		mod.GroupOnlyTags = slices.Clone(parent.GroupOnlyTags)
+		if len(parent.OnlyTags) > 0 {
+			mod.GroupOnlyTags = append(mod.GroupOnlyTags, parent.OnlyTags)
+		}
+		if !mod.IsGroup() {
+			mod.Groups = slices.Clone(path)
+			out = append(out, mod)
+			continue
+		}
+
+		if mod.Name == "" {
+			return nil, fmt.Errorf("module group: missing name")
+		}
+		if len(mod.Items) > 0 || mod.From != "" {
+			return nil, fmt.Errorf("module group %q: a group holds modules, not items or from", mod.Name)
+		}
+		if _, dup := groups[mod.Name]; dup {
+			return nil, fmt.Errorf("module group %q: duplicate name", mod.Name)
+		}
+		children := mod.Modules
+		def := mod
+		def.Modules = nil
+		def.Groups = slices.Clone(path)
+		groups[mod.Name] = def
+
+		var err error
+		out, err = flattenInto(out, children, def, append(slices.Clone(path), mod.Name), groups)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+// nestGroups is the inverse of flattenGroups: it places each module back
+// under its groups, dropping the tags and hooks it inherited. A group is
+// written where its first member appears.
+func nestGroups(mods []Module, groups map[string]Module) []Module {
+	if len(groups) == 0 {
+		return mods
+	}
+	var out []Module
+	for _, mod := range mods {
+		out = nestInto(out, mod, mod.Groups, Module{}, groups)
+	}
+	return out
+}
+
+func nestInto(list []Module, mod Module, path []string, parent Module, groups map[string]Module) []Module {
+	if len(path) == 0 {
+		return append(list, mod.withoutInherited(parent))
+	}
+	def, ok := groups[path[0]]
+	if !ok {
+		// The group was removed from the config; keep the module at this level.
+		return nestInto(list, mod, path[1:], parent, groups)
+	}
+	i := slices.IndexFunc(list, func(m Module) bool { return m.Name == def.Name && m.IsGroup() })
+	if i < 0 {
+		list = append(list, def.withoutInherited(parent))
+		i = len(list) - 1
+	}
+	list[i].Modules = nestInto(list[i].Modules, mod, path[1:], def, groups)
+	return list
+}
+
+// withoutInherited removes the tags and hooks mod inherited from parent.
+func (m Module) withoutInherited(parent Module) Module {
+	m.ExcludeTags = dropTags(m.ExcludeTags, parent.ExcludeTags)
+	m.Hooks = m.Hooks.without(parent.Hooks)
+	m.Groups = nil
+	m.GroupOnlyTags = nil
+	return m
+}
+
+// inherit fills hooks h does not set from parent.
+func (h ModuleHooks) inherit(parent ModuleHooks) ModuleHooks {
+	fill := func(own *string, from string) {
+		if *own == "" {
+			*own = from
+		}
+	}
+	fill(&h.BeforeApply, parent.BeforeApply)
+	fill(&h.AfterApply, parent.AfterApply)
+	fill(&h.BeforeSync, parent.BeforeSync)
+	fill(&h.AfterSync, parent.AfterSync)
+	fill(&h.BeforeUnapply, parent.BeforeUnapply)
+	fill(&h.AfterUnapply, parent.AfterUnapply)
+	return h
+}
+
+// without clears hooks h shares with parent.
+func (h ModuleHooks) without(parent ModuleHooks) ModuleHooks {
+	drop := func(own *string, from string) {
+		if *own == from {
+			*own = ""
+		}
+	}
+	drop(&h.BeforeApply, parent.BeforeApply)
+	drop(&h.AfterApply, parent.AfterApply)
+	drop(&h.BeforeSync, parent.BeforeSync)
+	drop(&h.AfterSync, parent.AfterSync)
+	drop(&h.BeforeUnapply, parent.BeforeUnapply)
+	drop(&h.AfterUnapply, parent.AfterUnapply)
+	return h
+}
+
+func mergeTags(parent, own []string) []string {
+	if len(parent) == 0 {
+		return own
+	}
+	out := slices.Clone(parent)
+	for _, t := range own {
+		if !slices.Contains(out, t) {
+			out = append(out, t)
+		}
+	}
+	return out
+}
+
+func dropTags(tags, parent []string) []string {
+	var out []string
+	for _, t := range tags {
+		if !slices.Contains(parent, t) {
+			out = append(out, t)
+		}
+	}
+	return out
+}
@@ -0,0 +1,179 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+const groupedConfig = `modules:
+  - name: git
+    items:
+      - package: git
+  - name: editors
+    exclude_tags: [server]
+    only_tags: [desktop]
+    hooks:
+      after_apply: echo editors
+    modules:
+      - name: nvim
+        items:
+          - package: neovim
+      - name: gui
+        only_tags: [darwin]
+        modules:
+          - name: vscode
+            exclude_tags: [work]
+            hooks:
+              after_apply: echo vscode
+            items:
+              - package: visual-studio-code
+`
+
+func loadString(t *testing.T, content string) (Config, string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "dotular.yaml")
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cfg, path
+}
+
+func TestLoadFlattensGroups(t *testing.T) {
+	cfg, _ := loadString(t, groupedConfig)
+
+	var names []string
+	for _, mod := range cfg.Modules {
+		names = append(names, mod.Name)
+	}
+	if !slices.Equal(names, []string{"git", "nvim", "vscode"}) {
+		t.Fatalf("modules = %v, want groups replaced by their members", names)
+	}
+
+	nvim := cfg.Module("nvim")
+	if !slices.Equal(nvim.Groups, []string{"editors"}) {
+		t.Errorf("nvim.Groups = %v", nvim.Groups)
+	}
+	if nvim.Hooks.AfterApply != "echo editors" {
+		t.Errorf("nvim did not inherit the group hook: %+v", nvim.Hooks)
+	}
+	if !slices.Equal(nvim.ExcludeTags, []string{"server"}) || len(nvim.OnlyTags) != 0 {
+		t.Errorf("nvim tags: only=%v exclude=%v", nvim.OnlyTags, nvim.ExcludeTags)
+	}
+	if len(nvim.GroupOnlyTags) != 1 || !slices.Equal(nvim.GroupOnlyTags[0], []string{"desktop"}) {
+		t.Errorf("nvim.GroupOnlyTags = %v", nvim.GroupOnlyTags)
+	}
+
+	vscode := cfg.Module("vscode")
+	if !slices.Equal(vscode.Groups, []string{"editors", "gui"}) {
+		t.Errorf("vscode.Groups = %v", vscode.Groups)
+	}
+	if vscode.Hooks.AfterApply != "echo vscode" {
+		t.Errorf("vscode's own hook was replaced: %+v", vscode.Hooks)
+	}
+	if !slices.Equal(vscode.ExcludeTags, []string{"server", "work"}) {
+		t.Errorf("vscode.ExcludeTags = %v", vscode.ExcludeTags)
+	}
+	if len(vscode.GroupOnlyTags) != 2 {
+		t.Errorf("vscode.GroupOnlyTags = %v, want both groups' only_tags", vscode.GroupOnlyTags)
+	}
+
+	if !cfg.IsGroupName("gui") || cfg.IsGroupName("nvim") {
+		t.Error("IsGroupName mismatch")
+	}
+	var members []string
+	for _, mod := range cfg.Members("editors") {
+		members = append(members, mod.Name)
+	}
+	if !slices.Equal(members, []string{"nvim", "vscode"}) {
+		t.Errorf("Members(editors) = %v", members)
+	}
+}
+
+func TestLoadGroupErrors(t *testing.T) {
+	for name, content := range map[string]string{
+		"items":     "modules:\n  - name: g\n    items: [{run: x}]\n    modules: [{name: a}]\n",
+		"duplicate": "modules:\n  - name: g\n    modules: [{name: a}]\n  - name: g\n    modules: [{name: b}]\n",
+		"unnamed":   "modules:\n  - modules: [{name: a}]\n",
+	} {
+		path := filepath.Join(t.TempDir(), "dotular.yaml")
+		os.WriteFile(path, []byte(content), 0o644)
+		if _, err := Load(path); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestValidateGroupNameClash(t *testing.T) {
+	cfg, _ := loadString(t, "modules:\n  - name: nvim\n    modules: [{name: nvim}]\n")
+	if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "duplicate name") {
+		t.Errorf("Validate() = %v, want a duplicate name error", err)
+	}
+}
+
+func TestSaveRenestsGroups(t *testing.T) {
+	cfg, path := loadString(t, groupedConfig)
+	cfg.Module("vscode").Items = append(cfg.Module("vscode").Items, Item{File: "settings.json"})
+	cfg.Modules = append(cfg.Modules, Module{Name: "new", Items: []Item{{Run: "true"}}})
+	if err := Save(path, cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	// The written document nests members under their groups again, without
+	// the tags and hooks they inherited.
+	data, _ := os.ReadFile(path)
+	var raw struct {
+		Modules []Module `yaml:"modules"`
+	}
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		t.Fatal(err)
+	}
+	if len(raw.Modules) != 3 || raw.Modules[1].Name != "editors" || raw.Modules[2].Name != "new" {
+		t.Fatalf("top-level modules = %+v", raw.Modules)
+	}
+	editors := raw.Modules[1]
+	if len(editors.Modules) != 2 || editors.Modules[0].Name != "nvim" || editors.Modules[1].Name != "gui" {
+		t.Fatalf("editors members = %+v", editors.Modules)
+	}
+	if nvim := editors.Modules[0]; nvim.Hooks.AfterApply != "" || len(nvim.ExcludeTags) != 0 {
+		t.Errorf("nvim was saved with inherited settings: %+v", nvim)
+	}
+	vscode := editors.Modules[1].Modules[0]
+	if !slices.Equal(vscode.ExcludeTags, []string{"work"}) || len(vscode.Items) != 2 {
+		t.Errorf("vscode saved as %+v", vscode)
+	}
+
+	reloaded, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := reloaded.Module("vscode"); got == nil || !slices.Equal(got.Groups, []string{"editors", "gui"}) || len(got.Items) != 2 {
+		t.Errorf("reloaded vscode = %+v", got)
+	}
+}
+
+func TestModuleMatchesTags(t *testing.T) {
+	cfg, _ := loadString(t, groupedConfig)
+	vscode := cfg.Module("vscode")
+	for _, tt := range []struct {
+		machine []string
+		want    bool
+	}{
+		{[]string{"desktop", "darwin"}, true},
+		{[]string{"darwin"}, false},                    // misses the outer group's only_tags
+		{[]string{"desktop"}, false},                   // misses the inner group's only_tags
+		{[]string{"desktop", "darwin", "work"}, false}, // excluded by its own tag
+	} {
+		if got := vscode.MatchesTags(tt.machine); got != tt.want {
+			t.Errorf("MatchesTags(%v) = %v, want %v", tt.machine, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,373 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Save writes cfg to path using the mapping format. Members of module groups
+// are written back under their groups.
+//
+// When path already holds a config, Save edits its YAML tree rather than
+// replacing it: nodes whose value did not change are kept as written, with
+// their comments, key order, anchors, and quoting, and changed values are
+// spliced in. The edit is only used if it reads back as cfg; otherwise the
+// file is rewritten from cfg alone.
+func Save(path string, cfg Config) error {
+	cfg.Modules = nestGroups(cfg.Modules, cfg.groups)
+	data, err := yaml.Marshal(&cfg)
+	if err != nil {
+		return fmt.Errorf("marshal config: %w", err)
+	}
+	if old, err := os.ReadFile(path); err == nil {
+		if edited, ok := editConfig(old, cfg, data); ok {
+			data = edited
+		}
+	}
+	return os.WriteFile(path, data, 0o644)
+}
+
+// editConfig merges cfg, whose groups are already nested and which marshals
+// to fresh, into the YAML document old. It reports false when old cannot be
+// edited or the edit would not read back as cfg.
+func editConfig(old []byte, cfg Config, fresh []byte) ([]byte, bool) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(old, &doc); err != nil || doc.Kind != yaml.DocumentNode || len(doc.Content) == 0 {
+		return nil, false
+	}
+	var want yaml.Node
+	if err := want.Encode(&cfg); err != nil {
+		return nil, false
+	}
+
+	root := doc.Content[0]
+	if root.Kind == yaml.SequenceNode {
+		// Legacy bare-sequence format: the sequence becomes the modules key.
+		root = &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map", Content: []*yaml.Node{
+			{Kind: yaml.ScalarNode, Tag: "!!str", Value: "modules"}, root,
+		}}
+	}
+	doc.Content[0] = mergeNode(root, &want, reflect.TypeOf(cfg))
+	untagMergeKeys(&doc)
+
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(indentOf(old))
+	if err := enc.Encode(&doc); err != nil {
+		return nil, false
+	}
+	if err := enc.Close(); err != nil {
+		return nil, false
+	}
+
+	back, err := parse(buf.Bytes())
+	if err != nil {
+		return nil, false
+	}
+	back.Modules = nestGroups(back.Modules, back.groups)
+	if again, err := yaml.Marshal(&back); err != nil || !bytes.Equal(again, fresh) {
+		return nil, false
+	}
+	return buf.Bytes(), true
+}
+
+// mergeNode returns want spliced into old, reusing old's nodes wherever they
+// already hold the same value. t is the Go type both decode to, or nil when
+// it is unknown.
+func mergeNode(old, want *yaml.Node, t reflect.Type) *yaml.Node {
+	if sameValue(old, want, t) {
+		return old
+	}
+	switch {
+	case old.Kind == yaml.MappingNode && want.Kind == yaml.MappingNode:
+		return mergeMapping(old, want, t)
+	case old.Kind == yaml.SequenceNode && want.Kind == yaml.SequenceNode:
+		return mergeSequence(old, want, elemType(t))
+	case old.Kind == yaml.ScalarNode && want.Kind == yaml.ScalarNode &&
+		old.ShortTag() == "!!str" && want.ShortTag() == "!!str" && old.Style&quotedStyles != 0:
+		want.Style = old.Style
+	}
+	want.Anchor = old.Anchor
+	copyComments(want, old)
+	return want
+}
+
+// quotedStyles are the scalar styles that can hold any string, and so can
+// be carried over from the old value to the new one.
+const quotedStyles = yaml.DoubleQuotedStyle | yaml.SingleQuotedStyle | yaml.LiteralStyle | yaml.FoldedStyle
+
+// mergeMapping keeps old's keys in their order with merged values, drops
+// the fields want no longer sets, and appends want's new keys.
+func mergeMapping(old, want *yaml.Node, t reflect.Type) *yaml.Node {
+	out := *old
+	out.Content = nil
+
+	wantValues := make(map[string]*yaml.Node, len(want.Content)/2)
+	for i := 0; i+1 < len(want.Content); i += 2 {
+		wantValues[want.Content[i].Value] = want.Content[i+1]
+	}
+	seen := make(map[string]bool)
+	for i := 0; i+1 < len(old.Content); i += 2 {
+		k, v := old.Content[i], old.Content[i+1]
+		ft, known := fieldType(t, k.Value)
+		if w, ok := wantValues[k.Value]; ok {
+			out.Content = append(out.Content, k, mergeNode(v, w, ft))
+			seen[k.Value] = true
+			continue
+		}
+		// Keep merge keys, keys the type does not know (such as a block
+		// that only holds anchors), and fields explicitly set to their zero
+		// value, which the encoder omits.
+		if k.Value == "<<" || (isStruct(t) && (!known || isZero(v, ft))) {
+			out.Content = append(out.Content, k, v)
+		}
+	}
+
+	inherited := mergedValues(old)
+	for i := 0; i+1 < len(want.Content); i += 2 {
+		k, v := want.Content[i], want.Content[i+1]
+		if seen[k.Value] {
+			continue
+		}
+		ft, _ := fieldType(t, k.Value)
+		if from, ok := inherited[k.Value]; ok && sameValue(from, v, ft) {
+			continue
+		}
+		out.Content = append(out.Content, k, v)
+	}
+	return &out
+}
+
+// mergeSequence pairs each element of want with an element of old: one with
+// the same value, else one with the same name, else an unpaired one between
+// its neighbours' pairs. Paired elements are merged and the rest of want is
+// inserted; unpaired old elements were removed.
+func mergeSequence(old, want *yaml.Node, et reflect.Type) *yaml.Node {
+	pair := make([]int, len(want.Content))
+	used := make([]bool, len(old.Content))
+	for i := range pair {
+		pair[i] = -1
+	}
+	claim := func(i int, match func(j int) bool, lo, hi int) {
+		for j := lo; j < hi; j++ {
+			if !used[j] && match(j) {
+				pair[i], used[j] = j, true
+				return
+			}
+		}
+	}
+	for i, w := range want.Content {
+		claim(i, func(j int) bool { return sameValue(old.Content[j], w, et) }, 0, len(old.Content))
+	}
+	for i, w := range want.Content {
+		if name := nameOf(w); pair[i] < 0 && name != "" {
+			claim(i, func(j int) bool { return nameOf(old.Content[j]) == name }, 0, len(old.Content))
+		}
+	}
+	for i, w := range want.Content {
+		if pair[i] >= 0 {
+			continue
+		}
+		lo, hi := 0, len(old.Content)
+		for p := i - 1; p >= 0; p-- {
+			if pair[p] >= 0 {
+				lo = pair[p] + 1
+				break
+			}
+		}
+		for n := i + 1; n < len(pair); n++ {
+			if pair[n] >= 0 {
+				hi = pair[n]
+				break
+			}
+		}
+		claim(i, func(j int) bool { return old.Content[j].Kind == w.Kind }, lo, hi)
+	}
+
+	out := *old
+	out.Content = make([]*yaml.Node, len(want.Content))
+	for i, w := range want.Content {
+		if j := pair[i]; j >= 0 {
+			out.Content[i] = mergeNode(old.Content[j], w, et)
+		} else {
+			out.Content[i] = w
+		}
+	}
+	return &out
+}
+
+// sameValue reports whether a and b decode to equal values of type t, or
+// of any type when t is nil.
+func sameValue(a, b *yaml.Node, t reflect.Type) bool {
+	if t == nil {
+		t = reflect.TypeOf((*any)(nil)).Elem()
+	}
+	av, bv := reflect.New(t), reflect.New(t)
+	if a.Decode(av.Interface()) != nil || b.Decode(bv.Interface()) != nil {
+		return false
+	}
+	return reflect.DeepEqual(av.Elem().Interface(), bv.Elem().Interface())
+}
+
+// isZero reports whether n decodes to the zero value of t.
+func isZero(n *yaml.Node, t reflect.Type) bool {
+	if t == nil {
+		return false
+	}
+	v := reflect.New(t)
+	return n.Decode(v.Interface()) == nil && v.Elem().IsZero()
+}
+
+// mergedValues returns the values a mapping takes from its << merge keys.
+func mergedValues(m *yaml.Node) map[string]*yaml.Node {
+	values := make(map[string]*yaml.Node)
+	var add func(n *yaml.Node)
+	add = func(n *yaml.Node) {
+		for n.Kind == yaml.AliasNode && n.Alias != nil {
+			n = n.Alias
+		}
+		switch n.Kind {
+		case yaml.MappingNode:
+			for i := 0; i+1 < len(n.Content); i += 2 {
+				if _, ok := values[n.Content[i].Value]; !ok {
+					values[n.Content[i].Value] = n.Content[i+1]
+				}
+			}
+		case yaml.SequenceNode:
+			for _, c := range n.Content {
+				add(c)
+			}
+		}
+	}
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		if m.Content[i].Value == "<<" {
+			add(m.Content[i+1])
+		}
+	}
+	return values
+}
+
+// untagMergeKeys clears the tag yaml.v3 gives parsed << keys, which it
+// would otherwise write out as "!!merge <<".
+func untagMergeKeys(n *yaml.Node) {
+	if n.Kind == yaml.MappingNode {
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			if k := n.Content[i]; k.Value == "<<" && k.Tag == "!!merge" {
+				k.Tag = ""
+			}
+		}
+	}
+	for _, c := range n.Content {
+		untagMergeKeys(c)
+	}
+}
+
+// nameOf returns the name key of a mapping node, such as a module's.
+func nameOf(n *yaml.Node) string {
+	if n.Kind != yaml.MappingNode {
+		return ""
+	}
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		if n.Content[i].Value == "name" && n.Content[i+1].Kind == yaml.ScalarNode {
+			return n.Content[i+1].Value
+		}
+	}
+	return ""
+}
+
+// copyComments carries old's comments over to n where n has none.
+func copyComments(n, old *yaml.Node) {
+	if n.HeadComment == "" {
+		n.HeadComment = old.HeadComment
+	}
+	if n.LineComment == "" {
+		n.LineComment = old.LineComment
+	}
+	if n.FootComment == "" {
+		n.FootComment = old.FootComment
+	}
+}
+
+// indentOf guesses the indentation a YAML document uses from its first
+// indented line, defaulting to yaml.Marshal's.
+func indentOf(data []byte) int {
+	for _, line := range strings.Split(string(data), "\n") {
+		trimmed := strings.TrimLeft(line, " ")
+		if trimmed == "" || trimmed == line || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		if n := len(line) - len(trimmed); n >= 2 && n <= 8 {
+			return n
+		}
+		break
+	}
+	return 4
+}
+
+func deref(t reflect.Type) reflect.Type {
+	for t != nil && t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	return t
+}
+
+func isStruct(t reflect.Type) bool {
+	t = deref(t)
+	return t != nil && t.Kind() == reflect.Struct && !t.Implements(marshalerType)
+}
+
+var marshalerType = reflect.TypeOf((*yaml.Marshaler)(nil)).Elem()
+
+// elemType returns the element type of a slice or map type, or nil.
+func elemType(t reflect.Type) reflect.Type {
+	t = deref(t)
+	if t != nil && (t.Kind() == reflect.Slice || t.Kind() == reflect.Array || t.Kind() == reflect.Map) {
+		return t.Elem()
+	}
+	return nil
+}
+
+// fieldType returns the type of the value under key in a mapping of type t:
+// the field whose yaml name is key for a struct, or the element type for a
+// map. known is false when t is a struct without such a field.
+func fieldType(t reflect.Type, key string) (ft reflect.Type, known bool) {
+	t = deref(t)
+	if t == nil {
+		return nil, false
+	}
+	if t.Kind() == reflect.Map {
+		return t.Elem(), true
+	}
+	if !isStruct(t) {
+		return nil, false
+	}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		tag := f.Tag.Get("yaml")
+		name, opts, _ := strings.Cut(tag, ",")
+		if name == "-" {
+			continue
+		}
+		if strings.Contains(opts, "inline") {
+			if ft, ok := fieldType(f.Type, key); ok {
+				return ft, true
+			}
+			continue
+		}
+		if name == "" {
+			name = strings.ToLower(f.Name)
+		}
+		if name == key {
+			return f.Type, true
+		}
+	}
+	return nil, false
+}
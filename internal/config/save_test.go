@@ -0,0 +1,177 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// saveEdited writes original to a config file, applies edit to the loaded
+// config, saves it, and returns the file's new content.
+func saveEdited(t *testing.T, original string, edit func(*Config)) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "dotular.yaml")
+	if err := os.WriteFile(path, []byte(original), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	edit(&cfg)
+	if err := Save(path, cfg); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	back, err := Load(path)
+	if err != nil {
+		t.Fatalf("saved config does not load: %v\n%s", err, data)
+	}
+	if len(back.Modules) != len(cfg.Modules) {
+		t.Fatalf("saved %d modules, want %d:\n%s", len(back.Modules), len(cfg.Modules), data)
+	}
+	return string(data)
+}
+
+func TestSaveKeepsComments(t *testing.T) {
+	original := `# My dotfiles
+modules:
+  # Shell setup
+  - name: shell
+    items:
+      - file: zshrc # the main one
+        destination: "~/"
+  - name: git # version control
+    items:
+      - package: git
+        via: brew
+`
+	got := saveEdited(t, original, func(cfg *Config) {
+		mod := cfg.Module("git")
+		mod.Items = append(mod.Items, Item{Package: "git-lfs", Via: "brew"})
+	})
+	want := `# My dotfiles
+modules:
+  # Shell setup
+  - name: shell
+    items:
+      - file: zshrc # the main one
+        destination: "~/"
+  - name: git # version control
+    items:
+      - package: git
+        via: brew
+      - package: git-lfs
+        via: brew
+`
+	if got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestSaveKeepsAnchors(t *testing.T) {
+	original := `x-brew: &brew
+  via: brew
+modules:
+  - name: tools
+    items:
+      - <<: *brew
+        package: git
+      - <<: *brew
+        package: ripgrep
+`
+	got := saveEdited(t, original, func(cfg *Config) {
+		mod := cfg.Module("tools")
+		mod.Items[1].Package = "fd"
+	})
+	for _, want := range []string{"x-brew: &brew", "- <<: *brew\n        package: git", "- <<: *brew\n        package: fd"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("missing %q in:\n%s", want, got)
+		}
+	}
+	if strings.Count(got, "via:") != 1 {
+		t.Errorf("merged keys were written out:\n%s", got)
+	}
+}
+
+func TestSaveReplacesFields(t *testing.T) {
+	original := `modules:
+  - name: editor
+    items:
+      # Installed extensions
+      - extension: golang.go
+        via: vscode
+`
+	got := saveEdited(t, original, func(cfg *Config) {
+		it := &cfg.Module("editor").Items[0]
+		it.Extension, it.Extensions = "", []string{"golang.go", "ms-python.python"}
+	})
+	want := `modules:
+  - name: editor
+    items:
+      # Installed extensions
+      - via: vscode
+        extensions:
+          - golang.go
+          - ms-python.python
+`
+	if got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestSaveRemovesModule(t *testing.T) {
+	original := `modules:
+  # first
+  - name: a
+    items: [{run: "true"}]
+  # second
+  - name: b
+    items: [{run: "true"}]
+  # third
+  - name: c
+    items: [{run: "true"}]
+`
+	got := saveEdited(t, original, func(cfg *Config) {
+		cfg.Modules = append(cfg.Modules[:1], cfg.Modules[2:]...)
+	})
+	if strings.Contains(got, "second") || !strings.Contains(got, "# first") || !strings.Contains(got, "# third") {
+		t.Errorf("got:\n%s", got)
+	}
+}
+
+func TestSaveKeepsQuotingAndZeroValues(t *testing.T) {
+	original := `modules:
+  - name: app
+    items:
+      - file: 'config.toml'
+        destination: "~/.config/app/"
+        link: false
+`
+	got := saveEdited(t, original, func(cfg *Config) {
+		cfg.Modules = append(cfg.Modules, Module{Name: "more", Items: []Item{{Run: "true"}}})
+	})
+	for _, want := range []string{"file: 'config.toml'", `destination: "~/.config/app/"`, "link: false"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("missing %q in:\n%s", want, got)
+		}
+	}
+}
+
+func TestSaveLegacyFormat(t *testing.T) {
+	original := `# legacy
+- name: a
+  items:
+    - run: "true"
+`
+	got := saveEdited(t, original, func(cfg *Config) {
+		cfg.Modules = append(cfg.Modules, Module{Name: "b", Items: []Item{{Run: "true"}}})
+	})
+	if !strings.Contains(got, "modules:") || !strings.Contains(got, "# legacy") || !strings.Contains(got, "name: b") {
+		t.Errorf("got:\n%s", got)
+	}
+}
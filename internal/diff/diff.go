@@ -0,0 +1,231 @@
+// Package diff produces line-based unified diffs for showing users what
+// changed in a config or dotfile.
+package diff
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/atomikpanda/dotular/internal/color"
+)
+
+// Op is the kind of change a Line represents.
+type Op int
+
+const (
+	Equal Op = iota
+	Delete
+	Insert
+)
+
+// Line is one line of an edit script.
+type Line struct {
+	Op   Op
+	Text string
+}
+
+// maxCells bounds the LCS table. Inputs larger than this are reported as a
+// whole-file replacement rather than spending quadratic memory.
+const maxCells = 4_000_000
+
+// Lines returns the edit script that turns a into b, line by line.
+func Lines(a, b string) []Line {
+	as, bs := splitLines(a), splitLines(b)
+
+	// Trim the common prefix and suffix so the table only covers the
+	// changed region.
+	pre := 0
+	for pre < len(as) && pre < len(bs) && as[pre] == bs[pre] {
+		pre++
+	}
+	suf := 0
+	for suf < len(as)-pre && suf < len(bs)-pre && as[len(as)-1-suf] == bs[len(bs)-1-suf] {
+		suf++
+	}
+
+	var out []Line
+	for _, s := range as[:pre] {
+		out = append(out, Line{Equal, s})
+	}
+	out = append(out, middle(as[pre:len(as)-suf], bs[pre:len(bs)-suf])...)
+	for _, s := range as[len(as)-suf:] {
+		out = append(out, Line{Equal, s})
+	}
+	return out
+}
+
+// middle diffs the changed region using a longest-common-subsequence table.
+func middle(a, b []string) []Line {
+	var out []Line
+	if (len(a)+1)*(len(b)+1) > maxCells {
+		for _, s := range a {
+			out = append(out, Line{Delete, s})
+		}
+		for _, s := range b {
+			out = append(out, Line{Insert, s})
+		}
+		return out
+	}
+
+	// lcs[i][j] is the LCS length of a[i:] and b[j:].
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			out = append(out, Line{Equal, a[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			out = append(out, Line{Delete, a[i]})
+			i++
+		default:
+			out = append(out, Line{Insert, b[j]})
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		out = append(out, Line{Delete, a[i]})
+	}
+	for ; j < len(b); j++ {
+		out = append(out, Line{Insert, b[j]})
+	}
+	return out
+}
+
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
+
+// Unified returns a unified diff of a and b with the given number of context
+// lines, labelled with fromName and toName. It returns "" when a and b are
+// identical.
+func Unified(fromName, toName, a, b string, context int) string {
+	lines := Lines(a, b)
+	if !hasChanges(lines) {
+		return ""
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "--- %s\n+++ %s\n", fromName, toName)
+
+	// Walk the script, emitting a hunk for each run of changes plus
+	// surrounding context. aLine/bLine track 1-based positions.
+	aLine, bLine := 1, 1
+	for i := 0; i < len(lines); {
+		if lines[i].Op == Equal {
+			i++
+			aLine++
+			bLine++
+			continue
+		}
+
+		start := max(i-context, 0)
+		// Extend the hunk until a run of more than 2*context equal lines.
+		end := i
+		for end < len(lines) {
+			if lines[end].Op != Equal {
+				end++
+				continue
+			}
+			run := end
+			for run < len(lines) && lines[run].Op == Equal {
+				run++
+			}
+			if run == len(lines) || run-end > 2*context {
+				end = min(end+context, len(lines))
+				break
+			}
+			end = run
+		}
+
+		hunkA, hunkB := aLine-(i-start), bLine-(i-start)
+		var aCount, bCount int
+		var body strings.Builder
+		for _, l := range lines[start:end] {
+			switch l.Op {
+			case Equal:
+				aCount++
+				bCount++
+				body.WriteString(" " + l.Text + "\n")
+			case Delete:
+				aCount++
+				body.WriteString("-" + l.Text + "\n")
+			case Insert:
+				bCount++
+				body.WriteString("+" + l.Text + "\n")
+			}
+		}
+		fmt.Fprintf(&sb, "@@ -%s +%s @@\n", hunkRange(hunkA, aCount), hunkRange(hunkB, bCount))
+		sb.WriteString(body.String())
+
+		for _, l := range lines[i:end] {
+			if l.Op != Insert {
+				aLine++
+			}
+			if l.Op != Delete {
+				bLine++
+			}
+		}
+		i = end
+	}
+	return sb.String()
+}
+
+func hasChanges(lines []Line) bool {
+	for _, l := range lines {
+		if l.Op != Equal {
+			return true
+		}
+	}
+	return false
+}
+
+func hunkRange(start, count int) string {
+	if count == 0 {
+		// An empty range names the line before the change.
+		return fmt.Sprintf("%d,0", start-1)
+	}
+	if count == 1 {
+		return fmt.Sprintf("%d", start)
+	}
+	return fmt.Sprintf("%d,%d", start, count)
+}
+
+// Colorize colors the lines of a unified diff: additions green, deletions
+// red, and hunk headers cyan. It is a no-op when color is disabled.
+func Colorize(unified string) string {
+	if unified == "" {
+		return ""
+	}
+	lines := strings.Split(strings.TrimSuffix(unified, "\n"), "\n")
+	for i, l := range lines {
+		switch {
+		case i < 2 && (strings.HasPrefix(l, "+++") || strings.HasPrefix(l, "---")):
+			lines[i] = color.Bold(l)
+		case strings.HasPrefix(l, "@@"):
+			lines[i] = color.Cyan(l)
+		case strings.HasPrefix(l, "+"):
+			lines[i] = color.Green(l)
+		case strings.HasPrefix(l, "-"):
+			lines[i] = color.Red(l)
+		}
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
@@ -0,0 +1,105 @@
+package diff
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/atomikpanda/dotular/internal/color"
+)
+
+func TestLines(t *testing.T) {
+	got := Lines("a\nb\nc\n", "a\nx\nc\n")
+	want := []Line{{Equal, "a"}, {Delete, "b"}, {Insert, "x"}, {Equal, "c"}}
+	if len(got) != len(want) {
+		t.Fatalf("got %v", got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("line %d = %v, want %v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestLinesEmpty(t *testing.T) {
+	got := Lines("", "a\nb\n")
+	if len(got) != 2 || got[0].Op != Insert || got[1].Op != Insert {
+		t.Errorf("got %v", got)
+	}
+}
+
+func TestUnifiedIdentical(t *testing.T) {
+	if got := Unified("a", "b", "x\ny\n", "x\ny\n", 3); got != "" {
+		t.Errorf("expected empty diff, got %q", got)
+	}
+	if got := Unified("a", "b", "x", "x\n", 3); got != "" {
+		t.Errorf("trailing newline alone should not produce a diff, got %q", got)
+	}
+}
+
+func TestUnified(t *testing.T) {
+	a := "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n"
+	b := "1\n2\n3\n4\nfive\n6\n7\n8\n9\n10\neleven\n"
+	got := Unified("old", "new", a, b, 1)
+	want := `--- old
++++ new
+@@ -4,3 +4,3 @@
+ 4
+-5
++five
+ 6
+@@ -10 +10,2 @@
+ 10
++eleven
+`
+	if got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestUnifiedMergesCloseHunks(t *testing.T) {
+	a := "1\n2\n3\n4\n5\n"
+	b := "one\n2\n3\n4\nfive\n"
+	got := Unified("a", "b", a, b, 2)
+	if strings.Count(got, "@@ ") != 1 {
+		t.Errorf("expected a single hunk, got:\n%s", got)
+	}
+	if !strings.Contains(got, "@@ -1,5 +1,5 @@") {
+		t.Errorf("unexpected hunk header:\n%s", got)
+	}
+}
+
+func TestUnifiedInsertIntoEmpty(t *testing.T) {
+	got := Unified("a", "b", "", "x\n", 3)
+	if !strings.Contains(got, "@@ -0,0 +1 @@") {
+		t.Errorf("unexpected diff:\n%s", got)
+	}
+}
+
+func TestLinesLargeInputFallback(t *testing.T) {
+	var a, b strings.Builder
+	for i := 0; i < 3000; i++ {
+		a.WriteString("a\n")
+		b.WriteString("b\n")
+	}
+	got := Lines(a.String(), b.String())
+	if len(got) != 6000 || got[0].Op != Delete || got[5999].Op != Insert {
+		t.Errorf("expected whole-file replacement, got %d lines", len(got))
+	}
+}
+
+func TestColorize(t *testing.T) {
+	old := color.Enabled
+	defer func() { color.Enabled = old }()
+
+	color.Enabled = false
+	in := "--- a\n+++ b\n@@ -1 +1 @@\n-x\n+y\n"
+	if got := Colorize(in); got != in {
+		t.Errorf("color disabled should be a no-op, got %q", got)
+	}
+
+	color.Enabled = true
+	got := Colorize(in)
+	if !strings.Contains(got, "\033[32m+y") || !strings.Contains(got, "\033[31m-x") {
+		t.Errorf("expected colored lines, got %q", got)
+	}
+}
@@ -0,0 +1,53 @@
+// Package errs defines the error kinds dotular's packages wrap their errors
+// in, so callers can branch with errors.Is instead of matching messages.
+package errs
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrModuleNotFound means a module or group named by the caller is not
+	// in the config, or a registry module does not exist.
+	ErrModuleNotFound = errors.New("module not found")
+
+	// ErrConflict means a file differs between the repo and the system and
+	// no resolution could be chosen.
+	ErrConflict = errors.New("unresolved conflict")
+
+	// ErrChecksumMismatch means downloaded or cached content does not match
+	// its pinned checksum. See ChecksumError.
+	ErrChecksumMismatch = errors.New("checksum mismatch")
+
+	// ErrNeedsElevation means the operation needs root or administrator
+	// rights that the current process lacks.
+	ErrNeedsElevation = errors.New("needs elevated privileges")
+
+	// ErrAborted means the run was interrupted, by a signal or a cancelled
+	// context, before it finished.
+	ErrAborted = errors.New("aborted")
+
+	// ErrLocked means another dotular process is already applying the same
+	// config.
+	ErrLocked = errors.New("config is locked by another run")
+
+	// ErrNotAccepted means a community registry module has not been
+	// reviewed and accepted in its current form.
+	ErrNotAccepted = errors.New("registry module not accepted")
+)
+
+// ChecksumError reports a checksum mismatch for Subject, such as a script
+// URL or a registry module reference. It matches ErrChecksumMismatch.
+type ChecksumError struct {
+	Subject string
+	Want    string
+	Got     string
+}
+
+func (e *ChecksumError) Error() string {
+	return fmt.Sprintf("checksum mismatch for %s (expected %s, got %s)", e.Subject, e.Want, e.Got)
+}
+
+// Is reports whether target is ErrChecksumMismatch.
+func (e *ChecksumError) Is(target error) bool { return target == ErrChecksumMismatch }
@@ -0,0 +1,24 @@
+package errs
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestChecksumError(t *testing.T) {
+	err := fmt.Errorf("registry: %w", &ChecksumError{Subject: "mod@v1", Want: "aaa", Got: "bbb"})
+	if !errors.Is(err, ErrChecksumMismatch) {
+		t.Error("ChecksumError should match ErrChecksumMismatch")
+	}
+	var ce *ChecksumError
+	if !errors.As(err, &ce) || ce.Subject != "mod@v1" {
+		t.Errorf("errors.As = %+v", ce)
+	}
+	if want := "registry: checksum mismatch for mod@v1 (expected aaa, got bbb)"; err.Error() != want {
+		t.Errorf("Error() = %q, want %q", err.Error(), want)
+	}
+	if errors.Is(err, ErrConflict) {
+		t.Error("ChecksumError should not match other kinds")
+	}
+}
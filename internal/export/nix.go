@@ -0,0 +1,143 @@
+package export
+
+import (
+	"fmt"
+	"io"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// WriteNix renders steps as a home-manager module: copies become home.file
+// entries with paths relative to the repo root, links become out-of-store
+// symlinks into the checkout at repoRoot so edits stay live, and nix and
+// nix-profile packages from nixpkgs become home.packages. Everything else,
+// including packages from other managers and destinations outside the home
+// directory, is listed as comments.
+func WriteNix(w io.Writer, repoRoot string, steps []Step) error {
+	var pkgs, files, notes []string
+	for _, s := range steps {
+		switch s.Kind {
+		case KindCopyFile, KindCopyDir, KindLink:
+			rest, ok := homeRelative(s.Target)
+			if !ok || rest == "" {
+				notes = append(notes, fmt.Sprintf("%s: %s -> %s (outside the home directory)", s.Module, s.Source, s.Target))
+				continue
+			}
+			files = append(files, nixFile(repoRoot, rest, s))
+		case KindCommands:
+			attr, ok := nixpkgsAttr(s.Manager, s.Package)
+			if !ok {
+				notes = append(notes, fmt.Sprintf("%s: package %s via %s", s.Module, s.Package, s.Manager))
+				continue
+			}
+			pkgs = append(pkgs, "pkgs."+attr)
+		default:
+			notes = append(notes, s.Module+": "+s.Note)
+		}
+	}
+
+	var b strings.Builder
+	b.WriteString("# Generated by dotular export nix. Keep it in the repo root and import it\n")
+	b.WriteString("# from your home-manager configuration.\n")
+	b.WriteString("{ config, pkgs, ... }:\n\n{\n")
+	if len(pkgs) > 0 {
+		b.WriteString("  home.packages = [\n")
+		for _, p := range pkgs {
+			fmt.Fprintf(&b, "    %s\n", p)
+		}
+		b.WriteString("  ];\n")
+	}
+	if len(files) > 0 {
+		if len(pkgs) > 0 {
+			b.WriteString("\n")
+		}
+		b.WriteString("  home.file = {\n")
+		for _, f := range files {
+			fmt.Fprintf(&b, "    %s\n", f)
+		}
+		b.WriteString("  };\n")
+	}
+	if len(notes) > 0 {
+		if len(pkgs)+len(files) > 0 {
+			b.WriteString("\n")
+		}
+		for _, n := range notes {
+			fmt.Fprintf(&b, "  # not exported: %s\n", comment(n))
+		}
+	}
+	b.WriteString("}\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// nixFile renders one home.file attribute for a copy or link to the
+// home-relative path rest.
+func nixFile(repoRoot, rest string, s Step) string {
+	key := nixString(rest)
+	switch s.Kind {
+	case KindLink:
+		target := path.Join(filepath.ToSlash(repoRoot), s.Source)
+		return fmt.Sprintf("%s.source = config.lib.file.mkOutOfStoreSymlink %s;", key, nixString(target))
+	case KindCopyDir:
+		return fmt.Sprintf("%s = { source = %s; recursive = true; };", key, nixPath(s.Source))
+	}
+	if mode, err := strconv.ParseUint(s.Mode, 8, 32); err == nil && mode&0o100 != 0 {
+		return fmt.Sprintf("%s = { source = %s; executable = true; };", key, nixPath(s.Source))
+	}
+	return fmt.Sprintf("%s.source = %s;", key, nixPath(s.Source))
+}
+
+// nixpkgsAttr returns the nixpkgs attribute path of a package installed with
+// nix-env ("nixpkgs.ripgrep") or nix profile ("ripgrep" or
+// "nixpkgs#ripgrep"). Packages from other managers or flakes have none.
+func nixpkgsAttr(manager, pkg string) (string, bool) {
+	var attr string
+	switch manager {
+	case "nix":
+		// nix-env -iA takes <channel>.<attribute>.
+		_, attr, _ = strings.Cut(pkg, ".")
+	case "nix-profile":
+		flake, a, ok := strings.Cut(pkg, "#")
+		if !ok {
+			a = flake
+		} else if flake != "nixpkgs" {
+			return "", false
+		}
+		attr = a
+	default:
+		return "", false
+	}
+	if attr == "" {
+		return "", false
+	}
+	parts := strings.Split(attr, ".")
+	for i, p := range parts {
+		if !nixIdent.MatchString(p) {
+			parts[i] = nixString(p)
+		}
+	}
+	return strings.Join(parts, "."), true
+}
+
+var (
+	nixIdent    = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_'-]*$`)
+	nixPathSafe = regexp.MustCompile(`^[A-Za-z0-9._+-]+(/[A-Za-z0-9._+-]+)*$`)
+)
+
+// nixPath returns a Nix path expression for a repo-relative path, as a
+// literal when the path allows one.
+func nixPath(rel string) string {
+	if nixPathSafe.MatchString(rel) {
+		return "./" + rel
+	}
+	return "./. + " + nixString("/"+rel)
+}
+
+// nixString quotes s as a Nix string.
+func nixString(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "${", `\${`)
+	return `"` + r.Replace(s) + `"`
+}
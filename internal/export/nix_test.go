@@ -0,0 +1,53 @@
+package export
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestWriteNix(t *testing.T) {
+	var out bytes.Buffer
+	err := WriteNix(&out, "/home/me/dotfiles", []Step{
+		{Module: "shell", Kind: KindCopyFile, Source: "shell/.zshrc", Target: "~/.zshrc", Mode: "0600"},
+		{Module: "shell", Kind: KindCopyFile, Source: "shell/bin/my tool", Target: "~/bin/my tool", Mode: "0755"},
+		{Module: "shell", Kind: KindLink, Source: "shell/.inputrc", Target: "~/.inputrc"},
+		{Module: "nvim", Kind: KindCopyDir, Source: "nvim/nvim", Target: "~/.config/nvim"},
+		{Module: "etc", Kind: KindCopyFile, Source: "etc/hosts", Target: "/etc/hosts"},
+		{Module: "tools", Kind: KindCommands, Package: "nixpkgs.ripgrep", Manager: "nix"},
+		{Module: "tools", Kind: KindCommands, Package: "nixpkgs#python3Packages.requests", Manager: "nix-profile"},
+		{Module: "tools", Kind: KindCommands, Package: "fd", Manager: "nix-profile"},
+		{Module: "tools", Kind: KindCommands, Package: "github:owner/repo#tool", Manager: "nix-profile"},
+		{Module: "tools", Kind: KindCommands, Package: "jq", Manager: "brew"},
+		{Module: "macos", Kind: KindNote, Note: "defaults write com.apple.dock autohide"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := out.String()
+	for _, want := range []string{
+		"{ config, pkgs, ... }:",
+		"    pkgs.ripgrep\n    pkgs.python3Packages.requests\n    pkgs.fd\n  ];",
+		`    ".zshrc".source = ./shell/.zshrc;`,
+		`    "bin/my tool" = { source = ./. + "/shell/bin/my tool"; executable = true; };`,
+		`    ".inputrc".source = config.lib.file.mkOutOfStoreSymlink "/home/me/dotfiles/shell/.inputrc";`,
+		`    ".config/nvim" = { source = ./nvim/nvim; recursive = true; };`,
+		"  # not exported: etc: etc/hosts -> /etc/hosts (outside the home directory)",
+		"  # not exported: tools: package github:owner/repo#tool via nix-profile",
+		"  # not exported: tools: package jq via brew",
+		"  # not exported: macos: defaults write com.apple.dock autohide",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("module missing %q:\n%s", want, got)
+		}
+	}
+	if strings.Count(got, "{") != strings.Count(got, "}") {
+		t.Errorf("unbalanced braces:\n%s", got)
+	}
+}
+
+func TestNixString(t *testing.T) {
+	if got := nixString(`a"b\c${d}`); got != `"a\"b\\c\${d}"` {
+		t.Errorf("nixString = %s", got)
+	}
+}
@@ -0,0 +1,250 @@
+// Package export renders a config's file copies and package installs in
+// other forms: a standalone shell script, for bootstrapping machines where
+// dotular itself cannot be installed first, or a home-manager module.
+package export
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Script dialects.
+const (
+	ShellPOSIX      = "sh"
+	ShellPowerShell = "powershell"
+)
+
+// Step kinds.
+const (
+	KindCopyFile = "copy-file"
+	KindCopyDir  = "copy-dir"
+	KindLink     = "link"
+	KindCommands = "commands"
+	KindNote     = "note"
+)
+
+// Step is one operation of an exported script.
+type Step struct {
+	Module string
+	Kind   string
+	// Source is the repo-side path, relative to the repo root and
+	// slash-separated, for copies and links.
+	Source string
+	// Target is the system-side path for copies and links. A "~/" prefix
+	// stands for the home directory of whoever runs the script.
+	Target string
+	Mode   string // octal permissions for a copied file, optional
+
+	// Check, for KindCommands, is a command that succeeds when the step is
+	// already done; Commands run only when it fails.
+	Check    []string
+	Commands [][]string
+	// Package and Manager name the package a KindCommands step installs.
+	Package string
+	Manager string
+
+	Note string // for KindNote: what was left out and why
+}
+
+// Write renders steps as a script in the given dialect. The script finds
+// the repo in $DOTULAR_REPO, else in its own directory.
+func Write(w io.Writer, shell string, steps []Step) error {
+	var d dialect
+	switch shell {
+	case ShellPOSIX:
+		d = posix{}
+	case ShellPowerShell:
+		d = powershell{}
+	default:
+		return fmt.Errorf("unknown script shell %q (want %q or %q)", shell, ShellPOSIX, ShellPowerShell)
+	}
+	var b strings.Builder
+	b.WriteString(d.prelude())
+	module := ""
+	for _, s := range steps {
+		if s.Module != module {
+			module = s.Module
+			fmt.Fprintf(&b, "\n# --- %s\n", comment(module))
+		}
+		b.WriteString(d.step(s))
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// lineBreaks escapes everything the POSIX shell, PowerShell, or Nix would
+// take as the end of a comment.
+var lineBreaks = strings.NewReplacer("\r\n", `\n`, "\n", `\n`, "\r", `\r`, "\u0085", `\u0085`, "\u2028", `\u2028`, "\u2029", `\u2029`)
+
+// comment makes text, such as a note built from item values, safe to write
+// after "#": a line break in it would end the comment and turn the rest into
+// code the script runs.
+func comment(text string) string {
+	return lineBreaks.Replace(text)
+}
+
+// dialect renders steps for one shell.
+type dialect interface {
+	prelude() string
+	step(s Step) string
+}
+
+// homeRelative splits a "~/"-prefixed target into its home-relative rest.
+func homeRelative(target string) (string, bool) {
+	if target == "~" {
+		return "", true
+	}
+	return strings.CutPrefix(target, "~/")
+}
+
+// --- POSIX sh ----------------------------------------------------------------
+
+type posix struct{}
+
+func (posix) prelude() string {
+	return `#!/bin/sh
+# Generated by dotular export script. Run it from a checkout of the repo.
+set -eu
+REPO="${DOTULAR_REPO:-$(cd "$(dirname "$0")" && pwd)}"
+
+copy_file() { mkdir -p "$(dirname "$2")" && cp "$1" "$2"; }
+copy_dir() { mkdir -p "$2" && cp -R "$1/." "$2/"; }
+link() {
+	mkdir -p "$(dirname "$2")"
+	if [ -e "$2" ] && [ ! -L "$2" ]; then
+		echo "dotular: $2 exists; not linking" >&2
+		return 0
+	fi
+	ln -sfn "$1" "$2"
+}
+`
+}
+
+func (p posix) step(s Step) string {
+	src := `"$REPO"/` + shQuote(s.Source)
+	dst := p.target(s.Target)
+	switch s.Kind {
+	case KindCopyFile:
+		out := fmt.Sprintf("copy_file %s %s\n", src, dst)
+		if s.Mode != "" {
+			out += fmt.Sprintf("chmod %s %s\n", shQuote(s.Mode), dst)
+		}
+		return out
+	case KindCopyDir:
+		return fmt.Sprintf("copy_dir %s %s\n", src, dst)
+	case KindLink:
+		return fmt.Sprintf("link %s %s\n", src, dst)
+	case KindCommands:
+		var cmds []string
+		for _, c := range s.Commands {
+			cmds = append(cmds, shJoin(c))
+		}
+		if len(s.Check) == 0 {
+			return strings.Join(cmds, "\n") + "\n"
+		}
+		return fmt.Sprintf("if ! %s >/dev/null 2>&1; then\n\t%s\nfi\n", shJoin(s.Check), strings.Join(cmds, "\n\t"))
+	default:
+		return "# not exported: " + comment(s.Note) + "\n"
+	}
+}
+
+func (posix) target(t string) string {
+	if rest, ok := homeRelative(t); ok {
+		if rest == "" {
+			return `"$HOME"`
+		}
+		return `"$HOME"/` + shQuote(rest)
+	}
+	return shQuote(t)
+}
+
+// shQuote single-quotes s for sh.
+func shQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+func shJoin(args []string) string {
+	quoted := make([]string, len(args))
+	for i, a := range args {
+		quoted[i] = shQuote(a)
+	}
+	return strings.Join(quoted, " ")
+}
+
+// --- PowerShell --------------------------------------------------------------
+
+type powershell struct{}
+
+func (powershell) prelude() string {
+	return `# Generated by dotular export script. Run it from a checkout of the repo.
+$ErrorActionPreference = 'Stop'
+$Repo = if ($env:DOTULAR_REPO) { $env:DOTULAR_REPO } else { $PSScriptRoot }
+
+function Copy-DotFile($Src, $Dst) {
+    New-Item -ItemType Directory -Force -Path (Split-Path -Parent $Dst) | Out-Null
+    Copy-Item -Force -LiteralPath $Src -Destination $Dst
+}
+function Copy-DotDir($Src, $Dst) {
+    New-Item -ItemType Directory -Force -Path $Dst | Out-Null
+    Copy-Item -Recurse -Force -Path (Join-Path $Src '*') -Destination $Dst
+}
+function New-DotLink($Src, $Dst) {
+    New-Item -ItemType Directory -Force -Path (Split-Path -Parent $Dst) | Out-Null
+    $item = Get-Item -LiteralPath $Dst -Force -ErrorAction SilentlyContinue
+    if ($item -and -not $item.LinkType) {
+        Write-Warning "dotular: $Dst exists; not linking"
+        return
+    }
+    New-Item -ItemType SymbolicLink -Force -Path $Dst -Target $Src | Out-Null
+}
+`
+}
+
+func (p powershell) step(s Step) string {
+	src := "(Join-Path $Repo " + psQuote(s.Source) + ")"
+	dst := p.target(s.Target)
+	switch s.Kind {
+	case KindCopyFile:
+		return fmt.Sprintf("Copy-DotFile %s %s\n", src, dst)
+	case KindCopyDir:
+		return fmt.Sprintf("Copy-DotDir %s %s\n", src, dst)
+	case KindLink:
+		return fmt.Sprintf("New-DotLink %s %s\n", src, dst)
+	case KindCommands:
+		var cmds []string
+		for _, c := range s.Commands {
+			cmds = append(cmds, psJoin(c))
+		}
+		if len(s.Check) == 0 {
+			return strings.Join(cmds, "\n") + "\n"
+		}
+		return fmt.Sprintf("%s *> $null\nif ($LASTEXITCODE -ne 0) {\n    %s\n}\n", psJoin(s.Check), strings.Join(cmds, "\n    "))
+	default:
+		return "# not exported: " + comment(s.Note) + "\n"
+	}
+}
+
+func (powershell) target(t string) string {
+	if rest, ok := homeRelative(t); ok {
+		if rest == "" {
+			return "$HOME"
+		}
+		return "(Join-Path $HOME " + psQuote(rest) + ")"
+	}
+	return psQuote(t)
+}
+
+// psQuote single-quotes s for PowerShell.
+func psQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+// psJoin renders a command invocation with the call operator.
+func psJoin(args []string) string {
+	quoted := make([]string, len(args))
+	for i, a := range args {
+		quoted[i] = psQuote(a)
+	}
+	return "& " + strings.Join(quoted, " ")
+}
@@ -0,0 +1,118 @@
+package export
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestWritePOSIXRuns(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("needs sh")
+	}
+	repo := t.TempDir()
+	home := t.TempDir()
+	os.MkdirAll(filepath.Join(repo, "shell"), 0o755)
+	os.MkdirAll(filepath.Join(repo, "nvim", "nvim", "lua"), 0o755)
+	os.WriteFile(filepath.Join(repo, "shell", ".zshrc"), []byte("zsh"), 0o644)
+	os.WriteFile(filepath.Join(repo, "shell", "it's"), []byte("quoted"), 0o644)
+	os.WriteFile(filepath.Join(repo, "nvim", "nvim", "lua", "opts.lua"), []byte("opts"), 0o644)
+
+	steps := []Step{
+		{Module: "shell", Kind: KindCopyFile, Source: "shell/.zshrc", Target: "~/.zshrc", Mode: "0600"},
+		{Module: "shell", Kind: KindLink, Source: "shell/it's", Target: "~/bin/it's"},
+		{Module: "shell", Kind: KindCommands, Check: []string{"false"}, Commands: [][]string{{"touch", filepath.Join(home, "installed")}}},
+		{Module: "shell", Kind: KindCommands, Check: []string{"true"}, Commands: [][]string{{"touch", filepath.Join(home, "skipped")}}},
+		{Module: "nvim", Kind: KindCopyDir, Source: "nvim/nvim", Target: "~/.config/nvim"},
+		{Module: "nvim", Kind: KindNote, Note: "set macOS default"},
+	}
+	var script bytes.Buffer
+	if err := Write(&script, ShellPOSIX, steps); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(script.String(), "chmod '0600' ") {
+		t.Errorf("script does not quote the mode:\n%s", script.String())
+	}
+	if !strings.Contains(script.String(), "# not exported: set macOS default") {
+		t.Errorf("script does not note the left-out item:\n%s", script.String())
+	}
+	path := filepath.Join(repo, "bootstrap.sh")
+	os.WriteFile(path, script.Bytes(), 0o755)
+	cmd := exec.Command("sh", path)
+	cmd.Env = append(os.Environ(), "HOME="+home)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("script failed: %v\n%s\n%s", err, out, script.String())
+	}
+
+	if data, _ := os.ReadFile(filepath.Join(home, ".zshrc")); string(data) != "zsh" {
+		t.Errorf(".zshrc = %q", data)
+	}
+	if info, err := os.Stat(filepath.Join(home, ".zshrc")); err != nil || info.Mode().Perm() != 0o600 {
+		t.Errorf(".zshrc mode = %v, %v; want 0600", info, err)
+	}
+	if dest, err := os.Readlink(filepath.Join(home, "bin", "it's")); err != nil || dest != filepath.Join(repo, "shell", "it's") {
+		t.Errorf("link = %q, %v", dest, err)
+	}
+	if data, _ := os.ReadFile(filepath.Join(home, ".config", "nvim", "lua", "opts.lua")); string(data) != "opts" {
+		t.Errorf("copied directory file = %q", data)
+	}
+	if _, err := os.Stat(filepath.Join(home, "installed")); err != nil {
+		t.Error("commands did not run when the check failed")
+	}
+	if _, err := os.Stat(filepath.Join(home, "skipped")); err == nil {
+		t.Error("commands ran although the check passed")
+	}
+}
+
+func TestWritePowerShell(t *testing.T) {
+	var script bytes.Buffer
+	err := Write(&script, ShellPowerShell, []Step{
+		{Module: "git", Kind: KindCopyFile, Source: "git/.gitconfig", Target: "~/.gitconfig"},
+		{Module: "git", Kind: KindCommands, Check: []string{"winget", "list", "--id", "Git.Git", "-e"}, Commands: [][]string{{"winget", "install", "--id", "Git.Git"}}},
+		{Module: "git", Kind: KindLink, Source: "git/it's", Target: `C:\tools\it's`},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"# --- git",
+		"Copy-DotFile (Join-Path $Repo 'git/.gitconfig') (Join-Path $HOME '.gitconfig')",
+		"& 'winget' 'list' '--id' 'Git.Git' '-e' *> $null\nif ($LASTEXITCODE -ne 0) {\n    & 'winget' 'install' '--id' 'Git.Git'\n}",
+		`New-DotLink (Join-Path $Repo 'git/it''s') 'C:\tools\it''s'`,
+	} {
+		if !strings.Contains(script.String(), want) {
+			t.Errorf("script missing %q:\n%s", want, script.String())
+		}
+	}
+	if err := Write(&script, "fish", nil); err == nil {
+		t.Error("expected an error for an unknown shell")
+	}
+}
+
+func TestNotesCannotInjectCode(t *testing.T) {
+	steps := []Step{{Module: "evil\ntouch /tmp/module", Kind: KindNote, Note: "shell_plugin x\ntouch /tmp/PWNED\r\nrm -rf ~"}}
+	for _, shell := range []string{ShellPOSIX, ShellPowerShell, "nix"} {
+		var out bytes.Buffer
+		var err error
+		if shell == "nix" {
+			err = WriteNix(&out, "/repo", steps)
+		} else {
+			err = Write(&out, shell, steps)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, line := range strings.Split(out.String(), "\n") {
+			if strings.HasPrefix(strings.TrimSpace(line), "touch") || strings.HasPrefix(strings.TrimSpace(line), "rm") {
+				t.Errorf("%s: note escaped its comment: %q", shell, line)
+			}
+		}
+		if !strings.Contains(out.String(), `shell_plugin x\ntouch /tmp/PWNED\nrm -rf ~`) {
+			t.Errorf("%s: note not kept on one line:\n%s", shell, out.String())
+		}
+	}
+}
@@ -0,0 +1,327 @@
+// Package expr evaluates item `when:` conditions at plan time without spawning
+// a shell. Two forms are accepted:
+//
+//   - Template: any string containing "{{" is rendered as a Go template and
+//     must produce "true" or "false", e.g. `{{ hasTag "work" }}`.
+//   - Expression: a small boolean language over the machine facts, e.g.
+//     `os == "darwin" && !hasTag("server")`.
+//
+// Both forms expose the same facts: os, arch, hostname, hasTag(name), and
+// env(name).
+package expr
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"text/template"
+)
+
+// Env holds the machine facts a condition is evaluated against.
+type Env struct {
+	OS       string
+	Arch     string
+	Hostname string
+	Tags     []string
+}
+
+// Eval evaluates condition s against env. An empty condition is true.
+func Eval(s string, env Env) (bool, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return true, nil
+	}
+	if strings.Contains(s, "{{") {
+		return evalTemplate(s, env)
+	}
+	p := &parser{src: s, env: env}
+	p.next()
+	v, err := p.parseOr()
+	if err == nil {
+		err = p.err
+	}
+	if err != nil {
+		return false, fmt.Errorf("when %q: %w", s, err)
+	}
+	if p.tok.kind != tokEOF {
+		return false, fmt.Errorf("when %q: unexpected %q", s, p.tok.text)
+	}
+	b, ok := v.(bool)
+	if !ok {
+		return false, fmt.Errorf("when %q: expression must be boolean, got %q", s, v)
+	}
+	return b, nil
+}
+
+func evalTemplate(s string, env Env) (bool, error) {
+	funcs := template.FuncMap{
+		"hasTag": func(tag string) bool { return slices.Contains(env.Tags, tag) },
+		"env":    os.Getenv,
+	}
+	t, err := template.New("when").Funcs(funcs).Option("missingkey=zero").Parse(s)
+	if err != nil {
+		return false, fmt.Errorf("when %q: %w", s, err)
+	}
+	data := map[string]any{
+		"os":       env.OS,
+		"arch":     env.Arch,
+		"hostname": env.Hostname,
+		"tags":     env.Tags,
+	}
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, data); err != nil {
+		return false, fmt.Errorf("when %q: %w", s, err)
+	}
+	switch out := strings.TrimSpace(buf.String()); out {
+	case "true":
+		return true, nil
+	case "false", "":
+		return false, nil
+	default:
+		return false, fmt.Errorf("when %q: template must render true or false, got %q", s, out)
+	}
+}
+
+// --- expression parser -------------------------------------------------------
+
+type tokKind int
+
+const (
+	tokEOF tokKind = iota
+	tokIdent
+	tokString
+	tokOp
+)
+
+type token struct {
+	kind tokKind
+	text string
+}
+
+type parser struct {
+	src string
+	pos int
+	tok token
+	env Env
+	err error
+}
+
+// next advances to the next token, recording any lexing error.
+func (p *parser) next() {
+	for p.pos < len(p.src) && (p.src[p.pos] == ' ' || p.src[p.pos] == '\t') {
+		p.pos++
+	}
+	if p.pos >= len(p.src) {
+		p.tok = token{kind: tokEOF}
+		return
+	}
+	c := p.src[p.pos]
+	switch {
+	case c == '"' || c == '\'':
+		end := strings.IndexByte(p.src[p.pos+1:], c)
+		if end < 0 {
+			p.err = fmt.Errorf("unterminated string")
+			p.tok = token{kind: tokEOF}
+			return
+		}
+		p.tok = token{kind: tokString, text: p.src[p.pos+1 : p.pos+1+end]}
+		p.pos += end + 2
+	case isIdentByte(c):
+		start := p.pos
+		for p.pos < len(p.src) && isIdentByte(p.src[p.pos]) {
+			p.pos++
+		}
+		p.tok = token{kind: tokIdent, text: p.src[start:p.pos]}
+	default:
+		for _, op := range []string{"==", "!=", "&&", "||", "!", "(", ")", ","} {
+			if strings.HasPrefix(p.src[p.pos:], op) {
+				p.tok = token{kind: tokOp, text: op}
+				p.pos += len(op)
+				return
+			}
+		}
+		p.err = fmt.Errorf("unexpected character %q", c)
+		p.tok = token{kind: tokEOF}
+	}
+}
+
+func isIdentByte(c byte) bool {
+	return c == '_' || c == '-' || c == '.' ||
+		(c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
+
+func (p *parser) isOp(op string) bool {
+	return p.tok.kind == tokOp && p.tok.text == op
+}
+
+func (p *parser) parseOr() (any, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.isOp("||") {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		l, r, err := bools(left, right, "||")
+		if err != nil {
+			return nil, err
+		}
+		left = l || r
+	}
+	return left, nil
+}
+
+func (p *parser) parseAnd() (any, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.isOp("&&") {
+		p.next()
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		l, r, err := bools(left, right, "&&")
+		if err != nil {
+			return nil, err
+		}
+		left = l && r
+	}
+	return left, nil
+}
+
+func (p *parser) parseUnary() (any, error) {
+	if p.isOp("!") {
+		p.next()
+		v, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		b, ok := v.(bool)
+		if !ok {
+			return nil, fmt.Errorf("operand of ! must be boolean")
+		}
+		return !b, nil
+	}
+	return p.parseCompare()
+}
+
+func (p *parser) parseCompare() (any, error) {
+	left, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+	if p.isOp("==") || p.isOp("!=") {
+		op := p.tok.text
+		p.next()
+		right, err := p.parsePrimary()
+		if err != nil {
+			return nil, err
+		}
+		eq := fmt.Sprint(left) == fmt.Sprint(right)
+		if op == "!=" {
+			return !eq, nil
+		}
+		return eq, nil
+	}
+	return left, nil
+}
+
+func (p *parser) parsePrimary() (any, error) {
+	if p.err != nil {
+		return nil, p.err
+	}
+	tok := p.tok
+	switch {
+	case tok.kind == tokOp && tok.text == "(":
+		p.next()
+		v, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if !p.isOp(")") {
+			return nil, fmt.Errorf("missing )")
+		}
+		p.next()
+		return v, nil
+	case tok.kind == tokString:
+		p.next()
+		return tok.text, nil
+	case tok.kind == tokIdent:
+		p.next()
+		if p.isOp("(") {
+			return p.parseCall(tok.text)
+		}
+		return p.ident(tok.text)
+	case tok.kind == tokEOF:
+		if p.err != nil {
+			return nil, p.err
+		}
+		return nil, fmt.Errorf("unexpected end of expression")
+	default:
+		return nil, fmt.Errorf("unexpected %q", tok.text)
+	}
+}
+
+func (p *parser) parseCall(name string) (any, error) {
+	p.next() // consume "("
+	var args []string
+	for !p.isOp(")") {
+		if p.tok.kind != tokString {
+			if p.err != nil {
+				return nil, p.err
+			}
+			return nil, fmt.Errorf("%s: arguments must be quoted strings", name)
+		}
+		args = append(args, p.tok.text)
+		p.next()
+		if p.isOp(",") {
+			p.next()
+		}
+	}
+	p.next() // consume ")"
+
+	if len(args) != 1 {
+		return nil, fmt.Errorf("%s expects 1 argument, got %d", name, len(args))
+	}
+	switch name {
+	case "hasTag":
+		return slices.Contains(p.env.Tags, args[0]), nil
+	case "env":
+		return os.Getenv(args[0]), nil
+	default:
+		return nil, fmt.Errorf("unknown function %q", name)
+	}
+}
+
+func (p *parser) ident(name string) (any, error) {
+	switch name {
+	case "os":
+		return p.env.OS, nil
+	case "arch":
+		return p.env.Arch, nil
+	case "hostname":
+		return p.env.Hostname, nil
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	default:
+		return nil, fmt.Errorf("unknown identifier %q (want os, arch, hostname, true, or false)", name)
+	}
+}
+
+func bools(l, r any, op string) (bool, bool, error) {
+	lb, lok := l.(bool)
+	rb, rok := r.(bool)
+	if !lok || !rok {
+		return false, false, fmt.Errorf("operands of %s must be boolean", op)
+	}
+	return lb, rb, nil
+}
@@ -0,0 +1,68 @@
+package expr
+
+import (
+	"testing"
+)
+
+var testEnv = Env{OS: "darwin", Arch: "arm64", Hostname: "laptop", Tags: []string{"work", "darwin"}}
+
+func TestEval(t *testing.T) {
+	t.Setenv("DOTULAR_TEST_WHEN", "yes")
+	tests := []struct {
+		expr string
+		want bool
+	}{
+		{"", true},
+		{`os == "darwin"`, true},
+		{`os == 'linux'`, false},
+		{`os != "linux"`, true},
+		{`hasTag("work")`, true},
+		{`!hasTag("work")`, false},
+		{`hasTag("server") || arch == "arm64"`, true},
+		{`os == "darwin" && hasTag("server")`, false},
+		{`(os == "linux" || os == "darwin") && !hasTag("server")`, true},
+		{`hostname == "laptop"`, true},
+		{`env("DOTULAR_TEST_WHEN") == "yes"`, true},
+		{`true`, true},
+		{`false || false`, false},
+		{`{{ hasTag "work" }}`, true},
+		{`{{ eq .os "linux" }}`, false},
+		{`{{ if eq .arch "arm64" }}true{{ end }}`, true},
+		{`{{ if eq .arch "amd64" }}true{{ end }}`, false},
+		{`{{ eq (env "DOTULAR_TEST_WHEN") "yes" }}`, true},
+	}
+	for _, tt := range tests {
+		got, err := Eval(tt.expr, testEnv)
+		if err != nil {
+			t.Errorf("Eval(%q) error: %v", tt.expr, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("Eval(%q) = %v, want %v", tt.expr, got, tt.want)
+		}
+	}
+}
+
+func TestEvalErrors(t *testing.T) {
+	tests := []string{
+		`os`,
+		`os ==`,
+		`unknown == "x"`,
+		`nope("x")`,
+		`hasTag(work)`,
+		`hasTag("a", "b")`,
+		`(os == "darwin"`,
+		`os == "darwin" )`,
+		`"unterminated`,
+		`os == "darwin" @`,
+		`!os`,
+		`os && true`,
+		`{{ .os }}`,
+		`{{ bad`,
+	}
+	for _, expr := range tests {
+		if _, err := Eval(expr, testEnv); err == nil {
+			t.Errorf("Eval(%q) expected error", expr)
+		}
+	}
+}
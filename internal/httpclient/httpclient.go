@@ -0,0 +1,184 @@
+// Package httpclient builds the HTTP client shared by every network-backed
+// feature: registry fetches, binary and remote-script downloads, and
+// notification webhooks.
+//
+// The client is configured from the config's http section. Headers and the
+// client certificate are sent only to the hosts or URL prefixes listed in
+// http.hosts, redirects included.
+package httpclient
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/atomikpanda/dotular/internal/config"
+	"github.com/atomikpanda/dotular/internal/platform"
+)
+
+// UserAgent is sent with every request that does not set its own.
+const UserAgent = "dotular/1"
+
+var (
+	mu     sync.RWMutex
+	shared = mustNew(config.HTTPConfig{})
+)
+
+// Client returns the shared client. It uses the default settings until
+// Configure is called.
+func Client() *http.Client {
+	mu.RLock()
+	defer mu.RUnlock()
+	return shared
+}
+
+// Configure replaces the shared client with one built from c.
+func Configure(c config.HTTPConfig) error {
+	client, err := New(c)
+	if err != nil {
+		return err
+	}
+	mu.Lock()
+	shared = client
+	mu.Unlock()
+	return nil
+}
+
+// New returns a client for c. Proxies come from the HTTP_PROXY, HTTPS_PROXY,
+// and NO_PROXY environment variables; CABundle adds trusted roots to the
+// system pool; Timeout bounds connecting and waiting for response headers,
+// but not reading the body, so large downloads are not cut off. Headers are
+// sent, and ClientCert and ClientKey presented for TLS client
+// authentication, only on requests to c.Hosts, so credentials never reach
+// webhooks, download hosts, or the target of a redirect elsewhere; setting
+// them without Hosts is an error.
+func New(c config.HTTPConfig) (*http.Client, error) {
+	if (len(c.Headers) > 0 || c.ClientCert != "") && len(c.Hosts) == 0 {
+		return nil, fmt.Errorf("http: headers and client_cert need hosts, the hosts or URL prefixes to send them to")
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = http.ProxyFromEnvironment
+
+	if c.CABundle != "" {
+		pool, err := loadCABundle(platform.ExpandPath(c.CABundle))
+		if err != nil {
+			return nil, err
+		}
+		transport.TLSClientConfig = &tls.Config{RootCAs: pool}
+	}
+
+	if c.Timeout != "" {
+		timeout, err := time.ParseDuration(c.Timeout)
+		if err != nil {
+			return nil, fmt.Errorf("http: invalid timeout %q: %w", c.Timeout, err)
+		}
+		dialer := &net.Dialer{Timeout: timeout, KeepAlive: 30 * time.Second}
+		transport.DialContext = dialer.DialContext
+		transport.TLSHandshakeTimeout = timeout
+		transport.ResponseHeaderTimeout = timeout
+	}
+
+	scoped := transport
+	if c.ClientCert != "" {
+		cert, err := tls.LoadX509KeyPair(platform.ExpandPath(c.ClientCert), platform.ExpandPath(c.ClientKey))
+		if err != nil {
+			return nil, fmt.Errorf("http: load client_cert: %w", err)
+		}
+		scoped = transport.Clone()
+		if scoped.TLSClientConfig == nil {
+			scoped.TLSClientConfig = &tls.Config{}
+		}
+		scoped.TLSClientConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	headers := http.Header{}
+	for name, value := range c.Headers {
+		headers.Set(name, resolveValue(value))
+	}
+	return &http.Client{Transport: &headerTransport{base: transport, scoped: scoped, headers: headers, hosts: c.Hosts}}, nil
+}
+
+func mustNew(c config.HTTPConfig) *http.Client {
+	client, err := New(c)
+	if err != nil {
+		panic(err)
+	}
+	return client
+}
+
+func loadCABundle(path string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("http: read ca_bundle: %w", err)
+	}
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		pool = x509.NewCertPool()
+	}
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("http: ca_bundle %s contains no PEM certificates", path)
+	}
+	return pool, nil
+}
+
+// resolveValue returns the named environment variable for "env:VARNAME"
+// and value unchanged otherwise.
+func resolveValue(value string) string {
+	if name, ok := strings.CutPrefix(value, "env:"); ok {
+		return os.Getenv(name)
+	}
+	return value
+}
+
+// headerTransport sets the User-Agent on requests that do not set their
+// own. Requests to hosts also get the configured headers they do not set
+// and go through scoped, which presents the client certificate. Each
+// redirect is a new request, so one that leaves hosts carries neither.
+type headerTransport struct {
+	base    http.RoundTripper
+	scoped  http.RoundTripper
+	headers http.Header
+	hosts   []string
+}
+
+func (t *headerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	if req.Header.Get("User-Agent") == "" {
+		req.Header.Set("User-Agent", UserAgent)
+	}
+	if !inScope(req.URL, t.hosts) {
+		return t.base.RoundTrip(req)
+	}
+	for name, values := range t.headers {
+		if req.Header.Get(name) == "" {
+			req.Header[name] = values
+		}
+	}
+	return t.scoped.RoundTrip(req)
+}
+
+// inScope reports whether u is covered by one of hosts: a host name, which
+// matches it on any port, "host:port", or a URL prefix such as
+// "https://artifacts.example.com/api", which matches the URLs under it.
+func inScope(u *url.URL, hosts []string) bool {
+	for _, h := range hosts {
+		if !strings.Contains(h, "://") {
+			if strings.EqualFold(u.Hostname(), h) || strings.EqualFold(u.Host, h) {
+				return true
+			}
+			continue
+		}
+		prefix, full := strings.TrimSuffix(h, "/"), u.String()
+		if full == prefix || strings.HasPrefix(full, prefix+"/") || strings.HasPrefix(full, prefix+"?") {
+			return true
+		}
+	}
+	return false
+}
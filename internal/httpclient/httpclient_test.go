@@ -0,0 +1,163 @@
+package httpclient
+
+import (
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/atomikpanda/dotular/internal/config"
+)
+
+func TestHeaders(t *testing.T) {
+	var got, gotOther http.Header
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotOther = r.Header.Clone()
+	}))
+	defer other.Close()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/redirect" {
+			http.Redirect(w, r, other.URL, http.StatusFound)
+			return
+		}
+		got = r.Header.Clone()
+	}))
+	defer srv.Close()
+
+	t.Setenv("DOTULAR_TEST_TOKEN", "s3cret")
+	client, err := New(config.HTTPConfig{
+		Headers: map[string]string{
+			"X-Team":        "dots",
+			"Authorization": "env:DOTULAR_TEST_TOKEN",
+		},
+		Hosts: []string{strings.TrimPrefix(srv.URL, "http://")},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, _ := http.NewRequest(http.MethodGet, srv.URL, nil)
+	req.Header.Set("X-Team", "override")
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if got.Get("User-Agent") != UserAgent {
+		t.Errorf("User-Agent = %q", got.Get("User-Agent"))
+	}
+	if got.Get("Authorization") != "s3cret" {
+		t.Errorf("Authorization = %q, want the env value", got.Get("Authorization"))
+	}
+	if got.Get("X-Team") != "override" {
+		t.Errorf("X-Team = %q, want the request's own value kept", got.Get("X-Team"))
+	}
+
+	for _, url := range []string{other.URL, srv.URL + "/redirect"} {
+		gotOther = nil
+		resp, err := client.Get(url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if gotOther.Get("Authorization") != "" || gotOther.Get("X-Team") != "" {
+			t.Errorf("%s: headers reached a host outside hosts: %v", url, gotOther)
+		}
+		if gotOther.Get("User-Agent") != UserAgent {
+			t.Errorf("%s: User-Agent = %q", url, gotOther.Get("User-Agent"))
+		}
+	}
+
+	if _, err := New(config.HTTPConfig{Headers: map[string]string{"Authorization": "x"}}); err == nil {
+		t.Error("expected an error for headers without hosts")
+	}
+}
+
+func TestInScope(t *testing.T) {
+	hosts := []string{"artifacts.example.com", "https://git.example.com/api"}
+	for raw, want := range map[string]bool{
+		"https://artifacts.example.com/x":    true,
+		"https://ARTIFACTS.example.com:8443": true,
+		"https://git.example.com/api/v1":     true,
+		"https://git.example.com/api":        true,
+		"https://git.example.com/apis":       false,
+		"https://git.example.com/other":      false,
+		"https://hooks.slack.com/services/x": false,
+		"https://artifacts.example.com.evil": false,
+	} {
+		u, _ := url.Parse(raw)
+		if got := inScope(u, hosts); got != want {
+			t.Errorf("inScope(%s) = %v, want %v", raw, got, want)
+		}
+	}
+}
+
+func TestCABundle(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+
+	plain, err := New(config.HTTPConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := plain.Get(srv.URL); err == nil {
+		t.Fatal("expected a certificate error without the CA bundle")
+	}
+
+	bundle := filepath.Join(t.TempDir(), "ca.pem")
+	cert := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+	if err := os.WriteFile(bundle, cert, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	client, err := New(config.HTTPConfig{CABundle: bundle})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := client.Get(srv.URL)
+	if err != nil {
+		t.Fatalf("with ca_bundle: %v", err)
+	}
+	resp.Body.Close()
+}
+
+func TestInvalidConfig(t *testing.T) {
+	empty := filepath.Join(t.TempDir(), "empty.pem")
+	os.WriteFile(empty, []byte("not a certificate"), 0o644)
+
+	for name, c := range map[string]config.HTTPConfig{
+		"missing bundle": {CABundle: filepath.Join(t.TempDir(), "nope.pem")},
+		"empty bundle":   {CABundle: empty},
+		"bad timeout":    {Timeout: "soon"},
+		"missing cert":   {ClientCert: filepath.Join(t.TempDir(), "me.pem"), ClientKey: filepath.Join(t.TempDir(), "me.key"), Hosts: []string{"example.com"}},
+		"unscoped cert":  {ClientCert: "me.pem", ClientKey: "me.key"},
+	} {
+		if _, err := New(c); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestConfigure(t *testing.T) {
+	orig := Client()
+	t.Cleanup(func() {
+		mu.Lock()
+		shared = orig
+		mu.Unlock()
+	})
+	if err := Configure(config.HTTPConfig{Timeout: "bad"}); err == nil {
+		t.Error("expected an error for an invalid timeout")
+	}
+	if Client() != orig {
+		t.Error("a failed Configure must keep the previous client")
+	}
+	if err := Configure(config.HTTPConfig{Timeout: "5s"}); err != nil {
+		t.Fatal(err)
+	}
+	if Client() == orig {
+		t.Error("Configure did not replace the shared client")
+	}
+}
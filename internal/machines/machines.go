@@ -0,0 +1,94 @@
+// Package machines keeps the inventory of machines applied from one repo.
+// The inventory lives in dotular.machines.yaml next to dotular.yaml and is
+// meant to be committed, so every machine can see when the others last
+// applied and what they applied.
+package machines
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// FileName is the inventory's name, next to the config file.
+const FileName = "dotular.machines.yaml"
+
+// Machine is one machine's entry in the inventory.
+type Machine struct {
+	Hostname  string    `yaml:"hostname" json:"hostname"`
+	OS        string    `yaml:"os" json:"os"`
+	Arch      string    `yaml:"arch" json:"arch"`
+	Tags      []string  `yaml:"tags,omitempty" json:"tags,omitempty"`
+	Version   string    `yaml:"version,omitempty" json:"version,omitempty"` // dotular version of the last apply
+	LastApply time.Time `yaml:"last_apply" json:"last_apply"`
+	// Modules maps each module the machine has applied to the hash of its
+	// resolved config and store contents at that apply.
+	Modules map[string]string `yaml:"modules,omitempty" json:"modules,omitempty"`
+}
+
+// Inventory is the set of registered machines, ordered by hostname.
+type Inventory struct {
+	Machines []Machine `yaml:"machines"`
+}
+
+// Path returns the inventory path for the config file at configPath.
+func Path(configPath string) string {
+	return filepath.Join(filepath.Dir(configPath), FileName)
+}
+
+// Load reads the inventory at path. A missing file yields an empty
+// Inventory.
+func Load(path string) (*Inventory, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return &Inventory{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var inv Inventory
+	if err := yaml.Unmarshal(data, &inv); err != nil {
+		return nil, fmt.Errorf("parse machine inventory %s: %w", path, err)
+	}
+	return &inv, nil
+}
+
+// Save writes the inventory to path.
+func (inv *Inventory) Save(path string) error {
+	data, err := yaml.Marshal(inv)
+	if err != nil {
+		return err
+	}
+	header := "# Machines applied from this repo; updated by dotular apply.\n"
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, append([]byte(header), data...), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// Register adds m or replaces the entry with the same hostname. Modules the
+// entry already had and m did not apply keep their recorded hashes.
+func (inv *Inventory) Register(m Machine) {
+	for i, existing := range inv.Machines {
+		if existing.Hostname != m.Hostname {
+			continue
+		}
+		merged := make(map[string]string, len(existing.Modules)+len(m.Modules))
+		for name, hash := range existing.Modules {
+			merged[name] = hash
+		}
+		for name, hash := range m.Modules {
+			merged[name] = hash
+		}
+		m.Modules = merged
+		inv.Machines[i] = m
+		return
+	}
+	inv.Machines = append(inv.Machines, m)
+	sort.Slice(inv.Machines, func(i, j int) bool { return inv.Machines[i].Hostname < inv.Machines[j].Hostname })
+}
@@ -0,0 +1,37 @@
+package machines
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRegisterAndRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), FileName)
+	inv, err := Load(path)
+	if err != nil || len(inv.Machines) != 0 {
+		t.Fatalf("Load missing = %+v, %v; want empty", inv, err)
+	}
+	at := time.Date(2026, 5, 1, 9, 0, 0, 0, time.UTC)
+	inv.Register(Machine{Hostname: "work", OS: "darwin", LastApply: at, Modules: map[string]string{"shell": "a", "git": "b"}})
+	inv.Register(Machine{Hostname: "home", OS: "linux", LastApply: at})
+	inv.Register(Machine{Hostname: "work", OS: "darwin", Version: "1.2.0", LastApply: at.Add(time.Hour), Modules: map[string]string{"shell": "c"}})
+	if err := inv.Save(path); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got.Machines) != 2 || got.Machines[0].Hostname != "home" || got.Machines[1].Hostname != "work" {
+		t.Fatalf("machines = %+v, want home and work in order", got.Machines)
+	}
+	work := got.Machines[1]
+	if work.Version != "1.2.0" || !work.LastApply.Equal(at.Add(time.Hour)) {
+		t.Errorf("work = %+v, want the latest registration", work)
+	}
+	if work.Modules["shell"] != "c" || work.Modules["git"] != "b" {
+		t.Errorf("work modules = %v, want shell updated and git kept", work.Modules)
+	}
+}
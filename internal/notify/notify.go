@@ -0,0 +1,166 @@
+// Package notify sends run-completion notifications to the desktop and to
+// webhooks (Slack, Discord, or generic JSON).
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"runtime"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/atomikpanda/dotular/internal/config"
+	"github.com/atomikpanda/dotular/internal/httpclient"
+)
+
+// Event describes a finished run.
+type Event struct {
+	Command  string        `json:"command"`
+	Outcome  string        `json:"outcome"` // "success" | "failure"
+	Hostname string        `json:"hostname"`
+	Applied  int           `json:"applied"`
+	Skipped  int           `json:"skipped"`
+	Failed   int           `json:"failed"`
+	Duration time.Duration `json:"duration_ns"`
+	Error    string        `json:"error,omitempty"`
+}
+
+// Title returns a one-line summary such as "dotular apply failed".
+func (e Event) Title() string {
+	verb := "succeeded"
+	if e.Outcome == "failure" {
+		verb = "failed"
+	}
+	return fmt.Sprintf("dotular %s %s", e.Command, verb)
+}
+
+// Message returns the notification body.
+func (e Event) Message() string {
+	msg := fmt.Sprintf("%d applied, %d skipped, %d failed in %s",
+		e.Applied, e.Skipped, e.Failed, e.Duration.Round(time.Second))
+	if e.Command == "verify" {
+		// Verify runs count modules whose checks passed or failed.
+		msg = fmt.Sprintf("%d modules passed, %d failed in %s",
+			e.Applied, e.Failed, e.Duration.Round(time.Second))
+	}
+	if e.Hostname != "" {
+		msg = e.Hostname + ": " + msg
+	}
+	if e.Error != "" {
+		msg += "\n" + e.Error
+	}
+	return msg
+}
+
+// Wants reports whether cfg asks for a notification on outcome.
+func Wants(cfg *config.NotifyConfig, outcome string) bool {
+	if cfg == nil || (!cfg.Desktop && len(cfg.Webhooks) == 0) {
+		return false
+	}
+	return len(cfg.On) == 0 || slices.Contains(cfg.On, outcome)
+}
+
+// Send delivers ev to every configured channel. Every channel is attempted;
+// the returned error joins the individual failures.
+func Send(ctx context.Context, cfg *config.NotifyConfig, ev Event) error {
+	if ev.Hostname == "" {
+		ev.Hostname, _ = os.Hostname()
+	}
+	var errs []error
+	if cfg.Desktop {
+		if err := desktop(ctx, ev.Title(), ev.Message()); err != nil {
+			errs = append(errs, fmt.Errorf("desktop notification: %w", err))
+		}
+	}
+	for _, wh := range cfg.Webhooks {
+		if err := postWebhook(ctx, wh, ev); err != nil {
+			errs = append(errs, fmt.Errorf("webhook %s: %w", wh.URL, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// execCommand is replaced in tests.
+var execCommand = exec.CommandContext
+
+func desktop(ctx context.Context, title, message string) error {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		script := fmt.Sprintf("display notification %s with title %s", appleString(message), appleString(title))
+		cmd = execCommand(ctx, "osascript", "-e", script)
+	case "windows":
+		cmd = execCommand(ctx, "powershell", "-NoProfile", "-Command", windowsToast(title, message))
+	default:
+		cmd = execCommand(ctx, "notify-send", title, message)
+	}
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("%w: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// appleString quotes s as an AppleScript string literal.
+func appleString(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	return `"` + strings.ReplaceAll(s, `"`, `\"`) + `"`
+}
+
+// windowsToast returns a PowerShell script that shows a balloon notification.
+func windowsToast(title, message string) string {
+	quote := func(s string) string { return "'" + strings.ReplaceAll(s, "'", "''") + "'" }
+	return strings.Join([]string{
+		"Add-Type -AssemblyName System.Windows.Forms",
+		"$n = New-Object System.Windows.Forms.NotifyIcon",
+		"$n.Icon = [System.Drawing.SystemIcons]::Information",
+		"$n.Visible = $true",
+		"$n.ShowBalloonTip(10000, " + quote(title) + ", " + quote(message) + ", 'Info')",
+		"Start-Sleep -Seconds 5",
+		"$n.Dispose()",
+	}, "; ")
+}
+
+// payload builds the webhook request body for wh's format.
+func payload(wh config.Webhook, ev Event) ([]byte, error) {
+	text := ev.Title() + "\n" + ev.Message()
+	switch wh.Format {
+	case "slack":
+		return json.Marshal(map[string]string{"text": text})
+	case "discord":
+		return json.Marshal(map[string]string{"content": text})
+	case "json", "":
+		return json.Marshal(ev)
+	default:
+		return nil, fmt.Errorf("unknown format %q (want slack, discord, or json)", wh.Format)
+	}
+}
+
+func postWebhook(ctx context.Context, wh config.Webhook, ev Event) error {
+	body, err := payload(wh, ev)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, wh.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := httpclient.Client().Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("HTTP %d", resp.StatusCode)
+	}
+	return nil
+}
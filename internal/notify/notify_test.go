@@ -0,0 +1,136 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/atomikpanda/dotular/internal/config"
+)
+
+func testEvent() Event {
+	return Event{
+		Command: "apply", Outcome: "failure", Hostname: "box",
+		Applied: 3, Skipped: 1, Failed: 1, Duration: 65 * time.Second,
+		Error: `module "x": boom`,
+	}
+}
+
+func TestEventText(t *testing.T) {
+	ev := testEvent()
+	if got := ev.Title(); got != "dotular apply failed" {
+		t.Errorf("Title() = %q", got)
+	}
+	want := "box: 3 applied, 1 skipped, 1 failed in 1m5s\nmodule \"x\": boom"
+	if got := ev.Message(); got != want {
+		t.Errorf("Message() = %q, want %q", got, want)
+	}
+
+	ev.Command, ev.Error = "verify", ""
+	if got, want := ev.Message(), "box: 3 modules passed, 1 failed in 1m5s"; got != want {
+		t.Errorf("verify Message() = %q, want %q", got, want)
+	}
+}
+
+func TestWants(t *testing.T) {
+	desktop := &config.NotifyConfig{Desktop: true}
+	failOnly := &config.NotifyConfig{Desktop: true, On: []string{"failure"}}
+	tests := []struct {
+		cfg     *config.NotifyConfig
+		outcome string
+		want    bool
+	}{
+		{nil, "failure", false},
+		{&config.NotifyConfig{On: []string{"failure"}}, "failure", false}, // no channels
+		{desktop, "success", true},
+		{desktop, "failure", true},
+		{failOnly, "success", false},
+		{failOnly, "failure", true},
+	}
+	for i, tt := range tests {
+		if got := Wants(tt.cfg, tt.outcome); got != tt.want {
+			t.Errorf("case %d: Wants(%q) = %v, want %v", i, tt.outcome, got, tt.want)
+		}
+	}
+}
+
+func TestPayload(t *testing.T) {
+	ev := testEvent()
+	for format, key := range map[string]string{"slack": "text", "discord": "content", "json": "outcome", "": "outcome"} {
+		body, err := payload(config.Webhook{Format: format}, ev)
+		if err != nil {
+			t.Fatalf("%s: %v", format, err)
+		}
+		var m map[string]any
+		if err := json.Unmarshal(body, &m); err != nil {
+			t.Fatalf("%s: %v", format, err)
+		}
+		if _, ok := m[key]; !ok {
+			t.Errorf("%s payload missing %q: %s", format, key, body)
+		}
+	}
+	if _, err := payload(config.Webhook{Format: "teams"}, ev); err == nil {
+		t.Error("expected error for unknown format")
+	}
+}
+
+func TestSendWebhook(t *testing.T) {
+	var got string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("unexpected request %s %s", r.Method, r.Header.Get("Content-Type"))
+		}
+		b, _ := io.ReadAll(r.Body)
+		got = string(b)
+	}))
+	defer srv.Close()
+
+	cfg := &config.NotifyConfig{Webhooks: []config.Webhook{{URL: srv.URL, Format: "slack"}}}
+	if err := Send(context.Background(), cfg, testEvent()); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(got, "dotular apply failed") {
+		t.Errorf("body = %s", got)
+	}
+}
+
+func TestSendWebhookError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	cfg := &config.NotifyConfig{Webhooks: []config.Webhook{{URL: srv.URL}}}
+	err := Send(context.Background(), cfg, testEvent())
+	if err == nil || !strings.Contains(err.Error(), "HTTP 500") {
+		t.Errorf("err = %v", err)
+	}
+}
+
+func TestSendDesktop(t *testing.T) {
+	var argv []string
+	execCommand = func(ctx context.Context, name string, args ...string) *exec.Cmd {
+		argv = append([]string{name}, args...)
+		return exec.CommandContext(ctx, "true")
+	}
+	defer func() { execCommand = exec.CommandContext }()
+
+	if err := Send(context.Background(), &config.NotifyConfig{Desktop: true}, testEvent()); err != nil {
+		t.Fatal(err)
+	}
+	if len(argv) == 0 || !strings.Contains(strings.Join(argv, " "), "dotular apply failed") {
+		t.Errorf("argv = %q", argv)
+	}
+}
+
+func TestAppleString(t *testing.T) {
+	if got := appleString(`say "hi" \ bye`); got != `"say \"hi\" \\ bye"` {
+		t.Errorf("appleString = %s", got)
+	}
+}
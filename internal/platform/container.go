@@ -0,0 +1,23 @@
+package platform
+
+import "os"
+
+// containerMarkers are files a container runtime creates in the root of
+// the containers it runs.
+var containerMarkers = []string{"/.dockerenv", "/run/.containerenv"}
+
+// InContainer reports whether dotular runs inside a dev container, a
+// GitHub Codespace, or another Docker or Podman container.
+func InContainer() bool {
+	for _, env := range []string{"CODESPACES", "REMOTE_CONTAINERS", "DEVCONTAINER"} {
+		if v := os.Getenv(env); v != "" && v != "false" && v != "0" {
+			return true
+		}
+	}
+	for _, marker := range containerMarkers {
+		if _, err := os.Stat(marker); err == nil {
+			return true
+		}
+	}
+	return false
+}
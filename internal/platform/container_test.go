@@ -0,0 +1,10 @@
+package platform
+
+import "testing"
+
+func TestInContainerCodespaces(t *testing.T) {
+	t.Setenv("CODESPACES", "true")
+	if !InContainer() {
+		t.Error("expected a Codespace to count as a container")
+	}
+}
@@ -3,6 +3,7 @@ package platform
 import (
 	"os"
 	"path/filepath"
+	"regexp"
 	"runtime"
 	"strings"
 )
@@ -13,7 +14,11 @@ func Current() string {
 }
 
 // ExpandPath expands a leading "~/" and environment variables in path.
+// Variables may be written $VAR, ${VAR}, or Windows-style %VAR%; unset XDG
+// base directory variables fall back to their spec defaults (for example
+// $XDG_CONFIG_HOME to ~/.config).
 func ExpandPath(path string) string {
+	path = expandPercentVars(path)
 	if path == "~" {
 		if home, err := os.UserHomeDir(); err == nil {
 			return home
@@ -24,7 +29,41 @@ func ExpandPath(path string) string {
 			path = filepath.Join(home, path[2:])
 		}
 	}
-	return os.ExpandEnv(path)
+	return os.Expand(path, Getenv)
+}
+
+// xdgDefaults are the home-relative defaults of the XDG base directories.
+var xdgDefaults = map[string]string{
+	"XDG_CONFIG_HOME": ".config",
+	"XDG_DATA_HOME":   filepath.Join(".local", "share"),
+	"XDG_STATE_HOME":  filepath.Join(".local", "state"),
+	"XDG_CACHE_HOME":  ".cache",
+}
+
+// Getenv is os.Getenv with XDG base directory defaults applied.
+func Getenv(name string) string {
+	if v := os.Getenv(name); v != "" {
+		return v
+	}
+	if rel, ok := xdgDefaults[name]; ok {
+		if home, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(home, rel)
+		}
+	}
+	return ""
+}
+
+var percentVar = regexp.MustCompile(`%([A-Za-z_][A-Za-z0-9_]*)%`)
+
+// expandPercentVars replaces %VAR% with its value, leaving unset variables
+// untouched.
+func expandPercentVars(path string) string {
+	return percentVar.ReplaceAllStringFunc(path, func(m string) string {
+		if v := Getenv(m[1 : len(m)-1]); v != "" {
+			return v
+		}
+		return m
+	})
 }
 
 // PackageManagerOS maps a package manager name to the OS it runs on.
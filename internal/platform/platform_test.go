@@ -83,3 +83,28 @@ func TestPackageManagerOS(t *testing.T) {
 		})
 	}
 }
+
+func TestExpandPathPercentVar(t *testing.T) {
+	t.Setenv("DOTULAR_TEST_VAR", "/custom/path")
+	if got := ExpandPath("%DOTULAR_TEST_VAR%/sub"); got != "/custom/path/sub" {
+		t.Errorf("ExpandPath(%%DOTULAR_TEST_VAR%%/sub) = %q", got)
+	}
+	if got := ExpandPath("%DOTULAR_UNSET_VAR%/sub"); got != "%DOTULAR_UNSET_VAR%/sub" {
+		t.Errorf("unset %%VAR%% should be left alone, got %q", got)
+	}
+}
+
+func TestExpandPathXDGDefault(t *testing.T) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		t.Skip("cannot determine home dir")
+	}
+	t.Setenv("XDG_CONFIG_HOME", "")
+	if got, want := ExpandPath("$XDG_CONFIG_HOME/nvim"), filepath.Join(home, ".config", "nvim"); got != want {
+		t.Errorf("ExpandPath($XDG_CONFIG_HOME/nvim) = %q, want %q", got, want)
+	}
+	t.Setenv("XDG_CONFIG_HOME", "/xdg")
+	if got := ExpandPath("$XDG_CONFIG_HOME/nvim"); got != "/xdg/nvim" {
+		t.Errorf("ExpandPath with XDG_CONFIG_HOME set = %q", got)
+	}
+}
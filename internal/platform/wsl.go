@@ -0,0 +1,140 @@
+package platform
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+)
+
+// InWSL reports whether dotular runs under the Windows Subsystem for Linux.
+func InWSL() bool {
+	if os.Getenv("WSL_DISTRO_NAME") != "" {
+		return true
+	}
+	data, err := os.ReadFile("/proc/sys/kernel/osrelease")
+	return err == nil && strings.Contains(strings.ToLower(string(data)), "microsoft")
+}
+
+// Commands that cross the WSL boundary; replaced in tests.
+var (
+	// windowsEnv returns a Windows environment variable from inside WSL.
+	windowsEnv = func(name string) (string, error) {
+		cmd := exec.Command("cmd.exe", "/d", "/c", "echo %"+name+"%")
+		// cmd.exe warns about UNC working directories such as \\wsl$\...
+		if _, err := os.Stat("/mnt/c"); err == nil {
+			cmd.Dir = "/mnt/c"
+		}
+		out, err := cmd.Output()
+		return strings.TrimSpace(string(out)), err
+	}
+	// wslpath converts a Windows path to its WSL mount, e.g.
+	// C:\Users\me to /mnt/c/Users/me.
+	wslpath = func(winPath string) (string, error) {
+		out, err := exec.Command("wslpath", "-u", winPath).Output()
+		return strings.TrimSpace(string(out)), err
+	}
+	// wslRoots returns, from Windows, the UNC paths of the default WSL
+	// distribution's home directory and root, e.g.
+	// \\wsl.localhost\Ubuntu\home\me and \\wsl.localhost\Ubuntu\.
+	wslRoots = func() (home, root string, err error) {
+		out, err := exec.Command("wsl.exe", "-e", "sh", "-c", `wslpath -w "$HOME"; wslpath -w /`).Output()
+		if err != nil {
+			return "", "", err
+		}
+		lines := strings.Fields(strings.ReplaceAll(string(out), "\x00", ""))
+		if len(lines) != 2 {
+			return "", "", fmt.Errorf("unexpected wslpath output %q", out)
+		}
+		return lines[0], lines[1], nil
+	}
+)
+
+var (
+	windowsEnvMu    sync.Mutex
+	windowsEnvCache = map[string]string{}
+
+	wslRootsMu         sync.Mutex
+	wslHome, wslRootFS string
+)
+
+// cachedWSLRoots is wslRoots, starting WSL once.
+func cachedWSLRoots() (home, root string, err error) {
+	wslRootsMu.Lock()
+	defer wslRootsMu.Unlock()
+	if wslHome == "" {
+		if wslHome, wslRootFS, err = wslRoots(); err != nil {
+			wslHome = ""
+			return "", "", err
+		}
+	}
+	return wslHome, wslRootFS, nil
+}
+
+// cachedWindowsEnv is windowsEnv, running cmd.exe once per variable.
+func cachedWindowsEnv(name string) (string, error) {
+	windowsEnvMu.Lock()
+	defer windowsEnvMu.Unlock()
+	if v, ok := windowsEnvCache[name]; ok {
+		return v, nil
+	}
+	v, err := windowsEnv(name)
+	if err != nil {
+		return "", fmt.Errorf("read Windows variable %s: %w", name, err)
+	}
+	if v == "" || v == "%"+name+"%" {
+		return "", fmt.Errorf("Windows variable %s is not set", name)
+	}
+	windowsEnvCache[name] = v
+	return v, nil
+}
+
+// WindowsHostPath converts a Windows-side destination, as written in the
+// config, to its path from inside WSL. "~" is the Windows user profile, and
+// %VAR% and $VAR are Windows environment variables, so
+// "~/AppData/Local/x" becomes "/mnt/c/Users/me/AppData/Local/x".
+func WindowsHostPath(path string) (string, error) {
+	if path == "~" || strings.HasPrefix(path, "~/") || strings.HasPrefix(path, `~\`) {
+		path = "%USERPROFILE%" + path[1:]
+	}
+	var expandErr error
+	expand := func(name string) string {
+		v, err := cachedWindowsEnv(name)
+		if err != nil && expandErr == nil {
+			expandErr = err
+		}
+		return v
+	}
+	path = percentVar.ReplaceAllStringFunc(path, func(m string) string { return expand(m[1 : len(m)-1]) })
+	path = os.Expand(path, expand)
+	if expandErr != nil {
+		return "", expandErr
+	}
+	out, err := wslpath(strings.ReplaceAll(path, "/", `\`))
+	if err != nil {
+		return "", fmt.Errorf("wslpath %s: %w", path, err)
+	}
+	return out, nil
+}
+
+// WSLPath converts a destination inside the default WSL distribution, as
+// written in the config, to its UNC path from Windows. "~" is the Linux
+// home directory, so "~/.bashrc" becomes
+// \\wsl.localhost\Ubuntu\home\me\.bashrc.
+func WSLPath(path string) (string, error) {
+	home, root, err := cachedWSLRoots()
+	if err != nil {
+		return "", fmt.Errorf("locate WSL distribution: %w", err)
+	}
+	base, rest := root, strings.TrimPrefix(path, "/")
+	switch {
+	case path == "~":
+		return home, nil
+	case strings.HasPrefix(path, "~/"):
+		base, rest = home, path[2:]
+	case !strings.HasPrefix(path, "/"):
+		return "", fmt.Errorf("WSL path %q must be absolute or start with ~/", path)
+	}
+	return strings.TrimSuffix(base, `\`) + `\` + strings.ReplaceAll(rest, "/", `\`), nil
+}
@@ -0,0 +1,77 @@
+package platform
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// fakeWSL replaces the commands that cross the WSL boundary for a test.
+func fakeWSL(t *testing.T, env map[string]string) {
+	oldEnv, oldPath, oldRoots := windowsEnv, wslpath, wslRoots
+	t.Cleanup(func() {
+		windowsEnv, wslpath, wslRoots = oldEnv, oldPath, oldRoots
+		windowsEnvCache = map[string]string{}
+		wslHome, wslRootFS = "", ""
+	})
+	windowsEnvCache = map[string]string{}
+	wslHome, wslRootFS = "", ""
+	windowsEnv = func(name string) (string, error) {
+		if v, ok := env[name]; ok {
+			return v, nil
+		}
+		return "%" + name + "%", nil // what cmd.exe echoes for an unset variable
+	}
+	wslpath = func(winPath string) (string, error) {
+		drive, rest, ok := strings.Cut(winPath, `:\`)
+		if !ok {
+			return "", errors.New("not a Windows path")
+		}
+		return "/mnt/" + strings.ToLower(drive) + "/" + strings.ReplaceAll(rest, `\`, "/"), nil
+	}
+	wslRoots = func() (string, string, error) {
+		return `\\wsl.localhost\Ubuntu\home\me`, `\\wsl.localhost\Ubuntu\`, nil
+	}
+}
+
+func TestWindowsHostPath(t *testing.T) {
+	fakeWSL(t, map[string]string{"USERPROFILE": `C:\Users\me`, "APPDATA": `C:\Users\me\AppData\Roaming`})
+	tests := map[string]string{
+		"~/AppData/Local/Packages/x/settings.json": "/mnt/c/Users/me/AppData/Local/Packages/x/settings.json",
+		"%APPDATA%/Code/User":                      "/mnt/c/Users/me/AppData/Roaming/Code/User",
+		"$APPDATA/alacritty":                       "/mnt/c/Users/me/AppData/Roaming/alacritty",
+		`D:\tools\bin`:                             "/mnt/d/tools/bin",
+	}
+	for in, want := range tests {
+		if got, err := WindowsHostPath(in); err != nil || got != want {
+			t.Errorf("WindowsHostPath(%q) = %q, %v; want %q", in, got, err, want)
+		}
+	}
+	if _, err := WindowsHostPath("%NOPE%/x"); err == nil || !strings.Contains(err.Error(), "NOPE is not set") {
+		t.Errorf("unset variable: err = %v", err)
+	}
+}
+
+func TestWSLPath(t *testing.T) {
+	fakeWSL(t, nil)
+	tests := map[string]string{
+		"~":             `\\wsl.localhost\Ubuntu\home\me`,
+		"~/.bashrc":     `\\wsl.localhost\Ubuntu\home\me\.bashrc`,
+		"/etc/wsl.conf": `\\wsl.localhost\Ubuntu\etc\wsl.conf`,
+	}
+	for in, want := range tests {
+		if got, err := WSLPath(in); err != nil || got != want {
+			t.Errorf("WSLPath(%q) = %q, %v; want %q", in, got, err, want)
+		}
+	}
+	if _, err := WSLPath(".bashrc"); err == nil {
+		t.Error("expected an error for a relative path")
+	}
+}
+
+func TestInWSLEnv(t *testing.T) {
+	t.Setenv("WSL_DISTRO_NAME", "Ubuntu")
+	if !InWSL() {
+		t.Error("WSL_DISTRO_NAME should mark WSL")
+	}
+}
@@ -7,12 +7,14 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 	"time"
 
 	"gopkg.in/yaml.v3"
 
 	"github.com/atomikpanda/dotular/internal/config"
+	"github.com/atomikpanda/dotular/internal/errs"
 	"github.com/atomikpanda/dotular/internal/ui"
 )
 
@@ -22,6 +24,17 @@ import (
 // If the module is already in the lockfile, the cached copy's checksum is
 // verified against the recorded value; a mismatch is a fatal error.
 func Fetch(ctx context.Context, rawRef string, lock *LockFile, noCache bool, u *ui.UI) (*RemoteModule, TrustLevel, error) {
+	data, trust, err := FetchRaw(ctx, rawRef, lock, noCache, u)
+	if err != nil {
+		return nil, trust, err
+	}
+	mod, _, err := parseModule(data)
+	return mod, trust, err
+}
+
+// FetchRaw is like Fetch but returns the module's raw YAML bytes instead of
+// the parsed definition. The same cache and lockfile rules apply.
+func FetchRaw(ctx context.Context, rawRef string, lock *LockFile, noCache bool, u *ui.UI) ([]byte, TrustLevel, error) {
 	ref := ParseRef(rawRef)
 
 	cachePath := moduleCachePath(rawRef)
@@ -32,12 +45,10 @@ func Fetch(ctx context.Context, rawRef string, lock *LockFile, noCache bool, u *
 		if data, err := os.ReadFile(cachePath); err == nil {
 			sum := fmt.Sprintf("%x", sha256.Sum256(data))
 			if sum != entry.SHA256 {
-				return nil, ref.Trust, fmt.Errorf(
-					"registry: checksum mismatch for %s (expected %s, got %s) — run with --no-cache to re-fetch",
-					rawRef, entry.SHA256, sum,
-				)
+				return nil, ref.Trust, fmt.Errorf("registry: %w — run with --no-cache to re-fetch",
+					&errs.ChecksumError{Subject: rawRef, Want: entry.SHA256, Got: sum})
 			}
-			return parseModule(data)
+			return data, ref.Trust, nil
 		}
 		// Cache file missing despite lockfile entry — re-fetch below.
 	}
@@ -52,10 +63,8 @@ func Fetch(ctx context.Context, rawRef string, lock *LockFile, noCache bool, u *
 	// explicitly re-fetching so that updated modules are accepted.
 	sum := fmt.Sprintf("%x", sha256.Sum256(data))
 	if !noCache && inLock && entry.SHA256 != sum {
-		return nil, ref.Trust, fmt.Errorf(
-			"registry: checksum mismatch for %s after re-fetch (lockfile: %s, got: %s)",
-			rawRef, entry.SHA256, sum,
-		)
+		return nil, ref.Trust, fmt.Errorf("registry: %w after re-fetch",
+			&errs.ChecksumError{Subject: rawRef, Want: entry.SHA256, Got: sum})
 	}
 
 	// Update lockfile + write cache.
@@ -63,29 +72,31 @@ func Fetch(ctx context.Context, rawRef string, lock *LockFile, noCache bool, u *
 		SHA256:    sum,
 		FetchedAt: time.Now().UTC(),
 		URL:       ref.FetchURL,
+		Accepted:  entry.Accepted,
 	}
 	if err := writeCacheFile(cachePath, data); err != nil {
 		// Non-fatal: we have the data in memory.
 		u.Warn(fmt.Sprintf("could not cache registry module: %v", err))
 	}
 
-	mod, _, err := parseModule(data)
-	return mod, ref.Trust, err
+	return data, ref.Trust, nil
 }
 
-func download(ctx context.Context, url string) ([]byte, error) {
+// get fetches url with client.
+func get(ctx context.Context, client *http.Client, url string) ([]byte, error) {
 	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
 	if err != nil {
 		return nil, err
 	}
-	req.Header.Set("User-Agent", "dotular/1")
-
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := client.Do(req)
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, fmt.Errorf("%w: HTTP 404 from %s", errs.ErrModuleNotFound, url)
+	}
 	if resp.StatusCode != http.StatusOK {
 		return nil, fmt.Errorf("HTTP %d from %s", resp.StatusCode, url)
 	}
@@ -156,6 +167,27 @@ func UnusedCacheEntries(lock *LockFile, activeRefs map[string]bool) []string {
 	return unused
 }
 
+// Prune removes the cache file and lockfile entry for every ref in lock that is
+// not in activeRefs, returning the pruned refs in sorted order. When dryRun is
+// true nothing is removed; the refs that would be pruned are still returned.
+// When a cache file cannot be removed, the refs pruned before it are
+// returned with the error; their entries are gone from lock either way.
+// The caller is responsible for saving the lockfile, including on error.
+func Prune(lock *LockFile, activeRefs map[string]bool, dryRun bool) ([]string, error) {
+	unused := UnusedCacheEntries(lock, activeRefs)
+	sort.Strings(unused)
+	if dryRun {
+		return unused, nil
+	}
+	for i, ref := range unused {
+		if err := os.Remove(moduleCachePath(ref)); err != nil && !os.IsNotExist(err) {
+			return unused[:i], fmt.Errorf("remove cache for %s: %w", ref, err)
+		}
+		delete(lock.Registry, ref)
+	}
+	return unused, nil
+}
+
 // collectActiveRefs walks a config and returns the set of registry refs used.
 func CollectActiveRefs(cfg config.Config) map[string]bool {
 	refs := make(map[string]bool)
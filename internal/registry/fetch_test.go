@@ -133,3 +133,84 @@ func TestUnusedCacheEntries(t *testing.T) {
 		t.Errorf("unused = %q", unused[0])
 	}
 }
+
+func TestPrune(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	lock := &LockFile{Registry: map[string]LockEntry{}}
+	seedCache(t, lock, "keep", []byte("name: keep\n"))
+	seedCache(t, lock, "drop-b", []byte("name: b\n"))
+	seedCache(t, lock, "drop-a", []byte("name: a\n"))
+	active := map[string]bool{"keep": true}
+
+	// Dry run reports but does not remove anything.
+	pruned, err := Prune(lock, active, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pruned) != 2 || pruned[0] != "drop-a" || pruned[1] != "drop-b" {
+		t.Fatalf("pruned = %v", pruned)
+	}
+	if len(lock.Registry) != 3 {
+		t.Errorf("dry run should not modify lock, got %d entries", len(lock.Registry))
+	}
+	if _, err := os.Stat(moduleCachePath("drop-a")); err != nil {
+		t.Error("dry run should not remove cache files")
+	}
+
+	pruned, err = Prune(lock, active, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pruned) != 2 {
+		t.Fatalf("pruned = %v", pruned)
+	}
+	if _, ok := lock.Registry["keep"]; !ok || len(lock.Registry) != 1 {
+		t.Errorf("lock = %v", lock.Registry)
+	}
+	if _, err := os.Stat(moduleCachePath("drop-a")); !os.IsNotExist(err) {
+		t.Error("expected cache file to be removed")
+	}
+	if _, err := os.Stat(moduleCachePath("keep")); err != nil {
+		t.Error("active cache file should be kept")
+	}
+}
+
+func TestPrunePartialFailure(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	lock := &LockFile{Registry: map[string]LockEntry{}}
+	seedCache(t, lock, "drop-a", []byte("name: a\n"))
+	seedCache(t, lock, "drop-c", []byte("name: c\n"))
+	lock.Registry["drop-b"] = LockEntry{}
+	// A non-empty directory where drop-b's cache file should be cannot be
+	// removed.
+	os.MkdirAll(filepath.Join(moduleCachePath("drop-b"), "x"), 0o755)
+
+	pruned, err := Prune(lock, nil, false)
+	if err == nil {
+		t.Fatal("expected an error removing drop-b")
+	}
+	if len(pruned) != 1 || pruned[0] != "drop-a" {
+		t.Errorf("pruned = %v, want [drop-a]", pruned)
+	}
+	if _, ok := lock.Registry["drop-a"]; ok {
+		t.Error("drop-a was pruned and should be gone from the lock")
+	}
+	if _, ok := lock.Registry["drop-b"]; !ok {
+		t.Error("drop-b failed and should stay in the lock")
+	}
+	if _, ok := lock.Registry["drop-c"]; !ok {
+		t.Error("drop-c was never reached and should stay in the lock")
+	}
+}
+
+func TestPruneMissingCacheFile(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	lock := &LockFile{Registry: map[string]LockEntry{"gone": {}}}
+	pruned, err := Prune(lock, nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pruned) != 1 || len(lock.Registry) != 0 {
+		t.Errorf("pruned = %v, lock = %v", pruned, lock.Registry)
+	}
+}
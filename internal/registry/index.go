@@ -20,8 +20,7 @@ type indexFile struct {
 
 // IndexURL returns the URL to the official registry index.
 func IndexURL() string {
-	return "https://raw.githubusercontent.com/" +
-		"atomikpanda/dotular/main/modules/index.yaml"
+	return officialPrefix + "/main/modules/index.yaml"
 }
 
 // ParseIndex parses raw YAML bytes into a list of index entries.
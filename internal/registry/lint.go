@@ -0,0 +1,129 @@
+package registry
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/atomikpanda/dotular/internal/config"
+	tmpl "github.com/atomikpanda/dotular/internal/template"
+)
+
+// Lint checks a module definition before it is published: fields must be
+// known, every param definition and default must be valid, the items must
+// use exactly the declared params, and the items rendered with the defaults
+// must pass the same validation as a config module. It returns the parsed
+// module, or nil when it does not parse, and every problem found.
+func Lint(data []byte) (*RemoteModule, []error) {
+	var mod RemoteModule
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(&mod); err != nil {
+		return nil, []error{fmt.Errorf("parse module: %w", err)}
+	}
+
+	var problems []error
+	if mod.Name == "" {
+		problems = append(problems, errors.New("missing name"))
+	}
+	if len(mod.Items) == 0 {
+		problems = append(problems, errors.New("no items"))
+	}
+
+	names := make([]string, 0, len(mod.Params))
+	for name := range mod.Params {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		def := mod.Params[name]
+		if def.Default == nil {
+			if err := checkParamType(def, placeholder(name, def)); err != nil {
+				problems = append(problems, fmt.Errorf("param %q: %w", name, err))
+			}
+			continue
+		}
+		if def.Required {
+			problems = append(problems, fmt.Errorf("param %q: required params cannot have a default", name))
+		}
+		if err := checkParamType(def, def.Default); err != nil {
+			problems = append(problems, fmt.Errorf("param %q: default %w", name, err))
+		}
+	}
+
+	var registered, used []string
+	for _, item := range mod.Items {
+		if item.Register != "" {
+			registered = append(registered, item.Register)
+		}
+	}
+	for i, item := range mod.Items {
+		fields, err := tmpl.Fields(item)
+		if err != nil {
+			problems = append(problems, fmt.Errorf("item %d: %w", i+1, err))
+			continue
+		}
+		for _, f := range fields {
+			if _, ok := mod.Params[f]; ok {
+				used = append(used, f)
+			} else if !slices.Contains(registered, f) {
+				problems = append(problems, fmt.Errorf("item %d: {{ .%s }} is not a declared param", i+1, f))
+			}
+		}
+	}
+	for _, name := range names {
+		if !slices.Contains(used, name) {
+			problems = append(problems, fmt.Errorf("param %q is not used by any item", name))
+		}
+	}
+
+	items, err := mod.Render(nil)
+	if err != nil {
+		return &mod, append(problems, err)
+	}
+	cfg := config.Config{Modules: []config.Module{{Name: mod.Name, Items: items}}}
+	if mod.Name == "" {
+		cfg.Modules[0].Name = "module"
+	}
+	if err := cfg.Validate(); err != nil {
+		problems = append(problems, err)
+	}
+	return &mod, problems
+}
+
+// Render renders the module's items with the params in with over their
+// defaults, the way Resolve does. Required params missing from with get a
+// placeholder of their type, so a module can be checked without them.
+func (m *RemoteModule) Render(with map[string]any) ([]config.Item, error) {
+	params := resolveParams(m.Params, with)
+	for name, def := range m.Params {
+		if _, ok := params[name]; !ok && def.Required {
+			params[name] = placeholder(name, def)
+		}
+	}
+	if err := validateParams(m.Params, params); err != nil {
+		return nil, err
+	}
+	items, err := renderModuleItems(m.Name, m.Items, withRegistered(params, m.Items))
+	if err != nil {
+		return nil, fmt.Errorf("render %w", err)
+	}
+	return items, nil
+}
+
+// placeholder returns a value of def's type to stand in for the param name.
+func placeholder(name string, def Param) any {
+	switch {
+	case len(def.Enum) > 0:
+		return def.Enum[0]
+	case def.Type == "int":
+		return 0
+	case def.Type == "bool":
+		return false
+	}
+	return "<" + name + ">"
+}
@@ -0,0 +1,88 @@
+package registry
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLint(t *testing.T) {
+	good := `
+name: tool
+version: "1.0.0"
+params:
+  version:
+    type: string
+    default: "0.10.2"
+  channel:
+    type: enum
+    enum: [stable, nightly]
+    required: true
+items:
+  - run: install {{ .version }} {{ .channel }}
+    register: out
+  - run: echo {{ .out }}
+`
+	mod, problems := Lint([]byte(good))
+	if len(problems) > 0 {
+		t.Fatalf("problems = %v", problems)
+	}
+	if mod.Name != "tool" {
+		t.Errorf("Name = %q", mod.Name)
+	}
+
+	tests := []struct {
+		name, module, want string
+	}{
+		{"unknown field", "name: x\nitems:\n  - run: true\n    colour: red\n", "field colour not found"},
+		{"missing name", "items:\n  - run: true\n", "missing name"},
+		{"no items", "name: x\n", "no items"},
+		{"undeclared param", "name: x\nitems:\n  - run: echo {{ .v }}\n", "{{ .v }} is not a declared param"},
+		{"unused param", "name: x\nparams:\n  v: {}\nitems:\n  - run: true\n", `param "v" is not used`},
+		{"bad default", "name: x\nparams:\n  n:\n    type: int\n    default: many\nitems:\n  - run: echo {{ .n }}\n", `param "n": default must be an int`},
+		{"enum without values", "name: x\nparams:\n  c:\n    type: enum\nitems:\n  - run: echo {{ .c }}\n", "requires an enum"},
+		{"required with default", "name: x\nparams:\n  v:\n    required: true\n    default: a\nitems:\n  - run: echo {{ .v }}\n", "cannot have a default"},
+		{"invalid rendered item", "name: x\nparams:\n  d:\n    default: both\nitems:\n  - file: a\n    direction: '{{ .d }}'\n", `invalid direction "both"`},
+		{"bad template", "name: x\nitems:\n  - run: echo {{ .v\n", "item 1"},
+	}
+	for _, tt := range tests {
+		_, problems := Lint([]byte(tt.module))
+		var msgs []string
+		for _, p := range problems {
+			msgs = append(msgs, p.Error())
+		}
+		if got := strings.Join(msgs, "; "); !strings.Contains(got, tt.want) {
+			t.Errorf("%s: problems = %q, want one mentioning %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestRemoteModuleRender(t *testing.T) {
+	mod, problems := Lint([]byte(`
+name: tool
+params:
+  version: {default: "1.0"}
+  channel: {required: true, enum: [stable, nightly]}
+items:
+  - run: install {{ .version }} {{ .channel }}
+`))
+	if len(problems) > 0 {
+		t.Fatal(problems)
+	}
+	items, err := mod.Render(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if items[0].Run != "install 1.0 stable" {
+		t.Errorf("with placeholders: Run = %q", items[0].Run)
+	}
+	items, err = mod.Render(map[string]any{"version": "2.0", "channel": "nightly"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if items[0].Run != "install 2.0 nightly" {
+		t.Errorf("with params: Run = %q", items[0].Run)
+	}
+	if _, err := mod.Render(map[string]any{"channel": "beta"}); err == nil {
+		t.Error("expected an error for a value outside the enum")
+	}
+}
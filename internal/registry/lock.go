@@ -1,25 +1,54 @@
 package registry
 
 import (
+	"bytes"
+	"context"
+	"crypto/sha256"
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
 	"time"
 
 	"gopkg.in/yaml.v3"
+
+	"github.com/atomikpanda/dotular/internal/ageutil"
 )
 
 // LockFile records the SHA-256 checksums of every fetched registry module.
 // It lives alongside dotular.yaml and should be committed to the repo.
 type LockFile struct {
 	Registry map[string]LockEntry `yaml:"registry,omitempty"`
+	// Downloads records, by URL, the checksums `dotular update` saw for
+	// content the config does not pin itself: remote scripts without a
+	// sha256 and binaries at version latest. They are never encrypted.
+	Downloads map[string]LockEntry `yaml:"downloads,omitempty"`
+	// Encrypted holds the registry entries sealed with the age key when the
+	// config sets lock.encrypt. LoadLock opens them into Registry.
+	Encrypted string `yaml:"encrypted,omitempty"`
+
+	opened []byte // what Encrypted opened to, so an unchanged lock keeps its ciphertext
+}
+
+var (
+	lockEncrypt bool
+	lockKey     *ageutil.Key
+)
+
+// ConfigureLock sets whether SaveLock seals the registry entries and the age
+// key that seals and opens them. Call it once the config is loaded.
+func ConfigureLock(encrypt bool, key *ageutil.Key) {
+	lockEncrypt, lockKey = encrypt, key
 }
 
 // LockEntry records a single cached module's checksum and fetch time.
+// Accepted is the checksum of the content last accepted after review; a
+// community module is reviewed again when it no longer equals SHA256.
 type LockEntry struct {
 	SHA256    string    `yaml:"sha256"`
 	FetchedAt time.Time `yaml:"fetched_at"`
 	URL       string    `yaml:"url"`
+	Accepted  string    `yaml:"accepted,omitempty"`
 }
 
 // LockPath returns the lockfile path derived from the config file path.
@@ -32,7 +61,7 @@ func LockPath(configPath string) string {
 func LoadLock(path string) (*LockFile, error) {
 	data, err := os.ReadFile(path)
 	if os.IsNotExist(err) {
-		return &LockFile{Registry: make(map[string]LockEntry)}, nil
+		return &LockFile{Registry: make(map[string]LockEntry), Downloads: make(map[string]LockEntry)}, nil
 	}
 	if err != nil {
 		return nil, fmt.Errorf("read lockfile: %w", err)
@@ -44,12 +73,52 @@ func LoadLock(path string) (*LockFile, error) {
 	if lf.Registry == nil {
 		lf.Registry = make(map[string]LockEntry)
 	}
+	if lf.Downloads == nil {
+		lf.Downloads = make(map[string]LockEntry)
+	}
+	if lf.Encrypted != "" {
+		if lockKey == nil {
+			return nil, fmt.Errorf("lockfile has encrypted entries; configure an age key (age.identity, age.passphrase, or age.passphrase_command) to read them")
+		}
+		plain, err := lockKey.Open(lf.Encrypted)
+		if err != nil {
+			return nil, fmt.Errorf("open encrypted lockfile entries: %w", err)
+		}
+		var sealed map[string]LockEntry
+		if err := yaml.Unmarshal(plain, &sealed); err != nil {
+			return nil, fmt.Errorf("parse encrypted lockfile entries: %w", err)
+		}
+		for ref, entry := range sealed {
+			lf.Registry[ref] = entry
+		}
+		lf.opened = plain
+	}
 	return &lf, nil
 }
 
-// SaveLock writes the lockfile atomically.
+// SaveLock writes the lockfile atomically. With lock encryption configured
+// the entries are sealed; an unchanged lock keeps its ciphertext so that
+// re-saving it does not show up as a change.
 func SaveLock(path string, lf *LockFile) error {
-	data, err := yaml.Marshal(lf)
+	out := &LockFile{Registry: lf.Registry, Downloads: lf.Downloads}
+	if lockEncrypt {
+		if lockKey == nil {
+			return fmt.Errorf("lock.encrypt needs an age key (age.identity, age.passphrase, or age.passphrase_command)")
+		}
+		plain, err := yaml.Marshal(lf.Registry)
+		if err != nil {
+			return err
+		}
+		if lf.Encrypted == "" || !bytes.Equal(plain, lf.opened) {
+			sealed, err := lockKey.Seal(plain)
+			if err != nil {
+				return fmt.Errorf("encrypt lockfile entries: %w", err)
+			}
+			lf.Encrypted, lf.opened = sealed, plain
+		}
+		out = &LockFile{Encrypted: lf.Encrypted, Downloads: lf.Downloads}
+	}
+	data, err := yaml.Marshal(out)
 	if err != nil {
 		return err
 	}
@@ -59,3 +128,49 @@ func SaveLock(path string, lf *LockFile) error {
 	}
 	return os.Rename(tmp, path)
 }
+
+// VerifyResult reports whether a locked ref still matches its recorded checksum.
+type VerifyResult struct {
+	Ref      string
+	Expected string
+	Actual   string
+	Source   string // "cache" | "network"
+	Err      error
+}
+
+// OK reports whether the ref was read successfully and its checksum matches.
+func (v VerifyResult) OK() bool {
+	return v.Err == nil && v.Actual == v.Expected
+}
+
+// VerifyLock checks every entry in lock against its recorded SHA-256. Cached
+// copies are used when present; missing cache files are re-downloaded. When
+// remote is true every ref is re-downloaded regardless of the cache. Nothing
+// is written — neither the cache nor the lockfile is modified.
+func VerifyLock(ctx context.Context, lock *LockFile, remote bool) []VerifyResult {
+	refs := CachedRefs(lock)
+	sort.Strings(refs)
+
+	results := make([]VerifyResult, 0, len(refs))
+	for _, ref := range refs {
+		entry := lock.Registry[ref]
+		res := VerifyResult{Ref: ref, Expected: entry.SHA256, Source: "cache"}
+
+		data, err := os.ReadFile(moduleCachePath(ref))
+		if remote || err != nil {
+			url := entry.URL
+			if url == "" {
+				url = ParseRef(ref).FetchURL
+			}
+			res.Source = "network"
+			data, err = download(ctx, url)
+		}
+		if err != nil {
+			res.Err = err
+		} else {
+			res.Actual = fmt.Sprintf("%x", sha256.Sum256(data))
+		}
+		results = append(results, res)
+	}
+	return results
+}
@@ -1,10 +1,18 @@
 package registry
 
 import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 	"time"
+
+	"github.com/atomikpanda/dotular/internal/ageutil"
+	"github.com/atomikpanda/dotular/internal/errs"
 )
 
 func TestLockPath(t *testing.T) {
@@ -87,3 +95,132 @@ func TestLoadLockNilRegistry(t *testing.T) {
 		t.Error("expected initialized Registry map even from empty YAML")
 	}
 }
+
+func TestVerifyLockCache(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	lock := &LockFile{Registry: map[string]LockEntry{}}
+	seedCache(t, lock, "good", []byte("name: good\n"))
+	seedCache(t, lock, "tampered", []byte("name: tampered\n"))
+	writeCacheFile(moduleCachePath("tampered"), []byte("name: evil\n"))
+
+	results := VerifyLock(context.Background(), lock, false)
+	if len(results) != 2 {
+		t.Fatalf("expected 2 results, got %d", len(results))
+	}
+	if results[0].Ref != "good" || !results[0].OK() || results[0].Source != "cache" {
+		t.Errorf("good = %+v", results[0])
+	}
+	if results[1].Ref != "tampered" || results[1].OK() {
+		t.Errorf("tampered = %+v", results[1])
+	}
+}
+
+func TestVerifyLockRemote(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("name: remote\n"))
+	}))
+	defer srv.Close()
+
+	lock := &LockFile{Registry: map[string]LockEntry{}}
+	seedCache(t, lock, "mod", []byte("name: remote\n"))
+	entry := lock.Registry["mod"]
+	entry.URL = srv.URL
+	lock.Registry["mod"] = entry
+
+	results := VerifyLock(context.Background(), lock, true)
+	if len(results) != 1 || !results[0].OK() || results[0].Source != "network" {
+		t.Errorf("results = %+v", results)
+	}
+}
+
+func TestVerifyLockDownloadError(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer srv.Close()
+
+	lock := &LockFile{Registry: map[string]LockEntry{
+		"missing": {SHA256: "abc", URL: srv.URL},
+	}}
+	results := VerifyLock(context.Background(), lock, false)
+	if len(results) != 1 || results[0].Err == nil || results[0].OK() {
+		t.Errorf("results = %+v", results)
+	}
+	if !errors.Is(results[0].Err, errs.ErrModuleNotFound) {
+		t.Errorf("404 error = %v, want ErrModuleNotFound", results[0].Err)
+	}
+}
+
+func TestFetchRawCachedChecksumMismatch(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	ref := "github.com/example/mods/tool@v1"
+	if err := writeCacheFile(moduleCachePath(ref), []byte("name: tampered\n")); err != nil {
+		t.Fatal(err)
+	}
+	lock := &LockFile{Registry: map[string]LockEntry{ref: {SHA256: "0000"}}}
+	_, _, err := FetchRaw(context.Background(), ref, lock, false, nil)
+	var ce *errs.ChecksumError
+	if !errors.As(err, &ce) || ce.Want != "0000" {
+		t.Errorf("err = %v, want a ChecksumError", err)
+	}
+}
+
+func TestEncryptedLock(t *testing.T) {
+	defer ConfigureLock(false, nil)
+	path := filepath.Join(t.TempDir(), "dotular.lock.yaml")
+	ref := "git.internal.example.com/team/mod@v1"
+	lf := &LockFile{Registry: map[string]LockEntry{
+		ref: {SHA256: "abc", URL: "https://token@git.internal.example.com/team/mod.yaml"},
+	}}
+
+	ConfigureLock(true, &ageutil.Key{Passphrase: "lock-pass"})
+	if err := SaveLock(path, lf); err != nil {
+		t.Fatal(err)
+	}
+	first, _ := os.ReadFile(path)
+	if strings.Contains(string(first), "internal.example.com") {
+		t.Errorf("lockfile leaks the private ref:\n%s", first)
+	}
+
+	loaded, err := LoadLock(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Registry[ref].SHA256 != "abc" {
+		t.Fatalf("registry = %+v", loaded.Registry)
+	}
+	if err := SaveLock(path, loaded); err != nil {
+		t.Fatal(err)
+	}
+	if second, _ := os.ReadFile(path); string(second) != string(first) {
+		t.Error("re-saving an unchanged lock should keep its ciphertext")
+	}
+
+	ConfigureLock(false, nil)
+	if _, err := LoadLock(path); err == nil {
+		t.Error("expected error opening encrypted entries without a key")
+	}
+
+	// Turning encryption off writes the entries in the clear again.
+	ConfigureLock(false, &ageutil.Key{Passphrase: "lock-pass"})
+	if loaded, err = LoadLock(path); err != nil {
+		t.Fatal(err)
+	}
+	if err := SaveLock(path, loaded); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(path); !strings.Contains(string(data), ref) || strings.Contains(string(data), "encrypted:") {
+		t.Errorf("plain lockfile:\n%s", data)
+	}
+}
+
+func TestEncryptedLockNeedsKey(t *testing.T) {
+	defer ConfigureLock(false, nil)
+	ConfigureLock(true, nil)
+	path := filepath.Join(t.TempDir(), "dotular.lock.yaml")
+	if err := SaveLock(path, &LockFile{Registry: map[string]LockEntry{}}); err == nil {
+		t.Error("expected error sealing without an age key")
+	}
+}
@@ -0,0 +1,84 @@
+package registry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/atomikpanda/dotular/internal/config"
+	"github.com/atomikpanda/dotular/internal/httpclient"
+)
+
+// officialPrefix is the URL prefix official modules and the index are
+// fetched from, and the default prefix of a mirror.
+const officialPrefix = "https://raw.githubusercontent.com/atomikpanda/dotular"
+
+// mirror is a configured Mirror with the client for its TLS settings.
+type mirror struct {
+	prefix string
+	url    string
+	client *http.Client
+}
+
+var (
+	mirrors     []mirror
+	mirrorsOnly bool
+)
+
+// ConfigureMirrors sets the mirrors registry fetches try. Each mirror's
+// client is built from h, the config's http section, with the mirror's own
+// TLS settings in place of h's and the mirror added to h's hosts, so it gets
+// the headers and client certificate. Call it once the config is loaded.
+func ConfigureMirrors(c config.RegistryConfig, h config.HTTPConfig) error {
+	var ms []mirror
+	for _, m := range c.Mirrors {
+		hc := h
+		hc.Hosts = append(slices.Clone(h.Hosts), m.URL)
+		if m.CABundle != "" {
+			hc.CABundle = m.CABundle
+		}
+		if m.ClientCert != "" {
+			hc.ClientCert, hc.ClientKey = m.ClientCert, m.ClientKey
+		}
+		client, err := httpclient.New(hc)
+		if err != nil {
+			return fmt.Errorf("registry: mirror %s: %w", m.URL, err)
+		}
+		prefix := m.Prefix
+		if prefix == "" {
+			prefix = officialPrefix
+		}
+		ms = append(ms, mirror{prefix: strings.TrimSuffix(prefix, "/"), url: strings.TrimSuffix(m.URL, "/"), client: client})
+	}
+	mirrors, mirrorsOnly = ms, c.MirrorsOnly
+	return nil
+}
+
+// download fetches url from each mirror whose prefix covers it, in order,
+// and then from url itself unless mirrors_only is set. The first success
+// wins; when every source fails their errors are returned together.
+func download(ctx context.Context, url string) ([]byte, error) {
+	var failed []error
+	for _, m := range mirrors {
+		rest, ok := strings.CutPrefix(url, m.prefix)
+		if !ok || (rest != "" && !strings.HasPrefix(rest, "/")) {
+			continue
+		}
+		data, err := get(ctx, m.client, m.url+rest)
+		if err == nil {
+			return data, nil
+		}
+		failed = append(failed, fmt.Errorf("mirror: %w", err))
+	}
+	if len(failed) > 0 && mirrorsOnly {
+		return nil, errors.Join(failed...)
+	}
+	data, err := get(ctx, httpclient.Client(), url)
+	if err != nil {
+		return nil, errors.Join(append(failed, err)...)
+	}
+	return data, nil
+}
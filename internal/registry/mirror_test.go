@@ -0,0 +1,94 @@
+package registry
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/atomikpanda/dotular/internal/config"
+	"github.com/atomikpanda/dotular/internal/errs"
+)
+
+func TestDownloadMirrors(t *testing.T) {
+	t.Cleanup(func() { ConfigureMirrors(config.RegistryConfig{}, config.HTTPConfig{}) })
+
+	var hits []string
+	serve := func(name string, status int) *httptest.Server {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			hits = append(hits, name+r.URL.Path)
+			w.WriteHeader(status)
+			w.Write([]byte(name))
+		}))
+		t.Cleanup(srv.Close)
+		return srv
+	}
+	down := serve("down", http.StatusBadGateway)
+	mirror := serve("mirror", http.StatusOK)
+	origin := serve("origin", http.StatusOK)
+
+	err := ConfigureMirrors(config.RegistryConfig{Mirrors: []config.Mirror{
+		{Prefix: origin.URL + "/gh", URL: down.URL + "/cache"},
+		{Prefix: origin.URL + "/gh/", URL: mirror.URL + "/cache/"},
+	}}, config.HTTPConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := download(context.Background(), origin.URL+"/gh/user/repo/main/mod.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "mirror" {
+		t.Errorf("data = %q, want it from the second mirror", data)
+	}
+	if want := []string{"down/cache/user/repo/main/mod.yaml", "mirror/cache/user/repo/main/mod.yaml"}; strings.Join(hits, " ") != strings.Join(want, " ") {
+		t.Errorf("hits = %q, want %q", hits, want)
+	}
+
+	// URLs outside every prefix, including ones that only share a string
+	// prefix, go straight to the origin.
+	hits = nil
+	if data, err := download(context.Background(), origin.URL+"/ghost/mod.yaml"); err != nil || string(data) != "origin" {
+		t.Errorf("download = %q, %v; want it from the origin", data, err)
+	}
+	if len(hits) != 1 {
+		t.Errorf("hits = %q, want only the origin", hits)
+	}
+}
+
+func TestDownloadMirrorsOnly(t *testing.T) {
+	t.Cleanup(func() { ConfigureMirrors(config.RegistryConfig{}, config.HTTPConfig{}) })
+	mirror := httptest.NewServer(http.NotFoundHandler())
+	defer mirror.Close()
+	originHit := false
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { originHit = true }))
+	defer origin.Close()
+
+	err := ConfigureMirrors(config.RegistryConfig{MirrorsOnly: true, Mirrors: []config.Mirror{{Prefix: origin.URL, URL: mirror.URL}}}, config.HTTPConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = download(context.Background(), origin.URL+"/mod.yaml")
+	if !errors.Is(err, errs.ErrModuleNotFound) {
+		t.Errorf("err = %v, want the mirror's not found", err)
+	}
+	if originHit {
+		t.Error("mirrors_only must not fall back to the origin")
+	}
+}
+
+func TestConfigureMirrorsDefaultsToOfficial(t *testing.T) {
+	t.Cleanup(func() { ConfigureMirrors(config.RegistryConfig{}, config.HTTPConfig{}) })
+	if err := ConfigureMirrors(config.RegistryConfig{Mirrors: []config.Mirror{{URL: "https://mirror.internal/dotular"}}}, config.HTTPConfig{}); err != nil {
+		t.Fatal(err)
+	}
+	if mirrors[0].prefix != officialPrefix || !strings.HasPrefix(IndexURL(), mirrors[0].prefix+"/") {
+		t.Errorf("prefix = %q, want the official registry covering the index", mirrors[0].prefix)
+	}
+	if err := ConfigureMirrors(config.RegistryConfig{Mirrors: []config.Mirror{{URL: "https://mirror.internal", CABundle: "/nonexistent.pem"}}}, config.HTTPConfig{}); err == nil {
+		t.Error("expected an error for a missing ca_bundle")
+	}
+}
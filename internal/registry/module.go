@@ -1,8 +1,28 @@
 // Package registry fetches, caches, verifies, and resolves remote Dotular
 // module definitions.
+//
+// The CLI wires it up when the config is loaded: ConfigureMirrors,
+// ConfigureLock (sealing lockfile entries with the age key when
+// lock.encrypt is set), ConfigureReview, and ConfigurePrompt.
+//
+// Before fetching a GitHub or external module, communityPolicy applies the
+// config's trust section. Under the prompt policy, Resolve passes the
+// module's Summarize to the reviewer unless its lock entry's Accepted equals
+// its SHA256, and fails with errs.ErrNotAccepted when it is refused.
+//
+// Required params missing from with: are asked for through the prompt, and
+// answers marked Save are written back to the config. Module items render
+// with missingkey=error, so a reference to a param without a value fails
+// with the module, item, and param named; resolveParams leaves such params
+// out and sets optional ones to "". Local-module vars still render with
+// missingkey=zero.
+//
+// Fetches go through download, which tries the mirrors covering the URL in
+// order and then, unless mirrors_only is set, the original host.
 package registry
 
 import (
+	"path/filepath"
 	"strings"
 
 	"github.com/atomikpanda/dotular/internal/config"
@@ -18,6 +38,9 @@ const (
 	GitHub
 	// External modules are from arbitrary URLs.
 	External
+	// Local modules are read from a path relative to dotular.yaml (e.g. a
+	// vendored copy written by `dotular registry vendor`).
+	Local
 )
 
 func (t TrustLevel) String() string {
@@ -26,32 +49,44 @@ func (t TrustLevel) String() string {
 		return "official"
 	case GitHub:
 		return "github"
+	case Local:
+		return "local"
 	default:
 		return "external"
 	}
 }
 
 // Param defines a single parameter accepted by a registry module.
+//
+// Type, when set, is one of "string", "int", "bool", or "enum" and is checked
+// against the resolved value at resolve time. Enum lists the allowed values;
+// it is enforced whenever non-empty, regardless of Type. An Optional param
+// that is neither set nor defaulted renders as the empty string; any other
+// param without a value is an error where an item references it.
 type Param struct {
-	Default     any    `yaml:"default,omitempty"`
-	Description string `yaml:"description,omitempty"`
+	Default     any      `yaml:"default,omitempty"`
+	Description string   `yaml:"description,omitempty"`
+	Type        string   `yaml:"type,omitempty"`
+	Required    bool     `yaml:"required,omitempty"`
+	Optional    bool     `yaml:"optional,omitempty"`
+	Enum        []string `yaml:"enum,omitempty"`
 }
 
 // RemoteModule is the on-disk format for a published registry module.
 type RemoteModule struct {
-	Name    string            `yaml:"name"`
-	Version string            `yaml:"version,omitempty"`
-	Params  map[string]Param  `yaml:"params,omitempty"`
-	Items   []config.Item     `yaml:"items"`
+	Name    string           `yaml:"name"`
+	Version string           `yaml:"version,omitempty"`
+	Params  map[string]Param `yaml:"params,omitempty"`
+	Items   []config.Item    `yaml:"items"`
 }
 
 // Ref holds a parsed registry reference string (e.g. "github.com/atomikpanda/dotular/modules/neovim@main").
 type Ref struct {
-	Raw     string
-	Host    string
-	Path    string
-	Version string
-	Trust   TrustLevel
+	Raw      string
+	Host     string
+	Path     string
+	Version  string
+	Trust    TrustLevel
 	FetchURL string
 }
 
@@ -62,6 +97,9 @@ const DefaultRegistry = "github.com/atomikpanda/dotular"
 // ParseRef parses a registry reference string. Bare names without a host
 // (e.g. "wezterm") are expanded against the DefaultRegistry.
 func ParseRef(raw string) Ref {
+	if IsLocalRef(raw) {
+		return Ref{Raw: raw, Path: raw, Trust: Local}
+	}
 	name, version, _ := strings.Cut(raw, "@")
 	// Shorthand: bare name with no slashes → default registry module.
 	if !strings.Contains(name, "/") {
@@ -91,6 +129,12 @@ func ParseRef(raw string) Ref {
 	}
 }
 
+// IsLocalRef reports whether raw refers to a module file on disk rather than
+// a remote registry. Local refs start with "./", "../" or are absolute paths.
+func IsLocalRef(raw string) bool {
+	return strings.HasPrefix(raw, "./") || strings.HasPrefix(raw, "../") || filepath.IsAbs(raw)
+}
+
 func resolveTrustAndURL(host, path, version string) (TrustLevel, string) {
 	switch host {
 	case "github.com":
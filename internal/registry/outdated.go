@@ -0,0 +1,91 @@
+package registry
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+
+	"github.com/atomikpanda/dotular/internal/version"
+)
+
+// OutdatedResult compares the cached copy of an official registry module
+// with the version the registry index lists for it.
+type OutdatedResult struct {
+	Ref     string
+	Name    string
+	Current string // version of the cached copy; empty when not cached
+	Latest  string // version in the index
+}
+
+// Outdated reports whether the index lists a newer version than the cached
+// copy, or the module is not cached yet.
+func (o OutdatedResult) Outdated() bool {
+	if o.Current == "" {
+		return true
+	}
+	cur, err1 := version.Parse(o.Current)
+	latest, err2 := version.Parse(o.Latest)
+	if err1 != nil || err2 != nil {
+		return o.Current != o.Latest
+	}
+	return latest.Compare(cur) > 0
+}
+
+// Outdated compares each of refs that names an official module in index
+// with its cached copy. Refs the index does not list, such as third-party
+// GitHub modules, are left out; results are sorted by ref.
+func Outdated(refs []string, index []IndexEntry) []OutdatedResult {
+	latest := make(map[string]string, len(index))
+	for _, e := range index {
+		latest[e.Name] = e.Version
+	}
+	var results []OutdatedResult
+	for _, raw := range refs {
+		ref := ParseRef(raw)
+		if ref.Trust != Official {
+			continue
+		}
+		name := path.Base(ref.Path)
+		v, ok := latest[name]
+		if !ok {
+			continue
+		}
+		results = append(results, OutdatedResult{Ref: raw, Name: name, Current: CachedVersion(raw), Latest: v})
+	}
+	sort.Slice(results, func(i, j int) bool { return results[i].Ref < results[j].Ref })
+	return results
+}
+
+// CachedVersion returns the version of the cached copy of a registry
+// module, or "" when it is not cached or declares no version.
+func CachedVersion(rawRef string) string {
+	data, err := os.ReadFile(moduleCachePath(rawRef))
+	if err != nil {
+		return ""
+	}
+	mod, _, err := parseModule(data)
+	if err != nil {
+		return ""
+	}
+	return mod.Version
+}
+
+// FetchLatest downloads the current published copy of a registry module and
+// returns it with the cached copy (nil when not cached). Neither the cache
+// nor the lockfile is changed, so the two can be compared before updating.
+func FetchLatest(ctx context.Context, rawRef string) (cached, latest []byte, err error) {
+	if IsLocalRef(rawRef) {
+		return nil, nil, fmt.Errorf("%s is a local module; edit it in place", rawRef)
+	}
+	latest, err = download(ctx, ParseRef(rawRef).FetchURL)
+	if err != nil {
+		return nil, nil, fmt.Errorf("fetch %s: %w", rawRef, err)
+	}
+	cached, err = os.ReadFile(moduleCachePath(rawRef))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, nil, err
+	}
+	return cached, latest, nil
+}
@@ -0,0 +1,56 @@
+package registry
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestOutdated(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	cached := map[string]string{
+		"github.com/atomikpanda/dotular/modules/git@main":  "name: git\nversion: 1.0.0\nitems: []\n",
+		"github.com/atomikpanda/dotular/modules/htop@main": "name: htop\nversion: 1.2.0\nitems: []\n",
+	}
+	for ref, data := range cached {
+		path := moduleCachePath(ref)
+		os.MkdirAll(filepath.Dir(path), 0o755)
+		if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	index := []IndexEntry{{Name: "git", Version: "1.1.0"}, {Name: "htop", Version: "1.2.0"}, {Name: "zsh", Version: "1.0.0"}}
+	refs := []string{
+		"github.com/atomikpanda/dotular/modules/zsh@main",
+		"github.com/atomikpanda/dotular/modules/git@main",
+		"github.com/atomikpanda/dotular/modules/htop@main",
+		"github.com/user/repo",
+		"./vendor/git.yaml",
+	}
+
+	results := Outdated(refs, index)
+	if len(results) != 3 {
+		t.Fatalf("results = %+v, want the 3 official refs", results)
+	}
+	want := []struct {
+		name, current string
+		outdated      bool
+	}{
+		{"git", "1.0.0", true},
+		{"htop", "1.2.0", false},
+		{"zsh", "", true},
+	}
+	for i, w := range want {
+		res := results[i]
+		if res.Name != w.name || res.Current != w.current || res.Outdated() != w.outdated {
+			t.Errorf("result %d = %+v (outdated %v), want %+v", i, res, res.Outdated(), w)
+		}
+	}
+}
+
+func TestFetchLatestLocalRef(t *testing.T) {
+	if _, _, err := FetchLatest(context.Background(), "./vendor/git.yaml"); err == nil {
+		t.Error("expected an error for a local ref")
+	}
+}
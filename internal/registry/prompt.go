@@ -0,0 +1,82 @@
+package registry
+
+import (
+	"fmt"
+	"sort"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ParamAnswer is a value given for a missing param. Save asks for it to be
+// written into the module's with: in dotular.yaml.
+type ParamAnswer struct {
+	Value string
+	Save  bool
+}
+
+// Prompter asks for the value of a required param that the module using ref
+// does not set. A nil answer leaves the param missing.
+type Prompter func(ref, name string, def Param) (*ParamAnswer, error)
+
+var prompter Prompter
+
+// ConfigurePrompt sets the Prompter Resolve asks for missing required
+// params. Without one a missing param is an error.
+func ConfigurePrompt(p Prompter) {
+	prompter = p
+}
+
+// promptParams asks the configured Prompter for each required param that
+// params lacks, in name order, and fills in the answers. It returns the
+// answers to write back to the module's with:.
+func promptParams(ref string, defs map[string]Param, params map[string]any) (map[string]any, error) {
+	if prompter == nil {
+		return nil, nil
+	}
+	names := make([]string, 0, len(defs))
+	for name, def := range defs {
+		if def.Required && params[name] == nil {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	var save map[string]any
+	for _, name := range names {
+		ans, err := prompter(ref, name, defs[name])
+		if err != nil {
+			return nil, err
+		}
+		if ans == nil {
+			continue
+		}
+		v, err := ParseParam(defs[name], ans.Value)
+		if err != nil {
+			return nil, fmt.Errorf("%s: param %q: %w", ref, name, err)
+		}
+		params[name] = v
+		if ans.Save {
+			if save == nil {
+				save = make(map[string]any)
+			}
+			save[name] = v
+		}
+	}
+	return save, nil
+}
+
+// ParseParam converts s, as typed by the user, to a value of def's type:
+// int and bool params are parsed as YAML scalars and any other param is
+// kept as the string. The value is checked against the definition.
+func ParseParam(def Param, s string) (any, error) {
+	var v any = s
+	if def.Type == "int" || def.Type == "bool" {
+		if err := yaml.Unmarshal([]byte(s), &v); err != nil {
+			return nil, err
+		}
+	}
+	if err := checkParamType(def, v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
@@ -0,0 +1,100 @@
+package registry
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/atomikpanda/dotular/internal/config"
+	"github.com/atomikpanda/dotular/internal/ui"
+)
+
+func TestResolvePromptsForMissingParams(t *testing.T) {
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "dotular.yaml")
+	module := `
+name: tool
+params:
+  version: {required: true, description: release to install}
+  port: {required: true, type: int}
+  channel: {default: stable}
+items:
+  - run: install {{ .version }} {{ .port }} {{ .channel }}
+`
+	if err := os.WriteFile(filepath.Join(dir, "tool.yaml"), []byte(module), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	doc := "# my dotfiles\nmodules:\n  - name: tool\n    from: ./tool.yaml\n"
+	if err := os.WriteFile(configPath, []byte(doc), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := config.Load(configPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u := ui.New(&bytes.Buffer{}, &bytes.Buffer{})
+	t.Cleanup(func() { ConfigurePrompt(nil) })
+
+	ConfigurePrompt(nil)
+	if _, err := Resolve(context.Background(), cfg, configPath, false, u); err == nil || !strings.Contains(err.Error(), `param "port" is required`) {
+		t.Fatalf("err = %v, want the missing param reported without a prompter", err)
+	}
+
+	var asked []string
+	ConfigurePrompt(func(ref, name string, def Param) (*ParamAnswer, error) {
+		asked = append(asked, name)
+		if name == "port" {
+			return &ParamAnswer{Value: "8080", Save: true}, nil
+		}
+		return &ParamAnswer{Value: "1.2"}, nil
+	})
+	result, err := Resolve(context.Background(), cfg, configPath, false, u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(asked, ",") != "port,version" {
+		t.Errorf("asked = %v, want the required params in name order", asked)
+	}
+	if got := result.Modules[0].Items[0].Run; got != "install 1.2 8080 stable" {
+		t.Errorf("Run = %q", got)
+	}
+
+	saved, err := config.Load(configPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := saved.Modules[0].With; len(got) != 1 || got["port"] != 8080 {
+		t.Errorf("saved with = %v, want only port: 8080", got)
+	}
+	if data, _ := os.ReadFile(configPath); !strings.HasPrefix(string(data), "# my dotfiles") {
+		t.Errorf("config lost its comment:\n%s", data)
+	}
+	if cfg.Modules[0].With != nil {
+		t.Error("Resolve must not modify the caller's config")
+	}
+}
+
+func TestParseParam(t *testing.T) {
+	tests := []struct {
+		def     Param
+		in      string
+		want    any
+		wantErr bool
+	}{
+		{Param{}, "0.10", "0.10", false},
+		{Param{Type: "string"}, "true", "true", false},
+		{Param{Type: "int"}, "42", 42, false},
+		{Param{Type: "int"}, "many", nil, true},
+		{Param{Type: "bool"}, "true", true, false},
+		{Param{Enum: []string{"a", "b"}}, "c", nil, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseParam(tt.def, tt.in)
+		if (err != nil) != tt.wantErr || (!tt.wantErr && got != tt.want) {
+			t.Errorf("ParseParam(%+v, %q) = %v, %v; want %v", tt.def, tt.in, got, err, tt.want)
+		}
+	}
+}
@@ -149,6 +149,7 @@ func TestResolvePreservesAge(t *testing.T) {
 	ageCfg := &config.AgeConfig{Passphrase: "test"}
 	cfg := config.Config{
 		Age:     ageCfg,
+		Hooks:   config.GlobalHooks{BeforeAll: "git pull"},
 		Modules: []config.Module{},
 	}
 
@@ -163,4 +164,82 @@ func TestResolvePreservesAge(t *testing.T) {
 	if result.Age == nil || result.Age.Passphrase != "test" {
 		t.Error("expected age config to be preserved")
 	}
+	if result.Hooks.BeforeAll != "git pull" {
+		t.Error("expected global hooks to be preserved")
+	}
+}
+
+func TestResolveRejectsInvalidParams(t *testing.T) {
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "dotular.yaml")
+	os.WriteFile(filepath.Join(dir, "tool.yaml"), []byte(`
+name: tool
+params:
+  channel:
+    type: enum
+    enum: [stable, nightly]
+    required: true
+items:
+  - run: echo {{ .channel }}
+`), 0o644)
+
+	cfg := config.Config{Modules: []config.Module{
+		{From: "./tool.yaml", With: map[string]any{"channel": "beta"}},
+	}}
+	_, err := Resolve(context.Background(), cfg, configPath, false, ui.New(&bytes.Buffer{}, &bytes.Buffer{}))
+	if err == nil {
+		t.Fatal("expected error for value outside enum")
+	}
+
+	cfg.Modules[0].With["channel"] = "nightly"
+	result, err := Resolve(context.Background(), cfg, configPath, false, ui.New(&bytes.Buffer{}, &bytes.Buffer{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Modules[0].Items[0].Run != "echo nightly" {
+		t.Errorf("Run = %q", result.Modules[0].Items[0].Run)
+	}
+}
+
+func TestResolveVars(t *testing.T) {
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "dotular.yaml")
+	os.WriteFile(filepath.Join(dir, "tool.yaml"), []byte(`
+name: tool
+params:
+  channel:
+    default: stable
+items:
+  - run: install {{ .channel }} {{ .prefix }}
+`), 0o644)
+
+	cfg := config.Config{
+		Vars: map[string]any{"python_version": "3.11", "prefix": "/usr/local"},
+		Modules: []config.Module{
+			{Name: "python", Vars: map[string]any{"python_version": "3.12"}, Items: []config.Item{
+				{Package: "python@{{ .python_version }}", Via: "brew"},
+				{Run: "python{{ .python_version }} -V", Register: "ver"},
+				{Run: "echo {{ .ver }} under {{ .prefix }}"},
+			}},
+			{Name: "plain", Items: []config.Item{{Run: "echo {{ .python_version }}"}}},
+			{From: "./tool.yaml", Vars: map[string]any{"channel": "nightly"}},
+		},
+	}
+	result, err := Resolve(context.Background(), cfg, configPath, false, ui.New(&bytes.Buffer{}, &bytes.Buffer{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	py := result.Modules[0].Items
+	if py[0].Package != "python@3.12" || py[1].Run != "python3.12 -V" {
+		t.Errorf("module vars not rendered: %+v", py[:2])
+	}
+	if py[2].Run != "echo {{ .ver }} under /usr/local" {
+		t.Errorf("registered name should be left for the runner: %q", py[2].Run)
+	}
+	if got := result.Modules[1].Items[0].Run; got != "echo 3.11" {
+		t.Errorf("global vars not rendered: %q", got)
+	}
+	if got := result.Modules[2].Items[0].Run; got != "install stable /usr/local" {
+		t.Errorf("registry params should win over vars: %q", got)
+	}
 }
@@ -2,7 +2,15 @@ package registry
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
 
 	"github.com/atomikpanda/dotular/internal/config"
 	tmpl "github.com/atomikpanda/dotular/internal/template"
@@ -11,7 +19,8 @@ import (
 
 // Resolve processes every module in cfg. Modules with a From field are
 // fetched from the registry, parameterised, and have their overrides merged.
-// The returned Config has no From fields — all modules are fully materialised.
+// Every module's items are rendered with its vars over the config's. The
+// returned Config has no From fields — all modules are fully materialised.
 //
 // configPath is the path to dotular.yaml and is used to locate the lockfile.
 // When noCache is true, all registry modules are re-fetched from the network.
@@ -22,16 +31,39 @@ func Resolve(ctx context.Context, cfg config.Config, configPath string, noCache
 		return config.Config{}, fmt.Errorf("load lockfile: %w", err)
 	}
 
-	result := config.Config{Age: cfg.Age}
+	result := cfg
+	result.Modules = nil
 	lockDirty := false
+	var saved config.Config // cfg with prompted params added to with:, if any
 
-	for _, mod := range cfg.Modules {
+	for i, mod := range cfg.Modules {
+		vars := mergeVars(cfg.Vars, mod.Vars)
 		if !mod.IsRegistry() {
+			if len(vars) > 0 {
+				if mod.Items, err = renderItems(mod.Items, withRegistered(vars, mod.Items)); err != nil {
+					return config.Config{}, fmt.Errorf("module %q: render vars: %w", mod.Name, err)
+				}
+			}
 			result.Modules = append(result.Modules, mod)
 			continue
 		}
 
-		remote, trust, err := Fetch(ctx, mod.From, lock, noCache, u)
+		policy := config.TrustAllow
+		if isCommunity(ParseRef(mod.From).Trust) {
+			if policy, err = communityPolicy(cfg.Trust, mod.From); err != nil {
+				return config.Config{}, err
+			}
+		}
+
+		var remote *RemoteModule
+		var trust TrustLevel
+		if IsLocalRef(mod.From) {
+			remote, err = LoadLocal(configPath, mod.From)
+			trust = Local
+		} else {
+			remote, trust, err = Fetch(ctx, mod.From, lock, noCache, u)
+			lockDirty = true
+		}
 		if err != nil {
 			return config.Config{}, err
 		}
@@ -42,13 +74,48 @@ func Resolve(ctx context.Context, cfg config.Config, configPath string, noCache
 		}
 
 		params := resolveParams(remote.Params, mod.With)
+		answers, err := promptParams(mod.From, remote.Params, params)
+		if err != nil {
+			return config.Config{}, err
+		}
+		if len(answers) > 0 {
+			if saved.Modules == nil {
+				saved = cfg
+				saved.Modules = slices.Clone(cfg.Modules)
+			}
+			with := maps.Clone(mod.With)
+			if with == nil {
+				with = make(map[string]any, len(answers))
+			}
+			maps.Copy(with, answers)
+			saved.Modules[i].With = with
+		}
+		if err := validateParams(remote.Params, params); err != nil {
+			return config.Config{}, fmt.Errorf("%s: %w", mod.From, err)
+		}
 
-		renderedItems, err := renderItems(remote.Items, params)
+		renderedItems, err := renderModuleItems(mod.From, remote.Items, withRegistered(mergeVars(vars, params), remote.Items))
 		if err != nil {
-			return config.Config{}, fmt.Errorf("render %s: %w", mod.From, err)
+			return config.Config{}, fmt.Errorf("render %w", err)
+		}
+		if policy == config.TrustPrompt {
+			accepted, err := review(mod.From, trust, renderedItems, lock)
+			if err != nil {
+				return config.Config{}, err
+			}
+			lockDirty = lockDirty || accepted
+		}
+		overrides := mod.Override
+		if len(vars) > 0 {
+			if overrides, err = renderItems(overrides, withRegistered(vars, overrides)); err != nil {
+				return config.Config{}, fmt.Errorf("module %q: render vars: %w", mod.Name, err)
+			}
 		}
 
-		mergedItems := mergeOverrides(renderedItems, mod.Override)
+		mergedItems, err := mergeOverrides(renderedItems, overrides)
+		if err != nil {
+			return config.Config{}, fmt.Errorf("module %q: %w", mod.Name, err)
+		}
 
 		name := remote.Name
 		if mod.Name != "" {
@@ -56,13 +123,15 @@ func Resolve(ctx context.Context, cfg config.Config, configPath string, noCache
 		}
 
 		result.Modules = append(result.Modules, config.Module{
-			Name:        name,
-			Items:       mergedItems,
-			OnlyTags:    mod.OnlyTags,
-			ExcludeTags: mod.ExcludeTags,
-			Hooks:       mod.Hooks,
+			Name:          name,
+			Items:         mergedItems,
+			OnlyTags:      mod.OnlyTags,
+			ExcludeTags:   mod.ExcludeTags,
+			Hooks:         mod.Hooks,
+			Vars:          mod.Vars,
+			Groups:        mod.Groups,
+			GroupOnlyTags: mod.GroupOnlyTags,
 		})
-		lockDirty = true
 	}
 
 	if lockDirty {
@@ -70,11 +139,33 @@ func Resolve(ctx context.Context, cfg config.Config, configPath string, noCache
 			u.Warn(fmt.Sprintf("could not save lockfile: %v", err))
 		}
 	}
+	if saved.Modules != nil {
+		if err := config.Save(configPath, saved); err != nil {
+			u.Warn(fmt.Sprintf("could not save params to %s: %v", configPath, err))
+		}
+	}
 
 	return result, nil
 }
 
+// LoadLocal reads a module definition from a local ref. Relative refs are
+// resolved against the directory containing configPath.
+func LoadLocal(configPath, rawRef string) (*RemoteModule, error) {
+	path := rawRef
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(filepath.Dir(configPath), path)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read local module %s: %w", rawRef, err)
+	}
+	mod, _, err := parseModule(data)
+	return mod, err
+}
+
 // resolveParams merges user-supplied with values over the module's defaults.
+// Params left without a value are omitted, except optional ones, which are
+// set to the empty string.
 func resolveParams(defs map[string]Param, with map[string]any) map[string]any {
 	params := make(map[string]any, len(defs))
 	for k, def := range defs {
@@ -83,9 +174,126 @@ func resolveParams(defs map[string]Param, with map[string]any) map[string]any {
 	for k, v := range with {
 		params[k] = v
 	}
+	for k, v := range params {
+		if v != nil {
+			continue
+		}
+		if defs[k].Optional {
+			params[k] = ""
+		} else {
+			delete(params, k)
+		}
+	}
 	return params
 }
 
+// validateParams checks resolved params against their definitions: required
+// params must have a value, and values must match the declared type and enum.
+func validateParams(defs map[string]Param, params map[string]any) error {
+	names := make([]string, 0, len(defs))
+	for name := range defs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		def := defs[name]
+		v := params[name]
+		if v == nil {
+			if def.Required {
+				msg := fmt.Sprintf("param %q is required; set it under with:", name)
+				if def.Description != "" {
+					msg += " (" + def.Description + ")"
+				}
+				return errors.New(msg)
+			}
+			continue
+		}
+		if err := checkParamType(def, v); err != nil {
+			return fmt.Errorf("param %q: %w", name, err)
+		}
+	}
+	return nil
+}
+
+func checkParamType(def Param, v any) error {
+	switch def.Type {
+	case "", "enum":
+		if def.Type == "enum" && len(def.Enum) == 0 {
+			return fmt.Errorf("type enum requires an enum: list")
+		}
+	case "string":
+		if _, ok := v.(string); !ok {
+			return fmt.Errorf("must be a string, got %T %v (quote the value in with:)", v, v)
+		}
+	case "int":
+		switch n := v.(type) {
+		case int, int64, uint64:
+		case float64:
+			if n != float64(int64(n)) {
+				return fmt.Errorf("must be an int, got %v", v)
+			}
+		default:
+			return fmt.Errorf("must be an int, got %T %v", v, v)
+		}
+	case "bool":
+		if _, ok := v.(bool); !ok {
+			return fmt.Errorf("must be a bool, got %T %v", v, v)
+		}
+	default:
+		return fmt.Errorf("unknown type %q (want string, int, bool, or enum)", def.Type)
+	}
+
+	if len(def.Enum) > 0 {
+		s := fmt.Sprint(v)
+		for _, allowed := range def.Enum {
+			if s == allowed {
+				return nil
+			}
+		}
+		return fmt.Errorf("must be one of [%s], got %q", strings.Join(def.Enum, ", "), s)
+	}
+	return nil
+}
+
+// mergeVars returns the values of base overlaid with over.
+func mergeVars(base, over map[string]any) map[string]any {
+	if len(base) == 0 {
+		return over
+	}
+	merged := make(map[string]any, len(base)+len(over))
+	for k, v := range base {
+		merged[k] = v
+	}
+	for k, v := range over {
+		merged[k] = v
+	}
+	return merged
+}
+
+// withRegistered adds to vars a reference to itself for every name an item
+// registers, so that rendering leaves {{ .name }} in place for the runner
+// to fill in with the command's output.
+func withRegistered(vars map[string]any, items []config.Item) map[string]any {
+	out, copied := vars, false
+	for _, item := range items {
+		if item.Register == "" {
+			continue
+		}
+		if _, ok := vars[item.Register]; ok {
+			continue
+		}
+		if !copied {
+			out, copied = make(map[string]any, len(vars)+1), true
+			for k, v := range vars {
+				out[k] = v
+			}
+		}
+		out[item.Register] = "{{ ." + item.Register + " }}"
+	}
+	return out
+}
+
 // renderItems renders Go template expressions in every item's string fields.
 func renderItems(items []config.Item, params map[string]any) ([]config.Item, error) {
 	rendered := make([]config.Item, 0, len(items))
@@ -99,39 +307,119 @@ func renderItems(items []config.Item, params map[string]any) ([]config.Item, err
 	return rendered, nil
 }
 
-// mergeOverrides replaces items in base with matching overrides (matched by
-// type + primary value). Overrides that match nothing are appended.
-func mergeOverrides(base, overrides []config.Item) []config.Item {
+// renderModuleItems renders a registry module's items like renderItems, but
+// a reference to a param without a value is an error naming the module, the
+// item, and the param.
+func renderModuleItems(ref string, items []config.Item, params map[string]any) ([]config.Item, error) {
+	rendered := make([]config.Item, 0, len(items))
+	for i, item := range items {
+		r, err := tmpl.RenderItemStrict(item, params)
+		if err != nil {
+			where := fmt.Sprintf("item %d", i+1)
+			if item.Name != "" {
+				where += fmt.Sprintf(" (%s)", item.Name)
+			}
+			var missing *tmpl.MissingParamError
+			if errors.As(err, &missing) {
+				return nil, fmt.Errorf("%s: %s: %w; set it under with:, or declare it with a default or optional: true", ref, where, err)
+			}
+			return nil, fmt.Errorf("%s: %s: %w", ref, where, err)
+		}
+		rendered = append(rendered, r)
+	}
+	return rendered, nil
+}
+
+// mergeOverrides merges matching overrides into the items of base: an
+// override with a name matches the base item of that name, and one without
+// matches by type + primary value. Only the fields an override sets replace
+// the item's (see overlayItem), unless it sets a different item type, which
+// replaces the item whole. Overrides that match nothing are appended, and
+// must then be complete items.
+func mergeOverrides(base, overrides []config.Item) ([]config.Item, error) {
 	if len(overrides) == 0 {
-		return base
+		return base, nil
 	}
 
 	type key struct{ typ, val string }
+	keyOf := func(item config.Item) key {
+		if item.Name != "" {
+			return key{"name", item.Name}
+		}
+		return key{item.Type(), item.PrimaryValue()}
+	}
 	overrideMap := make(map[key]config.Item, len(overrides))
 	for _, ov := range overrides {
-		overrideMap[key{ov.Type(), ov.PrimaryValue()}] = ov
+		overrideMap[keyOf(ov)] = ov
 	}
 
 	result := make([]config.Item, len(base))
 	replaced := make(map[key]bool)
 
 	for i, item := range base {
-		k := key{item.Type(), item.PrimaryValue()}
-		if ov, ok := overrideMap[k]; ok {
+		k := keyOf(item)
+		ov, ok := overrideMap[k]
+		if !ok && item.Name != "" {
+			// An unnamed override still matches a named item by value.
+			k = key{item.Type(), item.PrimaryValue()}
+			ov, ok = overrideMap[k]
+		}
+		switch {
+		case !ok:
+			result[i] = item
+		case ov.Type() != "unknown" && ov.Type() != item.Type():
 			result[i] = ov
+		default:
+			result[i] = overlayItem(item, ov)
+		}
+		if ok {
 			replaced[k] = true
-		} else {
-			result[i] = item
 		}
 	}
 
 	// Append overrides that didn't match any base item.
 	for _, ov := range overrides {
-		k := key{ov.Type(), ov.PrimaryValue()}
-		if !replaced[k] {
-			result = append(result, ov)
+		if replaced[keyOf(ov)] {
+			continue
 		}
+		if ov.Type() == "unknown" {
+			return nil, fmt.Errorf("override %q matches no item of the module", ov.Name)
+		}
+		result = append(result, ov)
 	}
 
-	return result
+	return result, nil
+}
+
+// overlayItem returns item with every field that ov sets replaced by ov's.
+// Nested structs such as destination and hooks are merged field by field
+// and maps key by key; lists are replaced whole. A field cannot be reset to
+// its zero value this way.
+func overlayItem(item, ov config.Item) config.Item {
+	overlay(reflect.ValueOf(&item).Elem(), reflect.ValueOf(ov))
+	return item
+}
+
+func overlay(dst, src reflect.Value) {
+	for i := 0; i < src.NumField(); i++ {
+		f := src.Field(i)
+		if !src.Type().Field(i).IsExported() || f.IsZero() {
+			continue
+		}
+		d := dst.Field(i)
+		switch f.Kind() {
+		case reflect.Struct:
+			overlay(d, f)
+		case reflect.Map:
+			merged := reflect.MakeMapWithSize(f.Type(), d.Len()+f.Len())
+			for _, m := range []reflect.Value{d, f} {
+				for iter := m.MapRange(); iter.Next(); {
+					merged.SetMapIndex(iter.Key(), iter.Value())
+				}
+			}
+			d.Set(merged)
+		default:
+			d.Set(f)
+		}
+	}
 }
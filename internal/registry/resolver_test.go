@@ -1,6 +1,7 @@
 package registry
 
 import (
+	"strings"
 	"testing"
 
 	"github.com/atomikpanda/dotular/internal/config"
@@ -29,6 +30,20 @@ func TestResolveParams(t *testing.T) {
 	}
 }
 
+func TestResolveParamsUnset(t *testing.T) {
+	defs := map[string]Param{
+		"version": {},
+		"flags":   {Optional: true},
+	}
+	params := resolveParams(defs, map[string]any{"version": nil})
+	if _, ok := params["version"]; ok {
+		t.Errorf("version = %v, want it omitted", params["version"])
+	}
+	if v, ok := params["flags"]; !ok || v != "" {
+		t.Errorf("flags = %v, want the empty string", v)
+	}
+}
+
 func TestResolveParamsEmpty(t *testing.T) {
 	params := resolveParams(nil, nil)
 	if len(params) != 0 {
@@ -47,7 +62,10 @@ func TestMergeOverrides(t *testing.T) {
 		{Package: "neovim", Via: "brew"},    // appends (no match)
 	}
 
-	result := mergeOverrides(base, overrides)
+	result, err := mergeOverrides(base, overrides)
+	if err != nil {
+		t.Fatal(err)
+	}
 
 	if len(result) != 4 {
 		t.Fatalf("expected 4 items, got %d", len(result))
@@ -70,9 +88,93 @@ func TestMergeOverrides(t *testing.T) {
 	}
 }
 
+func TestMergeOverridesByName(t *testing.T) {
+	base := []config.Item{
+		{Name: "nvim config", File: "nvim/init.lua"},
+		{Name: "vim config", File: "vim/init.lua"},
+		{Name: "git", Package: "git", Via: "brew"},
+	}
+	overrides := []config.Item{
+		{Name: "vim config", File: "vim/vimrc"}, // replaces by name
+		{Package: "git", Via: "apt"},            // unnamed: replaces by value
+	}
+
+	result, err := mergeOverrides(base, overrides)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(result) != 3 {
+		t.Fatalf("expected 3 items, got %+v", result)
+	}
+	if result[0].File != "nvim/init.lua" {
+		t.Errorf("item 0: %+v", result[0])
+	}
+	if result[1].File != "vim/vimrc" {
+		t.Errorf("item 1: %+v", result[1])
+	}
+	if result[2].Via != "apt" {
+		t.Errorf("item 2: %+v", result[2])
+	}
+}
+
+func TestMergeOverridesDeepMerge(t *testing.T) {
+	base := []config.Item{
+		{
+			Name:        "nvim config",
+			Directory:   "nvim",
+			Direction:   "sync",
+			Destination: config.PlatformMap{MacOS: "~/.config", Linux: "~/.config"},
+			Hooks:       config.ItemHooks{BeforeApply: "echo before", AfterApply: "echo after"},
+			SSHOptions:  map[string]string{"User": "me"},
+		},
+		{Package: "git", Via: "brew", SkipIf: "command -v git"},
+	}
+	overrides := []config.Item{
+		{Name: "nvim config", Destination: config.PlatformMap{Linux: "~/.local/nvim"}, Hooks: config.ItemHooks{AfterApply: "echo done"}, SSHOptions: map[string]string{"Port": "22"}},
+		{Package: "git", Via: "apt"},
+		{Name: "git", Binary: "git"}, // a different type replaces the item whole
+	}
+	base = append(base, config.Item{Name: "git", Package: "git-lfs", Via: "brew"})
+
+	result, err := mergeOverrides(base, overrides)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nvim := result[0]
+	if nvim.Directory != "nvim" || nvim.Direction != "sync" {
+		t.Errorf("unset fields should be kept: %+v", nvim)
+	}
+	if nvim.Destination.MacOS != "~/.config" || nvim.Destination.Linux != "~/.local/nvim" {
+		t.Errorf("destination = %+v", nvim.Destination)
+	}
+	if nvim.Hooks.BeforeApply != "echo before" || nvim.Hooks.AfterApply != "echo done" {
+		t.Errorf("hooks = %+v", nvim.Hooks)
+	}
+	if nvim.SSHOptions["User"] != "me" || nvim.SSHOptions["Port"] != "22" {
+		t.Errorf("options = %v", nvim.SSHOptions)
+	}
+	if base[0].SSHOptions["Port"] != "" {
+		t.Error("base item's map was modified")
+	}
+	if git := result[1]; git.Via != "apt" || git.SkipIf != "command -v git" {
+		t.Errorf("git = %+v", git)
+	}
+	if lfs := result[2]; lfs.Binary != "git" || lfs.Package != "" {
+		t.Errorf("replaced item = %+v", lfs)
+	}
+
+	if _, err := mergeOverrides(base, []config.Item{{Name: "missing", Via: "apt"}}); err == nil {
+		t.Error("expected an error for a partial override that matches nothing")
+	}
+}
+
 func TestMergeOverridesEmpty(t *testing.T) {
 	base := []config.Item{{Package: "git"}}
-	result := mergeOverrides(base, nil)
+	result, err := mergeOverrides(base, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
 	if len(result) != 1 || result[0].Package != "git" {
 		t.Errorf("unexpected result: %+v", result)
 	}
@@ -92,3 +194,65 @@ func TestRenderItems(t *testing.T) {
 		t.Errorf("Package = %q", result[0].Package)
 	}
 }
+
+func TestRenderModuleItemsMissingParam(t *testing.T) {
+	items := []config.Item{
+		{Package: "{{ .pkg }}", Via: "brew"},
+		{Name: "install", Run: "install {{ .version }}"},
+	}
+	_, err := renderModuleItems("github.com/someone/tools", items, map[string]any{"pkg": "tool"})
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	for _, want := range []string{"github.com/someone/tools", "item 2 (install)", `param "version" is not set`} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("err = %q, want it to contain %q", err, want)
+		}
+	}
+}
+
+func TestValidateParams(t *testing.T) {
+	defs := map[string]Param{
+		"version": {Type: "string", Required: true, Description: "release tag"},
+		"port":    {Type: "int", Default: 8080},
+		"enabled": {Type: "bool"},
+		"theme":   {Type: "enum", Enum: []string{"dark", "light"}},
+	}
+	tests := []struct {
+		name    string
+		with    map[string]any
+		wantErr string
+	}{
+		{"valid", map[string]any{"version": "1.0", "enabled": true, "theme": "dark"}, ""},
+		{"missing required", map[string]any{}, `param "version" is required`},
+		{"wrong string type", map[string]any{"version": 1}, `param "version": must be a string`},
+		{"wrong int type", map[string]any{"version": "1", "port": "80"}, `param "port": must be an int`},
+		{"integral float ok", map[string]any{"version": "1", "port": 80.0}, ""},
+		{"fractional float", map[string]any{"version": "1", "port": 80.5}, `param "port": must be an int`},
+		{"wrong bool type", map[string]any{"version": "1", "enabled": "yes"}, `param "enabled": must be a bool`},
+		{"not in enum", map[string]any{"version": "1", "theme": "blue"}, `must be one of [dark, light], got "blue"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateParams(defs, resolveParams(defs, tt.with))
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("error = %v, want containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateParamsBadDefinition(t *testing.T) {
+	if err := validateParams(map[string]Param{"x": {Type: "float"}}, map[string]any{"x": 1}); err == nil {
+		t.Error("expected error for unknown type")
+	}
+	if err := validateParams(map[string]Param{"x": {Type: "enum"}}, map[string]any{"x": "a"}); err == nil {
+		t.Error("expected error for enum without values")
+	}
+}
@@ -0,0 +1,230 @@
+package registry
+
+import (
+	"fmt"
+	"maps"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/atomikpanda/dotular/internal/actions"
+	"github.com/atomikpanda/dotular/internal/config"
+	"github.com/atomikpanda/dotular/internal/errs"
+)
+
+// Summary lists what a registry module's items would run or download, so a
+// community module can be reviewed before it is first used.
+type Summary struct {
+	Commands   []string // run items, guards, verify commands, hooks, and ssh commands
+	Scripts    []string // local scripts, relative to the module
+	URLs       []string // remote scripts, binary downloads, plugins, and signing keys
+	Sudo       []string // commands that call sudo, including package managers'
+	Sources    []string // package sources added by repo items
+	Containers []string // images run, with their ports and volumes, and compose files
+	Installs   []string // shell plugins, editor extensions, and login items
+}
+
+var sudoPattern = regexp.MustCompile(`\bsudo\b`)
+
+// sshCommands are the ssh_config options whose values ssh runs.
+var sshCommands = []string{"ProxyCommand", "LocalCommand", "KnownHostsCommand"}
+
+// pinPattern matches the versions trust.require_pin accepts: a semver tag or
+// a full commit SHA. Branches, whatever their name, can move.
+var pinPattern = regexp.MustCompile(`^(v?\d+\.\d+\.\d+([-+][0-9A-Za-z.+-]*)?|[0-9a-f]{40})$`)
+
+// Summarize collects what items run, download, or escalate: shell commands,
+// scripts, URLs, sudo usages, package sources, containers, and installed
+// plugins. Each list keeps the first occurrence of a value in item order.
+func Summarize(items []config.Item) Summary {
+	var s Summary
+	add := func(list *[]string, v string) {
+		v = strings.TrimSpace(v)
+		if v != "" && !slices.Contains(*list, v) {
+			*list = append(*list, v)
+		}
+	}
+	for _, item := range items {
+		for _, c := range []string{
+			item.Run, item.SkipIf, item.Unless, item.OnlyIf, item.Verify.Command,
+			item.Hooks.BeforeApply, item.Hooks.AfterApply, item.Hooks.BeforeSync, item.Hooks.AfterSync,
+		} {
+			add(&s.Commands, c)
+			if sudoPattern.MatchString(c) {
+				add(&s.Sudo, c)
+			}
+		}
+		if item.Script != "" {
+			if item.Via == "remote" {
+				add(&s.URLs, item.Script)
+			} else {
+				add(&s.Scripts, item.Script)
+			}
+		}
+		for _, u := range []string{item.Source.MacOS, item.Source.Linux, item.Source.Windows, item.KeyURL, item.Keyserver} {
+			add(&s.URLs, u)
+		}
+		sudo := func(args []string) {
+			if len(args) > 0 && args[0] == "sudo" {
+				add(&s.Sudo, strings.Join(args, " "))
+			}
+		}
+		switch item.Type() {
+		case "package":
+			if args, err := actions.InstallCommand(item.Via, item.Package); err == nil {
+				sudo(args)
+			}
+		case "repo":
+			add(&s.Sources, item.Via+": "+item.Repo)
+			if steps, err := (&actions.RepoAction{Repo: item.Repo, Manager: item.Via}).Commands(); err == nil {
+				for _, args := range steps {
+					sudo(args)
+				}
+			}
+		case "container":
+			add(&s.Containers, describeContainer(item))
+		case "shell_plugin":
+			a := &actions.ShellPluginAction{Plugin: item.ShellPlugin, Manager: item.Via, Version: item.Version}
+			add(&s.Installs, a.Describe())
+			for _, u := range a.Downloads() {
+				add(&s.URLs, u)
+			}
+			if item.Via == "fisher" {
+				add(&s.Commands, "curl -fsSL "+actions.FisherURL+" | source")
+			}
+		case "extension":
+			for _, ext := range append([]string{item.Extension}, item.Extensions...) {
+				if ext != "" {
+					add(&s.Installs, strings.TrimSpace(item.Via+" extension "+ext))
+				}
+			}
+		case "login_item":
+			add(&s.Installs, "open at login: "+item.LoginItem)
+		case "ssh_host":
+			for _, k := range slices.Sorted(maps.Keys(item.SSHOptions)) {
+				if slices.ContainsFunc(sshCommands, func(c string) bool { return strings.EqualFold(c, k) }) {
+					add(&s.Commands, item.SSHOptions[k])
+				}
+			}
+		}
+	}
+	return s
+}
+
+// describeContainer returns what a container item runs: an image with its
+// ports and volumes, a compose file, or an image to pull.
+func describeContainer(item config.Item) string {
+	switch {
+	case item.Compose != "":
+		return "compose " + item.Compose
+	case item.Image == "":
+		return "pull " + item.Container
+	}
+	desc := "run " + item.Image + " as " + item.Container
+	if len(item.Ports) > 0 {
+		desc += "; ports " + strings.Join(item.Ports, ", ")
+	}
+	if len(item.Volumes) > 0 {
+		desc += "; volumes " + strings.Join(item.Volumes, ", ")
+	}
+	return desc
+}
+
+// Empty reports whether the module runs, downloads, and escalates nothing.
+func (s Summary) Empty() bool {
+	return len(s.Commands) == 0 && len(s.Scripts) == 0 && len(s.URLs) == 0 && len(s.Sudo) == 0 &&
+		len(s.Sources) == 0 && len(s.Containers) == 0 && len(s.Installs) == 0
+}
+
+// String renders the summary as indented lines, one section per kind.
+func (s Summary) String() string {
+	if s.Empty() {
+		return "  (no commands, scripts, or downloads)\n"
+	}
+	var b strings.Builder
+	section := func(title string, values []string) {
+		if len(values) == 0 {
+			return
+		}
+		fmt.Fprintf(&b, "  %s:\n", title)
+		for _, v := range values {
+			fmt.Fprintf(&b, "    %s\n", v)
+		}
+	}
+	section("shell commands", s.Commands)
+	section("scripts", s.Scripts)
+	section("URLs", s.URLs)
+	section("sudo", s.Sudo)
+	section("package sources", s.Sources)
+	section("containers", s.Containers)
+	section("installs", s.Installs)
+	return b.String()
+}
+
+// Reviewer is asked whether a community module may be used, given its
+// summary. It returns false to refuse it.
+type Reviewer func(ref string, trust TrustLevel, s Summary) (bool, error)
+
+var reviewer Reviewer
+
+// ConfigureReview sets the Reviewer that Resolve consults before a GitHub or
+// external module is used for the first time, or after its content changed,
+// when the trust policy is to prompt. Without one such modules are refused.
+func ConfigureReview(r Reviewer) {
+	reviewer = r
+}
+
+// isCommunity reports whether modules of this trust level fall under the
+// config's trust policy.
+func isCommunity(trust TrustLevel) bool {
+	return trust == GitHub || trust == External
+}
+
+// communityPolicy returns how Resolve treats the community module rawRef
+// under p: modules under a private host are allowed, and TrustDeny and
+// RequirePin refuse the ref outright.
+func communityPolicy(p config.TrustConfig, rawRef string) (string, error) {
+	ref := ParseRef(rawRef)
+	name := ref.Host + "/" + ref.Path
+	for _, prefix := range p.PrivateHosts {
+		prefix = strings.TrimSuffix(prefix, "/")
+		if name == prefix || strings.HasPrefix(name, prefix+"/") {
+			return config.TrustAllow, nil
+		}
+	}
+	if p.Community == config.TrustDeny {
+		return "", fmt.Errorf("%s: community registry modules are denied by trust.community; vendor the module or add its host to trust.private_hosts", rawRef)
+	}
+	if p.RequirePin {
+		if !pinPattern.MatchString(ref.Version) {
+			return "", fmt.Errorf("%s: trust.require_pin needs a semver tag or full commit SHA, e.g. %s@v1.0.0", rawRef, name)
+		}
+	}
+	if p.Community == "" {
+		return config.TrustPrompt, nil
+	}
+	return p.Community, nil
+}
+
+// review makes sure the locked content of ref was accepted, asking the
+// configured Reviewer when it was not and recording its answer in lock. It
+// reports whether lock changed.
+func review(ref string, trust TrustLevel, items []config.Item, lock *LockFile) (bool, error) {
+	entry := lock.Registry[ref]
+	if entry.Accepted != "" && entry.Accepted == entry.SHA256 {
+		return false, nil
+	}
+	if reviewer == nil {
+		return false, fmt.Errorf("%s: %w", ref, errs.ErrNotAccepted)
+	}
+	ok, err := reviewer(ref, trust, Summarize(items))
+	if err != nil {
+		return false, err
+	}
+	if !ok {
+		return false, fmt.Errorf("%s: %w", ref, errs.ErrNotAccepted)
+	}
+	entry.Accepted = entry.SHA256
+	lock.Registry[ref] = entry
+	return true, nil
+}
@@ -0,0 +1,211 @@
+package registry
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/atomikpanda/dotular/internal/actions"
+	"github.com/atomikpanda/dotular/internal/config"
+	"github.com/atomikpanda/dotular/internal/errs"
+	"github.com/atomikpanda/dotular/internal/ui"
+)
+
+func TestSummarize(t *testing.T) {
+	s := Summarize([]config.Item{
+		{Run: "sudo make install", SkipIf: "command -v tool"},
+		{Script: "https://example.com/install.sh", Via: "remote"},
+		{Script: "setup.sh"},
+		{Binary: "tool", Source: config.PlatformMap{MacOS: "https://example.com/tool.tgz", Linux: "https://example.com/tool.tgz"}},
+		{Package: "git", Via: "brew", Hooks: config.ItemHooks{AfterApply: "git --version"}},
+	})
+	if want := []string{"sudo make install", "command -v tool", "git --version"}; !slices.Equal(s.Commands, want) {
+		t.Errorf("Commands = %q, want %q", s.Commands, want)
+	}
+	if want := []string{"setup.sh"}; !slices.Equal(s.Scripts, want) {
+		t.Errorf("Scripts = %q, want %q", s.Scripts, want)
+	}
+	if want := []string{"https://example.com/install.sh", "https://example.com/tool.tgz"}; !slices.Equal(s.URLs, want) {
+		t.Errorf("URLs = %q, want %q", s.URLs, want)
+	}
+	if want := []string{"sudo make install"}; !slices.Equal(s.Sudo, want) {
+		t.Errorf("Sudo = %q, want %q", s.Sudo, want)
+	}
+	if !Summarize([]config.Item{{Package: "git"}}).Empty() {
+		t.Error("a package-only module should have an empty summary")
+	}
+}
+
+func TestSummarizeItemTypes(t *testing.T) {
+	tests := []struct {
+		name string
+		item config.Item
+		want Summary
+	}{
+		{"apt package", config.Item{Package: "curl", Via: "apt"}, Summary{
+			Sudo: []string{"sudo apt-get install -y curl"},
+		}},
+		{"brew package", config.Item{Package: "curl", Via: "brew"}, Summary{}},
+		{"apt repo", config.Item{Repo: "deb https://repo.example.com stable main", Via: "apt", KeyURL: "https://repo.example.com/key.gpg"}, Summary{
+			URLs:    []string{"https://repo.example.com/key.gpg"},
+			Sudo:    []string{"sudo apt-get update"},
+			Sources: []string{"apt: deb https://repo.example.com stable main"},
+		}},
+		{"brew tap", config.Item{Repo: "owner/tap", Via: "brew"}, Summary{
+			Sources: []string{"brew: owner/tap"},
+		}},
+		{"container image", config.Item{Container: "web", Image: "nginx:1", Ports: []string{"8080:80"}, Volumes: []string{"/:/host"}}, Summary{
+			Containers: []string{"run nginx:1 as web; ports 8080:80; volumes /:/host"},
+		}},
+		{"compose", config.Item{Container: "stack", Compose: "compose.yaml"}, Summary{
+			Containers: []string{"compose compose.yaml"},
+		}},
+		{"fisher plugin", config.Item{ShellPlugin: "me/plugin", Via: "fisher", Version: "v1.0.0"}, Summary{
+			Commands: []string{"curl -fsSL " + actions.FisherURL + " | source"},
+			URLs:     []string{"https://github.com/me/plugin.git", actions.FisherURL},
+			Installs: []string{"install fisher plugin me/plugin@v1.0.0"},
+		}},
+		{"tpm plugin", config.Item{ShellPlugin: "tmux-plugins/tmux-sensible", Via: "tpm"}, Summary{
+			URLs:     []string{"https://github.com/tmux-plugins/tmux-sensible.git", "https://github.com/tmux-plugins/tpm.git"},
+			Installs: []string{"install tpm plugin tmux-plugins/tmux-sensible"},
+		}},
+		{"extension", config.Item{Extensions: []string{"golang.go"}, Via: "code"}, Summary{
+			Installs: []string{"code extension golang.go"},
+		}},
+		{"login item", config.Item{LoginItem: "Rectangle"}, Summary{
+			Installs: []string{"open at login: Rectangle"},
+		}},
+		{"gpg keyserver", config.Item{GpgKey: "ABCD", Keyserver: "hkps://keys.example.com"}, Summary{
+			URLs: []string{"hkps://keys.example.com"},
+		}},
+		{"ssh proxy command", config.Item{SSHHost: "box", SSHOptions: map[string]string{"proxycommand": "nc %h %p", "User": "me"}}, Summary{
+			Commands: []string{"nc %h %p"},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Summarize([]config.Item{tt.item})
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Summarize = %+v, want %+v", got, tt.want)
+			}
+			if got.Empty() != reflect.DeepEqual(tt.want, Summary{}) {
+				t.Errorf("Empty() = %v", got.Empty())
+			}
+		})
+	}
+}
+
+func TestResolveReviewsCommunityModules(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "dotular.yaml")
+	ref := "github.com/someone/tools@v1"
+	module := []byte("name: tools\nitems:\n  - run: sudo ./install\n")
+	if err := writeCacheFile(moduleCachePath(ref), module); err != nil {
+		t.Fatal(err)
+	}
+	lock := &LockFile{Registry: map[string]LockEntry{ref: {SHA256: fmt.Sprintf("%x", sha256.Sum256(module))}}}
+	if err := SaveLock(LockPath(configPath), lock); err != nil {
+		t.Fatal(err)
+	}
+	cfg := config.Config{Modules: []config.Module{{Name: "tools", From: ref}}}
+	u := ui.New(&bytes.Buffer{}, &bytes.Buffer{})
+	t.Cleanup(func() { ConfigureReview(nil) })
+
+	ConfigureReview(nil)
+	if _, err := Resolve(context.Background(), cfg, configPath, false, u); !errors.Is(err, errs.ErrNotAccepted) {
+		t.Fatalf("err = %v, want ErrNotAccepted without a reviewer", err)
+	}
+
+	var asked []Summary
+	ConfigureReview(func(_ string, trust TrustLevel, s Summary) (bool, error) {
+		if trust != GitHub {
+			t.Errorf("trust = %v, want github", trust)
+		}
+		asked = append(asked, s)
+		return true, nil
+	})
+	for range 2 {
+		if _, err := Resolve(context.Background(), cfg, configPath, false, u); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(asked) != 1 || !slices.Equal(asked[0].Sudo, []string{"sudo ./install"}) {
+		t.Errorf("reviews = %+v, want one listing the sudo command", asked)
+	}
+	saved, err := LoadLock(LockPath(configPath))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e := saved.Registry[ref]; e.Accepted != e.SHA256 {
+		t.Errorf("accepted = %q, want the module checksum %q", e.Accepted, e.SHA256)
+	}
+
+	// Changed content is reviewed again.
+	module = append(module, "  - run: curl example.com | sh\n"...)
+	if err := os.WriteFile(moduleCachePath(ref), module, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	e := saved.Registry[ref]
+	e.SHA256 = fmt.Sprintf("%x", sha256.Sum256(module))
+	saved.Registry[ref] = e
+	if err := SaveLock(LockPath(configPath), saved); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Resolve(context.Background(), cfg, configPath, false, u); err != nil {
+		t.Fatal(err)
+	}
+	if len(asked) != 2 {
+		t.Errorf("changed module reviewed %d times in total, want 2", len(asked))
+	}
+}
+
+func TestCommunityPolicy(t *testing.T) {
+	tests := []struct {
+		policy config.TrustConfig
+		ref    string
+		want   string // policy, or a substring of the error
+	}{
+		{config.TrustConfig{}, "github.com/someone/tools", config.TrustPrompt},
+		{config.TrustConfig{Community: config.TrustAllow}, "github.com/someone/tools", config.TrustAllow},
+		{config.TrustConfig{Community: config.TrustDeny}, "github.com/someone/tools", "denied by trust.community"},
+		{config.TrustConfig{Community: config.TrustDeny, PrivateHosts: []string{"github.com/myorg"}}, "github.com/myorg/tools@main", config.TrustAllow},
+		{config.TrustConfig{Community: config.TrustDeny, PrivateHosts: []string{"github.com/myorg"}}, "github.com/myorganisation/tools", "denied"},
+		{config.TrustConfig{RequirePin: true}, "github.com/someone/tools@main", "require_pin"},
+		{config.TrustConfig{RequirePin: true}, "example.com/modules/tools.yaml", "require_pin"},
+		{config.TrustConfig{RequirePin: true}, "github.com/someone/tools@v1.2.0", config.TrustPrompt},
+		{config.TrustConfig{RequirePin: true}, "github.com/someone/tools@develop", "require_pin"},
+		{config.TrustConfig{RequirePin: true}, "github.com/someone/tools@v1", "require_pin"},
+		{config.TrustConfig{RequirePin: true}, "github.com/someone/tools@0123456789abcdef0123456789abcdef01234567", config.TrustPrompt},
+	}
+	for _, tt := range tests {
+		got, err := communityPolicy(tt.policy, tt.ref)
+		if err != nil {
+			got = err.Error()
+		}
+		if !strings.Contains(got, tt.want) {
+			t.Errorf("communityPolicy(%+v, %q) = %q, want %q", tt.policy, tt.ref, got, tt.want)
+		}
+	}
+}
+
+func TestResolveDeniedCommunityModule(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	configPath := filepath.Join(t.TempDir(), "dotular.yaml")
+	cfg := config.Config{
+		Trust:   config.TrustConfig{Community: config.TrustDeny},
+		Modules: []config.Module{{Name: "official", Items: []config.Item{{Package: "git"}}}, {Name: "tools", From: "github.com/someone/tools@v1"}},
+	}
+	_, err := Resolve(context.Background(), cfg, configPath, false, ui.New(&bytes.Buffer{}, &bytes.Buffer{}))
+	if err == nil || !strings.Contains(err.Error(), "denied by trust.community") {
+		t.Errorf("err = %v, want the module denied before it is fetched", err)
+	}
+}
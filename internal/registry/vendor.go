@@ -0,0 +1,175 @@
+package registry
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/atomikpanda/dotular/internal/config"
+	"github.com/atomikpanda/dotular/internal/ui"
+)
+
+// VendorDirName is the directory, next to dotular.yaml, that holds vendored
+// registry modules.
+const VendorDirName = "vendor"
+
+// VendoredModule records a registry module copied into the vendor directory.
+type VendoredModule struct {
+	Ref   string // original registry reference
+	Local string // local ref written into the config, e.g. "./vendor/neovim.yaml"
+}
+
+// VendorDir returns the vendor directory derived from the config file path.
+func VendorDir(configPath string) string {
+	return filepath.Join(filepath.Dir(configPath), VendorDirName)
+}
+
+// Vendor fetches every registry module referenced by cfg, writes its raw
+// definition into the vendor directory, and returns a copy of cfg whose
+// From fields point at the vendored files. Modules that already use a local
+// ref are left untouched. The lockfile is updated with any fresh fetches.
+func Vendor(ctx context.Context, cfg config.Config, configPath string, noCache bool, u *ui.UI) (config.Config, []VendoredModule, error) {
+	lockPath := LockPath(configPath)
+	lock, err := LoadLock(lockPath)
+	if err != nil {
+		return config.Config{}, nil, fmt.Errorf("load lockfile: %w", err)
+	}
+
+	out := cfg
+	out.Modules = append([]config.Module(nil), cfg.Modules...)
+
+	dir := VendorDir(configPath)
+	used := vendorOwners(cfg, dir)
+	var vendored []VendoredModule
+
+	for i, mod := range out.Modules {
+		if !mod.IsRegistry() || IsLocalRef(mod.From) {
+			continue
+		}
+		data, _, err := FetchRaw(ctx, mod.From, lock, noCache, u)
+		if err != nil {
+			return config.Config{}, nil, err
+		}
+
+		name := vendorFileName(mod.From, used)
+		header := fmt.Sprintf(vendorHeader+"\n", mod.From)
+		if err := writeVendorFile(filepath.Join(dir, name), append([]byte(header), data...)); err != nil {
+			return config.Config{}, nil, fmt.Errorf("vendor %s: %w", mod.From, err)
+		}
+
+		local := "./" + VendorDirName + "/" + name
+		vendored = append(vendored, VendoredModule{Ref: mod.From, Local: local})
+		out.Modules[i].From = local
+	}
+
+	if len(vendored) > 0 {
+		if err := SaveLock(lockPath, lock); err != nil {
+			u.Warn(fmt.Sprintf("could not save lockfile: %v", err))
+		}
+	}
+	return out, vendored, nil
+}
+
+// vendorHeader is the first line of a vendored file, naming its ref.
+const vendorHeader = "# vendored from %s by `dotular registry vendor`"
+
+// vendorOwners maps the names of the files already in the vendor directory
+// dir to the refs they were vendored from, so a later vendor run does not
+// overwrite another module's file. Files without a header, and names that
+// local refs in cfg point at but that are missing, map to "": they belong
+// to no ref and are never reused.
+func vendorOwners(cfg config.Config, dir string) map[string]string {
+	owners := make(map[string]string)
+	for _, mod := range cfg.Modules {
+		if IsLocalRef(mod.From) && filepath.Dir(filepath.Clean(mod.From)) == VendorDirName {
+			owners[filepath.Base(mod.From)] = ""
+		}
+	}
+	entries, _ := os.ReadDir(dir)
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+		owners[e.Name()] = vendoredFrom(filepath.Join(dir, e.Name()))
+	}
+	return owners
+}
+
+// vendoredFrom returns the ref named in the header of the vendored file at
+// path, or "" when it has none.
+func vendoredFrom(path string) string {
+	f, err := os.Open(path)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+	line, _ := bufio.NewReader(f).ReadString('\n')
+	prefix, suffix, _ := strings.Cut(vendorHeader, "%s")
+	ref, ok := strings.CutPrefix(strings.TrimRight(line, "\r\n"), prefix)
+	if !ok {
+		return ""
+	}
+	ref, ok = strings.CutSuffix(ref, suffix)
+	if !ok {
+		return ""
+	}
+	return ref
+}
+
+// writeVendorFile writes a vendored module through a temporary file in the
+// vendor directory, so an interrupted run never leaves a truncated module
+// for the config to load.
+func writeVendorFile(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".vendor-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// vendorFileName derives a file name for a vendored module from the last
+// path element of its ref, adding a numeric suffix when the name belongs to
+// another ref in used, which maps names to the refs that own them.
+func vendorFileName(rawRef string, used map[string]string) string {
+	base := path.Base(ParseRef(rawRef).Path)
+	base = strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_':
+			return r
+		default:
+			return '_'
+		}
+	}, strings.TrimSuffix(base, ".yaml"))
+	if base == "" || base == "_" {
+		base = "module"
+	}
+
+	taken := func(name string) bool {
+		owner, ok := used[name]
+		return ok && owner != rawRef
+	}
+	name := base + ".yaml"
+	for n := 2; taken(name); n++ {
+		name = fmt.Sprintf("%s-%d.yaml", base, n)
+	}
+	used[name] = rawRef
+	return name
+}
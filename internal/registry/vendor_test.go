@@ -0,0 +1,168 @@
+package registry
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/atomikpanda/dotular/internal/config"
+	"github.com/atomikpanda/dotular/internal/ui"
+)
+
+// seedCache writes data into the registry cache and lockfile so that Fetch
+// returns it without touching the network.
+func seedCache(t *testing.T, lock *LockFile, rawRef string, data []byte) {
+	t.Helper()
+	if err := writeCacheFile(moduleCachePath(rawRef), data); err != nil {
+		t.Fatal(err)
+	}
+	lock.Registry[rawRef] = LockEntry{
+		SHA256:    fmt.Sprintf("%x", sha256.Sum256(data)),
+		FetchedAt: time.Now().UTC(),
+		URL:       ParseRef(rawRef).FetchURL,
+	}
+}
+
+func TestVendor(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "dotular.yaml")
+
+	lock, _ := LoadLock(LockPath(configPath))
+	seedCache(t, lock, "neovim", []byte("name: neovim\nitems:\n  - package: neovim\n    via: brew\n"))
+	if err := SaveLock(LockPath(configPath), lock); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := config.Config{
+		Modules: []config.Module{
+			{Name: "local", Items: []config.Item{{Package: "git", Via: "brew"}}},
+			{From: "neovim", With: map[string]any{"x": "y"}},
+		},
+	}
+
+	u := ui.New(&bytes.Buffer{}, &bytes.Buffer{})
+	out, vendored, err := Vendor(context.Background(), cfg, configPath, false, u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(vendored) != 1 || vendored[0].Local != "./vendor/neovim.yaml" {
+		t.Fatalf("vendored = %+v", vendored)
+	}
+	if out.Modules[1].From != "./vendor/neovim.yaml" {
+		t.Errorf("From = %q", out.Modules[1].From)
+	}
+	if cfg.Modules[1].From != "neovim" {
+		t.Error("Vendor should not mutate the input config")
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, "vendor", "neovim.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), "package: neovim") {
+		t.Errorf("vendored content = %q", data)
+	}
+
+	// The rewritten config resolves without the registry.
+	resolved, err := Resolve(context.Background(), out, configPath, false, u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resolved.Modules[1].Name != "neovim" || len(resolved.Modules[1].Items) != 1 {
+		t.Errorf("resolved = %+v", resolved.Modules[1])
+	}
+}
+
+func TestVendorFileName(t *testing.T) {
+	used := make(map[string]string)
+	if got := vendorFileName("neovim", used); got != "neovim.yaml" {
+		t.Errorf("got %q", got)
+	}
+	if got := vendorFileName("github.com/user/dots/modules/neovim@v1", used); got != "neovim-2.yaml" {
+		t.Errorf("got %q", got)
+	}
+	if got := vendorFileName("github.com/user/repo", used); got != "repo.yaml" {
+		t.Errorf("got %q", got)
+	}
+	if got := vendorFileName("neovim", used); got != "neovim.yaml" {
+		t.Errorf("the same ref should reuse its name, got %q", got)
+	}
+}
+
+func TestVendorKeepsExistingFiles(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "dotular.yaml")
+	vendorDir := filepath.Join(dir, "vendor")
+
+	// A previous run vendored another module as neovim.yaml, and a file
+	// with no header was put in place by hand as tmux.yaml.
+	other := fmt.Sprintf(vendorHeader+"\nname: neovim\nitems: []\n", "github.com/user/dots/modules/neovim")
+	os.MkdirAll(vendorDir, 0o755)
+	os.WriteFile(filepath.Join(vendorDir, "neovim.yaml"), []byte(other), 0o644)
+	os.WriteFile(filepath.Join(vendorDir, "tmux.yaml"), []byte("name: tmux\nitems: []\n"), 0o644)
+
+	lock, _ := LoadLock(LockPath(configPath))
+	seedCache(t, lock, "neovim", []byte("name: neovim\nitems:\n  - package: neovim\n    via: brew\n"))
+	seedCache(t, lock, "tmux", []byte("name: tmux\nitems:\n  - package: tmux\n    via: brew\n"))
+	if err := SaveLock(LockPath(configPath), lock); err != nil {
+		t.Fatal(err)
+	}
+	cfg := config.Config{Modules: []config.Module{
+		{From: "./vendor/neovim.yaml"},
+		{From: "neovim"},
+		{From: "tmux"},
+	}}
+	u := ui.New(&bytes.Buffer{}, &bytes.Buffer{})
+	out, _, err := Vendor(context.Background(), cfg, configPath, false, u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.Modules[1].From != "./vendor/neovim-2.yaml" || out.Modules[2].From != "./vendor/tmux-2.yaml" {
+		t.Errorf("From = %q, %q", out.Modules[1].From, out.Modules[2].From)
+	}
+	if data, _ := os.ReadFile(filepath.Join(vendorDir, "neovim.yaml")); string(data) != other {
+		t.Errorf("existing vendored file was overwritten: %q", data)
+	}
+
+	// Vendoring the same refs again reuses their files.
+	out, _, err = Vendor(context.Background(), cfg, configPath, false, u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.Modules[1].From != "./vendor/neovim-2.yaml" {
+		t.Errorf("re-vendored From = %q", out.Modules[1].From)
+	}
+}
+
+func TestIsLocalRef(t *testing.T) {
+	tests := map[string]bool{
+		"./vendor/neovim.yaml": true,
+		"../shared/git.yaml":   true,
+		"/abs/module.yaml":     true,
+		"neovim":               false,
+		"github.com/user/repo": false,
+	}
+	for ref, want := range tests {
+		if got := IsLocalRef(ref); got != want {
+			t.Errorf("IsLocalRef(%q) = %v, want %v", ref, got, want)
+		}
+	}
+	if ParseRef("./vendor/x.yaml").Trust != Local {
+		t.Error("expected Local trust for local ref")
+	}
+}
+
+func TestLoadLocalMissing(t *testing.T) {
+	_, err := LoadLocal(filepath.Join(t.TempDir(), "dotular.yaml"), "./vendor/missing.yaml")
+	if err == nil {
+		t.Error("expected error for missing local module")
+	}
+}
@@ -0,0 +1,15 @@
+//go:build !windows
+
+package runlock
+
+import (
+	"errors"
+	"syscall"
+)
+
+// alive reports whether a process with pid exists. Signal 0 checks without
+// delivering anything; EPERM means it exists but belongs to another user.
+func alive(pid int) bool {
+	err := syscall.Kill(pid, 0)
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
@@ -0,0 +1,225 @@
+// Package runlock keeps two dotular runs against the same config from
+// applying at once, such as a scheduled apply and a manual one, by holding a
+// lock file that records the owning process.
+//
+// A lock whose process has exited is taken over by renaming a new lock over
+// it while holding an OS lock (flock, LockFileEx) on <lock>.takeover, so
+// only one of the runs that find it stale wins.
+package runlock
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/atomikpanda/dotular/internal/errs"
+)
+
+// pollInterval is how often a waiting Acquire retries the lock.
+var pollInterval = 500 * time.Millisecond
+
+// Info describes the process holding a lock.
+type Info struct {
+	PID     int       `json:"pid"`
+	Host    string    `json:"host"`
+	Command string    `json:"command"`
+	Started time.Time `json:"started"`
+}
+
+func (i Info) String() string {
+	if i.PID < 0 {
+		return "another dotular run"
+	}
+	return fmt.Sprintf("dotular %s (pid %d on %s, started %s)", i.Command, i.PID, i.Host, i.Started.Local().Format(time.DateTime))
+}
+
+// HeldError reports that another live process holds the lock at Path. It
+// matches errs.ErrLocked.
+type HeldError struct {
+	Path   string
+	Holder Info
+}
+
+func (e *HeldError) Error() string {
+	return fmt.Sprintf("%s is already running against this config (lock %s)", e.Holder, e.Path)
+}
+
+// Is reports whether target is errs.ErrLocked.
+func (e *HeldError) Is(target error) bool { return target == errs.ErrLocked }
+
+// Lock is a held lock file.
+type Lock struct {
+	path string
+	// TookOver describes the exited process whose lock was taken over, or
+	// is nil when the lock was free.
+	TookOver *Info
+}
+
+// Path returns the lock file for the config at configPath, one per config
+// under ~/.local/share/dotular/locks.
+func Path(configPath string) (string, error) {
+	abs, err := filepath.Abs(configPath)
+	if err != nil {
+		return "", err
+	}
+	if resolved, err := filepath.EvalSymlinks(abs); err == nil {
+		abs = resolved
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("resolve home dir: %w", err)
+	}
+	sum := sha256.Sum256([]byte(abs))
+	return filepath.Join(home, ".local", "share", "dotular", "locks", fmt.Sprintf("%x.lock", sum[:8])), nil
+}
+
+// Acquire takes the lock at path for command. If a live process holds it,
+// Acquire returns a *HeldError, unless onWait is non-nil: then it calls
+// onWait once with the holder and retries until the lock is free or ctx is
+// done. A lock left behind by a process on this host that has exited is
+// taken over; see takeOver.
+func Acquire(ctx context.Context, path, command string, onWait func(Info)) (*Lock, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("create lock directory: %w", err)
+	}
+	host, _ := os.Hostname()
+	self := Info{PID: os.Getpid(), Host: host, Command: command, Started: time.Now().UTC()}
+	data, err := json.Marshal(self)
+	if err != nil {
+		return nil, err
+	}
+
+	waiting := false
+	for {
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+		if err == nil {
+			_, werr := f.Write(data)
+			if cerr := f.Close(); werr == nil {
+				werr = cerr
+			}
+			if werr != nil {
+				os.Remove(path)
+				return nil, fmt.Errorf("write lock %s: %w", path, werr)
+			}
+			return &Lock{path: path}, nil
+		}
+		if !errors.Is(err, fs.ErrExist) {
+			return nil, fmt.Errorf("create lock %s: %w", path, err)
+		}
+
+		holder, err := read(path)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue // released between the create and the read
+		}
+		if err != nil {
+			return nil, err
+		}
+		if stale(holder, host) {
+			tookOver, err := takeOver(path, host, data)
+			if err != nil {
+				return nil, err
+			}
+			if tookOver != nil {
+				return &Lock{path: path, TookOver: tookOver}, nil
+			}
+			continue // another run took it over first, or it was released
+		}
+		if onWait == nil {
+			return nil, &HeldError{Path: path, Holder: holder}
+		}
+		if !waiting {
+			onWait(holder)
+			waiting = true
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(pollInterval):
+		}
+	}
+}
+
+// takeOver replaces the stale lock at path with one holding data and returns
+// the holder it replaced. Runs that find the same stale lock serialize on an
+// OS lock over path+".takeover" and re-read the lock under it, so only the
+// first replaces it; the others get a nil Info and retry against the new
+// holder. The new lock is renamed into place, so path never goes missing
+// for a run that is creating it.
+func takeOver(path, host string, data []byte) (*Info, error) {
+	guard, err := os.OpenFile(path+".takeover", os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("open lock guard: %w", err)
+	}
+	defer guard.Close()
+	if err := lockFile(guard); err != nil {
+		return nil, fmt.Errorf("lock %s: %w", guard.Name(), err)
+	}
+	defer unlockFile(guard)
+
+	holder, err := read(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !stale(holder, host) {
+		return nil, nil
+	}
+	tmp := fmt.Sprintf("%s.%d.tmp", path, os.Getpid())
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		os.Remove(tmp)
+		return nil, fmt.Errorf("write lock %s: %w", path, err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return nil, fmt.Errorf("replace stale lock %s: %w", path, err)
+	}
+	return &holder, nil
+}
+
+// Release removes the lock file.
+func (l *Lock) Release() error {
+	if err := os.Remove(l.path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// unreadableAfter is how long a lock file that cannot be parsed, as when its
+// owner died while writing it, is left alone before it is taken over.
+const unreadableAfter = time.Minute
+
+// read parses the lock file at path. A lock that cannot be parsed, perhaps
+// because it is still being written, has PID -1 and its mtime as Started.
+func read(path string) (Info, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Info{}, err
+	}
+	var info Info
+	if err := json.Unmarshal(data, &info); err != nil || info.PID <= 0 {
+		fi, err := os.Stat(path)
+		if err != nil {
+			return Info{}, err
+		}
+		return Info{PID: -1, Command: "run", Started: fi.ModTime()}, nil
+	}
+	return info, nil
+}
+
+// stale reports whether holder's lock can be taken over: its process has
+// exited, or the lock has been unreadable for unreadableAfter. Processes on
+// other hosts sharing the home directory cannot be checked and never are.
+func stale(holder Info, host string) bool {
+	if holder.PID < 0 {
+		return time.Since(holder.Started) > unreadableAfter
+	}
+	return holder.Host == host && !alive(holder.PID)
+}
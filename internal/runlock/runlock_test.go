@@ -0,0 +1,191 @@
+package runlock
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/atomikpanda/dotular/internal/errs"
+)
+
+func writeLock(t *testing.T, path string, info Info) {
+	t.Helper()
+	data, err := json.Marshal(info)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPath(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	a, err := Path("/repo/dotular.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := Path("/repo/./dotular.yaml")
+	c, _ := Path("/other/dotular.yaml")
+	if a != b || a == c {
+		t.Errorf("Path() = %s, %s, %s; want the first two equal and the third different", a, b, c)
+	}
+}
+
+func TestAcquireHeld(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "locks", "x.lock")
+	l, err := Acquire(ctx, path, "apply", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l.TookOver != nil {
+		t.Errorf("TookOver = %v for a free lock", l.TookOver)
+	}
+
+	_, err = Acquire(ctx, path, "sync", nil)
+	var held *HeldError
+	if !errors.As(err, &held) || !errors.Is(err, errs.ErrLocked) {
+		t.Fatalf("second Acquire err = %v, want a HeldError", err)
+	}
+	if held.Holder.PID != os.Getpid() || held.Holder.Command != "apply" {
+		t.Errorf("Holder = %+v", held.Holder)
+	}
+
+	if err := l.Release(); err != nil {
+		t.Fatal(err)
+	}
+	l, err = Acquire(ctx, path, "sync", nil)
+	if err != nil {
+		t.Fatalf("Acquire after Release: %v", err)
+	}
+	l.Release()
+}
+
+func TestAcquireStale(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Unix-only test")
+	}
+	cmd := exec.Command("true")
+	if err := cmd.Run(); err != nil {
+		t.Fatal(err)
+	}
+	host, _ := os.Hostname()
+	path := filepath.Join(t.TempDir(), "x.lock")
+	writeLock(t, path, Info{PID: cmd.Process.Pid, Host: host, Command: "apply", Started: time.Now()})
+
+	l, err := Acquire(context.Background(), path, "apply", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Release()
+	if l.TookOver == nil || l.TookOver.PID != cmd.Process.Pid {
+		t.Errorf("TookOver = %v, want pid %d", l.TookOver, cmd.Process.Pid)
+	}
+}
+
+func TestAcquireStaleConcurrent(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Unix-only test")
+	}
+	cmd := exec.Command("true")
+	if err := cmd.Run(); err != nil {
+		t.Fatal(err)
+	}
+	host, _ := os.Hostname()
+	path := filepath.Join(t.TempDir(), "x.lock")
+	writeLock(t, path, Info{PID: cmd.Process.Pid, Host: host, Command: "apply", Started: time.Now()})
+
+	const runs = 8
+	results := make(chan error, runs)
+	for i := 0; i < runs; i++ {
+		go func() {
+			_, err := Acquire(context.Background(), path, "apply", nil)
+			results <- err
+		}()
+	}
+	won := 0
+	for i := 0; i < runs; i++ {
+		if err := <-results; err == nil {
+			won++
+		} else if !errors.Is(err, errs.ErrLocked) {
+			t.Errorf("err = %v, want ErrLocked for the runs that lost", err)
+		}
+	}
+	if won != 1 {
+		t.Errorf("%d runs took over the stale lock, want 1", won)
+	}
+}
+
+func TestAcquireOtherHost(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "x.lock")
+	writeLock(t, path, Info{PID: 1 << 22, Host: "elsewhere", Command: "apply", Started: time.Now()})
+	if _, err := Acquire(context.Background(), path, "apply", nil); !errors.Is(err, errs.ErrLocked) {
+		t.Errorf("err = %v, want ErrLocked for another host's lock", err)
+	}
+}
+
+func TestAcquireUnreadable(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "x.lock")
+	if err := os.WriteFile(path, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Acquire(context.Background(), path, "apply", nil); !errors.Is(err, errs.ErrLocked) {
+		t.Fatalf("err = %v, want ErrLocked for a fresh unreadable lock", err)
+	}
+	old := time.Now().Add(-2 * unreadableAfter)
+	if err := os.Chtimes(path, old, old); err != nil {
+		t.Fatal(err)
+	}
+	l, err := Acquire(context.Background(), path, "apply", nil)
+	if err != nil {
+		t.Fatalf("err = %v, want an old unreadable lock taken over", err)
+	}
+	l.Release()
+}
+
+func TestAcquireWait(t *testing.T) {
+	pollInterval = 10 * time.Millisecond
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "x.lock")
+	first, err := Acquire(ctx, path, "apply", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	waited := 0
+	l, err := Acquire(ctx, path, "apply", func(Info) {
+		waited++
+		go func() {
+			time.Sleep(50 * time.Millisecond)
+			first.Release()
+		}()
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.Release()
+	if waited != 1 {
+		t.Errorf("onWait called %d times, want 1", waited)
+	}
+}
+
+func TestAcquireWaitCancelled(t *testing.T) {
+	pollInterval = 10 * time.Millisecond
+	path := filepath.Join(t.TempDir(), "x.lock")
+	first, err := Acquire(context.Background(), path, "apply", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer first.Release()
+	ctx, cancel := context.WithCancel(context.Background())
+	_, err = Acquire(ctx, path, "apply", func(Info) { cancel() })
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("err = %v, want context.Canceled", err)
+	}
+}
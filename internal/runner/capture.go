@@ -0,0 +1,117 @@
+package runner
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/atomikpanda/dotular/internal/actions"
+	"github.com/atomikpanda/dotular/internal/audit"
+)
+
+// CaptureResult describes what Capture did with a saved file.
+type CaptureResult struct {
+	Module string
+	Source string // repo-side path the file was pulled into
+	// Linked is set when the file is managed by a link item, so the save
+	// already landed in the repo and nothing was copied.
+	Linked bool
+}
+
+// Capture pulls the system file at path into the repo when a copied file
+// item, or a copied directory item containing it, manages it. It is meant
+// for editor save hooks. A nil result means no module that matches this
+// machine's tags manages path.
+func (r *Runner) Capture(ctx context.Context, path string) (*CaptureResult, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	abs = realPath(abs)
+	for _, mod := range r.Config.Modules {
+		if !r.matchesTags(mod) {
+			continue
+		}
+		items, err := r.Effective(mod)
+		if err != nil {
+			return nil, err
+		}
+		for _, ei := range items {
+			if ei.Skipped || ei.Destination == "" {
+				continue
+			}
+			dest := realPath(ei.Destination)
+			var action *actions.FileAction
+			switch ei.Type {
+			case "file":
+				if dest != abs {
+					continue
+				}
+				if ei.Link {
+					return &CaptureResult{Module: mod.Name, Source: ei.Source, Linked: true}, nil
+				}
+				built, _, err := r.buildAction(ei.Item, mod.Name)
+				if err != nil {
+					return nil, fmt.Errorf("module %q: %w", mod.Name, err)
+				}
+				pull := *built.(*actions.FileAction)
+				pull.Direction = "pull"
+				action = &pull
+			case "directory":
+				rel, err := filepath.Rel(dest, abs)
+				if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+					continue
+				}
+				if ei.Link {
+					return &CaptureResult{Module: mod.Name, Source: filepath.Join(ei.Source, rel), Linked: true}, nil
+				}
+				// A destination ending in "/" is always a directory, so the
+				// pull targets abs itself.
+				action = &actions.FileAction{
+					Source:      filepath.Join(ei.Source, rel),
+					Destination: filepath.Dir(abs) + "/",
+					Direction:   "pull",
+				}
+			default:
+				continue
+			}
+			return &CaptureResult{Module: mod.Name, Source: action.RepoPath()}, r.runCapture(ctx, mod.Name, action)
+		}
+	}
+	return nil, nil
+}
+
+// runCapture pulls a single file and records it in the audit log. It holds
+// the config's run lock, so the pull cannot interleave with an apply.
+func (r *Runner) runCapture(ctx context.Context, module string, action *actions.FileAction) error {
+	if !r.DryRun && r.ConfigPath != "" {
+		l, err := r.lock(ctx)
+		if err != nil {
+			return err
+		}
+		defer l.Release()
+	}
+	ctx = actions.WithReporter(ctx, r.reporter(r.UI.Out))
+	start := time.Now()
+	err := action.Run(ctx, r.DryRun)
+	if r.DryRun {
+		return err
+	}
+	entry := audit.Entry{Command: r.Command, Module: module, Item: action.Describe(), Outcome: "success", DurationMS: time.Since(start).Milliseconds()}
+	if err != nil {
+		entry.Outcome, entry.Error = "failure", err.Error()
+	}
+	audit.Log(entry)
+	return err
+}
+
+// realPath resolves symlinks in p so that paths reached through different
+// links compare equal. Paths that cannot be resolved are returned as is.
+func realPath(p string) string {
+	if resolved, err := filepath.EvalSymlinks(p); err == nil {
+		return resolved
+	}
+	return p
+}
@@ -0,0 +1,63 @@
+package runner
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/atomikpanda/dotular/internal/config"
+)
+
+func TestCapture(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	repo := t.TempDir()
+	dest := t.TempDir()
+	wd, _ := os.Getwd()
+	os.Chdir(repo)
+	t.Cleanup(func() { os.Chdir(wd) })
+	os.MkdirAll(filepath.Join(repo, "shell"), 0o755)
+	os.MkdirAll(filepath.Join(repo, "nvim", "nvim", "lua"), 0o755)
+	os.WriteFile(filepath.Join(repo, "shell", ".zshrc"), []byte("old"), 0o644)
+	os.WriteFile(filepath.Join(repo, "nvim", "nvim", "lua", "opts.lua"), []byte("old"), 0o644)
+	os.MkdirAll(filepath.Join(dest, "nvim", "lua"), 0o755)
+	os.WriteFile(filepath.Join(dest, ".zshrc"), []byte("saved"), 0o644)
+	os.WriteFile(filepath.Join(dest, "nvim", "lua", "opts.lua"), []byte("saved"), 0o644)
+	os.WriteFile(filepath.Join(dest, "other"), []byte("saved"), 0o644)
+
+	cfg := config.Config{Modules: []config.Module{
+		{Name: "shell", Items: []config.Item{{File: ".zshrc", Destination: config.PlatformMap{MacOS: dest + "/"}}}},
+		{Name: "nvim", Items: []config.Item{{Directory: "nvim", Destination: config.PlatformMap{MacOS: dest}}}},
+	}}
+	r := newTestRunner(cfg)
+	r.DryRun = false
+	r.Command = "pull"
+	r.Root = repo
+
+	res, err := r.Capture(context.Background(), filepath.Join(dest, ".zshrc"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res == nil || res.Module != "shell" || res.Linked {
+		t.Fatalf("file capture = %+v, want module shell", res)
+	}
+	if data, _ := os.ReadFile(filepath.Join(repo, "shell", ".zshrc")); string(data) != "saved" {
+		t.Errorf("repo .zshrc = %q, want the saved content", data)
+	}
+
+	res, err = r.Capture(context.Background(), filepath.Join(dest, "nvim", "lua", "opts.lua"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := filepath.Join(repo, "nvim", "nvim", "lua", "opts.lua"); res == nil || res.Module != "nvim" || realPath(res.Source) != realPath(want) {
+		t.Fatalf("directory capture = %+v, want module nvim into %s", res, want)
+	}
+	if data, _ := os.ReadFile(filepath.Join(repo, "nvim", "nvim", "lua", "opts.lua")); string(data) != "saved" {
+		t.Errorf("repo opts.lua = %q, want the saved content", data)
+	}
+
+	res, err = r.Capture(context.Background(), filepath.Join(dest, "other"))
+	if err != nil || res != nil {
+		t.Errorf("unmanaged capture = %+v, %v; want nil, nil", res, err)
+	}
+}
@@ -0,0 +1,117 @@
+package runner
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/atomikpanda/dotular/internal/state"
+)
+
+// CleanResult is the outcome of cleaning one orphaned resource.
+type CleanResult struct {
+	Resource state.Resource
+	Removed  bool   // the resource was deleted from the system
+	Reason   string // why it was kept, or "" when removed/forgotten
+}
+
+// DeclaredResources returns the state keys of every resource the config
+// declares for this platform. Tag filters, when, and skip_if are ignored so
+// that conditionally skipped items never count as orphans.
+func (r *Runner) DeclaredResources() map[string]bool {
+	declared := make(map[string]bool)
+	for _, mod := range r.Config.Modules {
+		items, err := r.expandItems(mod)
+		if err != nil {
+			items = mod.Items
+		}
+		for _, item := range items {
+			action, skip, err := r.buildAction(item, mod.Name)
+			if err != nil || skip {
+				continue
+			}
+			if res, ok := resourceFor(mod.Name, action); ok {
+				declared[res.Key()] = true
+			}
+		}
+	}
+	return declared
+}
+
+// Orphans returns resources recorded for this config that no longer
+// correspond to any of its items.
+func (r *Runner) Orphans() []state.Resource {
+	if r.State == nil {
+		return nil
+	}
+	return r.State.Orphans(r.configKey(), r.DeclaredResources())
+}
+
+// Clean removes orphaned files, symlinks, and binaries and forgets them in the
+// state file. Files whose content changed since dotular deployed them,
+// symlinks that no longer point at the recorded source, directories, and
+// packages are left in place and reported with a reason. Like an apply, it
+// holds the config's run lock.
+func (r *Runner) Clean(ctx context.Context, orphans []state.Resource) ([]CleanResult, error) {
+	if r.ConfigPath != "" {
+		l, err := r.lock(ctx)
+		if err != nil {
+			return nil, err
+		}
+		defer l.Release()
+	}
+	results := make([]CleanResult, 0, len(orphans))
+	for _, res := range orphans {
+		removed, reason := removeResource(res)
+		if reason == "" {
+			r.State.Remove(res.Key())
+		}
+		results = append(results, CleanResult{Resource: res, Removed: removed, Reason: reason})
+	}
+	r.saveState()
+	return results, nil
+}
+
+// removeResource deletes res from the system when it is safe to do so. A
+// resource that is already gone is reported as not removed with no reason, so
+// it is simply forgotten.
+func removeResource(res state.Resource) (removed bool, reason string) {
+	switch res.Kind {
+	case state.KindPackage:
+		return false, "packages are not uninstalled"
+	case state.KindDirectory:
+		return false, "directories are not removed; delete it manually"
+	}
+
+	info, err := os.Lstat(res.Path)
+	if os.IsNotExist(err) {
+		return false, ""
+	}
+	if err != nil {
+		return false, err.Error()
+	}
+
+	switch res.Kind {
+	case state.KindSymlink:
+		if info.Mode()&os.ModeSymlink == 0 {
+			return false, "no longer a symlink"
+		}
+		if dest, _ := os.Readlink(res.Path); res.Source != "" && dest != res.Source {
+			return false, fmt.Sprintf("points to %s, not %s", dest, res.Source)
+		}
+	case state.KindFile, state.KindBinary:
+		if !info.Mode().IsRegular() {
+			return false, "no longer a regular file"
+		}
+		if res.Hash != "" {
+			if h, err := state.HashFile(res.Path); err != nil || h != res.Hash {
+				return false, "modified since dotular deployed it"
+			}
+		}
+	}
+
+	if err := os.Remove(res.Path); err != nil {
+		return false, err.Error()
+	}
+	return true, ""
+}
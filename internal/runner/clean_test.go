@@ -0,0 +1,117 @@
+package runner
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/atomikpanda/dotular/internal/config"
+	"github.com/atomikpanda/dotular/internal/state"
+)
+
+func TestOrphans(t *testing.T) {
+	cfg := config.Config{Modules: []config.Module{{
+		Name:  "m",
+		Items: []config.Item{{Package: "git", Via: "brew"}},
+	}}}
+	r := newTestRunner(cfg)
+	r.State = state.New()
+	r.State.Record(state.Resource{Kind: state.KindPackage, Package: "git", Manager: "brew", Module: "m"})
+	r.State.Record(state.Resource{Kind: state.KindPackage, Package: "wget", Manager: "brew", Module: "m"})
+
+	orphans := r.Orphans()
+	if len(orphans) != 1 || orphans[0].Package != "wget" {
+		t.Errorf("orphans = %+v", orphans)
+	}
+}
+
+func TestOrphansScopedToConfig(t *testing.T) {
+	dir := t.TempDir()
+	r := newTestRunner(config.Config{})
+	r.ConfigPath = filepath.Join(dir, "work.yaml")
+	r.State = state.New()
+	r.State.Record(state.Resource{Kind: state.KindPackage, Package: "wget", Manager: "brew", Module: "m", Config: r.ConfigPath})
+	r.State.Record(state.Resource{Kind: state.KindPackage, Package: "jq", Manager: "brew", Module: "m", Config: filepath.Join(dir, "home.yaml")})
+
+	orphans := r.Orphans()
+	if len(orphans) != 1 || orphans[0].Package != "wget" {
+		t.Errorf("orphans = %+v, want only the resource from this config", orphans)
+	}
+}
+
+func TestClean(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		p := filepath.Join(dir, name)
+		os.WriteFile(p, []byte(content), 0o644)
+		return p
+	}
+	hash := func(p string) string {
+		h, _ := state.HashFile(p)
+		return h
+	}
+
+	unchanged := write("unchanged", "a")
+	modified := write("modified", "b")
+	modifiedHash := hash(modified)
+	os.WriteFile(modified, []byte("edited"), 0o644)
+	src := write("src", "c")
+	link := filepath.Join(dir, "link")
+	os.Symlink(src, link)
+
+	orphans := []state.Resource{
+		{Kind: state.KindFile, Path: unchanged, Hash: hash(unchanged)},
+		{Kind: state.KindFile, Path: modified, Hash: modifiedHash},
+		{Kind: state.KindSymlink, Path: link, Source: src},
+		{Kind: state.KindBinary, Path: filepath.Join(dir, "gone")},
+		{Kind: state.KindPackage, Package: "wget", Manager: "brew"},
+	}
+
+	r := newTestRunner(config.Config{})
+	r.DryRun = false
+	r.State = state.New()
+	for _, o := range orphans {
+		r.State.Record(o)
+	}
+	r.StatePath = filepath.Join(dir, "state.json")
+
+	results, err := r.Clean(context.Background(), orphans)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []struct {
+		removed  bool
+		kept     bool
+		onSystem bool
+	}{
+		{true, false, false},
+		{false, true, true},
+		{true, false, false},
+		{false, false, false},
+		{false, true, false},
+	}
+	for i, w := range want {
+		res := results[i]
+		if res.Removed != w.removed || (res.Reason != "") != w.kept {
+			t.Errorf("%s: removed=%v reason=%q", res.Resource.Key(), res.Removed, res.Reason)
+		}
+		if res.Resource.Path != "" {
+			_, err := os.Lstat(res.Resource.Path)
+			if (err == nil) != w.onSystem {
+				t.Errorf("%s: on system = %v, want %v", res.Resource.Key(), err == nil, w.onSystem)
+			}
+		}
+	}
+	if _, err := os.Stat(src); err != nil {
+		t.Error("clean must not touch a symlink's source")
+	}
+
+	saved, err := state.Load(r.StatePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(saved.Resources) != 2 {
+		t.Errorf("state keeps %d resources, want the 2 kept ones", len(saved.Resources))
+	}
+}
@@ -0,0 +1,195 @@
+package runner
+
+import (
+	"github.com/atomikpanda/dotular/internal/actions"
+	"github.com/atomikpanda/dotular/internal/state"
+)
+
+// Drift statuses for copied (non-link) file and directory items.
+const (
+	DriftInSync     = "in sync"
+	DriftSystem     = "drifted"      // the system copy was edited after apply
+	DriftRepo       = "repo changed" // the repo copy changed after apply
+	DriftBoth       = "both changed"
+	DriftUnknown    = "differs" // the copies differ but there is no record of which moved
+	DriftNotApplied = "not applied"
+)
+
+// DriftResult reports whether one copied file or directory item has diverged
+// from what was deployed.
+type DriftResult struct {
+	Module string
+	Target string // system path
+	Source string // repo path
+	Status string
+}
+
+// Drift compares every copied file and directory item in the config that
+// matches this machine's tags against the content hashes recorded at apply
+// time. Directories are hashed as whole trees, with unchanged files served
+// from Runner.Hashes. Link and
+// pull-direction items are not checked: a symlink cannot drift, and pull
+// items are never deployed to the system.
+func (r *Runner) Drift() []DriftResult {
+	var out []DriftResult
+	for _, mod := range r.Config.Modules {
+		if !r.matchesTags(mod) {
+			continue
+		}
+		items, err := r.expandItems(mod)
+		if err != nil {
+			continue
+		}
+		for _, item := range items {
+			if t := item.Type(); (t != "file" && t != "directory") || item.Link || item.EffectiveDirection() == "pull" {
+				continue
+			}
+			if ok, err := r.whenMatches(item); err != nil || !ok {
+				continue
+			}
+			action, skip, err := r.buildAction(item, mod.Name)
+			if err != nil || skip {
+				continue
+			}
+			switch a := action.(type) {
+			case *actions.FileAction:
+				out = append(out, r.fileDrift(mod.Name, a))
+			case *actions.DirectoryAction:
+				out = append(out, r.dirDrift(mod.Name, a))
+			}
+		}
+	}
+	r.savePlainHashes()
+	if err := r.Hashes.Save(); err != nil {
+		r.UI.Warn("save hash cache: " + err.Error())
+	}
+	return out
+}
+
+func (r *Runner) fileDrift(module string, fa *actions.FileAction) DriftResult {
+	target := fa.ResolvedTarget()
+	result := DriftResult{Module: module, Target: target, Source: fa.RepoPath()}
+
+	sysHash, err := r.Hashes.HashFile(target)
+	if err != nil {
+		result.Status = DriftNotApplied
+		return result
+	}
+	repoHash, _ := r.Hashes.HashFile(result.Source)
+	rec, recorded := r.recorded(module, fa)
+
+	if fa.Encrypted {
+		if plain, ok := r.plainHash(fa, repoHash); ok {
+			result.Status = encryptedDrift(sysHash, plain, rec, recorded)
+			return result
+		}
+	}
+	result.Status = hashDrift(sysHash, repoHash, rec, recorded, fa.Encrypted)
+	return result
+}
+
+func (r *Runner) dirDrift(module string, da *actions.DirectoryAction) DriftResult {
+	target := da.ResolvedTarget()
+	result := DriftResult{Module: module, Target: target, Source: da.Source}
+
+	sysHash, err := r.Hashes.HashTreeLimit(target, da.MaxFileSize)
+	if err != nil {
+		result.Status = DriftNotApplied
+		return result
+	}
+	repoHash, _ := r.Hashes.HashTreeLimit(da.Source, da.MaxFileSize)
+	rec, recorded := r.recorded(module, da)
+	result.Status = hashDrift(sysHash, repoHash, rec, recorded, false)
+	return result
+}
+
+// recorded returns the state file's record of action, if any.
+func (r *Runner) recorded(module string, action actions.Action) (state.Resource, bool) {
+	if r.State == nil {
+		return state.Resource{}, false
+	}
+	res, ok := resourceFor(module, action)
+	if !ok {
+		return state.Resource{}, false
+	}
+	rec, ok := r.State.Resources[res.Key()]
+	return rec, ok
+}
+
+// hashDrift classifies a copied item from the current system and repo
+// hashes and the hashes recorded when it was applied. Plain copies can be
+// compared directly; encrypted ones whose plaintext is unknown only through
+// the recorded hashes, since the ciphertext never matches the system copy.
+func hashDrift(sysHash, repoHash string, rec state.Resource, recorded, encrypted bool) string {
+	if !encrypted && sysHash == repoHash {
+		return DriftInSync
+	}
+	if !recorded || rec.Hash == "" || rec.SourceHash == "" {
+		return DriftUnknown
+	}
+
+	sysMoved := sysHash != rec.Hash
+	repoMoved := repoHash != rec.SourceHash
+	switch {
+	case sysMoved && repoMoved:
+		return DriftBoth
+	case sysMoved:
+		return DriftSystem
+	case repoMoved:
+		return DriftRepo
+	case encrypted:
+		return DriftInSync
+	default:
+		// Neither side moved but they differ, e.g. a sync conflict that was
+		// skipped.
+		return DriftUnknown
+	}
+}
+
+// plainHash returns the plaintext hash of an encrypted repo file whose
+// ciphertext hashes to cipherHash. Known hashes come from the state file;
+// otherwise the file is decrypted when an age key is available and the
+// result remembered.
+func (r *Runner) plainHash(fa *actions.FileAction, cipherHash string) (string, bool) {
+	if cipherHash == "" {
+		return "", false
+	}
+	if r.State != nil {
+		if h, ok := r.State.PlainHash(cipherHash); ok {
+			return h, true
+		}
+	}
+	if fa.AgeKey == nil {
+		return "", false
+	}
+	h, err := fa.PlaintextHash()
+	if err != nil {
+		return "", false
+	}
+	if r.State != nil {
+		r.State.RememberPlainHash(cipherHash, h)
+		r.plainHashesChanged = true
+	}
+	return h, true
+}
+
+// encryptedDrift classifies an encrypted item whose repo plaintext hash is
+// known, using the recorded deployment to tell which side moved.
+func encryptedDrift(sysHash, plain string, rec state.Resource, recorded bool) string {
+	if sysHash == plain {
+		return DriftInSync
+	}
+	if !recorded || rec.Hash == "" {
+		return DriftUnknown
+	}
+	sysMoved := sysHash != rec.Hash
+	repoMoved := plain != rec.Hash
+	switch {
+	case sysMoved && repoMoved:
+		return DriftBoth
+	case sysMoved:
+		return DriftSystem
+	default:
+		return DriftRepo
+	}
+}
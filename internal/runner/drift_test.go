@@ -0,0 +1,190 @@
+package runner
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/atomikpanda/dotular/internal/ageutil"
+	"github.com/atomikpanda/dotular/internal/config"
+	"github.com/atomikpanda/dotular/internal/state"
+)
+
+// driftKind selects what driftFixture's module deploys.
+type driftKind string
+
+const (
+	driftFile      driftKind = "file"      // a copied file, beside a linked one that is not checked
+	driftEncrypted driftKind = "encrypted" // an encrypted file
+	driftDir       driftKind = "directory" // a copied directory
+)
+
+// driftEnv is a module set up by driftFixture. setRepo and setSystem
+// rewrite the repo copy (re-encrypting a secret) and the deployed copy; for
+// a directory item they rewrite the file init.lua inside it.
+type driftEnv struct {
+	r         *Runner
+	setRepo   func(content string)
+	setSystem func(content string)
+}
+
+// driftFixture sets up a module with one item of the given kind whose repo
+// copy holds "v1", in a repo that is the working directory.
+func driftFixture(t *testing.T, kind driftKind) driftEnv {
+	t.Helper()
+	repo := t.TempDir()
+	dest := t.TempDir()
+	wd, _ := os.Getwd()
+	os.Chdir(repo)
+	t.Cleanup(func() { os.Chdir(wd) })
+	write := func(path, content string) {
+		os.MkdirAll(filepath.Dir(path), 0o755)
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var env driftEnv
+	var mod config.Module
+	var key *ageutil.Key
+	switch kind {
+	case driftFile:
+		mod = config.Module{Name: "dots", Items: []config.Item{
+			{File: "rc", Destination: config.PlatformMap{MacOS: dest + "/"}},
+			{File: "linked", Link: true, Destination: config.PlatformMap{MacOS: dest + "/"}},
+		}}
+		env.setRepo = func(c string) { write(filepath.Join(repo, "dots", "rc"), c) }
+		env.setSystem = func(c string) { write(filepath.Join(dest, "rc"), c) }
+	case driftEncrypted:
+		key = &ageutil.Key{Passphrase: "drift-test"}
+		mod = config.Module{Name: "secrets", Items: []config.Item{
+			{File: "secret", Encrypted: true, Destination: config.PlatformMap{MacOS: dest + "/"}},
+		}}
+		env.setRepo = func(c string) {
+			plain := filepath.Join(t.TempDir(), "secret")
+			write(plain, c)
+			os.MkdirAll(filepath.Join(repo, "secrets"), 0o755)
+			if err := key.EncryptFile(plain, filepath.Join(repo, "secrets", "secret.age")); err != nil {
+				t.Fatal(err)
+			}
+		}
+		env.setSystem = func(c string) { write(filepath.Join(dest, "secret"), c) }
+	case driftDir:
+		mod = config.Module{Name: "nvim", Items: []config.Item{
+			{Directory: "nvim", Destination: config.PlatformMap{MacOS: dest}},
+		}}
+		write(filepath.Join(repo, "nvim", "nvim", "lua", "opts.lua"), "opts")
+		env.setRepo = func(c string) { write(filepath.Join(repo, "nvim", "nvim", "init.lua"), c) }
+		env.setSystem = func(c string) { write(filepath.Join(dest, "nvim", "init.lua"), c) }
+	}
+	env.setRepo("v1")
+
+	env.r = newTestRunner(config.Config{Modules: []config.Module{mod}})
+	env.r.DryRun = false
+	env.r.AgeKey = key
+	env.r.State = state.New()
+	env.r.Hashes = state.LoadHashCache(filepath.Join(t.TempDir(), "hashes.json"))
+	return env
+}
+
+// applyDrift applies the copied file item only.
+func applyDrift(t *testing.T, r *Runner) {
+	t.Helper()
+	mod := r.Config.Modules[0]
+	mod.Items = mod.Items[:1]
+	if err := r.ApplyModules(context.Background(), []config.Module{mod}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func driftStatus(t *testing.T, r *Runner) string {
+	t.Helper()
+	results := r.Drift()
+	if len(results) != 1 {
+		t.Fatalf("got %d drift results, want 1 (link items are not checked): %+v", len(results), results)
+	}
+	return results[0].Status
+}
+
+func TestDrift(t *testing.T) {
+	all := []driftKind{driftFile, driftEncrypted, driftDir}
+	tests := []struct {
+		name         string
+		kinds        []driftKind
+		apply        bool
+		repo, system string // new contents after the apply, if set
+		want         string
+	}{
+		{"not applied", all, false, "", "", DriftNotApplied},
+		{"in sync", all, true, "", "", DriftInSync},
+		{"system edited", all, true, "", "local edit", DriftSystem},
+		{"repo changed", all, true, "v2", "", DriftRepo},
+		{"both changed", all, true, "v2", "local edit", DriftBoth},
+		{"unrecorded", []driftKind{driftFile}, false, "", "pre-existing", DriftUnknown},
+		{"unrecorded but matching", []driftKind{driftEncrypted}, false, "", "v1", DriftInSync},
+		// Re-encrypting produces new ciphertext for the same secret.
+		{"re-encrypted", []driftKind{driftEncrypted}, true, "v1", "", DriftInSync},
+	}
+	for _, tt := range tests {
+		for _, kind := range tt.kinds {
+			t.Run(string(kind)+"/"+tt.name, func(t *testing.T) {
+				env := driftFixture(t, kind)
+				if tt.apply {
+					applyDrift(t, env.r)
+				}
+				if tt.repo != "" {
+					env.setRepo(tt.repo)
+				}
+				if tt.system != "" {
+					env.setSystem(tt.system)
+				}
+				if got := driftStatus(t, env.r); got != tt.want {
+					t.Errorf("status = %q, want %q", got, tt.want)
+				}
+			})
+		}
+	}
+}
+
+func TestEncryptedDriftUsesCachedPlainHash(t *testing.T) {
+	r := driftFixture(t, driftEncrypted).r
+	applyDrift(t, r)
+	// Without a key the recorded plaintext hash still answers the question.
+	r.AgeKey = nil
+	if got := driftStatus(t, r); got != DriftInSync {
+		t.Errorf("status = %q, want %q", got, DriftInSync)
+	}
+}
+
+func TestEncryptedDriftRemembersPlainHash(t *testing.T) {
+	env := driftFixture(t, driftEncrypted)
+	r := env.r
+	env.setSystem("v1")
+	if got := driftStatus(t, r); got != DriftInSync {
+		t.Errorf("status = %q, want %q", got, DriftInSync)
+	}
+	if len(r.State.PlainHashes) != 1 {
+		t.Errorf("PlainHashes = %v, want the decrypted hash remembered", r.State.PlainHashes)
+	}
+}
+
+func TestVerifyReportsStaleSecret(t *testing.T) {
+	env := driftFixture(t, driftEncrypted)
+	r := env.r
+	applyDrift(t, r)
+	mod := r.Config.Modules[0]
+
+	passed, err := r.VerifyModule(context.Background(), mod)
+	if err != nil || !passed {
+		t.Fatalf("fresh secret: passed=%v err=%v", passed, err)
+	}
+	env.setRepo("v2")
+	passed, err = r.VerifyModule(context.Background(), mod)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if passed {
+		t.Error("expected verify to fail for a secret changed in the repo")
+	}
+}
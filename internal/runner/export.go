@@ -0,0 +1,120 @@
+package runner
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/atomikpanda/dotular/internal/actions"
+	"github.com/atomikpanda/dotular/internal/config"
+	"github.com/atomikpanda/dotular/internal/export"
+)
+
+// ExportSteps returns the file copies, links, and package installs of the
+// modules in mods on this OS, for `dotular export script`. With filterTags,
+// modules that do not match the machine's tags are left out, as ApplyAll
+// does. Items a script cannot reproduce, such as encrypted files or
+// settings, are returned as notes.
+func (r *Runner) ExportSteps(mods []config.Module, filterTags bool) ([]export.Step, error) {
+	var steps []export.Step
+	for _, mod := range mods {
+		if filterTags && !r.matchesTags(mod) {
+			continue
+		}
+		items, err := r.Effective(mod)
+		if err != nil {
+			return nil, err
+		}
+		for _, ei := range items {
+			if ei.Skipped {
+				continue
+			}
+			action, _, err := r.buildAction(ei.Item, mod.Name)
+			if err != nil {
+				return nil, fmt.Errorf("module %q: %w", mod.Name, err)
+			}
+			step, err := r.exportStep(action)
+			if err != nil {
+				return nil, fmt.Errorf("module %q: %w", mod.Name, err)
+			}
+			step.Module = mod.Name
+			steps = append(steps, step)
+		}
+	}
+	return steps, nil
+}
+
+// exportStep converts one action into a script step.
+func (r *Runner) exportStep(action actions.Action) (export.Step, error) {
+	note := export.Step{Kind: export.KindNote, Note: action.Describe()}
+	switch a := action.(type) {
+	case *actions.FileAction:
+		switch {
+		case a.Encrypted:
+			note.Note += " (encrypted)"
+			return note, nil
+		case !a.Link && a.Direction == "pull":
+			return note, nil
+		}
+		if _, err := strconv.ParseUint(a.Permissions, 8, 32); a.Permissions != "" && err != nil {
+			return export.Step{}, fmt.Errorf("invalid permissions %q for %s", a.Permissions, a.Source)
+		}
+		step := export.Step{Kind: export.KindCopyFile, Source: r.exportSource(a.Source), Target: exportTarget(a.ResolvedTarget()), Mode: a.Permissions}
+		if a.Link {
+			step.Kind, step.Mode = export.KindLink, ""
+		}
+		return step, nil
+	case *actions.DirectoryAction:
+		if !a.Link && a.Direction == "pull" {
+			return note, nil
+		}
+		step := export.Step{Kind: export.KindCopyDir, Source: r.exportSource(a.Source), Target: exportTarget(a.ResolvedTarget())}
+		if a.Link {
+			step.Kind = export.KindLink
+		}
+		return step, nil
+	case *actions.PackageAction:
+		cmds, err := a.ScriptCommands()
+		if err != nil {
+			return export.Step{}, err
+		}
+		return export.Step{
+			Kind:     export.KindCommands,
+			Check:    actions.CheckArgs(a.Manager, a.Package),
+			Commands: cmds,
+			Package:  a.Package,
+			Manager:  a.Manager,
+		}, nil
+	}
+	return note, nil
+}
+
+// exportSource returns a repo path relative to the repo root.
+func (r *Runner) exportSource(path string) string {
+	root := r.Root
+	if root == "" {
+		root = "."
+	}
+	if rel, err := filepath.Rel(root, path); err == nil {
+		return filepath.ToSlash(rel)
+	}
+	return filepath.ToSlash(path)
+}
+
+// exportTarget rewrites a path under the home directory as "~/...", so the
+// script installs into the home directory of whoever runs it.
+func exportTarget(path string) string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return path
+	}
+	if path == home {
+		return "~"
+	}
+	if rest, ok := strings.CutPrefix(path, home+string(filepath.Separator)); ok {
+		return "~/" + filepath.ToSlash(rest)
+	}
+	return path
+}
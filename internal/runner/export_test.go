@@ -0,0 +1,60 @@
+package runner
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/atomikpanda/dotular/internal/config"
+	"github.com/atomikpanda/dotular/internal/export"
+)
+
+func TestExportSteps(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	repo := t.TempDir()
+	cfg := config.Config{Modules: []config.Module{
+		{Name: "shell", Items: []config.Item{
+			{File: ".zshrc", Destination: config.PlatformMap{MacOS: "~/"}, Permissions: "0600"},
+			{File: "secret", Destination: config.PlatformMap{MacOS: "~/"}, Encrypted: true},
+			{File: ".inputrc", Destination: config.PlatformMap{MacOS: "~/"}, Link: true},
+			{Directory: "nvim", Destination: config.PlatformMap{MacOS: "~/.config"}},
+			{File: "linux-only", Destination: config.PlatformMap{Linux: "~/"}},
+			{Package: "ripgrep", Via: "brew"},
+			{Run: "echo hi"},
+		}},
+		{Name: "work", OnlyTags: []string{"work"}, Items: []config.Item{{Package: "slack", Via: "brew-cask"}}},
+	}}
+	r := newTestRunner(cfg)
+	r.Root = repo
+
+	steps, err := r.ExportSteps(cfg.Modules, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []export.Step{
+		{Module: "shell", Kind: export.KindCopyFile, Source: "shell/.zshrc", Target: "~/.zshrc", Mode: "0600"},
+		{Module: "shell", Kind: export.KindNote},
+		{Module: "shell", Kind: export.KindLink, Source: "shell/.inputrc", Target: "~/.inputrc"},
+		{Module: "shell", Kind: export.KindCopyDir, Source: "shell/nvim", Target: "~/.config/nvim"},
+		{Module: "shell", Kind: export.KindCommands, Check: []string{"brew", "list", "--formula", "ripgrep"}, Commands: [][]string{{"brew", "install", "ripgrep"}}},
+		{Module: "shell", Kind: export.KindNote},
+	}
+	if len(steps) != len(want) {
+		t.Fatalf("got %d steps, want %d: %+v", len(steps), len(want), steps)
+	}
+	for i, w := range want {
+		got := steps[i]
+		if got.Kind == export.KindNote && got.Note != "" {
+			got.Note = ""
+		}
+		if got.Module != w.Module || got.Kind != w.Kind || got.Source != w.Source || got.Target != w.Target ||
+			got.Mode != w.Mode || !slices.Equal(got.Check, w.Check) || len(got.Commands) != len(w.Commands) {
+			t.Errorf("step %d = %+v, want %+v", i, steps[i], w)
+		}
+	}
+
+	named, err := r.ExportSteps(cfg.Modules[1:], false)
+	if err != nil || len(named) != 1 || named[0].Module != "work" {
+		t.Errorf("named module export = %+v, %v; want work regardless of tags", named, err)
+	}
+}
@@ -0,0 +1,67 @@
+package runner
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/atomikpanda/dotular/internal/actions"
+	"github.com/atomikpanda/dotular/internal/color"
+	"github.com/atomikpanda/dotular/internal/config"
+)
+
+// extensionAction builds the action for an extension item. Pulling (with
+// `dotular pull` or direction: pull) captures the installed extensions into
+// the item in the config file.
+func (r *Runner) extensionAction(item config.Item, moduleName ...string) *actions.ExtensionAction {
+	editor := item.Via
+	if editor == "" {
+		editor = "vscode"
+	}
+	exts := item.Extensions
+	if item.Extension != "" {
+		exts = []string{item.Extension}
+	}
+	a := &actions.ExtensionAction{Extensions: exts, Editor: editor}
+	if r.fileDirection(item) == "pull" {
+		module := ""
+		if len(moduleName) > 0 {
+			module = moduleName[0]
+		}
+		a.Pull = true
+		a.Capture = func(ctx context.Context, installed []string, dryRun bool) error {
+			return r.captureExtensions(module, item, installed, dryRun)
+		}
+	}
+	return a
+}
+
+// captureExtensions replaces the extensions of item, found in module in the
+// config file by its editor and primary value, with installed.
+func (r *Runner) captureExtensions(module string, item config.Item, installed []string, dryRun bool) error {
+	if r.ConfigPath == "" {
+		return fmt.Errorf("no config file to record extensions in")
+	}
+	if dryRun {
+		if r.UI.Quiet() {
+			return nil
+		}
+		fmt.Fprintf(r.UI.Out, "    %s\n", color.Dim(fmt.Sprintf("[dry-run] record %d extensions in %s", len(installed), r.ConfigPath)))
+		return nil
+	}
+	cfg, err := config.Load(r.ConfigPath)
+	if err != nil {
+		return err
+	}
+	mod := cfg.Module(module)
+	if mod == nil {
+		return fmt.Errorf("module %q is not defined in %s", module, r.ConfigPath)
+	}
+	for i := range mod.Items {
+		it := &mod.Items[i]
+		if it.Type() == "extension" && it.Via == item.Via && it.PrimaryValue() == item.PrimaryValue() {
+			it.Extension, it.Extensions = "", installed
+			return config.Save(r.ConfigPath, cfg)
+		}
+	}
+	return fmt.Errorf("module %q in %s has no %s item to record extensions in", module, r.ConfigPath, item.PrimaryValue())
+}
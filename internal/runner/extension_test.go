@@ -0,0 +1,58 @@
+package runner
+
+import (
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/atomikpanda/dotular/internal/actions"
+	"github.com/atomikpanda/dotular/internal/config"
+)
+
+func TestBuildActionExtension(t *testing.T) {
+	r := newTestRunner(config.Config{})
+	action, skip, err := r.buildAction(config.Item{Extension: "golang.go"}, "editor")
+	if err != nil || skip {
+		t.Fatalf("buildAction: %v, skip=%v", err, skip)
+	}
+	ea := action.(*actions.ExtensionAction)
+	if ea.Editor != "vscode" || ea.Pull || !slices.Equal(ea.Extensions, []string{"golang.go"}) {
+		t.Errorf("action = %+v", ea)
+	}
+
+	r.DirectionOverride = "pull"
+	action, _, _ = r.buildAction(config.Item{Extensions: []string{"golang.go"}, Via: "cursor"}, "editor")
+	if ea := action.(*actions.ExtensionAction); !ea.Pull || ea.Capture == nil || ea.Editor != "cursor" {
+		t.Errorf("pull action = %+v", ea)
+	}
+}
+
+func TestCaptureExtensions(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dotular.yaml")
+	cfg := config.Config{Modules: []config.Module{{Name: "editor", Items: []config.Item{
+		{Package: "visual-studio-code", Via: "brew-cask"},
+		{Extension: "golang.go"},
+	}}}}
+	if err := config.Save(path, cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	r := newTestRunner(cfg)
+	r.ConfigPath = path
+	installed := []string{"esbenp.prettier-vscode", "golang.go"}
+	if err := r.captureExtensions("editor", config.Item{Extension: "golang.go"}, installed, false); err != nil {
+		t.Fatal(err)
+	}
+	saved, err := config.Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	item := saved.Modules[0].Items[1]
+	if item.Extension != "" || !slices.Equal(item.Extensions, installed) {
+		t.Errorf("saved item = %+v", item)
+	}
+
+	if err := r.captureExtensions("editor", config.Item{Extension: "other"}, installed, false); err == nil {
+		t.Error("expected an error when the item is not in the config")
+	}
+}
@@ -0,0 +1,71 @@
+package runner
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// itemTypeAliases maps the names accepted by --only and --skip to item types.
+var itemTypeAliases = map[string]string{
+	"package": "package", "packages": "package", "pkg": "package", "pkgs": "package",
+	"script": "script", "scripts": "script",
+	"setting": "setting", "settings": "setting",
+	"file": "file", "files": "file",
+	"directory": "directory", "directories": "directory", "dir": "directory", "dirs": "directory",
+	"binary": "binary", "binaries": "binary",
+	"run": "run", "runs": "run",
+	"dock":       "dock",
+	"login_item": "login_item", "login_items": "login_item",
+	"repo": "repo", "repos": "repo",
+	"container": "container", "containers": "container",
+	"extension": "extension", "extensions": "extension",
+	"default_app": "default_app", "default_apps": "default_app",
+	"shell_plugin": "shell_plugin", "shell_plugins": "shell_plugin",
+	"gpg_key": "gpg_key", "gpg_keys": "gpg_key",
+	"ssh_host": "ssh_host", "ssh_hosts": "ssh_host",
+}
+
+// ParseItemTypes normalises item type names as given to --only and --skip
+// (singular or plural, e.g. "files", "packages", "run"), splitting
+// comma-separated values.
+func ParseItemTypes(names []string) ([]string, error) {
+	var types []string
+	for _, name := range names {
+		for _, part := range strings.Split(name, ",") {
+			part = strings.ToLower(strings.TrimSpace(part))
+			if part == "" {
+				continue
+			}
+			t, ok := itemTypeAliases[part]
+			if !ok {
+				return nil, fmt.Errorf("unknown item type %q (want package, script, setting, file, directory, binary, run, dock, login_item, repo, container, extension, default_app, shell_plugin, gpg_key, or ssh_host)", part)
+			}
+			if !slices.Contains(types, t) {
+				types = append(types, t)
+			}
+		}
+	}
+	return types, nil
+}
+
+// ItemTypes lists the item types --only and --skip accept, sorted.
+func ItemTypes() []string {
+	var types []string
+	for _, t := range itemTypeAliases {
+		if !slices.Contains(types, t) {
+			types = append(types, t)
+		}
+	}
+	slices.Sort(types)
+	return types
+}
+
+// typeFiltered reports whether items of type t are excluded by OnlyTypes or
+// SkipTypes.
+func (r *Runner) typeFiltered(t string) bool {
+	if len(r.OnlyTypes) > 0 && !slices.Contains(r.OnlyTypes, t) {
+		return true
+	}
+	return slices.Contains(r.SkipTypes, t)
+}
@@ -0,0 +1,79 @@
+package runner
+
+import (
+	"context"
+	"os"
+	"slices"
+	"testing"
+
+	"github.com/atomikpanda/dotular/internal/config"
+)
+
+func TestParseItemTypes(t *testing.T) {
+	got, err := ParseItemTypes([]string{"files,packages", "run", "Dirs", "file"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"file", "package", "run", "directory"}
+	if !slices.Equal(got, want) {
+		t.Errorf("ParseItemTypes() = %v, want %v", got, want)
+	}
+	if _, err := ParseItemTypes([]string{"services"}); err == nil {
+		t.Error("expected error for unknown type")
+	}
+	if got, err := ParseItemTypes(nil); err != nil || got != nil {
+		t.Errorf("ParseItemTypes(nil) = %v, %v", got, err)
+	}
+}
+
+func TestPlanTypeFilters(t *testing.T) {
+	cfg := config.Config{Modules: []config.Module{
+		{Name: "mixed", Items: []config.Item{
+			{Package: "git", Via: "brew"},
+			{Run: "echo hi"},
+		}},
+		{Name: "pkgs", Items: []config.Item{{Package: "jq", Via: "brew"}}},
+	}}
+
+	r := newTestRunner(cfg)
+	r.SkipTypes = []string{"package"}
+	plan, err := r.Plan(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	mixed := plan.Modules[0]
+	if mixed.Skipped || mixed.Actions[0].Reason != "type filter" || mixed.Actions[1].Status != StatusApply {
+		t.Errorf("mixed module plan = %+v", mixed)
+	}
+	if pkgs := plan.Modules[1]; !pkgs.Skipped || pkgs.Reason != "type filter" {
+		t.Errorf("module with only filtered items should be skipped, got %+v", pkgs)
+	}
+
+	r = newTestRunner(cfg)
+	r.OnlyTypes = []string{"package"}
+	plan, err = r.Plan(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if acts := plan.Modules[0].Actions; acts[0].Status != StatusApply || acts[1].Reason != "type filter" {
+		t.Errorf("--only package plan = %+v", acts)
+	}
+}
+
+func TestApplySkipsFilteredModuleHooks(t *testing.T) {
+	marker := t.TempDir() + "/hook-ran"
+	cfg := config.Config{Modules: []config.Module{{
+		Name:  "pkgs",
+		Hooks: config.ModuleHooks{BeforeApply: "touch " + marker},
+		Items: []config.Item{{Package: "jq", Via: "brew"}},
+	}}}
+	r := newTestRunner(cfg)
+	r.DryRun = false
+	r.OnlyTypes = []string{"file"}
+	if err := r.ApplyAll(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(marker); err == nil {
+		t.Error("hooks of a fully filtered module should not run")
+	}
+}
@@ -0,0 +1,156 @@
+package runner
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/atomikpanda/dotular/internal/ageutil"
+	"github.com/atomikpanda/dotular/internal/config"
+)
+
+// expandItems returns mod's items with every file glob ("file: *.conf" or a
+// "files:" list) replaced by one file item per matching file in the module
+// store, in lexical order. Other items are returned unchanged. A glob that
+// matches nothing contributes no items. Items are ordered by phase. Within a
+// phase, repo items are moved ahead of the first package item so the sources
+// exist before the packages that need them are installed, and items with
+// after: wait for the items of the type they name.
+func (r *Runner) expandItems(mod config.Module) ([]config.Item, error) {
+	var out []config.Item
+	for _, item := range mod.Items {
+		if item.Type() != "file" || (len(item.Files) == 0 && !isGlob(item.File)) {
+			out = append(out, item)
+			continue
+		}
+		patterns := item.Files
+		if len(patterns) == 0 {
+			patterns = []string{item.File}
+		}
+		for _, pattern := range patterns {
+			names, err := r.globStore(mod.Name, pattern, item.Encrypted)
+			if err != nil {
+				return nil, fmt.Errorf("module %q: %w", mod.Name, err)
+			}
+			for _, name := range names {
+				expanded := item
+				expanded.File, expanded.Files = name, nil
+				if item.Name != "" {
+					// Each matched file keeps a distinct label.
+					expanded.Name = item.Name + ": " + name
+				}
+				out = append(out, expanded)
+			}
+		}
+	}
+	slices.SortStableFunc(out, func(a, b config.Item) int {
+		return config.PhaseRank(a.Phase) - config.PhaseRank(b.Phase)
+	})
+	var ordered []config.Item
+	for start := 0; start < len(out); {
+		end := start + 1
+		for end < len(out) && config.PhaseRank(out[end].Phase) == config.PhaseRank(out[start].Phase) {
+			end++
+		}
+		ordered = append(ordered, afterDeps(reposFirst(out[start:end]))...)
+		start = end
+	}
+	return ordered, nil
+}
+
+// reposFirst moves repo items that follow the first package item to just
+// before it, keeping the relative order of everything else.
+func reposFirst(items []config.Item) []config.Item {
+	first := slices.IndexFunc(items, func(it config.Item) bool { return it.Type() == "package" })
+	if first < 0 {
+		return items
+	}
+	out := slices.Clone(items[:first])
+	var rest []config.Item
+	for _, item := range items[first:] {
+		if item.Type() == "repo" {
+			out = append(out, item)
+		} else {
+			rest = append(rest, item)
+		}
+	}
+	return append(out, rest...)
+}
+
+// afterDeps moves each item that sets After to just behind the last item of
+// the named type that does not set After itself, if that item comes later.
+// Everything else keeps its relative order.
+func afterDeps(items []config.Item) []config.Item {
+	last := make(map[string]int)
+	for i, item := range items {
+		if item.After == "" {
+			last[item.Type()] = i
+		}
+	}
+	type keyed struct {
+		pos, sub int
+		item     config.Item
+	}
+	keys := make([]keyed, len(items))
+	for i, item := range items {
+		keys[i] = keyed{pos: i, item: item}
+		if item.After != "" {
+			keys[i].sub = 1
+			if dep, ok := last[item.After]; ok && dep > i {
+				keys[i].pos = dep
+			}
+		}
+	}
+	slices.SortStableFunc(keys, func(a, b keyed) int {
+		if a.pos != b.pos {
+			return a.pos - b.pos
+		}
+		return a.sub - b.sub
+	})
+	out := make([]config.Item, len(keys))
+	for i, k := range keys {
+		out[i] = k.item
+	}
+	return out
+}
+
+// globStore returns the store-relative names of the regular files matching
+// pattern. Names without glob characters are returned as they are. For
+// encrypted items the pattern is matched against the plaintext names, that
+// is, with the ".age" extension removed.
+func (r *Runner) globStore(module, pattern string, encrypted bool) ([]string, error) {
+	if !isGlob(pattern) {
+		return []string{pattern}, nil
+	}
+	store := r.Config.StoreDir(r.Root, module)
+	full := filepath.Join(store, pattern)
+	if encrypted {
+		full = ageutil.RepoPath(full)
+	}
+	matches, err := filepath.Glob(full)
+	if err != nil {
+		return nil, fmt.Errorf("file pattern %q: %w", pattern, err)
+	}
+	var names []string
+	for _, m := range matches {
+		if info, err := os.Stat(m); err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+		rel, err := filepath.Rel(store, m)
+		if err != nil {
+			continue
+		}
+		if encrypted {
+			rel = strings.TrimSuffix(rel, ".age")
+		}
+		names = append(names, filepath.ToSlash(rel))
+	}
+	return names, nil
+}
+
+// isGlob reports whether name contains glob metacharacters.
+func isGlob(name string) bool {
+	return strings.ContainsAny(name, "*?[")
+}
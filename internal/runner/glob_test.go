@@ -0,0 +1,161 @@
+package runner
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/atomikpanda/dotular/internal/config"
+)
+
+func TestExpandItems(t *testing.T) {
+	root := t.TempDir()
+	store := filepath.Join(root, "m")
+	os.MkdirAll(filepath.Join(store, "conf.d"), 0o755)
+	for _, name := range []string{"a.conf", "b.conf", "notes.txt", "conf.d/c.conf", "secret.env.age"} {
+		os.WriteFile(filepath.Join(store, name), []byte(name), 0o644)
+	}
+
+	r := newTestRunner(config.Config{})
+	r.Root = root
+	mod := config.Module{Name: "m", Items: []config.Item{
+		{Package: "git"},
+		{File: "*.conf", Destination: config.PlatformMap{MacOS: "~/.config/m"}},
+		{Files: []string{"notes.txt", "conf.d/*.conf"}},
+		{File: "*.env", Encrypted: true},
+		{File: "*.missing"},
+	}}
+	items, err := r.expandItems(mod)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var files []string
+	for _, item := range items {
+		if item.Type() == "file" {
+			files = append(files, item.File)
+			if len(item.Files) != 0 {
+				t.Errorf("expanded item still has files: %+v", item)
+			}
+		}
+	}
+	want := []string{"a.conf", "b.conf", "notes.txt", "conf.d/c.conf", "secret.env"}
+	if len(files) != len(want) {
+		t.Fatalf("files = %v, want %v", files, want)
+	}
+	for i := range want {
+		if files[i] != want[i] {
+			t.Errorf("files[%d] = %q, want %q", i, files[i], want[i])
+		}
+	}
+	if items[0].Package != "git" {
+		t.Error("non-file items should be kept")
+	}
+	if items[1].Destination.MacOS != "~/.config/m" {
+		t.Error("expanded items should keep the glob item's settings")
+	}
+}
+
+func TestPlanModuleExpandsGlobs(t *testing.T) {
+	root := t.TempDir()
+	os.MkdirAll(filepath.Join(root, "m"), 0o755)
+	os.WriteFile(filepath.Join(root, "m", "a.conf"), []byte("a"), 0o644)
+	os.WriteFile(filepath.Join(root, "m", "b.conf"), []byte("b"), 0o644)
+
+	r := newTestRunner(config.Config{})
+	r.Root = root
+	mod := config.Module{Name: "m", Items: []config.Item{
+		{File: "*.conf", Destination: config.PlatformMap{MacOS: t.TempDir()}},
+	}}
+	mp, err := r.PlanModule(context.Background(), mod)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(mp.Actions) != 2 {
+		t.Fatalf("actions = %d, want one per match", len(mp.Actions))
+	}
+}
+
+func TestIsGlob(t *testing.T) {
+	for name, want := range map[string]bool{"*.conf": true, "a?.txt": true, "[ab].txt": true, ".zshrc": false} {
+		if isGlob(name) != want {
+			t.Errorf("isGlob(%q) = %v", name, !want)
+		}
+	}
+}
+
+func TestExpandItemsReposFirst(t *testing.T) {
+	r := newTestRunner(config.Config{})
+	r.Root = t.TempDir()
+	mod := config.Module{Name: "m", Items: []config.Item{
+		{Run: "echo setup"},
+		{Package: "neovim", Via: "brew"},
+		{Package: "gh", Via: "brew"},
+		{Repo: "homebrew/cask-fonts", Via: "brew"},
+		{Run: "echo done"},
+	}}
+	items, err := r.expandItems(mod)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, item := range items {
+		got = append(got, item.PrimaryValue())
+	}
+	want := []string{"echo setup", "homebrew/cask-fonts", "neovim", "gh", "echo done"}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("order = %v, want %v", got, want)
+	}
+}
+
+func TestExpandItemsPhases(t *testing.T) {
+	r := newTestRunner(config.Config{})
+	r.Root = t.TempDir()
+	mod := config.Module{Name: "m", Items: []config.Item{
+		{Run: "echo cleanup", Phase: config.PhasePost},
+		{Run: "echo configure"},
+		{Package: "neovim", Via: "brew", Phase: config.PhasePre},
+		{Repo: "homebrew/cask-fonts", Via: "brew", Phase: config.PhasePre},
+		{Run: "echo report", Phase: config.PhasePost},
+		{Package: "gh", Via: "brew", Phase: config.PhaseMain},
+	}}
+	items, err := r.expandItems(mod)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, item := range items {
+		got = append(got, item.PrimaryValue())
+	}
+	want := []string{"homebrew/cask-fonts", "neovim", "echo configure", "gh", "echo cleanup", "echo report"}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("order = %v, want %v", got, want)
+	}
+}
+
+func TestExpandItemsAfter(t *testing.T) {
+	r := newTestRunner(config.Config{})
+	r.Root = t.TempDir()
+	mod := config.Module{Name: "m", Items: []config.Item{
+		{Run: "nvim --headless +Lazy", After: "package"},
+		{Run: "echo first"},
+		{Package: "neovim", Via: "brew"},
+		{Run: "gh extension install", After: "package"},
+		{Package: "gh", Via: "brew"},
+		{Run: "echo last"},
+		{Run: "echo pre", Phase: config.PhasePre},
+	}}
+	items, err := r.expandItems(mod)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, item := range items {
+		got = append(got, item.PrimaryValue())
+	}
+	want := []string{"echo pre", "echo first", "neovim", "gh", "nvim --headless +Lazy", "gh extension install", "echo last"}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("order = %v, want %v", got, want)
+	}
+}
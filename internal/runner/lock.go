@@ -0,0 +1,36 @@
+package runner
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/atomikpanda/dotular/internal/errs"
+	"github.com/atomikpanda/dotular/internal/runlock"
+)
+
+// lock takes the run lock for r.ConfigPath, so that two processes cannot
+// apply the same config at once. With r.Wait it queues behind the process
+// holding it; otherwise that is an errs.ErrLocked error.
+func (r *Runner) lock(ctx context.Context) (*runlock.Lock, error) {
+	path, err := runlock.Path(r.ConfigPath)
+	if err != nil {
+		return nil, fmt.Errorf("lock: %w", err)
+	}
+	var onWait func(runlock.Info)
+	if r.Wait {
+		onWait = func(holder runlock.Info) {
+			r.UI.Info(fmt.Sprintf("waiting for %s to finish", holder))
+		}
+	}
+	l, err := runlock.Acquire(ctx, path, r.Command, onWait)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("waiting for lock: %w (%w)", errs.ErrAborted, context.Cause(ctx))
+		}
+		return nil, err
+	}
+	if l.TookOver != nil {
+		r.UI.Warn(fmt.Sprintf("taking over the lock of %s, which is no longer running", l.TookOver))
+	}
+	return l, nil
+}
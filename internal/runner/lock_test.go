@@ -0,0 +1,101 @@
+package runner
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/atomikpanda/dotular/internal/config"
+	"github.com/atomikpanda/dotular/internal/errs"
+	"github.com/atomikpanda/dotular/internal/runlock"
+	"github.com/atomikpanda/dotular/internal/state"
+)
+
+func TestApplyAllLocked(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Unix-only")
+	}
+	t.Setenv("HOME", t.TempDir())
+	cfgPath := filepath.Join(t.TempDir(), "dotular.yaml")
+	path, err := runlock.Path(cfgPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	held, err := runlock.Acquire(context.Background(), path, "apply", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := newTestRunner(config.Config{Modules: []config.Module{{Name: "m", Items: []config.Item{{Run: "true"}}}}})
+	r.DryRun = false
+	r.ConfigPath = cfgPath
+	if err := r.ApplyAll(context.Background()); !errors.Is(err, errs.ErrLocked) {
+		t.Fatalf("ApplyAll err = %v, want ErrLocked", err)
+	}
+
+	r.DryRun = true
+	if err := r.ApplyAll(context.Background()); err != nil {
+		t.Errorf("dry run should not need the lock: %v", err)
+	}
+
+	held.Release()
+	r.DryRun = false
+	if err := r.ApplyAll(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := runlock.Acquire(context.Background(), path, "apply", nil); err != nil {
+		t.Errorf("lock not released after the run: %v", err)
+	}
+}
+
+func TestUnapplyLocked(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Unix-only")
+	}
+	t.Setenv("HOME", t.TempDir())
+	cfgPath := filepath.Join(t.TempDir(), "dotular.yaml")
+	path, err := runlock.Path(cfgPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	held, err := runlock.Acquire(context.Background(), path, "apply", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer held.Release()
+
+	r := newTestRunner(config.Config{})
+	r.DryRun = false
+	r.ConfigPath = cfgPath
+	r.State = state.New()
+	if _, err := r.Unapply(context.Background(), config.Module{Name: "m"}, false); !errors.Is(err, errs.ErrLocked) {
+		t.Fatalf("Unapply err = %v, want ErrLocked", err)
+	}
+}
+
+func TestCleanLocked(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Unix-only")
+	}
+	t.Setenv("HOME", t.TempDir())
+	cfgPath := filepath.Join(t.TempDir(), "dotular.yaml")
+	path, err := runlock.Path(cfgPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	held, err := runlock.Acquire(context.Background(), path, "apply", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer held.Release()
+
+	r := newTestRunner(config.Config{})
+	r.DryRun = false
+	r.ConfigPath = cfgPath
+	r.State = state.New()
+	if _, err := r.Clean(context.Background(), nil); !errors.Is(err, errs.ErrLocked) {
+		t.Fatalf("Clean err = %v, want ErrLocked", err)
+	}
+}
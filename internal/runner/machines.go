@@ -0,0 +1,57 @@
+package runner
+
+import (
+	"os"
+	"runtime"
+	"time"
+
+	"github.com/atomikpanda/dotular/internal/machines"
+)
+
+// registerMachine records this machine and the modules this run applied in
+// the repo's machine inventory when machines.register is set. Only plain
+// applies register: pushes, pulls, and syncs do not bring a machine up to
+// date with the config. Failures are warnings; the run has already happened.
+func (r *Runner) registerMachine() {
+	if r.DryRun || !r.Config.Machines.Register || r.ConfigPath == "" ||
+		r.Command != "apply" || r.DirectionOverride != "" || len(r.applied) == 0 {
+		return
+	}
+	path := machines.Path(r.ConfigPath)
+	inv, err := machines.Load(path)
+	if err != nil {
+		r.UI.Warn("machine inventory: " + err.Error())
+		return
+	}
+	host, _ := os.Hostname()
+	inv.Register(machines.Machine{
+		Hostname:  host,
+		OS:        r.OS,
+		Arch:      runtime.GOARCH,
+		Tags:      r.MachineTags,
+		Version:   r.Version,
+		LastApply: time.Now().UTC(),
+		Modules:   r.applied,
+	})
+	if err := inv.Save(path); err != nil {
+		r.UI.Warn("machine inventory: " + err.Error())
+	}
+}
+
+// Behind returns, in config order, the modules m has applied whose resolved
+// config or store contents changed since. Modules no longer in the config
+// are ignored.
+func (r *Runner) Behind(m machines.Machine) []string {
+	var out []string
+	for _, mod := range r.Config.Modules {
+		applied, ok := m.Modules[mod.Name]
+		if !ok {
+			continue
+		}
+		hash, err := r.moduleHashFor(mod, "apply", "")
+		if err != nil || applied == "" || hash != applied {
+			out = append(out, mod.Name)
+		}
+	}
+	return out
+}
@@ -0,0 +1,60 @@
+package runner
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/atomikpanda/dotular/internal/config"
+	"github.com/atomikpanda/dotular/internal/machines"
+)
+
+func TestRegisterMachine(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	repo := t.TempDir()
+	dest := t.TempDir()
+	os.MkdirAll(filepath.Join(repo, "dots"), 0o755)
+	os.WriteFile(filepath.Join(repo, "dots", "rc"), []byte("v1"), 0o644)
+
+	to := config.PlatformMap{MacOS: dest + "/"}
+	cfg := config.Config{
+		Machines: config.MachinesConfig{Register: true},
+		Modules: []config.Module{
+			{Name: "dots", Items: []config.Item{{File: "rc", Destination: to}}},
+			{Name: "work", OnlyTags: []string{"work"}, Items: []config.Item{{Run: "true"}}},
+		},
+	}
+	r := newTestRunner(cfg)
+	r.DryRun = false
+	r.Root = repo
+	r.ConfigPath = filepath.Join(repo, "dotular.yaml")
+	r.Version = "1.2.3"
+	if err := r.ApplyAll(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	inv, err := machines.Load(machines.Path(r.ConfigPath))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(inv.Machines) != 1 {
+		t.Fatalf("machines = %+v, want this machine", inv.Machines)
+	}
+	m := inv.Machines[0]
+	if m.Version != "1.2.3" || m.OS != "darwin" || m.LastApply.IsZero() || !slices.Contains(m.Tags, "testhost") {
+		t.Errorf("machine = %+v", m)
+	}
+	if _, ok := m.Modules["dots"]; !ok || len(m.Modules) != 1 {
+		t.Errorf("modules = %v, want just dots", m.Modules)
+	}
+	if behind := r.Behind(m); len(behind) != 0 {
+		t.Errorf("Behind right after apply = %v", behind)
+	}
+
+	os.WriteFile(filepath.Join(repo, "dots", "rc"), []byte("v2"), 0o644)
+	if behind := r.Behind(m); !slices.Equal(behind, []string{"dots"}) {
+		t.Errorf("Behind after a store change = %v, want [dots]", behind)
+	}
+}
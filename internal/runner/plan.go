@@ -0,0 +1,251 @@
+package runner
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"slices"
+
+	"github.com/atomikpanda/dotular/internal/actions"
+	"github.com/atomikpanda/dotular/internal/config"
+	"github.com/atomikpanda/dotular/internal/platform"
+)
+
+// Plan statuses.
+const (
+	StatusApply = "apply"
+	StatusSkip  = "skip"
+)
+
+// Plan is the full list of concrete actions the runner would take.
+type Plan struct {
+	Modules []ModulePlan `json:"modules"`
+}
+
+// ModulePlan holds the planned actions for a single module. Skipped modules
+// (e.g. tag mismatch) carry a Reason and no actions.
+type ModulePlan struct {
+	Module  string          `json:"module"`
+	Skipped bool            `json:"skipped,omitempty"`
+	Reason  string          `json:"reason,omitempty"`
+	Actions []PlannedAction `json:"actions"`
+
+	config config.Module
+}
+
+// PlannedAction is the outcome of planning one item: whether it will be
+// applied or skipped (and why), plus its current and desired state where the
+// runner can observe it without side effects.
+type PlannedAction struct {
+	Index       int    `json:"index"`
+	Type        string `json:"type"`
+	Description string `json:"description"`
+	Status      string `json:"status"`           // StatusApply | StatusSkip
+	Reason      string `json:"reason,omitempty"` // why the item is skipped
+	Current     string `json:"current,omitempty"`
+	Desired     string `json:"desired,omitempty"`
+	// Unchecked lists the guard commands, such as "skip_if: test -f x",
+	// that a dry-run apply reports instead of running.
+	Unchecked []string `json:"unchecked,omitempty"`
+
+	Item   config.Item    `json:"-"`
+	Action actions.Action `json:"-"`
+	// pending is set when the checks after when are left to executeItems.
+	pending bool
+}
+
+// checkMode is when planItem evaluates an item's creates, skip_if, unless,
+// and only_if guards and its idempotency check.
+type checkMode int
+
+const (
+	checkNow    checkMode = iota // plan and status: all of them, up front
+	checkListed                  // dry-run apply: guard commands are listed in Unchecked, not run
+	checkLater                   // apply: executeItems checks each item just before it runs
+)
+
+// Plan builds the plan for every module in the config, respecting tag filters.
+// Nothing is modified; skip_if commands and idempotency checks are run.
+func (r *Runner) Plan(ctx context.Context) (*Plan, error) {
+	plan := &Plan{}
+	for _, mod := range r.Config.Modules {
+		if !r.matchesTags(mod) {
+			plan.Modules = append(plan.Modules, ModulePlan{
+				Module: mod.Name, Skipped: true, Reason: "tag mismatch", Actions: []PlannedAction{},
+			})
+			continue
+		}
+		mp, err := r.PlanModule(ctx, mod)
+		if err != nil {
+			return nil, err
+		}
+		plan.Modules = append(plan.Modules, mp)
+	}
+	return plan, nil
+}
+
+// PlanModule builds the plan for a single module. Tag filters are not
+// applied; callers that name a module explicitly get it planned regardless.
+// A module whose items are all excluded by OnlyTypes/SkipTypes is skipped
+// as a whole, so its hooks do not run either.
+func (r *Runner) PlanModule(ctx context.Context, mod config.Module) (ModulePlan, error) {
+	return r.planModule(ctx, mod, checkNow)
+}
+
+// planModule is PlanModule with the item checks done as mode says.
+func (r *Runner) planModule(ctx context.Context, mod config.Module, mode checkMode) (ModulePlan, error) {
+	mp := ModulePlan{Module: mod.Name, Actions: []PlannedAction{}, config: mod}
+	if r.Item != "" {
+		i, err := mod.FindItem(r.Item)
+		if err != nil {
+			return mp, err
+		}
+		mod.Items = mod.Items[i : i+1]
+	}
+	if len(mod.Items) > 0 && !slices.ContainsFunc(mod.Items, func(item config.Item) bool {
+		return !r.typeFiltered(item.Type())
+	}) {
+		mp.Skipped, mp.Reason = true, "type filter"
+		return mp, nil
+	}
+	if len(mod.Items) > 0 && !slices.ContainsFunc(mod.Items, func(item config.Item) bool {
+		return !r.profileFiltered(item)
+	}) {
+		mp.Skipped, mp.Reason = true, "profile "+r.ProfileName
+		return mp, nil
+	}
+	items, err := r.expandItems(mod)
+	if err != nil {
+		return mp, err
+	}
+	for i, item := range items {
+		pa, err := r.planItem(ctx, mod.Name, i, item, mode)
+		if err != nil {
+			return mp, fmt.Errorf("module %q: %w", mod.Name, err)
+		}
+		mp.Actions = append(mp.Actions, pa)
+	}
+	return mp, nil
+}
+
+// planItem evaluates an item's applicability (platform, when, creates,
+// skip_if/unless/only_if, and idempotency) without modifying anything. With
+// checkLater only the platform, filters, and when are evaluated; checkItem
+// does the rest.
+func (r *Runner) planItem(ctx context.Context, modName string, index int, item config.Item, mode checkMode) (PlannedAction, error) {
+	pa := PlannedAction{Index: index, Type: item.Type(), Item: item}
+
+	action, skip, err := r.buildAction(item, modName)
+	if err != nil {
+		return pa, err
+	}
+	if skip {
+		pa.Description = item.Type()
+		pa.Status = StatusSkip
+		pa.Reason = item.Type() + " not applicable on " + r.OS
+		return pa, nil
+	}
+	pa.Action = action
+	pa.Description = label(item, action)
+
+	if r.typeFiltered(pa.Type) {
+		pa.Status, pa.Reason = StatusSkip, "type filter"
+		return pa, nil
+	}
+	if r.profileFiltered(item) {
+		pa.Status, pa.Reason = StatusSkip, "profile "+r.ProfileName
+		return pa, nil
+	}
+
+	if _, _, err := retryPolicy(item); err != nil {
+		return pa, err
+	}
+
+	// --- when ---
+	matched, err := r.whenMatches(item)
+	if err != nil {
+		return pa, err
+	}
+	if !matched {
+		pa.Status, pa.Reason = StatusSkip, "when"
+		return pa, nil
+	}
+
+	if mode == checkLater {
+		pa.Status, pa.pending = StatusApply, true
+		return pa, nil
+	}
+	return r.checkItem(ctx, pa, mode == checkNow)
+}
+
+// checkItem evaluates pa's creates guard, its skip_if, unless, and only_if
+// commands, and its idempotency check, and records the current and desired
+// state of an item that will apply. Without runGuards the guard commands are
+// listed in pa.Unchecked instead of run.
+func (r *Runner) checkItem(ctx context.Context, pa PlannedAction, runGuards bool) (PlannedAction, error) {
+	item, action := pa.Item, pa.Action
+	pa.pending = false
+	skipWith := func(reason string) (PlannedAction, error) {
+		pa.Status = StatusSkip
+		pa.Reason = reason
+		return pa, nil
+	}
+
+	// --- creates ---
+	if item.Creates != "" && r.createsExists(item.Creates) {
+		return skipWith("creates")
+	}
+
+	// --- skip_if / unless / only_if ---
+	for _, guard := range []struct {
+		name, command string
+		skipOn        bool
+	}{
+		{"skip_if", item.SkipIf, true},
+		{"unless", item.Unless, true},
+		{"only_if", item.OnlyIf, false},
+	} {
+		if guard.command == "" {
+			continue
+		}
+		if !runGuards {
+			pa.Unchecked = append(pa.Unchecked, guard.name+": "+guard.command)
+			continue
+		}
+		exitsZero, err := r.shellFor(item).Eval(ctx, guard.command)
+		if err != nil {
+			return pa, fmt.Errorf("%s eval failed: %w", guard.name, err)
+		}
+		if exitsZero == guard.skipOn {
+			return skipWith(guard.name)
+		}
+	}
+
+	// --- auto-idempotency ---
+	if idem, ok := action.(actions.Idempotent); ok {
+		applied, err := idem.IsApplied(ctx)
+		if err != nil {
+			return pa, fmt.Errorf("idempotency check: %w", err)
+		}
+		if applied {
+			return skipWith("already applied")
+		}
+	}
+
+	pa.Status = StatusApply
+	if st, ok := action.(actions.Stater); ok {
+		pa.Current, pa.Desired = st.State(ctx)
+	}
+	return pa, nil
+}
+
+// createsExists reports whether the path or glob pattern of a creates guard
+// matches anything on disk. A relative path is taken from the repo root.
+func (r *Runner) createsExists(pattern string) bool {
+	path := platform.ExpandPath(pattern)
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(r.Root, path)
+	}
+	matches, err := filepath.Glob(path)
+	return err == nil && len(matches) > 0
+}
@@ -0,0 +1,168 @@
+package runner
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/atomikpanda/dotular/internal/config"
+)
+
+func TestPlanModuleStatuses(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Unix-only test")
+	}
+	mod := config.Module{
+		Name: "plan-test",
+		Items: []config.Item{
+			{Run: "echo hi"},
+			{Run: "echo skip", SkipIf: "true"},
+			{Run: "echo work", When: `hasTag("work")`},
+			{Package: "foo", Via: "winget"},
+			{Run: "echo unless", Unless: "true"},
+			{Run: "echo only", OnlyIf: "false"},
+			{Run: "echo only", OnlyIf: "true"},
+		},
+	}
+	r := newTestRunner(config.Config{})
+	mp, err := r.PlanModule(context.Background(), mod)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(mp.Actions) != 7 {
+		t.Fatalf("got %d actions, want 7", len(mp.Actions))
+	}
+	want := []struct{ status, reason string }{
+		{StatusApply, ""},
+		{StatusSkip, "skip_if"},
+		{StatusSkip, "when"},
+		{StatusSkip, "package not applicable on darwin"},
+		{StatusSkip, "unless"},
+		{StatusSkip, "only_if"},
+		{StatusApply, ""},
+	}
+	for i, w := range want {
+		pa := mp.Actions[i]
+		if pa.Status != w.status || pa.Reason != w.reason {
+			t.Errorf("action %d = %s/%q, want %s/%q", i, pa.Status, pa.Reason, w.status, w.reason)
+		}
+	}
+}
+
+func TestPlanCreates(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	repo := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(home, ".local", "bin"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range []string{filepath.Join(home, ".local", "bin", "nvim"), filepath.Join(repo, "built.stamp")} {
+		if err := os.WriteFile(p, nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	mod := config.Module{
+		Name: "creates",
+		Items: []config.Item{
+			{Run: "echo a", Creates: "~/.local/bin/nvim"},
+			{Run: "echo b", Creates: "~/.local/bin/missing"},
+			{Run: "echo c", Creates: "built.stamp"},
+			{Run: "echo d", Creates: "~/.local/bin/nv*"},
+		},
+	}
+	r := newTestRunner(config.Config{})
+	r.Root = repo
+	mp, err := r.PlanModule(context.Background(), mod)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{StatusSkip, StatusApply, StatusSkip, StatusSkip}
+	for i, w := range want {
+		if pa := mp.Actions[i]; pa.Status != w || (w == StatusSkip && pa.Reason != "creates") {
+			t.Errorf("action %d = %s/%q, want %s", i, pa.Status, pa.Reason, w)
+		}
+	}
+}
+
+func TestPlanDoesNotModify(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	repo := t.TempDir()
+	if err := os.WriteFile(filepath.Join(repo, ".vimrc"), []byte("set nu"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	mod := config.Module{
+		Name: "vim",
+		Items: []config.Item{
+			{File: filepath.Join(repo, ".vimrc"), Destination: config.PlatformMap{MacOS: home}},
+		},
+	}
+	r := newTestRunner(config.Config{Modules: []config.Module{mod}})
+	r.DryRun = false
+	plan, err := r.Plan(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	pa := plan.Modules[0].Actions[0]
+	if pa.Status != StatusApply || pa.Current != "missing" {
+		t.Errorf("planned = %+v", pa)
+	}
+	if _, err := os.Stat(filepath.Join(home, ".vimrc")); !os.IsNotExist(err) {
+		t.Error("Plan must not write the destination")
+	}
+}
+
+func TestPlanTagMismatch(t *testing.T) {
+	cfg := config.Config{
+		Modules: []config.Module{
+			{Name: "win", OnlyTags: []string{"windows"}, Items: []config.Item{{Run: "echo"}}},
+		},
+	}
+	r := newTestRunner(cfg)
+	plan, err := r.Plan(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !plan.Modules[0].Skipped || plan.Modules[0].Reason != "tag mismatch" {
+		t.Errorf("module plan = %+v", plan.Modules[0])
+	}
+}
+
+func TestExecuteUsesPlan(t *testing.T) {
+	mod := config.Module{Name: "exec", Items: []config.Item{{Run: "echo a"}, {Run: "echo b", When: "false"}}}
+	r := newTestRunner(config.Config{})
+	mp, err := r.PlanModule(context.Background(), mod)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result := r.Execute(context.Background(), mp)
+	if result.Err != nil || result.Applied != 1 || result.Skipped != 1 {
+		t.Errorf("result = %+v", result)
+	}
+}
+
+func TestApplyChecksGuardsBeforeEachItem(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Unix-only test")
+	}
+	dir := t.TempDir()
+	marker := filepath.Join(dir, "marker")
+	ran := filepath.Join(dir, "ran")
+	mod := config.Module{Name: "guards", Items: []config.Item{
+		{Run: "touch " + marker},
+		{Run: "echo creates >> " + ran, Creates: marker},
+		{Run: "echo skip_if >> " + ran, SkipIf: "test -f " + marker},
+		{Run: "echo only_if >> " + ran, OnlyIf: "test -f " + marker},
+	}}
+	r := newTestRunner(config.Config{})
+	r.DryRun = false
+	result := r.ApplyModule(context.Background(), mod)
+	if result.Err != nil || result.Applied != 2 || result.Skipped != 2 {
+		t.Errorf("result = %+v, want the guards to see the first item's file", result)
+	}
+	if got, _ := os.ReadFile(ran); string(got) != "only_if\n" {
+		t.Errorf("ran = %q, want only the only_if item", got)
+	}
+}
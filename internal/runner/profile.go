@@ -0,0 +1,78 @@
+package runner
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/atomikpanda/dotular/internal/config"
+)
+
+// ProfileDevcontainer is the built-in profile for dev containers and
+// Codespaces, chosen automatically when dotular runs in a container.
+const ProfileDevcontainer = "devcontainer"
+
+// builtinProfiles are the profiles available without a profiles: entry.
+var builtinProfiles = map[string]config.Profile{
+	// Containers have no GUI, Dock, or login session, and editor extensions
+	// come from devcontainer.json.
+	ProfileDevcontainer: {
+		Skip:         []string{"setting", "dock", "login_item", "default_app", "extension"},
+		SkipManagers: []string{"brew-cask", "mas", "flatpak", "snap"},
+		Tags:         []string{ProfileDevcontainer},
+	},
+}
+
+// LookupProfile returns the named profile from the config's profiles:,
+// else a built-in one, with its item types normalised as for --skip.
+func LookupProfile(cfg config.Config, name string) (config.Profile, error) {
+	p, ok := cfg.Profiles[name]
+	if !ok {
+		if p, ok = builtinProfiles[name]; !ok {
+			return config.Profile{}, fmt.Errorf("unknown profile %q (want %s)", name, strings.Join(ProfileNames(cfg), ", "))
+		}
+	}
+	skip, err := ParseItemTypes(p.Skip)
+	if err != nil {
+		return config.Profile{}, fmt.Errorf("profile %q: %w", name, err)
+	}
+	p.Skip = skip
+	return p, nil
+}
+
+// ProfileNames lists the built-in and configured profiles, sorted.
+func ProfileNames(cfg config.Config) []string {
+	var names []string
+	for name := range builtinProfiles {
+		names = append(names, name)
+	}
+	for name := range cfg.Profiles {
+		if !slices.Contains(names, name) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// UseProfile trims the run to the named profile p: its item types and
+// package managers are skipped and its tags are added to the machine tags,
+// so modules can opt in or out with only_tags and exclude_tags.
+func (r *Runner) UseProfile(name string, p config.Profile) {
+	r.ProfileName, r.Profile = name, p
+	for _, tag := range p.Tags {
+		if !slices.Contains(r.MachineTags, tag) {
+			r.MachineTags = append(r.MachineTags, tag)
+		}
+	}
+}
+
+// profileFiltered reports whether the active profile skips item.
+func (r *Runner) profileFiltered(item config.Item) bool {
+	t := item.Type()
+	if slices.Contains(r.Profile.Skip, t) {
+		return true
+	}
+	return t == "package" && slices.Contains(r.Profile.SkipManagers, item.Via)
+}
@@ -0,0 +1,66 @@
+package runner
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/atomikpanda/dotular/internal/config"
+)
+
+func TestLookupProfile(t *testing.T) {
+	p, err := LookupProfile(config.Config{}, ProfileDevcontainer)
+	if err != nil || !slices.Contains(p.Skip, "setting") || !slices.Contains(p.SkipManagers, "brew-cask") {
+		t.Errorf("built-in devcontainer = %+v, %v", p, err)
+	}
+
+	cfg := config.Config{Profiles: map[string]config.Profile{
+		ProfileDevcontainer: {Skip: []string{"scripts"}},
+		"broken":            {Skip: []string{"widgets"}},
+	}}
+	if p, err := LookupProfile(cfg, ProfileDevcontainer); err != nil || !slices.Equal(p.Skip, []string{"script"}) {
+		t.Errorf("configured devcontainer = %+v, %v; want it to replace the built-in one", p, err)
+	}
+	if _, err := LookupProfile(cfg, "broken"); err == nil || !strings.Contains(err.Error(), "widgets") {
+		t.Errorf("invalid skip type: err = %v", err)
+	}
+	if _, err := LookupProfile(cfg, "laptop"); err == nil || !strings.Contains(err.Error(), "broken, devcontainer") {
+		t.Errorf("unknown profile: err = %v, want the known profiles listed", err)
+	}
+}
+
+func TestUseProfile(t *testing.T) {
+	cfg := config.Config{Modules: []config.Module{
+		{Name: "tools", Items: []config.Item{
+			{Package: "ripgrep", Via: "brew"},
+			{Package: "firefox", Via: "brew-cask"},
+			{Setting: "com.apple.dock", Key: "autohide", Value: true},
+		}},
+		{Name: "gui", Items: []config.Item{{Setting: "com.apple.finder", Key: "ShowPathbar", Value: true}}},
+		{Name: "desktop", ExcludeTags: []string{ProfileDevcontainer}, Items: []config.Item{{Run: "true"}}},
+	}}
+	r := newTestRunner(cfg)
+	p, _ := LookupProfile(cfg, ProfileDevcontainer)
+	r.UseProfile(ProfileDevcontainer, p)
+
+	plan, err := r.PlanModule(context.Background(), cfg.Modules[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	var skipped []string
+	for _, pa := range plan.Actions {
+		if pa.Status == StatusSkip && pa.Reason == "profile devcontainer" {
+			skipped = append(skipped, pa.Type+":"+pa.Item.Via)
+		}
+	}
+	if !slices.Equal(skipped, []string{"package:brew-cask", "setting:"}) {
+		t.Errorf("skipped by profile = %v, want the cask and the setting", skipped)
+	}
+	if plan, _ := r.PlanModule(context.Background(), cfg.Modules[1]); !plan.Skipped || plan.Reason != "profile devcontainer" {
+		t.Errorf("gui plan = %+v, want the whole module skipped", plan)
+	}
+	if r.matchesTags(cfg.Modules[2]) {
+		t.Error("the profile's tag should exclude the desktop module")
+	}
+}
@@ -0,0 +1,135 @@
+package runner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"time"
+
+	"github.com/atomikpanda/dotular/internal/actions"
+	"github.com/atomikpanda/dotular/internal/config"
+	"github.com/atomikpanda/dotular/internal/ui"
+)
+
+// Defaults applied to network-backed items (binary downloads, remote
+// scripts, and shell plugin clones) when the item does not set retries/retry_delay itself.
+const (
+	defaultNetworkRetries = 2
+	defaultRetryDelay     = 2 * time.Second
+)
+
+// retryPolicy returns how many extra attempts an item gets after a failure
+// and how long to wait between them.
+func retryPolicy(item config.Item) (retries int, delay time.Duration, err error) {
+	switch {
+	case item.Retries != nil:
+		retries = *item.Retries
+	case item.Type() == "binary", item.Type() == "shell_plugin", item.Type() == "script" && item.Via == "remote":
+		retries = defaultNetworkRetries
+	}
+	if retries < 0 {
+		return 0, 0, fmt.Errorf("retries must not be negative, got %d", retries)
+	}
+
+	delay = defaultRetryDelay
+	if item.RetryDelay != "" {
+		delay, err = time.ParseDuration(item.RetryDelay)
+		if err != nil {
+			return 0, 0, fmt.Errorf("invalid retry_delay %q: %w", item.RetryDelay, err)
+		}
+		if delay < 0 {
+			return 0, 0, fmt.Errorf("retry_delay must not be negative, got %q", item.RetryDelay)
+		}
+	}
+	return retries, delay, nil
+}
+
+// runWithRetry runs action, re-running it on failure according to the item's
+// retry policy. Skips (actions.ErrSkipped) are never retried.
+func (r *Runner) runWithRetry(ctx context.Context, item config.Item, action actions.Action) error {
+	retries, delay, err := retryPolicy(item)
+	if err != nil {
+		return err
+	}
+	for attempt := 0; ; attempt++ {
+		err = action.Run(ctx, false)
+		if err == nil || errors.Is(err, actions.ErrSkipped) || attempt >= retries {
+			return err
+		}
+		r.UI.Warn(fmt.Sprintf("%s failed (attempt %d/%d), retrying in %s: %v",
+			label(item, action), attempt+1, retries+1, delay, err))
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+	}
+}
+
+// runWithProgress runs the action (with retries) behind a spinner, unless it
+// may prompt: the spinner redraws its line and would hide the prompt.
+//
+// In quiet mode subprocess stdout is discarded; at debug level subprocess argv
+// is logged.
+func (r *Runner) runWithProgress(ctx context.Context, item config.Item, action actions.Action) error {
+	if r.UI.Level >= ui.LevelDebug {
+		ctx = actions.WithDebug(ctx, r.UI.Debug)
+	}
+	if r.UI.Quiet() {
+		ctx = actions.WithOutput(ctx, io.Discard, nil)
+	}
+	if r.NoCache {
+		ctx = actions.WithRefetch(ctx)
+	}
+	if mayPrompt(item, action) {
+		ctx = actions.WithReporter(ctx, r.reporter(r.UI.Out))
+		return r.runWithRetry(ctx, item, action)
+	}
+	spin := r.UI.StartSpinner(label(item, action))
+	defer spin.Stop()
+	if w := spin.Writer(); w != nil {
+		ctx = actions.WithOutput(ctx, w, w)
+		ctx = actions.WithReporter(ctx, r.reporter(w))
+	} else {
+		ctx = actions.WithReporter(ctx, r.reporter(r.UI.Out))
+	}
+	ctx = actions.WithProgress(ctx, spin.Progress)
+	return r.runWithRetry(ctx, item, action)
+}
+
+// mayPrompt reports whether running action may ask for input: file and
+// directory items on conflicts, run and script items because user commands
+// often prompt (e.g. sudo), and package and repo items whose manager runs
+// under sudo.
+func mayPrompt(item config.Item, action actions.Action) bool {
+	switch a := action.(type) {
+	case *actions.PackageAction:
+		args, err := actions.InstallCommand(a.Manager, a.Package)
+		return err == nil && args[0] == "sudo"
+	case *actions.RepoAction:
+		steps, _ := a.Commands()
+		return slices.ContainsFunc(steps, func(args []string) bool { return args[0] == "sudo" })
+	}
+	switch item.Type() {
+	case "file", "directory", "run", "script":
+		return true
+	}
+	return false
+}
+
+// reporter returns the Reporter actions report to, writing to w in the
+// terminal format. In quiet mode only warnings, such as sync conflicts and
+// their prompts, get through.
+func (r *Runner) reporter(w io.Writer) actions.Reporter {
+	text := actions.NewTextReporter(w)
+	if !r.UI.Quiet() {
+		return text
+	}
+	return actions.ReporterFunc(func(e actions.Event) {
+		if e.Level >= actions.LevelWarn {
+			text.Report(e)
+		}
+	})
+}
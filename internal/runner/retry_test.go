@@ -0,0 +1,128 @@
+package runner
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/atomikpanda/dotular/internal/actions"
+	"github.com/atomikpanda/dotular/internal/config"
+	"github.com/atomikpanda/dotular/internal/ui"
+)
+
+// flakyAction fails the first failures runs, then succeeds.
+type flakyAction struct {
+	failures int
+	runs     int
+	err      error
+}
+
+func (a *flakyAction) Describe() string { return "flaky" }
+
+func (a *flakyAction) Run(ctx context.Context, dryRun bool) error {
+	a.runs++
+	if a.runs <= a.failures {
+		return a.err
+	}
+	return nil
+}
+
+func intPtr(n int) *int { return &n }
+
+func TestRetryPolicy(t *testing.T) {
+	tests := []struct {
+		name    string
+		item    config.Item
+		retries int
+		delay   time.Duration
+		wantErr bool
+	}{
+		{"run default", config.Item{Run: "x"}, 0, defaultRetryDelay, false},
+		{"binary default", config.Item{Binary: "x"}, defaultNetworkRetries, defaultRetryDelay, false},
+		{"remote script default", config.Item{Script: "https://x", Via: "remote"}, defaultNetworkRetries, defaultRetryDelay, false},
+		{"explicit zero", config.Item{Binary: "x", Retries: intPtr(0)}, 0, defaultRetryDelay, false},
+		{"explicit", config.Item{Package: "x", Retries: intPtr(3), RetryDelay: "1m"}, 3, time.Minute, false},
+		{"bad delay", config.Item{Run: "x", RetryDelay: "soon"}, 0, 0, true},
+		{"negative", config.Item{Run: "x", Retries: intPtr(-1)}, 0, 0, true},
+	}
+	for _, tt := range tests {
+		retries, delay, err := retryPolicy(tt.item)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: err = %v", tt.name, err)
+			continue
+		}
+		if !tt.wantErr && (retries != tt.retries || delay != tt.delay) {
+			t.Errorf("%s: got %d/%s, want %d/%s", tt.name, retries, delay, tt.retries, tt.delay)
+		}
+	}
+}
+
+func TestRunWithRetry(t *testing.T) {
+	r := newTestRunner(config.Config{})
+	item := config.Item{Run: "x", Retries: intPtr(2), RetryDelay: "1ms"}
+
+	a := &flakyAction{failures: 2, err: errors.New("boom")}
+	if err := r.runWithRetry(context.Background(), item, a); err != nil || a.runs != 3 {
+		t.Errorf("err = %v, runs = %d; want success after 3 runs", err, a.runs)
+	}
+
+	a = &flakyAction{failures: 5, err: errors.New("boom")}
+	if err := r.runWithRetry(context.Background(), item, a); err == nil || a.runs != 3 {
+		t.Errorf("err = %v, runs = %d; want failure after 3 runs", err, a.runs)
+	}
+
+	a = &flakyAction{failures: 5, err: actions.ErrSkipped}
+	if err := r.runWithRetry(context.Background(), item, a); !errors.Is(err, actions.ErrSkipped) || a.runs != 1 {
+		t.Errorf("err = %v, runs = %d; skips must not be retried", err, a.runs)
+	}
+}
+
+func TestRunWithRetryCanceled(t *testing.T) {
+	r := newTestRunner(config.Config{})
+	item := config.Item{Run: "x", Retries: intPtr(3), RetryDelay: "1h"}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	a := &flakyAction{failures: 5, err: errors.New("boom")}
+	if err := r.runWithRetry(ctx, item, a); !errors.Is(err, context.Canceled) {
+		t.Errorf("err = %v, want context.Canceled", err)
+	}
+}
+
+func TestReporterQuietKeepsWarnings(t *testing.T) {
+	var buf bytes.Buffer
+	r := &Runner{UI: ui.New(&buf, &bytes.Buffer{})}
+	r.UI.Level = ui.LevelQuiet
+	rep := r.reporter(&buf)
+	rep.Report(actions.Event{Level: actions.LevelInfo, Kind: actions.KindDryRun, Message: "run: x"})
+	rep.Report(actions.Event{Level: actions.LevelWarn, Kind: actions.KindConflict, Message: "CONFLICT: a"})
+	if got := buf.String(); strings.Contains(got, "run: x") || !strings.Contains(got, "CONFLICT: a") {
+		t.Errorf("quiet output = %q", got)
+	}
+}
+
+func TestMayPrompt(t *testing.T) {
+	tests := []struct {
+		name   string
+		item   config.Item
+		action actions.Action
+		want   bool
+	}{
+		{"apt package", config.Item{Package: "git", Via: "apt"}, &actions.PackageAction{Package: "git", Manager: "apt"}, true},
+		{"pacman package", config.Item{Package: "git", Via: "pacman"}, &actions.PackageAction{Package: "git", Manager: "pacman"}, true},
+		{"brew package", config.Item{Package: "git", Via: "brew"}, &actions.PackageAction{Package: "git", Manager: "brew"}, false},
+		{"apt repo", config.Item{Repo: "ppa:git-core/ppa", Via: "apt"}, &actions.RepoAction{Repo: "ppa:git-core/ppa", Manager: "apt"}, true},
+		{"dnf repo", config.Item{Repo: "owner/project", Via: "dnf"}, &actions.RepoAction{Repo: "owner/project", Manager: "dnf"}, true},
+		{"brew tap", config.Item{Repo: "owner/tap", Via: "brew"}, &actions.RepoAction{Repo: "owner/tap", Manager: "brew"}, false},
+		{"run", config.Item{Run: "sudo true"}, &flakyAction{}, true},
+		{"script", config.Item{Script: "setup.sh"}, &flakyAction{}, true},
+		{"binary", config.Item{Binary: "tool"}, &flakyAction{}, false},
+	}
+	for _, tt := range tests {
+		if got := mayPrompt(tt.item, tt.action); got != tt.want {
+			t.Errorf("%s: mayPrompt = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
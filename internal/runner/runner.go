@@ -1,5 +1,20 @@
 // Package runner orchestrates applying config modules, integrating idempotency,
 // hooks, atomic rollback, verification, audit logging, and machine tagging.
+//
+// A real apply plans only the static checks (platform, type and profile
+// filters, when). creates, the shell guards, and IsApplied run in
+// executeItems, through prepareItem and checkItem, just before each item,
+// so they see what earlier items did. plan and status evaluate them up
+// front instead.
+//
+// Dry runs execute no user command: ApplyModule plans without running
+// guards unless RunGuards is set (PlannedAction.Unchecked lists them), and
+// dryRunItem reports guards, item hooks, the item, and its verify checks in
+// run order.
+//
+// The runner checks ctx between modules and items and stops with
+// errs.ErrAborted, restoring the module in flight from its snapshot.
+// Commands that change what is deployed hold the config's run lock.
 package runner
 
 import (
@@ -7,8 +22,13 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"os"
 	"path/filepath"
+	"regexp"
+	"runtime"
+	"slices"
+	"strconv"
 	"strings"
 	"time"
 
@@ -16,17 +36,23 @@ import (
 	"github.com/atomikpanda/dotular/internal/ageutil"
 	"github.com/atomikpanda/dotular/internal/audit"
 	"github.com/atomikpanda/dotular/internal/config"
+	"github.com/atomikpanda/dotular/internal/errs"
+	"github.com/atomikpanda/dotular/internal/expr"
+	"github.com/atomikpanda/dotular/internal/notify"
 	"github.com/atomikpanda/dotular/internal/platform"
 	"github.com/atomikpanda/dotular/internal/shell"
 	"github.com/atomikpanda/dotular/internal/snapshot"
+	"github.com/atomikpanda/dotular/internal/state"
 	"github.com/atomikpanda/dotular/internal/tags"
+	tmpl "github.com/atomikpanda/dotular/internal/template"
 	"github.com/atomikpanda/dotular/internal/ui"
 )
 
 type itemOutcome int
 
 const (
-	outcomeApplied itemOutcome = iota
+	outcomeApplied   itemOutcome = iota
+	outcomeUnchanged             // ran without changing anything; counted as skipped
 	outcomeSkipped
 	outcomeFailed
 )
@@ -41,19 +67,57 @@ type ModuleResult struct {
 
 // Runner orchestrates applying config modules on the current platform.
 type Runner struct {
-	Config      config.Config
-	DryRun      bool
-	Verbose     bool
-	Atomic      bool // snapshot-and-rollback per module (default true)
-	OS          string
-	MachineTags []string
-	Out         io.Writer
-	UI          *ui.UI
-	AgeKey           *ageutil.Key
-	Command          string // "apply" | "push" | "pull" | "sync" | "verify" — for audit log
-	DirectionOverride string // when set, overrides direction on all non-link file items
+	Config            config.Config
+	DryRun            bool
+	Verbose           bool
+	Atomic            bool // snapshot-and-rollback per module (default true)
+	OS                string
+	MachineTags       []string
+	Out               io.Writer
+	UI                *ui.UI
+	AgeKey            *ageutil.Key
+	Command           string       // "apply" | "push" | "pull" | "sync" | "verify" — for audit log
+	DirectionOverride string       // when set, overrides direction on all non-link file items
+	KeepGoing         string       // KeepGoingModule | KeepGoingItem; empty aborts on the first failure
+	State             *state.State // deployed resources; nil disables tracking
+	StatePath         string
+	Hashes            *state.HashCache // content hashes for drift checks; nil re-reads every file
+	OnlyTypes         []string         // when set, only items of these types run (see ParseItemTypes)
+	SkipTypes         []string         // items of these types are skipped
+	NoCache           bool             // re-download binaries and remote scripts instead of revalidating cached copies
+	ShowDiff          bool             // in a dry run, print a diff under each file push that would modify its destination
+	RunGuards         bool             // in a dry run, still run skip_if/unless/only_if to decide what would apply (status)
+	Wait              bool             // when another process is applying the same config, wait for it instead of failing
+	ChangedOnly       bool             // skip modules whose config and store are unchanged since their last successful apply
+	// Item, when set, selects the only item of each module that runs (see
+	// config.Module.FindItem); the module is then not recorded as applied.
+	Item string
+	// Profile trims the run for an environment such as a dev container;
+	// set it with UseProfile.
+	Profile     config.Profile
+	ProfileName string
+	// ConfigPath is the config file that pulled state, such as the installed
+	// editor extensions, is written back to.
+	ConfigPath string
+	// Root is the repo directory that module stores (see config.StoreConfig)
+	// and local scripts are resolved against, normally the config file's
+	// directory. Empty means the current directory.
+	Root string
+
+	// Version is the dotular version recorded in the machine inventory.
+	Version string
+
+	plainHashesChanged bool              // State.PlainHashes learned entries not yet saved
+	applied            map[string]string // module hashes of this run's successful applies, for the machine inventory
+	totals             ModuleResult      // counts of the last ApplyAll or ApplyModules run
 }
 
+// Continue-on-error modes for Runner.KeepGoing.
+const (
+	KeepGoingModule = "module" // a failure skips the rest of its module; other modules still run
+	KeepGoingItem   = "item"   // a failure skips only the failing item
+)
+
 // New creates a Runner for the current platform, resolving age credentials and
 // machine tags automatically.
 func New(cfg config.Config, dryRun, verbose, atomic bool) *Runner {
@@ -68,47 +132,200 @@ func New(cfg config.Config, dryRun, verbose, atomic bool) *Runner {
 	}
 	r.UI = ui.New(r.Out, os.Stderr)
 
-	r.AgeKey = resolveAgeKey(cfg.Age)
+	r.AgeKey = ageutil.FromConfig(cfg.Age, cfg.Shell)
 	r.MachineTags = loadMachineTags()
+	if path, err := state.DefaultPath(); err == nil {
+		if st, err := state.Load(path); err == nil {
+			r.State, r.StatePath = st, path
+		} else {
+			r.UI.Warn(fmt.Sprintf("state tracking disabled: %v", err))
+		}
+	}
+	if path, err := state.DefaultHashCachePath(); err == nil {
+		r.Hashes = state.LoadHashCache(path)
+	}
 	return r
 }
 
 // --- public apply API --------------------------------------------------------
 
-// ApplyAll applies every module in order, respecting tag filters.
+// ApplyAll applies every module in order, respecting tag filters. Each module
+// is planned immediately before it is executed so that later modules observe
+// the effects of earlier ones (e.g. a package manager installed by a prior
+// module).
 func (r *Runner) ApplyAll(ctx context.Context) error {
+	return r.applyModules(ctx, r.Config.Modules, true)
+}
+
+// ApplyModules applies the given modules in order without tag filtering, as
+// when modules are named explicitly on the command line.
+func (r *Runner) ApplyModules(ctx context.Context, mods []config.Module) error {
+	return r.applyModules(ctx, mods, false)
+}
+
+func (r *Runner) applyModules(ctx context.Context, mods []config.Module, filterTags bool) (err error) {
+	switch r.KeepGoing {
+	case "", KeepGoingModule, KeepGoingItem:
+	default:
+		return fmt.Errorf("invalid keep-going mode %q (want %q or %q)", r.KeepGoing, KeepGoingModule, KeepGoingItem)
+	}
+	if !r.DryRun && r.ConfigPath != "" {
+		l, err := r.lock(ctx)
+		if err != nil {
+			return err
+		}
+		defer l.Release()
+	}
+
 	start := time.Now()
 	var totalApplied, totalSkipped, totalFailed int
-	var firstErr error
+	var errs []error
 
 	defer func() {
-		r.UI.Summary(totalApplied, totalSkipped, totalFailed, time.Since(start))
+		r.saveState()
+		r.registerMachine()
+		r.totals = ModuleResult{Applied: totalApplied, Skipped: totalSkipped, Failed: totalFailed, Err: err}
+		elapsed := time.Since(start)
+		r.UI.Summary(totalApplied, totalSkipped, totalFailed, elapsed)
+		if err != nil && ctx.Err() != nil {
+			audit.Log(audit.Entry{Command: r.Command, Item: "run", Outcome: "aborted", Error: err.Error()})
+		}
+		r.sendNotification(ctx, notify.Event{
+			Applied: totalApplied, Skipped: totalSkipped, Failed: totalFailed, Duration: elapsed,
+		}, err)
 	}()
 
-	for _, mod := range r.Config.Modules {
-		if !r.matchesTags(mod) {
+	// One batch per run, so a "for all" conflict answer carries across modules.
+	ctx = actions.WithConflictBatch(ctx, &actions.ConflictBatch{})
+
+	hooks := r.Config.Hooks
+	if err := r.runHook(ctx, hooks.BeforeAll, "run", r.Command, "before_all", hookEnv{}); err != nil {
+		return r.runFailureHook(ctx, err)
+	}
+
+	for _, mod := range mods {
+		if filterTags && !r.matchesTags(mod) {
 			if r.Verbose {
 				r.UI.SkipHeader(mod.Name, "tag mismatch")
 			}
 			continue
 		}
+		if r.ChangedOnly && r.unchangedSinceApply(mod) {
+			if r.Verbose {
+				r.UI.SkipHeader(mod.Name, "unchanged since last apply")
+			}
+			continue
+		}
 		result := r.ApplyModule(ctx, mod)
 		totalApplied += result.Applied
 		totalSkipped += result.Skipped
 		totalFailed += result.Failed
 		if result.Err != nil {
-			firstErr = result.Err
-			break
+			errs = append(errs, result.Err)
+			if r.KeepGoing == "" || ctx.Err() != nil {
+				break
+			}
 		}
 	}
-	return firstErr
+
+	if r.KeepGoing != "" && len(errs) > 0 {
+		r.UI.Warn(fmt.Sprintf("%d module(s) failed:", len(errs)))
+		for _, err := range errs {
+			r.UI.Warn("  " + err.Error())
+		}
+	}
+	if len(errs) > 0 {
+		return r.runFailureHook(ctx, errors.Join(errs...))
+	}
+	if err := r.runHook(ctx, hooks.AfterAll, "run", r.Command, "after_all", hookEnv{Outcome: "success"}); err != nil {
+		return r.runFailureHook(ctx, err)
+	}
+	return nil
+}
+
+// Totals returns the item counts of the last ApplyAll or ApplyModules run.
+// After a dry run, Applied counts the items that would change.
+func (r *Runner) Totals() ModuleResult { return r.totals }
+
+// postRunTimeout bounds the on_failure hook and the notifications of a run,
+// which still run after an interrupt has cancelled the run's context.
+const postRunTimeout = time.Minute
+
+// postRunContext returns a context for the work that reports a finished
+// run: it keeps ctx's values but not its cancellation, and expires after
+// postRunTimeout.
+func postRunContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.WithoutCancel(ctx), postRunTimeout)
+}
+
+// runFailureHook runs the global on_failure hook for a failed run and returns
+// runErr joined with any error from the hook itself. It runs even when ctx
+// was cancelled by an interrupt.
+func (r *Runner) runFailureHook(ctx context.Context, runErr error) error {
+	ctx, cancel := postRunContext(ctx)
+	defer cancel()
+	if err := r.runHook(ctx, r.Config.Hooks.OnFailure, "run", r.Command, "on_failure", hookEnv{Outcome: "failure"}); err != nil {
+		return errors.Join(runErr, err)
+	}
+	return runErr
+}
+
+// sendNotification reports a finished run through the configured notify
+// channels. Delivery problems are warnings and never fail the run.
+func (r *Runner) sendNotification(ctx context.Context, ev notify.Event, runErr error) {
+	if r.DryRun {
+		return
+	}
+	ev.Command = r.Command
+	ev.Outcome = "success"
+	if runErr != nil {
+		ev.Outcome = "failure"
+		ev.Error = runErr.Error()
+	}
+	if !notify.Wants(r.Config.Notify, ev.Outcome) {
+		return
+	}
+	// An interrupted run is still reported.
+	ctx, cancel := postRunContext(ctx)
+	defer cancel()
+	if err := notify.Send(ctx, r.Config.Notify, ev); err != nil {
+		r.UI.Warn(err.Error())
+	}
 }
 
-// ApplyModule applies a single module with hooks, snapshot/rollback, and audit.
+// ApplyModule plans and then executes a single module.
 func (r *Runner) ApplyModule(ctx context.Context, mod config.Module) ModuleResult {
+	mode := checkLater
+	if r.DryRun {
+		mode = checkListed
+		if r.RunGuards {
+			mode = checkNow
+		}
+	}
+	mp, err := r.planModule(ctx, mod, mode)
+	if err != nil {
+		r.UI.Header(mod.Name)
+		return ModuleResult{Failed: 1, Err: err}
+	}
+	return r.Execute(ctx, mp)
+}
+
+// Execute carries out a module plan with hooks, snapshot/rollback, and audit.
+// In dry-run mode each planned action is printed instead of run.
+func (r *Runner) Execute(ctx context.Context, mp ModulePlan) ModuleResult {
+	mod := mp.config
+	if mp.Skipped {
+		if r.Verbose {
+			r.UI.SkipHeader(mod.Name, mp.Reason)
+		}
+		return ModuleResult{}
+	}
+	if ctx.Err() != nil {
+		return ModuleResult{Err: abortErr(ctx, mod.Name)}
+	}
 	r.UI.Header(mod.Name)
 
-	if err := r.runHook(ctx, mod.Hooks.BeforeApply, "module", mod.Name, "before_apply"); err != nil {
+	if err := r.runHook(ctx, mod.Hooks.BeforeApply, "module", mod.Name, "before_apply", hookEnv{Module: mod.Name}); err != nil {
 		return ModuleResult{Err: err}
 	}
 
@@ -121,10 +338,17 @@ func (r *Runner) ApplyModule(ctx context.Context, mod config.Module) ModuleResul
 		}
 	}
 
-	applied, skipped, failed, applyErr := r.applyItems(ctx, mod, snap)
+	applied, skipped, failed, applyErr := r.executeItems(ctx, mp, snap)
 
-	if applyErr != nil && snap != nil {
-		r.UI.Warn(fmt.Sprintf("[rollback] restoring snapshot after failure in %q", mod.Name))
+	// With KeepGoingItem, failed items were rolled back one by one and the
+	// ones that succeeded are kept; only an interrupt restores the module.
+	itemsRolledBack := r.KeepGoing == KeepGoingItem && failed > 0 && !errors.Is(applyErr, errs.ErrAborted)
+	if applyErr != nil && snap != nil && !itemsRolledBack {
+		cause := "failure"
+		if errors.Is(applyErr, errs.ErrAborted) {
+			cause = "interrupt"
+		}
+		r.UI.Warn(fmt.Sprintf("[rollback] restoring snapshot after %s in %q", cause, mod.Name))
 		if restoreErr := snap.Restore(); restoreErr != nil {
 			r.UI.Warn(fmt.Sprintf("[rollback] restore error: %v", restoreErr))
 		}
@@ -141,11 +365,14 @@ func (r *Runner) ApplyModule(ctx context.Context, mod config.Module) ModuleResul
 		return ModuleResult{Applied: applied, Skipped: skipped, Failed: failed, Err: applyErr}
 	}
 
-	if err := r.runHook(ctx, mod.Hooks.AfterApply, "module", mod.Name, "after_apply"); err != nil {
+	if err := r.runHook(ctx, mod.Hooks.AfterApply, "module", mod.Name, "after_apply", hookEnv{Module: mod.Name, Outcome: "success"}); err != nil {
 		r.UI.ModuleSummary(applied, skipped, failed)
 		return ModuleResult{Applied: applied, Skipped: skipped, Failed: failed, Err: err}
 	}
 
+	if failed == 0 && r.Item == "" {
+		r.recordModule(mod)
+	}
 	r.UI.ModuleSummary(applied, skipped, failed)
 	return ModuleResult{Applied: applied, Skipped: skipped, Failed: failed}
 }
@@ -154,20 +381,46 @@ func (r *Runner) ApplyModule(ctx context.Context, mod config.Module) ModuleResul
 
 // VerifyAll runs verify checks for all modules, returning an error if any fail.
 func (r *Runner) VerifyAll(ctx context.Context) (allPassed bool, err error) {
-	allPassed = true
-	for _, mod := range r.Config.Modules {
-		if !r.matchesTags(mod) {
+	return r.verifyModules(ctx, r.Config.Modules, true)
+}
+
+// VerifyModules runs verify checks for the given modules without tag
+// filtering, as when modules are named explicitly on the command line.
+func (r *Runner) VerifyModules(ctx context.Context, mods []config.Module) (allPassed bool, err error) {
+	return r.verifyModules(ctx, mods, false)
+}
+
+// verifyModules verifies mods and reports the result through the configured
+// notifications, counting each module with a failed check as one failure.
+func (r *Runner) verifyModules(ctx context.Context, mods []config.Module, filterTags bool) (allPassed bool, err error) {
+	start := time.Now()
+	passed, failed := 0, 0
+	defer func() {
+		runErr := err
+		if runErr == nil && failed > 0 {
+			runErr = fmt.Errorf("verify checks failed in %d module(s)", failed)
+		}
+		r.sendNotification(ctx, notify.Event{Applied: passed, Failed: failed, Duration: time.Since(start)}, runErr)
+	}()
+
+	for _, mod := range mods {
+		if filterTags && !r.matchesTags(mod) {
 			continue
 		}
-		passed, err := r.VerifyModule(ctx, mod)
+		if ctx.Err() != nil {
+			return false, abortErr(ctx, mod.Name)
+		}
+		ok, err := r.VerifyModule(ctx, mod)
 		if err != nil {
 			return false, err
 		}
-		if !passed {
-			allPassed = false
+		if ok {
+			passed++
+		} else {
+			failed++
 		}
 	}
-	return allPassed, nil
+	return failed == 0, nil
 }
 
 // VerifyModule runs verify commands for every item in the module that defines one.
@@ -177,8 +430,20 @@ func (r *Runner) VerifyModule(ctx context.Context, mod config.Module) (allPassed
 	r.UI.Header(mod.Name)
 	allPassed = true
 
-	for _, item := range mod.Items {
-		if item.Verify == "" {
+	items, err := r.expandItems(mod)
+	if err != nil {
+		return false, fmt.Errorf("module %q: %w", mod.Name, err)
+	}
+	defer r.savePlainHashes()
+
+	for _, item := range items {
+		if ctx.Err() != nil {
+			return false, abortErr(ctx, mod.Name)
+		}
+		// Copied secrets are always checked for freshness against the repo.
+		checkSecret := item.Type() == "file" && item.Encrypted && !item.Link &&
+			r.fileDirection(item) != "pull"
+		if !item.HasVerify() && !checkSecret {
 			if r.Verbose {
 				r.UI.Skip("no verify", item.Type())
 			}
@@ -189,23 +454,39 @@ func (r *Runner) VerifyModule(ctx context.Context, mod config.Module) (allPassed
 		if buildErr != nil || skip {
 			continue
 		}
+		if matched, err := r.whenMatches(item); err != nil {
+			return false, fmt.Errorf("module %q: %w", mod.Name, err)
+		} else if !matched {
+			if r.Verbose {
+				r.UI.Skip("when", label(item, action))
+			}
+			continue
+		}
 
 		start := time.Now()
-		verifyErr := shell.Run(ctx, item.Verify)
+		var verifyErr error
+		if fa, ok := action.(*actions.FileAction); ok && checkSecret {
+			if d := r.fileDrift(mod.Name, fa); d.Status != DriftInSync {
+				verifyErr = fmt.Errorf("secret %s", d.Status)
+			}
+		}
+		if verifyErr == nil && item.HasVerify() {
+			verifyErr = r.verifyItem(ctx, item, action)
+		}
 		dur := time.Since(start)
 		outcome := "success"
 		if verifyErr != nil {
 			outcome = "failure"
 			allPassed = false
-			r.UI.ItemResult(action.Describe(), dur, verifyErr)
+			r.UI.ItemResult(label(item, action), dur, verifyErr)
 		} else {
-			r.UI.ItemResult(action.Describe(), dur, nil)
+			r.UI.ItemResult(label(item, action), dur, nil)
 		}
 
 		audit.Log(audit.Entry{
 			Command: "verify",
 			Module:  mod.Name,
-			Item:    action.Describe(),
+			Item:    label(item, action),
 			Outcome: outcome,
 		})
 	}
@@ -214,8 +495,11 @@ func (r *Runner) VerifyModule(ctx context.Context, mod config.Module) (allPassed
 
 // --- internal apply flow -----------------------------------------------------
 
-// applyItems applies every item in the module, firing sync hooks around sync items.
-func (r *Runner) applyItems(ctx context.Context, mod config.Module, snap *snapshot.Snapshot) (applied, skipped, failed int, err error) {
+// executeItems executes every planned action in the module, firing sync hooks
+// around sync items. With KeepGoingItem a failing item does not stop the
+// remaining items; all item errors are returned together.
+func (r *Runner) executeItems(ctx context.Context, mp ModulePlan, snap *snapshot.Snapshot) (applied, skipped, failed int, err error) {
+	mod := mp.config
 	hasSyncItem := false
 	for _, item := range mod.Items {
 		t := item.Type()
@@ -226,163 +510,409 @@ func (r *Runner) applyItems(ctx context.Context, mod config.Module, snap *snapsh
 	}
 
 	if hasSyncItem {
-		if err := r.runHook(ctx, mod.Hooks.BeforeSync, "module", mod.Name, "before_sync"); err != nil {
+		if err := r.runHook(ctx, mod.Hooks.BeforeSync, "module", mod.Name, "before_sync", hookEnv{Module: mod.Name}); err != nil {
 			return applied, skipped, failed, err
 		}
 	}
 
-	for _, item := range mod.Items {
-		outcome, itemErr := r.applyItem(ctx, mod, item, snap)
+	var errs []error
+	var restarts []string        // processes to restart once the items ran
+	vars := make(map[string]any) // values registered by run items
+	for _, pa := range mp.Actions {
+		if ctx.Err() != nil {
+			return applied, skipped, failed, abortErr(ctx, mod.Name)
+		}
+		var err error
+		if pa, err = r.prepareItem(ctx, pa, mod.Name, vars); err != nil {
+			itemErr := fmt.Errorf("module %q: %w", mod.Name, err)
+			failed++
+			if r.KeepGoing != KeepGoingItem {
+				return applied, skipped, failed, itemErr
+			}
+			errs = append(errs, itemErr)
+			continue
+		}
+		itemSnap, snapErr := r.itemSnapshot(snap, mod.Name, pa)
+		if snapErr != nil {
+			failed++
+			if r.KeepGoing != KeepGoingItem {
+				return applied, skipped, failed, snapErr
+			}
+			errs = append(errs, snapErr)
+			continue
+		}
+		outcome, itemErr := r.executeItem(ctx, mod, pa, itemSnap)
+		if itemSnap != snap {
+			if itemErr != nil && ctx.Err() == nil {
+				r.UI.Warn(fmt.Sprintf("[rollback] restoring %s after failure in %q", label(pa.Item, pa.Action), mod.Name))
+				if restoreErr := itemSnap.Restore(); restoreErr != nil {
+					r.UI.Warn(fmt.Sprintf("[rollback] restore error: %v", restoreErr))
+				}
+			}
+			itemSnap.Discard()
+		}
+		ran := outcome == outcomeApplied || outcome == outcomeUnchanged
+		if name := pa.Item.Register; name != "" && ran {
+			if ra, ok := pa.Action.(*actions.RunAction); ok {
+				vars[name] = strings.TrimRight(ra.Output(), "\r\n")
+			}
+		}
+		if rs, ok := pa.Action.(actions.Restarter); ok && outcome == outcomeApplied {
+			for _, name := range rs.Restarts() {
+				if !slices.Contains(restarts, name) {
+					restarts = append(restarts, name)
+				}
+			}
+		}
 		switch outcome {
 		case outcomeApplied:
 			applied++
-		case outcomeSkipped:
+		case outcomeSkipped, outcomeUnchanged:
 			skipped++
 		case outcomeFailed:
 			failed++
 		}
 		if itemErr != nil {
-			return applied, skipped, failed, itemErr
+			if r.KeepGoing != KeepGoingItem || ctx.Err() != nil {
+				return applied, skipped, failed, itemErr
+			}
+			errs = append(errs, itemErr)
 		}
 	}
+	r.restartApps(ctx, mod.Name, restarts)
+	if len(errs) > 0 {
+		return applied, skipped, failed, errors.Join(errs...)
+	}
 
 	if hasSyncItem {
-		if err := r.runHook(ctx, mod.Hooks.AfterSync, "module", mod.Name, "after_sync"); err != nil {
+		if err := r.runHook(ctx, mod.Hooks.AfterSync, "module", mod.Name, "after_sync", hookEnv{Module: mod.Name, Outcome: "success"}); err != nil {
 			return applied, skipped, failed, err
 		}
 	}
 	return applied, skipped, failed, nil
 }
 
-func (r *Runner) applyItem(ctx context.Context, mod config.Module, item config.Item, snap *snapshot.Snapshot) (itemOutcome, error) {
-	action, skip, err := r.buildAction(item, mod.Name)
+// itemSnapshot returns the snapshot pa's destination is recorded in. With
+// KeepGoingItem a file or directory item gets a snapshot of its own, so that
+// its failure rolls back only that item, and its destination is also
+// recorded in the module snapshot, which an interrupt still restores whole.
+func (r *Runner) itemSnapshot(snap *snapshot.Snapshot, module string, pa PlannedAction) (*snapshot.Snapshot, error) {
+	if _, ok := pa.Action.(targeted); !ok || snap == nil || r.KeepGoing != KeepGoingItem || pa.Status != StatusApply {
+		return snap, nil
+	}
+	if err := snapshotTarget(snap, module, pa.Action); err != nil {
+		return nil, err
+	}
+	itemSnap, err := snapshot.New()
 	if err != nil {
-		return outcomeFailed, fmt.Errorf("module %q: %w", mod.Name, err)
+		return nil, fmt.Errorf("module %q: create snapshot: %w", module, err)
 	}
-	if skip {
-		if r.Verbose {
-			r.UI.Skip(item.Type()+" not applicable on "+r.OS, item.Type())
+	return itemSnap, nil
+}
+
+// abortErr is the error a module stops with when ctx is cancelled, such as
+// by Ctrl-C.
+func abortErr(ctx context.Context, module string) error {
+	return fmt.Errorf("module %q: %w (%w)", module, errs.ErrAborted, context.Cause(ctx))
+}
+
+// maxDryRunDiffLines caps each diff printed by --diff.
+const maxDryRunDiffLines = 40
+
+// dryRunItem reports everything applying pa would run, in order, without
+// running any of it: the guard commands left unchecked at plan time, the
+// item's hooks, the item itself, and its verify checks. Actions that
+// implement actions.Previewer also report whether their destination would
+// change; an unchanged one counts as skipped.
+func (r *Runner) dryRunItem(ctx context.Context, module string, pa PlannedAction, isSync bool) itemOutcome {
+	item, action := pa.Item, pa.Action
+	desc := label(item, action)
+	for _, guard := range pa.Unchecked {
+		r.UI.DryRun("check " + guard)
+	}
+	r.runHook(ctx, item.Hooks.BeforeApply, "item", desc, "before_apply", hookEnv{})
+	if isSync {
+		r.runHook(ctx, item.Hooks.BeforeSync, "item", desc, "before_sync", hookEnv{})
+	}
+
+	var ch actions.Change
+	if p, ok := action.(actions.Previewer); ok {
+		if c, err := p.Preview(ctx); err == nil {
+			ch = c
+		} else {
+			r.UI.Debug(fmt.Sprintf("preview %s: %v", desc, err))
 		}
-		return outcomeSkipped, nil
+	}
+	if ch.Kind == "" {
+		r.UI.DryRun(desc)
+	} else {
+		r.UI.DryRunChange(desc, ch.Kind)
+		if r.ShowDiff {
+			r.UI.DryRunDiff(ch.Diff, maxDryRunDiffLines)
+		}
+	}
+	for _, check := range verifyChecks(item) {
+		r.UI.DryRun(check)
 	}
 
-	// --- skip_if ---
-	if item.SkipIf != "" {
-		exitsZero, err := shell.Eval(ctx, item.SkipIf)
+	if isSync {
+		r.runHook(ctx, item.Hooks.AfterSync, "item", desc, "after_sync", hookEnv{})
+	}
+	r.runHook(ctx, item.Hooks.AfterApply, "item", desc, "after_apply", hookEnv{})
+
+	outcome, auditOutcome := outcomeApplied, "success"
+	if ch.Kind == actions.ChangeUnchanged {
+		outcome, auditOutcome = outcomeSkipped, "skipped"
+	}
+	audit.Log(audit.Entry{Command: r.Command, Module: module, Item: desc, Outcome: auditOutcome})
+	return outcome
+}
+
+// restartApps restarts each named process so that preference changes made
+// by the module's items take effect. A failed restart is reported but does
+// not fail the module: the change is in place and applies at next launch.
+func (r *Runner) restartApps(ctx context.Context, module string, names []string) {
+	for _, name := range names {
+		desc := "restart " + name
+		if r.DryRun {
+			r.UI.DryRun(desc)
+			continue
+		}
+		start := time.Now()
+		err := actions.RestartApp(ctx, name)
 		if err != nil {
-			return outcomeFailed, fmt.Errorf("module %q: skip_if eval failed: %w", mod.Name, err)
+			r.UI.Warn(err.Error())
+		} else {
+			r.UI.ItemResult(desc, time.Since(start), nil)
 		}
-		if exitsZero {
-			if r.Verbose {
-				r.UI.Skip("skip_if", action.Describe())
-			}
-			audit.Log(audit.Entry{Command: r.Command, Module: mod.Name, Item: action.Describe(), Outcome: "skipped"})
-			return outcomeSkipped, nil
+		outcome, errMsg := "success", ""
+		if err != nil {
+			outcome, errMsg = "failure", err.Error()
 		}
+		audit.Log(audit.Entry{Command: r.Command, Module: module, Item: desc, Outcome: outcome, Error: errMsg})
 	}
+}
 
-	// --- auto-idempotency ---
-	if idem, ok := action.(actions.Idempotent); ok {
-		applied, err := idem.IsApplied(ctx)
-		if err != nil {
-			return outcomeFailed, fmt.Errorf("module %q: idempotency check: %w", mod.Name, err)
+// prepareItem readies pa to run once the items before it have: it renders
+// the values they registered into it and then, when the plan left them to
+// now, runs its guards and idempotency check, so they see what those items
+// did.
+func (r *Runner) prepareItem(ctx context.Context, pa PlannedAction, module string, vars map[string]any) (PlannedAction, error) {
+	if pa.Status != StatusApply {
+		return pa, nil
+	}
+	if len(vars) > 0 {
+		var err error
+		if pa, err = r.renderRegistered(pa, module, vars); err != nil {
+			return pa, err
 		}
-		if applied {
-			if r.Verbose {
-				r.UI.Skip("already applied", action.Describe())
-			}
-			audit.Log(audit.Entry{Command: r.Command, Module: mod.Name, Item: action.Describe(), Outcome: "skipped"})
-			return outcomeSkipped, nil
+	}
+	if pa.pending {
+		return r.checkItem(ctx, pa, true)
+	}
+	return pa, nil
+}
+
+// renderRegistered renders registered run output into pa's item and rebuilds
+// its action.
+func (r *Runner) renderRegistered(pa PlannedAction, module string, vars map[string]any) (PlannedAction, error) {
+	item, err := tmpl.RenderItem(pa.Item, vars)
+	if err != nil {
+		return pa, err
+	}
+	action, _, err := r.buildAction(item, module)
+	if err != nil {
+		return pa, err
+	}
+	if action == nil {
+		return pa, nil
+	}
+	pa.Item, pa.Action, pa.Description = item, action, label(item, action)
+	return pa, nil
+}
+
+func (r *Runner) executeItem(ctx context.Context, mod config.Module, pa PlannedAction, snap *snapshot.Snapshot) (itemOutcome, error) {
+	item, action := pa.Item, pa.Action
+
+	if pa.Status == StatusSkip {
+		if r.Verbose {
+			r.UI.Skip(pa.Reason, pa.Description)
+		}
+		if action != nil {
+			audit.Log(audit.Entry{Command: r.Command, Module: mod.Name, Item: pa.Description, Outcome: "skipped"})
 		}
+		return outcomeSkipped, nil
 	}
 
 	// --- item hooks: before ---
+	desc := label(item, action)
+	itemEnv := hookEnv{Module: mod.Name, Item: desc}
 	itemType := item.Type()
 	isSync := (itemType == "file" || itemType == "directory") && r.fileDirection(item) == "sync"
-	if err := r.runHook(ctx, item.Hooks.BeforeApply, "item", action.Describe(), "before_apply"); err != nil {
+	if r.DryRun {
+		return r.dryRunItem(ctx, mod.Name, pa, isSync), nil
+	}
+	if err := r.runHook(ctx, item.Hooks.BeforeApply, "item", desc, "before_apply", itemEnv); err != nil {
 		return outcomeFailed, fmt.Errorf("module %q: %w", mod.Name, err)
 	}
 	if isSync {
-		if err := r.runHook(ctx, item.Hooks.BeforeSync, "item", action.Describe(), "before_sync"); err != nil {
+		if err := r.runHook(ctx, item.Hooks.BeforeSync, "item", desc, "before_sync", itemEnv); err != nil {
 			return outcomeFailed, fmt.Errorf("module %q: %w", mod.Name, err)
 		}
 	}
 
 	// --- snapshot destination before modification ---
-	if snap != nil && itemType == "file" {
-		if fa, ok := action.(*actions.FileAction); ok {
-			destPath := fa.ResolvedTarget()
-			if err := snap.Record(destPath); err != nil {
-				return outcomeFailed, fmt.Errorf("module %q: snapshot %s: %w", mod.Name, destPath, err)
-			}
-		}
-	}
-	if snap != nil && itemType == "directory" {
-		if da, ok := action.(*actions.DirectoryAction); ok {
-			destPath := da.ResolvedTarget()
-			if err := snap.Record(destPath); err != nil {
-				return outcomeFailed, fmt.Errorf("module %q: snapshot %s: %w", mod.Name, destPath, err)
-			}
-		}
+	if err := snapshotTarget(snap, mod.Name, action); err != nil {
+		return outcomeFailed, err
 	}
 
 	// --- run ---
-	if r.DryRun {
-		r.UI.DryRun(action.Describe())
-		audit.Log(audit.Entry{Command: r.Command, Module: mod.Name, Item: action.Describe(), Outcome: "success"})
-		return outcomeApplied, nil
-	}
-
-	if fa, ok := action.(*actions.FileAction); ok && fa.Permissions != "" {
-		if ps := fa.PermissionsStatus(); ps != "" {
-			r.UI.Info("     " + ps)
+	if !r.UI.Quiet() {
+		for _, status := range attributeStatus(action) {
+			r.UI.Info("     " + status)
 		}
 	}
+	r.UI.Debug(fmt.Sprintf("%s item %d: %s", pa.Type, pa.Index, pa.Description))
+	if t, ok := action.(targeted); ok {
+		r.UI.Debug(fmt.Sprintf("paths: %s -> %s", t.RepoPath(), t.ResolvedTarget()))
+	}
+	if pa.Current != "" || pa.Desired != "" {
+		r.UI.Debug(fmt.Sprintf("state: %s => %s", pa.Current, pa.Desired))
+	}
 
+	ctx = actions.WithConflictLog(ctx, func(path, resolution string) {
+		audit.Log(audit.Entry{Command: r.Command, Module: mod.Name, Item: "conflict " + path, Outcome: "resolved", Detail: resolution})
+	})
 	start := time.Now()
-	runErr := action.Run(ctx, false)
+	runErr := r.runWithProgress(ctx, item, action)
 
 	if runErr != nil && errors.Is(runErr, actions.ErrSkipped) {
 		msg := strings.TrimSuffix(runErr.Error(), ": "+actions.ErrSkipped.Error())
-		r.UI.Skip(msg, action.Describe())
-		audit.Log(audit.Entry{Command: r.Command, Module: mod.Name, Item: action.Describe(), Outcome: "skipped"})
+		r.UI.Skip(msg, desc)
+		audit.Log(audit.Entry{Command: r.Command, Module: mod.Name, Item: desc, Outcome: "skipped"})
 		return outcomeSkipped, nil
 	}
 
-	r.UI.ItemResult(action.Describe(), time.Since(start), runErr)
+	changed := runErr != nil || r.changed(item, action)
+	if changed {
+		r.UI.ItemResult(desc, time.Since(start), runErr)
+	} else {
+		r.UI.ItemUnchanged(desc, time.Since(start))
+	}
 
 	outcome, errMsg := "success", ""
+	if !changed {
+		outcome = "unchanged"
+	}
 	if runErr != nil {
 		outcome, errMsg = "failure", runErr.Error()
+		if ctx.Err() != nil {
+			outcome = "aborted"
+		}
 	}
-	audit.Log(audit.Entry{Command: r.Command, Module: mod.Name, Item: action.Describe(), Outcome: outcome, Error: errMsg})
+	audit.Log(audit.Entry{Command: r.Command, Module: mod.Name, Item: desc, Outcome: outcome, Error: errMsg, DurationMS: time.Since(start).Milliseconds()})
 
 	if runErr != nil {
+		if ctx.Err() != nil {
+			return outcomeFailed, abortErr(ctx, mod.Name)
+		}
+		if errors.Is(runErr, fs.ErrPermission) && !errors.Is(runErr, errs.ErrNeedsElevation) {
+			runErr = fmt.Errorf("%w: %w", errs.ErrNeedsElevation, runErr)
+		}
 		return outcomeFailed, fmt.Errorf("module %q: %w", mod.Name, runErr)
 	}
+	r.recordState(mod.Name, action)
 
 	// --- verify ---
-	if item.Verify != "" {
-		if err := shell.Run(ctx, item.Verify); err != nil {
-			return outcomeFailed, fmt.Errorf("module %q: verify failed for %q: %w", mod.Name, action.Describe(), err)
+	if item.HasVerify() {
+		if err := r.verifyItem(ctx, item, action); err != nil {
+			return outcomeFailed, fmt.Errorf("module %q: verify failed for %q: %w", mod.Name, desc, err)
 		}
 	}
 
 	// --- item hooks: after ---
+	itemEnv.Outcome = "success"
 	if isSync {
-		if err := r.runHook(ctx, item.Hooks.AfterSync, "item", action.Describe(), "after_sync"); err != nil {
+		if err := r.runHook(ctx, item.Hooks.AfterSync, "item", desc, "after_sync", itemEnv); err != nil {
 			return outcomeFailed, fmt.Errorf("module %q: %w", mod.Name, err)
 		}
 	}
-	if err := r.runHook(ctx, item.Hooks.AfterApply, "item", action.Describe(), "after_apply"); err != nil {
+	if err := r.runHook(ctx, item.Hooks.AfterApply, "item", desc, "after_apply", itemEnv); err != nil {
 		return outcomeFailed, fmt.Errorf("module %q: %w", mod.Name, err)
 	}
 
+	if !changed {
+		return outcomeUnchanged, nil
+	}
 	return outcomeApplied, nil
 }
 
+// snapshotTarget records the destination of a file or directory action in
+// snap, when there is one, before the action changes it.
+func snapshotTarget(snap *snapshot.Snapshot, module string, action actions.Action) error {
+	t, ok := action.(targeted)
+	if !ok || snap == nil {
+		return nil
+	}
+	destPath := t.ResolvedTarget()
+	var limit int64
+	if da, ok := action.(*actions.DirectoryAction); ok {
+		limit = da.MaxFileSize
+	}
+	if err := snap.RecordLimit(destPath, limit); err != nil {
+		return fmt.Errorf("module %q: snapshot %s: %w", module, destPath, err)
+	}
+	return nil
+}
+
+// label is how item is named in output, hooks, and the audit log: its name
+// when it sets one, else its action's description.
+func label(item config.Item, action actions.Action) string {
+	if item.Name != "" {
+		return item.Name
+	}
+	return action.Describe()
+}
+
+// changed reports whether a successful run of item changed anything. Only
+// run items can say otherwise, through changed_when or creates.
+func (r *Runner) changed(item config.Item, action actions.Action) bool {
+	ra, ok := action.(*actions.RunAction)
+	if !ok {
+		return true
+	}
+	if item.ChangedWhen != "" {
+		re, err := regexp.Compile(item.ChangedWhen)
+		return err != nil || re.MatchString(ra.Output())
+	}
+	if item.Creates != "" {
+		return r.createsExists(item.Creates)
+	}
+	return true
+}
+
 // --- action builder ----------------------------------------------------------
 
+// targeted is implemented by file and directory actions, which deploy a
+// repo path to a system path.
+type targeted interface {
+	RepoPath() string
+	ResolvedTarget() string
+}
+
+// attributeStatus returns the permission and ownership annotations for file
+// and directory actions that configure them.
+func attributeStatus(action actions.Action) []string {
+	var out []string
+	switch a := action.(type) {
+	case *actions.FileAction:
+		out = append(out, a.PermissionsStatus(), a.OwnershipStatus())
+	case *actions.DirectoryAction:
+		out = append(out, a.PermissionsStatus(), a.OwnershipStatus())
+	}
+	return slices.DeleteFunc(out, func(s string) bool { return s == "" })
+}
+
 // fileDirection returns the effective direction for a file item, applying any
 // DirectionOverride. Link items are always push and are never overridden.
 func (r *Runner) fileDirection(item config.Item) string {
@@ -393,25 +923,54 @@ func (r *Runner) fileDirection(item config.Item) string {
 }
 
 func (r *Runner) buildAction(item config.Item, moduleName ...string) (actions.Action, bool, error) {
-	// sourcePrefix prepends the module name directory to a repo-side path.
+	// sourcePrefix resolves a repo-side path inside the module's store.
 	sourcePrefix := func(name string) string {
 		if len(moduleName) > 0 && moduleName[0] != "" {
-			return filepath.Join(moduleName[0], name)
+			return filepath.Join(r.Config.StoreDir(r.Root, moduleName[0]), name)
 		}
-		return name
+		return filepath.Join(r.Root, name)
 	}
 	switch item.Type() {
 	case "package":
 		if r.skipManager(item.Via) {
 			return nil, true, nil
 		}
-		return &actions.PackageAction{Package: item.Package, Manager: item.Via}, false, nil
+		return &actions.PackageAction{
+			Package:   item.Package,
+			Manager:   item.Via,
+			Remote:    item.Remote,
+			RemoteURL: item.RemoteURL,
+			Channel:   item.Channel,
+			Classic:   item.Classic,
+			Options:   item.Options,
+		}, false, nil
 
 	case "script":
-		return &actions.ScriptAction{Script: item.Script, Via: item.Via}, false, nil
+		// Scripts run from the module's store directory when it exists.
+		dir := ""
+		if store := sourcePrefix(""); store != "" {
+			if info, err := os.Stat(store); err == nil && info.IsDir() {
+				dir = store
+			}
+		}
+		script := item.Script
+		if item.Via != "remote" && !filepath.IsAbs(script) {
+			script = filepath.Join(r.Root, script)
+		}
+		return &actions.ScriptAction{
+			Script:      script,
+			Via:         item.Via,
+			Args:        item.Args,
+			Interpreter: item.Interpreter,
+			SHA256:      item.SHA256,
+			Dir:         dir,
+		}, false, nil
 
 	case "file":
-		dest := item.Destination.ForOS(r.OS)
+		dest, err := r.destination(item.Destination)
+		if err != nil {
+			return nil, false, err
+		}
 		if dest == "" {
 			return nil, true, nil
 		}
@@ -421,21 +980,31 @@ func (r *Runner) buildAction(item config.Item, moduleName ...string) (actions.Ac
 			Direction:   r.fileDirection(item),
 			Link:        item.Link,
 			Permissions: item.Permissions,
+			Owner:       item.Owner,
+			Group:       item.Group,
 			Encrypted:   item.Encrypted,
 			AgeKey:      r.AgeKey,
 		}, false, nil
 
 	case "directory":
-		dest := item.Destination.ForOS(r.OS)
+		dest, err := r.destination(item.Destination)
+		if err != nil {
+			return nil, false, err
+		}
 		if dest == "" {
 			return nil, true, nil
 		}
 		return &actions.DirectoryAction{
-			Source:      sourcePrefix(item.Directory),
-			Destination: dest,
-			Direction:   r.fileDirection(item),
-			Link:        item.Link,
-			Permissions: item.Permissions,
+			Source:         sourcePrefix(item.Directory),
+			Destination:    dest,
+			Direction:      r.fileDirection(item),
+			Link:           item.Link,
+			Permissions:    item.Permissions,
+			DirPermissions: item.DirPermissions,
+			Dereference:    item.Dereference,
+			MaxFileSize:    r.Config.MaxFileSizeFor(item),
+			Owner:          item.Owner,
+			Group:          item.Group,
 		}, false, nil
 
 	case "binary":
@@ -458,7 +1027,18 @@ func (r *Runner) buildAction(item config.Item, moduleName ...string) (actions.Ac
 		if r.DirectionOverride == "pull" {
 			return nil, true, nil
 		}
-		return &actions.RunAction{Command: item.Run, After: item.After}, false, nil
+		dir := ""
+		if item.Cwd != "" {
+			dir = platform.ExpandPath(item.Cwd)
+		}
+		return &actions.RunAction{
+			Command: item.Run,
+			After:   item.After,
+			Dir:     dir,
+			Env:     item.Env,
+			Shell:   string(r.shellFor(item)),
+			Capture: item.Register != "" || item.ChangedWhen != "",
+		}, false, nil
 
 	case "setting":
 		return &actions.SettingAction{
@@ -467,6 +1047,73 @@ func (r *Runner) buildAction(item config.Item, moduleName ...string) (actions.Ac
 			Value:  item.Value,
 		}, false, nil
 
+	case "dock":
+		if r.OS != "darwin" {
+			return nil, true, nil
+		}
+		return &actions.DockAction{Apps: item.Dock, Add: item.DockMode == "add"}, false, nil
+
+	case "login_item":
+		if r.OS != "darwin" {
+			return nil, true, nil
+		}
+		return &actions.LoginItemAction{App: item.LoginItem, Hidden: item.Hidden}, false, nil
+
+	case "repo":
+		if r.skipManager(item.Via) {
+			return nil, true, nil
+		}
+		return &actions.RepoAction{Repo: item.Repo, Manager: item.Via, KeyURL: item.KeyURL}, false, nil
+
+	case "container":
+		compose := item.Compose
+		if compose != "" && !filepath.IsAbs(compose) {
+			compose = sourcePrefix(compose)
+		}
+		return &actions.ContainerAction{
+			Name:    item.Container,
+			Image:   item.Image,
+			Compose: compose,
+			Ports:   item.Ports,
+			Volumes: item.Volumes,
+			Env:     item.Env,
+			Engine:  item.Via,
+		}, false, nil
+
+	case "extension":
+		return r.extensionAction(item, moduleName...), false, nil
+
+	case "default_app":
+		app := item.DefaultApp.ForOS(r.OS)
+		if app == "" {
+			return nil, true, nil
+		}
+		return &actions.DefaultAppAction{App: app, Handles: item.Handles, OS: r.OS}, false, nil
+
+	case "shell_plugin":
+		if r.OS == "windows" {
+			return nil, true, nil
+		}
+		return &actions.ShellPluginAction{Plugin: item.ShellPlugin, Manager: item.Via, Version: item.Version}, false, nil
+
+	case "gpg_key":
+		keyFile := item.KeyFile
+		if keyFile != "" && !filepath.IsAbs(keyFile) {
+			keyFile = sourcePrefix(keyFile)
+		}
+		return &actions.GpgKeyAction{
+			Fingerprint: item.GpgKey,
+			KeyFile:     keyFile,
+			Encrypted:   item.Encrypted,
+			AgeKey:      r.AgeKey,
+			Keyserver:   item.Keyserver,
+			Trust:       item.Trust,
+			Secret:      item.Secret,
+		}, false, nil
+
+	case "ssh_host":
+		return &actions.SSHHostAction{Host: item.SSHHost, Options: item.SSHOptions, KnownHosts: item.KnownHosts}, false, nil
+
 	default:
 		return nil, false, fmt.Errorf("item has no recognised type: %+v", item)
 	}
@@ -475,7 +1122,38 @@ func (r *Runner) buildAction(item config.Item, moduleName ...string) (actions.Ac
 // --- helpers -----------------------------------------------------------------
 
 func (r *Runner) matchesTags(mod config.Module) bool {
-	return tags.Matches(r.MachineTags, mod.OnlyTags, mod.ExcludeTags)
+	return mod.MatchesTags(r.MachineTags)
+}
+
+// whenMatches evaluates the item's when: condition against this machine.
+func (r *Runner) whenMatches(item config.Item) (bool, error) {
+	if item.When == "" {
+		return true, nil
+	}
+	host, _ := os.Hostname()
+	return expr.Eval(item.When, expr.Env{
+		OS:       r.OS,
+		Arch:     runtime.GOARCH,
+		Hostname: host,
+		Tags:     r.MachineTags,
+	})
+}
+
+// destination returns a file or directory item's destination on this
+// machine, or "" when it has none. Under WSL an item without a linux
+// destination uses its windows_host path on the Windows side, and on
+// Windows one without a windows destination uses its wsl path.
+func (r *Runner) destination(p config.PlatformMap) (string, error) {
+	if dest := p.ForOS(r.OS); dest != "" {
+		return dest, nil
+	}
+	switch {
+	case r.OS == "linux" && p.WindowsHost != "" && platform.InWSL():
+		return platform.WindowsHostPath(p.WindowsHost)
+	case r.OS == "windows" && p.WSL != "":
+		return platform.WSLPath(p.WSL)
+	}
+	return "", nil
 }
 
 func (r *Runner) skipManager(manager string) bool {
@@ -483,45 +1161,56 @@ func (r *Runner) skipManager(manager string) bool {
 	return targetOS != "" && targetOS != r.OS
 }
 
-func (r *Runner) runHook(ctx context.Context, cmd, scope, name, hookName string) error {
+// hookEnv is the context exposed to hook commands as DOTULAR_* environment
+// variables. Empty fields are omitted.
+type hookEnv struct {
+	Module  string
+	Item    string
+	Outcome string // after-hooks only: "success" | "failure"
+}
+
+// environ returns the DOTULAR_* variables for a hook run by r.
+func (h hookEnv) environ(r *Runner) []string {
+	env := []string{
+		"DOTULAR_COMMAND=" + r.Command,
+		"DOTULAR_DRY_RUN=" + strconv.FormatBool(r.DryRun),
+	}
+	if h.Module != "" {
+		env = append(env, "DOTULAR_MODULE="+h.Module)
+	}
+	if h.Item != "" {
+		env = append(env, "DOTULAR_ITEM="+h.Item)
+	}
+	if h.Outcome != "" {
+		env = append(env, "DOTULAR_OUTCOME="+h.Outcome)
+	}
+	return env
+}
+
+func (r *Runner) runHook(ctx context.Context, cmd, scope, name, hookName string, env hookEnv) error {
 	if cmd == "" {
 		return nil
 	}
 	if r.DryRun {
-		r.UI.DryRun(fmt.Sprintf("hook %s.%s: %s", hookName, scope, cmd))
+		r.UI.DryRun(fmt.Sprintf("hook %s (%s %q): %s", hookName, scope, name, cmd))
 		return nil
 	}
 	if r.Verbose {
 		r.UI.Info(fmt.Sprintf("  hook %s (%s %q)", hookName, scope, name))
 	}
-	if err := shell.Run(ctx, cmd); err != nil {
+	if err := shell.Shell(r.Config.Shell).RunEnv(ctx, cmd, env.environ(r)); err != nil {
 		return fmt.Errorf("hook %s failed on %s %q: %w", hookName, scope, name, err)
 	}
 	return nil
 }
 
-func resolveAgeKey(cfg *config.AgeConfig) *ageutil.Key {
-	// Config file takes precedence over env vars.
-	if cfg != nil {
-		passphrase := cfg.Passphrase
-		if strings.HasPrefix(passphrase, "env:") {
-			passphrase = os.Getenv(strings.TrimPrefix(passphrase, "env:"))
-		}
-		if cfg.Identity != "" || passphrase != "" {
-			return &ageutil.Key{
-				IdentityFile: platform.ExpandPath(cfg.Identity),
-				Passphrase:   passphrase,
-			}
-		}
-	}
-	// Fallback: environment variables.
-	if v := os.Getenv("DOTULAR_AGE_IDENTITY"); v != "" {
-		return &ageutil.Key{IdentityFile: platform.ExpandPath(v)}
+// shellFor returns the shell that runs item's commands: the item's own shell
+// when set, otherwise the config-wide one.
+func (r *Runner) shellFor(item config.Item) shell.Shell {
+	if item.Shell != "" {
+		return shell.Shell(item.Shell)
 	}
-	if v := os.Getenv("DOTULAR_AGE_PASSPHRASE"); v != "" {
-		return &ageutil.Key{Passphrase: v}
-	}
-	return nil
+	return shell.Shell(r.Config.Shell)
 }
 
 func loadMachineTags() []string {
@@ -3,12 +3,22 @@ package runner
 import (
 	"bytes"
 	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"os/exec"
 	"path/filepath"
 	"runtime"
+	"slices"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/atomikpanda/dotular/internal/actions"
+	"github.com/atomikpanda/dotular/internal/audit"
 	"github.com/atomikpanda/dotular/internal/config"
+	"github.com/atomikpanda/dotular/internal/errs"
 	"github.com/atomikpanda/dotular/internal/ui"
 )
 
@@ -185,6 +195,52 @@ func TestBuildActionRun(t *testing.T) {
 	}
 }
 
+func TestBuildActionScriptOptions(t *testing.T) {
+	repo := t.TempDir()
+	wd, _ := os.Getwd()
+	os.Chdir(repo)
+	t.Cleanup(func() { os.Chdir(wd) })
+	os.Mkdir("tools", 0o755)
+
+	r := newTestRunner(config.Config{})
+	item := config.Item{Script: "tools/setup.py", Args: []string{"--fast"}, Interpreter: "python3", SHA256: "abc"}
+	action, _, err := r.buildAction(item, "tools")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sa := action.(*actions.ScriptAction)
+	if sa.Dir != "tools" || sa.Interpreter != "python3" || sa.SHA256 != "abc" || len(sa.Args) != 1 {
+		t.Errorf("script action = %+v", sa)
+	}
+
+	action, _, _ = r.buildAction(item, "missing")
+	if dir := action.(*actions.ScriptAction).Dir; dir != "" {
+		t.Errorf("Dir = %q for a module without a store directory", dir)
+	}
+}
+
+func TestBuildActionRoot(t *testing.T) {
+	r := newTestRunner(config.Config{})
+	r.Root = "/repo"
+	item := config.Item{File: ".zshrc", Destination: config.PlatformMap{MacOS: "~"}}
+	action, _, err := r.buildAction(item, "shell")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if src := action.(*actions.FileAction).Source; src != filepath.Join("/repo", "shell", ".zshrc") {
+		t.Errorf("Source = %q", src)
+	}
+
+	action, _, _ = r.buildAction(config.Item{Script: "bin/setup.sh"}, "shell")
+	if script := action.(*actions.ScriptAction).Script; script != filepath.Join("/repo", "bin", "setup.sh") {
+		t.Errorf("local Script = %q", script)
+	}
+	action, _, _ = r.buildAction(config.Item{Script: "https://x/install.sh", Via: "remote"}, "shell")
+	if script := action.(*actions.ScriptAction).Script; script != "https://x/install.sh" {
+		t.Errorf("remote Script = %q", script)
+	}
+}
+
 func TestBuildActionRunSkippedOnPull(t *testing.T) {
 	r := newTestRunner(config.Config{})
 	r.DirectionOverride = "pull"
@@ -250,6 +306,8 @@ func TestMatchesTags(t *testing.T) {
 		{"only no match", config.Module{Name: "c", OnlyTags: []string{"windows"}}, false},
 		{"exclude match", config.Module{Name: "d", ExcludeTags: []string{"darwin"}}, false},
 		{"exclude no match", config.Module{Name: "e", ExcludeTags: []string{"windows"}}, true},
+		{"group only match", config.Module{Name: "f", OnlyTags: []string{"amd64"}, GroupOnlyTags: [][]string{{"darwin"}}}, true},
+		{"group only no match", config.Module{Name: "g", OnlyTags: []string{"darwin"}, GroupOnlyTags: [][]string{{"desktop"}}}, false},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -421,6 +479,41 @@ func TestApplyItemSkipIf(t *testing.T) {
 	}
 }
 
+func TestApplyItemWhen(t *testing.T) {
+	mod := config.Module{
+		Name: "when-test",
+		Items: []config.Item{
+			{Run: "echo work", When: `hasTag("work")`},
+			{Run: "echo mac", When: `os == "darwin"`},
+			{Run: "echo tmpl", When: `{{ hasTag "testhost" }}`},
+		},
+	}
+	r := newTestRunner(config.Config{})
+	var buf bytes.Buffer
+	r.UI = ui.New(&buf, &bytes.Buffer{})
+	result := r.ApplyModule(context.Background(), mod)
+	if result.Err != nil {
+		t.Fatal(result.Err)
+	}
+	if result.Applied != 2 || result.Skipped != 1 {
+		t.Errorf("applied=%d skipped=%d, want 2/1", result.Applied, result.Skipped)
+	}
+	if !containsStr(buf.String(), "skip [when]") {
+		t.Errorf("expected when skip output, got:\n%s", buf.String())
+	}
+}
+
+func TestApplyItemWhenInvalid(t *testing.T) {
+	mod := config.Module{
+		Name:  "when-bad",
+		Items: []config.Item{{Run: "true", When: `os ==`}},
+	}
+	r := newTestRunner(config.Config{})
+	if result := r.ApplyModule(context.Background(), mod); result.Err == nil {
+		t.Error("expected error for invalid when expression")
+	}
+}
+
 func TestApplyItemVerify(t *testing.T) {
 	if runtime.GOOS == "windows" {
 		t.Skip("Unix-only test")
@@ -428,7 +521,7 @@ func TestApplyItemVerify(t *testing.T) {
 	mod := config.Module{
 		Name: "verify-test",
 		Items: []config.Item{
-			{Run: "true", Verify: "true"},
+			{Run: "true", Verify: config.Verify{Command: "true"}},
 		},
 	}
 	r := newTestRunner(config.Config{})
@@ -446,7 +539,7 @@ func TestVerifyModuleDryRun(t *testing.T) {
 		Name: "verify-mod",
 		Items: []config.Item{
 			{Run: "echo hello"},
-			{Run: "echo world", Verify: "true"},
+			{Run: "echo world", Verify: config.Verify{Command: "true"}},
 		},
 	}
 	r := newTestRunner(config.Config{})
@@ -476,8 +569,8 @@ func TestVerifyAllDryRun(t *testing.T) {
 	}
 	cfg := config.Config{
 		Modules: []config.Module{
-			{Name: "a", Items: []config.Item{{Run: "echo", Verify: "true"}}},
-			{Name: "b", OnlyTags: []string{"windows"}, Items: []config.Item{{Run: "echo", Verify: "true"}}},
+			{Name: "a", Items: []config.Item{{Run: "echo", Verify: config.Verify{Command: "true"}}}},
+			{Name: "b", OnlyTags: []string{"windows"}, Items: []config.Item{{Run: "echo", Verify: config.Verify{Command: "true"}}}},
 		},
 	}
 	r := newTestRunner(cfg)
@@ -496,7 +589,7 @@ func TestVerifyAllDryRun(t *testing.T) {
 
 func TestRunHookEmpty(t *testing.T) {
 	r := newTestRunner(config.Config{})
-	err := r.runHook(context.Background(), "", "module", "test", "before_apply")
+	err := r.runHook(context.Background(), "", "module", "test", "before_apply", hookEnv{Module: "test"})
 	if err != nil {
 		t.Errorf("empty hook should not error: %v", err)
 	}
@@ -507,7 +600,7 @@ func TestRunHookDryRun(t *testing.T) {
 	var buf bytes.Buffer
 	r.Out = &buf
 	r.UI = ui.New(&buf, &bytes.Buffer{})
-	err := r.runHook(context.Background(), "echo hello", "module", "test", "before_apply")
+	err := r.runHook(context.Background(), "echo hello", "module", "test", "before_apply", hookEnv{Module: "test"})
 	if err != nil {
 		t.Errorf("dry-run hook should not error: %v", err)
 	}
@@ -525,7 +618,7 @@ func TestRunHookVerbose(t *testing.T) {
 	var buf bytes.Buffer
 	r.Out = &buf
 	r.UI = ui.New(&buf, &bytes.Buffer{})
-	err := r.runHook(context.Background(), "true", "module", "test", "before_apply")
+	err := r.runHook(context.Background(), "true", "module", "test", "before_apply", hookEnv{Module: "test"})
 	if err != nil {
 		t.Errorf("hook should not error: %v", err)
 	}
@@ -565,83 +658,6 @@ func TestNewRunnerWithAge(t *testing.T) {
 	}
 }
 
-func TestResolveAgeKeyFromConfig(t *testing.T) {
-	cfg := &config.AgeConfig{Passphrase: "secret"}
-	key := resolveAgeKey(cfg)
-	if key == nil {
-		t.Fatal("expected key")
-	}
-	if key.Passphrase != "secret" {
-		t.Errorf("Passphrase = %q", key.Passphrase)
-	}
-}
-
-func TestResolveAgeKeyEnvPassphrase(t *testing.T) {
-	cfg := &config.AgeConfig{Passphrase: "env:MY_AGE_PASS"}
-	t.Setenv("MY_AGE_PASS", "from-env")
-	key := resolveAgeKey(cfg)
-	if key == nil {
-		t.Fatal("expected key")
-	}
-	if key.Passphrase != "from-env" {
-		t.Errorf("Passphrase = %q", key.Passphrase)
-	}
-}
-
-func TestResolveAgeKeyIdentity(t *testing.T) {
-	cfg := &config.AgeConfig{Identity: "~/.age/key.txt"}
-	key := resolveAgeKey(cfg)
-	if key == nil {
-		t.Fatal("expected key")
-	}
-	if key.IdentityFile == "" {
-		t.Error("expected non-empty IdentityFile")
-	}
-}
-
-func TestResolveAgeKeyNil(t *testing.T) {
-	t.Setenv("DOTULAR_AGE_IDENTITY", "")
-	t.Setenv("DOTULAR_AGE_PASSPHRASE", "")
-	key := resolveAgeKey(nil)
-	if key != nil {
-		t.Error("expected nil key when no config")
-	}
-}
-
-func TestResolveAgeKeyEnvIdentityFallback(t *testing.T) {
-	t.Setenv("DOTULAR_AGE_IDENTITY", "/path/to/key")
-	t.Setenv("DOTULAR_AGE_PASSPHRASE", "")
-	key := resolveAgeKey(nil)
-	if key == nil {
-		t.Fatal("expected key from env")
-	}
-	if key.IdentityFile == "" {
-		t.Error("expected non-empty IdentityFile")
-	}
-}
-
-func TestResolveAgeKeyEnvPassphraseFallback(t *testing.T) {
-	t.Setenv("DOTULAR_AGE_IDENTITY", "")
-	t.Setenv("DOTULAR_AGE_PASSPHRASE", "env-pass")
-	key := resolveAgeKey(nil)
-	if key == nil {
-		t.Fatal("expected key from env")
-	}
-	if key.Passphrase != "env-pass" {
-		t.Errorf("Passphrase = %q", key.Passphrase)
-	}
-}
-
-func TestResolveAgeKeyEmptyConfig(t *testing.T) {
-	t.Setenv("DOTULAR_AGE_IDENTITY", "")
-	t.Setenv("DOTULAR_AGE_PASSPHRASE", "")
-	cfg := &config.AgeConfig{}
-	key := resolveAgeKey(cfg)
-	if key != nil {
-		t.Error("expected nil key for empty age config")
-	}
-}
-
 func TestApplyModuleSkipsOSMismatch(t *testing.T) {
 	mod := config.Module{
 		Name: "os-skip",
@@ -683,6 +699,178 @@ func TestApplyItemWithItemHooks(t *testing.T) {
 	}
 }
 
+func TestApplyModuleDryRunPreview(t *testing.T) {
+	repo, sys := t.TempDir(), t.TempDir()
+	store := filepath.Join(repo, "conf")
+	if err := os.Mkdir(store, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range map[string]string{"same.conf": "x\n", "changed.conf": "new\n", "created.conf": "y\n"} {
+		if err := os.WriteFile(filepath.Join(store, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for name, content := range map[string]string{"same.conf": "x\n", "changed.conf": "old\n"} {
+		if err := os.WriteFile(filepath.Join(sys, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var items []config.Item
+	for _, name := range []string{"same.conf", "changed.conf", "created.conf"} {
+		items = append(items, config.Item{File: name, Destination: config.PlatformMap{MacOS: sys}})
+	}
+	r := newTestRunner(config.Config{})
+	r.Root = repo
+	r.ShowDiff = true
+	var buf bytes.Buffer
+	r.UI = ui.New(&buf, &bytes.Buffer{})
+	result := r.ApplyModule(context.Background(), config.Module{Name: "conf", Items: items})
+	if result.Err != nil {
+		t.Fatal(result.Err)
+	}
+	if result.Applied != 2 || result.Skipped != 1 {
+		t.Errorf("result = %+v, want 2 applied and 1 skipped", result)
+	}
+	out := buf.String()
+	for _, want := range []string{"(unchanged)", "(modified)", "(created)", "-old", "+new"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output missing %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestApplyModulesInterrupted(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Unix-only")
+	}
+	t.Setenv("HOME", t.TempDir())
+	repo, sys := t.TempDir(), t.TempDir()
+	if err := os.MkdirAll(filepath.Join(repo, "app"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(repo, "app", "app.conf"), []byte("x\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	started, never := filepath.Join(sys, "started"), filepath.Join(sys, "never")
+	mods := []config.Module{
+		{Name: "app", Items: []config.Item{
+			{File: "app.conf", Destination: config.PlatformMap{MacOS: sys}},
+			{Run: "touch " + started + " && exec sleep 10"},
+			{Run: "touch " + never},
+		}},
+		{Name: "later", Items: []config.Item{{Run: "touch " + never}}},
+	}
+	r := newTestRunner(config.Config{})
+	r.DryRun, r.Atomic, r.Root = false, true, repo
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		for {
+			if _, err := os.Stat(started); err == nil {
+				cancel()
+				return
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}()
+	start := time.Now()
+	err := r.ApplyModules(ctx, mods)
+	if !errors.Is(err, errs.ErrAborted) {
+		t.Fatalf("err = %v, want ErrAborted", err)
+	}
+	if time.Since(start) > 5*time.Second {
+		t.Error("the running item was not stopped")
+	}
+	if _, err := os.Stat(never); err == nil {
+		t.Error("items after the interrupt ran")
+	}
+	if _, err := os.Stat(filepath.Join(sys, "app.conf")); err == nil {
+		t.Error("the interrupted module was not rolled back")
+	}
+	entries, err := audit.Read("", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) == 0 || entries[len(entries)-1].Outcome != "aborted" {
+		t.Errorf("last audit entry = %+v, want an aborted run", entries)
+	}
+}
+
+func TestApplyNamedItem(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Unix-only")
+	}
+	t.Setenv("HOME", t.TempDir())
+	mod := config.Module{Name: "runs", Items: []config.Item{
+		{Name: "say hello", Run: "echo hello"},
+		{Run: "echo bye"},
+	}}
+	r := newTestRunner(config.Config{})
+	r.DryRun = false
+	var buf bytes.Buffer
+	r.UI = ui.New(&buf, &bytes.Buffer{})
+	if result := r.ApplyModule(context.Background(), mod); result.Err != nil {
+		t.Fatal(result.Err)
+	}
+	if !strings.Contains(buf.String(), "say hello") || strings.Contains(buf.String(), "echo hello") {
+		t.Errorf("output should name the item by its name:\n%s", buf.String())
+	}
+	entries, err := audit.Read("", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var items []string
+	for _, e := range entries {
+		items = append(items, e.Item)
+	}
+	if !slices.Contains(items, "say hello") {
+		t.Errorf("audit items = %q, want the item name", items)
+	}
+}
+
+func TestApplyRunChanged(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Unix-only")
+	}
+	t.Setenv("HOME", t.TempDir())
+	sys := t.TempDir()
+	mod := config.Module{Name: "runs", Items: []config.Item{
+		{Run: "echo changed", ChangedWhen: "^changed"},
+		{Run: "echo nothing to do", ChangedWhen: "^changed", Register: "out"},
+		{Run: "true", Creates: filepath.Join(sys, "missing")},
+		{Run: "touch " + filepath.Join(sys, "made"), Creates: filepath.Join(sys, "made")},
+		{Run: `test "{{ .out }}" = "nothing to do"`},
+	}}
+	r := newTestRunner(config.Config{})
+	r.DryRun = false
+	var buf bytes.Buffer
+	r.UI = ui.New(&buf, &bytes.Buffer{})
+	result := r.ApplyModule(context.Background(), mod)
+	if result.Err != nil {
+		t.Fatal(result.Err)
+	}
+	if result.Applied != 3 || result.Skipped != 2 {
+		t.Errorf("applied=%d skipped=%d, want 3/2", result.Applied, result.Skipped)
+	}
+	if n := strings.Count(buf.String(), "(unchanged)"); n != 2 {
+		t.Errorf("%d unchanged lines, want 2:\n%s", n, buf.String())
+	}
+	entries, err := audit.Read("", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var unchanged int
+	for _, e := range entries {
+		if e.Outcome == "unchanged" {
+			unchanged++
+		}
+	}
+	if unchanged != 2 {
+		t.Errorf("%d unchanged audit entries, want 2: %+v", unchanged, entries)
+	}
+}
+
 func TestApplyModuleNonDryRun(t *testing.T) {
 	if runtime.GOOS == "windows" {
 		t.Skip("Unix-only")
@@ -704,6 +892,80 @@ func TestApplyModuleNonDryRun(t *testing.T) {
 	}
 }
 
+func TestApplyModuleRegister(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Unix-only")
+	}
+	dir := t.TempDir()
+	out := filepath.Join(dir, "out")
+	mod := config.Module{
+		Name: "register",
+		Items: []config.Item{
+			{Run: "echo $GREETING", Env: map[string]string{"GREETING": "hello"}, Register: "greeting"},
+			{Run: "pwd > " + out + "; echo {{ .greeting }} >> " + out, Cwd: dir},
+		},
+	}
+	r := newTestRunner(config.Config{})
+	r.DryRun = false
+	var buf bytes.Buffer
+	r.UI = ui.New(&buf, &bytes.Buffer{})
+	ctx := actions.WithOutput(context.Background(), &buf, &buf)
+	if result := r.ApplyModule(ctx, mod); result.Err != nil {
+		t.Fatal(result.Err)
+	}
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantDir, _ := filepath.EvalSymlinks(dir)
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 2 || (lines[0] != dir && lines[0] != wantDir) || lines[1] != "hello" {
+		t.Errorf("output = %q", data)
+	}
+}
+
+func TestBuildActionRunOptions(t *testing.T) {
+	r := newTestRunner(config.Config{})
+	item := config.Item{Run: "ls", Cwd: "/tmp", Shell: "bash", Env: map[string]string{"A": "1"}, Register: "x"}
+	action, _, err := r.buildAction(item)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ra := action.(*actions.RunAction)
+	if ra.Dir != "/tmp" || ra.Shell != "bash" || ra.Env["A"] != "1" || !ra.Capture {
+		t.Errorf("run action = %+v", ra)
+	}
+}
+
+func TestShellFor(t *testing.T) {
+	r := newTestRunner(config.Config{Shell: "bash"})
+	if got := r.shellFor(config.Item{Run: "x"}); got != "bash" {
+		t.Errorf("config shell = %q, want bash", got)
+	}
+	if got := r.shellFor(config.Item{Run: "x", Shell: "zsh"}); got != "zsh" {
+		t.Errorf("item shell = %q, want zsh", got)
+	}
+	action, _, _ := r.buildAction(config.Item{Run: "x"})
+	if ra := action.(*actions.RunAction); ra.Shell != "bash" {
+		t.Errorf("run action shell = %q, want bash", ra.Shell)
+	}
+}
+
+func TestPlanSkipIfUsesConfigShell(t *testing.T) {
+	if _, err := exec.LookPath("bash"); err != nil {
+		t.Skip("bash not installed")
+	}
+	mod := config.Module{Name: "m", Items: []config.Item{{Run: "true", SkipIf: "[[ -n $BASH_VERSION ]]"}}}
+	r := newTestRunner(config.Config{Shell: "bash"})
+	mp, err := r.PlanModule(context.Background(), mod)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mp.Actions[0].Status != StatusSkip {
+		t.Errorf("skip_if should run in bash: %+v", mp.Actions[0])
+	}
+}
+
 func TestApplyModuleWithAtomic(t *testing.T) {
 	if runtime.GOOS == "windows" {
 		t.Skip("Unix-only")
@@ -783,7 +1045,7 @@ func TestVerifyModuleFailure(t *testing.T) {
 	mod := config.Module{
 		Name: "verify-fail",
 		Items: []config.Item{
-			{Run: "echo", Verify: "false"},
+			{Run: "echo", Verify: config.Verify{Command: "false"}},
 		},
 	}
 	r := newTestRunner(config.Config{})
@@ -874,6 +1136,47 @@ func TestApplyModuleDirItemWithSnapshot(t *testing.T) {
 	}
 }
 
+func TestApplyModuleDirItemWithSymlinksTwice(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Unix-only")
+	}
+	dir := t.TempDir()
+	srcDir := filepath.Join(dir, "links", "srcdir")
+	os.MkdirAll(filepath.Join(srcDir, "real"), 0o755)
+	os.WriteFile(filepath.Join(srcDir, "real", "f.txt"), []byte("data"), 0o644)
+	os.Symlink("real", filepath.Join(srcDir, "alias"))
+	os.Symlink("missing", filepath.Join(srcDir, "dangling"))
+	destDir := filepath.Join(dir, "dest")
+
+	origDir, _ := os.Getwd()
+	os.Chdir(dir)
+	defer os.Chdir(origDir)
+
+	mod := config.Module{
+		Name: "links",
+		Items: []config.Item{{
+			Directory:   "srcdir",
+			Destination: config.PlatformMap{MacOS: destDir + "/"},
+			Direction:   "push",
+		}},
+	}
+	r := newTestRunner(config.Config{})
+	r.DryRun = false
+	r.Atomic = true
+	var buf bytes.Buffer
+	r.Out = &buf
+	r.UI = ui.New(&buf, &bytes.Buffer{})
+	// The second apply snapshots the copied tree, symlinks included.
+	for i := 0; i < 2; i++ {
+		if result := r.ApplyModule(context.Background(), mod); result.Err != nil {
+			t.Fatalf("apply %d: %v", i+1, result.Err)
+		}
+	}
+	if link, err := os.Readlink(filepath.Join(destDir, "srcdir", "alias")); err != nil || link != "real" {
+		t.Errorf("alias = %q, %v; want a link to real", link, err)
+	}
+}
+
 func containsStr(s, sub string) bool {
 	for i := 0; i <= len(s)-len(sub); i++ {
 		if s[i:i+len(sub)] == sub {
@@ -882,3 +1185,332 @@ func containsStr(s, sub string) bool {
 	}
 	return false
 }
+
+func TestApplyInterruptedRunsFailureHook(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Unix-only test")
+	}
+	dir := t.TempDir()
+	started, log := filepath.Join(dir, "started"), filepath.Join(dir, "hooks.log")
+	cfg := config.Config{
+		Hooks:   config.GlobalHooks{OnFailure: "sleep 0.1 && echo failure >> " + log},
+		Modules: []config.Module{{Name: "m", Items: []config.Item{{Run: "touch " + started + " && exec sleep 10"}}}},
+	}
+	r := newTestRunner(cfg)
+	r.DryRun = false
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		for {
+			if _, err := os.Stat(started); err == nil {
+				cancel()
+				return
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}()
+	if err := r.ApplyAll(ctx); !errors.Is(err, errs.ErrAborted) {
+		t.Fatalf("err = %v, want ErrAborted", err)
+	}
+	if data, _ := os.ReadFile(log); string(data) != "failure\n" {
+		t.Errorf("on_failure wrote %q; it should run after an interrupt", data)
+	}
+}
+
+func TestApplyAllKeepGoing(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Unix-only test")
+	}
+	cfg := config.Config{
+		Modules: []config.Module{
+			{Name: "broken", Items: []config.Item{{Run: "false"}, {Run: "true"}}},
+			{Name: "fine", Items: []config.Item{{Run: "true"}}},
+		},
+	}
+
+	tests := []struct {
+		mode        string
+		wantApplied string
+	}{
+		{"", "0 applied"},
+		{KeepGoingModule, "1 applied"},
+		{KeepGoingItem, "2 applied"},
+	}
+	for _, tt := range tests {
+		r := newTestRunner(cfg)
+		r.DryRun = false
+		r.KeepGoing = tt.mode
+		var buf bytes.Buffer
+		r.UI = ui.New(&buf, &bytes.Buffer{})
+
+		err := r.ApplyAll(context.Background())
+		if err == nil || !containsStr(err.Error(), `module "broken"`) {
+			t.Errorf("mode %q: err = %v", tt.mode, err)
+		}
+		if !containsStr(buf.String(), tt.wantApplied) {
+			t.Errorf("mode %q: expected %q in output:\n%s", tt.mode, tt.wantApplied, buf.String())
+		}
+	}
+}
+
+func TestApplyKeepGoingItemRollsBackFailedItem(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Unix-only test")
+	}
+	repo, sys := t.TempDir(), t.TempDir()
+	os.MkdirAll(filepath.Join(repo, "app"), 0o755)
+	os.WriteFile(filepath.Join(repo, "app", "good.conf"), []byte("good"), 0o644)
+	os.WriteFile(filepath.Join(repo, "app", "bad.conf"), []byte("bad"), 0o644)
+	os.WriteFile(filepath.Join(sys, "bad.conf"), []byte("before"), 0o644)
+	mod := config.Module{Name: "app", Items: []config.Item{
+		{File: "good.conf", Destination: config.PlatformMap{MacOS: sys}},
+		{File: "bad.conf", Destination: config.PlatformMap{MacOS: sys}, Hooks: config.ItemHooks{AfterApply: "false"}},
+	}}
+	r := newTestRunner(config.Config{})
+	r.DryRun, r.Atomic, r.Root = false, true, repo
+	r.KeepGoing = KeepGoingItem
+	r.UI = ui.New(&bytes.Buffer{}, &bytes.Buffer{})
+
+	if result := r.ApplyModule(context.Background(), mod); result.Err == nil || result.Failed != 1 {
+		t.Fatalf("result = %+v, want the second item failed", result)
+	}
+	if got, _ := os.ReadFile(filepath.Join(sys, "good.conf")); string(got) != "good" {
+		t.Errorf("good.conf = %q; the item that succeeded was rolled back", got)
+	}
+	if got, _ := os.ReadFile(filepath.Join(sys, "bad.conf")); string(got) != "before" {
+		t.Errorf("bad.conf = %q; the failed item was not rolled back", got)
+	}
+}
+
+func TestApplyAllKeepGoingInvalid(t *testing.T) {
+	r := newTestRunner(config.Config{})
+	r.KeepGoing = "sometimes"
+	if err := r.ApplyAll(context.Background()); err == nil {
+		t.Error("expected error for invalid keep-going mode")
+	}
+}
+
+func TestApplyAllGlobalHooks(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Unix-only test")
+	}
+	dir := t.TempDir()
+	log := filepath.Join(dir, "hooks.log")
+	hooks := config.GlobalHooks{
+		BeforeAll: "echo before >> " + log,
+		AfterAll:  "echo after >> " + log,
+		OnFailure: "echo failure >> " + log,
+	}
+
+	tests := []struct {
+		name    string
+		run     string
+		want    string
+		wantErr bool
+	}{
+		{"success", "true", "before\nafter\n", false},
+		{"failure", "false", "before\nfailure\n", true},
+	}
+	for _, tt := range tests {
+		os.Remove(log)
+		cfg := config.Config{
+			Hooks:   hooks,
+			Modules: []config.Module{{Name: "m", Items: []config.Item{{Run: tt.run}}}},
+		}
+		r := newTestRunner(cfg)
+		r.DryRun = false
+		err := r.ApplyAll(context.Background())
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: err = %v", tt.name, err)
+		}
+		data, _ := os.ReadFile(log)
+		if string(data) != tt.want {
+			t.Errorf("%s: hooks ran %q, want %q", tt.name, data, tt.want)
+		}
+	}
+}
+
+func TestApplyAllBeforeAllFailure(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Unix-only test")
+	}
+	marker := filepath.Join(t.TempDir(), "ran")
+	cfg := config.Config{
+		Hooks:   config.GlobalHooks{BeforeAll: "false"},
+		Modules: []config.Module{{Name: "m", Items: []config.Item{{Run: "touch " + marker}}}},
+	}
+	r := newTestRunner(cfg)
+	r.DryRun = false
+	if err := r.ApplyAll(context.Background()); err == nil {
+		t.Error("expected error from failing before_all hook")
+	}
+	if _, err := os.Stat(marker); err == nil {
+		t.Error("modules must not run after before_all fails")
+	}
+}
+
+func TestHookEnvironment(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Unix-only test")
+	}
+	out := filepath.Join(t.TempDir(), "env")
+	dump := `echo "$DOTULAR_COMMAND|$DOTULAR_DRY_RUN|$DOTULAR_MODULE|$DOTULAR_ITEM|$DOTULAR_OUTCOME" >> ` + out
+	mod := config.Module{
+		Name:  "envmod",
+		Hooks: config.ModuleHooks{BeforeApply: dump, AfterApply: dump},
+		Items: []config.Item{{Run: "true", Hooks: config.ItemHooks{AfterApply: dump}}},
+	}
+	r := newTestRunner(config.Config{})
+	r.DryRun = false
+	r.Command = "push"
+	if result := r.ApplyModule(context.Background(), mod); result.Err != nil {
+		t.Fatal(result.Err)
+	}
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "push|false|envmod||\n" +
+		"push|false|envmod|run \"true\"|success\n" +
+		"push|false|envmod||success\n"
+	if string(data) != want {
+		t.Errorf("hook env:\n%s\nwant:\n%s", data, want)
+	}
+}
+
+func TestApplyAllNotifiesWebhook(t *testing.T) {
+	var calls int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		calls++
+	}))
+	defer srv.Close()
+
+	cfg := config.Config{
+		Notify:  &config.NotifyConfig{Webhooks: []config.Webhook{{URL: srv.URL}}},
+		Modules: []config.Module{{Name: "m", Items: []config.Item{{Run: "true"}}}},
+	}
+	r := newTestRunner(cfg)
+	if err := r.ApplyAll(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if calls != 0 {
+		t.Error("dry-run must not send notifications")
+	}
+
+	r.DryRun = false
+	if err := r.ApplyAll(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if calls != 1 {
+		t.Errorf("webhook called %d times, want 1", calls)
+	}
+}
+
+func TestAttributeStatus(t *testing.T) {
+	if got := attributeStatus(&actions.RunAction{Command: "true"}); len(got) != 0 {
+		t.Errorf("run action should have no attribute status, got %v", got)
+	}
+	if got := attributeStatus(&actions.FileAction{Source: "a", Destination: "/nonexistent/", Permissions: "0600"}); len(got) != 0 {
+		t.Errorf("missing destination should have no status, got %v", got)
+	}
+}
+
+func TestApplyRestartsOncePerModule(t *testing.T) {
+	mod := config.Module{
+		Name: "macos",
+		Items: []config.Item{
+			{Setting: "com.apple.dock", Key: "autohide", Value: true},
+			{Setting: "com.apple.dock", Key: "tilesize", Value: 36},
+			{Setting: "NSGlobalDomain", Key: "KeyRepeat", Value: 2},
+		},
+	}
+	r := newTestRunner(config.Config{})
+	var buf bytes.Buffer
+	r.UI = ui.New(&buf, &bytes.Buffer{})
+	if result := r.ApplyModule(context.Background(), mod); result.Err != nil {
+		t.Fatal(result.Err)
+	}
+	if n := strings.Count(buf.String(), "restart Dock"); n != 1 {
+		t.Errorf("restart Dock printed %d times, want once:\n%s", n, buf.String())
+	}
+	if strings.Contains(buf.String(), "restart Finder") {
+		t.Errorf("unexpected Finder restart:\n%s", buf.String())
+	}
+}
+
+func TestBuildActionMacOSOnly(t *testing.T) {
+	r := newTestRunner(config.Config{})
+	r.OS = "linux"
+	for _, item := range []config.Item{{Dock: []string{"Safari"}}, {LoginItem: "Rectangle"}} {
+		if _, skip, err := r.buildAction(item); err != nil || !skip {
+			t.Errorf("%s on linux: skip=%v err=%v, want skipped", item.Type(), skip, err)
+		}
+	}
+	r.OS = "darwin"
+	action, _, _ := r.buildAction(config.Item{Dock: []string{"Safari"}, DockMode: "add"})
+	if da, ok := action.(*actions.DockAction); !ok || !da.Add {
+		t.Errorf("dock action = %#v", action)
+	}
+}
+
+func TestTotalsAfterDryRun(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Unix-only test")
+	}
+	r := newTestRunner(config.Config{Modules: []config.Module{{Name: "m", Items: []config.Item{
+		{Run: "echo a"},
+		{Run: "echo b", SkipIf: "true"},
+	}}}})
+	r.RunGuards = true
+	if err := r.ApplyAll(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got := r.Totals(); got.Applied != 1 || got.Skipped != 1 || got.Failed != 0 {
+		t.Errorf("Totals() = %+v, want 1 applied and 1 skipped", got)
+	}
+}
+
+func TestDryRunRunsNothing(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Unix-only test")
+	}
+	marker := filepath.Join(t.TempDir(), "ran")
+	touch := "touch " + marker
+	mod := config.Module{
+		Name:  "m",
+		Hooks: config.ModuleHooks{BeforeApply: touch},
+		Items: []config.Item{{
+			Run:    touch,
+			SkipIf: touch,
+			OnlyIf: touch,
+			Verify: config.Verify{Command: touch},
+			Hooks:  config.ItemHooks{BeforeApply: touch, AfterApply: touch},
+		}},
+	}
+	r := newTestRunner(config.Config{})
+	var buf bytes.Buffer
+	r.UI = ui.New(&buf, &bytes.Buffer{})
+	if result := r.ApplyModule(context.Background(), mod); result.Err != nil || result.Applied != 1 {
+		t.Fatalf("result = %+v, want 1 applied", result)
+	}
+	if _, err := os.Stat(marker); err == nil {
+		t.Error("a command ran during the dry run")
+	}
+	out := buf.String()
+	for _, want := range []string{
+		`hook before_apply (module "m"): ` + touch,
+		"check skip_if: " + touch,
+		"check only_if: " + touch,
+		`hook before_apply (item "run \"` + touch + `\""): ` + touch,
+		"verify: " + touch,
+		`hook after_apply (item "run \"` + touch + `\""): ` + touch,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output missing %q:\n%s", want, out)
+		}
+	}
+	if strings.Index(out, "check skip_if") > strings.Index(out, "verify: ") {
+		t.Errorf("guards should be reported before verify:\n%s", out)
+	}
+}
@@ -0,0 +1,81 @@
+package runner
+
+import (
+	"fmt"
+
+	"github.com/atomikpanda/dotular/internal/actions"
+	"github.com/atomikpanda/dotular/internal/config"
+)
+
+// EffectiveItem is one item of a module as it would be applied on this
+// machine: file globs expanded, destinations chosen for this OS and fully
+// expanded, and store paths resolved against the repo root.
+type EffectiveItem struct {
+	Type        string `json:"type"`
+	Name        string `json:"name,omitempty"`
+	Description string `json:"description"`
+	Source      string `json:"source,omitempty"`      // repo-side path
+	Destination string `json:"destination,omitempty"` // system-side path
+	Direction   string `json:"direction,omitempty"`
+	Link        bool   `json:"link,omitempty"`
+	Skipped     bool   `json:"skipped,omitempty"`
+	Reason      string `json:"reason,omitempty"` // why the item is skipped
+
+	Item config.Item `json:"-"`
+}
+
+// Effective returns the effective items of mod on this machine. Unlike
+// PlanModule it runs no commands: skip_if and idempotency checks are left
+// out, so an item is only reported skipped when it does not apply to this
+// OS, its when: condition is false, or it is excluded by a type filter.
+func (r *Runner) Effective(mod config.Module) ([]EffectiveItem, error) {
+	items, err := r.expandItems(mod)
+	if err != nil {
+		return nil, err
+	}
+	out := []EffectiveItem{}
+	for _, item := range items {
+		ei := EffectiveItem{Type: item.Type(), Name: item.Name, Description: item.Type(), Item: item}
+		action, skip, err := r.buildAction(item, mod.Name)
+		if err != nil {
+			return nil, fmt.Errorf("module %q: %w", mod.Name, err)
+		}
+		if skip {
+			ei.Skipped, ei.Reason = true, item.Type()+" not applicable on "+r.OS
+			out = append(out, ei)
+			continue
+		}
+		ei.Description = action.Describe()
+		switch a := action.(type) {
+		case *actions.FileAction:
+			ei.Source, ei.Destination = a.RepoPath(), a.ResolvedTarget()
+			ei.Link = a.Link
+			if !a.Link {
+				ei.Direction = a.Direction
+			}
+		case *actions.DirectoryAction:
+			ei.Source, ei.Destination = a.Source, a.ResolvedTarget()
+			ei.Link = a.Link
+			if !a.Link {
+				ei.Direction = a.Direction
+			}
+		case *actions.BinaryAction:
+			ei.Source, ei.Destination = a.SourceURL, a.InstalledPath()
+		}
+
+		matched, err := r.whenMatches(item)
+		if err != nil {
+			return nil, fmt.Errorf("module %q: %w", mod.Name, err)
+		}
+		switch {
+		case r.typeFiltered(ei.Type):
+			ei.Skipped, ei.Reason = true, "type filter"
+		case r.profileFiltered(item):
+			ei.Skipped, ei.Reason = true, "profile "+r.ProfileName
+		case !matched:
+			ei.Skipped, ei.Reason = true, "when"
+		}
+		out = append(out, ei)
+	}
+	return out, nil
+}
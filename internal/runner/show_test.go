@@ -0,0 +1,49 @@
+package runner
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/atomikpanda/dotular/internal/config"
+)
+
+func TestEffective(t *testing.T) {
+	root, home := t.TempDir(), t.TempDir()
+	t.Setenv("HOME", home)
+	os.MkdirAll(filepath.Join(root, "m"), 0o755)
+	for _, name := range []string{"a.conf", "b.conf"} {
+		os.WriteFile(filepath.Join(root, "m", name), []byte(name), 0o644)
+	}
+
+	r := newTestRunner(config.Config{})
+	r.Root = root
+	r.SkipTypes = []string{"run"}
+	mod := config.Module{Name: "m", Items: []config.Item{
+		{File: "*.conf", Destination: config.PlatformMap{MacOS: "~/.config/m/"}},
+		{File: "linux.conf", Destination: config.PlatformMap{Linux: "~/"}},
+		{Package: "git", When: `os == "linux"`},
+		{SkipIf: "exit 1", Run: "echo hi"},
+	}}
+	items, err := r.Effective(mod)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 5 {
+		t.Fatalf("items = %+v, want the glob expanded", items)
+	}
+	for i, name := range []string{"a.conf", "b.conf"} {
+		ei := items[i]
+		if ei.Source != filepath.Join(root, "m", name) || ei.Destination != filepath.Join(home, ".config", "m", name) {
+			t.Errorf("items[%d] = %+v", i, ei)
+		}
+		if ei.Direction != "push" || ei.Skipped {
+			t.Errorf("items[%d] = %+v, want an applied push", i, ei)
+		}
+	}
+	for i, reason := range map[int]string{2: "file not applicable on darwin", 3: "when", 4: "type filter"} {
+		if !items[i].Skipped || items[i].Reason != reason {
+			t.Errorf("items[%d] = %+v, want skipped for %q", i, items[i], reason)
+		}
+	}
+}
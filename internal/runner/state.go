@@ -0,0 +1,191 @@
+package runner
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"time"
+
+	"github.com/atomikpanda/dotular/internal/actions"
+	"github.com/atomikpanda/dotular/internal/config"
+	"github.com/atomikpanda/dotular/internal/state"
+)
+
+// resourceFor describes what an action deploys on the system, for the state
+// file. ok is false for actions that leave nothing trackable behind (run,
+// script, and setting items, and pull-direction files, which write into the
+// repo rather than the system).
+func resourceFor(module string, action actions.Action) (res state.Resource, ok bool) {
+	switch a := action.(type) {
+	case *actions.FileAction:
+		if a.Direction == "pull" {
+			return res, false
+		}
+		return pathResource(module, state.KindFile, a.Link, a.Source, a.ResolvedTarget()), true
+	case *actions.DirectoryAction:
+		if a.Direction == "pull" {
+			return res, false
+		}
+		return pathResource(module, state.KindDirectory, a.Link, a.Source, a.ResolvedTarget()), true
+	case *actions.PackageAction:
+		return state.Resource{Kind: state.KindPackage, Package: a.Package, Manager: a.Manager, Module: module}, true
+	case *actions.BinaryAction:
+		return state.Resource{Kind: state.KindBinary, Path: a.InstalledPath(), Source: a.SourceURL, Module: module}, true
+	default:
+		return res, false
+	}
+}
+
+func pathResource(module, kind string, link bool, source, target string) state.Resource {
+	if link {
+		kind = state.KindSymlink
+	}
+	if abs, err := filepath.Abs(source); err == nil {
+		source = abs
+	}
+	return state.Resource{Kind: kind, Path: target, Source: source, Module: module}
+}
+
+// recordState notes a successfully applied action in the state file.
+func (r *Runner) recordState(module string, action actions.Action) {
+	if r.State == nil || r.DryRun {
+		return
+	}
+	res, ok := resourceFor(module, action)
+	if !ok {
+		return
+	}
+	if fa, ok := action.(*actions.FileAction); ok && fa.ContentHash() != "" {
+		res.Hash = fa.ContentHash() // read whole by the sync comparison
+	} else if res.Kind == state.KindFile || res.Kind == state.KindBinary {
+		res.Hash, _ = state.HashFile(res.Path)
+	}
+	if da, ok := action.(*actions.DirectoryAction); ok && res.Kind == state.KindDirectory {
+		res.Hash, _ = r.Hashes.HashTreeLimit(res.Path, da.MaxFileSize)
+		res.SourceHash, _ = r.Hashes.HashTreeLimit(da.Source, da.MaxFileSize)
+	}
+	if fa, ok := action.(*actions.FileAction); ok && res.Kind == state.KindFile {
+		if fa.Encrypted || fa.ContentHash() == "" {
+			res.SourceHash, _ = state.HashFile(fa.RepoPath())
+		} else {
+			res.SourceHash = fa.ContentHash() // the repo copy matched the system one
+		}
+		if fa.Encrypted && res.Hash != "" && res.SourceHash != "" {
+			// The system now holds the plaintext of this ciphertext.
+			if old, ok := r.State.Resources[res.Key()]; ok && old.SourceHash != res.SourceHash {
+				r.State.ForgetPlainHash(old.SourceHash)
+			}
+			r.State.RememberPlainHash(res.SourceHash, res.Hash)
+		}
+	}
+	res.Config = r.configKey()
+	r.State.Record(res)
+}
+
+// configKey returns the absolute path of r.ConfigPath, which scopes state
+// entries to the config that recorded them, or "" when it is unset.
+func (r *Runner) configKey() string {
+	if r.ConfigPath == "" {
+		return ""
+	}
+	if abs, err := filepath.Abs(r.ConfigPath); err == nil {
+		return abs
+	}
+	return r.ConfigPath
+}
+
+// savePlainHashes persists plaintext hashes learned while checking drift.
+// It also runs for read-only commands: the entries are a cache and do not
+// describe anything deployed.
+func (r *Runner) savePlainHashes() {
+	if !r.plainHashesChanged || r.State == nil || r.StatePath == "" {
+		return
+	}
+	r.plainHashesChanged = false
+	if err := r.State.Save(r.StatePath); err != nil {
+		r.UI.Warn("save state: " + err.Error())
+	}
+}
+
+// saveState writes the state file after a run. Failures are warnings: the
+// run itself has already happened.
+func (r *Runner) saveState() {
+	if r.State == nil || r.DryRun || r.StatePath == "" {
+		return
+	}
+	if err := r.State.Save(r.StatePath); err != nil {
+		r.UI.Warn("save state: " + err.Error())
+	}
+}
+
+// recordModule notes a module's successful apply in the state file. Runs
+// limited by --only, --skip, or a profile did not apply the whole module and
+// are not recorded.
+func (r *Runner) recordModule(mod config.Module) {
+	if r.DryRun || len(r.OnlyTypes) > 0 || len(r.SkipTypes) > 0 || r.ProfileName != "" {
+		return
+	}
+	hash, err := r.moduleHash(mod)
+	if err != nil {
+		hash = "" // never matches, so --changed-only re-applies the module
+	}
+	if r.State != nil {
+		r.State.RecordModule(r.configKey(), mod.Name, hash)
+	}
+	if r.applied == nil {
+		r.applied = make(map[string]string)
+	}
+	r.applied[mod.Name] = hash
+}
+
+// LastApplied returns when the named module of r's config last applied
+// successfully on this machine, or the zero time.
+func (r *Runner) LastApplied(name string) time.Time {
+	if r.State == nil {
+		return time.Time{}
+	}
+	rec, _ := r.State.Module(r.configKey(), name)
+	return rec.AppliedAt
+}
+
+// unchangedSinceApply reports whether mod's config and store contents hash
+// the same as at its last successful apply by the same command from the same
+// config file.
+func (r *Runner) unchangedSinceApply(mod config.Module) bool {
+	if r.State == nil {
+		return false
+	}
+	rec, ok := r.State.Module(r.configKey(), mod.Name)
+	if !ok || rec.Hash == "" {
+		return false
+	}
+	hash, err := r.moduleHash(mod)
+	return err == nil && hash == rec.Hash
+}
+
+// moduleHash returns a hex sha256 over the command, mod's resolved config,
+// and the contents of its store directory.
+func (r *Runner) moduleHash(mod config.Module) (string, error) {
+	return r.moduleHashFor(mod, r.Command, r.DirectionOverride)
+}
+
+// moduleHashFor is moduleHash for the given command and direction override.
+func (r *Runner) moduleHashFor(mod config.Module, command, direction string) (string, error) {
+	data, err := json.Marshal(mod)
+	if err != nil {
+		return "", err
+	}
+	h := sha256.New()
+	fmt.Fprintf(h, "%s %s\n%s\n", command, direction, data)
+	tree, err := r.Hashes.HashTree(r.Config.StoreDir(r.Root, mod.Name))
+	switch {
+	case err == nil:
+		fmt.Fprintf(h, "store %s\n", tree)
+	case !errors.Is(err, fs.ErrNotExist):
+		return "", err
+	}
+	return fmt.Sprintf("%x", h.Sum(nil)), nil
+}
@@ -0,0 +1,171 @@
+package runner
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/atomikpanda/dotular/internal/actions"
+	"github.com/atomikpanda/dotular/internal/config"
+	"github.com/atomikpanda/dotular/internal/state"
+)
+
+func TestResourceFor(t *testing.T) {
+	tests := []struct {
+		name   string
+		action actions.Action
+		key    string
+		ok     bool
+	}{
+		{"file", &actions.FileAction{Source: "a.txt", Destination: "/etc/", Direction: "push"}, "file:/etc/a.txt", true},
+		{"link", &actions.FileAction{Source: "a.txt", Destination: "/etc/", Link: true}, "symlink:/etc/a.txt", true},
+		{"pull", &actions.FileAction{Source: "a.txt", Destination: "/etc/", Direction: "pull"}, "", false},
+		{"package", &actions.PackageAction{Package: "git", Manager: "brew"}, "package:brew:git", true},
+		{"binary", &actions.BinaryAction{Name: "nvim", InstallTo: "/opt/bin"}, "binary:/opt/bin/nvim", true},
+		{"run", &actions.RunAction{Command: "true"}, "", false},
+	}
+	for _, tt := range tests {
+		res, ok := resourceFor("m", tt.action)
+		if ok != tt.ok {
+			t.Errorf("%s: ok = %v, want %v", tt.name, ok, tt.ok)
+			continue
+		}
+		if ok && (res.Key() != tt.key || res.Module != "m") {
+			t.Errorf("%s: resource = %+v, want key %s", tt.name, res, tt.key)
+		}
+	}
+}
+
+func TestApplyRecordsState(t *testing.T) {
+	repo := t.TempDir()
+	dest := t.TempDir()
+	os.MkdirAll(filepath.Join(repo, "dots"), 0o755)
+	os.WriteFile(filepath.Join(repo, "dots", "rc"), []byte("x"), 0o644)
+	wd, _ := os.Getwd()
+	os.Chdir(repo)
+	defer os.Chdir(wd)
+
+	cfg := config.Config{Modules: []config.Module{{
+		Name: "dots",
+		Items: []config.Item{
+			{File: "rc", Destination: config.PlatformMap{MacOS: dest + "/"}},
+			{Run: "true"},
+		},
+	}}}
+	r := newTestRunner(cfg)
+	r.DryRun = false
+	r.State = state.New()
+	r.StatePath = filepath.Join(t.TempDir(), "state.json")
+
+	if err := r.ApplyAll(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	saved, err := state.Load(r.StatePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(saved.Resources) != 1 {
+		t.Fatalf("got %d resources, want 1: %+v", len(saved.Resources), saved.Resources)
+	}
+	res := saved.Resources["file:"+filepath.Join(dest, "rc")]
+	if res.Module != "dots" || res.Hash == "" || res.SourceHash != res.Hash {
+		t.Errorf("resource = %+v", res)
+	}
+}
+
+func TestDryRunDoesNotRecordState(t *testing.T) {
+	cfg := config.Config{Modules: []config.Module{{
+		Name:  "pkgs",
+		Items: []config.Item{{Package: "git", Via: "brew"}},
+	}}}
+	r := newTestRunner(cfg)
+	r.State = state.New()
+	r.StatePath = filepath.Join(t.TempDir(), "state.json")
+	if err := r.ApplyAll(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(r.StatePath); !os.IsNotExist(err) {
+		t.Error("dry-run must not write the state file")
+	}
+}
+
+func TestChangedOnly(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	repo := t.TempDir()
+	dest := t.TempDir()
+	os.MkdirAll(filepath.Join(repo, "dots"), 0o755)
+	os.WriteFile(filepath.Join(repo, "dots", "rc"), []byte("v1"), 0o644)
+	wd, _ := os.Getwd()
+	os.Chdir(repo)
+	defer os.Chdir(wd)
+
+	cfg := config.Config{Modules: []config.Module{{
+		Name:  "dots",
+		Items: []config.Item{{File: "rc", Destination: config.PlatformMap{MacOS: dest + "/"}}},
+	}}}
+	r := newTestRunner(cfg)
+	r.DryRun = false
+	r.State = state.New()
+	r.StatePath = filepath.Join(t.TempDir(), "state.json")
+	r.ChangedOnly = true
+	ctx := context.Background()
+
+	if err := r.ApplyAll(ctx); err != nil {
+		t.Fatal(err)
+	}
+	first := r.LastApplied("dots")
+	if first.IsZero() {
+		t.Fatal("expected the apply to be recorded")
+	}
+
+	// Nothing changed: the module is skipped without touching the system.
+	os.WriteFile(filepath.Join(dest, "rc"), []byte("edited"), 0o644)
+	if err := r.ApplyAll(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := os.ReadFile(filepath.Join(dest, "rc")); string(got) != "edited" {
+		t.Errorf("unchanged module was applied: rc = %q", got)
+	}
+	if !r.LastApplied("dots").Equal(first) {
+		t.Error("a skipped module must keep its last applied time")
+	}
+
+	// A store change makes the module apply again.
+	os.WriteFile(filepath.Join(repo, "dots", "rc"), []byte("v2"), 0o644)
+	if err := r.ApplyAll(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := os.ReadFile(filepath.Join(dest, "rc")); string(got) != "v2" {
+		t.Errorf("changed module was not applied: rc = %q", got)
+	}
+
+	// A module of the same name in another config file is not the same module.
+	r.ConfigPath = filepath.Join(repo, "other.yaml")
+	if r.unchangedSinceApply(r.Config.Modules[0]) {
+		t.Error("a module applied from another config should count as changed")
+	}
+	r.ConfigPath = ""
+
+	// So does a config change.
+	r.Config.Modules[0].Items[0].Permissions = "0600"
+	if r.unchangedSinceApply(r.Config.Modules[0]) {
+		t.Error("a config change should count as changed")
+	}
+}
+
+func TestProfileApplyNotRecorded(t *testing.T) {
+	cfg := config.Config{Modules: []config.Module{{Name: "tools", Items: []config.Item{{Run: "true"}}}}}
+	r := newTestRunner(cfg)
+	r.DryRun = false
+	r.State = state.New()
+	p, _ := LookupProfile(cfg, ProfileDevcontainer)
+	r.UseProfile(ProfileDevcontainer, p)
+	if err := r.ApplyAll(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if !r.LastApplied("tools").IsZero() {
+		t.Error("a profile-limited apply must not be recorded as a full apply")
+	}
+}
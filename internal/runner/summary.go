@@ -0,0 +1,120 @@
+package runner
+
+import (
+	"context"
+	"time"
+
+	"github.com/atomikpanda/dotular/internal/actions"
+	"github.com/atomikpanda/dotular/internal/audit"
+)
+
+// ModuleSummary counts a module's items by how the machine compares with
+// the config, for `dotular status --summary`.
+type ModuleSummary struct {
+	Module  string `json:"module"`
+	Skipped bool   `json:"skipped,omitempty"` // tag mismatch
+	// InSync items are already applied or skipped by creates, skip_if, or
+	// unless.
+	InSync int `json:"in_sync"`
+	// Modified items have a destination that exists but differs.
+	Modified int `json:"modified"`
+	// Missing items would be created, installed, or run.
+	Missing int `json:"missing"`
+	// Errors counts items whose checks failed.
+	Errors int `json:"errors"`
+	// LastApplied is when the module last applied successfully on this
+	// machine, from the state file, or else when the audit log last shows
+	// one of its items succeeding; zero if never.
+	LastApplied time.Time `json:"last_applied,omitempty"`
+}
+
+// NeedsAttention reports whether anything in the module would change or
+// could not be checked.
+func (s ModuleSummary) NeedsAttention() bool {
+	return s.Modified > 0 || s.Missing > 0 || s.Errors > 0
+}
+
+// Summarize plans every module that matches the machine's tags, running
+// guards and idempotency checks, and counts its items. Unlike Plan, an item
+// whose check fails is counted as an error instead of stopping the summary.
+func (r *Runner) Summarize(ctx context.Context) ([]ModuleSummary, error) {
+	lastApplied := lastApplied()
+	var out []ModuleSummary
+	for _, mod := range r.Config.Modules {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		sum := ModuleSummary{Module: mod.Name, LastApplied: r.LastApplied(mod.Name)}
+		if sum.LastApplied.IsZero() {
+			sum.LastApplied = lastApplied[mod.Name]
+		}
+		if !r.matchesTags(mod) {
+			sum.Skipped = true
+			out = append(out, sum)
+			continue
+		}
+		items, err := r.expandItems(mod)
+		if err != nil {
+			sum.Errors++
+		}
+		for i, item := range items {
+			pa, err := r.planItem(ctx, mod.Name, i, item, checkNow)
+			if err != nil {
+				sum.Errors++
+				continue
+			}
+			countItem(ctx, pa, &sum)
+		}
+		out = append(out, sum)
+	}
+	return out, nil
+}
+
+// countItem adds a planned item to sum. Items skipped for other reasons,
+// such as another OS or a when condition, are not counted.
+func countItem(ctx context.Context, pa PlannedAction, sum *ModuleSummary) {
+	if pa.Status == StatusSkip {
+		switch pa.Reason {
+		case "already applied", "creates", "skip_if", "unless":
+			sum.InSync++
+		}
+		return
+	}
+	prev, ok := pa.Action.(actions.Previewer)
+	if !ok {
+		sum.Missing++
+		return
+	}
+	change, err := prev.Preview(ctx)
+	switch {
+	case err != nil:
+		sum.Errors++
+	case change.Kind == actions.ChangeModified:
+		sum.Modified++
+	case change.Kind == actions.ChangeUnchanged:
+		sum.InSync++
+	default:
+		sum.Missing++
+	}
+}
+
+// lastApplied returns, per module, when an apply, push, pull, or sync last
+// ran one of its items successfully.
+func lastApplied() map[string]time.Time {
+	entries, _ := audit.Read("", 0)
+	last := make(map[string]time.Time)
+	for _, e := range entries {
+		switch e.Command {
+		case "apply", "push", "pull", "sync":
+		default:
+			continue
+		}
+		if e.Outcome != "success" && e.Outcome != "unchanged" {
+			continue
+		}
+		if e.Time.After(last[e.Module]) {
+			last[e.Module] = e.Time
+		}
+	}
+	return last
+}
@@ -0,0 +1,66 @@
+package runner
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/atomikpanda/dotular/internal/audit"
+	"github.com/atomikpanda/dotular/internal/config"
+)
+
+func TestSummarize(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	repo := t.TempDir()
+	dest := t.TempDir()
+	wd, _ := os.Getwd()
+	os.Chdir(repo)
+	t.Cleanup(func() { os.Chdir(wd) })
+	os.MkdirAll(filepath.Join(repo, "dots"), 0o755)
+	for _, name := range []string{"same", "changed", "new"} {
+		os.WriteFile(filepath.Join(repo, "dots", name), []byte("repo"), 0o644)
+	}
+	os.WriteFile(filepath.Join(dest, "same"), []byte("repo"), 0o644)
+	os.WriteFile(filepath.Join(dest, "changed"), []byte("edited"), 0o644)
+
+	to := config.PlatformMap{MacOS: dest + "/"}
+	cfg := config.Config{Modules: []config.Module{
+		{Name: "dots", Items: []config.Item{
+			{File: "same", Destination: to},
+			{File: "changed", Destination: to},
+			{File: "new", Destination: to},
+			{Run: "echo hi", SkipIf: "true"},
+			{Run: "echo hi", SkipIf: "exit 1"},
+			{Run: "echo hi", RetryDelay: "soon"},
+		}},
+		{Name: "work", OnlyTags: []string{"work"}, Items: []config.Item{{Run: "true"}}},
+	}}
+	applied := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	audit.Log(audit.Entry{Time: applied, Command: "apply", Module: "dots", Item: "x", Outcome: "success"})
+	audit.Log(audit.Entry{Time: applied.Add(time.Hour), Command: "apply", Module: "dots", Item: "x", Outcome: "failure"})
+	audit.Log(audit.Entry{Time: applied.Add(2 * time.Hour), Command: "verify", Module: "dots", Item: "x", Outcome: "success"})
+
+	r := newTestRunner(cfg)
+	sums, err := r.Summarize(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sums) != 2 {
+		t.Fatalf("got %d summaries, want 2", len(sums))
+	}
+	dots := sums[0]
+	if dots.InSync != 2 || dots.Modified != 1 || dots.Missing != 2 || dots.Errors != 1 {
+		t.Errorf("dots = %+v, want 2 in sync, 1 modified, 2 missing, 1 error", dots)
+	}
+	if !dots.LastApplied.Equal(applied) {
+		t.Errorf("LastApplied = %v, want the last successful apply %v", dots.LastApplied, applied)
+	}
+	if !dots.NeedsAttention() {
+		t.Error("dots should need attention")
+	}
+	if work := sums[1]; !work.Skipped || work.NeedsAttention() || !work.LastApplied.IsZero() {
+		t.Errorf("work = %+v, want skipped by tags", work)
+	}
+}
@@ -0,0 +1,95 @@
+package runner
+
+import (
+	"context"
+
+	"github.com/atomikpanda/dotular/internal/actions"
+	"github.com/atomikpanda/dotular/internal/audit"
+	"github.com/atomikpanda/dotular/internal/config"
+	"github.com/atomikpanda/dotular/internal/state"
+)
+
+// ModuleResources returns the recorded resources deployed by the named
+// module from this runner's config, ordered by key. A module of the same
+// name in another config on this machine is a different module.
+func (r *Runner) ModuleResources(module string) []state.Resource {
+	if r.State == nil {
+		return nil
+	}
+	var out []state.Resource
+	for _, res := range r.State.Sorted() {
+		if res.Module == module && res.Config == r.configKey() {
+			out = append(out, res)
+		}
+	}
+	return out
+}
+
+// Unapply reverses what mod deployed on this machine, as recorded in the
+// state file. Files, symlinks, and binaries are removed under the same rules
+// as Clean; packages are uninstalled only when uninstallPackages is set, and
+// directories are always kept. The module's before_unapply and after_unapply
+// hooks run around the removal. In dry-run mode nothing is touched and every
+// resource is reported as neither removed nor kept. Like an apply, a real
+// unapply holds the config's run lock.
+func (r *Runner) Unapply(ctx context.Context, mod config.Module, uninstallPackages bool) ([]CleanResult, error) {
+	if !r.DryRun && r.ConfigPath != "" {
+		l, err := r.lock(ctx)
+		if err != nil {
+			return nil, err
+		}
+		defer l.Release()
+	}
+	if err := r.runHook(ctx, mod.Hooks.BeforeUnapply, "module", mod.Name, "before_unapply", hookEnv{Module: mod.Name}); err != nil {
+		return nil, err
+	}
+
+	ctx = actions.WithReporter(ctx, r.reporter(r.UI.Out))
+	resources := r.ModuleResources(mod.Name)
+	results := make([]CleanResult, 0, len(resources))
+	for _, res := range resources {
+		if r.DryRun {
+			if res.Kind == state.KindPackage && uninstallPackages {
+				pa := &actions.PackageAction{Package: res.Package, Manager: res.Manager}
+				if err := pa.Uninstall(ctx, true); err != nil {
+					results = append(results, CleanResult{Resource: res, Reason: err.Error()})
+					continue
+				}
+			}
+			results = append(results, CleanResult{Resource: res})
+			continue
+		}
+
+		var removed bool
+		var reason string
+		switch {
+		case res.Kind == state.KindPackage && uninstallPackages:
+			pa := &actions.PackageAction{Package: res.Package, Manager: res.Manager}
+			if err := pa.Uninstall(ctx, false); err != nil {
+				reason = err.Error()
+			} else {
+				removed = true
+			}
+		case res.Kind == state.KindPackage:
+			reason = "packages are kept; use --packages to uninstall"
+		default:
+			removed, reason = removeResource(res)
+		}
+
+		if reason == "" {
+			r.State.Remove(res.Key())
+		}
+		outcome := "success"
+		if reason != "" {
+			outcome = "skipped"
+		}
+		audit.Log(audit.Entry{Command: "unapply", Module: mod.Name, Item: res.Key(), Outcome: outcome, Detail: reason})
+		results = append(results, CleanResult{Resource: res, Removed: removed, Reason: reason})
+	}
+	r.saveState()
+
+	if err := r.runHook(ctx, mod.Hooks.AfterUnapply, "module", mod.Name, "after_unapply", hookEnv{Module: mod.Name, Outcome: "success"}); err != nil {
+		return results, err
+	}
+	return results, nil
+}
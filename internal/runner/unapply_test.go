@@ -0,0 +1,111 @@
+package runner
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/atomikpanda/dotular/internal/config"
+	"github.com/atomikpanda/dotular/internal/state"
+)
+
+func TestModuleResources(t *testing.T) {
+	r := newTestRunner(config.Config{})
+	r.State = state.New()
+	r.State.Record(state.Resource{Kind: state.KindFile, Path: "/b", Module: "m"})
+	r.State.Record(state.Resource{Kind: state.KindFile, Path: "/a", Module: "m"})
+	r.State.Record(state.Resource{Kind: state.KindFile, Path: "/c", Module: "other"})
+	r.State.Record(state.Resource{Kind: state.KindFile, Path: "/d", Module: "m", Config: "/other/dotular.yaml"})
+
+	got := r.ModuleResources("m")
+	if len(got) != 2 || got[0].Path != "/a" || got[1].Path != "/b" {
+		t.Errorf("ModuleResources = %+v", got)
+	}
+}
+
+func TestUnapply(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "file")
+	os.WriteFile(file, []byte("a"), 0o644)
+	hash, _ := state.HashFile(file)
+	other := filepath.Join(dir, "other")
+	os.WriteFile(other, []byte("b"), 0o644)
+	marker := filepath.Join(dir, "hooks")
+
+	mod := config.Module{Name: "m", Hooks: config.ModuleHooks{
+		BeforeUnapply: "echo before >> " + marker,
+		AfterUnapply:  "echo after >> " + marker,
+	}}
+	r := newTestRunner(config.Config{Modules: []config.Module{mod}})
+	r.DryRun = false
+	r.Command = "unapply"
+	r.StatePath = filepath.Join(dir, "state.json")
+	r.State = state.New()
+	r.State.Record(state.Resource{Kind: state.KindFile, Path: file, Hash: hash, Module: "m"})
+	r.State.Record(state.Resource{Kind: state.KindPackage, Package: "git", Manager: "brew", Module: "m"})
+	r.State.Record(state.Resource{Kind: state.KindFile, Path: other, Module: "other"})
+
+	results, err := r.Unapply(context.Background(), mod, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 2 {
+		t.Fatalf("results = %+v", results)
+	}
+	for _, res := range results {
+		switch res.Resource.Kind {
+		case state.KindFile:
+			if !res.Removed {
+				t.Errorf("file not removed: %q", res.Reason)
+			}
+		case state.KindPackage:
+			if res.Removed || res.Reason == "" {
+				t.Errorf("package should be kept without --packages: %+v", res)
+			}
+		}
+	}
+	if _, err := os.Stat(file); !os.IsNotExist(err) {
+		t.Error("deployed file should be removed")
+	}
+	if _, err := os.Stat(other); err != nil {
+		t.Error("another module's file must not be touched")
+	}
+
+	saved, err := state.Load(r.StatePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(saved.Resources) != 2 {
+		t.Errorf("state keeps %d resources, want the package and the other module's file", len(saved.Resources))
+	}
+
+	hooks, _ := os.ReadFile(marker)
+	if string(hooks) != "before\nafter\n" {
+		t.Errorf("hooks ran %q", hooks)
+	}
+}
+
+func TestUnapplyDryRun(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "file")
+	os.WriteFile(file, []byte("a"), 0o644)
+
+	r := newTestRunner(config.Config{})
+	r.State = state.New()
+	r.State.Record(state.Resource{Kind: state.KindFile, Path: file, Module: "m"})
+
+	results, err := r.Unapply(context.Background(), config.Module{Name: "m"}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0].Removed {
+		t.Errorf("results = %+v", results)
+	}
+	if _, err := os.Stat(file); err != nil {
+		t.Error("dry run must not remove files")
+	}
+	if len(r.State.Resources) != 1 {
+		t.Error("dry run must not forget resources")
+	}
+}
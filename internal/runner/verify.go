@@ -0,0 +1,125 @@
+package runner
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+
+	"github.com/atomikpanda/dotular/internal/actions"
+	"github.com/atomikpanda/dotular/internal/config"
+	"github.com/atomikpanda/dotular/internal/platform"
+	"github.com/atomikpanda/dotular/internal/version"
+)
+
+// verifyChecks describes the verify command and built-in checks verifyItem
+// would run for item, for dry-run output.
+func verifyChecks(item config.Item) []string {
+	var out []string
+	if cmd := item.Verify.Command; cmd != "" {
+		check := "verify: " + cmd
+		if item.Verify.Expect != "" {
+			check += fmt.Sprintf(" (expect %q)", item.Verify.Expect)
+		}
+		out = append(out, check)
+	}
+	if item.VerifyFileExists != "" {
+		out = append(out, "verify_file_exists: "+item.VerifyFileExists)
+	}
+	if item.VerifySymlink != "" {
+		out = append(out, "verify_symlink: "+item.VerifySymlink)
+	}
+	if item.VerifyVersion != "" {
+		out = append(out, "verify_version: "+item.VerifyVersion)
+	}
+	return out
+}
+
+// verifyItem runs the item's verify command and built-in checks, returning
+// the first that fails.
+func (r *Runner) verifyItem(ctx context.Context, item config.Item, action actions.Action) error {
+	var output string
+	if cmd := item.Verify.Command; cmd != "" {
+		if item.Verify.Expect == "" && item.VerifyVersion == "" {
+			if err := r.shellFor(item).Run(ctx, cmd); err != nil {
+				return err
+			}
+		} else {
+			c, err := r.shellFor(item).Command(ctx, cmd)
+			if err != nil {
+				return err
+			}
+			c.Stdout, c.Stderr = nil, nil
+			out, err := c.CombinedOutput()
+			if err != nil {
+				return err
+			}
+			output = string(out)
+		}
+		if item.Verify.Expect != "" {
+			re, err := regexp.Compile(item.Verify.Expect)
+			if err != nil {
+				return fmt.Errorf("invalid verify expect: %w", err)
+			}
+			if !re.MatchString(output) {
+				return fmt.Errorf("output of %q does not match %q", cmd, item.Verify.Expect)
+			}
+		}
+	}
+
+	if item.VerifyFileExists != "" {
+		path := platform.ExpandPath(item.VerifyFileExists)
+		if _, err := os.Stat(path); err != nil {
+			return fmt.Errorf("verify_file_exists: %w", err)
+		}
+	}
+
+	if item.VerifySymlink != "" {
+		path := platform.ExpandPath(item.VerifySymlink)
+		info, err := os.Lstat(path)
+		if err != nil {
+			return fmt.Errorf("verify_symlink: %w", err)
+		}
+		if info.Mode()&os.ModeSymlink == 0 {
+			return fmt.Errorf("verify_symlink: %s is not a symlink", path)
+		}
+		if _, err := os.Stat(path); err != nil {
+			return fmt.Errorf("verify_symlink: %s is a broken link", path)
+		}
+	}
+
+	if item.VerifyVersion != "" {
+		constraint, err := version.ParseConstraint(item.VerifyVersion)
+		if err != nil {
+			return fmt.Errorf("verify_version: %w", err)
+		}
+		if item.Verify.Command == "" {
+			program := versionProgram(item, action)
+			out, err := exec.CommandContext(ctx, program, "--version").CombinedOutput()
+			if err != nil {
+				return fmt.Errorf("verify_version: %s --version: %w", program, err)
+			}
+			output = string(out)
+		}
+		v, ok := version.Find(output)
+		if !ok {
+			return fmt.Errorf("verify_version: no version in output %q", strings.TrimSpace(output))
+		}
+		if !constraint.Check(v) {
+			return fmt.Errorf("verify_version: version %s does not satisfy %s", v, constraint)
+		}
+	}
+	return nil
+}
+
+// versionProgram returns the program whose --version output verify_version
+// checks when the item has no verify command: the installed binary of a
+// binary item, otherwise the item's name looked up on PATH.
+func versionProgram(item config.Item, action actions.Action) string {
+	if ba, ok := action.(*actions.BinaryAction); ok {
+		return ba.InstalledPath()
+	}
+	return item.PrimaryValue()
+}
@@ -0,0 +1,72 @@
+package runner
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/atomikpanda/dotular/internal/config"
+)
+
+func TestVerifyItem(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Unix-only test")
+	}
+	dir := t.TempDir()
+	file := filepath.Join(dir, "file")
+	if err := os.WriteFile(file, []byte("x"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	link := filepath.Join(dir, "link")
+	if err := os.Symlink(file, link); err != nil {
+		t.Fatal(err)
+	}
+	broken := filepath.Join(dir, "broken")
+	if err := os.Symlink(filepath.Join(dir, "missing"), broken); err != nil {
+		t.Fatal(err)
+	}
+	tool := filepath.Join(dir, "tool")
+	if err := os.WriteFile(tool, []byte("#!/bin/sh\necho 'tool v0.9.5 (build 2024)'\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	tests := []struct {
+		name    string
+		item    config.Item
+		wantErr string
+	}{
+		{"expect match", config.Item{Run: "x", Verify: config.Verify{Command: "echo ready", Expect: "^rea"}}, ""},
+		{"expect mismatch", config.Item{Run: "x", Verify: config.Verify{Command: "echo ready", Expect: "^done"}}, "does not match"},
+		{"file exists", config.Item{Run: "x", VerifyFileExists: file}, ""},
+		{"file missing", config.Item{Run: "x", VerifyFileExists: filepath.Join(dir, "missing")}, "verify_file_exists"},
+		{"symlink", config.Item{Run: "x", VerifySymlink: link}, ""},
+		{"not a symlink", config.Item{Run: "x", VerifySymlink: file}, "not a symlink"},
+		{"broken symlink", config.Item{Run: "x", VerifySymlink: broken}, "broken link"},
+		{"version from program", config.Item{Package: "tool", VerifyVersion: ">=0.9"}, ""},
+		{"version too old", config.Item{Package: "tool", VerifyVersion: ">=0.10"}, "does not satisfy"},
+		{"version from command", config.Item{Run: "x", Verify: config.Verify{Command: "echo 1.2.3"}, VerifyVersion: ">=1.2,<2"}, ""},
+	}
+	r := newTestRunner(config.Config{})
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			action, _, err := r.buildAction(tt.item, "mod")
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = r.verifyItem(context.Background(), tt.item, action)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("verifyItem: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("verifyItem error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,281 @@
+// Package schedule generates the system timer that runs dotular on an
+// interval: a launchd agent on macOS, a systemd user timer on Linux, and a
+// Task Scheduler task on Windows.
+package schedule
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/atomikpanda/dotular/internal/platform"
+)
+
+// Job is a dotular command run on an interval.
+type Job struct {
+	Command    string // "verify" | "apply"
+	Every      time.Duration
+	Executable string // absolute path of the dotular binary
+	Config     string // absolute path of the config file
+	Path       string // PATH for the job, so verify commands find their tools
+}
+
+// Name returns the job's file and task name, e.g. "dotular-verify".
+func Name(command string) string { return "dotular-" + command }
+
+// label returns the launchd label of the job.
+func label(command string) string { return "com.atomikpanda.dotular." + command }
+
+// Args returns the dotular command line the timer runs.
+func (j Job) Args() []string {
+	return []string{j.Executable, "--config", j.Config, "--quiet", j.Command}
+}
+
+// File is a file the timer is made of.
+type File struct {
+	Path    string
+	Content string
+}
+
+// Step is a command run to load or unload the timer. Optional steps may
+// fail, e.g. unloading a timer that was never loaded.
+type Step struct {
+	Args     []string
+	Optional bool
+}
+
+// Plan is what installing or uninstalling a timer writes, removes, and runs.
+type Plan struct {
+	Files  []File // written on install, removed on uninstall
+	Before []Step // run before the files are written or removed
+	After  []Step // run after
+}
+
+// Validate checks the command and interval.
+func (j Job) Validate() error {
+	switch j.Command {
+	case "verify", "apply":
+	default:
+		return fmt.Errorf("cannot schedule %q (want verify or apply)", j.Command)
+	}
+	if j.Every < time.Minute {
+		return fmt.Errorf("interval %s is shorter than a minute", j.Every)
+	}
+	return nil
+}
+
+// InstallPlan returns the plan installing j on goos.
+func InstallPlan(goos string, j Job) (Plan, error) {
+	if err := j.Validate(); err != nil {
+		return Plan{}, err
+	}
+	switch goos {
+	case "darwin":
+		path := launchdPath(j.Command)
+		return Plan{
+			Files:  []File{{path, launchdPlist(j)}},
+			Before: []Step{{Args: []string{"launchctl", "unload", path}, Optional: true}},
+			After:  []Step{{Args: []string{"launchctl", "load", "-w", path}}},
+		}, nil
+	case "linux":
+		service, timer := systemdPaths(j.Command)
+		return Plan{
+			Files: []File{{service, systemdService(j)}, {timer, systemdTimer(j)}},
+			After: []Step{
+				{Args: []string{"systemctl", "--user", "daemon-reload"}},
+				{Args: []string{"systemctl", "--user", "enable", "--now", filepath.Base(timer)}},
+			},
+		}, nil
+	case "windows":
+		sched, err := schtasksInterval(j.Every)
+		if err != nil {
+			return Plan{}, err
+		}
+		args := append([]string{"schtasks", "/Create", "/F", "/TN", Name(j.Command)}, sched...)
+		args = append(args, "/TR", windowsCommandLine(j.Args()))
+		return Plan{After: []Step{{Args: args}}}, nil
+	default:
+		return Plan{}, fmt.Errorf("scheduling is not supported on %s", goos)
+	}
+}
+
+// UninstallPlan returns the plan removing the timer for command on goos.
+func UninstallPlan(goos, command string) (Plan, error) {
+	switch goos {
+	case "darwin":
+		path := launchdPath(command)
+		return Plan{
+			Files:  []File{{Path: path}},
+			Before: []Step{{Args: []string{"launchctl", "unload", path}, Optional: true}},
+		}, nil
+	case "linux":
+		service, timer := systemdPaths(command)
+		return Plan{
+			Files:  []File{{Path: service}, {Path: timer}},
+			Before: []Step{{Args: []string{"systemctl", "--user", "disable", "--now", filepath.Base(timer)}, Optional: true}},
+			After:  []Step{{Args: []string{"systemctl", "--user", "daemon-reload"}}},
+		}, nil
+	case "windows":
+		return Plan{After: []Step{{Args: []string{"schtasks", "/Delete", "/F", "/TN", Name(command)}}}}, nil
+	default:
+		return Plan{}, fmt.Errorf("scheduling is not supported on %s", goos)
+	}
+}
+
+// Install writes the plan's files and loads the timer.
+func Install(ctx context.Context, p Plan) error {
+	if err := run(ctx, p.Before); err != nil {
+		return err
+	}
+	for _, f := range p.Files {
+		if err := os.MkdirAll(filepath.Dir(f.Path), 0o755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(f.Path, []byte(f.Content), 0o644); err != nil {
+			return fmt.Errorf("write %s: %w", f.Path, err)
+		}
+	}
+	return run(ctx, p.After)
+}
+
+// Uninstall unloads the timer and removes the plan's files.
+func Uninstall(ctx context.Context, p Plan) error {
+	if err := run(ctx, p.Before); err != nil {
+		return err
+	}
+	for _, f := range p.Files {
+		if err := os.Remove(f.Path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	return run(ctx, p.After)
+}
+
+// execCommand is replaced in tests.
+var execCommand = exec.CommandContext
+
+func run(ctx context.Context, steps []Step) error {
+	for _, s := range steps {
+		out, err := execCommand(ctx, s.Args[0], s.Args[1:]...).CombinedOutput()
+		if err != nil && !s.Optional {
+			return fmt.Errorf("%s: %w: %s", strings.Join(s.Args, " "), err, strings.TrimSpace(string(out)))
+		}
+	}
+	return nil
+}
+
+// --- launchd -----------------------------------------------------------------
+
+func launchdPath(command string) string {
+	return platform.ExpandPath("~/Library/LaunchAgents/" + label(command) + ".plist")
+}
+
+func launchdPlist(j Job) string {
+	esc := func(s string) string {
+		var b bytes.Buffer
+		xml.EscapeText(&b, []byte(s))
+		return b.String()
+	}
+	logPath := platform.ExpandPath("~/Library/Logs/" + Name(j.Command) + ".log")
+	var b strings.Builder
+	b.WriteString(`<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+<dict>
+	<key>Label</key>
+	<string>` + label(j.Command) + `</string>
+	<key>ProgramArguments</key>
+	<array>
+`)
+	for _, a := range j.Args() {
+		b.WriteString("\t\t<string>" + esc(a) + "</string>\n")
+	}
+	b.WriteString("\t</array>\n")
+	if j.Path != "" {
+		b.WriteString("\t<key>EnvironmentVariables</key>\n\t<dict>\n\t\t<key>PATH</key>\n\t\t<string>" + esc(j.Path) + "</string>\n\t</dict>\n")
+	}
+	fmt.Fprintf(&b, "\t<key>StartInterval</key>\n\t<integer>%d</integer>\n", int(j.Every.Seconds()))
+	b.WriteString("\t<key>StandardOutPath</key>\n\t<string>" + esc(logPath) + "</string>\n")
+	b.WriteString("\t<key>StandardErrorPath</key>\n\t<string>" + esc(logPath) + "</string>\n")
+	b.WriteString("</dict>\n</plist>\n")
+	return b.String()
+}
+
+// --- systemd -----------------------------------------------------------------
+
+func systemdPaths(command string) (service, timer string) {
+	dir := filepath.Join(platform.Getenv("XDG_CONFIG_HOME"), "systemd", "user")
+	return filepath.Join(dir, Name(command)+".service"), filepath.Join(dir, Name(command)+".timer")
+}
+
+// systemdQuote quotes an ExecStart argument when it needs it.
+func systemdQuote(arg string) string {
+	if arg != "" && !strings.ContainsAny(arg, " \t\"'\\$%;") {
+		return arg
+	}
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, `$`, `$$`, `%`, `%%`)
+	return `"` + r.Replace(arg) + `"`
+}
+
+func systemdService(j Job) string {
+	args := j.Args()
+	for i, a := range args {
+		args[i] = systemdQuote(a)
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "[Unit]\nDescription=dotular %s\n\n[Service]\nType=oneshot\n", j.Command)
+	if j.Path != "" {
+		fmt.Fprintf(&b, "Environment=%s\n", systemdQuote("PATH="+j.Path))
+	}
+	fmt.Fprintf(&b, "ExecStart=%s\n", strings.Join(args, " "))
+	return b.String()
+}
+
+func systemdTimer(j Job) string {
+	return fmt.Sprintf(`[Unit]
+Description=Run dotular %s every %s
+
+[Timer]
+OnBootSec=5min
+OnUnitActiveSec=%ds
+
+[Install]
+WantedBy=timers.target
+`, j.Command, j.Every, int(j.Every.Seconds()))
+}
+
+// --- Task Scheduler ----------------------------------------------------------
+
+// schtasksInterval returns the /SC and /MO arguments for every, which
+// schtasks expresses in whole minutes (under a day), hours, or days.
+func schtasksInterval(every time.Duration) ([]string, error) {
+	switch {
+	case every%(24*time.Hour) == 0:
+		return []string{"/SC", "DAILY", "/MO", fmt.Sprint(int(every / (24 * time.Hour)))}, nil
+	case every%time.Hour == 0 && every < 24*time.Hour:
+		return []string{"/SC", "HOURLY", "/MO", fmt.Sprint(int(every / time.Hour))}, nil
+	case every%time.Minute == 0 && every < 24*time.Hour:
+		return []string{"/SC", "MINUTE", "/MO", fmt.Sprint(int(every / time.Minute))}, nil
+	default:
+		return nil, fmt.Errorf("Task Scheduler cannot run every %s; use whole minutes under a day, or whole days", every)
+	}
+}
+
+// windowsCommandLine joins args for /TR, quoting those with spaces.
+func windowsCommandLine(args []string) string {
+	quoted := make([]string, len(args))
+	for i, a := range args {
+		if a == "" || strings.ContainsAny(a, " \t") {
+			a = `"` + a + `"`
+		}
+		quoted[i] = a
+	}
+	return strings.Join(quoted, " ")
+}
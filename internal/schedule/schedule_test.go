@@ -0,0 +1,179 @@
+package schedule
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testJob() Job {
+	return Job{
+		Command:    "verify",
+		Every:      6 * time.Hour,
+		Executable: "/usr/local/bin/dotular",
+		Config:     "/home/me/dot files/dotular.yaml",
+		Path:       "/usr/local/bin:/usr/bin",
+	}
+}
+
+func TestValidate(t *testing.T) {
+	if err := testJob().Validate(); err != nil {
+		t.Fatal(err)
+	}
+	j := testJob()
+	j.Command = "clean"
+	if err := j.Validate(); err == nil || !strings.Contains(err.Error(), "cannot schedule") {
+		t.Errorf("command error = %v", err)
+	}
+	j = testJob()
+	j.Every = 30 * time.Second
+	if err := j.Validate(); err == nil || !strings.Contains(err.Error(), "shorter than a minute") {
+		t.Errorf("interval error = %v", err)
+	}
+}
+
+func TestInstallPlanDarwin(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	p, err := InstallPlan("darwin", testJob())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := filepath.Join(home, "Library", "LaunchAgents", "com.atomikpanda.dotular.verify.plist")
+	if len(p.Files) != 1 || p.Files[0].Path != want {
+		t.Fatalf("files = %+v", p.Files)
+	}
+	plist := p.Files[0].Content
+	for _, s := range []string{
+		"<string>com.atomikpanda.dotular.verify</string>",
+		"<string>/home/me/dot files/dotular.yaml</string>",
+		"<key>StartInterval</key>\n\t<integer>21600</integer>",
+		"<string>/usr/local/bin:/usr/bin</string>",
+	} {
+		if !strings.Contains(plist, s) {
+			t.Errorf("plist missing %q:\n%s", s, plist)
+		}
+	}
+	if !p.Before[0].Optional || p.After[0].Args[1] != "load" {
+		t.Errorf("steps = %+v %+v", p.Before, p.After)
+	}
+}
+
+func TestInstallPlanLinux(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", "/cfg")
+	p, err := InstallPlan("linux", testJob())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Files[0].Path != filepath.Join("/cfg", "systemd", "user", "dotular-verify.service") {
+		t.Errorf("service path = %s", p.Files[0].Path)
+	}
+	service, timer := p.Files[0].Content, p.Files[1].Content
+	if !strings.Contains(service, `ExecStart=/usr/local/bin/dotular --config "/home/me/dot files/dotular.yaml" --quiet verify`) {
+		t.Errorf("service:\n%s", service)
+	}
+	if !strings.Contains(timer, "OnUnitActiveSec=21600s") {
+		t.Errorf("timer:\n%s", timer)
+	}
+	last := p.After[len(p.After)-1].Args
+	if !reflect.DeepEqual(last, []string{"systemctl", "--user", "enable", "--now", "dotular-verify.timer"}) {
+		t.Errorf("enable step = %v", last)
+	}
+}
+
+func TestInstallPlanWindows(t *testing.T) {
+	j := testJob()
+	j.Executable = `C:\Program Files\dotular\dotular.exe`
+	p, err := InstallPlan("windows", j)
+	if err != nil {
+		t.Fatal(err)
+	}
+	args := strings.Join(p.After[0].Args, " ")
+	for _, s := range []string{"/TN dotular-verify", "/SC HOURLY /MO 6", `/TR "C:\Program Files\dotular\dotular.exe" --config`} {
+		if !strings.Contains(args, s) {
+			t.Errorf("schtasks args missing %q: %s", s, args)
+		}
+	}
+
+	j.Every = 90 * time.Second
+	if _, err := InstallPlan("windows", j); err == nil {
+		t.Error("expected error for an interval in seconds")
+	}
+}
+
+func TestSchtasksInterval(t *testing.T) {
+	tests := []struct {
+		every time.Duration
+		want  []string
+	}{
+		{30 * time.Minute, []string{"/SC", "MINUTE", "/MO", "30"}},
+		{90 * time.Minute, []string{"/SC", "MINUTE", "/MO", "90"}},
+		{2 * time.Hour, []string{"/SC", "HOURLY", "/MO", "2"}},
+		{48 * time.Hour, []string{"/SC", "DAILY", "/MO", "2"}},
+	}
+	for _, tt := range tests {
+		got, err := schtasksInterval(tt.every)
+		if err != nil || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("schtasksInterval(%s) = %v, %v; want %v", tt.every, got, err, tt.want)
+		}
+	}
+	if _, err := schtasksInterval(36 * time.Hour); err == nil {
+		t.Error("expected error for 36h")
+	}
+}
+
+func TestInstallAndUninstall(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	var ran []string
+	execCommand = func(ctx context.Context, name string, args ...string) *exec.Cmd {
+		ran = append(ran, name+" "+strings.Join(args, " "))
+		return exec.CommandContext(ctx, "true")
+	}
+	defer func() { execCommand = exec.CommandContext }()
+	if _, err := exec.LookPath("true"); err != nil {
+		t.Skip("true not available")
+	}
+
+	p, err := InstallPlan("linux", testJob())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Install(context.Background(), p); err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range p.Files {
+		if _, err := os.Stat(f.Path); err != nil {
+			t.Errorf("%s not written: %v", f.Path, err)
+		}
+	}
+
+	u, err := UninstallPlan("linux", "verify")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Uninstall(context.Background(), u); err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range p.Files {
+		if _, err := os.Stat(f.Path); !os.IsNotExist(err) {
+			t.Errorf("%s not removed", f.Path)
+		}
+	}
+	if len(ran) != 4 || !strings.HasPrefix(ran[2], "systemctl --user disable") {
+		t.Errorf("ran = %q", ran)
+	}
+}
+
+func TestUnsupportedOS(t *testing.T) {
+	if _, err := InstallPlan("plan9", testJob()); err == nil {
+		t.Error("expected error")
+	}
+	if _, err := UninstallPlan("plan9", "verify"); err == nil {
+		t.Error("expected error")
+	}
+}
@@ -1,23 +1,103 @@
 // Package shell provides helpers for evaluating user-supplied shell commands
-// (skip_if, verify, hooks).
+// (skip_if, verify, hooks, run items).
 package shell
 
 import (
 	"context"
+	"fmt"
+	"os"
 	"os/exec"
 	"runtime"
 )
 
-// Run executes command in a shell and returns an error if the exit code is non-zero.
-func Run(ctx context.Context, command string) error {
-	cmd := shellCmd(ctx, command)
+// Shell names the interpreter commands run in: sh, bash, zsh, pwsh,
+// powershell, or cmd. The zero value is the platform default — sh, or on
+// Windows pwsh when it is installed and powershell otherwise.
+type Shell string
+
+// Names lists the accepted Shell values.
+var Names = []string{"sh", "bash", "zsh", "pwsh", "powershell", "cmd"}
+
+// Valid reports whether s is the default or one of Names.
+func (s Shell) Valid() bool {
+	if s == "" {
+		return true
+	}
+	for _, n := range Names {
+		if string(s) == n {
+			return true
+		}
+	}
+	return false
+}
+
+// resolve returns the concrete shell name for s on this platform.
+func (s Shell) resolve() string {
+	if s != "" {
+		return string(s)
+	}
+	if runtime.GOOS != "windows" {
+		return "sh"
+	}
+	if _, err := exec.LookPath("pwsh"); err == nil {
+		return "pwsh"
+	}
+	return "powershell"
+}
+
+// Args returns the interpreter invocation that runs command in s.
+//
+// PowerShell does not fail a -Command script when a native program exits
+// non-zero, so the command is wrapped to stop on errors and to propagate
+// $LASTEXITCODE; otherwise failing hooks and verify checks would pass.
+func (s Shell) Args(command string) ([]string, error) {
+	switch name := s.resolve(); name {
+	case "sh", "bash", "zsh":
+		return []string{name, "-c", command}, nil
+	case "pwsh", "powershell":
+		script := "$ErrorActionPreference = 'Stop'; " + command + "\nif ($LASTEXITCODE) { exit $LASTEXITCODE }"
+		return []string{name, "-NoProfile", "-NonInteractive", "-Command", script}, nil
+	case "cmd":
+		return []string{"cmd", "/C", command}, nil
+	default:
+		return nil, fmt.Errorf("unknown shell %q (want sh, bash, zsh, pwsh, powershell, or cmd)", name)
+	}
+}
+
+// Command returns an exec.Cmd that runs command in s.
+func (s Shell) Command(ctx context.Context, command string) (*exec.Cmd, error) {
+	args, err := s.Args(command)
+	if err != nil {
+		return nil, err
+	}
+	return exec.CommandContext(ctx, args[0], args[1:]...), nil
+}
+
+// Run executes command in s and returns an error if the exit code is non-zero.
+func (s Shell) Run(ctx context.Context, command string) error {
+	return s.RunEnv(ctx, command, nil)
+}
+
+// RunEnv is like Run but adds env (KEY=value pairs) to the inherited
+// environment.
+func (s Shell) RunEnv(ctx context.Context, command string, env []string) error {
+	cmd, err := s.Command(ctx, command)
+	if err != nil {
+		return err
+	}
+	if len(env) > 0 {
+		cmd.Env = append(os.Environ(), env...)
+	}
 	return cmd.Run()
 }
 
-// Eval executes command and returns true when it exits 0 (success).
+// Eval executes command in s and returns true when it exits 0 (success).
 // A non-zero exit is not treated as a Go error; only execution failures are.
-func Eval(ctx context.Context, command string) (exitsZero bool, err error) {
-	cmd := shellCmd(ctx, command)
+func (s Shell) Eval(ctx context.Context, command string) (exitsZero bool, err error) {
+	cmd, err := s.Command(ctx, command)
+	if err != nil {
+		return false, err
+	}
 	runErr := cmd.Run()
 	if runErr == nil {
 		return true, nil
@@ -28,9 +108,20 @@ func Eval(ctx context.Context, command string) (exitsZero bool, err error) {
 	return false, runErr // real execution failure (binary not found, etc.)
 }
 
-func shellCmd(ctx context.Context, command string) *exec.Cmd {
-	if runtime.GOOS == "windows" {
-		return exec.CommandContext(ctx, "powershell", "-Command", command)
-	}
-	return exec.CommandContext(ctx, "sh", "-c", command)
+// Run executes command in the default shell and returns an error if the
+// exit code is non-zero.
+func Run(ctx context.Context, command string) error {
+	return Shell("").Run(ctx, command)
+}
+
+// RunEnv is like Run but adds env (KEY=value pairs) to the inherited
+// environment.
+func RunEnv(ctx context.Context, command string, env []string) error {
+	return Shell("").RunEnv(ctx, command, env)
+}
+
+// Eval executes command in the default shell and returns true when it exits
+// 0 (success).
+func Eval(ctx context.Context, command string) (exitsZero bool, err error) {
+	return Shell("").Eval(ctx, command)
 }
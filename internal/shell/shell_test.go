@@ -2,7 +2,9 @@ package shell
 
 import (
 	"context"
+	"os/exec"
 	"runtime"
+	"strings"
 	"testing"
 )
 
@@ -82,3 +84,82 @@ func TestRunCancelled(t *testing.T) {
 		t.Error("expected error for cancelled context")
 	}
 }
+
+func TestRunEnv(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("shell tests use Unix commands")
+	}
+	err := RunEnv(context.Background(), `test "$DOTULAR_TEST" = yes && test -n "$PATH"`, []string{"DOTULAR_TEST=yes"})
+	if err != nil {
+		t.Errorf("RunEnv should expose env and keep the inherited environment: %v", err)
+	}
+}
+
+func TestShellArgs(t *testing.T) {
+	tests := []struct {
+		shell Shell
+		want  string
+	}{
+		{"bash", "bash -c x"},
+		{"zsh", "zsh -c x"},
+		{"cmd", "cmd /C x"},
+	}
+	for _, tt := range tests {
+		got, err := tt.shell.Args("x")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.Join(got, " ") != tt.want {
+			t.Errorf("Args(%q) = %v, want %q", tt.shell, got, tt.want)
+		}
+	}
+	if _, err := Shell("fish").Args("x"); err == nil {
+		t.Error("expected error for unknown shell")
+	}
+}
+
+func TestShellArgsPowerShellPropagatesExitCode(t *testing.T) {
+	args, err := Shell("pwsh").Args("git fetch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if args[0] != "pwsh" || args[len(args)-2] != "-Command" {
+		t.Fatalf("Args = %v", args)
+	}
+	script := args[len(args)-1]
+	for _, want := range []string{"$ErrorActionPreference = 'Stop'", "git fetch", "exit $LASTEXITCODE"} {
+		if !strings.Contains(script, want) {
+			t.Errorf("script %q should contain %q", script, want)
+		}
+	}
+}
+
+func TestShellDefault(t *testing.T) {
+	args, err := Shell("").Args("x")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if runtime.GOOS != "windows" && args[0] != "sh" {
+		t.Errorf("default shell = %q, want sh", args[0])
+	}
+}
+
+func TestShellValid(t *testing.T) {
+	for _, s := range []Shell{"", "bash", "pwsh", "cmd"} {
+		if !s.Valid() {
+			t.Errorf("%q should be valid", s)
+		}
+	}
+	if Shell("fish").Valid() {
+		t.Error("fish should not be valid")
+	}
+}
+
+func TestShellRunBash(t *testing.T) {
+	if _, err := exec.LookPath("bash"); err != nil {
+		t.Skip("bash not installed")
+	}
+	if err := Shell("bash").Run(context.Background(), "[[ 1 == 1 ]]"); err != nil {
+		t.Errorf("bash run: %v", err)
+	}
+}
@@ -9,14 +9,16 @@ import (
 	"os"
 	"path/filepath"
 	"strconv"
+	"strings"
 )
 
 // Snapshot holds copies of files that existed before an apply started, plus a
 // list of paths that were newly created so they can be removed on rollback.
 type Snapshot struct {
 	dir     string
-	saved   map[string]string // destination path → copy inside dir
-	created []string          // paths that did not exist before; delete on rollback
+	saved   map[string]string   // destination path → copy inside dir
+	created []string            // paths that did not exist before; delete on rollback
+	large   map[string][]string // saved directory → files in it too large to copy
 }
 
 // New creates an empty Snapshot backed by a temporary directory.
@@ -25,13 +27,20 @@ func New() (*Snapshot, error) {
 	if err != nil {
 		return nil, fmt.Errorf("create snapshot dir: %w", err)
 	}
-	return &Snapshot{dir: dir, saved: make(map[string]string)}, nil
+	return &Snapshot{dir: dir, saved: make(map[string]string), large: make(map[string][]string)}, nil
 }
 
 // Record saves the current state of path so it can be restored later.
 // If path does not exist, it is added to the created list (deleted on rollback).
 // Calling Record twice for the same path is a no-op after the first call.
 func (s *Snapshot) Record(path string) error {
+	return s.RecordLimit(path, 0)
+}
+
+// RecordLimit is Record for a directory whose files larger than maxFileSize
+// bytes are not copied. A rollback leaves those files as they are. Zero
+// means no limit; a single file is always saved.
+func (s *Snapshot) RecordLimit(path string, maxFileSize int64) error {
 	if _, alreadyRecorded := s.saved[path]; alreadyRecorded {
 		return nil
 	}
@@ -43,19 +52,32 @@ func (s *Snapshot) Record(path string) error {
 
 	info, err := os.Stat(path)
 	if os.IsNotExist(err) {
-		s.created = append(s.created, path)
-		return nil
+		// A dangling symlink is saved as the link itself.
+		if _, lerr := os.Lstat(path); lerr != nil {
+			s.created = append(s.created, path)
+			return nil
+		}
+		info, err = os.Lstat(path)
 	}
 	if err != nil {
 		return fmt.Errorf("snapshot %s: %w", path, err)
 	}
 
 	tmpPath := filepath.Join(s.dir, strconv.Itoa(len(s.saved)))
-	if info.IsDir() {
-		if err := copyDir(path, tmpPath); err != nil {
+	switch {
+	case info.Mode()&fs.ModeSymlink != 0:
+		if err := copyLink(path, tmpPath); err != nil {
 			return fmt.Errorf("snapshot %s: %w", path, err)
 		}
-	} else {
+	case info.IsDir():
+		large, err := copyDir(resolve(path), tmpPath, maxFileSize)
+		if err != nil {
+			return fmt.Errorf("snapshot %s: %w", path, err)
+		}
+		if len(large) > 0 {
+			s.large[path] = large
+		}
+	default:
 		if err := copyFile(path, tmpPath); err != nil {
 			return fmt.Errorf("snapshot %s: %w", path, err)
 		}
@@ -69,17 +91,19 @@ func (s *Snapshot) Record(path string) error {
 func (s *Snapshot) Restore() error {
 	var first error
 	for dest, tmp := range s.saved {
-		info, err := os.Stat(tmp)
+		info, err := os.Lstat(tmp)
 		if err != nil {
 			if first == nil {
 				first = fmt.Errorf("restore %s: %w", dest, err)
 			}
 			continue
 		}
-		if info.IsDir() {
-			os.RemoveAll(dest)
-			err = copyDir(tmp, dest)
-		} else {
+		switch {
+		case info.Mode()&fs.ModeSymlink != 0:
+			err = copyLink(tmp, dest)
+		case info.IsDir():
+			err = restoreDir(tmp, resolve(dest), s.large[dest])
+		default:
 			err = copyFile(tmp, dest)
 		}
 		if err != nil && first == nil {
@@ -97,9 +121,65 @@ func (s *Snapshot) Discard() error {
 	return os.RemoveAll(s.dir)
 }
 
-func copyDir(src, dst string) error {
+// resolve returns path with symlinks evaluated, so a symlink to a directory
+// is walked as the directory, or path itself when it cannot be resolved.
+func resolve(path string) string {
+	if real, err := filepath.EvalSymlinks(path); err == nil {
+		return real
+	}
+	return path
+}
+
+// restoreDir makes dest the saved tree tmp again: entries that tmp lacks, or
+// whose type differs from the saved one, are removed, except the files in
+// large, which were too big to save and are left in place, and tmp is
+// copied over the rest.
+func restoreDir(tmp, dest string, large []string) error {
+	holdsLarge := func(path string) bool {
+		for _, f := range large {
+			if f == path || strings.HasPrefix(f, path+string(filepath.Separator)) {
+				return true
+			}
+		}
+		return false
+	}
+	var added []string
+	filepath.WalkDir(dest, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || path == dest {
+			return nil
+		}
+		rel, err := filepath.Rel(dest, path)
+		if err != nil {
+			return nil
+		}
+		if saved, err := os.Lstat(filepath.Join(tmp, rel)); err == nil && saved.Mode().Type() == d.Type() {
+			return nil
+		}
+		if holdsLarge(path) {
+			return nil
+		}
+		added = append(added, path)
+		if d.IsDir() {
+			return filepath.SkipDir
+		}
+		return nil
+	})
+	for _, path := range added {
+		if err := os.RemoveAll(path); err != nil {
+			return err
+		}
+	}
+	_, err := copyDir(tmp, dest, 0)
+	return err
+}
+
+// copyDir copies the tree src to dst, skipping files larger than
+// maxFileSize bytes unless it is zero. Symlinks are copied as links, never
+// followed. It returns the skipped files.
+func copyDir(src, dst string, maxFileSize int64) ([]string, error) {
 	src = filepath.Clean(src)
-	return filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
+	var large []string
+	err := filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
 		if err != nil {
 			return err
 		}
@@ -111,8 +191,30 @@ func copyDir(src, dst string) error {
 		if d.IsDir() {
 			return os.MkdirAll(target, 0o755)
 		}
+		if d.Type()&fs.ModeSymlink != 0 {
+			return copyLink(path, target)
+		}
+		if maxFileSize > 0 {
+			if info, err := d.Info(); err == nil && info.Mode().IsRegular() && info.Size() > maxFileSize {
+				large = append(large, path)
+				return nil
+			}
+		}
 		return copyFile(path, target)
 	})
+	return large, err
+}
+
+// copyLink recreates the symlink src at dst, replacing whatever dst is.
+func copyLink(src, dst string) error {
+	link, err := os.Readlink(src)
+	if err != nil {
+		return err
+	}
+	if err := os.RemoveAll(dst); err != nil {
+		return err
+	}
+	return os.Symlink(link, dst)
 }
 
 func copyFile(src, dst string) error {
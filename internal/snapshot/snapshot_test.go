@@ -156,3 +156,95 @@ func TestRecordDirectory(t *testing.T) {
 		t.Errorf("restored file = %q", string(data))
 	}
 }
+
+func TestRecordDirectoryWithSymlinks(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "mydir")
+	os.MkdirAll(filepath.Join(dir, "real"), 0o755)
+	os.WriteFile(filepath.Join(dir, "real", "a.txt"), []byte("aaa"), 0o644)
+	if err := os.Symlink("real", filepath.Join(dir, "alias")); err != nil {
+		t.Skip("symlinks unsupported:", err)
+	}
+	os.Symlink("missing", filepath.Join(dir, "dangling"))
+
+	snap, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer snap.Discard()
+	if err := snap.Record(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	// Replace the directory link with a real directory and drop the other.
+	os.Remove(filepath.Join(dir, "alias"))
+	os.MkdirAll(filepath.Join(dir, "alias"), 0o755)
+	os.Remove(filepath.Join(dir, "dangling"))
+	if err := snap.Restore(); err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[string]string{"alias": "real", "dangling": "missing"} {
+		if link, err := os.Readlink(filepath.Join(dir, name)); err != nil || link != want {
+			t.Errorf("%s = %q, %v; want a link to %s", name, link, err, want)
+		}
+	}
+	if data, _ := os.ReadFile(filepath.Join(dir, "real", "a.txt")); string(data) != "aaa" {
+		t.Errorf("real/a.txt = %q", data)
+	}
+}
+
+func TestRecordDanglingSymlink(t *testing.T) {
+	link := filepath.Join(t.TempDir(), "link")
+	if err := os.Symlink("missing", link); err != nil {
+		t.Skip("symlinks unsupported:", err)
+	}
+	snap, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer snap.Discard()
+	if err := snap.Record(link); err != nil {
+		t.Fatal(err)
+	}
+	os.Remove(link)
+	os.WriteFile(link, []byte("file"), 0o644)
+	if err := snap.Restore(); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := os.Readlink(link); err != nil || got != "missing" {
+		t.Errorf("link = %q, %v; want the dangling link back", got, err)
+	}
+}
+
+func TestRecordLimitKeepsLargeFiles(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "profile")
+	os.MkdirAll(filepath.Join(dir, "cache"), 0o755)
+	os.WriteFile(filepath.Join(dir, "prefs.js"), []byte("old"), 0o644)
+	os.WriteFile(filepath.Join(dir, "cache", "big.db"), make([]byte, 2048), 0o644)
+
+	snap, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer snap.Discard()
+	if err := snap.RecordLimit(dir, 1024); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(snap.saved[dir], "cache", "big.db")); err == nil {
+		t.Error("file over the limit was copied into the snapshot")
+	}
+
+	os.WriteFile(filepath.Join(dir, "prefs.js"), []byte("new"), 0o644)
+	os.WriteFile(filepath.Join(dir, "added.txt"), []byte("x"), 0o644)
+	if err := snap.Restore(); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(filepath.Join(dir, "prefs.js")); string(data) != "old" {
+		t.Errorf("prefs.js = %q, want old", data)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "added.txt")); err == nil {
+		t.Error("file added after the snapshot was not removed")
+	}
+	if info, err := os.Stat(filepath.Join(dir, "cache", "big.db")); err != nil || info.Size() != 2048 {
+		t.Errorf("large file was not left in place: %v", err)
+	}
+}
@@ -0,0 +1,169 @@
+package state
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// racyWindow is how recently a file may have been modified and still be
+// cached. A file written within the same timestamp tick as a later edit of
+// the same size would otherwise keep a stale hash.
+const racyWindow = 2 * time.Second
+
+// HashCache remembers content hashes keyed by path, size, and modification
+// time, so repeated drift checks over large trees only re-read files that
+// changed. A nil *HashCache hashes every file.
+type HashCache struct {
+	path    string
+	entries map[string]hashEntry
+	dirty   bool
+}
+
+type hashEntry struct {
+	Size    int64  `json:"size"`
+	ModTime int64  `json:"mtime"` // UnixNano
+	Hash    string `json:"hash"`
+}
+
+// DefaultHashCachePath returns the per-machine hash cache path, next to the
+// state file.
+func DefaultHashCachePath() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("resolve home dir: %w", err)
+	}
+	return filepath.Join(home, ".local", "share", "dotular", "hashes.json"), nil
+}
+
+// LoadHashCache reads the cache at path. A missing or unreadable cache
+// starts empty: it only saves work and is rebuilt as files are hashed.
+func LoadHashCache(path string) *HashCache {
+	c := &HashCache{path: path, entries: make(map[string]hashEntry)}
+	if data, err := os.ReadFile(path); err == nil {
+		if json.Unmarshal(data, &c.entries) != nil || c.entries == nil {
+			c.entries = make(map[string]hashEntry)
+		}
+	}
+	return c
+}
+
+// HashFile returns the hex sha256 of the file at path, reusing the cached
+// hash when the file's size and modification time are unchanged.
+func (c *HashCache) HashFile(path string) (string, error) {
+	if c == nil {
+		return HashFile(path)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+	key := path
+	if abs, err := filepath.Abs(path); err == nil {
+		key = abs
+	}
+	if e, ok := c.entries[key]; ok && e.Size == info.Size() && e.ModTime == info.ModTime().UnixNano() {
+		return e.Hash, nil
+	}
+	h, err := HashFile(path)
+	if err != nil {
+		return "", err
+	}
+	if time.Since(info.ModTime()) > racyWindow {
+		c.entries[key] = hashEntry{Size: info.Size(), ModTime: info.ModTime().UnixNano(), Hash: h}
+		c.dirty = true
+	}
+	return h, nil
+}
+
+// HashTree returns a hex sha256 over the relative paths and contents of
+// every file under dir. Symlinks are followed as a copy would follow them;
+// empty directories do not contribute.
+func (c *HashCache) HashTree(dir string) (string, error) {
+	return c.HashTreeLimit(dir, 0)
+}
+
+// HashTreeLimit is HashTree leaving out files larger than maxFileSize
+// bytes, which directory copies skip; zero means no limit.
+func (c *HashCache) HashTreeLimit(dir string, maxFileSize int64) (string, error) {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return "", err
+	}
+	if !info.IsDir() {
+		return "", fmt.Errorf("%s is not a directory", dir)
+	}
+	h := sha256.New()
+	err = filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		if maxFileSize > 0 {
+			if info, err := os.Stat(path); err == nil && info.Size() > maxFileSize {
+				return nil
+			}
+		}
+		sum, err := c.HashFile(path)
+		if err != nil {
+			// A symlink to a directory, or one that dangles: record where
+			// it points instead.
+			dest, linkErr := os.Readlink(path)
+			if linkErr != nil {
+				return err
+			}
+			fmt.Fprintf(h, "l %s %s\n", filepath.ToSlash(rel), dest)
+			return nil
+		}
+		fmt.Fprintf(h, "f %s %s\n", filepath.ToSlash(rel), sum)
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%x", h.Sum(nil)), nil
+}
+
+// HashTree is HashCache.HashTree without a cache.
+func HashTree(dir string) (string, error) {
+	return (*HashCache)(nil).HashTree(dir)
+}
+
+// Save writes the cache if any entry changed, dropping entries for files
+// that no longer exist.
+func (c *HashCache) Save() error {
+	if c == nil || !c.dirty || c.path == "" {
+		return nil
+	}
+	for path := range c.entries {
+		if _, err := os.Stat(path); err != nil {
+			delete(c.entries, path)
+		}
+	}
+	if err := os.MkdirAll(filepath.Dir(c.path), 0o755); err != nil {
+		return err
+	}
+	data, err := json.Marshal(c.entries)
+	if err != nil {
+		return err
+	}
+	tmp := c.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, c.path); err != nil {
+		return err
+	}
+	c.dirty = false
+	return nil
+}
@@ -0,0 +1,131 @@
+package state
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeOld writes content to path with a modification time outside the
+// racy window, so the cache will keep its hash.
+func writeOld(t *testing.T, path, content string, mtime time.Time) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(path, mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestHashCacheReusesUnchangedFiles(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "f")
+	old := time.Now().Add(-time.Hour)
+	writeOld(t, path, "aaaa", old)
+
+	c := LoadHashCache(filepath.Join(dir, "hashes.json"))
+	first, err := c.HashFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Same size and mtime: the cached hash is returned without reading.
+	writeOld(t, path, "bbbb", old)
+	if got, _ := c.HashFile(path); got != first {
+		t.Errorf("HashFile re-read a file whose size and mtime are unchanged")
+	}
+	// A new mtime invalidates the entry.
+	writeOld(t, path, "bbbb", old.Add(time.Minute))
+	if got, _ := c.HashFile(path); got == first {
+		t.Errorf("HashFile returned a stale hash after the file changed")
+	}
+}
+
+func TestHashCacheSkipsRecentFiles(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "f")
+	os.WriteFile(path, []byte("fresh"), 0o644)
+
+	c := LoadHashCache(filepath.Join(dir, "hashes.json"))
+	if _, err := c.HashFile(path); err != nil {
+		t.Fatal(err)
+	}
+	if len(c.entries) != 0 {
+		t.Errorf("a file modified within the racy window was cached: %v", c.entries)
+	}
+}
+
+func TestHashCacheSaveLoad(t *testing.T) {
+	dir := t.TempDir()
+	kept := filepath.Join(dir, "kept")
+	gone := filepath.Join(dir, "gone")
+	old := time.Now().Add(-time.Hour)
+	writeOld(t, kept, "k", old)
+	writeOld(t, gone, "g", old)
+
+	cachePath := filepath.Join(dir, "nested", "hashes.json")
+	c := LoadHashCache(cachePath)
+	want, _ := c.HashFile(kept)
+	c.HashFile(gone)
+	os.Remove(gone)
+	if err := c.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded := LoadHashCache(cachePath)
+	abs, _ := filepath.Abs(kept)
+	if e, ok := loaded.entries[abs]; !ok || e.Hash != want {
+		t.Errorf("entry for kept file = %+v, %v", e, ok)
+	}
+	if len(loaded.entries) != 1 {
+		t.Errorf("entries = %v, want the deleted file dropped", loaded.entries)
+	}
+}
+
+func TestHashTree(t *testing.T) {
+	a, b := t.TempDir(), t.TempDir()
+	for _, dir := range []string{a, b} {
+		os.MkdirAll(filepath.Join(dir, "lua", "plugins"), 0o755)
+		os.WriteFile(filepath.Join(dir, "init.lua"), []byte("require('x')"), 0o644)
+		os.WriteFile(filepath.Join(dir, "lua", "plugins", "x.lua"), []byte("return {}"), 0o644)
+	}
+	ha, err := HashTree(a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hb, _ := HashTree(b); hb != ha {
+		t.Error("identical trees hash differently")
+	}
+
+	os.WriteFile(filepath.Join(b, "lua", "plugins", "x.lua"), []byte("return { 1 }"), 0o644)
+	if hb, _ := HashTree(b); hb == ha {
+		t.Error("changed file content did not change the tree hash")
+	}
+
+	os.WriteFile(filepath.Join(b, "lua", "plugins", "x.lua"), []byte("return {}"), 0o644)
+	os.Rename(filepath.Join(b, "init.lua"), filepath.Join(b, "other.lua"))
+	if hb, _ := HashTree(b); hb == ha {
+		t.Error("renamed file did not change the tree hash")
+	}
+
+	if _, err := HashTree(filepath.Join(a, "missing")); err == nil {
+		t.Error("expected an error for a missing directory")
+	}
+}
+
+func TestHashTreeLimit(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "prefs.js"), []byte("x"), 0o644)
+	small, err := HashTree(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.WriteFile(filepath.Join(dir, "big.db"), make([]byte, 2048), 0o644)
+	if h, _ := (*HashCache)(nil).HashTreeLimit(dir, 1024); h != small {
+		t.Error("a file over the limit changed the tree hash")
+	}
+	if h, _ := HashTree(dir); h == small {
+		t.Error("without a limit the large file should count")
+	}
+}
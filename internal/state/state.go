@@ -0,0 +1,295 @@
+// Package state records the resources dotular has deployed on this machine —
+// destination files, directories, symlinks, packages, and binaries — so that
+// resources which are no longer declared in the config can be found later.
+//
+// Resources and module records are tagged with the absolute path of the
+// config that deployed them, so clean and --changed-only only consider the
+// current config's entries. One state file serves every config on the
+// machine: Save replays the edits made through Record, Remove, and the
+// other methods onto the file's current contents under an OS lock, so the
+// maps must never be modified directly.
+package state
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// Resource kinds.
+const (
+	KindFile      = "file"
+	KindDirectory = "directory"
+	KindSymlink   = "symlink"
+	KindPackage   = "package"
+	KindBinary    = "binary"
+)
+
+// Resource is a single deployed artefact.
+type Resource struct {
+	Kind    string `json:"kind"`
+	Path    string `json:"path,omitempty"`    // destination on disk (file, directory, symlink, binary)
+	Package string `json:"package,omitempty"` // package name
+	Manager string `json:"manager,omitempty"` // package manager
+	Module  string `json:"module"`
+	Config  string `json:"config,omitempty"` // absolute path of the config that deployed it
+	Source  string `json:"source,omitempty"` // repo path or download URL
+	Hash    string `json:"hash,omitempty"`   // sha256 of deployed file content (HashTree for directories)
+	// SourceHash is the sha256 of the repo file (as stored, so ciphertext for
+	// encrypted items) or directory tree when it was deployed. Together with Hash it tells
+	// which side of a copied file changed since the last apply.
+	SourceHash string    `json:"source_hash,omitempty"`
+	AppliedAt  time.Time `json:"applied_at"`
+}
+
+// Key identifies the resource independently of which module deployed it.
+func (r Resource) Key() string {
+	if r.Kind == KindPackage {
+		return r.Kind + ":" + r.Manager + ":" + r.Package
+	}
+	return r.Kind + ":" + r.Path
+}
+
+// State is the set of resources deployed on this machine, keyed by
+// Resource.Key.
+type State struct {
+	Version   int                 `json:"version"`
+	Resources map[string]Resource `json:"resources"`
+	// PlainHashes maps the sha256 of an encrypted repo file to the sha256
+	// of its plaintext, so secrets can be compared with their deployed
+	// copies without decrypting them every time.
+	PlainHashes map[string]string `json:"plain_hashes,omitempty"`
+	// Modules records each module's last successful apply on this machine,
+	// by the absolute path of the config it was applied from and then by
+	// name; a module of the same name in another config is another module.
+	Modules map[string]map[string]ModuleRecord `json:"config_modules,omitempty"`
+
+	// changes are the edits made since the state was loaded, which Save
+	// replays onto the file's current contents.
+	changes []func(*State)
+}
+
+// ModuleRecord is a module's last successful apply.
+type ModuleRecord struct {
+	AppliedAt time.Time `json:"applied_at"`
+	// Hash covers the module's resolved config and store contents as they
+	// were applied, so an unchanged module can be skipped.
+	Hash string `json:"hash,omitempty"`
+}
+
+// legacyModules is the "modules" field of older state files, keyed by
+// module name alone with the config inside each record.
+type legacyModules struct {
+	Modules map[string]struct {
+		ModuleRecord
+		Config string `json:"config"`
+	} `json:"modules"`
+}
+
+const currentVersion = 1
+
+// New returns an empty State.
+func New() *State {
+	return &State{Version: currentVersion, Resources: make(map[string]Resource)}
+}
+
+// DefaultPath returns the per-machine state file path.
+func DefaultPath() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("resolve home dir: %w", err)
+	}
+	return filepath.Join(home, ".local", "share", "dotular", "state.json"), nil
+}
+
+// Load reads the state file at path. A missing file yields an empty State.
+func Load(path string) (*State, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return New(), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	st := New()
+	if err := json.Unmarshal(data, st); err != nil {
+		return nil, fmt.Errorf("parse state file %s: %w", path, err)
+	}
+	if st.Resources == nil {
+		st.Resources = make(map[string]Resource)
+	}
+	var legacy legacyModules
+	if json.Unmarshal(data, &legacy) == nil {
+		for name, rec := range legacy.Modules {
+			if _, ok := st.Module(rec.Config, name); !ok {
+				st.setModule(rec.Config, name, rec.ModuleRecord)
+			}
+		}
+	}
+	return st, nil
+}
+
+// Save writes the state to path, creating parent directories as needed.
+// The state file is shared by every config on this machine, so Save holds
+// an OS lock on path+".lock" while it re-reads the file and replays the
+// changes made through s onto it; entries another run saved in the
+// meantime are kept. Afterwards s holds the merged state.
+func (s *State) Save(path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	guard, err := os.OpenFile(path+".lock", os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return fmt.Errorf("open state lock: %w", err)
+	}
+	defer guard.Close()
+	if err := lockFile(guard); err != nil {
+		return fmt.Errorf("lock %s: %w", guard.Name(), err)
+	}
+	defer unlockFile(guard)
+
+	merged, err := Load(path)
+	if err != nil {
+		return err
+	}
+	for _, change := range s.changes {
+		change(merged)
+	}
+	data, err := json.MarshalIndent(merged, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0o644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return err
+	}
+	*s = *merged
+	return nil
+}
+
+// change applies fn to s and queues it for Save.
+func (s *State) change(fn func(*State)) {
+	fn(s)
+	s.changes = append(s.changes, fn)
+}
+
+// Record adds or replaces a resource, stamping AppliedAt when unset. A path
+// holds one resource at a time, so recording e.g. a symlink replaces a file
+// previously recorded at the same path.
+func (s *State) Record(r Resource) {
+	if r.AppliedAt.IsZero() {
+		r.AppliedAt = time.Now().UTC()
+	}
+	s.change(func(s *State) {
+		if r.Path != "" {
+			for key, existing := range s.Resources {
+				if existing.Path == r.Path && key != r.Key() {
+					delete(s.Resources, key)
+				}
+			}
+		}
+		s.Resources[r.Key()] = r
+	})
+}
+
+// PlainHash returns the recorded plaintext hash for the ciphertext hash.
+func (s *State) PlainHash(cipherHash string) (string, bool) {
+	h, ok := s.PlainHashes[cipherHash]
+	return h, ok
+}
+
+// RememberPlainHash records that the ciphertext hashing to cipherHash
+// decrypts to content hashing to plainHash.
+func (s *State) RememberPlainHash(cipherHash, plainHash string) {
+	s.change(func(s *State) {
+		if s.PlainHashes == nil {
+			s.PlainHashes = make(map[string]string)
+		}
+		s.PlainHashes[cipherHash] = plainHash
+	})
+}
+
+// ForgetPlainHash drops the plaintext hash recorded for cipherHash.
+func (s *State) ForgetPlainHash(cipherHash string) {
+	s.change(func(s *State) {
+		delete(s.PlainHashes, cipherHash)
+	})
+}
+
+// RecordModule notes that the named module of the config file at config
+// applied successfully now, with the given config and store hash.
+func (s *State) RecordModule(config, name, hash string) {
+	rec := ModuleRecord{AppliedAt: time.Now().UTC(), Hash: hash}
+	s.change(func(s *State) {
+		s.setModule(config, name, rec)
+	})
+}
+
+func (s *State) setModule(config, name string, rec ModuleRecord) {
+	if s.Modules == nil {
+		s.Modules = make(map[string]map[string]ModuleRecord)
+	}
+	if s.Modules[config] == nil {
+		s.Modules[config] = make(map[string]ModuleRecord)
+	}
+	s.Modules[config][name] = rec
+}
+
+// Module returns the last successful apply of the named module of the
+// config file at config.
+func (s *State) Module(config, name string) (ModuleRecord, bool) {
+	rec, ok := s.Modules[config][name]
+	return rec, ok
+}
+
+// Remove forgets the resource with the given key.
+func (s *State) Remove(key string) {
+	s.change(func(s *State) {
+		delete(s.Resources, key)
+	})
+}
+
+// Sorted returns all resources ordered by key.
+func (s *State) Sorted() []Resource {
+	out := make([]Resource, 0, len(s.Resources))
+	for _, r := range s.Resources {
+		out = append(out, r)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Key() < out[j].Key() })
+	return out
+}
+
+// Orphans returns the resources recorded for the config file at config
+// whose keys are not in declared, ordered by key. Resources deployed from
+// other configs on this machine are never orphans of this one.
+func (s *State) Orphans(config string, declared map[string]bool) []Resource {
+	var out []Resource
+	for _, r := range s.Sorted() {
+		if r.Config == config && !declared[r.Key()] {
+			out = append(out, r)
+		}
+	}
+	return out
+}
+
+// HashFile returns the hex sha256 of the file at path.
+func HashFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%x", h.Sum(nil)), nil
+}
@@ -0,0 +1,185 @@
+package state
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadMissing(t *testing.T) {
+	st, err := Load(filepath.Join(t.TempDir(), "state.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(st.Resources) != 0 {
+		t.Errorf("expected empty state, got %d resources", len(st.Resources))
+	}
+}
+
+func TestSaveLoadRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "nested", "state.json")
+	st := New()
+	st.Record(Resource{Kind: KindFile, Path: "/home/u/.vimrc", Module: "vim", Hash: "abc"})
+	st.Record(Resource{Kind: KindPackage, Package: "git", Manager: "brew", Module: "git"})
+	if err := st.Save(path); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got.Resources) != 2 {
+		t.Fatalf("got %d resources, want 2", len(got.Resources))
+	}
+	r, ok := got.Resources["file:/home/u/.vimrc"]
+	if !ok || r.Module != "vim" || r.Hash != "abc" || r.AppliedAt.IsZero() {
+		t.Errorf("file resource = %+v", r)
+	}
+	if _, ok := got.Resources["package:brew:git"]; !ok {
+		t.Error("package resource missing")
+	}
+}
+
+func TestPlainHashesRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	st := New()
+	if _, ok := st.PlainHash("cipher"); ok {
+		t.Error("empty state should know no plaintext hashes")
+	}
+	st.RememberPlainHash("cipher", "plain")
+	if err := st.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	got, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h, ok := got.PlainHash("cipher"); !ok || h != "plain" {
+		t.Errorf("PlainHash(cipher) = %q, %v", h, ok)
+	}
+}
+
+func TestLoadInvalid(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	os.WriteFile(path, []byte("{not json"), 0o644)
+	if _, err := Load(path); err == nil {
+		t.Error("expected error for invalid state file")
+	}
+}
+
+func TestOrphans(t *testing.T) {
+	st := New()
+	st.Record(Resource{Kind: KindSymlink, Path: "/b", Module: "m"})
+	st.Record(Resource{Kind: KindFile, Path: "/a", Module: "m"})
+	st.Record(Resource{Kind: KindBinary, Path: "/c", Module: "m"})
+	st.Record(Resource{Kind: KindFile, Path: "/d", Module: "m", Config: "/other/dotular.yaml"})
+
+	orphans := st.Orphans("", map[string]bool{"file:/a": true})
+	if len(orphans) != 2 || orphans[0].Key() != "binary:/c" || orphans[1].Key() != "symlink:/b" {
+		t.Errorf("orphans = %+v", orphans)
+	}
+
+	st.Remove("binary:/c")
+	if len(st.Resources) != 3 {
+		t.Error("Remove did not delete the resource")
+	}
+}
+
+func TestHashFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "f")
+	os.WriteFile(path, []byte("hello"), 0o644)
+	got, err := HashFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824" {
+		t.Errorf("HashFile = %s", got)
+	}
+}
+
+func TestRecordReplacesPath(t *testing.T) {
+	st := New()
+	st.Record(Resource{Kind: KindFile, Path: "/x", Module: "m"})
+	st.Record(Resource{Kind: KindSymlink, Path: "/x", Module: "m"})
+	if len(st.Resources) != 1 {
+		t.Fatalf("got %d resources, want 1", len(st.Resources))
+	}
+	if _, ok := st.Resources["symlink:/x"]; !ok {
+		t.Error("expected symlink to replace file at the same path")
+	}
+}
+
+func TestRecordModuleRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	st := New()
+	st.RecordModule("/repo/dotular.yaml", "shell", "abc")
+	if err := st.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	got, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec, ok := got.Module("/repo/dotular.yaml", "shell")
+	if !ok || rec.Hash != "abc" || rec.AppliedAt.IsZero() {
+		t.Errorf("Module(shell) = %+v, %v", rec, ok)
+	}
+	if _, ok := got.Module("/other/dotular.yaml", "shell"); ok {
+		t.Error("a module of another config must not match")
+	}
+}
+
+func TestLoadLegacyModules(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	legacy := `{"version": 1, "resources": {}, "modules": {"shell": {"applied_at": "2024-01-02T03:04:05Z", "config": "/repo/dotular.yaml", "hash": "abc"}}}`
+	if err := os.WriteFile(path, []byte(legacy), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	st, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rec, ok := st.Module("/repo/dotular.yaml", "shell"); !ok || rec.Hash != "abc" {
+		t.Errorf("Module(shell) = %+v, %v", rec, ok)
+	}
+}
+
+func TestSaveMergesConcurrentRuns(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	base := New()
+	base.Record(Resource{Kind: KindFile, Path: "/old", Module: "a", Config: "/a.yaml"})
+	if err := base.Save(path); err != nil {
+		t.Fatal(err)
+	}
+
+	// Two runs of different configs load the same file and save in turn.
+	a, _ := Load(path)
+	b, _ := Load(path)
+	a.Remove("file:/old")
+	a.RecordModule("/a.yaml", "a", "h1")
+	b.Record(Resource{Kind: KindFile, Path: "/b", Module: "b", Config: "/b.yaml"})
+	if err := a.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Save(path); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := got.Resources["file:/old"]; ok {
+		t.Error("the first run's removal was undone by the second save")
+	}
+	if _, ok := got.Resources["file:/b"]; !ok {
+		t.Error("the second run's resource is missing")
+	}
+	if _, ok := got.Module("/a.yaml", "a"); !ok {
+		t.Error("the first run's module record was overwritten by the second save")
+	}
+	if _, ok := b.Module("/a.yaml", "a"); !ok {
+		t.Error("Save should leave the merged state in the receiver")
+	}
+}
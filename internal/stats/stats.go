@@ -0,0 +1,199 @@
+// Package stats summarizes the local audit log and state file for
+// `dotular stats`: what each module manages, when each machine last applied,
+// and which items fail most often or take longest. Nothing leaves the
+// machine.
+package stats
+
+import (
+	"sort"
+	"time"
+
+	"github.com/atomikpanda/dotular/internal/audit"
+	"github.com/atomikpanda/dotular/internal/state"
+)
+
+// applyCommands are the audit commands that change the machine.
+var applyCommands = map[string]bool{"apply": true, "push": true, "pull": true, "sync": true}
+
+// Report is the summary built by Build.
+type Report struct {
+	Modules  []ModuleCount `json:"modules"`
+	Machines []MachineRun  `json:"machines"`
+	Failing  []ItemFailure `json:"failing"`
+	Slowest  []ItemTiming  `json:"slowest"`
+}
+
+// ModuleCount is the number of resources a module has deployed on this
+// machine, by kind.
+type ModuleCount struct {
+	Module      string `json:"module"`
+	Files       int    `json:"files"`
+	Directories int    `json:"directories"`
+	Symlinks    int    `json:"symlinks"`
+	Packages    int    `json:"packages"`
+	Binaries    int    `json:"binaries"`
+}
+
+// Total returns the number of resources of every kind.
+func (c ModuleCount) Total() int {
+	return c.Files + c.Directories + c.Symlinks + c.Packages + c.Binaries
+}
+
+// MachineRun is the last apply, push, pull, or sync recorded for a host.
+type MachineRun struct {
+	Host    string    `json:"host"`
+	Command string    `json:"command"`
+	Time    time.Time `json:"time"`
+}
+
+// ItemFailure counts how often an item failed out of the times it ran.
+type ItemFailure struct {
+	Module   string `json:"module"`
+	Item     string `json:"item"`
+	Runs     int    `json:"runs"`
+	Failures int    `json:"failures"`
+}
+
+// Rate returns the fraction of runs that failed.
+func (f ItemFailure) Rate() float64 {
+	if f.Runs == 0 {
+		return 0
+	}
+	return float64(f.Failures) / float64(f.Runs)
+}
+
+// ItemTiming is the mean and longest run time of an item.
+type ItemTiming struct {
+	Module string        `json:"module"`
+	Item   string        `json:"item"`
+	Runs   int           `json:"runs"`
+	Mean   time.Duration `json:"mean_ns"`
+	Max    time.Duration `json:"max_ns"`
+}
+
+// Build summarizes entries and st, which may be nil. Failing and Slowest
+// are limited to the top entries when top is positive.
+func Build(entries []audit.Entry, st *state.State, top int) Report {
+	rep := Report{
+		Modules:  moduleCounts(st),
+		Machines: machineRuns(entries),
+	}
+	rep.Failing, rep.Slowest = itemStats(entries)
+	if top > 0 {
+		rep.Failing = rep.Failing[:min(top, len(rep.Failing))]
+		rep.Slowest = rep.Slowest[:min(top, len(rep.Slowest))]
+	}
+	return rep
+}
+
+// moduleCounts counts st's resources per module, largest module first.
+func moduleCounts(st *state.State) []ModuleCount {
+	if st == nil {
+		return nil
+	}
+	byModule := make(map[string]*ModuleCount)
+	for _, res := range st.Resources {
+		c := byModule[res.Module]
+		if c == nil {
+			c = &ModuleCount{Module: res.Module}
+			byModule[res.Module] = c
+		}
+		switch res.Kind {
+		case state.KindFile:
+			c.Files++
+		case state.KindDirectory:
+			c.Directories++
+		case state.KindSymlink:
+			c.Symlinks++
+		case state.KindPackage:
+			c.Packages++
+		case state.KindBinary:
+			c.Binaries++
+		}
+	}
+	out := make([]ModuleCount, 0, len(byModule))
+	for _, c := range byModule {
+		out = append(out, *c)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Total() != out[j].Total() {
+			return out[i].Total() > out[j].Total()
+		}
+		return out[i].Module < out[j].Module
+	})
+	return out
+}
+
+// machineRuns returns the latest applying entry per host, most recent
+// first. Entries written before hosts were recorded have an empty Host.
+func machineRuns(entries []audit.Entry) []MachineRun {
+	last := make(map[string]MachineRun)
+	for _, e := range entries {
+		if !applyCommands[e.Command] {
+			continue
+		}
+		if prev, ok := last[e.Host]; !ok || e.Time.After(prev.Time) {
+			last[e.Host] = MachineRun{Host: e.Host, Command: e.Command, Time: e.Time}
+		}
+	}
+	out := make([]MachineRun, 0, len(last))
+	for _, run := range last {
+		out = append(out, run)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Time.After(out[j].Time) })
+	return out
+}
+
+// itemStats aggregates the items that ran under an applying command. Failing
+// lists items that failed at least once, highest failure rate first; Slowest
+// lists items with recorded durations, longest mean first.
+func itemStats(entries []audit.Entry) (failing []ItemFailure, slowest []ItemTiming) {
+	type key struct{ module, item string }
+	type agg struct {
+		runs, failures int
+		timed          int
+		total, max     time.Duration
+	}
+	items := make(map[key]*agg)
+	var order []key
+	for _, e := range entries {
+		if !applyCommands[e.Command] || (e.Outcome != "success" && e.Outcome != "unchanged" && e.Outcome != "failure") {
+			continue
+		}
+		k := key{e.Module, e.Item}
+		a := items[k]
+		if a == nil {
+			a = &agg{}
+			items[k] = a
+			order = append(order, k)
+		}
+		a.runs++
+		if e.Outcome == "failure" {
+			a.failures++
+		}
+		if e.DurationMS > 0 {
+			d := time.Duration(e.DurationMS) * time.Millisecond
+			a.timed++
+			a.total += d
+			a.max = max(a.max, d)
+		}
+	}
+
+	for _, k := range order {
+		a := items[k]
+		if a.failures > 0 {
+			failing = append(failing, ItemFailure{Module: k.module, Item: k.item, Runs: a.runs, Failures: a.failures})
+		}
+		if a.timed > 0 {
+			slowest = append(slowest, ItemTiming{Module: k.module, Item: k.item, Runs: a.timed, Mean: a.total / time.Duration(a.timed), Max: a.max})
+		}
+	}
+	sort.SliceStable(failing, func(i, j int) bool {
+		if failing[i].Rate() != failing[j].Rate() {
+			return failing[i].Rate() > failing[j].Rate()
+		}
+		return failing[i].Failures > failing[j].Failures
+	})
+	sort.SliceStable(slowest, func(i, j int) bool { return slowest[i].Mean > slowest[j].Mean })
+	return failing, slowest
+}
@@ -0,0 +1,84 @@
+package stats
+
+import (
+	"testing"
+	"time"
+
+	"github.com/atomikpanda/dotular/internal/audit"
+	"github.com/atomikpanda/dotular/internal/state"
+)
+
+func TestModuleCounts(t *testing.T) {
+	st := state.New()
+	st.Record(state.Resource{Kind: state.KindFile, Path: "/a", Module: "shell"})
+	st.Record(state.Resource{Kind: state.KindSymlink, Path: "/b", Module: "shell"})
+	st.Record(state.Resource{Kind: state.KindPackage, Package: "git", Manager: "brew", Module: "git"})
+
+	rep := Build(nil, st, 0)
+	want := []ModuleCount{
+		{Module: "shell", Files: 1, Symlinks: 1},
+		{Module: "git", Packages: 1},
+	}
+	if len(rep.Modules) != len(want) {
+		t.Fatalf("Modules = %+v, want %+v", rep.Modules, want)
+	}
+	for i := range want {
+		if rep.Modules[i] != want[i] {
+			t.Errorf("Modules[%d] = %+v, want %+v", i, rep.Modules[i], want[i])
+		}
+	}
+}
+
+func TestMachineRuns(t *testing.T) {
+	t0 := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	entries := []audit.Entry{
+		{Time: t0, Host: "laptop", Command: "apply", Outcome: "success"},
+		{Time: t0.Add(time.Hour), Host: "laptop", Command: "sync", Outcome: "success"},
+		{Time: t0.Add(2 * time.Hour), Host: "laptop", Command: "verify", Outcome: "success"},
+		{Time: t0.Add(30 * time.Minute), Host: "desktop", Command: "apply", Outcome: "failure"},
+	}
+	got := Build(entries, nil, 0).Machines
+	want := []MachineRun{
+		{Host: "laptop", Command: "sync", Time: t0.Add(time.Hour)},
+		{Host: "desktop", Command: "apply", Time: t0.Add(30 * time.Minute)},
+	}
+	if len(got) != len(want) || got[0] != want[0] || got[1] != want[1] {
+		t.Errorf("Machines = %+v, want %+v", got, want)
+	}
+}
+
+func TestItemStats(t *testing.T) {
+	entry := func(item, outcome string, ms int64) audit.Entry {
+		return audit.Entry{Command: "apply", Module: "m", Item: item, Outcome: outcome, DurationMS: ms}
+	}
+	entries := []audit.Entry{
+		entry("flaky", "success", 100),
+		entry("flaky", "failure", 300),
+		entry("flaky", "unchanged", 200),
+		entry("flaky", "failure", 0),
+		entry("broken", "failure", 10),
+		entry("slow", "success", 5000),
+		entry("slow", "skipped", 0),
+		{Command: "verify", Module: "m", Item: "slow", Outcome: "failure"},
+	}
+	rep := Build(entries, nil, 0)
+
+	if len(rep.Failing) != 2 || rep.Failing[0].Item != "broken" || rep.Failing[1].Item != "flaky" {
+		t.Fatalf("Failing = %+v, want broken then flaky", rep.Failing)
+	}
+	if f := rep.Failing[1]; f.Runs != 4 || f.Failures != 2 || f.Rate() != 0.5 {
+		t.Errorf("flaky = %+v (rate %v)", f, f.Rate())
+	}
+
+	if len(rep.Slowest) != 3 || rep.Slowest[0].Item != "slow" || rep.Slowest[1].Item != "flaky" {
+		t.Fatalf("Slowest = %+v, want slow, flaky, broken", rep.Slowest)
+	}
+	if s := rep.Slowest[1]; s.Mean != 200*time.Millisecond || s.Max != 300*time.Millisecond {
+		t.Errorf("flaky timing = %+v", s)
+	}
+
+	top := Build(entries, nil, 1)
+	if len(top.Failing) != 1 || len(top.Slowest) != 1 {
+		t.Errorf("top 1 = %+v", top)
+	}
+}
@@ -5,7 +5,9 @@ package template
 import (
 	"bytes"
 	"fmt"
+	"slices"
 	"text/template"
+	"text/template/parse"
 
 	"gopkg.in/yaml.v3"
 
@@ -13,8 +15,13 @@ import (
 )
 
 // Render executes the Go template string s with params as the data object.
+// A field missing from params renders as "<no value>".
 func Render(s string, params map[string]any) (string, error) {
-	t, err := template.New("").Option("missingkey=zero").Parse(s)
+	return render(s, params, "missingkey=zero")
+}
+
+func render(s string, params map[string]any, missingKey string) (string, error) {
+	t, err := template.New("").Option(missingKey).Parse(s)
 	if err != nil {
 		return "", fmt.Errorf("parse template %q: %w", s, err)
 	}
@@ -29,17 +36,26 @@ func Render(s string, params map[string]any) (string, error) {
 // expressions. It works by marshalling the item to YAML, rendering the
 // resulting string as a template, then unmarshalling back. This approach
 // automatically covers every string field without explicit enumeration.
+//
+// The When field is left untouched: it may hold its own template (e.g.
+// {{ hasTag "work" }}) that is evaluated later against machine facts.
 func RenderItem(item config.Item, params map[string]any) (config.Item, error) {
 	if len(params) == 0 {
 		return item, nil
 	}
+	return renderItem(item, params, "missingkey=zero")
+}
+
+func renderItem(item config.Item, params map[string]any, missingKey string) (config.Item, error) {
+	src := item
+	src.When = ""
 
-	data, err := yaml.Marshal(item)
+	data, err := yaml.Marshal(src)
 	if err != nil {
 		return item, fmt.Errorf("marshal item for template rendering: %w", err)
 	}
 
-	rendered, err := Render(string(data), params)
+	rendered, err := render(string(data), params, missingKey)
 	if err != nil {
 		return item, fmt.Errorf("render item: %w", err)
 	}
@@ -48,5 +64,109 @@ func RenderItem(item config.Item, params map[string]any) (config.Item, error) {
 	if err := yaml.Unmarshal([]byte(rendered), &result); err != nil {
 		return item, fmt.Errorf("unmarshal rendered item: %w", err)
 	}
+	result.When = item.When
 	return result, nil
 }
+
+// MissingParamError reports a template reference to a param that is not
+// set.
+type MissingParamError struct {
+	Param string
+}
+
+func (e *MissingParamError) Error() string {
+	return fmt.Sprintf("param %q is not set", e.Param)
+}
+
+// RenderItemStrict is RenderItem for registry modules: a reference to a
+// param that params does not contain is a *MissingParamError rather than
+// "<no value>" in the rendered item.
+func RenderItemStrict(item config.Item, params map[string]any) (config.Item, error) {
+	names, err := Fields(item)
+	if err != nil {
+		return item, fmt.Errorf("render item: %w", err)
+	}
+	for _, name := range names {
+		if _, ok := params[name]; !ok {
+			return item, &MissingParamError{Param: name}
+		}
+	}
+	if len(names) == 0 {
+		return item, nil
+	}
+	return renderItem(item, params, "missingkey=error")
+}
+
+// Fields returns the top-level params the templates in item's string fields
+// refer to, such as "version" for {{ .version }} or {{ .version.major }},
+// sorted. Like RenderItem it leaves When out.
+func Fields(item config.Item) ([]string, error) {
+	src := item
+	src.When = ""
+	data, err := yaml.Marshal(src)
+	if err != nil {
+		return nil, fmt.Errorf("marshal item for template rendering: %w", err)
+	}
+	t, err := template.New("").Parse(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("parse template: %w", err)
+	}
+	var names []string
+	add := func(ident []string) {
+		if len(ident) > 0 && !slices.Contains(names, ident[0]) {
+			names = append(names, ident[0])
+		}
+	}
+	var walk func(n parse.Node)
+	walk = func(n parse.Node) {
+		switch n := n.(type) {
+		case *parse.ListNode:
+			if n == nil {
+				return
+			}
+			for _, c := range n.Nodes {
+				walk(c)
+			}
+		case *parse.ActionNode:
+			walk(n.Pipe)
+		case *parse.PipeNode:
+			if n == nil {
+				return
+			}
+			for _, c := range n.Cmds {
+				walk(c)
+			}
+		case *parse.CommandNode:
+			for _, arg := range n.Args {
+				walk(arg)
+			}
+		case *parse.ChainNode:
+			walk(n.Node)
+		case *parse.FieldNode:
+			add(n.Ident)
+		case *parse.VariableNode:
+			if len(n.Ident) > 1 && n.Ident[0] == "$" {
+				add(n.Ident[1:])
+			}
+		case *parse.IfNode:
+			walk(n.Pipe)
+			walk(n.List)
+			walk(n.ElseList)
+		case *parse.RangeNode:
+			walk(n.Pipe)
+			walk(n.List)
+			walk(n.ElseList)
+		case *parse.WithNode:
+			walk(n.Pipe)
+			walk(n.List)
+			walk(n.ElseList)
+		case *parse.TemplateNode:
+			walk(n.Pipe)
+		}
+	}
+	if t.Tree != nil {
+		walk(t.Tree.Root)
+	}
+	slices.Sort(names)
+	return names, nil
+}
@@ -1,6 +1,8 @@
 package template
 
 import (
+	"errors"
+	"slices"
 	"testing"
 
 	"github.com/atomikpanda/dotular/internal/config"
@@ -163,3 +165,61 @@ func TestRenderItemScriptFields(t *testing.T) {
 		t.Errorf("Script = %q", result.Script)
 	}
 }
+
+func TestRenderItemPreservesWhen(t *testing.T) {
+	item := config.Item{
+		Package: "{{ .pkg }}",
+		When:    `{{ hasTag "work" }}`,
+	}
+	result, err := RenderItem(item, map[string]any{"pkg": "slack"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Package != "slack" {
+		t.Errorf("Package = %q", result.Package)
+	}
+	if result.When != item.When {
+		t.Errorf("When = %q, want %q", result.When, item.When)
+	}
+}
+
+func TestRenderItemStrict(t *testing.T) {
+	item := config.Item{Run: "install {{ .flags }}--prefix {{ .prefix }}"}
+	result, err := RenderItemStrict(item, map[string]any{"prefix": "/opt", "flags": ""})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Run != "install --prefix /opt" {
+		t.Errorf("Run = %q", result.Run)
+	}
+
+	_, err = RenderItemStrict(item, map[string]any{"prefix": "/opt"})
+	var missing *MissingParamError
+	if !errors.As(err, &missing) || missing.Param != "flags" {
+		t.Fatalf("err = %v, want a MissingParamError for flags", err)
+	}
+	if _, err := RenderItemStrict(item, nil); err == nil {
+		t.Error("expected an error with no params")
+	}
+}
+
+func TestFields(t *testing.T) {
+	item := config.Item{
+		Binary:  "nvim",
+		Version: "{{ .version }}",
+		Source:  config.PlatformMap{Linux: "https://example.com/{{ .version }}/{{ if .nightly }}nightly{{ end }}/nvim-{{ $.arch | printf \"%s\" }}.tgz"},
+		Run:     "{{ .dir.path }}/install",
+		When:    "{{ .ignored }}",
+	}
+	got, err := Fields(item)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"arch", "dir", "nightly", "version"}; !slices.Equal(got, want) {
+		t.Errorf("Fields = %q, want %q", got, want)
+	}
+
+	if _, err := Fields(config.Item{Run: "{{ .broken"}); err == nil {
+		t.Error("expected a parse error")
+	}
+}
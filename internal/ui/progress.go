@@ -0,0 +1,168 @@
+package ui
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/atomikpanda/dotular/internal/color"
+)
+
+const spinnerInterval = 100 * time.Millisecond
+
+var (
+	spinnerFrames      = []string{"⠋", "⠙", "⠹", "⠸", "⠼", "⠴", "⠦", "⠧", "⠇", "⠏"}
+	spinnerFramesASCII = []string{"|", "/", "-", `\`}
+)
+
+// Spinner animates a status line for a running item on interactive
+// terminals, with an optional byte-progress bar for downloads. On
+// non-interactive output every method is a no-op, so callers need not guard
+// their use.
+//
+// Subprocess output written through Writer is printed above the status line.
+// Once a subprocess has produced output the spinner stops redrawing; the
+// output itself is the progress indicator from then on.
+type Spinner struct {
+	u    *UI
+	desc string
+
+	mu      sync.Mutex
+	frame   int
+	done    int64
+	total   int64
+	drawn   bool // status line currently on screen
+	stopped bool
+	quit    chan struct{}
+	wg      sync.WaitGroup
+}
+
+// StartSpinner begins animating desc. Call Stop when the item finishes.
+func (u *UI) StartSpinner(desc string) *Spinner {
+	s := &Spinner{u: u, desc: desc, total: -1}
+	if !u.Interactive || u.Quiet() {
+		s.stopped = true
+		return s
+	}
+	s.quit = make(chan struct{})
+	s.wg.Add(1)
+	go s.loop()
+	return s
+}
+
+func (s *Spinner) loop() {
+	defer s.wg.Done()
+	t := time.NewTicker(spinnerInterval)
+	defer t.Stop()
+	for {
+		s.mu.Lock()
+		if !s.stopped {
+			s.draw()
+			s.frame++
+		}
+		s.mu.Unlock()
+		select {
+		case <-s.quit:
+			return
+		case <-t.C:
+		}
+	}
+}
+
+// draw renders the status line. The caller holds s.mu.
+func (s *Spinner) draw() {
+	frames := spinnerFramesASCII
+	if color.Enabled {
+		frames = spinnerFrames
+	}
+	line := "  " + color.Cyan(frames[s.frame%len(frames)]) + " " + s.desc
+	if s.done > 0 {
+		line += "  " + color.Dim(progressText(s.done, s.total))
+	}
+	fmt.Fprint(s.u.Out, "\r\x1b[K"+line)
+	s.drawn = true
+}
+
+// clear erases the status line. The caller holds s.mu.
+func (s *Spinner) clear() {
+	if s.drawn {
+		fmt.Fprint(s.u.Out, "\r\x1b[K")
+		s.drawn = false
+	}
+}
+
+// Progress records download progress; total is -1 when unknown.
+func (s *Spinner) Progress(done, total int64) {
+	s.mu.Lock()
+	s.done, s.total = done, total
+	s.mu.Unlock()
+}
+
+// Writer returns a writer for subprocess output, or nil when the spinner is
+// not animating (callers then keep their default streams). Call it before
+// Stop.
+func (s *Spinner) Writer() io.Writer {
+	if s.quit == nil {
+		return nil
+	}
+	return spinnerWriter{s}
+}
+
+type spinnerWriter struct{ s *Spinner }
+
+func (w spinnerWriter) Write(p []byte) (int, error) {
+	w.s.mu.Lock()
+	defer w.s.mu.Unlock()
+	w.s.clear()
+	w.s.stopped = true
+	return w.s.u.Out.Write(p)
+}
+
+// Stop ends the animation and erases the status line.
+func (s *Spinner) Stop() {
+	if s.quit == nil {
+		return
+	}
+	s.mu.Lock()
+	s.stopped = true
+	s.clear()
+	s.mu.Unlock()
+	close(s.quit)
+	s.wg.Wait()
+	s.quit = nil
+}
+
+// progressText formats byte progress as a bar when the total is known and as
+// a plain byte count otherwise.
+func progressText(done, total int64) string {
+	if total <= 0 {
+		return formatBytes(done)
+	}
+	const width = 20
+	frac := float64(done) / float64(total)
+	if frac > 1 {
+		frac = 1
+	}
+	filled := int(frac * width)
+	bar := strings.Repeat("=", filled) + strings.Repeat(" ", width-filled)
+	if filled > 0 && filled < width {
+		bar = bar[:filled-1] + ">" + bar[filled:]
+	}
+	return fmt.Sprintf("[%s] %3.0f%% %s/%s", bar, frac*100, formatBytes(done), formatBytes(total))
+}
+
+// formatBytes formats n using binary units.
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
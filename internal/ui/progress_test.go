@@ -0,0 +1,94 @@
+package ui
+
+import (
+	"bytes"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestFormatBytes(t *testing.T) {
+	tests := map[int64]string{
+		0:                "0 B",
+		1023:             "1023 B",
+		1536:             "1.5 KiB",
+		10 * 1024 * 1024: "10.0 MiB",
+	}
+	for n, want := range tests {
+		if got := formatBytes(n); got != want {
+			t.Errorf("formatBytes(%d) = %q, want %q", n, got, want)
+		}
+	}
+}
+
+func TestProgressText(t *testing.T) {
+	if got := progressText(2048, -1); got != "2.0 KiB" {
+		t.Errorf("unknown total = %q", got)
+	}
+	got := progressText(512, 1024)
+	if !strings.Contains(got, "50%") || !strings.Contains(got, "512 B/1.0 KiB") {
+		t.Errorf("known total = %q", got)
+	}
+	if got := progressText(2048, 1024); !strings.Contains(got, "100%") {
+		t.Errorf("overflow = %q", got)
+	}
+}
+
+func TestSpinnerNonInteractive(t *testing.T) {
+	var buf bytes.Buffer
+	u := New(&buf, &bytes.Buffer{})
+	if u.Interactive {
+		t.Fatal("buffer must not be treated as a terminal")
+	}
+	s := u.StartSpinner("install thing")
+	s.Progress(10, 100)
+	if s.Writer() != nil {
+		t.Error("non-interactive spinner should not wrap subprocess output")
+	}
+	s.Stop()
+	if buf.Len() != 0 {
+		t.Errorf("non-interactive spinner wrote %q", buf.String())
+	}
+}
+
+func TestSpinnerInteractive(t *testing.T) {
+	var buf syncBuffer
+	u := &UI{Out: &buf, Err: &bytes.Buffer{}, Interactive: true}
+	s := u.StartSpinner("download thing")
+	s.Progress(512, 1024)
+	time.Sleep(3 * spinnerInterval)
+	if _, err := s.Writer().Write([]byte("subprocess line\n")); err != nil {
+		t.Fatal(err)
+	}
+	s.Stop()
+
+	out := buf.String()
+	if !strings.Contains(out, "download thing") || !strings.Contains(out, "50%") {
+		t.Errorf("expected status line with progress, got %q", out)
+	}
+	if !strings.Contains(out, "\r\x1b[Ksubprocess line\n") {
+		t.Errorf("expected subprocess output after cleared line, got %q", out)
+	}
+	if strings.HasSuffix(out, "download thing") {
+		t.Error("status line should be cleared on Stop")
+	}
+}
+
+// syncBuffer is a bytes.Buffer safe for the spinner goroutine.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
@@ -3,21 +3,48 @@ package ui
 import (
 	"fmt"
 	"io"
+	"os"
 	"strings"
 	"time"
 
 	"github.com/atomikpanda/dotular/internal/color"
+	"github.com/atomikpanda/dotular/internal/diff"
+)
+
+// Level controls how much progress output a UI writes.
+type Level int
+
+const (
+	LevelQuiet   Level = iota - 1 // errors, warnings, and the final summary only
+	LevelNormal                   // module headers and item results
+	LevelVerbose                  // plus skipped items and hook commands
+	LevelDebug                    // plus expanded paths, resolved actions, and subprocess argv
 )
 
 // UI provides formatted terminal output for dotular commands.
 type UI struct {
-	Out io.Writer
-	Err io.Writer
+	Out   io.Writer
+	Err   io.Writer
+	Level Level
+
+	// Interactive enables animated output (spinners, progress bars). New sets
+	// it when Out is a terminal.
+	Interactive bool
 }
 
 // New creates a UI that writes to the given output and error writers.
 func New(out, err io.Writer) *UI {
-	return &UI{Out: out, Err: err}
+	return &UI{Out: out, Err: err, Interactive: isTerminal(out)}
+}
+
+// isTerminal reports whether w is a character device that can redraw lines.
+func isTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	if !ok || os.Getenv("TERM") == "dumb" {
+		return false
+	}
+	stat, err := f.Stat()
+	return err == nil && stat.Mode()&os.ModeCharDevice != 0
 }
 
 // syms holds a set of display symbols.
@@ -68,45 +95,112 @@ func formatDuration(d time.Duration) string {
 	return fmt.Sprintf("(%dm %ds)", m, s)
 }
 
+// Quiet reports whether progress output is suppressed.
+func (u *UI) Quiet() bool {
+	return u.Level <= LevelQuiet
+}
+
 // Header writes a module header line to Out.
 func (u *UI) Header(name string) {
+	if u.Quiet() {
+		return
+	}
 	fmt.Fprintf(u.Out, "\n%s\n", color.BoldCyan("==> "+name))
 }
 
 // SkipHeader writes a dimmed skip header line to Out.
 func (u *UI) SkipHeader(name, reason string) {
+	if u.Quiet() {
+		return
+	}
 	fmt.Fprintf(u.Out, "\n%s\n", color.Dim("==> "+name+"  [skip: "+reason+"]"))
 }
 
 // Item writes a pending item line to Out.
 func (u *UI) Item(desc string) {
+	if u.Quiet() {
+		return
+	}
 	s := u.symbols()
 	fmt.Fprintf(u.Out, "  %s %s\n", color.Dim(s.Arrow), desc)
 }
 
 // ItemResult writes a completed item line with duration and status to Out.
+// In quiet mode only failures are written.
 func (u *UI) ItemResult(desc string, dur time.Duration, err error) {
 	s := u.symbols()
 	d := color.Dim(formatDuration(dur))
 	if err != nil {
 		fmt.Fprintf(u.Out, "  %s %s %s\n", color.BoldRed(s.Cross), desc, d)
-	} else {
+	} else if !u.Quiet() {
 		fmt.Fprintf(u.Out, "  %s %s %s\n", color.Green(s.Check), desc, d)
 	}
 }
 
+// ItemUnchanged writes a completed item line for an item that ran without
+// changing anything to Out.
+func (u *UI) ItemUnchanged(desc string, dur time.Duration) {
+	if u.Quiet() {
+		return
+	}
+	s := u.symbols()
+	fmt.Fprintf(u.Out, "  %s %s %s\n", color.Dim(s.Check), color.Dim(desc+" (unchanged)"), color.Dim(formatDuration(dur)))
+}
+
 // Skip writes a skipped item line to Out.
 func (u *UI) Skip(reason, desc string) {
+	if u.Quiet() {
+		return
+	}
 	s := u.symbols()
 	fmt.Fprintf(u.Out, "  %s\n", color.Dim(s.Dash+" skip ["+reason+"] "+desc))
 }
 
 // DryRun writes a dry-run item line to Out.
 func (u *UI) DryRun(desc string) {
+	if u.Quiet() {
+		return
+	}
 	s := u.symbols()
 	fmt.Fprintf(u.Out, "  %s\n", color.Dim(s.Arrow+" [dry-run] "+desc))
 }
 
+// DryRunChange writes a dry-run item line to Out, followed by how the item
+// would change its destination: created, modified, or unchanged.
+func (u *UI) DryRunChange(desc, change string) {
+	if u.Quiet() {
+		return
+	}
+	s := u.symbols()
+	paint := color.Dim
+	switch change {
+	case "created":
+		paint = color.Green
+	case "modified":
+		paint = color.Yellow
+	}
+	fmt.Fprintf(u.Out, "  %s %s\n", color.Dim(s.Arrow+" [dry-run] "+desc), paint("("+change+")"))
+}
+
+// DryRunDiff writes a colored unified diff under a dry-run item line,
+// truncated to maxLines lines.
+func (u *UI) DryRunDiff(unified string, maxLines int) {
+	if u.Quiet() || unified == "" {
+		return
+	}
+	lines := strings.Split(strings.TrimSuffix(diff.Colorize(unified), "\n"), "\n")
+	more := 0
+	if len(lines) > maxLines {
+		lines, more = lines[:maxLines], len(lines)-maxLines
+	}
+	for _, line := range lines {
+		fmt.Fprintf(u.Out, "      %s\n", line)
+	}
+	if more > 0 {
+		fmt.Fprintf(u.Out, "      %s\n", color.Dim(fmt.Sprintf("... %d more lines", more)))
+	}
+}
+
 // Warn writes a warning message to Err.
 func (u *UI) Warn(msg string) {
 	s := u.symbols()
@@ -115,6 +209,9 @@ func (u *UI) Warn(msg string) {
 
 // Success writes a success message to Out.
 func (u *UI) Success(msg string) {
+	if u.Quiet() {
+		return
+	}
 	s := u.symbols()
 	fmt.Fprintf(u.Out, "%s\n", color.Green(s.Check+" "+msg))
 }
@@ -124,6 +221,14 @@ func (u *UI) Info(msg string) {
 	fmt.Fprintf(u.Out, "%s\n", msg)
 }
 
+// Debug writes a dimmed diagnostic message to Err at LevelDebug.
+func (u *UI) Debug(msg string) {
+	if u.Level < LevelDebug {
+		return
+	}
+	fmt.Fprintf(u.Err, "%s\n", color.Dim("  [debug] "+msg))
+}
+
 // summaryIcon returns the appropriate icon and color function for a summary line.
 func (u *UI) summaryIcon(applied, failed int) (string, func(string) string) {
 	s := u.symbols()
@@ -146,6 +251,9 @@ func (u *UI) Summary(applied, skipped, failed int, elapsed time.Duration) {
 
 // ModuleSummary writes an indented summary line for a single module to Out.
 func (u *UI) ModuleSummary(applied, skipped, failed int) {
+	if u.Quiet() {
+		return
+	}
 	icon, colorFn := u.summaryIcon(applied, failed)
 	body := fmt.Sprintf("%s %d applied, %d skipped, %d failed",
 		icon, applied, skipped, failed)
@@ -386,3 +386,44 @@ func TestTableEmpty(t *testing.T) {
 		t.Errorf("separator line = %q, want to contain dashes", lines[1])
 	}
 }
+
+func TestQuietLevel(t *testing.T) {
+	var out, errBuf bytes.Buffer
+	u := New(&out, &errBuf)
+	u.Level = LevelQuiet
+
+	u.Header("mod")
+	u.Item("item")
+	u.Skip("reason", "item")
+	u.DryRun("item")
+	u.Success("done")
+	u.ModuleSummary(1, 0, 0)
+	u.ItemResult("ok item", time.Millisecond, nil)
+	if out.Len() != 0 {
+		t.Errorf("quiet mode wrote progress output: %q", out.String())
+	}
+
+	u.ItemResult("bad item", time.Millisecond, errors.New("boom"))
+	u.Summary(0, 0, 1, time.Second)
+	u.Warn("careful")
+	if !strings.Contains(out.String(), "bad item") || !strings.Contains(out.String(), "1 failed") {
+		t.Errorf("quiet mode must keep failures and summary: %q", out.String())
+	}
+	if !strings.Contains(errBuf.String(), "careful") {
+		t.Error("quiet mode must keep warnings")
+	}
+}
+
+func TestDebugLevel(t *testing.T) {
+	var errBuf bytes.Buffer
+	u := New(&bytes.Buffer{}, &errBuf)
+	u.Debug("hidden")
+	if errBuf.Len() != 0 {
+		t.Errorf("debug output at normal level: %q", errBuf.String())
+	}
+	u.Level = LevelDebug
+	u.Debug("exec: brew install git")
+	if !strings.Contains(errBuf.String(), "[debug] exec: brew install git") {
+		t.Errorf("debug output = %q", errBuf.String())
+	}
+}
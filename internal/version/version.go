@@ -0,0 +1,145 @@
+// Package version finds version numbers in program output and checks them
+// against constraints such as ">=0.10" or ">=1.2, <2".
+package version
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Version is a dotted numeric version, e.g. [0 10 1] for "0.10.1".
+type Version []int
+
+var versionPattern = regexp.MustCompile(`\d+(?:\.\d+)+|\d+`)
+
+var exactPattern = regexp.MustCompile(`^(\d+(?:\.\d+)*)(?:[-+].*)?$`)
+
+// Parse parses a dotted version such as "0.10.1" or "v1.2". Anything after
+// the numeric part ("-beta", "+build") is ignored.
+func Parse(s string) (Version, error) {
+	m := exactPattern.FindStringSubmatch(strings.TrimPrefix(strings.TrimSpace(s), "v"))
+	if m == nil {
+		return nil, fmt.Errorf("invalid version %q", s)
+	}
+	var v Version
+	for _, part := range strings.Split(m[1], ".") {
+		n, err := strconv.Atoi(part)
+		if err != nil {
+			return nil, fmt.Errorf("invalid version %q: %w", s, err)
+		}
+		v = append(v, n)
+	}
+	return v, nil
+}
+
+// Find returns the first dotted version in output, e.g. 0.10.1 in
+// "NVIM v0.10.1". Versions with at least two parts are preferred over bare
+// numbers.
+func Find(output string) (Version, bool) {
+	matches := versionPattern.FindAllString(output, -1)
+	for _, m := range matches {
+		if strings.Contains(m, ".") {
+			v, err := Parse(m)
+			return v, err == nil
+		}
+	}
+	if len(matches) > 0 {
+		v, err := Parse(matches[0])
+		return v, err == nil
+	}
+	return nil, false
+}
+
+// Compare returns -1, 0, or 1 as v is older than, the same as, or newer
+// than w. Missing parts count as zero, so 1.2 equals 1.2.0.
+func (v Version) Compare(w Version) int {
+	for i := 0; i < len(v) || i < len(w); i++ {
+		var a, b int
+		if i < len(v) {
+			a = v[i]
+		}
+		if i < len(w) {
+			b = w[i]
+		}
+		switch {
+		case a < b:
+			return -1
+		case a > b:
+			return 1
+		}
+	}
+	return 0
+}
+
+func (v Version) String() string {
+	parts := make([]string, len(v))
+	for i, n := range v {
+		parts[i] = strconv.Itoa(n)
+	}
+	return strings.Join(parts, ".")
+}
+
+// Constraint is a comma-separated list of comparisons that must all hold,
+// e.g. ">=1.2, <2". A comparison without an operator means ">=".
+type Constraint struct {
+	raw   string
+	terms []term
+}
+
+type term struct {
+	op string
+	v  Version
+}
+
+var operators = []string{">=", "<=", "==", "!=", ">", "<", "="}
+
+// ParseConstraint parses a constraint such as ">=0.10".
+func ParseConstraint(s string) (Constraint, error) {
+	c := Constraint{raw: s}
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		op := ">="
+		for _, o := range operators {
+			if rest, ok := strings.CutPrefix(part, o); ok {
+				op, part = o, strings.TrimSpace(rest)
+				break
+			}
+		}
+		v, err := Parse(part)
+		if err != nil {
+			return Constraint{}, fmt.Errorf("invalid version constraint %q: %w", s, err)
+		}
+		c.terms = append(c.terms, term{op, v})
+	}
+	return c, nil
+}
+
+// Check reports whether v satisfies every comparison of c.
+func (c Constraint) Check(v Version) bool {
+	for _, t := range c.terms {
+		cmp := v.Compare(t.v)
+		var ok bool
+		switch t.op {
+		case ">=":
+			ok = cmp >= 0
+		case "<=":
+			ok = cmp <= 0
+		case ">":
+			ok = cmp > 0
+		case "<":
+			ok = cmp < 0
+		case "=", "==":
+			ok = cmp == 0
+		case "!=":
+			ok = cmp != 0
+		}
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+func (c Constraint) String() string { return c.raw }
@@ -0,0 +1,69 @@
+package version
+
+import "testing"
+
+func TestFind(t *testing.T) {
+	tests := map[string]string{
+		"NVIM v0.10.1\nBuild type: Release":  "0.10.1",
+		"ripgrep 14.1.0 (rev e50df40a19)":    "14.1.0",
+		"git version 2.39.3 (Apple Git-145)": "2.39.3",
+		"tool 7":                             "7",
+	}
+	for out, want := range tests {
+		v, ok := Find(out)
+		if !ok || v.String() != want {
+			t.Errorf("Find(%q) = %v, %v; want %s", out, v, ok, want)
+		}
+	}
+	if _, ok := Find("no version here"); ok {
+		t.Error("found a version in output without one")
+	}
+}
+
+func TestCompare(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"0.10", "0.9", 1},
+		{"1.2", "1.2.0", 0},
+		{"1.2.3", "1.10", -1},
+		{"v2", "1.99", 1},
+	}
+	for _, tt := range tests {
+		a, _ := Parse(tt.a)
+		b, _ := Parse(tt.b)
+		if got := a.Compare(b); got != tt.want {
+			t.Errorf("Compare(%s, %s) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestConstraint(t *testing.T) {
+	tests := []struct {
+		constraint, version string
+		want                bool
+	}{
+		{">=0.10", "0.10.1", true},
+		{">=0.10", "0.9.5", false},
+		{"0.10", "0.11", true},
+		{">=1.2, <2", "1.9", true},
+		{">=1.2, <2", "2.0", false},
+		{"=1.2", "1.2.0", true},
+		{"!=1.2", "1.2", false},
+		{"<3", "2.99.1", true},
+	}
+	for _, tt := range tests {
+		c, err := ParseConstraint(tt.constraint)
+		if err != nil {
+			t.Fatal(err)
+		}
+		v, _ := Parse(tt.version)
+		if got := c.Check(v); got != tt.want {
+			t.Errorf("%q.Check(%s) = %v, want %v", tt.constraint, tt.version, got, tt.want)
+		}
+	}
+	if _, err := ParseConstraint(">=latest"); err == nil {
+		t.Error("expected an error for a non-numeric version")
+	}
+}
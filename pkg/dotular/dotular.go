@@ -0,0 +1,286 @@
+// Package dotular is the Go API for embedding dotular in other programs,
+// such as provisioning tools or GUIs, without shelling out to the CLI.
+//
+// A typical caller loads the config, resolves its registry modules, and then
+// plans, applies, or checks it:
+//
+//	d, err := dotular.Load("")
+//	if err != nil {
+//		return err
+//	}
+//	if err := d.Resolve(ctx, dotular.Options{}); err != nil {
+//		return err
+//	}
+//	res, err := d.Apply(ctx, dotular.Options{Modules: []string{"git"}})
+//
+// Progress is written to Options.Stdout and Options.Stderr, which default to
+// the process's own; prompts such as sync conflicts read standard input.
+package dotular
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/atomikpanda/dotular/internal/ageutil"
+	"github.com/atomikpanda/dotular/internal/config"
+	"github.com/atomikpanda/dotular/internal/errs"
+	"github.com/atomikpanda/dotular/internal/httpclient"
+	"github.com/atomikpanda/dotular/internal/registry"
+	"github.com/atomikpanda/dotular/internal/runner"
+	"github.com/atomikpanda/dotular/internal/ui"
+)
+
+// Config types, as parsed from dotular.yaml.
+type (
+	Config = config.Config
+	Module = config.Module
+	Item   = config.Item
+)
+
+// Plan types; see Dotfiles.Plan.
+type (
+	Plan          = runner.Plan
+	ModulePlan    = runner.ModulePlan
+	PlannedAction = runner.PlannedAction
+)
+
+// Planned action statuses.
+const (
+	StatusApply = runner.StatusApply
+	StatusSkip  = runner.StatusSkip
+)
+
+// DriftResult reports whether a copied file or directory item has changed
+// since it was applied.
+type DriftResult = runner.DriftResult
+
+// Drift statuses.
+const (
+	DriftInSync     = runner.DriftInSync
+	DriftSystem     = runner.DriftSystem
+	DriftRepo       = runner.DriftRepo
+	DriftBoth       = runner.DriftBoth
+	DriftUnknown    = runner.DriftUnknown
+	DriftNotApplied = runner.DriftNotApplied
+)
+
+// Result counts the items of an apply. After a dry run, Applied counts the
+// items that would change.
+type Result = runner.ModuleResult
+
+// Error kinds returned by this package, for use with errors.Is.
+var (
+	ErrModuleNotFound   = errs.ErrModuleNotFound
+	ErrConflict         = errs.ErrConflict
+	ErrChecksumMismatch = errs.ErrChecksumMismatch
+	ErrNeedsElevation   = errs.ErrNeedsElevation
+	ErrAborted          = errs.ErrAborted
+	ErrLocked           = errs.ErrLocked
+	ErrNotAccepted      = errs.ErrNotAccepted
+)
+
+// ChecksumError details an ErrChecksumMismatch.
+type ChecksumError = errs.ChecksumError
+
+// Keep-going modes for Options.KeepGoing.
+const (
+	KeepGoingModule = runner.KeepGoingModule
+	KeepGoingItem   = runner.KeepGoingItem
+)
+
+// Options control a Resolve, Plan, Apply, or Status call. The zero value
+// applies every module matching the machine's tags, with rollback, and
+// aborts on the first failure.
+type Options struct {
+	DryRun bool
+	// ShowDiff prints, in a dry run, a diff under each file push that
+	// would modify its destination.
+	ShowDiff bool
+	// Modules are module or group names; empty means every module whose
+	// tags match the machine.
+	Modules []string
+	// Only and Skip filter items by type, as the --only and --skip flags
+	// do (e.g. "files", "packages").
+	Only, Skip []string
+	KeepGoing  string // "", KeepGoingModule, or KeepGoingItem
+	NoAtomic   bool   // disable snapshot and rollback per module
+	NoCache    bool   // re-fetch registry modules and downloads
+	Verbose    bool
+	Wait       bool // queue behind another process applying the same config instead of failing with ErrLocked
+	Stdout     io.Writer
+	Stderr     io.Writer
+}
+
+// Dotfiles is a loaded config and the path it was loaded from, which
+// module stores, scripts, and the registry lockfile are relative to.
+type Dotfiles struct {
+	Config Config
+	Path   string
+}
+
+// Load reads the config at path. An empty path discovers it the way the
+// CLI does: $DOTULAR_CONFIG, dotular.yaml in the working directory or a
+// parent, ~/dotfiles, or ~/.dotfiles. Registry modules are not fetched
+// until Resolve.
+func Load(path string) (*Dotfiles, error) {
+	if path == "" {
+		found, err := config.Discover(".")
+		if err != nil {
+			return nil, err
+		}
+		path = found
+	}
+	cfg, err := config.Load(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	if err := httpclient.Configure(cfg.HTTP); err != nil {
+		return nil, err
+	}
+	if err := registry.ConfigureMirrors(cfg.Registry, cfg.HTTP); err != nil {
+		return nil, err
+	}
+	registry.ConfigureLock(cfg.Lock.Encrypt, ageutil.FromConfig(cfg.Age, cfg.Shell))
+	return &Dotfiles{Config: cfg, Path: path}, nil
+}
+
+// Resolve fetches the registry modules the config refers to with `from:`
+// and replaces them with their items. Only Stdout, Stderr, NoCache, and
+// Verbose of opts apply.
+func (d *Dotfiles) Resolve(ctx context.Context, opts Options) error {
+	cfg, err := registry.Resolve(ctx, d.Config, d.Path, opts.NoCache, opts.ui())
+	if err != nil {
+		return err
+	}
+	d.Config = cfg
+	return nil
+}
+
+// Plan reports what Apply would do without changing anything. skip_if
+// commands and idempotency checks are run.
+func (d *Dotfiles) Plan(ctx context.Context, opts Options) (*Plan, error) {
+	r, err := d.runner(opts)
+	if err != nil {
+		return nil, err
+	}
+	if len(opts.Modules) == 0 {
+		return r.Plan(ctx)
+	}
+	mods, err := d.Config.Select(opts.Modules)
+	if err != nil {
+		return nil, err
+	}
+	plan := &Plan{}
+	for _, mod := range mods {
+		mp, err := r.PlanModule(ctx, mod)
+		if err != nil {
+			return nil, err
+		}
+		plan.Modules = append(plan.Modules, mp)
+	}
+	return plan, nil
+}
+
+// Apply applies the selected modules and returns the item counts, which are
+// also set when the error is non-nil.
+func (d *Dotfiles) Apply(ctx context.Context, opts Options) (Result, error) {
+	r, err := d.runner(opts)
+	if err != nil {
+		return Result{}, err
+	}
+	if len(opts.Modules) == 0 {
+		err = r.ApplyAll(ctx)
+	} else {
+		mods, selErr := d.Config.Select(opts.Modules)
+		if selErr != nil {
+			return Result{}, selErr
+		}
+		err = r.ApplyModules(ctx, mods)
+	}
+	return r.Totals(), err
+}
+
+// Status is the state of the machine relative to the config.
+type Status struct {
+	Plan  *Plan
+	Drift []DriftResult
+}
+
+// InSync reports whether nothing would be applied and no copied file has
+// drifted, as `dotular status --exit-code` does.
+func (s *Status) InSync() bool {
+	for _, mp := range s.Plan.Modules {
+		for _, pa := range mp.Actions {
+			if pa.Status == StatusApply {
+				return false
+			}
+		}
+	}
+	for _, d := range s.Drift {
+		if d.Status != DriftInSync {
+			return false
+		}
+	}
+	return true
+}
+
+// Status plans the config and checks copied files for drift, without
+// changing anything.
+func (d *Dotfiles) Status(ctx context.Context, opts Options) (*Status, error) {
+	plan, err := d.Plan(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	r, err := d.runner(opts)
+	if err != nil {
+		return nil, err
+	}
+	return &Status{Plan: plan, Drift: r.Drift()}, nil
+}
+
+func (o Options) ui() *ui.UI {
+	stdout, stderr := o.Stdout, o.Stderr
+	if stdout == nil {
+		stdout = os.Stdout
+	}
+	if stderr == nil {
+		stderr = os.Stderr
+	}
+	u := ui.New(stdout, stderr)
+	if o.Verbose {
+		u.Level = ui.LevelVerbose
+	}
+	return u
+}
+
+// runner builds a runner for d configured like the CLI's.
+func (d *Dotfiles) runner(opts Options) (*runner.Runner, error) {
+	only, err := runner.ParseItemTypes(opts.Only)
+	if err != nil {
+		return nil, err
+	}
+	skip, err := runner.ParseItemTypes(opts.Skip)
+	if err != nil {
+		return nil, err
+	}
+	r := runner.New(d.Config, opts.DryRun, opts.Verbose, !opts.NoAtomic)
+	r.UI = opts.ui()
+	if opts.Stdout != nil {
+		r.Out = opts.Stdout
+	}
+	r.OnlyTypes, r.SkipTypes = only, skip
+	r.KeepGoing = opts.KeepGoing
+	r.NoCache = opts.NoCache
+	r.ShowDiff = opts.ShowDiff
+	r.Wait = opts.Wait
+	r.ConfigPath = d.Path
+	if root, err := filepath.Abs(filepath.Dir(d.Path)); err == nil {
+		r.Root = root
+	}
+	return r, nil
+}
@@ -0,0 +1,113 @@
+package dotular
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("XDG_STATE_HOME", "")
+	t.Setenv("XDG_DATA_HOME", "")
+	t.Setenv("XDG_CONFIG_HOME", "")
+	path := filepath.Join(t.TempDir(), "dotular.yaml")
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadInvalid(t *testing.T) {
+	path := writeConfig(t, "modules:\n  - name: x\n    items: [{via: brew}]\n")
+	if _, err := Load(path); err == nil {
+		t.Error("expected a validation error")
+	}
+}
+
+func TestLoadConfiguresMirrors(t *testing.T) {
+	path := writeConfig(t, `
+registry:
+  mirrors:
+    - url: https://mirror.example.com
+      ca_bundle: /nonexistent/ca.pem
+modules: []
+`)
+	if _, err := Load(path); err == nil || !strings.Contains(err.Error(), "mirror.example.com") {
+		t.Errorf("Load err = %v, want the mirror's CA bundle error", err)
+	}
+}
+
+func TestPlanApplyStatus(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Unix-only test")
+	}
+	marker := filepath.Join(t.TempDir(), "marker")
+	path := writeConfig(t, `
+modules:
+  - name: marker
+    items:
+      - run: touch `+marker+`
+        skip_if: test -f `+marker+`
+  - name: other
+    items:
+      - run: "true"
+`)
+	d, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	var out bytes.Buffer
+	opts := Options{Modules: []string{"marker"}, Stdout: &out, Stderr: &out}
+
+	plan, err := d.Plan(ctx, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plan.Modules) != 1 || plan.Modules[0].Actions[0].Status != StatusApply {
+		t.Fatalf("plan = %+v", plan.Modules)
+	}
+
+	st, err := d.Status(ctx, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.InSync() {
+		t.Error("expected out of sync before apply")
+	}
+
+	res, err := d.Apply(ctx, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Applied != 1 {
+		t.Errorf("Apply result = %+v, want 1 applied", res)
+	}
+
+	st, err = d.Status(ctx, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !st.InSync() {
+		t.Errorf("expected in sync after apply: %+v", st.Plan.Modules)
+	}
+}
+
+func TestApplyUnknownModule(t *testing.T) {
+	path := writeConfig(t, "modules:\n  - name: x\n    items: [{run: 'true'}]\n")
+	d, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = d.Apply(context.Background(), Options{Modules: []string{"missing"}})
+	if !errors.Is(err, ErrModuleNotFound) {
+		t.Errorf("err = %v, want ErrModuleNotFound", err)
+	}
+}